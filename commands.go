@@ -0,0 +1,188 @@
+// Copyright (c) OpenFaaS Author(s) 2020. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openfaas/faas-netes/pkg/certificates"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/openfaas/faas-netes/pkg/signals"
+	"github.com/openfaas/faas-netes/pkg/webhook"
+	version "github.com/openfaas/faas-netes/version"
+)
+
+const (
+	// commandController runs the REST provider, it is the default command
+	commandController = "controller"
+	// commandOperator runs the CRD operator
+	commandOperator = "operator"
+	// commandWebhook serves the validating admission webhook for Functions
+	commandWebhook = "webhook"
+	commandRender  = "render"
+	commandVersion = "version"
+)
+
+const usage = `Usage: faas-netes [command] [flags]
+
+Commands:
+  controller  Serve the REST provider API (default)
+  operator    Run the operator for the Function CRD
+  webhook     Serve the validating admission webhook for Functions
+  render      Write the manifests to install faas-netes without Helm
+  version     Print the version
+
+Run faas-netes [command] -h for the flags of a command.
+`
+
+// parseCommand splits the command from its flags, the controller is run when
+// the first argument is a flag so that the flags of earlier releases still work
+func parseCommand(args []string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return commandController, args, nil
+	}
+
+	switch args[0] {
+	case commandController, commandOperator, commandWebhook, commandRender, commandVersion:
+		return args[0], args[1:], nil
+	}
+	return "", nil, fmt.Errorf("unknown command: %s", args[0])
+}
+
+// sharedFlags are the flags of each command that runs against the cluster
+type sharedFlags struct {
+	kubeconfig string
+	masterURL  string
+	verbose    bool
+
+	kubeAPIQPS     float64
+	kubeAPIBurst   int
+	protobuf       bool
+	kubeAPITimeout time.Duration
+
+	logFormat           string
+	logLevel            string
+	logSampleInitial    int
+	logSampleThereafter int
+}
+
+// newFlagSet returns the flags of a command, with the shared flags registered
+func newFlagSet(command string) (*flag.FlagSet, *sharedFlags) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	shared := &sharedFlags{}
+
+	flags.StringVar(&shared.kubeconfig, "kubeconfig", "",
+		"Path to a kubeconfig. Only required if out-of-cluster.")
+	flags.BoolVar(&shared.verbose, "verbose", false, "Print verbose config information")
+	flags.StringVar(&shared.masterURL, "master", "",
+		"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+
+	flags.Float64Var(&shared.kubeAPIQPS, "kube-api-qps", 100, "Maximum queries per second to the Kubernetes API server")
+	flags.IntVar(&shared.kubeAPIBurst, "kube-api-burst", 250, "Maximum burst of queries to the Kubernetes API server")
+	flags.BoolVar(&shared.protobuf, "kube-api-protobuf", true, "Use protobuf instead of JSON for the built-in Kubernetes API groups")
+	flags.DurationVar(&shared.kubeAPITimeout, "kube-api-timeout", k8s.DefaultAPITimeout, "Timeout of each call to the Kubernetes API made for a request to the provider, 0 disables it")
+
+	flags.StringVar(&shared.logFormat, "log-format", logging.FormatJSON, "Format of the logs, either json or text")
+	flags.StringVar(&shared.logLevel, "log-level", "info", "Level of the logs, either error, info, debug or a verbosity number")
+	flags.IntVar(&shared.logSampleInitial, "log-sample-initial", 0, "Number of log lines with the same message written each second before sampling, 0 disables sampling")
+	flags.IntVar(&shared.logSampleThereafter, "log-sample-thereafter", 100, "Write every Nth log line with the same message once sampling has started")
+
+	return flags, shared
+}
+
+// setupLogging makes the logger of the flags the default one, it exits when the
+// flags are invalid
+func (f *sharedFlags) setupLogging() logr.Logger {
+	level, err := logging.ParseLevel(f.logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stderr, logging.Config{
+		Format:           f.logFormat,
+		Level:            level,
+		SampleInitial:    f.logSampleInitial,
+		SampleThereafter: f.logSampleThereafter,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	logging.SetDefault(logger)
+	logging.RedirectStdLog(logger.WithName("faas-provider"))
+	return logger
+}
+
+// runVersion prints the version and commit of the build
+func runVersion(w io.Writer) {
+	fmt.Fprintf(w, "faas-netes - Community Edition (CE)\nversion: %s\ncommit: %s\n", version.BuildVersion(), version.GitCommit)
+}
+
+// runWebhook serves the validating admission webhook for Functions over TLS, the
+// API server only calls webhooks over HTTPS. The certificate is reloaded from
+// its files when it is rotated.
+func runWebhook(args []string) {
+	flags, shared := newFlagSet(commandWebhook)
+	var port int
+	var certFile, keyFile string
+	var reloadInterval time.Duration
+	flags.IntVar(&port, "port", 8443, "Port to serve the webhook on")
+	flags.StringVar(&certFile, "tls-cert-file", "", "Path to the TLS certificate of the webhook")
+	flags.StringVar(&keyFile, "tls-key-file", "", "Path to the TLS key of the webhook")
+	flags.DurationVar(&reloadInterval, "tls-reload-interval", time.Second*30, "How often the TLS files are checked for changes")
+	flags.Parse(args)
+
+	logger := shared.setupLogging()
+
+	sha, release := version.GetReleaseInfo()
+	logger.Info("faas-netes - Community Edition (CE)", "version", release, "commit", sha, "mode", commandWebhook)
+
+	if certFile == "" || keyFile == "" {
+		fatal(nil, "The webhook requires -tls-cert-file and -tls-key-file")
+	}
+
+	reloader, err := certificates.NewReloader(certFile, keyFile, "")
+	if err != nil {
+		fatal(err, "Error loading the TLS certificate")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx, reloadInterval)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate", logging.Middleware(webhook.MakeValidatingHandler()))
+	mux.HandleFunc("/healthz", handlers.MakeHealthHandler())
+
+	server := &http.Server{
+		Addr:           fmt.Sprintf(":%d", port),
+		ReadTimeout:    time.Second * 10,
+		WriteTimeout:   time.Second * 10,
+		MaxHeaderBytes: http.DefaultMaxHeaderBytes,
+		Handler:        mux,
+		TLSConfig:      reloader.TLSConfig(),
+	}
+
+	stopCh := signals.SetupSignalHandler()
+	go func() {
+		<-stopCh
+		server.Shutdown(context.Background())
+	}()
+
+	logger.Info("Serving the admission webhook over TLS", "port", port)
+	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		fatal(err, "Error serving the admission webhook")
+	}
+}
@@ -0,0 +1,20 @@
+#!/bin/bash
+
+# Regenerates the Go code of the gRPC provider API, protoc must be installed
+
+set -e
+
+export PATH="$GOPATH/bin:$PATH"
+
+if [ ! -e "$GOPATH/bin/protoc-gen-go" ]; then
+  go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.31.0
+fi
+
+if [ ! -e "$GOPATH/bin/protoc-gen-go-grpc" ]; then
+  go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.3.0
+fi
+
+protoc \
+  --go_out=. --go_opt=paths=source_relative \
+  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+  pkg/providerpb/provider.proto
@@ -5,37 +5,64 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
-	"log"
+	"net"
+	"net/http"
 	"os"
 	"time"
 
+	"github.com/openfaas/faas-netes/pkg/async"
+	"github.com/openfaas/faas-netes/pkg/certificates"
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
 	informers "github.com/openfaas/faas-netes/pkg/client/informers/externalversions"
 	v1 "github.com/openfaas/faas-netes/pkg/client/informers/externalversions/openfaas/v1"
 	"github.com/openfaas/faas-netes/pkg/config"
 	"github.com/openfaas/faas-netes/pkg/controller"
+	"github.com/openfaas/faas-netes/pkg/events"
 	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/imagepolicy"
 	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/openfaas/faas-netes/pkg/metrics"
+	"github.com/openfaas/faas-netes/pkg/mock"
+	"github.com/openfaas/faas-netes/pkg/providergrpc"
+	"github.com/openfaas/faas-netes/pkg/providerpb"
+	"github.com/openfaas/faas-netes/pkg/rbac"
 	"github.com/openfaas/faas-netes/pkg/signals"
+	"github.com/openfaas/faas-netes/pkg/tracing"
 	version "github.com/openfaas/faas-netes/version"
 	faasProvider "github.com/openfaas/faas-provider"
+	"github.com/openfaas/faas-provider/auth"
 	"github.com/openfaas/faas-provider/logs"
 	"github.com/openfaas/faas-provider/proxy"
 	providertypes "github.com/openfaas/faas-provider/types"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	kubeinformers "k8s.io/client-go/informers"
 	v1apps "k8s.io/client-go/informers/apps/v1"
 	v1core "k8s.io/client-go/informers/core/v1"
+	v1discovery "k8s.io/client-go/informers/discovery/v1"
 	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/klog"
 
 	// required to authenticate against GKE clusters
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
+	// the image has no time zone database for the time zone of the scaling schedules
+	_ "time/tzdata"
+
 	// required for updating and validating the CRD clientset
 	_ "k8s.io/code-generator/cmd/client-gen/generators"
 	// main.go:36:2: import "sigs.k8s.io/controller-tools/cmd/controller-gen" is a program, not an importable package
@@ -43,79 +70,132 @@ import (
 )
 
 func main() {
-	var kubeconfig string
-	var masterURL string
-	var (
-		operator,
-		verbose bool
-	)
-
-	flag.StringVar(&kubeconfig, "kubeconfig", "",
-		"Path to a kubeconfig. Only required if out-of-cluster.")
-	flag.BoolVar(&verbose, "verbose", false, "Print verbose config information")
-	flag.StringVar(&masterURL, "master", "",
-		"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	command, args, err := parseCommand(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
 
-	flag.BoolVar(&operator, "operator", false, "Use the operator mode instead of faas-netes")
-	flag.Parse()
+	switch command {
+	case commandRender:
+		if err := runRender(args, os.Stdout); err != nil {
+			if err != flag.ErrHelp {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+			os.Exit(1)
+		}
+	case commandVersion:
+		runVersion(os.Stdout)
+	case commandWebhook:
+		runWebhook(args)
+	default:
+		runProvider(command, args)
+	}
+}
 
-	if operator {
-		klog.Errorf("The operator mode is deprecated in OpenFaaS Community Edition (CE), upgrade to OpenFaaS Pro to continue using it")
-		os.Exit(1)
+// runProvider runs the REST provider, or the operator for the Function CRD
+func runProvider(command string, args []string) {
+	flags, shared := newFlagSet(command)
+	var legacyOperator, dryRun, mockMode bool
+	if command == commandController {
+		flags.BoolVar(&legacyOperator, "operator", false, "Deprecated: use the operator command instead")
 	}
+	flags.BoolVar(&mockMode, "mock", false, "Serve the provider API against in-memory fake clientsets without a cluster, for integration tests")
+	flags.BoolVar(&dryRun, "dry-run", false, "Run the operator without applying changes, the diff for each Function is logged and served on /system/dry-run")
+	flags.Parse(args)
+
+	operator := command == commandOperator || legacyOperator
+	logger := shared.setupLogging()
 
 	mode := "controller"
+	if operator {
+		mode = "operator"
+		if dryRun {
+			mode = "operator (dry-run)"
+		}
+	}
 
 	sha, release := version.GetReleaseInfo()
-	fmt.Printf("faas-netes - Community Edition (CE)\n"+
-		"\nVersion: %s Commit: %s Mode: %s\n", release, sha, mode)
+	logger.Info("faas-netes - Community Edition (CE)", "version", release, "commit", sha, "mode", mode)
 
-	clientCmdConfig, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
+	shutdownTracing, err := tracing.Setup(context.Background(), "faas-netes", release)
 	if err != nil {
-		log.Fatalf("Error building kubeconfig: %s", err.Error())
+		fatal(err, "Error setting up tracing")
 	}
 
-	kubeconfigQPS := 100
-	kubeconfigBurst := 250
-
-	clientCmdConfig.QPS = float32(kubeconfigQPS)
-	clientCmdConfig.Burst = kubeconfigBurst
+	readConfig := config.ReadConfig{}
+	osEnv := providertypes.OsEnv{}
 
-	kubeClient, err := kubernetes.NewForConfig(clientCmdConfig)
-	if err != nil {
-		log.Fatalf("Error building Kubernetes clientset: %s", err.Error())
+	// the settings in the config file take precedence over the environment
+	var env providertypes.HasEnv = osEnv
+	if configFile := osEnv.Getenv("config_file"); configFile != "" {
+		fileEnv, err := config.ReadFileEnv(configFile, osEnv)
+		if err != nil {
+			fatal(err, "Error reading config file")
+		}
+		env = fileEnv
 	}
 
-	faasClient, err := clientset.NewForConfig(clientCmdConfig)
+	config, err := readConfig.Read(env)
+
 	if err != nil {
-		log.Fatalf("Error building OpenFaaS clientset: %s", err.Error())
+		fatal(err, "Error reading config")
 	}
 
-	readConfig := config.ReadConfig{}
-	osEnv := providertypes.OsEnv{}
-	config, err := readConfig.Read(osEnv)
+	config.Fprint(shared.verbose)
+
+	var kubeClient kubernetes.Interface
+	var faasClient clientset.Interface
+	var dynamicClient dynamic.Interface
+	if mockMode {
+		logger.Info("Serving the provider API against in-memory fake clientsets, functions can not be invoked")
+		kubeClient, faasClient, dynamicClient = mock.NewClients(config.DefaultFunctionNamespace, config.ProfilesNamespace)
+		go mock.RunStatusUpdater(context.Background(), kubeClient, config.DefaultFunctionNamespace)
+	} else {
+		kubeClient, faasClient, dynamicClient = newClients(shared.masterURL, shared.kubeconfig, shared.kubeAPIQPS, shared.kubeAPIBurst, shared.protobuf)
+	}
 
+	defaultResources, err := config.DefaultResources()
 	if err != nil {
-		log.Fatalf("Error reading config: %s", err.Error())
+		fatal(err, "Error reading default resources")
 	}
 
-	config.Fprint(verbose)
+	rollout, err := config.Rollout()
+	if err != nil {
+		fatal(err, "Error reading rollout config")
+	}
 
 	deployConfig := k8s.DeploymentConfig{
-		RuntimeHTTPPort: 8080,
-		HTTPProbe:       config.HTTPProbe,
-		SetNonRootUser:  config.SetNonRootUser,
-		ReadinessProbe: &k8s.ProbeConfig{
-			InitialDelaySeconds: int32(2),
-			TimeoutSeconds:      int32(1),
-			PeriodSeconds:       int32(2),
+		RuntimeHTTPPort: int32(config.FunctionPort),
+		WatchdogEnv: k8s.WatchdogEnv{
+			Process:      config.WatchdogProcessEnv,
+			ReadTimeout:  config.WatchdogReadTimeoutEnv,
+			WriteTimeout: config.WatchdogWriteTimeoutEnv,
+			ExecTimeout:  config.WatchdogExecTimeoutEnv,
 		},
-		LivenessProbe: &k8s.ProbeConfig{
-			InitialDelaySeconds: int32(2),
-			TimeoutSeconds:      int32(1),
-			PeriodSeconds:       int32(2),
+		HTTPProbe:                   config.HTTPProbe,
+		SetNonRootUser:              config.SetNonRootUser,
+		NonRootUserID:               config.NonRootUserID,
+		NonRootGroupID:              config.NonRootGroupID,
+		RestrictedPodSecurity:       config.RestrictedPodSecurity,
+		ForceReadOnlyRootFilesystem: config.ForceReadOnlyRootFilesystem,
+		ReadinessProbe:              &config.ReadinessProbe,
+		LivenessProbe:               &config.LivenessProbe,
+		Live:                        k8s.NewLiveConfig(config.LiveSettings()),
+		ProfilesNamespace:           config.ProfilesNamespace,
+		VPARecommendations:          config.VPARecommendations,
+		MeshMode:                    config.MeshMode,
+		PrewarmImage:                config.PrewarmImage,
+		CostLabels:                  k8s.ParseCostLabels(config.CostLabels),
+		SecretSelector:              config.SecretSelector,
+		SecretsStore: k8s.SecretsStoreConfig{
+			VaultAddress: config.VaultAddress,
+			VaultRole:    config.VaultRole,
 		},
-		ProfilesNamespace: config.ProfilesNamespace,
+		APITimeout:       shared.kubeAPITimeout,
+		DefaultResources: defaultResources,
+		Rollout:          rollout,
 	}
 
 	// the sync interval does not affect the scale to/from zero feature
@@ -125,34 +205,84 @@ func main() {
 	namespaceScope := config.DefaultFunctionNamespace
 
 	if namespaceScope == "" {
-		klog.Fatal("DefaultFunctionNamespace must be set")
+		fatal(nil, "DefaultFunctionNamespace must be set")
 	}
 
+	// the initial lists are paginated so that a cold start with thousands of
+	// functions does not depend on a single large response
 	kubeInformerOpt := kubeinformers.WithNamespace(namespaceScope)
-	kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResync, kubeInformerOpt)
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResync,
+		kubeInformerOpt, kubeinformers.WithTweakListOptions(k8s.PaginateInformerList))
 
 	faasInformerOpt := informers.WithNamespace(namespaceScope)
-	faasInformerFactory := informers.NewSharedInformerFactoryWithOptions(faasClient, defaultResync, faasInformerOpt)
+	faasInformerFactory := informers.NewSharedInformerFactoryWithOptions(faasClient, defaultResync,
+		faasInformerOpt, informers.WithTweakListOptions(k8s.PaginateInformerList))
+
+	// Profiles are looked up in their own namespace, which may differ from the function namespace
+	profileInformerOpt := informers.WithNamespace(config.ProfilesNamespace)
+	profileInformerFactory := informers.NewSharedInformerFactoryWithOptions(faasClient, defaultResync,
+		profileInformerOpt, informers.WithTweakListOptions(k8s.PaginateInformerList))
+
+	// only secrets managed by OpenFaaS are cached, others are read from the API when needed
+	secretInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResync,
+		kubeInformerOpt, kubeinformers.WithTweakListOptions(k8s.FilterManagedSecrets))
+
+	// only the Pods of functions are cached, for the runtime status in the function list
+	podInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResync,
+		kubeInformerOpt, kubeinformers.WithTweakListOptions(k8s.FilterFunctionPods))
 
 	factory := k8s.NewFunctionFactory(kubeClient, deployConfig, faasClient.OpenfaasV1())
 
+	if config.ConfigFile != "" {
+		watchConfigFile(config, osEnv, deployConfig.Live)
+	}
+	factory.Dynamic = dynamicClient
+
+	if config.ImagePolicyFile != "" {
+		policy, err := imagepolicy.Load(config.ImagePolicyFile)
+		if err != nil {
+			fatal(err, "Error reading image policy")
+		}
+		factory.ImageVerifier = imagepolicy.NewVerifier(policy, nil)
+	}
+
+	if config.DetectImageArchitectures {
+		factory.ArchitectureResolver = imagepolicy.NewArchitectureResolver(nil)
+	}
+
+	factory.ReplicaLimits = k8s.NewReplicaLimits(int32(config.MaxReplicas), kubeClient)
+	factory.NamespaceAnnotations = k8s.NewNamespaceAnnotations(kubeClient)
+
 	setup := serverSetup{
-		config:              config,
-		functionFactory:     factory,
-		kubeInformerFactory: kubeInformerFactory,
-		faasInformerFactory: faasInformerFactory,
-		kubeClient:          kubeClient,
-		faasClient:          faasClient,
+		config:                 config,
+		functionFactory:        factory,
+		kubeInformerFactory:    kubeInformerFactory,
+		faasInformerFactory:    faasInformerFactory,
+		profileInformerFactory: profileInformerFactory,
+		secretInformerFactory:  secretInformerFactory,
+		podInformerFactory:     podInformerFactory,
+		shutdownTracing:        shutdownTracing,
+		kubeClient:             kubeClient,
+		faasClient:             faasClient,
+		dynamicClient:          dynamicClient,
 	}
 
-	runController(setup)
+	if operator {
+		runOperator(setup, dryRun)
+		return
+	}
 
+	runController(setup)
 }
 
 type customInformers struct {
-	EndpointsInformer  v1core.EndpointsInformer
-	StatefulsetInformer v1apps.StatefulSetInformer
-	FunctionsInformer  v1.FunctionInformer
+	EndpointSlicesInformer v1discovery.EndpointSliceInformer
+	StatefulsetInformer    v1apps.StatefulSetInformer
+	FunctionsInformer      v1.FunctionInformer
+	ProfilesInformer       v1.ProfileInformer
+	ServicesInformer       v1core.ServiceInformer
+	SecretsInformer        v1core.SecretInformer
+	PodsInformer           v1core.PodInformer
 }
 
 func startInformers(setup serverSetup, stopCh <-chan struct{}, operator bool) customInformers {
@@ -164,26 +294,57 @@ func startInformers(setup serverSetup, stopCh <-chan struct{}, operator bool) cu
 		functions = faasInformerFactory.Openfaas().V1().Functions()
 		go functions.Informer().Run(stopCh)
 		if ok := cache.WaitForNamedCacheSync("faas-netes:functions", stopCh, functions.Informer().HasSynced); !ok {
-			log.Fatalf("failed to wait for cache to sync")
+			fatal(nil, "failed to wait for cache to sync")
 		}
 	}
 
 	statefulsets := kubeInformerFactory.Apps().V1().StatefulSets()
 	go statefulsets.Informer().Run(stopCh)
 	if ok := cache.WaitForNamedCacheSync("faas-netes:statefulsets", stopCh, statefulsets.Informer().HasSynced); !ok {
-		log.Fatalf("failed to wait for cache to sync")
+		fatal(nil, "failed to wait for cache to sync")
+	}
+
+	profiles := setup.profileInformerFactory.Openfaas().V1().Profiles()
+	go profiles.Informer().Run(stopCh)
+	if ok := cache.WaitForNamedCacheSync("faas-netes:profiles", stopCh, profiles.Informer().HasSynced); !ok {
+		fatal(nil, "failed to wait for cache to sync")
+	}
+
+	services := kubeInformerFactory.Core().V1().Services()
+	go services.Informer().Run(stopCh)
+	if ok := cache.WaitForNamedCacheSync("faas-netes:services", stopCh, services.Informer().HasSynced); !ok {
+		fatal(nil, "failed to wait for cache to sync")
+	}
+
+	secrets := setup.secretInformerFactory.Core().V1().Secrets()
+	go secrets.Informer().Run(stopCh)
+	if ok := cache.WaitForNamedCacheSync("faas-netes:secrets", stopCh, secrets.Informer().HasSynced); !ok {
+		fatal(nil, "failed to wait for cache to sync")
 	}
 
-	endpoints := kubeInformerFactory.Core().V1().Endpoints()
-	go endpoints.Informer().Run(stopCh)
-	if ok := cache.WaitForNamedCacheSync("faas-netes:endpoints", stopCh, endpoints.Informer().HasSynced); !ok {
-		log.Fatalf("failed to wait for cache to sync")
+	pods := setup.podInformerFactory.Core().V1().Pods()
+	go pods.Informer().Run(stopCh)
+	if ok := cache.WaitForNamedCacheSync("faas-netes:pods", stopCh, pods.Informer().HasSynced); !ok {
+		fatal(nil, "failed to wait for cache to sync")
+	}
+
+	endpointSlices := kubeInformerFactory.Discovery().V1().EndpointSlices()
+	if err := endpointSlices.Informer().AddIndexers(k8s.EndpointSliceIndexers); err != nil {
+		fatal(err, "failed to add the endpointslice indexers")
+	}
+	go endpointSlices.Informer().Run(stopCh)
+	if ok := cache.WaitForNamedCacheSync("faas-netes:endpointslices", stopCh, endpointSlices.Informer().HasSynced); !ok {
+		fatal(nil, "failed to wait for cache to sync")
 	}
 
 	return customInformers{
-		EndpointsInformer:  endpoints,
-		StatefulsetInformer: statefulsets,
-		FunctionsInformer:  functions,
+		EndpointSlicesInformer: endpointSlices,
+		StatefulsetInformer:    statefulsets,
+		FunctionsInformer:      functions,
+		ProfilesInformer:       profiles,
+		ServicesInformer:       services,
+		SecretsInformer:        secrets,
+		PodsInformer:           pods,
 	}
 }
 
@@ -195,38 +356,732 @@ func runController(setup serverSetup) {
 
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
+	go flushSpansOnStop(stopCh, setup.shutdownTracing)
 	operator := false
 	listers := startInformers(setup, stopCh, operator)
-	controller.RegisterEventHandlers(listers.StatefulsetInformer, kubeClient, config.DefaultFunctionNamespace)
+	factory.SecretLister = listers.SecretsInformer.Lister()
+	factory.DefaultEnv = startDefaultEnv(config, kubeClient, stopCh)
+	controller.RegisterEventHandlers(listers.StatefulsetInformer, kubeClient, factory.ReplicaLimits, config.AllowZeroReplicas)
+	controller.RegisterProfileEventHandlers(listers.ProfilesInformer, listers.StatefulsetInformer.Lister(), factory, config.DefaultFunctionNamespace)
+
+	functionLookup := k8s.NewFunctionLookup(config.DefaultFunctionNamespace, listers.EndpointSlicesInformer.Informer().GetIndexer())
+	functionLookup.StatefulSets = listers.StatefulsetInformer.Lister()
+	functionLookup.DefaultLoadBalancing = config.LoadBalancing
+	functionLookup.DefaultPort = int32(config.FunctionPort)
+	var breaker *k8s.CircuitBreaker
+	if config.CircuitBreakerFailures > 0 {
+		breaker = k8s.NewCircuitBreaker(config.CircuitBreakerFailures, config.CircuitBreakerCooldown)
+		functionLookup.Breaker = breaker
+		listers.EndpointSlicesInformer.Informer().AddEventHandler(breaker.EndpointSliceEventHandler())
+	}
+	var resolver proxy.BaseURLResolver = functionLookup
+	if config.ScaleFromZero {
+		resolver = k8s.NewScaleFromZeroResolver(functionLookup, kubeClient, listers.StatefulsetInformer.Lister(), config.ScaleFromZeroTimeout)
+	}
+	cachedReader := k8s.NewCachedReader(kubeClient, listers.StatefulsetInformer.Lister(), listers.ServicesInformer.Lister())
+	replicaCache := handlers.NewReplicaCache(config.ReplicaCacheTTL)
+	stabilizer := handlers.NewScaleStabilizer(handlers.StabilizationConfig{
+		UpWindow:    config.ScaleUpStabilization,
+		DownWindow:  config.ScaleDownStabilization,
+		MaxUpStep:   int32(config.MaxScaleUpStep),
+		MaxDownStep: int32(config.MaxScaleDownStep),
+	})
+	replicaCache.RegisterEventHandlers(listers.StatefulsetInformer.Informer())
+	timeouts := k8s.NewFunctionTimeouts(config.DefaultFunctionNamespace, listers.StatefulsetInformer.Lister())
+	maintenanceGuard := handlers.MakeMaintenanceGuard(k8s.NewFunctionMaintenance(config.DefaultFunctionNamespace, listers.StatefulsetInformer.Lister()))
+	retrier := handlers.NewRetrier(handlers.RetryConfig{
+		Attempts:    config.ProxyRetries,
+		Backoff:     config.ProxyRetryBackoff,
+		Budget:      config.ProxyRetryBudget,
+		MaxBodySize: int64(config.ProxyRetryMaxBody),
+	})
+	proxyClient := handlers.NewProxyClient(handlers.ProxyConfig{
+		Timeout:             config.FaaSConfig.GetReadTimeout(),
+		MaxIdleConns:        config.FaaSConfig.GetMaxIdleConns(),
+		MaxIdleConnsPerHost: config.FaaSConfig.GetMaxIdleConnsPerHost(),
+		IdleConnTimeout:     config.ProxyIdleConnTimeout,
+		KeepAlive:           config.ProxyKeepAlive,
+		HTTP2:               config.ProxyHTTP2,
+	})
 
-	functionLookup := k8s.NewFunctionLookup(config.DefaultFunctionNamespace, listers.EndpointsInformer.Lister())
+	// the metrics are served on /metrics by faas-provider from the default registry
+	invocationMetrics := metrics.NewInvocations(prometheus.DefaultRegisterer)
+	prometheus.MustRegister(metrics.NewConcurrency(invocationMetrics, listers.StatefulsetInformer.Lister()))
+	if config.StatsDAddress != "" {
+		startStatsD(config, stopCh)
+	}
+
+	withEvents, emitter := startEvents(config, stopCh)
+	if emitter != nil {
+		listers.PodsInformer.Informer().AddEventHandler(emitter.ContainerHealthHandler())
+	}
+	deployAdmission, scaleAdmission := startPriorityAdmission(config, kubeClient, listers, emitter, stopCh)
+
+	logRequester := k8s.NewLogRequestor(kubeClient, config.DefaultFunctionNamespace)
+
+	var unsealer *k8s.SecretUnsealer
+	if config.SealedSecretsKeyFile != "" {
+		var err error
+		if unsealer, err = k8s.LoadSecretUnsealer(config.SealedSecretsKeyFile); err != nil {
+			fatal(err, "Error reading the sealing keys")
+		}
+	}
+
+	authorize := makeAuthorizer(config)
+	namespaceGuard := handlers.MakeNamespaceGuard(config.DefaultFunctionNamespace, kubeClient)
 
 	bootstrapHandlers := providertypes.FaaSHandlers{
-		FunctionProxy:        proxy.NewHandlerFunc(config.FaaSConfig, functionLookup),
-		DeleteHandler:        handlers.MakeDeleteHandler(config.DefaultFunctionNamespace, kubeClient),
-		DeployHandler:        handlers.MakeDeployHandler(config.DefaultFunctionNamespace, factory),
-		FunctionReader:       handlers.MakeFunctionReader(config.DefaultFunctionNamespace, listers.StatefulsetInformer.Lister()),
-		ReplicaReader:        handlers.MakeReplicaReader(config.DefaultFunctionNamespace, listers.StatefulsetInformer.Lister()),
-		ReplicaUpdater:       handlers.MakeReplicaUpdater(config.DefaultFunctionNamespace, kubeClient),
-		UpdateHandler:        handlers.MakeUpdateHandler(config.DefaultFunctionNamespace, factory),
+		FunctionProxy: logging.Middleware(tracing.Handler("invoke",
+			invocationMetrics.Instrument(config.DefaultFunctionNamespace, maintenanceGuard(handlers.MakeProxyHandler(proxyClient, resolver, retrier, breaker, timeouts))))),
+		DeleteHandler:        logging.Middleware(namespaceGuard(tracing.Handler("delete", withEvents(events.FunctionDeleted, handlers.MakeDeleteHandler(config.DefaultFunctionNamespace, kubeClient, factory.Dynamic, cachedReader, factory.Config.APITimeout))))),
+		DeployHandler:        logging.Middleware(namespaceGuard(deployAdmission(tracing.Handler("deploy", withEvents(events.FunctionDeployed, handlers.MakeDeployHandler(config.DefaultFunctionNamespace, factory)))))),
+		FunctionReader:       logging.Middleware(namespaceGuard(handlers.MakeFunctionReader(config.DefaultFunctionNamespace, listers.StatefulsetInformer.Lister(), listers.PodsInformer.Lister(), listers.StatefulsetInformer.Informer()))),
+		ReplicaReader:        logging.Middleware(handlers.MakeReplicaReader(config.DefaultFunctionNamespace, cachedReader, replicaCache, listers.StatefulsetInformer.Informer())),
+		ReplicaUpdater:       logging.Middleware(namespaceGuard(scaleAdmission(tracing.Handler("scale", withEvents(events.FunctionScaled, handlers.MakeReplicaUpdater(config.DefaultFunctionNamespace, kubeClient, factory.ReplicaLimits, config.AllowZeroReplicas, stabilizer)))))),
+		UpdateHandler:        logging.Middleware(namespaceGuard(tracing.Handler("update", withEvents(events.FunctionUpdated, handlers.MakeUpdateHandler(config.DefaultFunctionNamespace, factory, cachedReader))))),
 		HealthHandler:        handlers.MakeHealthHandler(),
-		InfoHandler:          handlers.MakeInfoHandler(version.BuildVersion(), version.GitCommit),
-		SecretHandler:        handlers.MakeSecretHandler(config.DefaultFunctionNamespace, kubeClient),
-		LogHandler:           logs.NewLogHandlerFunc(k8s.NewLogRequestor(kubeClient, config.DefaultFunctionNamespace), config.FaaSConfig.WriteTimeout),
-		ListNamespaceHandler: handlers.MakeNamespacesLister(config.DefaultFunctionNamespace, kubeClient),
+		InfoHandler:          logging.Middleware(handlers.MakeInfoHandler(version.BuildVersion(), version.GitCommit)),
+		SecretHandler:        logging.Middleware(namespaceGuard(handlers.MakeSecretHandler(config.DefaultFunctionNamespace, kubeClient, unsealer, factory.Config.APITimeout))),
+		LogHandler:           logging.Middleware(logs.NewLogHandlerFunc(logRequester, config.FaaSConfig.WriteTimeout)),
+		ListNamespaceHandler: logging.Middleware(handlers.MakeNamespacesLister(config.DefaultFunctionNamespace, kubeClient)),
+	}
+
+	if config.NATSURL != "" {
+		startAsync(config, proxyClient, resolver, stopCh)
+	}
+
+	startSchedule(config, kubeClient, listers.StatefulsetInformer.Lister(), factory.ReplicaLimits, stopCh)
+
+	if config.DrainRebalance {
+		startDrainRebalancer(config, kubeClient, listers, stopCh)
+	}
+
+	if config.RevisionGC {
+		startRevisionCollector(config, kubeClient, listers.StatefulsetInformer.Lister(), stopCh)
+	}
+
+	startSecretRotator(config, kubeClient, listers.StatefulsetInformer.Lister(), factory.Config.Rollout, stopCh)
+
+	if config.GRPCPort > 0 {
+		// the handlers are authorized by the interceptors of the gRPC server, with
+		// the same roles as their REST routes
+		grpcHandlers := providergrpc.Handlers{
+			Deploy: bootstrapHandlers.DeployHandler,
+			Update: bootstrapHandlers.UpdateHandler,
+			List:   bootstrapHandlers.FunctionReader,
+			Get:    bootstrapHandlers.ReplicaReader,
+			Scale:  bootstrapHandlers.ReplicaUpdater,
+			Delete: bootstrapHandlers.DeleteHandler,
+		}
+		watcher := providergrpc.NewWatcher(listers.StatefulsetInformer.Lister())
+		watcher.RegisterEventHandlers(listers.StatefulsetInformer.Informer())
+		startGRPC(config, providergrpc.NewServer(grpcHandlers, logRequester, watcher), authorize, stopCh)
+	}
+
+	faasProvider.Router().HandleFunc("/system/functions/export",
+		authorize(rbac.RoleReader, logging.Middleware(handlers.MakeExportHandler(config.DefaultFunctionNamespace, listers.StatefulsetInformer.Lister())))).
+		Methods(http.MethodGet)
+
+	faasProvider.Router().HandleFunc("/system/chargeback",
+		authorize(rbac.RoleReader, logging.Middleware(handlers.MakeChargebackHandler(config.DefaultFunctionNamespace, factory.Config.CostLabels, listers.StatefulsetInformer.Lister(), kubeClient)))).
+		Methods(http.MethodGet)
+
+	faasProvider.Router().HandleFunc("/system/namespaces/{ns}/usage",
+		authorize(rbac.RoleReader, logging.Middleware(handlers.MakeNamespaceUsageHandler(config.DefaultFunctionNamespace, listers.StatefulsetInformer.Lister(), kubeClient, factory.Config.APITimeout)))).
+		Methods(http.MethodGet)
+
+	faasProvider.Router().HandleFunc("/system/function/{name:["+faasProvider.NameExpression+"]+}/resume",
+		authorize(rbac.RoleDeployer, logging.Middleware(namespaceGuard(tracing.Handler("resume", handlers.MakeResumeHandler(config.DefaultFunctionNamespace, kubeClient, factory.ReplicaLimits)))))).
+		Methods(http.MethodPost)
+
+	faasProvider.Router().HandleFunc("/system/function/{name:["+faasProvider.NameExpression+"]+}/maintenance",
+		authorize(rbac.RoleDeployer, logging.Middleware(namespaceGuard(tracing.Handler("maintenance", handlers.MakeMaintenanceHandler(config.DefaultFunctionNamespace, kubeClient, factory.Config.APITimeout)))))).
+		Methods(http.MethodPut, http.MethodDelete)
+
+	secretRotation := handlers.MakeSecretRotationHandler(config.DefaultFunctionNamespace, kubeClient, listers.StatefulsetInformer.Lister(), unsealer, factory.Config.APITimeout)
+	faasProvider.Router().HandleFunc("/system/secret/{name}/rotate",
+		authorize(rbac.RoleAdmin, logging.Middleware(namespaceGuard(tracing.Handler("rotate-secret", secretRotation))))).
+		Methods(http.MethodPost)
+	faasProvider.Router().HandleFunc("/system/secret/{name}/rotate",
+		authorize(rbac.RoleReader, logging.Middleware(namespaceGuard(secretRotation)))).
+		Methods(http.MethodGet)
+
+	// the functions are restored through the deploy and update handlers, which are
+	// authorized by the route of the archive and check the namespace themselves
+	archive := handlers.MakeArchiveHandler(config.DefaultFunctionNamespace, kubeClient, listers.StatefulsetInformer.Lister(),
+		bootstrapHandlers.DeployHandler, bootstrapHandlers.UpdateHandler, factory.ReplicaLimits, factory.Config.APITimeout)
+	faasProvider.Router().HandleFunc("/system/functions/archive",
+		authorize(rbac.RoleReader, logging.Middleware(archive))).
+		Methods(http.MethodGet)
+	faasProvider.Router().HandleFunc("/system/functions/archive",
+		authorize(rbac.RoleDeployer, logging.Middleware(tracing.Handler("restore", archive)))).
+		Methods(http.MethodPost)
+
+	// the copy is deployed through the deploy handler, which is authorized by the route
+	// of the promotion
+	faasProvider.Router().HandleFunc("/system/function/{name:["+faasProvider.NameExpression+"]+}/promote",
+		authorize(rbac.RoleDeployer, logging.Middleware(namespaceGuard(tracing.Handler("promote", handlers.MakePromoteHandler(config.DefaultFunctionNamespace, kubeClient, bootstrapHandlers.DeployHandler, factory.ReplicaLimits, factory.Config.APITimeout)))))).
+		Methods(http.MethodPost)
+
+	// the functions of a group are changed through the deploy, update and delete
+	// handlers, which are authorized by the routes of the group
+	group := handlers.MakeFunctionGroupHandler(config.DefaultFunctionNamespace, factory, listers.StatefulsetInformer.Lister(),
+		bootstrapHandlers.DeployHandler, bootstrapHandlers.UpdateHandler, bootstrapHandlers.DeleteHandler)
+	faasProvider.Router().HandleFunc("/system/group/{name}",
+		authorize(rbac.RoleReader, logging.Middleware(namespaceGuard(group)))).
+		Methods(http.MethodGet)
+	faasProvider.Router().HandleFunc("/system/group/{name}",
+		authorize(rbac.RoleDeployer, logging.Middleware(namespaceGuard(tracing.Handler("group", group))))).
+		Methods(http.MethodPut, http.MethodDelete)
+	faasProvider.Router().HandleFunc("/system/group/{name}/rollback",
+		authorize(rbac.RoleDeployer, logging.Middleware(namespaceGuard(tracing.Handler("rollback-group", handlers.MakeFunctionGroupRollbackHandler(config.DefaultFunctionNamespace, factory,
+			bootstrapHandlers.DeployHandler, bootstrapHandlers.UpdateHandler, bootstrapHandlers.DeleteHandler)))))).
+		Methods(http.MethodPost)
+
+	faasProvider.Router().HandleFunc("/system/function/{name:["+faasProvider.NameExpression+"]+}/revisions",
+		authorize(rbac.RoleDeployer, logging.Middleware(namespaceGuard(tracing.Handler("revisions", handlers.MakePurgeRevisionsHandler(config.DefaultFunctionNamespace, kubeClient, factory.Config.APITimeout)))))).
+		Methods(http.MethodDelete)
+
+	if config.VPARecommendations {
+		faasProvider.Router().HandleFunc("/system/function/{name:["+faasProvider.NameExpression+"]+}/recommendations",
+			authorize(rbac.RoleReader, logging.Middleware(handlers.MakeRecommendationsReader(config.DefaultFunctionNamespace, setup.dynamicClient, cachedReader)))).
+			Methods(http.MethodGet)
+	}
+
+	// the routes of faasProvider.Serve are authorized here instead of with its basic
+	// auth, so that the roles of the users apply to them
+	authorizeHandlers(&bootstrapHandlers, authorize)
+	faasConfig := config.FaaSConfig
+	faasConfig.EnableBasicAuth = false
+
+	if config.TLSCertFile != "" {
+		serveTLS(config, &bootstrapHandlers, stopCh)
+		return
+	}
+
+	faasProvider.Serve(&bootstrapHandlers, &faasConfig)
+
+}
+
+// serveTLS serves the provider API over TLS until the first shutdown signal, the
+// certificate is reloaded from its files when it is rotated. faasProvider.Serve
+// can only listen for plain HTTP, so its routes are registered here in the same
+// way, without its HTTP request metrics. The handlers must already be authorized.
+func serveTLS(config config.BootstrapConfig, faasHandlers *providertypes.FaaSHandlers, stopCh <-chan struct{}) {
+	reloader, err := certificates.NewReloader(config.TLSCertFile, config.TLSKeyFile, config.TLSClientCAFile)
+	if err != nil {
+		fatal(err, "Error loading the TLS certificate")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx, config.TLSReloadInterval)
+
+	faasConfig := config.FaaSConfig
+	r := faasProvider.Router()
+	name := "{name:[" + faasProvider.NameExpression + "]+}"
+
+	r.HandleFunc("/system/functions", faasHandlers.FunctionReader).Methods(http.MethodGet)
+	r.HandleFunc("/system/functions", faasHandlers.DeployHandler).Methods(http.MethodPost)
+	r.HandleFunc("/system/functions", faasHandlers.DeleteHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/system/functions", faasHandlers.UpdateHandler).Methods(http.MethodPut)
+	r.HandleFunc("/system/function/"+name, faasHandlers.ReplicaReader).Methods(http.MethodGet)
+	r.HandleFunc("/system/scale-function/"+name, faasHandlers.ReplicaUpdater).Methods(http.MethodPost)
+	r.HandleFunc("/system/info", faasHandlers.InfoHandler).Methods(http.MethodGet)
+	r.HandleFunc("/system/secrets", faasHandlers.SecretHandler).
+		Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
+	r.HandleFunc("/system/logs", faasHandlers.LogHandler).Methods(http.MethodGet)
+	// faasProvider.Serve does not protect the namespaces either
+	r.HandleFunc("/system/namespaces", faasHandlers.ListNamespaceHandler).Methods(http.MethodGet)
+
+	r.HandleFunc("/function/"+name, faasHandlers.FunctionProxy)
+	r.HandleFunc("/function/"+name+"/", faasHandlers.FunctionProxy)
+	r.HandleFunc("/function/"+name+"/{params:.*}", faasHandlers.FunctionProxy)
+
+	r.HandleFunc("/healthz", faasHandlers.HealthHandler).Methods(http.MethodGet)
+	r.Handle("/metrics", promhttp.Handler())
+
+	port := 8080
+	if faasConfig.TCPPort != nil {
+		port = *faasConfig.TCPPort
+	}
+
+	server := &http.Server{
+		Addr:           fmt.Sprintf(":%d", port),
+		ReadTimeout:    faasConfig.ReadTimeout,
+		WriteTimeout:   faasConfig.WriteTimeout,
+		MaxHeaderBytes: http.DefaultMaxHeaderBytes,
+		Handler:        r,
+		TLSConfig:      reloader.TLSConfig(),
+	}
+
+	go func() {
+		<-stopCh
+		server.Shutdown(context.Background())
+	}()
+
+	logging.Default().Info("Serving the provider API over TLS", "port", port, "clientCertificates", config.TLSClientCAFile != "")
+	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		fatal(err, "Error serving the provider API over TLS")
+	}
+}
+
+// makeAuthorizer returns the middleware that authenticates the requests to the
+// provider API. With config.RBACFile the user must have the role of the route,
+// otherwise only the basic auth user of the gateway is allowed.
+func makeAuthorizer(config config.BootstrapConfig) func(rbac.Role, http.HandlerFunc) http.HandlerFunc {
+	if config.RBACFile == "" {
+		return func(_ rbac.Role, next http.HandlerFunc) http.HandlerFunc {
+			return withBasicAuth(config.FaaSConfig, next)
+		}
+	}
+
+	var admin *auth.BasicAuthCredentials
+	if config.FaaSConfig.EnableBasicAuth {
+		reader := auth.ReadBasicAuthFromDisk{SecretMountPath: config.FaaSConfig.SecretMountPath}
+		credentials, err := reader.Read()
+		if err != nil {
+			fatal(err, "Error reading basic auth credentials")
+		}
+		admin = credentials
+	}
+
+	authorizer, err := rbac.Load(config.RBACFile, admin)
+	if err != nil {
+		fatal(err, "Error loading the RBAC users")
+	}
+	logging.Default().Info("RBAC enabled for the provider API", "file", config.RBACFile)
+
+	return authorizer.Require
+}
+
+// authorizeHandlers requires a reader to list functions and read their logs, a
+// deployer to change functions and an admin to manage secrets
+func authorizeHandlers(h *providertypes.FaaSHandlers, authorize func(rbac.Role, http.HandlerFunc) http.HandlerFunc) {
+	h.FunctionReader = authorize(rbac.RoleReader, h.FunctionReader)
+	h.ReplicaReader = authorize(rbac.RoleReader, h.ReplicaReader)
+	h.InfoHandler = authorize(rbac.RoleReader, h.InfoHandler)
+	h.LogHandler = authorize(rbac.RoleReader, h.LogHandler)
+
+	h.DeployHandler = authorize(rbac.RoleDeployer, h.DeployHandler)
+	h.UpdateHandler = authorize(rbac.RoleDeployer, h.UpdateHandler)
+	h.DeleteHandler = authorize(rbac.RoleDeployer, h.DeleteHandler)
+	h.ReplicaUpdater = authorize(rbac.RoleDeployer, h.ReplicaUpdater)
+
+	h.SecretHandler = authorize(rbac.RoleAdmin, h.SecretHandler)
+}
+
+// withBasicAuth protects the routes that are added to the router of faas-provider
+// in the same way as its own /system routes
+func withBasicAuth(faasConfig providertypes.FaaSConfig, next http.HandlerFunc) http.HandlerFunc {
+	if !faasConfig.EnableBasicAuth {
+		return next
+	}
+
+	reader := auth.ReadBasicAuthFromDisk{SecretMountPath: faasConfig.SecretMountPath}
+	credentials, err := reader.Read()
+	if err != nil {
+		fatal(err, "Error reading basic auth credentials")
+	}
+
+	return auth.DecorateWithBasicAuth(next, credentials)
+}
+
+// startEvents starts the emitter of the lifecycle events when a sink or webhooks are
+// configured, the returned function wraps a handler so that it emits an event of
+// eventType. The emitter is nil when there is no sink.
+func startEvents(config config.BootstrapConfig, stopCh <-chan struct{}) (func(eventType string, next http.HandlerFunc) http.HandlerFunc, *events.Emitter) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var sinks events.MultiSink
+	if config.EventsSink != "" {
+		sink, err := events.NewSink(config.EventsSink, config.EventsSubject, client)
+		if err != nil {
+			fatal(err, "Error creating the events sink")
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if urls := events.ParseURLs(config.WebhookURLs); len(urls) > 0 {
+		webhooks := &events.WebhookSink{
+			URLs:    urls,
+			Client:  client,
+			Retries: config.WebhookRetries,
+			Backoff: time.Second,
+		}
+		if config.WebhookSecretFile != "" {
+			secret, err := os.ReadFile(config.WebhookSecretFile)
+			if err != nil {
+				fatal(err, "Error reading the webhook secret")
+			}
+			webhooks.Secret = bytes.TrimSpace(secret)
+		}
+		sinks = append(sinks, webhooks)
+	}
+
+	if len(sinks) == 0 {
+		return func(eventType string, next http.HandlerFunc) http.HandlerFunc {
+			return next
+		}, nil
+	}
+
+	// the timeout covers the retries of the webhooks
+	emitter := events.NewEmitter(sinks, 1000, 2*time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go emitter.Run(ctx)
+
+	return func(eventType string, next http.HandlerFunc) http.HandlerFunc {
+		return emitter.Handler(eventType, config.DefaultFunctionNamespace, next)
+	}, emitter
+}
+
+// startStatsD pushes the metrics of the default registry to a StatsD agent until
+// the first shutdown signal
+func startStatsD(config config.BootstrapConfig, stopCh <-chan struct{}) {
+	statsd, err := metrics.NewStatsD(config.StatsDAddress, config.StatsDFlavor, prometheus.DefaultGatherer)
+	if err != nil {
+		fatal(err, "Error creating the statsd client")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go statsd.Run(ctx, config.StatsDInterval)
+}
+
+// startSchedule scales functions at the windows of their scaling schedules until the
+// first shutdown signal
+func startSchedule(config config.BootstrapConfig, kubeClient kubernetes.Interface, statefulsets appslisters.StatefulSetLister, limits *k8s.ReplicaLimits, stopCh <-chan struct{}) {
+	location, err := time.LoadLocation(config.ScheduleTimezone)
+	if err != nil {
+		fatal(err, "Error loading the time zone of the scaling schedules")
 	}
+	scaler := controller.NewScheduledScaler(kubeClient, statefulsets, limits, config.AllowZeroReplicas, location)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go scaler.Run(ctx)
+}
 
-	faasProvider.Serve(&bootstrapHandlers, &config.FaaSConfig)
+// startDrainRebalancer moves the Pods of functions off cordoned nodes until the first
+// shutdown signal, the nodes have their own informer as they are not namespaced
+func startDrainRebalancer(config config.BootstrapConfig, kubeClient kubernetes.Interface, listers customInformers, stopCh <-chan struct{}) {
+	nodeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Minute*5,
+		kubeinformers.WithTweakListOptions(k8s.PaginateInformerList))
+	nodes := nodeInformerFactory.Core().V1().Nodes()
 
+	rebalancer := controller.NewDrainRebalancer(kubeClient, nodes.Lister(), listers.PodsInformer.Lister(),
+		listers.StatefulsetInformer.Lister(), config.DefaultFunctionNamespace, config.DrainRebalanceInterval)
+	nodes.Informer().AddEventHandler(rebalancer.NodeEventHandler())
+
+	go nodes.Informer().Run(stopCh)
+	if ok := cache.WaitForNamedCacheSync("faas-netes:nodes", stopCh, nodes.Informer().HasSynced); !ok {
+		fatal(nil, "failed to wait for cache to sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go rebalancer.Run(ctx)
+}
+
+// startDefaultEnv watches the ConfigMap of the default environment variables of
+// functions, only that ConfigMap is cached. It returns nil when
+// default_env_configmap is not set.
+func startDefaultEnv(config config.BootstrapConfig, kubeClient kubernetes.Interface, stopCh <-chan struct{}) *k8s.DefaultEnv {
+	if config.DefaultEnvConfigMap == "" {
+		return nil
+	}
+
+	informerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Minute*5,
+		kubeinformers.WithNamespace(config.ProfilesNamespace),
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", config.DefaultEnvConfigMap).String()
+		}))
+	configMaps := informerFactory.Core().V1().ConfigMaps()
+
+	go configMaps.Informer().Run(stopCh)
+	if ok := cache.WaitForNamedCacheSync("faas-netes:configmaps", stopCh, configMaps.Informer().HasSynced); !ok {
+		fatal(nil, "failed to wait for cache to sync")
+	}
+
+	return k8s.NewDefaultEnv(configMaps.Lister(), config.ProfilesNamespace, config.DefaultEnvConfigMap)
+}
+
+// startRevisionCollector prunes the ControllerRevisions of functions until the first
+// shutdown signal
+func startRevisionCollector(config config.BootstrapConfig, kubeClient kubernetes.Interface, statefulsets appslisters.StatefulSetLister, stopCh <-chan struct{}) {
+	collector := controller.NewRevisionCollector(kubeClient, statefulsets, config.DefaultFunctionNamespace, config.RevisionGCInterval)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go collector.Run(ctx)
+}
+
+// startSecretRotator restarts the functions that use a rotated secret one Pod at a
+// time until the first shutdown signal
+func startSecretRotator(config config.BootstrapConfig, kubeClient kubernetes.Interface, statefulsets appslisters.StatefulSetLister, rollout k8s.RolloutConfig, stopCh <-chan struct{}) {
+	rotator := controller.NewSecretRotator(kubeClient, statefulsets, config.DefaultFunctionNamespace, config.SecretRotationInterval, rollout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go rotator.Run(ctx)
+}
+
+// startPriorityAdmission scales down functions with a low priority while the cluster
+// is saturated, until the first shutdown signal. The middlewares deny their deploys
+// and scale-ups, they pass every request on when priority_admission is not set.
+func startPriorityAdmission(config config.BootstrapConfig, kubeClient kubernetes.Interface, listers customInformers, emitter *events.Emitter, stopCh <-chan struct{}) (deploy, scale func(next http.HandlerFunc) http.HandlerFunc) {
+	if !config.PriorityAdmission {
+		passThrough := func(next http.HandlerFunc) http.HandlerFunc {
+			return next
+		}
+		return passThrough, passThrough
+	}
+
+	admission := controller.NewPriorityAdmission(kubeClient, listers.PodsInformer.Lister(), listers.StatefulsetInformer.Lister(),
+		config.DefaultFunctionNamespace, config.PriorityPendingThreshold, config.PriorityAdmissionInterval,
+		metrics.NewAdmission(prometheus.DefaultRegisterer), emitter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go admission.Run(ctx)
+
+	return handlers.MakeDeployAdmissionGuard(config.DefaultFunctionNamespace, admission),
+		handlers.MakeScaleAdmissionGuard(config.DefaultFunctionNamespace, admission)
+}
+
+// startAsync adds the /async-function routes to the router of faas-provider and
+// runs the worker that invokes the queued functions
+func startAsync(config config.BootstrapConfig, proxyClient *http.Client, resolver proxy.BaseURLResolver, stopCh <-chan struct{}) {
+	asyncConfig := async.Config{
+		URL:         config.NATSURL,
+		Stream:      config.NATSStream,
+		Subject:     config.NATSSubject,
+		Durable:     "faas-netes",
+		AckWait:     config.AsyncAckWait,
+		MaxDeliver:  config.AsyncMaxDeliver,
+		MaxInflight: config.AsyncMaxInflight,
+	}
+
+	nc, js, err := async.Connect(asyncConfig)
+	if err != nil {
+		fatal(err, "Error connecting to NATS JetStream")
+	}
+
+	sub, err := async.Subscribe(js, asyncConfig)
+	if err != nil {
+		fatal(err, "Error subscribing to the async invocations")
+	}
+
+	asyncHandler := logging.Middleware(tracing.Handler("invoke-async",
+		handlers.MakeAsyncHandler(async.NewQueue(js, asyncConfig.Subject))))
+
+	router := faasProvider.Router()
+	router.HandleFunc("/async-function/{name:["+faasProvider.NameExpression+"]+}", asyncHandler)
+	router.HandleFunc("/async-function/{name:["+faasProvider.NameExpression+"]+}/", asyncHandler)
+	router.HandleFunc("/async-function/{name:["+faasProvider.NameExpression+"]+}/{params:.*}", asyncHandler)
+
+	worker := async.Worker{
+		Client:         proxyClient,
+		CallbackClient: &http.Client{Timeout: config.FaaSConfig.GetReadTimeout()},
+		Resolver:       resolver,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+		nc.Drain()
+	}()
+	go worker.Run(ctx, sub, asyncConfig.MaxInflight)
+
+	logging.Default().Info("Async invocations enabled", "stream", asyncConfig.Stream, "subject", asyncConfig.Subject)
+}
+
+// startGRPC serves the provider API over gRPC on config.GRPCPort until the first
+// shutdown signal
+func startGRPC(config config.BootstrapConfig, server *providergrpc.Server, authorize providergrpc.Authorizer, stopCh <-chan struct{}) {
+	// the gRPC API can deploy and delete functions, so it is not served without
+	// credentials
+	if !config.FaaSConfig.EnableBasicAuth && config.RBACFile == "" {
+		fatal(nil, "The gRPC API requires basic auth or rbac_file to be enabled")
+	}
+
+	unary, stream := providergrpc.AuthorizeInterceptors(authorize)
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream)}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.GRPCPort))
+	if err != nil {
+		fatal(err, "Error listening for gRPC")
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	providerpb.RegisterProviderServer(grpcServer, server)
+
+	go func() {
+		<-stopCh
+		grpcServer.GracefulStop()
+	}()
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			logging.Default().Error(err, "gRPC server stopped")
+		}
+	}()
+
+	logging.Default().Info("gRPC API enabled", "port", config.GRPCPort)
+}
+
+// runOperator reconciles the Function resources, with dryRun no changes are
+// applied, so that the diff between the desired and actual resources can be
+// reviewed before upgrading the operator or rolling out a new Profile
+func runOperator(setup serverSetup, dryRun bool) {
+	config := setup.config
+	factory := controller.FunctionFactory{Factory: setup.functionFactory}
+
+	// set up signals so we handle the first shutdown signal gracefully
+	stopCh := signals.SetupSignalHandler()
+	go flushSpansOnStop(stopCh, setup.shutdownTracing)
+	factory.Factory.DefaultEnv = startDefaultEnv(config, setup.kubeClient, stopCh)
+
+	ctrl := controller.NewController(
+		setup.kubeClient,
+		setup.faasClient,
+		setup.dynamicClient,
+		setup.kubeInformerFactory,
+		setup.faasInformerFactory,
+		factory,
+		dryRun,
+	)
+
+	setup.kubeInformerFactory.Start(stopCh)
+	setup.faasInformerFactory.Start(stopCh)
+
+	mux := http.NewServeMux()
+	if dryRun {
+		mux.HandleFunc("/system/dry-run", ctrl.MakeDryRunHandler())
+	}
+	mux.HandleFunc("/healthz", handlers.MakeHealthHandler())
+
+	go func() {
+		addr := fmt.Sprintf(":%d", *config.FaaSConfig.TCPPort)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fatal(err, "Error serving operator endpoints")
+		}
+	}()
+
+	if err := ctrl.Run(1, stopCh); err != nil {
+		fatal(err, "Error running operator")
+	}
 }
 
 // serverSetup is a container for the config and clients needed to start the
 // faas-netes controller or operator
 type serverSetup struct {
-	config              config.BootstrapConfig
-	kubeClient          *kubernetes.Clientset
-	faasClient          *clientset.Clientset
-	functionFactory     k8s.FunctionFactory
-	kubeInformerFactory kubeinformers.SharedInformerFactory
-	faasInformerFactory informers.SharedInformerFactory
+	config                 config.BootstrapConfig
+	kubeClient             kubernetes.Interface
+	faasClient             clientset.Interface
+	dynamicClient          dynamic.Interface
+	functionFactory        k8s.FunctionFactory
+	kubeInformerFactory    kubeinformers.SharedInformerFactory
+	faasInformerFactory    informers.SharedInformerFactory
+	profileInformerFactory informers.SharedInformerFactory
+	secretInformerFactory  kubeinformers.SharedInformerFactory
+	podInformerFactory     kubeinformers.SharedInformerFactory
+	shutdownTracing        func(context.Context) error
+}
+
+// newClients builds the clientsets for the cluster of the kubeconfig, or the cluster
+// that the provider runs in
+func newClients(masterURL, kubeconfig string, qps float64, burst int, protobuf bool) (kubernetes.Interface, clientset.Interface, dynamic.Interface) {
+	clientCmdConfig, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
+	if err != nil {
+		fatal(err, "Error building kubeconfig")
+	}
+
+	clientCmdConfig.QPS = float32(qps)
+	clientCmdConfig.Burst = burst
+
+	if tracing.Enabled() {
+		clientCmdConfig.Wrap(tracing.Transport)
+	}
+
+	// protobuf is only served for the built-in API groups, the OpenFaaS
+	// clientset for the CRDs must keep using JSON
+	kubeClientConfig := rest.CopyConfig(clientCmdConfig)
+	if protobuf {
+		kubeClientConfig.ContentType = runtime.ContentTypeProtobuf
+		kubeClientConfig.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(kubeClientConfig)
+	if err != nil {
+		fatal(err, "Error building Kubernetes clientset")
+	}
+
+	faasClient, err := clientset.NewForConfig(clientCmdConfig)
+	if err != nil {
+		fatal(err, "Error building OpenFaaS clientset")
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(clientCmdConfig)
+	if err != nil {
+		fatal(err, "Error building dynamic clientset")
+	}
+
+	return kubeClient, faasClient, dynamicClient
+}
+
+// watchConfigFile reloads the config file when it changes, the settings that can be
+// changed without a restart are used for the functions deployed or updated after it
+func watchConfigFile(cfg config.BootstrapConfig, env providertypes.HasEnv, live *k8s.LiveConfig) {
+	watcher, err := config.NewFileWatcher(cfg.ConfigFile, env, cfg)
+	if err != nil {
+		fatal(err, "Error watching config file")
+	}
+
+	logger := logging.Default().WithName("config")
+	go watcher.Run(context.Background(), cfg.ConfigReloadInterval, func(previous, current config.BootstrapConfig) {
+		live.Store(current.LiveSettings())
+		logger.Info("Reloaded the config file", "file", cfg.ConfigFile)
+
+		if config.RequiresRestart(previous, current) {
+			logger.Info("The config file changed settings that are only applied after a restart", "file", cfg.ConfigFile)
+		}
+	})
+}
+
+// flushSpansOnStop exports the remaining spans when the first shutdown signal is received
+func flushSpansOnStop(stopCh <-chan struct{}, shutdownTracing func(context.Context) error) {
+	<-stopCh
+	if err := shutdownTracing(context.Background()); err != nil {
+		logging.Default().Error(err, "Error flushing spans")
+	}
+}
+
+// fatal logs the error and exits
+func fatal(err error, msg string) {
+	logging.Default().Error(err, msg)
+	os.Exit(1)
 }
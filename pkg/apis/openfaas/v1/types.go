@@ -6,9 +6,9 @@ import (
 )
 
 // +genclient
-// +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.spec.image`
+// +kubebuilder:subresource:status
 
 // Function describes an OpenFaaS function
 type Function struct {
@@ -16,6 +16,8 @@ type Function struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec FunctionSpec `json:"spec"`
+	// +optional
+	Status FunctionStatus `json:"status,omitempty"`
 }
 
 // FunctionSpec is the spec for a Function resource
@@ -43,6 +45,52 @@ type FunctionSpec struct {
 	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem"`
 }
 
+// FunctionStatus is the most recently observed status of a Function,
+// it is written by the operator and should not be set by users
+type FunctionStatus struct {
+	// Conditions describe the latest observations of the Function's state
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// FunctionReady is the condition type used to report if the Function's
+	// StatefulSet could be created or updated with all of its secrets and Profiles
+	FunctionReady = "Ready"
+
+	// ReasonSynced is used when the StatefulSet was created or updated
+	ReasonSynced = "Synced"
+	// ReasonSecretsFailed is used when a secret required by the Function could
+	// not be found or added to the StatefulSet
+	ReasonSecretsFailed = "SecretsFailed"
+	// ReasonProfilesFailed is used when the Function's Profiles could not be
+	// retrieved for a reason other than a missing Profile
+	ReasonProfilesFailed = "ProfilesFailed"
+	// ReasonPodSecurityFailed is used when the Function would violate the
+	// restricted Pod Security Standard that the operator enforces
+	ReasonPodSecurityFailed = "PodSecurityFailed"
+	// ReasonConstraintsFailed is used when the constraints of the Function can
+	// not be parsed
+	ReasonConstraintsFailed = "ConstraintsFailed"
+
+	// FunctionProfilesApplied is the condition type used to report if the
+	// Profiles requested by a Function could be applied
+	FunctionProfilesApplied = "ProfilesApplied"
+
+	// ReasonProfilesApplied is used when all requested Profiles were applied
+	// without any overlapping fields
+	ReasonProfilesApplied = "ProfilesApplied"
+	// ReasonProfileConflict is used when two or more Profiles set the same field,
+	// the value from the Profile listed last has been used
+	ReasonProfileConflict = "ProfileConflict"
+	// ReasonProfileNotFound is used when a requested Profile does not exist,
+	// the Function will not be deployed until it has been created
+	ReasonProfileNotFound = "ProfileNotFound"
+)
+
 // FunctionResources is used to set CPU and memory limits and requests
 type FunctionResources struct {
 	Memory string `json:"memory,omitempty"`
@@ -95,6 +143,19 @@ type ProfileSpec struct {
 	// +optional
 	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
 
+	// If specified, indicates the pod's priority. "system-node-critical" and
+	// "system-cluster-critical" are two special keywords which indicate the
+	// highest priorities with the former being the highest priority. Any other
+	// name must be defined by creating a PriorityClass object with that name.
+	// If not specified, the pod priority will be default or zero if there is no
+	// default.
+	//
+	// copied to the Pod PriorityClassName, this will replace any existing value or previously
+	// applied Profile.
+	//
+	// +optional
+	PriorityClassName *string `json:"priorityClassName,omitempty"`
+
 	// SecurityContext holds pod-level security attributes and common container settings.
 	// Optional: Defaults to empty.  See type description for default values of each field.
 	//
@@ -120,6 +181,88 @@ type ProfileSpec struct {
 	// https://kubernetes.io/docs/concepts/scheduling-eviction/topology-spread-constraints/
 	// +optional
 	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// Volumes to be added to the function's Pod, for example a ConfigMap
+	// containing a CA bundle or a shared cache.
+	//
+	// merged into the Pod Volumes, a volume will replace a volume with the same
+	// name from a previously applied Profile, a different volume of the function
+	// with the same name is an error
+	//
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+
+	// VolumeMounts to be added to the function container, these should refer
+	// to Volumes defined in the same Profile.
+	//
+	// merged into the function container VolumeMounts, a mount will replace a
+	// mount with the same name from a previously applied Profile, a different
+	// mount of the function with the same name is an error
+	//
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+
+	// SPIFFE mounts the SPIFFE Workload API socket into the function container, so
+	// that the function can obtain an SVID from the SPIRE agent on its node and use
+	// it for mTLS to internal services.
+	//
+	// replaces any existing value or previously applied Profile
+	//
+	// +optional
+	SPIFFE *SPIFFE `json:"spiffe,omitempty"`
+
+	// AppArmor confines the processes of the function's containers with an AppArmor
+	// profile, the profile must be loaded on the nodes when its type is Localhost.
+	//
+	// replaces any existing value or previously applied Profile
+	//
+	// +optional
+	AppArmor *AppArmor `json:"appArmor,omitempty"`
+}
+
+// AppArmor selects the AppArmor profile of the containers of a function
+// +kubebuilder:validation:XValidation:rule="self.type != 'Localhost' || has(self.localhostProfile)",message="localhostProfile is required for the Localhost type"
+type AppArmor struct {
+	// Type of the profile, RuntimeDefault for the profile of the container runtime,
+	// Localhost for a profile loaded on the node or Unconfined
+	// +kubebuilder:validation:Enum=RuntimeDefault;Localhost;Unconfined
+	Type string `json:"type"`
+
+	// LocalhostProfile is the name of the profile loaded on the node, it must be
+	// set when Type is Localhost
+	// +optional
+	LocalhostProfile string `json:"localhostProfile,omitempty"`
+}
+
+// SPIFFE configures the SPIFFE Workload API for the functions that use a Profile
+type SPIFFE struct {
+	// Driver is the CSI driver that provides the Workload API socket,
+	// the default is csi.spiffe.io. It is ignored when HostPath is set.
+	// +optional
+	Driver string `json:"driver,omitempty"`
+
+	// HostPath is the directory of the SPIRE agent socket on the node, for
+	// example /run/spire/sockets, it is used instead of the CSI driver.
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
+
+	// SocketName is the file name of the Workload API socket, the default
+	// is spire-agent.sock
+	// +optional
+	SocketName string `json:"socketName,omitempty"`
+
+	// Labels are added to the function's Pod so that it is selected by the
+	// workload registration, for example the podSelector of a ClusterSPIFFEID
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the function's Pod
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,117 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package async queues invocations to NATS JetStream and runs the worker that
+// invokes the functions and posts their results to a callback URL, so that
+// faas-netes can serve /async-function without the gateway's queue-worker.
+package async
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	ftypes "github.com/openfaas/faas-provider/types"
+)
+
+// Config for the JetStream stream and consumer
+type Config struct {
+	// URL of the NATS server
+	URL string
+
+	// Stream is created with a work-queue retention policy when it does not exist
+	Stream string
+
+	// Subject the invocations are published to
+	Subject string
+
+	// Durable is the name of the pull consumer shared by all faas-netes replicas
+	Durable string
+
+	// AckWait is how long an invocation may run before it is delivered again, it
+	// should be longer than the read timeout of the function
+	AckWait time.Duration
+
+	// MaxDeliver is the number of attempts for each invocation
+	MaxDeliver int
+
+	// MaxInflight is the number of invocations that are run at the same time
+	MaxInflight int
+}
+
+// Queue publishes invocations to JetStream
+type Queue struct {
+	js      nats.JetStreamContext
+	subject string
+}
+
+// Connect connects to NATS and creates the stream when it does not exist
+func Connect(config Config) (*nats.Conn, nats.JetStreamContext, error) {
+	logger := logging.Default().WithName("async")
+
+	nc, err := nats.Connect(config.URL,
+		nats.Name("faas-netes"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Error(err, "Disconnected from NATS")
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Info("Reconnected to NATS", "url", nc.ConnectedUrl())
+		}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to NATS at %s: %w", config.URL, err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("unable to create JetStream context: %w", err)
+	}
+
+	if _, err := js.StreamInfo(config.Stream); err != nil {
+		if !errors.Is(err, nats.ErrStreamNotFound) {
+			nc.Close()
+			return nil, nil, fmt.Errorf("unable to get stream %s: %w", config.Stream, err)
+		}
+
+		if _, err := js.AddStream(&nats.StreamConfig{
+			Name:      config.Stream,
+			Subjects:  []string{config.Subject},
+			Retention: nats.WorkQueuePolicy,
+			Storage:   nats.FileStorage,
+		}); err != nil {
+			nc.Close()
+			return nil, nil, fmt.Errorf("unable to create stream %s: %w", config.Stream, err)
+		}
+		logger.Info("Created stream", "stream", config.Stream, "subject", config.Subject)
+	}
+
+	return nc, js, nil
+}
+
+// NewQueue creates a Queue that publishes to subject
+func NewQueue(js nats.JetStreamContext, subject string) *Queue {
+	return &Queue{js: js, subject: subject}
+}
+
+// Queue publishes req, the call ID is used to de-duplicate requests that are
+// retried by the caller
+func (q *Queue) Queue(req *ftypes.QueueRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	var opts []nats.PubOpt
+	if callID := req.Header.Get(logging.RequestIDHeader); callID != "" {
+		opts = append(opts, nats.MsgId(callID))
+	}
+
+	_, err = q.js.Publish(q.subject, data, opts...)
+	return err
+}
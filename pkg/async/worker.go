@@ -0,0 +1,195 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package async
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/nats-io/nats.go"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/openfaas/faas-provider/proxy"
+	ftypes "github.com/openfaas/faas-provider/types"
+)
+
+// retryDelay is how long an invocation waits before it is delivered again when the
+// function has no endpoints, for instance while it scales up from zero
+const retryDelay = 5 * time.Second
+
+// errNoEndpoints means the invocation can be retried later
+var errNoEndpoints = errors.New("no endpoints available")
+
+// Worker invokes the functions of queued requests
+type Worker struct {
+	// Client is used to invoke the functions, it is shared with the proxy
+	Client *http.Client
+
+	// CallbackClient is used to post the results to the callback URL
+	CallbackClient *http.Client
+
+	Resolver proxy.BaseURLResolver
+}
+
+// Subscribe creates or binds to the durable pull consumer of the stream
+func Subscribe(js nats.JetStreamContext, config Config) (*nats.Subscription, error) {
+	return js.PullSubscribe(config.Subject, config.Durable,
+		nats.BindStream(config.Stream),
+		nats.AckWait(config.AckWait),
+		nats.MaxDeliver(config.MaxDeliver),
+		nats.MaxAckPending(config.MaxInflight*2))
+}
+
+// Run fetches up to maxInflight invocations at a time from sub until ctx is done
+func (w *Worker) Run(ctx context.Context, sub *nats.Subscription, maxInflight int) {
+	logger := logging.Default().WithName("async")
+
+	for ctx.Err() == nil {
+		// each fetch is bounded so that the loop notices when ctx is done
+		fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		msgs, err := sub.Fetch(maxInflight, nats.Context(fetchCtx))
+		cancel()
+		if err != nil {
+			if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, nats.ErrTimeout) && ctx.Err() == nil {
+				logger.Error(err, "Error fetching invocations")
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		wg := sync.WaitGroup{}
+		for _, msg := range msgs {
+			wg.Add(1)
+			go func(msg *nats.Msg) {
+				defer wg.Done()
+				w.handle(ctx, logger, msg)
+			}(msg)
+		}
+		wg.Wait()
+	}
+}
+
+func (w *Worker) handle(ctx context.Context, logger logr.Logger, msg *nats.Msg) {
+	req := ftypes.QueueRequest{}
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		logger.Error(err, "Unable to decode the queued request")
+		_ = msg.Term()
+		return
+	}
+
+	logger = logger.WithValues("function", req.Function, "request_id", req.Header.Get(logging.RequestIDHeader))
+
+	if err := w.Invoke(logging.NewContext(ctx, logger), &req); err != nil {
+		if errors.Is(err, errNoEndpoints) {
+			logger.Info("Function not ready, retrying the invocation", "delay", retryDelay.String())
+			_ = msg.NakWithDelay(retryDelay)
+			return
+		}
+		logger.Error(err, "Error invoking function")
+	}
+
+	if err := msg.Ack(); err != nil {
+		logger.Error(err, "Error acknowledging the invocation")
+	}
+}
+
+// Invoke calls the function and posts the result to the callback URL when it is set
+func (w *Worker) Invoke(ctx context.Context, req *ftypes.QueueRequest) error {
+	logger := logging.FromContext(ctx)
+
+	functionAddr, err := w.Resolver.Resolve(req.Function)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errNoEndpoints, err)
+	}
+
+	upstreamURL := url.URL{
+		Scheme:   functionAddr.Scheme,
+		Host:     functionAddr.Host,
+		Path:     req.Path,
+		RawQuery: req.QueryString,
+	}
+
+	upstreamReq, err := http.NewRequestWithContext(ctx, req.Method, upstreamURL.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return err
+	}
+	copyHeaders(upstreamReq.Header, req.Header)
+	if req.Host != "" && upstreamReq.Header.Get("X-Forwarded-Host") == "" {
+		upstreamReq.Header.Set("X-Forwarded-Host", req.Host)
+	}
+
+	start := time.Now()
+	res, err := w.Client.Do(upstreamReq)
+	seconds := time.Since(start)
+
+	var status int
+	var body []byte
+	var resHeader http.Header
+	if err != nil {
+		logger.Error(err, "Error invoking function")
+		status = http.StatusServiceUnavailable
+		body = []byte(err.Error())
+	} else {
+		defer res.Body.Close()
+		status = res.StatusCode
+		resHeader = res.Header
+		body, err = io.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("unable to read the response: %w", err)
+		}
+	}
+
+	logger.V(1).Info("Invocation completed", "status", status, "seconds", seconds.Seconds())
+
+	if req.CallbackURL == nil {
+		return nil
+	}
+
+	return w.callback(ctx, req, status, seconds, resHeader, body)
+}
+
+// callback posts the result with the same headers as the queue-worker of OpenFaaS
+func (w *Worker) callback(ctx context.Context, req *ftypes.QueueRequest, status int, duration time.Duration, resHeader http.Header, body []byte) error {
+	callbackReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.CallbackURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	copyHeaders(callbackReq.Header, resHeader)
+	callbackReq.Header.Set("X-Function-Status", strconv.Itoa(status))
+	callbackReq.Header.Set("X-Function-Name", req.Function)
+	callbackReq.Header.Set("X-Duration-Seconds", strconv.FormatFloat(duration.Seconds(), 'f', -1, 64))
+	if callID := req.Header.Get(logging.RequestIDHeader); callID != "" {
+		callbackReq.Header.Set(logging.RequestIDHeader, callID)
+	}
+
+	res, err := w.CallbackClient.Do(callbackReq)
+	if err != nil {
+		return fmt.Errorf("unable to post the result to %s: %w", req.CallbackURL.String(), err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("callback %s returned status %d", req.CallbackURL.String(), res.StatusCode)
+	}
+	return nil
+}
+
+func copyHeaders(destination http.Header, source http.Header) {
+	for k, v := range source {
+		vClone := make([]string, len(v))
+		copy(vClone, v)
+		destination[k] = vClone
+	}
+}
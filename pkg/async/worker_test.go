@@ -0,0 +1,94 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package async
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	ftypes "github.com/openfaas/faas-provider/types"
+)
+
+type staticResolver struct {
+	url url.URL
+	err error
+}
+
+func (r staticResolver) Resolve(name string) (url.URL, error) {
+	return r.url, r.err
+}
+
+func Test_Worker_Invoke_PostsCallback(t *testing.T) {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/sub" || r.URL.RawQuery != "text=1" {
+			t.Errorf("unexpected function URL: %s", r.URL.String())
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(append([]byte("echo "), body...))
+	}))
+	defer function.Close()
+
+	var callback *http.Request
+	var callbackBody string
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		callback = r
+		callbackBody = string(body)
+	}))
+	defer callbackServer.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	callbackURL, _ := url.Parse(callbackServer.URL)
+	worker := Worker{
+		Client:         http.DefaultClient,
+		CallbackClient: http.DefaultClient,
+		Resolver:       staticResolver{url: *functionURL},
+	}
+
+	err := worker.Invoke(context.Background(), &ftypes.QueueRequest{
+		Function:    "figlet",
+		Method:      http.MethodPost,
+		Path:        "/sub",
+		QueryString: "text=1",
+		Body:        []byte("hi"),
+		Header:      http.Header{"X-Call-Id": []string{"abc123"}},
+		CallbackURL: callbackURL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if callback == nil {
+		t.Fatalf("expected the result to be posted to the callback URL")
+	}
+	if callbackBody != "echo hi" {
+		t.Errorf("want the function's response, got %q", callbackBody)
+	}
+	for header, want := range map[string]string{
+		"X-Function-Status": "201",
+		"X-Function-Name":   "figlet",
+		"X-Call-Id":         "abc123",
+		"Content-Type":      "text/plain",
+	} {
+		if got := callback.Header.Get(header); got != want {
+			t.Errorf("want %s to be %q, got %q", header, want, got)
+		}
+	}
+}
+
+func Test_Worker_Invoke_NoEndpoints(t *testing.T) {
+	worker := Worker{Resolver: staticResolver{err: errors.New("no endpoints")}}
+
+	err := worker.Invoke(context.Background(), &ftypes.QueueRequest{Function: "figlet", Method: http.MethodPost})
+	if !errors.Is(err, errNoEndpoints) {
+		t.Errorf("want errNoEndpoints so that the invocation is retried, got %v", err)
+	}
+}
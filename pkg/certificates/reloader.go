@@ -0,0 +1,162 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package certificates
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+)
+
+// Reloader serves a key pair, and optionally the CA of the client certificates,
+// from files that are replaced when the certificate is rotated, i.e. the keys of
+// a Secret mounted as a volume. The files are reloaded when they change, so that
+// a rotated certificate is used for new connections without a restart.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	lock     sync.RWMutex
+	config   *tls.Config
+	modified map[string]time.Time
+}
+
+// NewReloader loads the key pair from certFile and keyFile, client certificates
+// signed by the CA in clientCAFile are required when it is set
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the configuration of a server, each connection uses the
+// certificate that was loaded last
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.lock.RLock()
+			defer r.lock.RUnlock()
+			return r.config, nil
+		},
+	}
+}
+
+// Reload reads the files, the previous certificate is kept when they can not be
+// loaded, i.e. while only one of them has been replaced
+func (r *Reloader) Reload() error {
+	modified, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load the TLS key pair: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{pair},
+	}
+
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("unable to read the client CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in the client CA %s", r.clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.config = config
+	r.modified = modified
+
+	return nil
+}
+
+// Run checks the files every interval and reloads them when they have changed,
+// until ctx is cancelled
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logging.Default().WithName("certificates")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.changed()
+			if err != nil {
+				logger.Error(err, "Unable to check the TLS certificate")
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			if err := r.Reload(); err != nil {
+				logger.Error(err, "Unable to reload the TLS certificate")
+				continue
+			}
+			logger.Info("Reloaded the TLS certificate", "certFile", r.certFile)
+		}
+	}
+}
+
+// changed reports whether any of the files has been modified since it was loaded
+func (r *Reloader) changed() (bool, error) {
+	modified, err := r.modTimes()
+	if err != nil {
+		return false, err
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for file, modTime := range modified {
+		if !modTime.Equal(r.modified[file]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// modTimes stats the files, following the symlinks that the kubelet swaps when
+// it updates a Secret volume
+func (r *Reloader) modTimes() (map[string]time.Time, error) {
+	modified := map[string]time.Time{}
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modified[file] = info.ModTime()
+	}
+	return modified, nil
+}
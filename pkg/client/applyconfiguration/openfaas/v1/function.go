@@ -19,7 +19,8 @@ import (
 type FunctionApplyConfiguration struct {
 	v1.TypeMetaApplyConfiguration    `json:",inline"`
 	*v1.ObjectMetaApplyConfiguration `json:"metadata,omitempty"`
-	Spec                             *FunctionSpecApplyConfiguration `json:"spec,omitempty"`
+	Spec                             *FunctionSpecApplyConfiguration   `json:"spec,omitempty"`
+	Status                           *FunctionStatusApplyConfiguration `json:"status,omitempty"`
 }
 
 // Function constructs an declarative configuration of the Function type for use with
@@ -198,3 +199,11 @@ func (b *FunctionApplyConfiguration) WithSpec(value *FunctionSpecApplyConfigurat
 	b.Spec = value
 	return b
 }
+
+// WithStatus sets the Status field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the Status field is set to the value of the last call.
+func (b *FunctionApplyConfiguration) WithStatus(value *FunctionStatusApplyConfiguration) *FunctionApplyConfiguration {
+	b.Status = value
+	return b
+}
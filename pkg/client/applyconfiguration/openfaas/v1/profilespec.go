@@ -17,9 +17,12 @@ import (
 type ProfileSpecApplyConfiguration struct {
 	Tolerations               []v1.Toleration               `json:"tolerations,omitempty"`
 	RuntimeClassName          *string                       `json:"runtimeClassName,omitempty"`
+	PriorityClassName         *string                       `json:"priorityClassName,omitempty"`
 	PodSecurityContext        *v1.PodSecurityContext        `json:"podSecurityContext,omitempty"`
 	Affinity                  *v1.Affinity                  `json:"affinity,omitempty"`
 	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	Volumes                   []v1.Volume                   `json:"volumes,omitempty"`
+	VolumeMounts              []v1.VolumeMount              `json:"volumeMounts,omitempty"`
 }
 
 // ProfileSpecApplyConfiguration constructs an declarative configuration of the ProfileSpec type for use with
@@ -46,6 +49,14 @@ func (b *ProfileSpecApplyConfiguration) WithRuntimeClassName(value string) *Prof
 	return b
 }
 
+// WithPriorityClassName sets the PriorityClassName field in the declarative configuration to the given value
+// and returns the receiver, so that objects can be built by chaining "With" function invocations.
+// If called multiple times, the PriorityClassName field is set to the value of the last call.
+func (b *ProfileSpecApplyConfiguration) WithPriorityClassName(value string) *ProfileSpecApplyConfiguration {
+	b.PriorityClassName = &value
+	return b
+}
+
 // WithPodSecurityContext sets the PodSecurityContext field in the declarative configuration to the given value
 // and returns the receiver, so that objects can be built by chaining "With" function invocations.
 // If called multiple times, the PodSecurityContext field is set to the value of the last call.
@@ -71,3 +82,23 @@ func (b *ProfileSpecApplyConfiguration) WithTopologySpreadConstraints(values ...
 	}
 	return b
 }
+
+// WithVolumes adds the given value to the Volumes field in the declarative configuration
+// and returns the receiver, so that objects can be build by chaining "With" function invocations.
+// If called multiple times, values provided by each call will be appended to the Volumes field.
+func (b *ProfileSpecApplyConfiguration) WithVolumes(values ...v1.Volume) *ProfileSpecApplyConfiguration {
+	for i := range values {
+		b.Volumes = append(b.Volumes, values[i])
+	}
+	return b
+}
+
+// WithVolumeMounts adds the given value to the VolumeMounts field in the declarative configuration
+// and returns the receiver, so that objects can be build by chaining "With" function invocations.
+// If called multiple times, values provided by each call will be appended to the VolumeMounts field.
+func (b *ProfileSpecApplyConfiguration) WithVolumeMounts(values ...v1.VolumeMount) *ProfileSpecApplyConfiguration {
+	for i := range values {
+		b.VolumeMounts = append(b.VolumeMounts, values[i])
+	}
+	return b
+}
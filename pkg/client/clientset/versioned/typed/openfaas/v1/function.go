@@ -33,6 +33,7 @@ type FunctionsGetter interface {
 type FunctionInterface interface {
 	Create(ctx context.Context, function *v1.Function, opts metav1.CreateOptions) (*v1.Function, error)
 	Update(ctx context.Context, function *v1.Function, opts metav1.UpdateOptions) (*v1.Function, error)
+	UpdateStatus(ctx context.Context, function *v1.Function, opts metav1.UpdateOptions) (*v1.Function, error)
 	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
 	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
 	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.Function, error)
@@ -40,6 +41,7 @@ type FunctionInterface interface {
 	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
 	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.Function, err error)
 	Apply(ctx context.Context, function *openfaasv1.FunctionApplyConfiguration, opts metav1.ApplyOptions) (result *v1.Function, err error)
+	ApplyStatus(ctx context.Context, function *openfaasv1.FunctionApplyConfiguration, opts metav1.ApplyOptions) (result *v1.Function, err error)
 	FunctionExpansion
 }
 
@@ -129,6 +131,22 @@ func (c *functions) Update(ctx context.Context, function *v1.Function, opts meta
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *functions) UpdateStatus(ctx context.Context, function *v1.Function, opts metav1.UpdateOptions) (result *v1.Function, err error) {
+	result = &v1.Function{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("functions").
+		Name(function.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(function).
+		Do(ctx).
+		Into(result)
+	return
+}
+
 // Delete takes name of the function and deletes it. Returns an error if one occurs.
 func (c *functions) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
 	return c.client.Delete().
@@ -196,3 +214,33 @@ func (c *functions) Apply(ctx context.Context, function *openfaasv1.FunctionAppl
 		Into(result)
 	return
 }
+
+// ApplyStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating ApplyStatus().
+func (c *functions) ApplyStatus(ctx context.Context, function *openfaasv1.FunctionApplyConfiguration, opts metav1.ApplyOptions) (result *v1.Function, err error) {
+	if function == nil {
+		return nil, fmt.Errorf("function provided to Apply must not be nil")
+	}
+	patchOpts := opts.ToPatchOptions()
+	data, err := json.Marshal(function)
+	if err != nil {
+		return nil, err
+	}
+
+	name := function.Name
+	if name == nil {
+		return nil, fmt.Errorf("function.Name must be provided to Apply")
+	}
+
+	result = &v1.Function{}
+	err = c.client.Patch(types.ApplyPatchType).
+		Namespace(c.ns).
+		Resource("functions").
+		Name(*name).
+		SubResource("status").
+		VersionedParams(&patchOpts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	ftypes "github.com/openfaas/faas-provider/types"
+	"sigs.k8s.io/yaml"
+)
+
+// FileEnv reads the settings of the provider from a YAML file whose keys are the
+// names of the environment variables, i.e. `http_probe: true`. The keys that the
+// file does not set are read from the environment.
+type FileEnv struct {
+	values map[string]string
+	env    ftypes.HasEnv
+}
+
+// ReadFileEnv reads the settings from the YAML file at path, falling back to env
+func ReadFileEnv(path string, env ftypes.HasEnv) (FileEnv, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FileEnv{}, fmt.Errorf("unable to read the config file: %w", err)
+	}
+
+	fileEnv, err := parseFileEnv(data, env)
+	if err != nil {
+		return FileEnv{}, fmt.Errorf("unable to parse the config file %s: %w", path, err)
+	}
+	return fileEnv, nil
+}
+
+func parseFileEnv(data []byte, env ftypes.HasEnv) (FileEnv, error) {
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return FileEnv{}, err
+	}
+
+	values := map[string]string{}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			values[key] = v
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return FileEnv{}, fmt.Errorf("%s must be a string, number or boolean", key)
+		}
+	}
+	return FileEnv{values: values, env: env}, nil
+}
+
+// Getenv returns the value of the key from the file, or from the environment when
+// the file does not set it
+func (f FileEnv) Getenv(key string) string {
+	if value, ok := f.values[key]; ok {
+		return value
+	}
+	return f.env.Getenv(key)
+}
+
+// LiveSettings returns the settings that are applied to Functions without a restart
+func (c BootstrapConfig) LiveSettings() k8s.LiveSettings {
+	return k8s.LiveSettings{
+		HTTPProbe:      c.HTTPProbe,
+		ReadinessProbe: c.ReadinessProbe,
+		LivenessProbe:  c.LivenessProbe,
+		SetNonRootUser: c.SetNonRootUser,
+	}
+}
+
+// RequiresRestart returns true when the configs differ in more than their
+// LiveSettings
+func RequiresRestart(previous, current BootstrapConfig) bool {
+	for _, c := range []*BootstrapConfig{&previous, &current} {
+		c.HTTPProbe = false
+		c.ReadinessProbe = k8s.ProbeConfig{}
+		c.LivenessProbe = k8s.ProbeConfig{}
+		c.SetNonRootUser = false
+	}
+	return !reflect.DeepEqual(previous, current)
+}
+
+// FileWatcher reads the config again when the config file changes
+type FileWatcher struct {
+	path     string
+	env      ftypes.HasEnv
+	config   BootstrapConfig
+	modified time.Time
+}
+
+// NewFileWatcher watches the config file at path, config is the config that was
+// read from it at startup and env is used for the keys that it does not set
+func NewFileWatcher(path string, env ftypes.HasEnv, config BootstrapConfig) (*FileWatcher, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWatcher{path: path, env: env, config: config, modified: info.ModTime()}, nil
+}
+
+// Run checks the file every interval until ctx is cancelled, onChange is called
+// with the previous and the new config each time that it changes. A file that can
+// not be read or is invalid is logged and the previous config is kept.
+func (w *FileWatcher) Run(ctx context.Context, interval time.Duration, onChange func(previous, current BootstrapConfig)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logging.Default().WithName("config")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, changed, err := w.reload()
+			if err != nil {
+				logger.Error(err, "Unable to reload the config file", "file", w.path)
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			previous := w.config
+			w.config = current
+			onChange(previous, current)
+		}
+	}
+}
+
+// reload reads the config when the file has been modified since it was last read,
+// following the symlinks that the kubelet swaps when it updates a ConfigMap volume
+func (w *FileWatcher) reload() (BootstrapConfig, bool, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return w.config, false, err
+	}
+	if info.ModTime().Equal(w.modified) {
+		return w.config, false, nil
+	}
+	// an invalid file is only reported once, until it is modified again
+	w.modified = info.ModTime()
+
+	fileEnv, err := ReadFileEnv(w.path, w.env)
+	if err != nil {
+		return w.config, false, err
+	}
+	config, err := ReadConfig{}.Read(fileEnv)
+	if err != nil {
+		return w.config, false, err
+	}
+	return config, true, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_parseFileEnv_FallsBackToEnv(t *testing.T) {
+	env := NewEnvBucket()
+	env.Setenv("http_probe", "false")
+	env.Setenv("function_namespace", "functions")
+
+	fileEnv, err := parseFileEnv([]byte("http_probe: true\nreadiness_probe_period_seconds: 5\nprofiles_namespace: profiles\n"), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ReadConfig{}.Read(fileEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.HTTPProbe || config.ReadinessProbe.PeriodSeconds != 5 || config.ProfilesNamespace != "profiles" {
+		t.Errorf("want the settings of the file, got %+v", config)
+	}
+	if config.DefaultFunctionNamespace != "functions" {
+		t.Errorf("want the namespace from the environment, got %s", config.DefaultFunctionNamespace)
+	}
+}
+
+func Test_parseFileEnv_RejectsNestedValues(t *testing.T) {
+	if _, err := parseFileEnv([]byte("functions:\n  httpProbe: true\n"), NewEnvBucket()); err == nil {
+		t.Fatal("want an error for a nested value")
+	}
+}
+
+func Test_RequiresRestart(t *testing.T) {
+	previous, err := ReadConfig{}.Read(NewEnvBucket())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := previous
+	current.HTTPProbe = true
+	current.ReadinessProbe.PeriodSeconds = 10
+	if RequiresRestart(previous, current) {
+		t.Errorf("want the probes to be changed without a restart")
+	}
+
+	current.ProfilesNamespace = "profiles"
+	if !RequiresRestart(previous, current) {
+		t.Errorf("want a restart for the profiles namespace")
+	}
+}
+
+func Test_FileWatcher_ReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("http_probe: false\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fileEnv, err := ReadFileEnv(path, NewEnvBucket())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := ReadConfig{}.Read(fileEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher, err := NewFileWatcher(path, NewEnvBucket(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("http_probe: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the modification time may have a coarse resolution
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	changes := make(chan BootstrapConfig, 1)
+	go watcher.Run(ctx, time.Millisecond*10, func(previous, current BootstrapConfig) {
+		changes <- current
+	})
+
+	select {
+	case current := <-changes:
+		if !current.HTTPProbe {
+			t.Errorf("want the reloaded config to use the HTTP probe")
+		}
+	case <-ctx.Done():
+		t.Fatal("the config file was not reloaded")
+	}
+}
+
+func Test_FileWatcher_KeepsConfigWhenFileIsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("http_probe: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := BootstrapConfig{HTTPProbe: true}
+	watcher, err := NewFileWatcher(path, NewEnvBucket(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("readiness_probe_timeout_seconds: 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	current, changed, err := watcher.reload()
+	if err == nil || changed || !current.HTTPProbe {
+		t.Errorf("want an error and the previous config, got changed: %t, error: %v", changed, err)
+	}
+}
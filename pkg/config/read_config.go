@@ -4,9 +4,13 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"time"
 
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
 	ftypes "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
 )
 
 // ReadConfig constitutes config from env variables
@@ -33,6 +37,181 @@ func (ReadConfig) Read(hasEnv ftypes.HasEnv) (BootstrapConfig, error) {
 	cfg.HTTPProbe = httpProbe
 	cfg.SetNonRootUser = setNonRootUser
 
+	if cfg.ReadinessProbe, err = readProbeConfig(hasEnv, "readiness_probe"); err != nil {
+		return cfg, err
+	}
+	if cfg.LivenessProbe, err = readProbeConfig(hasEnv, "liveness_probe"); err != nil {
+		return cfg, err
+	}
+
+	cfg.ConfigFile = ftypes.ParseString(hasEnv.Getenv("config_file"), "")
+	cfg.ConfigReloadInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("config_reload_interval"), time.Second*10)
+	cfg.RestrictedPodSecurity = ftypes.ParseBoolValue(hasEnv.Getenv("restricted_pod_security"), false)
+	cfg.ForceReadOnlyRootFilesystem = ftypes.ParseBoolValue(hasEnv.Getenv("force_read_only_root_filesystem"), false)
+
+	cfg.SecretSelector = hasEnv.Getenv("secret_selector")
+	if err := k8s.ParseSecretSelector(cfg.SecretSelector); err != nil {
+		return cfg, fmt.Errorf("invalid secret_selector: %w", err)
+	}
+
+	cfg.DefaultCPURequest = ftypes.ParseString(hasEnv.Getenv("default_cpu_request"), "")
+	cfg.DefaultMemoryRequest = ftypes.ParseString(hasEnv.Getenv("default_memory_request"), "")
+	cfg.DefaultCPULimit = ftypes.ParseString(hasEnv.Getenv("default_cpu_limit"), "")
+	cfg.DefaultMemoryLimit = ftypes.ParseString(hasEnv.Getenv("default_memory_limit"), "")
+	if _, err := cfg.DefaultResources(); err != nil {
+		return cfg, fmt.Errorf("invalid default resources: %w", err)
+	}
+
+	cfg.RevisionHistoryLimit = ftypes.ParseString(hasEnv.Getenv("revision_history_limit"), "")
+	cfg.RolloutMaxUnavailable = ftypes.ParseString(hasEnv.Getenv("rollout_max_unavailable"), "")
+	cfg.RolloutPartition = ftypes.ParseString(hasEnv.Getenv("rollout_partition"), "")
+	if _, err := cfg.Rollout(); err != nil {
+		return cfg, fmt.Errorf("invalid rollout config: %w", err)
+	}
+
+	cfg.NonRootUserID = k8s.SecurityContextUserID
+	if value := hasEnv.Getenv("nonroot_user_id"); value != "" {
+		if cfg.NonRootUserID, err = k8s.ParseUserID(value); err != nil {
+			return cfg, fmt.Errorf("invalid nonroot_user_id: %w", err)
+		}
+	}
+	if value := hasEnv.Getenv("nonroot_group_id"); value != "" {
+		if cfg.NonRootGroupID, err = k8s.ParseGroupID(value); err != nil {
+			return cfg, fmt.Errorf("invalid nonroot_group_id: %w", err)
+		}
+	}
+
+	cfg.ProxyIdleConnTimeout = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("proxy_idle_conn_timeout"), time.Second*90)
+	cfg.ProxyKeepAlive = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("proxy_keep_alive"), time.Second*30)
+	cfg.ProxyHTTP2 = ftypes.ParseBoolValue(hasEnv.Getenv("proxy_http2"), false)
+
+	cfg.ProxyRetries = ftypes.ParseIntValue(hasEnv.Getenv("proxy_retries"), 0)
+	if cfg.ProxyRetries < 0 {
+		return cfg, fmt.Errorf("invalid proxy_retries: %d, must not be negative", cfg.ProxyRetries)
+	}
+	cfg.ProxyRetryBackoff = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("proxy_retry_backoff"), time.Millisecond*50)
+	cfg.ProxyRetryBudget = ftypes.ParseIntValue(hasEnv.Getenv("proxy_retry_budget"), 20)
+	if cfg.ProxyRetryBudget < 0 || cfg.ProxyRetryBudget > 100 {
+		return cfg, fmt.Errorf("invalid proxy_retry_budget: %d, must be a percentage between 0 and 100", cfg.ProxyRetryBudget)
+	}
+	cfg.ProxyRetryMaxBody = ftypes.ParseIntValue(hasEnv.Getenv("proxy_retry_max_body"), 1024*1024)
+
+	cfg.FunctionPort = ftypes.ParseIntValue(hasEnv.Getenv("function_port"), int(k8s.DefaultFunctionPort))
+	if cfg.FunctionPort < 1 || cfg.FunctionPort > 65535 {
+		return cfg, fmt.Errorf("invalid function_port: %d, must be a port between 1 and 65535", cfg.FunctionPort)
+	}
+	cfg.WatchdogProcessEnv = ftypes.ParseString(hasEnv.Getenv("watchdog_process_env"), k8s.EnvProcessName)
+	cfg.WatchdogReadTimeoutEnv = ftypes.ParseString(hasEnv.Getenv("watchdog_read_timeout_env"), "read_timeout")
+	cfg.WatchdogWriteTimeoutEnv = ftypes.ParseString(hasEnv.Getenv("watchdog_write_timeout_env"), "write_timeout")
+	cfg.WatchdogExecTimeoutEnv = ftypes.ParseString(hasEnv.Getenv("watchdog_exec_timeout_env"), "exec_timeout")
+
+	cfg.LoadBalancing = ftypes.ParseString(hasEnv.Getenv("load_balancing"), k8s.LoadBalancingRandom)
+	if err := k8s.ValidateLoadBalancing(cfg.LoadBalancing); err != nil {
+		return cfg, fmt.Errorf("invalid load_balancing: %w", err)
+	}
+
+	cfg.CircuitBreakerFailures = ftypes.ParseIntValue(hasEnv.Getenv("circuit_breaker_failures"), 0)
+	cfg.CircuitBreakerCooldown = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("circuit_breaker_cooldown"), time.Second*10)
+
+	cfg.ReplicaCacheTTL = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("replica_cache_ttl"), time.Second*2)
+
+	cfg.MaxReplicas = ftypes.ParseIntValue(hasEnv.Getenv("max_replicas"), k8s.DefaultMaxReplicas)
+
+	cfg.ScaleUpStabilization = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("scale_up_stabilization"), 0)
+	cfg.ScaleDownStabilization = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("scale_down_stabilization"), 0)
+	cfg.MaxScaleUpStep = ftypes.ParseIntValue(hasEnv.Getenv("max_scale_up_step"), 0)
+	cfg.MaxScaleDownStep = ftypes.ParseIntValue(hasEnv.Getenv("max_scale_down_step"), 0)
+
+	cfg.AllowZeroReplicas = ftypes.ParseBoolValue(hasEnv.Getenv("allow_zero_replicas"), false)
+
+	cfg.ScheduleTimezone = ftypes.ParseString(hasEnv.Getenv("schedule_timezone"), "UTC")
+	if _, err := time.LoadLocation(cfg.ScheduleTimezone); err != nil {
+		return cfg, fmt.Errorf("invalid schedule_timezone: %w", err)
+	}
+
+	cfg.ScaleFromZero = ftypes.ParseBoolValue(hasEnv.Getenv("scale_from_zero"), false)
+	cfg.ScaleFromZeroTimeout = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("scale_from_zero_timeout"), time.Second*30)
+
+	cfg.DrainRebalance = ftypes.ParseBoolValue(hasEnv.Getenv("drain_rebalance"), false)
+	cfg.DrainRebalanceInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("drain_rebalance_interval"), time.Second*10)
+	if cfg.DrainRebalanceInterval <= 0 {
+		return cfg, fmt.Errorf("invalid drain_rebalance_interval: %s, must be greater than zero", cfg.DrainRebalanceInterval)
+	}
+
+	cfg.PriorityAdmission = ftypes.ParseBoolValue(hasEnv.Getenv("priority_admission"), false)
+	cfg.PriorityPendingThreshold = ftypes.ParseIntValue(hasEnv.Getenv("priority_pending_threshold"), 5)
+	if cfg.PriorityPendingThreshold < 1 {
+		return cfg, fmt.Errorf("invalid priority_pending_threshold: %d, must be at least 1", cfg.PriorityPendingThreshold)
+	}
+	cfg.PriorityAdmissionInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("priority_admission_interval"), time.Second*10)
+	if cfg.PriorityAdmissionInterval <= 0 {
+		return cfg, fmt.Errorf("invalid priority_admission_interval: %s, must be greater than zero", cfg.PriorityAdmissionInterval)
+	}
+
+	cfg.RevisionGC = ftypes.ParseBoolValue(hasEnv.Getenv("revision_gc"), false)
+	cfg.RevisionGCInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("revision_gc_interval"), time.Hour)
+	if cfg.RevisionGCInterval <= 0 {
+		return cfg, fmt.Errorf("invalid revision_gc_interval: %s, must be greater than zero", cfg.RevisionGCInterval)
+	}
+
+	cfg.SecretRotationInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("secret_rotation_interval"), time.Second*5)
+	if cfg.SecretRotationInterval <= 0 {
+		return cfg, fmt.Errorf("invalid secret_rotation_interval: %s, must be greater than zero", cfg.SecretRotationInterval)
+	}
+
+	cfg.VPARecommendations = ftypes.ParseBoolValue(hasEnv.Getenv("vpa_recommendations"), false)
+
+	cfg.VaultAddress = ftypes.ParseString(hasEnv.Getenv("vault_address"), "")
+	cfg.VaultRole = ftypes.ParseString(hasEnv.Getenv("vault_role"), "")
+	cfg.SealedSecretsKeyFile = ftypes.ParseString(hasEnv.Getenv("sealed_secrets_key_file"), "")
+
+	cfg.ImagePolicyFile = ftypes.ParseString(hasEnv.Getenv("image_policy_file"), "")
+	cfg.DetectImageArchitectures = ftypes.ParseBoolValue(hasEnv.Getenv("detect_image_architectures"), false)
+
+	cfg.EventsSink = ftypes.ParseString(hasEnv.Getenv("events_sink"), "")
+	cfg.EventsSubject = ftypes.ParseString(hasEnv.Getenv("events_subject"), "openfaas.function.events")
+
+	cfg.WebhookURLs = ftypes.ParseString(hasEnv.Getenv("webhook_urls"), "")
+	cfg.WebhookSecretFile = ftypes.ParseString(hasEnv.Getenv("webhook_secret_file"), "")
+	cfg.WebhookRetries = ftypes.ParseIntValue(hasEnv.Getenv("webhook_retries"), 3)
+
+	cfg.MeshMode = ftypes.ParseString(hasEnv.Getenv("mesh_mode"), "")
+	if err := k8s.ValidateMeshMode(cfg.MeshMode); err != nil {
+		return cfg, err
+	}
+
+	cfg.DefaultEnvConfigMap = ftypes.ParseString(hasEnv.Getenv("default_env_configmap"), "")
+
+	cfg.PrewarmImage = ftypes.ParseString(hasEnv.Getenv("prewarm_image"), k8s.DefaultPrewarmImage)
+
+	cfg.StatsDAddress = ftypes.ParseString(hasEnv.Getenv("statsd_address"), "")
+	cfg.StatsDFlavor = ftypes.ParseString(hasEnv.Getenv("statsd_flavor"), "dogstatsd")
+	cfg.StatsDInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("statsd_interval"), time.Second*10)
+
+	cfg.CostLabels = ftypes.ParseString(hasEnv.Getenv("cost_labels"), "team,project")
+
+	cfg.GRPCPort = ftypes.ParseIntValue(hasEnv.Getenv("grpc_port"), 0)
+
+	cfg.RBACFile = ftypes.ParseString(hasEnv.Getenv("rbac_file"), "")
+
+	cfg.TLSCertFile = ftypes.ParseString(hasEnv.Getenv("tls_cert_file"), "")
+	cfg.TLSKeyFile = ftypes.ParseString(hasEnv.Getenv("tls_key_file"), "")
+	cfg.TLSClientCAFile = ftypes.ParseString(hasEnv.Getenv("tls_client_ca_file"), "")
+	cfg.TLSReloadInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("tls_reload_interval"), time.Second*30)
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return cfg, fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return cfg, fmt.Errorf("tls_client_ca_file requires tls_cert_file and tls_key_file")
+	}
+
+	cfg.NATSURL = ftypes.ParseString(hasEnv.Getenv("nats_url"), "")
+	cfg.NATSStream = ftypes.ParseString(hasEnv.Getenv("nats_stream"), "faas-request")
+	cfg.NATSSubject = ftypes.ParseString(hasEnv.Getenv("nats_subject"), "faas-request")
+	cfg.AsyncAckWait = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("async_ack_wait"), cfg.FaaSConfig.GetReadTimeout()+time.Second*30)
+	cfg.AsyncMaxInflight = ftypes.ParseIntValue(hasEnv.Getenv("async_max_inflight"), 1)
+	cfg.AsyncMaxDeliver = ftypes.ParseIntValue(hasEnv.Getenv("async_max_deliver"), 3)
+
 	return cfg, nil
 }
 
@@ -44,9 +223,79 @@ type BootstrapConfig struct {
 	HTTPProbe bool
 
 	// SetNonRootUser determines if the Function is deployed with a overridden
-	// non-root user id.  Currently this is preconfigured to the uid 12000.
+	// non-root user id, NonRootUserID.
 	SetNonRootUser bool
 
+	// ReadinessProbe and LivenessProbe are the timings of the probes of Functions.
+	// Values are set via the readiness_probe_ and liveness_probe_ prefixed
+	// initial_delay_seconds, timeout_seconds and period_seconds environment
+	// variables, the defaults are 2, 1 and 2.
+	ReadinessProbe k8s.ProbeConfig
+	LivenessProbe  k8s.ProbeConfig
+
+	// ConfigFile is the path of an optional YAML file whose keys are the names of
+	// the environment variables, it takes precedence over the environment. The
+	// probes, HTTPProbe and SetNonRootUser are reloaded when it changes, the other
+	// settings require a restart. Value is set via the config_file environment
+	// variable.
+	ConfigFile string
+
+	// ConfigReloadInterval is how often the ConfigFile is checked for changes. Value
+	// is set via the config_reload_interval environment variable, defaults to 10s.
+	ConfigReloadInterval time.Duration
+
+	// ForceReadOnlyRootFilesystem makes the root filesystem of each Function
+	// read-only regardless of the request. Value is set via the
+	// force_read_only_root_filesystem environment variable, defaults to false.
+	ForceReadOnlyRootFilesystem bool
+
+	// SecretSelector is a label selector that the secrets of Functions must match,
+	// i.e. openfaas-managed=true. Value is set via the secret_selector environment
+	// variable, all secrets in the namespace may be used when it is empty.
+	SecretSelector string
+
+	// NonRootUserID is the UID of Functions when SetNonRootUser is true, it can be
+	// overridden per namespace and per Function. Value is set via the
+	// nonroot_user_id environment variable, defaults to 12000.
+	NonRootUserID int64
+
+	// NonRootGroupID is the GID of Functions when SetNonRootUser is true. Value is
+	// set via the nonroot_group_id environment variable, defaults to 0 which keeps
+	// the group of the image.
+	NonRootGroupID int64
+
+	// DefaultCPURequest and DefaultMemoryRequest are the requests of Functions that
+	// do not set their own, i.e. 50m and 64Mi, so that they can be scheduled in
+	// namespaces with a LimitRange and sized by the cluster autoscaler. Values are
+	// set via the default_cpu_request and default_memory_request environment
+	// variables, no request is set when they are empty.
+	DefaultCPURequest    string
+	DefaultMemoryRequest string
+
+	// DefaultCPULimit and DefaultMemoryLimit are the limits of Functions that do not
+	// set their own. Values are set via the default_cpu_limit and
+	// default_memory_limit environment variables, no limit is set when they are empty.
+	DefaultCPULimit    string
+	DefaultMemoryLimit string
+
+	// RevisionHistoryLimit is the number of old revisions kept for the StatefulSet of
+	// each Function. Value is set via the revision_history_limit environment
+	// variable, when empty it is 10 for the REST API and 5 for the operator.
+	RevisionHistoryLimit string
+
+	// RolloutMaxUnavailable is the number or percentage of a Function's Pods that may
+	// be unavailable during a rolling update, and RolloutPartition the ordinal below
+	// which Pods are held at the previous revision. Values are set via the
+	// rollout_max_unavailable and rollout_partition environment variables, the
+	// defaults are 0.
+	RolloutMaxUnavailable string
+	RolloutPartition      string
+
+	// RestrictedPodSecurity makes each Function compliant with the restricted Pod
+	// Security Standard and rejects Functions that would violate it. Value is set
+	// via the restricted_pod_security environment variable, defaults to false.
+	RestrictedPodSecurity bool
+
 	// DefaultFunctionNamespace defines which namespace in which Functions are deployed.
 	// Value is set via the function_namespace environment variable. If the
 	// variable is not set, it is set to "default".
@@ -57,25 +306,453 @@ type BootstrapConfig struct {
 	// variable is not set, then it falls back to DefaultFunctionNamespace.
 	ProfilesNamespace string
 
+	// ProxyIdleConnTimeout is how long an idle connection to a function is kept in
+	// the pool of the invocation proxy. Value is set via the proxy_idle_conn_timeout
+	// environment variable, the default is 90s.
+	ProxyIdleConnTimeout time.Duration
+
+	// ProxyKeepAlive is the TCP keep-alive period for connections to functions.
+	// Value is set via the proxy_keep_alive environment variable, the default is 30s.
+	ProxyKeepAlive time.Duration
+
+	// ProxyHTTP2 switches the invocation proxy to HTTP/2 with prior knowledge (h2c),
+	// so that all requests to a function pod share one connection. The function's
+	// watchdog must support h2c. Value is set via the proxy_http2 environment variable.
+	ProxyHTTP2 bool
+
+	// ProxyRetries is the most times an invocation is sent again after it failed to
+	// reach the function, or a replica answered with a 502 or 503. Value is set via
+	// the proxy_retries environment variable, the default of 0 disables retries.
+	ProxyRetries int
+
+	// ProxyRetryBackoff is the wait before each retry. Value is set via the
+	// proxy_retry_backoff environment variable, the default is 50ms.
+	ProxyRetryBackoff time.Duration
+
+	// ProxyRetryBudget is the most retries as a percentage of all invocations. Value
+	// is set via the proxy_retry_budget environment variable, the default is 20.
+	ProxyRetryBudget int
+
+	// ProxyRetryMaxBody is the largest request body in bytes that is buffered so
+	// that the invocation can be retried. Value is set via the proxy_retry_max_body
+	// environment variable, the default is 1MB.
+	ProxyRetryMaxBody int
+
+	// FunctionPort is the port of the Service of each function, and of its container
+	// unless it sets the com.openfaas.port annotation. Value is set via the
+	// function_port environment variable, the default is 8080 for the watchdog.
+	FunctionPort int
+
+	// WatchdogProcessEnv is the name of the environment variable that is set to the
+	// process of a function. Value is set via the watchdog_process_env environment
+	// variable, the default is fprocess.
+	WatchdogProcessEnv string
+
+	// WatchdogReadTimeoutEnv, WatchdogWriteTimeoutEnv and WatchdogExecTimeoutEnv are
+	// the names of the environment variables that are set to the timeout of a
+	// function with the com.openfaas.timeout annotation. Values are set via the
+	// watchdog_read_timeout_env, watchdog_write_timeout_env and
+	// watchdog_exec_timeout_env environment variables, the defaults are
+	// read_timeout, write_timeout and exec_timeout.
+	WatchdogReadTimeoutEnv  string
+	WatchdogWriteTimeoutEnv string
+	WatchdogExecTimeoutEnv  string
+
+	// LoadBalancing is the strategy that spreads the invocations of the functions
+	// without the com.openfaas.load-balancing annotation over their endpoints, one
+	// of random, round-robin, least-connections or ordinal-affinity. Value is set
+	// via the load_balancing environment variable, the default is random.
+	LoadBalancing string
+
+	// CircuitBreakerFailures is the number of failed invocations in a row after
+	// which a replica of a function is left out of the load balancing for the
+	// CircuitBreakerCooldown. Value is set via the circuit_breaker_failures
+	// environment variable, the default of 0 disables the circuit breaker.
+	CircuitBreakerFailures int
+
+	// CircuitBreakerCooldown is how long a replica is left out before it is tried
+	// again. Value is set via the circuit_breaker_cooldown environment variable,
+	// the default is 10s.
+	CircuitBreakerCooldown time.Duration
+
+	// ReplicaCacheTTL is how long the replica reader caches the status of a function
+	// between scrapes from the gateway, changes to the function's StatefulSet clear
+	// the cache straight away. Value is set via the replica_cache_ttl environment
+	// variable, the default is 2s and 0 disables the cache.
+	ReplicaCacheTTL time.Duration
+
+	// MaxReplicas is the maximum replicas of a function, it is replaced for a namespace
+	// by its openfaas.com/max-replicas annotation and lowered for a function by its
+	// com.openfaas.scale.max label. Value is set via the max_replicas environment
+	// variable, the default is 20000.
+	MaxReplicas int
+
+	// ScaleUpStabilization is how far back the scale requests for a function are
+	// considered before it is scaled up, it is scaled up to the lowest replicas that
+	// were requested. Value is set via the scale_up_stabilization environment
+	// variable, the default is 0 and scales up straight away.
+	ScaleUpStabilization time.Duration
+
+	// ScaleDownStabilization is how far back the scale requests for a function are
+	// considered before it is scaled down, it is scaled down to the highest replicas
+	// that were requested. Value is set via the scale_down_stabilization environment
+	// variable, the default is 0 and scales down straight away.
+	ScaleDownStabilization time.Duration
+
+	// MaxScaleUpStep is the most replicas that are added by one scale request. Value
+	// is set via the max_scale_up_step environment variable, the default is 0 and
+	// does not limit the step.
+	MaxScaleUpStep int
+
+	// MaxScaleDownStep is the most replicas that are removed by one scale request.
+	// Value is set via the max_scale_down_step environment variable, the default is
+	// 0 and does not limit the step.
+	MaxScaleDownStep int
+
+	// AllowZeroReplicas leaves functions at zero replicas instead of scaling them back
+	// to one, for scale-to-zero tooling or KEDA, and allows the scale API to set zero
+	// replicas. It can be overridden for a function with the
+	// com.openfaas.scale.allow-zero annotation. Value is set via the
+	// allow_zero_replicas environment variable, the default is false.
+	AllowZeroReplicas bool
+
+	// ScheduleTimezone is the IANA time zone of the com.openfaas.scale.schedule
+	// windows of functions. Value is set via the schedule_timezone environment
+	// variable, the default is "UTC".
+	ScheduleTimezone string
+
+	// ScaleFromZero scales a function that is at zero replicas up to one when it is
+	// invoked, and holds the request until the function is ready. Value is set via
+	// the scale_from_zero environment variable, the default is false.
+	ScaleFromZero bool
+
+	// ScaleFromZeroTimeout is how long an invocation waits for a function to become
+	// ready before it fails with a 503. Value is set via the scale_from_zero_timeout
+	// environment variable, the default is 30s.
+	ScaleFromZeroTimeout time.Duration
+
+	// DrainRebalance moves the Pods of functions off nodes that are cordoned, one
+	// at a time and within their PodDisruptionBudgets, before the nodes are
+	// drained. It needs a ClusterRole to watch nodes. Value is set via the
+	// drain_rebalance environment variable, the default is false.
+	DrainRebalance bool
+
+	// DrainRebalanceInterval is how often the Pods on cordoned nodes are checked.
+	// Value is set via the drain_rebalance_interval environment variable, the
+	// default is 10s.
+	DrainRebalanceInterval time.Duration
+
+	// PriorityAdmission scales down functions with a low com.openfaas.priority
+	// label while the cluster is saturated, and denies their deploys and
+	// scale-ups. Value is set via the priority_admission environment variable,
+	// the default is false.
+	PriorityAdmission bool
+
+	// PriorityPendingThreshold is the count of Pods of functions that can not be
+	// scheduled at which the cluster is saturated. Value is set via the
+	// priority_pending_threshold environment variable, the default is 5.
+	PriorityPendingThreshold int
+
+	// PriorityAdmissionInterval is how often the Pods that can not be scheduled
+	// are counted, and a replica of a function with a low priority is removed.
+	// Value is set via the priority_admission_interval environment variable, the
+	// default is 10s.
+	PriorityAdmissionInterval time.Duration
+
+	// RevisionGC prunes the ControllerRevisions of functions to the revision
+	// history limit of their StatefulSets, and deletes the revisions of
+	// StatefulSets that no longer exist. Value is set via the revision_gc
+	// environment variable, the default is false.
+	RevisionGC bool
+
+	// RevisionGCInterval is how often the revisions are pruned. Value is set via
+	// the revision_gc_interval environment variable, the default is 1h.
+	RevisionGCInterval time.Duration
+
+	// SecretRotationInterval is how often the functions that are restarted for a
+	// rotated secret are checked, and the next Pod is restarted once the previous
+	// ones are ready. Value is set via the secret_rotation_interval environment
+	// variable, the default is 5s.
+	SecretRotationInterval time.Duration
+
+	// VPARecommendations creates a VerticalPodAutoscaler in recommendation mode for
+	// each function and serves its recommendations on
+	// /system/function/{name}/recommendations. Value is set via the
+	// vpa_recommendations environment variable, the default is false.
+	VPARecommendations bool
+
+	// VaultAddress is used in the SecretProviderClass for the vault: secrets of
+	// functions. Value is set via the vault_address environment variable, the
+	// default is empty and uses the address configured for the Vault CSI provider.
+	VaultAddress string
+
+	// VaultRole is the Kubernetes auth role used to read the vault: secrets of
+	// functions. Value is set via the vault_role environment variable, the default
+	// is empty and uses the name of each function as its role.
+	VaultRole string
+
+	// SealedSecretsKeyFile holds the PEM encoded private keys of the Sealed Secrets
+	// controller, values sent with "sealed": true are unsealed by the secrets API. Value is set via the sealed_secrets_key_file environment
+	// variable, the default is empty and rejects sealed values.
+	SealedSecretsKeyFile string
+
+	// ImagePolicyFile is the path of a YAML policy, see the imagepolicy package, that
+	// the images of functions are checked against before they are deployed. Value is
+	// set via the image_policy_file environment variable, the default is empty and
+	// allows any image.
+	ImagePolicyFile string
+
+	// DetectImageArchitectures reads the CPU architectures of a function's image from
+	// its registry, when they are not set with the com.openfaas.architectures
+	// annotation, and requires the Pods to be scheduled to nodes with one of them.
+	// Value is set via the detect_image_architectures environment variable, the
+	// default is false.
+	DetectImageArchitectures bool
+
+	// EventsSink receives a CloudEvent when a function is deployed, updated, scaled,
+	// deleted or when its rollout failed. Value is set via the events_sink environment
+	// variable as an http(s) URL or a nats URL, the default is empty and disables
+	// the events.
+	EventsSink string
+
+	// EventsSubject is the NATS subject of the events. Value is set via the
+	// events_subject environment variable, the default is openfaas.function.events.
+	EventsSubject string
+
+	// WebhookURLs receive the same events as the events sink as signed JSON, the
+	// deliveries are retried with a backoff. Value is set via the webhook_urls
+	// environment variable as a comma separated list, the default is empty.
+	WebhookURLs string
+
+	// WebhookSecretFile holds the secret that the webhooks are signed with, the HMAC
+	// is sent in the X-OpenFaaS-Signature-256 header. Value is set via the
+	// webhook_secret_file environment variable, the default is empty and the webhooks
+	// are not signed.
+	WebhookSecretFile string
+
+	// WebhookRetries is the number of times a failed webhook is retried. Value is set
+	// via the webhook_retries environment variable, the default is 3.
+	WebhookRetries int
+
+	// MeshMode adds the functions to a service mesh, either istio or linkerd. The
+	// injection annotations are set on the Pods and a DestinationRule or ServiceProfile
+	// is created for each function. Value is set via the mesh_mode environment
+	// variable, the default is empty and disables the mesh mode.
+	MeshMode string
+
+	// DefaultEnvConfigMap is the name of a ConfigMap in the ProfilesNamespace whose
+	// data is added to the environment variables of every function that does not
+	// set them. Value is set via the default_env_configmap environment variable,
+	// the default is empty and adds no variables.
+	DefaultEnvConfigMap string
+
+	// PrewarmImage is the image of the DaemonSets that keep the images of functions
+	// with the com.openfaas.prewarm label on the nodes, it must provide /bin/busybox
+	// as a static binary. Value is set via the prewarm_image environment variable,
+	// the default is busybox:1.36.
+	PrewarmImage string
+
+	// StatsDAddress is the host:port of a StatsD or DogStatsD agent that the provider
+	// and invocation metrics are pushed to over UDP, in addition to /metrics. Value is
+	// set via the statsd_address environment variable, the default is empty and
+	// disables the push.
+	StatsDAddress string
+
+	// StatsDFlavor is dogstatsd to send the labels of the metrics as tags, or statsd
+	// to append them to the metric names. Value is set via the statsd_flavor
+	// environment variable, the default is "dogstatsd".
+	StatsDFlavor string
+
+	// StatsDInterval is how often the metrics are pushed. Value is set via the
+	// statsd_interval environment variable, the default is 10s.
+	StatsDInterval time.Duration
+
+	// CostLabels are the comma separated keys of the function labels that are copied
+	// to each of the resources created for a function and used to group the
+	// /system/chargeback report. Value is set via the cost_labels environment
+	// variable, the default is "team,project".
+	CostLabels string
+
+	// GRPCPort serves the provider API over gRPC on this port, in addition to the REST
+	// API. Value is set via the grpc_port environment variable, the default is 0 and
+	// disables the gRPC server.
+	GRPCPort int
+
+	// RBACFile lists the users of the provider API and their roles, reader, deployer
+	// or admin, the basic auth user is an admin. Value is set via the rbac_file
+	// environment variable, the default is empty and only allows the basic auth user.
+	RBACFile string
+
+	// TLSCertFile and TLSKeyFile serve the provider API over TLS, i.e. from the
+	// tls.crt and tls.key of a mounted Secret. The files are reloaded when they
+	// are rotated. Values are set via the tls_cert_file and tls_key_file
+	// environment variables, the default is empty and serves plain HTTP.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSClientCAFile requires a client certificate signed by this CA, i.e. from
+	// the gateway. Value is set via the tls_client_ca_file environment variable,
+	// the default is empty and no client certificate is required.
+	TLSClientCAFile string
+
+	// TLSReloadInterval is how often the TLS files are checked for changes. Value
+	// is set via the tls_reload_interval environment variable, the default is 30s.
+	TLSReloadInterval time.Duration
+
+	// NATSURL enables the /async-function endpoint, invocations are queued to NATS
+	// JetStream and run by a worker in faas-netes. Value is set via the nats_url
+	// environment variable, the default is empty and disables async invocations.
+	NATSURL string
+
+	// NATSStream is the JetStream stream for async invocations, it is created when it
+	// does not exist. Value is set via the nats_stream environment variable, the
+	// default is "faas-request".
+	NATSStream string
+
+	// NATSSubject that async invocations are published to. Value is set via the
+	// nats_subject environment variable, the default is "faas-request".
+	NATSSubject string
+
+	// AsyncAckWait is how long an async invocation may run before it is delivered
+	// again. Value is set via the async_ack_wait environment variable, the default is
+	// the read timeout plus 30s.
+	AsyncAckWait time.Duration
+
+	// AsyncMaxInflight is the number of async invocations run at the same time by each
+	// replica of faas-netes. Value is set via the async_max_inflight environment
+	// variable, the default is 1.
+	AsyncMaxInflight int
+
+	// AsyncMaxDeliver is the number of times an async invocation is delivered, it is
+	// retried when the function has no endpoints or runs for longer than AsyncAckWait. Value is set via the async_max_deliver environment variable,
+	// the default is 3.
+	AsyncMaxDeliver int
+
 	// FaaSConfig contains the configuration for the FaaSProvider
 	FaaSConfig ftypes.FaaSConfig
 }
 
-// Fprint pretty-prints the config with the stdlib logger. One line per config value.
-// When the verbose flag is set to false, it prints the same output as prior to
-// the 0.12.0 release.
-func (c BootstrapConfig) Fprint(verbose bool) {
-	log.Printf("HTTP Read Timeout: %s\n", c.FaaSConfig.GetReadTimeout())
-	log.Printf("HTTP Write Timeout: %s\n", c.FaaSConfig.WriteTimeout)
+// DefaultResources parses the default requests and limits of Functions
+func (c BootstrapConfig) DefaultResources() (corev1.ResourceRequirements, error) {
+	return k8s.ParseDefaultResources(c.DefaultCPURequest, c.DefaultMemoryRequest, c.DefaultCPULimit, c.DefaultMemoryLimit)
+}
 
-	log.Printf("ImagePullPolicy: %s\n", "Always")
-	log.Printf("DefaultFunctionNamespace: %s\n", c.DefaultFunctionNamespace)
+// Rollout parses the revision history limit and rolling update settings of Functions
+func (c BootstrapConfig) Rollout() (k8s.RolloutConfig, error) {
+	return k8s.ParseRolloutConfig(c.RevisionHistoryLimit, c.RolloutMaxUnavailable, c.RolloutPartition)
+}
+
+// readProbeConfig reads the timings of a probe from the environment variables with
+// the prefix
+func readProbeConfig(hasEnv ftypes.HasEnv, prefix string) (k8s.ProbeConfig, error) {
+	probe := k8s.ProbeConfig{
+		InitialDelaySeconds: int32(ftypes.ParseIntValue(hasEnv.Getenv(prefix+"_initial_delay_seconds"), 2)),
+		TimeoutSeconds:      int32(ftypes.ParseIntValue(hasEnv.Getenv(prefix+"_timeout_seconds"), 1)),
+		PeriodSeconds:       int32(ftypes.ParseIntValue(hasEnv.Getenv(prefix+"_period_seconds"), 2)),
+	}
+
+	if probe.InitialDelaySeconds < 0 || probe.TimeoutSeconds < 1 || probe.PeriodSeconds < 1 {
+		return probe, fmt.Errorf("invalid %s: the initial delay must not be negative, the timeout and period must be at least 1s", prefix)
+	}
+	return probe, nil
+}
+
+// Fprint writes the config to the default logger as a single line. When the verbose
+// flag is set to false, it prints the same values as prior to the 0.12.0 release.
+func (c BootstrapConfig) Fprint(verbose bool) {
+	values := []interface{}{
+		"httpReadTimeout", c.FaaSConfig.GetReadTimeout().String(),
+		"httpWriteTimeout", c.FaaSConfig.WriteTimeout.String(),
+		"imagePullPolicy", "Always",
+		"defaultFunctionNamespace", c.DefaultFunctionNamespace,
+	}
 
 	if verbose {
-		log.Printf("MaxIdleConns: %d\n", c.FaaSConfig.MaxIdleConns)
-		log.Printf("MaxIdleConnsPerHost: %d\n", c.FaaSConfig.MaxIdleConnsPerHost)
-		log.Printf("HTTPProbe: %v\n", c.HTTPProbe)
-		log.Printf("ProfilesNamespace: %s\n", c.ProfilesNamespace)
-		log.Printf("SetNonRootUser: %v\n", c.SetNonRootUser)
+		values = append(values,
+			"maxIdleConns", c.FaaSConfig.MaxIdleConns,
+			"maxIdleConnsPerHost", c.FaaSConfig.MaxIdleConnsPerHost,
+			"proxyIdleConnTimeout", c.ProxyIdleConnTimeout.String(),
+			"proxyKeepAlive", c.ProxyKeepAlive.String(),
+			"proxyHTTP2", c.ProxyHTTP2,
+			"proxyRetries", c.ProxyRetries,
+			"proxyRetryBackoff", c.ProxyRetryBackoff.String(),
+			"proxyRetryBudget", c.ProxyRetryBudget,
+			"proxyRetryMaxBody", c.ProxyRetryMaxBody,
+			"functionPort", c.FunctionPort,
+			"watchdogProcessEnv", c.WatchdogProcessEnv,
+			"watchdogTimeoutEnv", []string{c.WatchdogReadTimeoutEnv, c.WatchdogWriteTimeoutEnv, c.WatchdogExecTimeoutEnv},
+			"loadBalancing", c.LoadBalancing,
+			"circuitBreakerFailures", c.CircuitBreakerFailures,
+			"circuitBreakerCooldown", c.CircuitBreakerCooldown.String(),
+			"replicaCacheTTL", c.ReplicaCacheTTL.String(),
+			"maxReplicas", c.MaxReplicas,
+			"scaleUpStabilization", c.ScaleUpStabilization.String(),
+			"scaleDownStabilization", c.ScaleDownStabilization.String(),
+			"maxScaleUpStep", c.MaxScaleUpStep,
+			"maxScaleDownStep", c.MaxScaleDownStep,
+			"allowZeroReplicas", c.AllowZeroReplicas,
+			"scheduleTimezone", c.ScheduleTimezone,
+			"scaleFromZero", c.ScaleFromZero,
+			"scaleFromZeroTimeout", c.ScaleFromZeroTimeout.String(),
+			"drainRebalance", c.DrainRebalance,
+			"drainRebalanceInterval", c.DrainRebalanceInterval.String(),
+			"priorityAdmission", c.PriorityAdmission,
+			"priorityPendingThreshold", c.PriorityPendingThreshold,
+			"priorityAdmissionInterval", c.PriorityAdmissionInterval.String(),
+			"revisionGC", c.RevisionGC,
+			"revisionGCInterval", c.RevisionGCInterval.String(),
+			"secretRotationInterval", c.SecretRotationInterval.String(),
+			"vpaRecommendations", c.VPARecommendations,
+			"vaultAddress", c.VaultAddress,
+			"vaultRole", c.VaultRole,
+			"sealedSecretsKeyFile", c.SealedSecretsKeyFile,
+			"imagePolicyFile", c.ImagePolicyFile,
+			"detectImageArchitectures", c.DetectImageArchitectures,
+			"meshMode", c.MeshMode,
+			"defaultEnvConfigMap", c.DefaultEnvConfigMap,
+			"prewarmImage", c.PrewarmImage,
+			"costLabels", c.CostLabels,
+			"grpcPort", c.GRPCPort,
+			"rbacFile", c.RBACFile,
+			"tlsCertFile", c.TLSCertFile,
+			"tlsKeyFile", c.TLSKeyFile,
+			"tlsClientCAFile", c.TLSClientCAFile,
+			"tlsReloadInterval", c.TLSReloadInterval.String(),
+			"statsdAddress", c.StatsDAddress,
+			"statsdFlavor", c.StatsDFlavor,
+			"statsdInterval", c.StatsDInterval.String(),
+			"eventsSink", c.EventsSink,
+			"eventsSubject", c.EventsSubject,
+			"webhookURLs", c.WebhookURLs,
+			"webhookSecretFile", c.WebhookSecretFile,
+			"webhookRetries", c.WebhookRetries,
+			"natsURL", c.NATSURL,
+			"natsStream", c.NATSStream,
+			"natsSubject", c.NATSSubject,
+			"asyncAckWait", c.AsyncAckWait.String(),
+			"asyncMaxInflight", c.AsyncMaxInflight,
+			"asyncMaxDeliver", c.AsyncMaxDeliver,
+			"httpProbe", c.HTTPProbe,
+			"profilesNamespace", c.ProfilesNamespace,
+			"setNonRootUser", c.SetNonRootUser,
+			"readinessProbe", c.ReadinessProbe,
+			"livenessProbe", c.LivenessProbe,
+			"configFile", c.ConfigFile,
+			"configReloadInterval", c.ConfigReloadInterval.String(),
+			"nonRootUserID", c.NonRootUserID,
+			"nonRootGroupID", c.NonRootGroupID,
+			"restrictedPodSecurity", c.RestrictedPodSecurity,
+			"forceReadOnlyRootFilesystem", c.ForceReadOnlyRootFilesystem,
+			"defaultCPURequest", c.DefaultCPURequest,
+			"defaultMemoryRequest", c.DefaultMemoryRequest,
+			"defaultCPULimit", c.DefaultCPULimit,
+			"defaultMemoryLimit", c.DefaultMemoryLimit,
+			"revisionHistoryLimit", c.RevisionHistoryLimit,
+			"rolloutMaxUnavailable", c.RolloutMaxUnavailable,
+			"rolloutPartition", c.RolloutPartition,
+			"secretSelector", c.SecretSelector,
+		)
 	}
+
+	logging.Default().Info("Configuration", values...)
 }
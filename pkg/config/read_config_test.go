@@ -6,6 +6,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 type EnvBucket struct {
@@ -70,3 +71,189 @@ func TestRead_HTTPProbeConfig_true(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRead_ProxyConfig_Defaults(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+
+	if config.ProxyIdleConnTimeout != time.Second*90 {
+		t.Fatalf("ProxyIdleConnTimeout incorrect, want: %s, got: %s", time.Second*90, config.ProxyIdleConnTimeout)
+	}
+	if config.ProxyKeepAlive != time.Second*30 {
+		t.Fatalf("ProxyKeepAlive incorrect, want: %s, got: %s", time.Second*30, config.ProxyKeepAlive)
+	}
+	if config.ProxyHTTP2 {
+		t.Fatalf("ProxyHTTP2 incorrect, want: false, got: %v", config.ProxyHTTP2)
+	}
+}
+
+func TestRead_ProxyConfig(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("proxy_idle_conn_timeout", "5m")
+	defaults.Setenv("proxy_keep_alive", "15")
+	defaults.Setenv("proxy_http2", "true")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+
+	if config.ProxyIdleConnTimeout != time.Minute*5 {
+		t.Fatalf("ProxyIdleConnTimeout incorrect, want: %s, got: %s", time.Minute*5, config.ProxyIdleConnTimeout)
+	}
+	if config.ProxyKeepAlive != time.Second*15 {
+		t.Fatalf("ProxyKeepAlive incorrect, want: %s, got: %s", time.Second*15, config.ProxyKeepAlive)
+	}
+	if !config.ProxyHTTP2 {
+		t.Fatalf("ProxyHTTP2 incorrect, want: true, got: %v", config.ProxyHTTP2)
+	}
+}
+
+func TestRead_WatchdogConventions(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if config.FunctionPort != 8080 || config.WatchdogProcessEnv != "fprocess" || config.WatchdogExecTimeoutEnv != "exec_timeout" {
+		t.Fatalf("want the conventions of the watchdog by default, got port: %d, process: %s, exec timeout: %s",
+			config.FunctionPort, config.WatchdogProcessEnv, config.WatchdogExecTimeoutEnv)
+	}
+
+	defaults.Setenv("function_port", "9000")
+	defaults.Setenv("watchdog_process_env", "HANDLER")
+	defaults.Setenv("watchdog_exec_timeout_env", "HANDLER_TIMEOUT")
+	config, err = readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+	if config.FunctionPort != 9000 || config.WatchdogProcessEnv != "HANDLER" || config.WatchdogExecTimeoutEnv != "HANDLER_TIMEOUT" {
+		t.Fatalf("want the configured conventions, got port: %d, process: %s, exec timeout: %s",
+			config.FunctionPort, config.WatchdogProcessEnv, config.WatchdogExecTimeoutEnv)
+	}
+
+	defaults.Setenv("function_port", "70000")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("Expected an error for an invalid function_port")
+	}
+}
+
+func TestRead_InvalidMeshMode(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("mesh_mode", "consul")
+
+	readConfig := ReadConfig{}
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("Expected an error for an unknown mesh mode")
+	}
+}
+
+func TestRead_NonRootUser(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.NonRootUserID != 12000 || config.NonRootGroupID != 0 {
+		t.Fatalf("want the default user 12000 and no group, got %d and %d", config.NonRootUserID, config.NonRootGroupID)
+	}
+
+	defaults.Setenv("nonroot_user_id", "1000")
+	defaults.Setenv("nonroot_group_id", "1000")
+	config, err = readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.NonRootUserID != 1000 || config.NonRootGroupID != 1000 {
+		t.Fatalf("want user and group 1000, got %d and %d", config.NonRootUserID, config.NonRootGroupID)
+	}
+
+	defaults.Setenv("nonroot_user_id", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for the root user")
+	}
+}
+
+func TestRead_InvalidSecretSelector(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("secret_selector", "openfaas-managed in (true")
+
+	readConfig := ReadConfig{}
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("Expected an error for an invalid secret selector")
+	}
+}
+
+func TestRead_TLSKeyPairRequired(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("tls_cert_file", "/var/openfaas/provider-tls/tls.crt")
+
+	readConfig := ReadConfig{}
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("Expected an error for a certificate without a key")
+	}
+
+	defaults.Setenv("tls_key_file", "/var/openfaas/provider-tls/tls.key")
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TLSReloadInterval != time.Second*30 {
+		t.Fatalf("TLSReloadInterval incorrect, want: %s, got: %s", time.Second*30, config.TLSReloadInterval)
+	}
+}
+
+func TestRead_DefaultResources(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("default_cpu_request", "50m")
+	defaults.Setenv("default_memory_request", "64Mi")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := config.DefaultResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resources.Requests.Memory().String(); got != "64Mi" {
+		t.Fatalf("want a memory request of 64Mi, got %s", got)
+	}
+
+	defaults.Setenv("default_memory_limit", "32Mi")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for a memory request greater than the limit")
+	}
+}
+
+func TestRead_ProbeConfig(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("liveness_probe_period_seconds", "10")
+
+	readConfig := ReadConfig{}
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ReadinessProbe.PeriodSeconds != 2 || config.ReadinessProbe.TimeoutSeconds != 1 {
+		t.Errorf("want the default readiness probe, got %+v", config.ReadinessProbe)
+	}
+	if config.LivenessProbe.PeriodSeconds != 10 {
+		t.Errorf("want a liveness probe period of 10s, got %+v", config.LivenessProbe)
+	}
+
+	defaults.Setenv("readiness_probe_timeout_seconds", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for a timeout of 0s")
+	}
+}
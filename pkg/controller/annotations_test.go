@@ -1,13 +1,16 @@
 package controller
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
 
 	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
 )
 
 func Test_makeAnnotations_NoKeys(t *testing.T) {
-	annotationVal := `{"name":"","image":"","readOnlyRootFilesystem":false}`
+	annotationVal := sha256Hex(`{"name":"","image":"","readOnlyRootFilesystem":false}`)
 
 	spec := faasv1.Function{
 		Spec: faasv1.FunctionSpec{},
@@ -24,19 +27,23 @@ func Test_makeAnnotations_NoKeys(t *testing.T) {
 		t.Fail()
 	}
 
-	if _, ok := annotations[annotationFunctionSpec]; !ok {
-		t.Errorf("wanted annotation " + annotationFunctionSpec)
+	if _, ok := annotations[annotationFunctionSpecHash]; !ok {
+		t.Errorf("wanted annotation " + annotationFunctionSpecHash)
 		t.Fail()
 	}
 
-	if val, _ := annotations[annotationFunctionSpec]; val != annotationVal {
-		t.Errorf("Annotation " + annotationFunctionSpec + "\nwant: '" + annotationVal + "'\ngot: '" + val + "'")
+	if val, _ := annotations[annotationFunctionSpecHash]; val != annotationVal {
+		t.Errorf("Annotation " + annotationFunctionSpecHash + "\nwant: '" + annotationVal + "'\ngot: '" + val + "'")
 		t.Fail()
 	}
+
+	if _, ok := annotations[annotationFunctionSpec]; ok {
+		t.Errorf("the full spec must not be stored in annotation " + annotationFunctionSpec)
+	}
 }
 
 func Test_makeAnnotations_WithKeyAndValue(t *testing.T) {
-	annotationVal := `{"name":"","image":"","annotations":{"key":"value","key2":"value2"},"readOnlyRootFilesystem":false}`
+	annotationVal := sha256Hex(`{"name":"","image":"","annotations":{"key":"value","key2":"value2"},"readOnlyRootFilesystem":false}`)
 
 	spec := faasv1.Function{
 		Spec: faasv1.FunctionSpec{
@@ -58,15 +65,19 @@ func Test_makeAnnotations_WithKeyAndValue(t *testing.T) {
 		t.Fail()
 	}
 
-	if _, ok := annotations[annotationFunctionSpec]; !ok {
-		t.Errorf("wanted annotation " + annotationFunctionSpec)
+	if _, ok := annotations[annotationFunctionSpecHash]; !ok {
+		t.Errorf("wanted annotation " + annotationFunctionSpecHash)
 		t.Fail()
 	}
 
-	if val, _ := annotations[annotationFunctionSpec]; val != annotationVal {
-		t.Errorf("Annotation " + annotationFunctionSpec + "\nwant: '" + annotationVal + "'\ngot: '" + val + "'")
+	if val, _ := annotations[annotationFunctionSpecHash]; val != annotationVal {
+		t.Errorf("Annotation " + annotationFunctionSpecHash + "\nwant: '" + annotationVal + "'\ngot: '" + val + "'")
 		t.Fail()
 	}
+
+	if _, ok := annotations[annotationFunctionSpec]; ok {
+		t.Errorf("the full spec must not be stored in annotation " + annotationFunctionSpec)
+	}
 }
 
 func Test_makeAnnotationsDoesNotModifyOriginalSpec(t *testing.T) {
@@ -81,9 +92,9 @@ func Test_makeAnnotationsDoesNotModifyOriginalSpec(t *testing.T) {
 	}
 
 	expectedAnnotations := map[string]string{
-		"prometheus.io.scrape": "false",
-		"test.foo":             "bar",
-		annotationFunctionSpec: `{"name":"testfunc","image":"","annotations":{"test.foo":"bar"},"readOnlyRootFilesystem":false}`,
+		"prometheus.io.scrape":     "false",
+		"test.foo":                 "bar",
+		annotationFunctionSpecHash: sha256Hex(`{"name":"testfunc","image":"","annotations":{"test.foo":"bar"},"readOnlyRootFilesystem":false}`),
 	}
 
 	makeAnnotations(function)
@@ -104,3 +115,33 @@ func Test_makeAnnotationsDoesNotModifyOriginalSpec(t *testing.T) {
 		}
 	}
 }
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func Test_makeAnnotations_KeepsScrapeAnnotations(t *testing.T) {
+	function := &faasv1.Function{
+		Spec: faasv1.FunctionSpec{
+			Name: "testfunc",
+			Annotations: &map[string]string{
+				"prometheus.io/scrape": "true",
+				"prometheus.io/port":   "8081",
+			},
+		},
+	}
+
+	annotations := makeAnnotations(function)
+	if _, ok := annotations["prometheus.io.scrape"]; ok {
+		t.Errorf("want no default scrape annotation when prometheus.io/scrape is set")
+	}
+	if annotations["prometheus.io/scrape"] != "true" {
+		t.Errorf("want prometheus.io/scrape to be true, got %q", annotations["prometheus.io/scrape"])
+	}
+
+	service := newService(function, k8s.DefaultFunctionPort)
+	if service.Annotations["prometheus.io/port"] != "8081" {
+		t.Errorf("want the service to keep prometheus.io/port, got %v", service.Annotations)
+	}
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-cmp/cmp"
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// TLSMountPath is where tls.crt, tls.key and ca.crt are mounted in the function
+	TLSMountPath = k8s.TLSMountPath
+
+	// ReasonCertificateFailed is used for the Event when the Certificate of a
+	// Function can not be built or applied
+	ReasonCertificateFailed = "CertificateFailed"
+)
+
+var certificateResource = k8s.CertificateResource
+
+// certificateName is the name of the Certificate of a Function and of the Secret
+// that cert-manager writes the key pair to
+func certificateName(function *faasv1.Function) string {
+	return k8s.CertificateName(function.Spec.Name)
+}
+
+// newCertificate creates the cert-manager Certificate for the Service of a Function
+// from its com.openfaas.tls.* annotations, nil is returned when the Function does
+// not set an issuer. It is controlled by the Function.
+func newCertificate(function *faasv1.Function) (*unstructured.Unstructured, error) {
+	certificate, err := k8s.MakeCertificate(function.Spec.Name, function.Namespace, annotationsOf(function))
+	if err != nil || certificate == nil {
+		return nil, err
+	}
+
+	owner := metav1.NewControllerRef(function, schema.GroupVersionKind{
+		Group:   faasv1.SchemeGroupVersion.Group,
+		Version: faasv1.SchemeGroupVersion.Version,
+		Kind:    faasKind,
+	})
+	certificate.SetOwnerReferences([]metav1.OwnerReference{*owner})
+
+	return certificate, nil
+}
+
+// configureCertificate mounts the Secret of the Function's Certificate at
+// TLSMountPath
+func configureCertificate(function *faasv1.Function, statefulset *appsv1.StatefulSet) {
+	k8s.ConfigureCertificate(statefulset, function.Spec.Name, annotationsOf(function))
+}
+
+// syncCertificate applies the Certificate of the Function, or removes it together
+// with its Secret when the Function has changed and no longer sets an issuer. Only
+// a Certificate that is controlled by the Function is removed.
+func (c *Controller) syncCertificate(ctx context.Context, function *faasv1.Function, changed bool) error {
+	if c.dynamicclientset == nil {
+		return nil
+	}
+
+	logger := functionLogger(function)
+	certificates := c.dynamicclientset.Resource(certificateResource).Namespace(function.Namespace)
+
+	desired, err := newCertificate(function)
+	if err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonCertificateFailed, err.Error())
+		logger.Error(err, "Invalid TLS annotations")
+		return nil
+	}
+
+	if desired == nil {
+		if !changed {
+			return nil
+		}
+
+		existing, err := certificates.Get(ctx, certificateName(function), metav1.GetOptions{})
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !metav1.IsControlledBy(existing, function) {
+			return nil
+		}
+
+		logger.Info("Deleting Certificate")
+		if err := certificates.Delete(ctx, existing.GetName(), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+
+		// cert-manager keeps the Secret of a deleted Certificate by default
+		secrets := c.kubeclientset.CoreV1().Secrets(function.Namespace)
+		secret, err := secrets.Get(ctx, existing.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if secret.Annotations["cert-manager.io/certificate-name"] != existing.GetName() {
+			return nil
+		}
+		if err := secrets.Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	k8s.AddLabels(desired, c.costLabels(function))
+
+	logger.V(2).Info("Applying Certificate")
+	if _, err := certificates.Apply(ctx, desired.GetName(), desired, metav1.ApplyOptions{FieldManager: controllerAgentName, Force: true}); err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonCertificateFailed,
+			fmt.Sprintf("Certificate can not be applied: %s", err))
+		return err
+	}
+
+	return nil
+}
+
+// diffCertificate returns the changes to the Certificate of the Function for the
+// dry-run mode
+func (c *Controller) diffCertificate(ctx context.Context, function *faasv1.Function) (string, error) {
+	if c.dynamicclientset == nil {
+		return "", nil
+	}
+
+	desired, err := newCertificate(function)
+	if err != nil {
+		return "", err
+	}
+
+	actual, err := c.dynamicclientset.Resource(certificateResource).Namespace(function.Namespace).
+		Get(ctx, certificateName(function), metav1.GetOptions{})
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		actual = nil
+	} else if err != nil {
+		return "", err
+	}
+
+	switch {
+	case desired == nil && actual != nil && metav1.IsControlledBy(actual, function):
+		return "certificate will be deleted", nil
+	case desired == nil:
+		return "", nil
+	case actual == nil:
+		return "certificate will be created", nil
+	case !equality.Semantic.DeepDerivative(desired.Object["spec"], actual.Object["spec"]):
+		return cmp.Diff(actual.Object["spec"], desired.Object["spec"]), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_newCertificate_NoIssuer(t *testing.T) {
+	certificate, err := newCertificate(newRouteFunction(map[string]string{"com.openfaas.tls.dns-names": "figlet.internal"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if certificate != nil {
+		t.Errorf("want no Certificate without an issuer, got %v", certificate.Object)
+	}
+}
+
+func Test_newCertificate(t *testing.T) {
+	certificate, err := newCertificate(newRouteFunction(map[string]string{
+		"com.openfaas.tls.issuer":      "internal-ca",
+		"com.openfaas.tls.issuer-kind": "Issuer",
+		"com.openfaas.tls.dns-names":   "figlet.internal, figlet.example.com",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if certificate.GetName() != "figlet-serving-cert" {
+		t.Errorf("want the Certificate figlet-serving-cert, got %s", certificate.GetName())
+	}
+	if owner := metav1.GetControllerOf(certificate); owner == nil || owner.Name != "figlet" {
+		t.Errorf("want the Certificate to be controlled by the Function, got %v", owner)
+	}
+	if secretName, _, _ := unstructured.NestedString(certificate.Object, "spec", "secretName"); secretName != "figlet-serving-cert" {
+		t.Errorf("want the Secret figlet-serving-cert, got %q", secretName)
+	}
+	if kind, _, _ := unstructured.NestedString(certificate.Object, "spec", "issuerRef", "kind"); kind != "Issuer" {
+		t.Errorf("want the issuer kind Issuer, got %q", kind)
+	}
+
+	dnsNames, _, _ := unstructured.NestedStringSlice(certificate.Object, "spec", "dnsNames")
+	want := []string{
+		"figlet",
+		"figlet.openfaas-fn",
+		"figlet.openfaas-fn.svc",
+		"figlet.openfaas-fn.svc.cluster.local",
+		"figlet.internal",
+		"figlet.example.com",
+	}
+	if !reflect.DeepEqual(want, dnsNames) {
+		t.Errorf("want the DNS names %v, got %v", want, dnsNames)
+	}
+}
+
+func Test_newCertificate_InvalidIssuerKind(t *testing.T) {
+	_, err := newCertificate(newRouteFunction(map[string]string{
+		"com.openfaas.tls.issuer":      "internal-ca",
+		"com.openfaas.tls.issuer-kind": "Vault",
+	}))
+	if err == nil {
+		t.Fatalf("want an error for an unknown issuer kind")
+	}
+}
+
+func Test_configureCertificate(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "figlet"}}},
+			},
+		},
+	}
+
+	configureCertificate(newRouteFunction(map[string]string{"com.openfaas.tls.issuer": "internal-ca"}), statefulset)
+
+	volumes := statefulset.Spec.Template.Spec.Volumes
+	if len(volumes) != 1 || volumes[0].Secret == nil || volumes[0].Secret.SecretName != "figlet-serving-cert" {
+		t.Fatalf("want the certificate's Secret as a volume, got %+v", volumes)
+	}
+
+	mounts := statefulset.Spec.Template.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].MountPath != TLSMountPath || !mounts[0].ReadOnly {
+		t.Fatalf("want a read-only mount at %s, got %+v", TLSMountPath, mounts)
+	}
+}
+
+func Test_syncCertificate_RemovesCertificateAndSecret(t *testing.T) {
+	previous, _ := newCertificate(newRouteFunction(map[string]string{"com.openfaas.tls.issuer": "internal-ca"}))
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		certificateResource: "CertificateList",
+	}, previous)
+	kubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "figlet-serving-cert",
+			Namespace:   "openfaas-fn",
+			Annotations: map[string]string{"cert-manager.io/certificate-name": "figlet-serving-cert"},
+		},
+	})
+
+	c := &Controller{dynamicclientset: dynamicClient, kubeclientset: kubeClient, recorder: record.NewFakeRecorder(10)}
+
+	if err := c.syncCertificate(context.Background(), newRouteFunction(map[string]string{}), true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := dynamicClient.Resource(certificateResource).Namespace("openfaas-fn").
+		Get(context.Background(), "figlet-serving-cert", metav1.GetOptions{}); err == nil {
+		t.Errorf("want the Certificate to be deleted when the Function no longer sets an issuer")
+	}
+	if _, err := kubeClient.CoreV1().Secrets("openfaas-fn").
+		Get(context.Background(), "figlet-serving-cert", metav1.GetOptions{}); err == nil {
+		t.Errorf("want the Secret of the Certificate to be deleted")
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -21,19 +25,24 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
-	glog "k8s.io/klog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
 	faasscheme "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/scheme"
 	informers "github.com/openfaas/faas-netes/pkg/client/informers/externalversions"
 	listers "github.com/openfaas/faas-netes/pkg/client/listers/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/openfaas/faas-netes/pkg/tracing"
 )
 
 const (
 	controllerAgentName = "openfaas-operator"
 	faasKind            = "Function"
-	functionPort        = 8080
 	LabelMinReplicas    = "com.openfaas.scale.min"
 	// SuccessSynced is used as part of the Event 'reason' when a Function is synced
 	SuccessSynced = "Synced"
@@ -53,13 +62,16 @@ const (
 type Controller struct {
 	// kubeclientset is a standard kubernetes clientset
 	kubeclientset kubernetes.Interface
+	// dynamicclientset manages the resources of add-ons such as KEDA, whose
+	// CRDs may not be installed
+	dynamicclientset dynamic.Interface
 	// faasclientset is a clientset for our own API group
 	faasclientset clientset.Interface
 
-	statefulSetLister appslisters.StatefulSetLister
+	statefulSetLister  appslisters.StatefulSetLister
 	statefulsetsSynced cache.InformerSynced
-	functionsLister   listers.FunctionLister
-	functionsSynced   cache.InformerSynced
+	functionsLister    listers.FunctionLister
+	functionsSynced    cache.InformerSynced
 
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
@@ -73,15 +85,24 @@ type Controller struct {
 
 	// OpenFaaS function factory
 	factory FunctionFactory
+
+	// dryRun computes the changes for each Function without applying them,
+	// the diffs are kept by namespace/name for MakeDryRunHandler
+	dryRun    bool
+	diffs     map[string]FunctionDiff
+	diffsLock sync.RWMutex
 }
 
-// NewController returns a new OpenFaaS controller
+// NewController returns a new OpenFaaS controller, when dryRun is set the
+// controller only logs and records the changes it would make
 func NewController(
 	kubeclientset kubernetes.Interface,
 	faasclientset clientset.Interface,
+	dynamicclientset dynamic.Interface,
 	kubeInformerFactory kubeinformers.SharedInformerFactory,
 	faasInformerFactory informers.SharedInformerFactory,
-	factory FunctionFactory) *Controller {
+	factory FunctionFactory,
+	dryRun bool) *Controller {
 
 	// obtain references to shared index informers for the statefulset and Function types
 	statefulsetInformer := kubeInformerFactory.Apps().V1().StatefulSets()
@@ -91,25 +112,29 @@ func NewController(
 	// Add o6s types to the default Kubernetes Scheme so Events can be
 	// logged for faas-controller types.
 	faasscheme.AddToScheme(scheme.Scheme)
-	glog.V(4).Info("Creating event broadcaster")
+	logger := logging.Default().WithName("controller")
+	logger.V(4).Info("Creating event broadcaster")
 	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(glog.V(4).Infof)
+	eventBroadcaster.StartStructuredLogging(4)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
 	controller := &Controller{
-		kubeclientset:     kubeclientset,
-		faasclientset:     faasclientset,
-		statefulSetLister: statefulsetInformer.Lister(),
+		kubeclientset:      kubeclientset,
+		faasclientset:      faasclientset,
+		dynamicclientset:   dynamicclientset,
+		statefulSetLister:  statefulsetInformer.Lister(),
 		statefulsetsSynced: statefulsetInformer.Informer().HasSynced,
-		functionsLister:   faasInformer.Lister(),
-		functionsSynced:   faasInformer.Informer().HasSynced,
-		workqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Functions"),
-		recorder:          recorder,
-		factory:           factory,
+		functionsLister:    faasInformer.Lister(),
+		functionsSynced:    faasInformer.Informer().HasSynced,
+		workqueue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Functions"),
+		recorder:           recorder,
+		factory:            factory,
+		dryRun:             dryRun,
+		diffs:              map[string]FunctionDiff{},
 	}
 
-	glog.Info("Setting up event handlers")
+	logger.Info("Setting up event handlers")
 
 	//  Add Function (OpenFaaS CRD-entry) Informer
 	//
@@ -125,6 +150,7 @@ func NewController(
 	// can't be materialized. This logs abnormal events like ImagePullBackOff, back-off restarting failed container,
 	// failed to start container, oci runtime errors, etc
 	// Enable this with -v=3
+	// Failed image pulls are also recorded on the Function.
 	kubeInformerFactory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			key, err := cache.MetaNamespaceKeyFunc(obj)
@@ -133,8 +159,9 @@ func NewController(
 				since := time.Since(event.LastTimestamp.Time)
 				// log abnormal events occurred in the last minute
 				if since.Seconds() < 61 && strings.Contains(event.Type, "Warning") {
-					glog.V(3).Infof("Abnormal event detected on %s %s: %s", event.LastTimestamp, key, event.Message)
+					logger.V(3).Info("Abnormal event detected", "event", key, "lastTimestamp", event.LastTimestamp, "message", event.Message)
 				}
+				controller.recordImagePullEvent(event)
 			}
 		},
 	})
@@ -152,20 +179,21 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 
 	// Start the informer factories to begin populating the informer caches
 	// Wait for the caches to be synced before starting workers
-	glog.Info("Waiting for informer caches to sync")
+	logger := logging.Default().WithName("controller")
+	logger.Info("Waiting for informer caches to sync")
 	if ok := cache.WaitForCacheSync(stopCh, c.statefulsetsSynced, c.functionsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
-	glog.Info("Starting workers")
+	logger.Info("Starting workers")
 	// Launch two workers to process Function resources
 	for i := 0; i < threadiness; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
 
-	glog.Info("Started workers")
+	logger.Info("Started workers")
 	<-stopCh
-	glog.Info("Shutting down workers")
+	logger.Info("Shutting down workers")
 
 	return nil
 }
@@ -195,7 +223,13 @@ func (c *Controller) processNextWorkItem() bool {
 			runtime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
 			return nil
 		}
-		if err := c.syncHandler(key); err != nil {
+		ctx, span := tracing.Tracer().Start(context.Background(), "reconcile",
+			trace.WithAttributes(attribute.String("function.key", key)))
+		defer span.End()
+
+		if err := c.syncHandler(ctx, key); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 			return fmt.Errorf("error syncing '%s': %s", key, err.Error())
 		}
 		c.workqueue.Forget(obj)
@@ -212,7 +246,7 @@ func (c *Controller) processNextWorkItem() bool {
 
 // syncHandler compares the actual state with the desired, and attempts to
 // converge the two.
-func (c *Controller) syncHandler(key string) error {
+func (c *Controller) syncHandler(ctx context.Context, key string) error {
 	// Convert the namespace/name string into a distinct namespace and name
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
@@ -226,6 +260,9 @@ func (c *Controller) syncHandler(key string) error {
 		// The Function resource may no longer exist, in which case we stop processing.
 		if errors.IsNotFound(err) {
 			runtime.HandleError(fmt.Errorf("function '%s' in work queue no longer exists", key))
+			if c.dryRun {
+				c.deleteDryRunDiff(key)
+			}
 			return nil
 		}
 
@@ -241,6 +278,12 @@ func (c *Controller) syncHandler(key string) error {
 		return nil
 	}
 
+	if c.dryRun {
+		return c.syncDryRun(function)
+	}
+
+	logger := functionLogger(function)
+
 	// Get the statefulset with the name specified in Function.spec
 	statefulset, err := c.statefulSetLister.StatefulSets(function.Namespace).Get(statefulsetName)
 	// If the resource doesn't exist, we'll create it
@@ -248,29 +291,38 @@ func (c *Controller) syncHandler(key string) error {
 		err = nil
 		existingSecrets, err := c.getSecrets(function.Namespace, function.Spec.Secrets)
 		if err != nil {
-			return err
+			return c.reconcileFailed(function, err)
+		}
+
+		logger.Info("Creating statefulset")
+		statefulsetSpec, conflicts, err := newStatefulSet(function, statefulset, existingSecrets, c.factory)
+		if err != nil {
+			return c.reconcileFailed(function, err)
 		}
 
-		glog.Infof("Creating statefulset for '%s'", function.Spec.Name)
 		statefulset, err = c.kubeclientset.AppsV1().StatefulSets(function.Namespace).Create(
-			context.TODO(),
-			newStatefulSet(function, statefulset, existingSecrets, c.factory),
-			metav1.CreateOptions{},
+			ctx,
+			statefulsetSpec,
+			metav1.CreateOptions{FieldManager: controllerAgentName},
 		)
 		if err != nil {
 			return err
 		}
+
+		c.reconcileSucceeded(function, conflicts)
 	}
 
 	svcGetOptions := metav1.GetOptions{}
-	_, getSvcErr := c.kubeclientset.CoreV1().Services(function.Namespace).Get(context.TODO(), statefulsetName, svcGetOptions)
+	_, getSvcErr := c.kubeclientset.CoreV1().Services(function.Namespace).Get(ctx, statefulsetName, svcGetOptions)
 	if errors.IsNotFound(getSvcErr) {
-		glog.Infof("Creating ClusterIP service for '%s'", function.Spec.Name)
-		if _, err := c.kubeclientset.CoreV1().Services(function.Namespace).Create(context.TODO(), newService(function), metav1.CreateOptions{}); err != nil {
+		logger.Info("Creating ClusterIP service")
+		service := newService(function, c.factory.Factory.Config.HTTPPort())
+		k8s.AddLabels(service, c.costLabels(function))
+		if _, err := c.kubeclientset.CoreV1().Services(function.Namespace).Create(ctx, service, metav1.CreateOptions{FieldManager: controllerAgentName}); err != nil {
 			// If an error occurs during Service Create, we'll requeue the item
 			if errors.IsAlreadyExists(err) {
 				err = nil
-				glog.V(2).Infof("ClusterIP service '%s' already exists. Skipping creation.", function.Spec.Name)
+				logger.V(2).Info("ClusterIP service already exists, skipping creation")
 			} else {
 				return err
 			}
@@ -292,34 +344,72 @@ func (c *Controller) syncHandler(key string) error {
 		return fmt.Errorf(msg)
 	}
 
-	// Update the statefulset resource if the Function definition differs
-	if statefulsetNeedsUpdate(function, statefulset) {
-		glog.Infof("Updating statefulset for '%s'", function.Spec.Name)
+	// the secrets are read on each sync so that a change of their data restarts the
+	// Pods, an error is only reported when the statefulset is updated
+	existingSecrets, secretsErr := c.getSecrets(function.Namespace, function.Spec.Secrets)
+	if secretsErr != nil {
+		existingSecrets = nil
+	}
 
-		existingSecrets, err := c.getSecrets(function.Namespace, function.Spec.Secrets)
+	// Update the statefulset resource if the Function definition or the data of its
+	// secrets differs
+	changed := statefulsetNeedsUpdate(function, statefulset, existingSecrets)
+	if changed {
+		if secretsErr != nil {
+			return c.reconcileFailed(function, secretsErr)
+		}
+
+		statefulsetSpec, conflicts, err := newStatefulSet(function, statefulset, existingSecrets, c.factory)
 		if err != nil {
-			return err
+			return c.reconcileFailed(function, err)
 		}
 
-		statefulset, err = c.kubeclientset.AppsV1().StatefulSets(function.Namespace).Update(
-			context.TODO(),
-			newStatefulSet(function, statefulset, existingSecrets, c.factory),
-			metav1.UpdateOptions{},
-		)
+		// labels and annotations added by other controllers are kept, only those
+		// removed from the Function are removed
+		prior := statefulset
+		statefulsetSpec.Labels = k8s.KeepExternalLabels(statefulsetSpec.Labels, prior)
+		statefulsetSpec.Annotations = k8s.KeepExternalAnnotations(statefulsetSpec.Annotations, prior.Annotations, prior)
+
+		// changes that leave the Pod template as it is, such as to the labels or
+		// annotations of the Function, are patched so that the Pods keep running
+		if podTemplateChanged(prior, statefulsetSpec) {
+			logger.Info("Updating statefulset")
+			statefulset, err = c.kubeclientset.AppsV1().StatefulSets(function.Namespace).Update(
+				ctx,
+				statefulsetSpec,
+				metav1.UpdateOptions{FieldManager: controllerAgentName},
+			)
+		} else {
+			logger.Info("Patching statefulset without restarting its pods")
+			var patch []byte
+			patch, err = statefulsetMetadataPatch(prior, statefulsetSpec)
+			if err == nil {
+				statefulset, err = c.kubeclientset.AppsV1().StatefulSets(function.Namespace).Patch(
+					ctx,
+					statefulsetName,
+					types.StrategicMergePatchType,
+					patch,
+					metav1.PatchOptions{FieldManager: controllerAgentName},
+				)
+			}
+		}
 
 		if err != nil {
-			glog.Errorf("Updating statefulset for '%s' failed: %v", function.Spec.Name, err)
+			logger.Error(err, "Updating statefulset failed")
+		} else {
+			c.reconcileSucceeded(function, conflicts)
 		}
 
-		existingService, err := c.kubeclientset.CoreV1().Services(function.Namespace).Get(context.TODO(), function.Spec.Name, metav1.GetOptions{})
+		existingService, err := c.kubeclientset.CoreV1().Services(function.Namespace).Get(ctx, function.Spec.Name, metav1.GetOptions{})
 		if err != nil {
 			return err
 		}
 
-		existingService.Annotations = makeAnnotations(function)
-		_, err = c.kubeclientset.CoreV1().Services(function.Namespace).Update(context.TODO(), existingService, metav1.UpdateOptions{})
+		existingService.Annotations = k8s.KeepExternalAnnotations(makeAnnotations(function), existingService.Annotations, prior)
+		existingService.Spec.Ports = newService(function, c.factory.Factory.Config.HTTPPort()).Spec.Ports
+		_, err = c.kubeclientset.CoreV1().Services(function.Namespace).Update(ctx, existingService, metav1.UpdateOptions{FieldManager: controllerAgentName})
 		if err != nil {
-			glog.Errorf("Updating service for '%s' failed: %v", function.Spec.Name, err)
+			logger.Error(err, "Updating service failed")
 		}
 	}
 
@@ -330,6 +420,34 @@ func (c *Controller) syncHandler(key string) error {
 		return err
 	}
 
+	if err := c.syncScaledObject(ctx, function, changed); err != nil {
+		return err
+	}
+
+	if err := c.syncHPA(ctx, function, changed); err != nil {
+		return err
+	}
+
+	if err := c.syncSecretProviderClass(ctx, function, changed); err != nil {
+		return err
+	}
+
+	if err := c.syncRoute(ctx, function, changed); err != nil {
+		return err
+	}
+
+	if err := c.syncCertificate(ctx, function, changed); err != nil {
+		return err
+	}
+
+	if err := c.syncEgressPolicy(ctx, function, changed); err != nil {
+		return err
+	}
+
+	if err := c.syncMeshPolicy(ctx, function); err != nil {
+		return err
+	}
+
 	c.recorder.Event(function, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
 	return nil
 }
@@ -366,10 +484,10 @@ func (c *Controller) handleObject(obj interface{}) {
 			runtime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
 			return
 		}
-		glog.V(4).Infof("Recovered deleted object '%s' from tombstone", object.GetName())
+		logging.Default().V(4).Info("Recovered deleted object from tombstone", "object", object.GetName())
 	}
 
-	glog.V(4).Infof("Processing object: %s", object.GetName())
+	logging.Default().V(4).Info("Processing object", "object", object.GetName())
 	if ownerRef := metav1.GetControllerOf(object); ownerRef != nil {
 		// If this object is not owned by a function, we should not do anything more
 		// with it.
@@ -379,7 +497,8 @@ func (c *Controller) handleObject(obj interface{}) {
 
 		function, err := c.functionsLister.Functions(object.GetNamespace()).Get(ownerRef.Name)
 		if err != nil {
-			glog.Infof("Function '%s' deleted. Ignoring orphaned object '%s'", ownerRef.Name, object.GetSelfLink())
+			logging.Default().Info("Function deleted, ignoring orphaned object",
+				"function", ownerRef.Name, "namespace", object.GetNamespace(), "object", object.GetName())
 			return
 		}
 
@@ -388,18 +507,38 @@ func (c *Controller) handleObject(obj interface{}) {
 	}
 }
 
+// functionLogger returns the logger for the lines about a Function
+func functionLogger(function *faasv1.Function) logr.Logger {
+	return logging.Default().WithName("controller").
+		WithValues("function", function.Spec.Name, "namespace", function.Namespace)
+}
+
 // getSecrets queries Kubernetes for a list of secrets by name in the given k8s namespace.
 func (c *Controller) getSecrets(namespace string, secretNames []string) (map[string]*corev1.Secret, error) {
 	secrets := map[string]*corev1.Secret{}
 
 	for _, secretName := range secretNames {
+		if k8s.IsExternalSecret(secretName) {
+			continue
+		}
+
 		secret, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
 		if err != nil {
-			return secrets, err
+			return secrets, &reconcileError{
+				reason: faasv1.ReasonSecretsFailed,
+				err:    fmt.Errorf("required secret '%s' can not be retrieved: %w", secretName, err),
+			}
 		}
 		secrets[secretName] = secret
 	}
 
+	if err := c.factory.Factory.CheckSecretPolicy(context.TODO(), namespace, secrets); err != nil {
+		return secrets, &reconcileError{
+			reason: faasv1.ReasonSecretsFailed,
+			err:    err,
+		}
+	}
+
 	return secrets, nil
 }
 
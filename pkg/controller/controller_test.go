@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	faasfake "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/fake"
+	listers "github.com/openfaas/faas-netes/pkg/client/listers/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_syncHandler_CreatesStatefulSet(t *testing.T) {
+	labels := map[string]string{"team": "payments"}
+	annotations := map[string]string{"topic": "orders"}
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "figlet-uid"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "figlet",
+			Image:       "ghcr.io/openfaas/figlet:latest",
+			Labels:      &labels,
+			Annotations: &annotations,
+		},
+	}
+
+	functions := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	functions.Add(function)
+	statefulsets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	kubeClient := fake.NewSimpleClientset()
+	c := &Controller{
+		kubeclientset:     kubeClient,
+		faasclientset:     faasfake.NewSimpleClientset(function),
+		functionsLister:   listers.NewFunctionLister(functions),
+		statefulSetLister: appslisters.NewStatefulSetLister(statefulsets),
+		recorder:          record.NewFakeRecorder(10),
+		factory: NewFunctionFactory(kubeClient, k8s.DeploymentConfig{
+			LivenessProbe:  &k8s.ProbeConfig{},
+			ReadinessProbe: &k8s.ProbeConfig{},
+		}),
+	}
+
+	if err := c.syncHandler(context.Background(), "openfaas-fn/figlet"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	created, err := kubeClient.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want the statefulset to be created: %s", err)
+	}
+	if created.Spec.Template.Labels["team"] != "payments" || created.Annotations["topic"] != "orders" {
+		t.Errorf("want the labels and annotations of the Function, got %v %v", created.Spec.Template.Labels, created.Annotations)
+	}
+	if !metav1.IsControlledBy(created, function) {
+		t.Errorf("want the statefulset to be controlled by the Function")
+	}
+}
+
+func Test_syncHandler_PatchesAnnotationsWithoutRestart(t *testing.T) {
+	annotations := map[string]string{"topic": "orders"}
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "figlet-uid"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "figlet",
+			Image:       "ghcr.io/openfaas/figlet:latest",
+			Annotations: &annotations,
+		},
+	}
+
+	functions := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	functions.Add(function)
+	statefulsets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	kubeClient := fake.NewSimpleClientset()
+	c := &Controller{
+		kubeclientset:     kubeClient,
+		faasclientset:     faasfake.NewSimpleClientset(function),
+		functionsLister:   listers.NewFunctionLister(functions),
+		statefulSetLister: appslisters.NewStatefulSetLister(statefulsets),
+		recorder:          record.NewFakeRecorder(10),
+		factory: NewFunctionFactory(kubeClient, k8s.DeploymentConfig{
+			LivenessProbe:  &k8s.ProbeConfig{},
+			ReadinessProbe: &k8s.ProbeConfig{},
+		}),
+	}
+
+	if err := c.syncHandler(context.Background(), "openfaas-fn/figlet"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	created, err := kubeClient.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want the statefulset to be created: %s", err)
+	}
+	statefulsets.Add(created)
+
+	updated := function.DeepCopy()
+	updated.Spec.Annotations = &map[string]string{"topic": "invoices"}
+	functions.Update(updated)
+	kubeClient.ClearActions()
+
+	if err := c.syncHandler(context.Background(), "openfaas-fn/figlet"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, action := range kubeClient.Actions() {
+		if action.GetResource().Resource == "statefulsets" && action.GetVerb() == "update" {
+			t.Fatalf("want the statefulset to be patched, got an update")
+		}
+	}
+	patched, err := kubeClient.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if patched.Annotations["topic"] != "invoices" {
+		t.Errorf("want the annotation of the Function on the statefulset, got %v", patched.Annotations)
+	}
+	if patched.Spec.Template.Annotations["topic"] != "orders" {
+		t.Errorf("want the pod template to be kept, got %v", patched.Spec.Template.Annotations)
+	}
+}
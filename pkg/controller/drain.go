@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DrainRebalancer moves the Pods of functions off nodes that are cordoned, before
+// kubectl drain or a cluster upgrade evicts them all at once. One Pod of a function
+// is evicted at a time, from the highest ordinal as the StatefulSet scales down, and
+// only when the others are ready. The Eviction API is used, so PodDisruptionBudgets
+// are respected. The progress is recorded on the StatefulSet for the function status.
+type DrainRebalancer struct {
+	client       kubernetes.Interface
+	nodes        corelisters.NodeLister
+	pods         corelisters.PodLister
+	statefulsets appslisters.StatefulSetLister
+	namespace    string
+	interval     time.Duration
+
+	// notify runs a pass straight away when a node is cordoned
+	notify chan struct{}
+}
+
+// NewDrainRebalancer creates a DrainRebalancer for the functions in namespace, the
+// Pods are checked every interval and when a node is cordoned
+func NewDrainRebalancer(client kubernetes.Interface, nodes corelisters.NodeLister, pods corelisters.PodLister, statefulsets appslisters.StatefulSetLister, namespace string, interval time.Duration) *DrainRebalancer {
+	return &DrainRebalancer{
+		client:       client,
+		nodes:        nodes,
+		pods:         pods,
+		statefulsets: statefulsets,
+		namespace:    namespace,
+		interval:     interval,
+		notify:       make(chan struct{}, 1),
+	}
+}
+
+// NodeEventHandler starts a pass when a node is cordoned, it is registered with the
+// Node informer
+func (r *DrainRebalancer) NodeEventHandler() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, ok := oldObj.(*corev1.Node)
+			if !ok {
+				return
+			}
+			node, ok := newObj.(*corev1.Node)
+			if !ok {
+				return
+			}
+
+			if k8s.IsNodeDraining(node) && !k8s.IsNodeDraining(oldNode) {
+				select {
+				case r.notify <- struct{}{}:
+				default:
+				}
+			}
+		},
+	}
+}
+
+// Run moves the Pods off cordoned nodes until ctx is cancelled
+func (r *DrainRebalancer) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+
+		r.rebalance(ctx)
+	}
+}
+
+// rebalance evicts the next Pod of each function that runs on a cordoned node, and
+// records the progress of the functions that changed
+func (r *DrainRebalancer) rebalance(ctx context.Context) {
+	logger := logging.Default().WithName("drain")
+
+	nodes, err := r.nodes.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Unable to list nodes")
+		return
+	}
+	draining := map[string]bool{}
+	for _, node := range nodes {
+		if k8s.IsNodeDraining(node) {
+			draining[node.Name] = true
+		}
+	}
+
+	requirement, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		return
+	}
+	statefulsets, err := r.statefulsets.StatefulSets(r.namespace).List(labels.NewSelector().Add(*requirement))
+	if err != nil {
+		logger.Error(err, "Unable to list functions")
+		return
+	}
+
+	for _, statefulset := range statefulsets {
+		pods, err := r.pods.Pods(r.namespace).List(labels.SelectorFromSet(labels.Set{"faas_function": statefulset.Name}))
+		if err != nil {
+			logger.Error(err, "Unable to list the Pods of function", "function", statefulset.Name)
+			continue
+		}
+
+		status := r.rebalanceFunction(ctx, pods, draining)
+		if reflect.DeepEqual(status, k8s.ParseDrainStatus(statefulset.Annotations)) {
+			continue
+		}
+
+		if status != nil {
+			logger.Info("Moving function off cordoned nodes", "function", statefulset.Name,
+				"nodes", status.Nodes, "pending", status.Pending, "evicting", status.Evicting, "blocked", status.Blocked)
+		} else {
+			logger.Info("Function moved off cordoned nodes", "function", statefulset.Name)
+		}
+		if err := k8s.ApplyDrainStatus(ctx, r.client, r.namespace, statefulset.Name, status); err != nil {
+			logger.Error(err, "Unable to record the drain status", "function", statefulset.Name)
+		}
+	}
+}
+
+// rebalanceFunction evicts the next Pod of the function that runs on a draining
+// node, it returns nil when there are none left
+func (r *DrainRebalancer) rebalanceFunction(ctx context.Context, pods []*corev1.Pod, draining map[string]bool) *k8s.DrainStatus {
+	var moving []*corev1.Pod
+	nodes := map[string]bool{}
+	for _, pod := range pods {
+		if draining[pod.Spec.NodeName] {
+			moving = append(moving, pod)
+			nodes[pod.Spec.NodeName] = true
+		}
+	}
+	if len(moving) == 0 {
+		return nil
+	}
+
+	status := &k8s.DrainStatus{Pending: int32(len(moving))}
+	for node := range nodes {
+		status.Nodes = append(status.Nodes, node)
+	}
+	sort.Strings(status.Nodes)
+
+	// a Pod that is terminating or starting holds back the next eviction, so that
+	// only one replica of the function is unavailable at a time
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil {
+			continue
+		}
+		if draining[pod.Spec.NodeName] {
+			status.Evicting = pod.Name
+		} else {
+			status.Blocked = fmt.Sprintf("waiting for Pod %s to terminate", pod.Name)
+		}
+		return status
+	}
+	for _, pod := range pods {
+		if !isPodReady(pod) {
+			status.Blocked = fmt.Sprintf("waiting for Pod %s to be ready", pod.Name)
+			return status
+		}
+	}
+
+	sort.Slice(moving, func(i, j int) bool {
+		return podOrdinal(moving[i]) > podOrdinal(moving[j])
+	})
+	pod := moving[0]
+
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+	err := r.client.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+	switch {
+	case err == nil:
+		status.Evicting = pod.Name
+	case errors.IsTooManyRequests(err):
+		status.Blocked = fmt.Sprintf("eviction of Pod %s is blocked by a PodDisruptionBudget", pod.Name)
+	case errors.IsNotFound(err):
+		status.Evicting = pod.Name
+	default:
+		status.Blocked = fmt.Sprintf("eviction of Pod %s failed: %s", pod.Name, err)
+	}
+	return status
+}
+
+// podOrdinal returns the ordinal of a Pod of a StatefulSet from its name
+func podOrdinal(pod *corev1.Pod) int {
+	i := strings.LastIndex(pod.Name, "-")
+	if i < 0 {
+		return -1
+	}
+	ordinal, err := strconv.Atoi(pod.Name[i+1:])
+	if err != nil {
+		return -1
+	}
+	return ordinal
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newDrainPod(name, node string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn", Labels: map[string]string{"faas_function": "figlet"}},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}},
+	}
+}
+
+func newDrainRebalancer(t *testing.T, client *fake.Clientset, pods ...*corev1.Pod) *DrainRebalancer {
+	t.Helper()
+
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodes.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: corev1.NodeSpec{Unschedulable: true}})
+	nodes.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}})
+
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pod := range pods {
+		podIndexer.Add(pod)
+	}
+
+	statefulsets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	statefulsets.Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name: "figlet", Namespace: "openfaas-fn", Labels: map[string]string{"faas_function": "figlet"},
+	}})
+
+	return NewDrainRebalancer(client, corelisters.NewNodeLister(nodes), corelisters.NewPodLister(podIndexer),
+		appslisters.NewStatefulSetLister(statefulsets), "openfaas-fn", time.Second)
+}
+
+func Test_DrainRebalancer_EvictsTheHighestOrdinalFirst(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var evicted []string
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "eviction" {
+			evicted = append(evicted, action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName())
+		}
+		return true, nil, nil
+	})
+	var applied *appsv1.StatefulSet
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		applied = &appsv1.StatefulSet{}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), applied); err != nil {
+			return true, nil, err
+		}
+		return true, applied, nil
+	})
+
+	r := newDrainRebalancer(t, client,
+		newDrainPod("figlet-0", "node-1", true),
+		newDrainPod("figlet-1", "node-2", true),
+		newDrainPod("figlet-2", "node-1", true),
+	)
+	r.rebalance(context.Background())
+
+	if want := []string{"figlet-2"}; !reflect.DeepEqual(evicted, want) {
+		t.Errorf("want evicted Pods %v, got %v", want, evicted)
+	}
+	if applied == nil {
+		t.Fatal("want the drain status to be recorded")
+	}
+	want := &k8s.DrainStatus{Nodes: []string{"node-1"}, Pending: 2, Evicting: "figlet-2"}
+	if got := k8s.ParseDrainStatus(applied.Annotations); !reflect.DeepEqual(got, want) {
+		t.Errorf("want status %+v, got %+v", want, got)
+	}
+}
+
+func Test_DrainRebalancer_WaitsForReadyPods(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	r := newDrainRebalancer(t, client)
+
+	pods := []*corev1.Pod{
+		newDrainPod("figlet-0", "node-1", true),
+		newDrainPod("figlet-1", "node-2", false),
+	}
+	status := r.rebalanceFunction(context.Background(), pods, map[string]bool{"node-1": true})
+
+	want := &k8s.DrainStatus{Nodes: []string{"node-1"}, Pending: 1, Blocked: "waiting for Pod figlet-1 to be ready"}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("want status %+v, got %+v", want, status)
+	}
+	for _, action := range client.Actions() {
+		if action.GetSubresource() == "eviction" {
+			t.Errorf("want no eviction while a Pod is not ready")
+		}
+	}
+}
+
+func Test_DrainRebalancer_ReportsPodDisruptionBudget(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+	})
+	r := newDrainRebalancer(t, client)
+
+	pods := []*corev1.Pod{newDrainPod("figlet-0", "node-1", true)}
+	status := r.rebalanceFunction(context.Background(), pods, map[string]bool{"node-1": true})
+
+	want := &k8s.DrainStatus{Nodes: []string{"node-1"}, Pending: 1, Blocked: "eviction of Pod figlet-0 is blocked by a PodDisruptionBudget"}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("want status %+v, got %+v", want, status)
+	}
+}
+
+func Test_DrainRebalancer_NoPodsOnCordonedNodes(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	r := newDrainRebalancer(t, client)
+
+	pods := []*corev1.Pod{newDrainPod("figlet-0", "node-2", true)}
+	if status := r.rebalanceFunction(context.Background(), pods, map[string]bool{"node-1": true}); status != nil {
+		t.Errorf("want no status, got %+v", status)
+	}
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/google/go-cmp/cmp"
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FunctionDiff is the difference between the desired and the actual resources of
+// a Function, as found by the dry-run mode. The diffs are written with the actual
+// state as "-" and the desired state as "+".
+type FunctionDiff struct {
+	Namespace   string `json:"namespace"`
+	Function    string `json:"function"`
+	StatefulSet string `json:"statefulset,omitempty"`
+	Service     string `json:"service,omitempty"`
+	// ScaledObject is the diff of the KEDA ScaledObject
+	ScaledObject string `json:"scaledObject,omitempty"`
+	// HPA is the diff of the HorizontalPodAutoscaler for a Prometheus metric
+	HPA string `json:"hpa,omitempty"`
+	// Route is the diff of the Ingress or HTTPRoute
+	Route string `json:"route,omitempty"`
+	// Certificate is the diff of the cert-manager Certificate
+	Certificate string `json:"certificate,omitempty"`
+	// Egress is the diff of the NetworkPolicy or CiliumNetworkPolicy
+	Egress string `json:"egress,omitempty"`
+	// Error is set when the desired StatefulSet can not be built, for example
+	// due to a missing secret or Profile
+	Error string `json:"error,omitempty"`
+}
+
+// HasChanges returns true when applying the Function would change the cluster
+func (d FunctionDiff) HasChanges() bool {
+	return d.StatefulSet != "" || d.Service != "" || d.ScaledObject != "" || d.HPA != "" || d.Route != "" || d.Certificate != "" || d.Egress != "" || d.Error != ""
+}
+
+// syncDryRun computes the StatefulSet and Service for the Function and records how
+// they differ from the resources in the cluster, without applying any changes.
+func (c *Controller) syncDryRun(function *faasv1.Function) error {
+	diff := FunctionDiff{Namespace: function.Namespace, Function: function.Name}
+
+	statefulset, err := c.statefulSetLister.StatefulSets(function.Namespace).Get(function.Spec.Name)
+	if errors.IsNotFound(err) {
+		statefulset = nil
+	} else if err != nil {
+		return err
+	}
+
+	existingSecrets, err := c.getSecrets(function.Namespace, function.Spec.Secrets)
+	if err != nil {
+		diff.Error = err.Error()
+	} else {
+		desired, _, err := newStatefulSet(function, statefulset, existingSecrets, c.factory)
+		if err != nil {
+			diff.Error = err.Error()
+		} else {
+			diff.StatefulSet = diffStatefulSet(desired, statefulset)
+		}
+	}
+
+	service, err := c.kubeclientset.CoreV1().Services(function.Namespace).Get(context.TODO(), function.Spec.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		service = nil
+	} else if err != nil {
+		return err
+	}
+	diff.Service = diffService(newService(function, c.factory.Factory.Config.HTTPPort()), service)
+
+	if diff.ScaledObject, err = c.diffScaledObject(context.TODO(), function); err != nil {
+		diff.Error = err.Error()
+	}
+	if diff.HPA, err = c.diffHPA(context.TODO(), function); err != nil {
+		diff.Error = err.Error()
+	}
+	if diff.Route, err = c.diffRoute(context.TODO(), function); err != nil {
+		diff.Error = err.Error()
+	}
+	if diff.Certificate, err = c.diffCertificate(context.TODO(), function); err != nil {
+		diff.Error = err.Error()
+	}
+	if diff.Egress, err = c.diffEgressPolicy(context.TODO(), function); err != nil {
+		diff.Error = err.Error()
+	}
+
+	if diff.HasChanges() {
+		functionLogger(function).Info("Dry-run: changes for function",
+			"statefulset", diff.StatefulSet, "service", diff.Service, "scaledObject", diff.ScaledObject, "hpa", diff.HPA, "route", diff.Route, "certificate", diff.Certificate, "egress", diff.Egress, "error", diff.Error)
+	} else {
+		functionLogger(function).V(2).Info("Dry-run: no changes for function")
+	}
+
+	c.diffsLock.Lock()
+	c.diffs[function.Namespace+"/"+function.Name] = diff
+	c.diffsLock.Unlock()
+
+	return nil
+}
+
+func (c *Controller) deleteDryRunDiff(key string) {
+	c.diffsLock.Lock()
+	delete(c.diffs, key)
+	c.diffsLock.Unlock()
+}
+
+// diffStatefulSet only considers the fields that are set in desired, so that values
+// defaulted by the API server are not reported as changes
+func diffStatefulSet(desired, actual *appsv1.StatefulSet) string {
+	if actual == nil {
+		return "statefulset will be created"
+	}
+
+	if equality.Semantic.DeepDerivative(desired.Annotations, actual.Annotations) &&
+		equality.Semantic.DeepDerivative(desired.Spec, actual.Spec) {
+		return ""
+	}
+
+	return cmp.Diff(actual.Annotations, desired.Annotations) + cmp.Diff(actual.Spec, desired.Spec)
+}
+
+func diffService(desired, actual *corev1.Service) string {
+	if actual == nil {
+		return "service will be created"
+	}
+
+	if equality.Semantic.DeepDerivative(desired.Annotations, actual.Annotations) &&
+		equality.Semantic.DeepDerivative(desired.Spec, actual.Spec) {
+		return ""
+	}
+
+	return cmp.Diff(actual.Annotations, desired.Annotations) + cmp.Diff(actual.Spec, desired.Spec)
+}
+
+// MakeDryRunHandler returns the diffs found by the dry-run mode as JSON, only the
+// Functions with changes are returned unless the query parameter `all` is set
+func (c *Controller) MakeDryRunHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all := r.URL.Query().Get("all") != ""
+
+		c.diffsLock.RLock()
+		diffs := make([]FunctionDiff, 0, len(c.diffs))
+		for _, diff := range c.diffs {
+			if all || diff.HasChanges() {
+				diffs = append(diffs, diff)
+			}
+		}
+		c.diffsLock.RUnlock()
+
+		sort.Slice(diffs, func(i, j int) bool {
+			if diffs[i].Namespace != diffs[j].Namespace {
+				return diffs[i].Namespace < diffs[j].Namespace
+			}
+			return diffs[i].Function < diffs[j].Function
+		})
+
+		body, err := json.Marshal(diffs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_syncDryRun(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name:  "figlet",
+			Image: "ghcr.io/openfaas/figlet:latest",
+		},
+	}
+
+	kubeClient := fake.NewSimpleClientset()
+	factory := NewFunctionFactory(kubeClient,
+		k8s.DeploymentConfig{
+			LivenessProbe:  &k8s.ProbeConfig{},
+			ReadinessProbe: &k8s.ProbeConfig{},
+		})
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	c := &Controller{
+		kubeclientset:     kubeClient,
+		statefulSetLister: appslisters.NewStatefulSetLister(indexer),
+		factory:           factory,
+		dryRun:            true,
+		diffs:             map[string]FunctionDiff{},
+	}
+
+	if err := c.syncDryRun(function); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	diff := c.diffs["openfaas-fn/figlet"]
+	if diff.StatefulSet != "statefulset will be created" || diff.Service != "service will be created" {
+		t.Fatalf("expected the statefulset and service to be created, got %+v", diff)
+	}
+
+	actual, _, _ := newStatefulSet(function, nil, nil, factory)
+	indexer.Add(actual)
+	kubeClient.Tracker().Add(newService(function, k8s.DefaultFunctionPort))
+
+	if err := c.syncDryRun(function); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := c.diffs["openfaas-fn/figlet"]; diff.HasChanges() {
+		t.Fatalf("expected no changes, got %+v", diff)
+	}
+
+	updated := function.DeepCopy()
+	updated.Spec.Image = "ghcr.io/openfaas/figlet:0.2.0"
+	if err := c.syncDryRun(updated); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := c.diffs["openfaas-fn/figlet"]; diff.StatefulSet == "" || diff.Service != "" {
+		t.Fatalf("expected only the statefulset to change, got %+v", diff)
+	}
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() != "get" {
+			t.Fatalf("expected dry-run to only read resources, got %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ReasonEgressFailed is used for the Event when the egress policy of a
+	// Function can not be built or applied
+	ReasonEgressFailed = "EgressFailed"
+)
+
+var (
+	networkPolicyResource       = k8s.NetworkPolicyResource
+	ciliumNetworkPolicyResource = k8s.CiliumNetworkPolicyResource
+
+	// egressResources are checked for policies to remove, when a Function no longer
+	// sets an allowlist or changes the kind of its policy
+	egressResources = k8s.EgressResources
+)
+
+// egressPolicyName is the name of the NetworkPolicy or CiliumNetworkPolicy of a
+// Function
+func egressPolicyName(function *faasv1.Function) string {
+	return k8s.EgressPolicyName(function.Spec.Name)
+}
+
+// newEgressPolicy creates the NetworkPolicy or CiliumNetworkPolicy that restricts
+// the egress of a Function to its com.openfaas.egress allowlist, nil is returned
+// when the Function does not set one. It is controlled by the Function.
+func newEgressPolicy(function *faasv1.Function) (*unstructured.Unstructured, schema.GroupVersionResource, error) {
+	policy, resource, err := k8s.MakeEgressPolicy(function.Spec.Name, function.Namespace, annotationsOf(function))
+	if err != nil || policy == nil {
+		return nil, resource, err
+	}
+
+	owner := metav1.NewControllerRef(function, schema.GroupVersionKind{
+		Group:   faasv1.SchemeGroupVersion.Group,
+		Version: faasv1.SchemeGroupVersion.Version,
+		Kind:    faasKind,
+	})
+	policy.SetOwnerReferences([]metav1.OwnerReference{*owner})
+
+	return policy, resource, nil
+}
+
+// syncEgressPolicy applies the egress policy of the Function, and removes the
+// policy of the other kind, or both when the Function has changed and no longer
+// sets an allowlist. Only policies that are controlled by the Function are removed.
+func (c *Controller) syncEgressPolicy(ctx context.Context, function *faasv1.Function, changed bool) error {
+	if c.dynamicclientset == nil {
+		return nil
+	}
+
+	logger := functionLogger(function)
+
+	desired, desiredResource, err := newEgressPolicy(function)
+	if err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonEgressFailed, err.Error())
+		logger.Error(err, "Invalid egress annotations")
+		return nil
+	}
+
+	if changed {
+		for _, resource := range egressResources {
+			if desired != nil && resource == desiredResource {
+				continue
+			}
+			if err := c.deleteEgressPolicy(ctx, function, resource); err != nil {
+				return err
+			}
+		}
+	}
+
+	if desired == nil {
+		return nil
+	}
+
+	k8s.AddLabels(desired, c.costLabels(function))
+
+	logger.V(2).Info("Applying egress policy", "kind", desired.GetKind())
+	if _, err := c.dynamicclientset.Resource(desiredResource).Namespace(function.Namespace).
+		Apply(ctx, desired.GetName(), desired, metav1.ApplyOptions{FieldManager: controllerAgentName, Force: true}); err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonEgressFailed,
+			fmt.Sprintf("%s can not be applied: %s", desired.GetKind(), err))
+		return err
+	}
+
+	return nil
+}
+
+func (c *Controller) deleteEgressPolicy(ctx context.Context, function *faasv1.Function, resource schema.GroupVersionResource) error {
+	policies := c.dynamicclientset.Resource(resource).Namespace(function.Namespace)
+
+	existing, err := policies.Get(ctx, egressPolicyName(function), metav1.GetOptions{})
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !metav1.IsControlledBy(existing, function) {
+		return nil
+	}
+
+	functionLogger(function).Info("Deleting egress policy", "kind", existing.GetKind())
+	if err := policies.Delete(ctx, existing.GetName(), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// diffEgressPolicy returns the changes to the egress policy of the Function for
+// the dry-run mode
+func (c *Controller) diffEgressPolicy(ctx context.Context, function *faasv1.Function) (string, error) {
+	if c.dynamicclientset == nil {
+		return "", nil
+	}
+
+	desired, desiredResource, err := newEgressPolicy(function)
+	if err != nil {
+		return "", err
+	}
+
+	var changes []string
+	for _, resource := range egressResources {
+		actual, err := c.dynamicclientset.Resource(resource).Namespace(function.Namespace).
+			Get(ctx, egressPolicyName(function), metav1.GetOptions{})
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			actual = nil
+		} else if err != nil {
+			return "", err
+		}
+
+		switch {
+		case desired != nil && resource == desiredResource:
+			if actual == nil {
+				changes = append(changes, fmt.Sprintf("%s will be created", resource.Resource))
+			} else if !equality.Semantic.DeepDerivative(desired.Object["spec"], actual.Object["spec"]) {
+				changes = append(changes, cmp.Diff(actual.Object["spec"], desired.Object["spec"]))
+			}
+		case actual != nil && metav1.IsControlledBy(actual, function):
+			changes = append(changes, fmt.Sprintf("%s will be deleted", resource.Resource))
+		}
+	}
+
+	return strings.Join(changes, "\n"), nil
+}
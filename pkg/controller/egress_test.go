@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_newEgressPolicy_NoAllowlist(t *testing.T) {
+	policy, _, err := newEgressPolicy(newRouteFunction(map[string]string{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if policy != nil {
+		t.Errorf("want no policy without an allowlist, got %v", policy.Object)
+	}
+}
+
+func Test_newEgressPolicy_NetworkPolicy(t *testing.T) {
+	policy, resource, err := newEgressPolicy(newRouteFunction(map[string]string{
+		"com.openfaas.egress": "10.0.0.0/8,192.168.1.10:5432",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resource != networkPolicyResource || policy.GetName() != "figlet-egress" {
+		t.Fatalf("want the NetworkPolicy figlet-egress, got %s %s", policy.GetKind(), policy.GetName())
+	}
+	if owner := metav1.GetControllerOf(policy); owner == nil || owner.Name != "figlet" {
+		t.Errorf("want the NetworkPolicy to be controlled by the Function, got %v", owner)
+	}
+
+	types, _, _ := unstructured.NestedStringSlice(policy.Object, "spec", "policyTypes")
+	if len(types) != 1 || types[0] != "Egress" {
+		t.Errorf("want only egress to be restricted, got %v", types)
+	}
+
+	egress, _, _ := unstructured.NestedSlice(policy.Object, "spec", "egress")
+	if len(egress) != 3 {
+		t.Fatalf("want DNS and two rules, got %v", egress)
+	}
+	to, _, _ := unstructured.NestedSlice(egress[2].(map[string]interface{}), "to")
+	if cidr, _, _ := unstructured.NestedString(to[0].(map[string]interface{}), "ipBlock", "cidr"); cidr != "192.168.1.10/32" {
+		t.Errorf("want the CIDR 192.168.1.10/32, got %q", cidr)
+	}
+	ports, _, _ := unstructured.NestedSlice(egress[2].(map[string]interface{}), "ports")
+	if len(ports) != 1 || ports[0].(map[string]interface{})["port"] != int64(5432) {
+		t.Errorf("want port 5432, got %v", ports)
+	}
+}
+
+func Test_newEgressPolicy_HostRequiresCilium(t *testing.T) {
+	_, _, err := newEgressPolicy(newRouteFunction(map[string]string{
+		"com.openfaas.egress": "api.stripe.com:443",
+	}))
+	if err == nil {
+		t.Fatalf("want an error for a host in a NetworkPolicy")
+	}
+
+	policy, resource, err := newEgressPolicy(newRouteFunction(map[string]string{
+		"com.openfaas.egress":      "api.stripe.com:443",
+		"com.openfaas.egress.kind": "CiliumNetworkPolicy",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resource != ciliumNetworkPolicyResource {
+		t.Fatalf("want a CiliumNetworkPolicy, got %s", policy.GetKind())
+	}
+
+	egress, _, _ := unstructured.NestedSlice(policy.Object, "spec", "egress")
+	fqdns, _, _ := unstructured.NestedSlice(egress[1].(map[string]interface{}), "toFQDNs")
+	if len(fqdns) != 1 || fqdns[0].(map[string]interface{})["matchName"] != "api.stripe.com" {
+		t.Errorf("want api.stripe.com to be allowed, got %v", fqdns)
+	}
+}
+
+func Test_syncEgressPolicy_RemovesPolicyWithoutAllowlist(t *testing.T) {
+	policy, _, _ := newEgressPolicy(newRouteFunction(map[string]string{"com.openfaas.egress": "10.0.0.0/8"}))
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		networkPolicyResource:       "NetworkPolicyList",
+		ciliumNetworkPolicyResource: "CiliumNetworkPolicyList",
+	}, policy)
+
+	c := &Controller{dynamicclientset: dynamicClient, recorder: record.NewFakeRecorder(10)}
+
+	if err := c.syncEgressPolicy(context.Background(), newRouteFunction(map[string]string{}), true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := dynamicClient.Resource(networkPolicyResource).Namespace("openfaas-fn").Get(context.Background(), "figlet-egress", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("want the NetworkPolicy to be deleted when the Function no longer sets an allowlist")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/openfaas/faas-netes/pkg/k8s"
 	"github.com/openfaas/faas-provider/types"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 
 	"k8s.io/client-go/kubernetes"
 )
@@ -25,6 +26,12 @@ func NewFunctionFactory(clientset kubernetes.Interface, config k8s.DeploymentCon
 	}
 }
 
+// FunctionRequest converts a Function to the request of the REST API, so that it
+// can be validated in the same way as a deployment through the API
+func FunctionRequest(in *faasv1.Function) types.FunctionDeployment {
+	return functionToFunctionRequest(in)
+}
+
 func functionToFunctionRequest(in *faasv1.Function) types.FunctionDeployment {
 	env := make(map[string]string)
 	if in.Spec.Environment != nil {
@@ -71,12 +78,36 @@ func (f *FunctionFactory) ConfigureReadOnlyRootFilesystem(function *faasv1.Funct
 	f.Factory.ConfigureReadOnlyRootFilesystem(req, statefulset)
 }
 
+func (f *FunctionFactory) ApplyDefaultResources(resources *corev1.ResourceRequirements) {
+	f.Factory.ApplyDefaultResources(resources)
+}
+
 func (f *FunctionFactory) ConfigureContainerUserID(statefulset *appsv1.StatefulSet) {
 	f.Factory.ConfigureContainerUserID(statefulset)
 }
 
-func (f *FunctionFactory) ApplyProfile(profile k8s.Profile, statefulset *appsv1.StatefulSet) {
-	f.Factory.ApplyProfile(profile, statefulset)
+func (f *FunctionFactory) ConfigureMesh(statefulset *appsv1.StatefulSet) {
+	f.Factory.ConfigureMesh(statefulset)
+}
+
+func (f *FunctionFactory) ConfigureServiceToken(statefulset *appsv1.StatefulSet) {
+	f.Factory.ConfigureServiceToken(statefulset)
+}
+
+func (f *FunctionFactory) ConfigureTimeout(statefulset *appsv1.StatefulSet) {
+	f.Factory.ConfigureTimeout(statefulset)
+}
+
+func (f *FunctionFactory) ConfigureRollout(statefulset *appsv1.StatefulSet) error {
+	return f.Factory.ConfigureRollout(statefulset)
+}
+
+func (f *FunctionFactory) ConfigurePodSecurity(statefulset *appsv1.StatefulSet) error {
+	return f.Factory.ConfigurePodSecurity(statefulset)
+}
+
+func (f *FunctionFactory) ApplyProfile(profile k8s.Profile, statefulset *appsv1.StatefulSet) error {
+	return f.Factory.ApplyProfile(profile, statefulset)
 }
 
 func (f *FunctionFactory) RemoveProfile(profile k8s.Profile, statefulset *appsv1.StatefulSet) {
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-cmp/cmp"
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// newHPA creates the HorizontalPodAutoscaler for the StatefulSet of a Function from
+// its com.openfaas.scale.prometheus.* annotations, nil is returned when the Function
+// does not set a query. It is controlled by the Function.
+func newHPA(function *faasv1.Function) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	hpa, err := k8s.MakeHPA(function.Spec.Name, function.Namespace, annotationsOf(function), labelsOf(function))
+	if err != nil || hpa == nil {
+		return nil, err
+	}
+
+	hpa.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(function, schema.GroupVersionKind{
+			Group:   faasv1.SchemeGroupVersion.Group,
+			Version: faasv1.SchemeGroupVersion.Version,
+			Kind:    faasKind,
+		}),
+	}
+
+	return hpa, nil
+}
+
+// syncHPA creates or updates the HorizontalPodAutoscaler of the Function, or
+// removes it when the Function has changed and no longer sets a query. Only an
+// HPA that is controlled by the Function is changed or removed.
+func (c *Controller) syncHPA(ctx context.Context, function *faasv1.Function, changed bool) error {
+	logger := functionLogger(function)
+	hpas := c.kubeclientset.AutoscalingV2().HorizontalPodAutoscalers(function.Namespace)
+
+	desired, err := newHPA(function)
+	if err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonScalingFailed, err.Error())
+		logger.Error(err, "Invalid Prometheus scaling annotations")
+		return nil
+	}
+	if desired == nil && !changed {
+		return nil
+	}
+
+	existing, err := hpas.Get(ctx, function.Spec.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		existing = nil
+	} else if err != nil {
+		return err
+	}
+
+	if existing != nil && !metav1.IsControlledBy(existing, function) {
+		if desired != nil {
+			c.recorder.Event(function, corev1.EventTypeWarning, ReasonScalingFailed,
+				fmt.Sprintf("HorizontalPodAutoscaler %s already exists and is not managed by the Function", function.Spec.Name))
+		}
+		return nil
+	}
+
+	if desired == nil {
+		if existing == nil {
+			return nil
+		}
+		logger.Info("Deleting HorizontalPodAutoscaler")
+		if err := hpas.Delete(ctx, function.Spec.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	k8s.AddLabels(desired, c.costLabels(function))
+
+	if existing == nil {
+		logger.Info("Creating HorizontalPodAutoscaler")
+		if _, err := hpas.Create(ctx, desired, metav1.CreateOptions{FieldManager: controllerAgentName}); err != nil {
+			c.recorder.Event(function, corev1.EventTypeWarning, ReasonScalingFailed,
+				fmt.Sprintf("HorizontalPodAutoscaler can not be created: %s", err))
+			return err
+		}
+		return nil
+	}
+
+	if equality.Semantic.DeepDerivative(desired.Spec, existing.Spec) &&
+		equality.Semantic.DeepEqual(desired.Labels, existing.Labels) {
+		return nil
+	}
+
+	existing = existing.DeepCopy()
+	existing.Spec = desired.Spec
+	existing.Labels = desired.Labels
+	logger.V(2).Info("Updating HorizontalPodAutoscaler")
+	if _, err := hpas.Update(ctx, existing, metav1.UpdateOptions{FieldManager: controllerAgentName}); err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonScalingFailed,
+			fmt.Sprintf("HorizontalPodAutoscaler can not be updated: %s", err))
+		return err
+	}
+	return nil
+}
+
+// diffHPA returns the changes to the HorizontalPodAutoscaler of the Function for
+// the dry-run mode
+func (c *Controller) diffHPA(ctx context.Context, function *faasv1.Function) (string, error) {
+	desired, err := newHPA(function)
+	if err != nil {
+		return "", err
+	}
+
+	actual, err := c.kubeclientset.AutoscalingV2().HorizontalPodAutoscalers(function.Namespace).
+		Get(ctx, function.Spec.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		actual = nil
+	} else if err != nil {
+		return "", err
+	}
+
+	switch {
+	case desired == nil && actual != nil && metav1.IsControlledBy(actual, function):
+		return "hpa will be deleted", nil
+	case desired == nil:
+		return "", nil
+	case actual == nil:
+		return "hpa will be created", nil
+	}
+
+	if equality.Semantic.DeepDerivative(desired.Spec, actual.Spec) {
+		return "", nil
+	}
+	return cmp.Diff(actual.Spec, desired.Spec), nil
+}
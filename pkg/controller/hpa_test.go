@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func newHPAFunction(annotations map[string]string, labels map[string]string) *faasv1.Function {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "figlet-uid"},
+		Spec:       faasv1.FunctionSpec{Name: "figlet", Annotations: &annotations},
+	}
+	if labels != nil {
+		function.Spec.Labels = &labels
+	}
+	return function
+}
+
+func Test_newHPA_NoQuery(t *testing.T) {
+	hpa, err := newHPA(newHPAFunction(map[string]string{"topic": "orders"}, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if hpa != nil {
+		t.Errorf("want no HPA without a query, got %v", hpa.Spec)
+	}
+}
+
+func Test_newHPA_Prometheus(t *testing.T) {
+	function := newHPAFunction(map[string]string{
+		"com.openfaas.scale.prometheus.query":  `gateway_function_invocation_started{function_name="figlet.openfaas-fn", code="200"}`,
+		"com.openfaas.scale.prometheus.target": "50",
+	}, map[string]string{
+		"com.openfaas.scale.min": "2",
+		"com.openfaas.scale.max": "10",
+	})
+
+	hpa, err := newHPA(function)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if owner := metav1.GetControllerOf(hpa); owner == nil || owner.Kind != faasKind || owner.Name != "figlet" {
+		t.Errorf("want the HPA to be controlled by the Function, got %v", owner)
+	}
+	if target := hpa.Spec.ScaleTargetRef; target.Kind != "StatefulSet" || target.Name != "figlet" {
+		t.Errorf("want the StatefulSet as the scale target, got %v", target)
+	}
+	if *hpa.Spec.MinReplicas != 2 || hpa.Spec.MaxReplicas != 10 {
+		t.Errorf("want 2 to 10 replicas, got %d to %d", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+
+	if len(hpa.Spec.Metrics) != 1 || hpa.Spec.Metrics[0].External == nil {
+		t.Fatalf("want one external metric, got %v", hpa.Spec.Metrics)
+	}
+	external := hpa.Spec.Metrics[0].External
+	if external.Metric.Name != "gateway_function_invocation_started" {
+		t.Errorf("want the metric name from the query, got %q", external.Metric.Name)
+	}
+	want := map[string]string{"function_name": "figlet.openfaas-fn", "code": "200"}
+	if got := external.Metric.Selector.MatchLabels; len(got) != len(want) || got["function_name"] != want["function_name"] || got["code"] != want["code"] {
+		t.Errorf("want the labels %v, got %v", want, got)
+	}
+	if external.Target.Type != autoscalingv2.AverageValueMetricType || external.Target.AverageValue.String() != "50" {
+		t.Errorf("want an average value of 50, got %v", external.Target)
+	}
+}
+
+func Test_newHPA_Invalid(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		labels      map[string]string
+		want        string
+	}{
+		{
+			name:        "expression",
+			annotations: map[string]string{"com.openfaas.scale.prometheus.query": "sum(rate(http_requests_total[1m]))", "com.openfaas.scale.prometheus.target": "10"},
+			want:        "must be a series selector",
+		},
+		{
+			name:        "regex matcher",
+			annotations: map[string]string{"com.openfaas.scale.prometheus.query": `http_requests_total{code=~"5.."}`, "com.openfaas.scale.prometheus.target": "10"},
+			want:        `only label="value" matchers are supported`,
+		},
+		{
+			name:        "missing target",
+			annotations: map[string]string{"com.openfaas.scale.prometheus.query": "http_requests_total"},
+			want:        "com.openfaas.scale.prometheus.target is required",
+		},
+		{
+			name:        "zero target",
+			annotations: map[string]string{"com.openfaas.scale.prometheus.query": "http_requests_total", "com.openfaas.scale.prometheus.target": "0"},
+			want:        "must be a quantity greater than zero",
+		},
+		{
+			name: "target type",
+			annotations: map[string]string{"com.openfaas.scale.prometheus.query": "http_requests_total", "com.openfaas.scale.prometheus.target": "10",
+				"com.openfaas.scale.prometheus.target-type": "Utilization"},
+			want: "use AverageValue or Value",
+		},
+		{
+			name: "keda",
+			annotations: map[string]string{"com.openfaas.scale.prometheus.query": "http_requests_total", "com.openfaas.scale.prometheus.target": "10",
+				"com.openfaas.scale.keda.type": "kafka"},
+			want: "can not be used with com.openfaas.scale.keda.type",
+		},
+		{
+			name:        "scale to zero",
+			annotations: map[string]string{"com.openfaas.scale.prometheus.query": "http_requests_total", "com.openfaas.scale.prometheus.target": "10"},
+			labels:      map[string]string{"com.openfaas.scale.min": "0"},
+			want:        "must be at least 1 for an HPA",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := newHPA(newHPAFunction(c.annotations, c.labels))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("want error containing %q, got %v", c.want, err)
+			}
+		})
+	}
+}
+
+func Test_syncHPA_CreatesAndRemovesHPA(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	c := &Controller{kubeclientset: kubeClient, recorder: record.NewFakeRecorder(10)}
+	hpas := kubeClient.AutoscalingV2().HorizontalPodAutoscalers("openfaas-fn")
+
+	function := newHPAFunction(map[string]string{
+		"com.openfaas.scale.prometheus.query":       "queue_depth",
+		"com.openfaas.scale.prometheus.target":      "100",
+		"com.openfaas.scale.prometheus.target-type": "Value",
+	}, nil)
+	if err := c.syncHPA(context.Background(), function, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	hpa, err := hpas.Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want the HPA to be created: %s", err)
+	}
+	if target := hpa.Spec.Metrics[0].External.Target; target.Type != autoscalingv2.ValueMetricType || target.Value.String() != "100" {
+		t.Errorf("want a value of 100, got %v", target)
+	}
+
+	if err := c.syncHPA(context.Background(), newHPAFunction(map[string]string{}, nil), true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := hpas.Get(context.Background(), "figlet", metav1.GetOptions{}); err == nil {
+		t.Errorf("want the HPA to be deleted when the Function no longer sets a query")
+	}
+}
+
+func Test_syncHPA_KeepsUnmanagedHPA(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+	})
+	c := &Controller{kubeclientset: kubeClient, recorder: record.NewFakeRecorder(10)}
+
+	if err := c.syncHPA(context.Background(), newHPAFunction(map[string]string{}, nil), true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := kubeClient.AutoscalingV2().HorizontalPodAutoscalers("openfaas-fn").
+		Get(context.Background(), "figlet", metav1.GetOptions{}); err != nil {
+		t.Errorf("want the HPA which is not controlled by the Function to be kept: %s", err)
+	}
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ReasonImagePullFailed is used for the Event when the image of a Function can
+	// not be pulled for one of its Pods, the message has the error of the registry
+	ReasonImagePullFailed = "ImagePullFailed"
+)
+
+// recordImagePullEvent copies an Event of the kubelet about an image that could
+// not be pulled for the Pod of a Function to the Function itself, so that a tag
+// which does not exist is seen with kubectl describe on the Function. Events from
+// before the last minute are left out, as they are listed again on a restart.
+func (c *Controller) recordImagePullEvent(event *corev1.Event) {
+	if c.dryRun || !k8s.IsImagePullEvent(event) || time.Since(event.LastTimestamp.Time) > time.Minute {
+		return
+	}
+
+	// the Pods of a StatefulSet are named after it with their ordinal
+	podName := event.InvolvedObject.Name
+	i := strings.LastIndex(podName, "-")
+	if i < 0 {
+		return
+	}
+
+	function, err := c.functionsLister.Functions(event.InvolvedObject.Namespace).Get(podName[:i])
+	if err != nil || function.Spec.Name != podName[:i] {
+		return
+	}
+
+	c.recorder.Eventf(function, corev1.EventTypeWarning, ReasonImagePullFailed, "Pod %s: %s", podName, event.Message)
+}
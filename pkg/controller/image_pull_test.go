@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	listers "github.com/openfaas/faas-netes/pkg/client/listers/openfaas/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_recordImagePullEvent(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(&faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec:       faasv1.FunctionSpec{Name: "figlet"},
+	})
+
+	newEvent := func(pod, reason, message string, age time.Duration) *corev1.Event {
+		return &corev1.Event{
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod, Namespace: "openfaas-fn"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         reason,
+			Message:        message,
+			LastTimestamp:  metav1.NewTime(time.Now().Add(-age)),
+		}
+	}
+
+	cases := []struct {
+		name  string
+		event *corev1.Event
+		want  string
+	}{
+		{
+			name:  "records a failed pull on the function",
+			event: newEvent("figlet-1", "Failed", `Failed to pull image "functions/figlet:0.99": not found`, 0),
+			want:  `Warning ImagePullFailed Pod figlet-1: Failed to pull image "functions/figlet:0.99": not found`,
+		},
+		{
+			name:  "skips the back-off",
+			event: newEvent("figlet-1", "BackOff", `Back-off pulling image "functions/figlet:0.99"`, 0),
+		},
+		{
+			name:  "skips an old event",
+			event: newEvent("figlet-1", "Failed", `Failed to pull image "functions/figlet:0.99": not found`, time.Hour),
+		},
+		{
+			name:  "skips the pods of other workloads",
+			event: newEvent("nats-0", "Failed", `Failed to pull image "nats:latest": not found`, 0),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			controller := &Controller{functionsLister: listers.NewFunctionLister(indexer), recorder: recorder}
+
+			controller.recordImagePullEvent(c.event)
+
+			select {
+			case event := <-recorder.Events:
+				if event != c.want {
+					t.Fatalf("want event %q, got %q", c.want, event)
+				}
+			default:
+				if c.want != "" {
+					t.Fatalf("want event %q, got none", c.want)
+				}
+			}
+		})
+	}
+}
@@ -4,26 +4,29 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
 	appsv1 "k8s.io/api/apps/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	v1apps "k8s.io/client-go/informers/apps/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/klog"
 )
 
-func RegisterEventHandlers(statefulsetInformer v1apps.StatefulSetInformer, kubeClient *kubernetes.Clientset, namespace string) {
+// RegisterEventHandlers validates the replicas of each function against the maximum
+// from limits, a function at zero replicas is scaled to one unless allowZero is set or
+// it is allowed by the function's com.openfaas.scale.allow-zero annotation. When the informer has already synced, an Add event is delivered for
+// every StatefulSet in the cache, so the existing functions are validated one by one
+// without listing them again.
+func RegisterEventHandlers(statefulsetInformer v1apps.StatefulSetInformer, kubeClient kubernetes.Interface, limits *k8s.ReplicaLimits, allowZero bool) {
 	statefulsetInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			statefulset, ok := obj.(*appsv1.StatefulSet)
 			if !ok || statefulset == nil {
 				return
 			}
-			if err := applyValidation(statefulset, kubeClient); err != nil {
-				klog.Info(err)
+			if err := applyValidation(statefulset, kubeClient, limits, allowZero); err != nil {
+				logging.Default().Error(err, "Validating replicas failed",
+					"function", statefulset.Name, "namespace", statefulset.Namespace)
 			}
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
@@ -31,26 +34,15 @@ func RegisterEventHandlers(statefulsetInformer v1apps.StatefulSetInformer, kubeC
 			if !ok || statefulset == nil {
 				return
 			}
-			if err := applyValidation(statefulset, kubeClient); err != nil {
-				klog.Info(err)
+			if err := applyValidation(statefulset, kubeClient, limits, allowZero); err != nil {
+				logging.Default().Error(err, "Validating replicas failed",
+					"function", statefulset.Name, "namespace", statefulset.Namespace)
 			}
 		},
 	})
-
-	list, err := statefulsetInformer.Lister().StatefulSets(namespace).List(labels.Everything())
-	if err != nil {
-		klog.Info(err)
-		return
-	}
-
-	for _, statefulset := range list {
-		if err := applyValidation(statefulset, kubeClient); err != nil {
-			klog.Info(err)
-		}
-	}
 }
 
-func applyValidation(statefulset *appsv1.StatefulSet, kubeClient *kubernetes.Clientset) error {
+func applyValidation(statefulset *appsv1.StatefulSet, kubeClient kubernetes.Interface, limits *k8s.ReplicaLimits, allowZero bool) error {
 	if statefulset.Spec.Replicas == nil {
 		return nil
 	}
@@ -60,24 +52,19 @@ func applyValidation(statefulset *appsv1.StatefulSet, kubeClient *kubernetes.Cli
 	}
 
 	current := *statefulset.Spec.Replicas
-	var target int
+	var value int32
 	if current == 0 {
-		target = 1
-	} else if current > handlers.MaxReplicas {
-		target = handlers.MaxReplicas
+		if k8s.AllowsZeroReplicas(statefulset.Annotations, allowZero) {
+			return nil
+		}
+		value = 1
+	} else if max := limits.FunctionMax(context.Background(), statefulset.Namespace, statefulset.Spec.Template.Labels); current > max {
+		value = max
 	} else {
 		return nil
 	}
-	clone := statefulset.DeepCopy()
-
-	value := int32(target)
-	clone.Spec.Replicas = &value
 
-	if _, err := kubeClient.AppsV1().StatefulSets(statefulset.Namespace).
-		Update(context.Background(), clone, metav1.UpdateOptions{}); err != nil {
-		if errors.IsConflict(err) {
-			return nil
-		}
+	if err := k8s.ApplyStatefulSetReplicas(context.Background(), kubeClient, statefulset.Namespace, statefulset.Name, value, k8s.ValidationFieldManager); err != nil {
 		return fmt.Errorf("error scaling %s to %d replicas: %w", statefulset.Name, value, err)
 	}
 
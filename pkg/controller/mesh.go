@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"context"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// syncMeshPolicy applies the DestinationRule or ServiceProfile for the StatefulSet of
+// the Function when the mesh mode is enabled. A StatefulSet that was just created may
+// not be in the cache yet, its event requeues the Function.
+func (c *Controller) syncMeshPolicy(ctx context.Context, function *faasv1.Function) error {
+	mode := c.factory.Factory.Config.MeshMode
+	if c.dynamicclientset == nil || mode == "" {
+		return nil
+	}
+
+	statefulset, err := c.statefulSetLister.StatefulSets(function.Namespace).Get(function.Spec.Name)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	functionLogger(function).V(2).Info("Applying mesh policy", "mesh", mode)
+	return k8s.ApplyMeshPolicy(ctx, c.dynamicclientset, mode, statefulset, c.costLabels(function))
+}
@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/events"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/openfaas/faas-netes/pkg/metrics"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+// PriorityAdmission favours the functions with a high com.openfaas.priority label
+// while the cluster is saturated, that is while at least threshold Pods of functions
+// can not be scheduled. Functions with a lower priority than the highest of those
+// Pods are scaled down one replica at a time, to their com.openfaas.scale.min, and
+// they can not be deployed or scaled up until the Pods have been scheduled.
+type PriorityAdmission struct {
+	client       kubernetes.Interface
+	pods         corelisters.PodLister
+	statefulsets appslisters.StatefulSetLister
+	namespace    string
+	threshold    int
+	interval     time.Duration
+	metrics      *metrics.Admission
+	// emitter is nil when no events sink is configured
+	emitter *events.Emitter
+
+	lock      sync.RWMutex
+	saturated bool
+	// pendingPriority is the highest priority of the Pods that can not be
+	// scheduled, while the cluster is saturated
+	pendingPriority int32
+}
+
+// NewPriorityAdmission creates a PriorityAdmission for the functions in namespace,
+// the Pods are checked every interval
+func NewPriorityAdmission(client kubernetes.Interface, pods corelisters.PodLister, statefulsets appslisters.StatefulSetLister, namespace string, threshold int, interval time.Duration, m *metrics.Admission, emitter *events.Emitter) *PriorityAdmission {
+	return &PriorityAdmission{
+		client:       client,
+		pods:         pods,
+		statefulsets: statefulsets,
+		namespace:    namespace,
+		threshold:    threshold,
+		interval:     interval,
+		metrics:      m,
+		emitter:      emitter,
+	}
+}
+
+// Run checks for saturation and preempts the functions with a low priority until
+// ctx is cancelled
+func (a *PriorityAdmission) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		a.check(ctx)
+	}
+}
+
+// check counts the Pods that can not be scheduled and removes a replica from the
+// function with the lowest priority while the cluster is saturated
+func (a *PriorityAdmission) check(ctx context.Context) {
+	logger := logging.Default().WithName("admission")
+
+	pods, err := a.pods.Pods(a.namespace).List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Unable to list the Pods of functions")
+		return
+	}
+
+	pending := 0
+	var pendingPriority int32
+	for _, pod := range pods {
+		if _, ok := pod.Labels["faas_function"]; !ok || !k8s.IsPodUnschedulable(pod) {
+			continue
+		}
+		priority, _ := k8s.FunctionPriority(pod.Labels)
+		if pending == 0 || priority > pendingPriority {
+			pendingPriority = priority
+		}
+		pending++
+	}
+	saturated := pending >= a.threshold
+
+	a.metrics.PendingPods.Set(float64(pending))
+	if saturated {
+		a.metrics.Saturated.Set(1)
+	} else {
+		a.metrics.Saturated.Set(0)
+	}
+
+	a.lock.Lock()
+	changed := saturated != a.saturated
+	a.saturated = saturated
+	a.pendingPriority = pendingPriority
+	a.lock.Unlock()
+
+	if changed && saturated {
+		logger.Info("Cluster is saturated, admitting functions by priority", "pendingPods", pending, "priority", pendingPriority)
+	} else if changed {
+		logger.Info("Cluster is no longer saturated", "pendingPods", pending)
+	}
+
+	if saturated {
+		a.preempt(ctx, pendingPriority)
+	}
+}
+
+// preempt removes one replica from the function with the lowest priority below
+// priority that is above its minimum replicas
+func (a *PriorityAdmission) preempt(ctx context.Context, priority int32) {
+	logger := logging.Default().WithName("admission")
+
+	requirement, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		return
+	}
+	statefulsets, err := a.statefulsets.StatefulSets(a.namespace).List(labels.NewSelector().Add(*requirement))
+	if err != nil {
+		logger.Error(err, "Unable to list functions")
+		return
+	}
+
+	type candidate struct {
+		statefulset *appsv1.StatefulSet
+		priority    int32
+		replicas    int32
+	}
+	var candidates []candidate
+	for _, statefulset := range statefulsets {
+		if statefulset.Spec.Replicas == nil {
+			continue
+		}
+		p, _ := k8s.FunctionPriority(statefulset.Spec.Template.Labels)
+		if p >= priority || *statefulset.Spec.Replicas <= minReplicas(statefulset) {
+			continue
+		}
+		candidates = append(candidates, candidate{statefulset: statefulset, priority: p, replicas: *statefulset.Spec.Replicas})
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	// the lowest priority first, then the function with the most replicas
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		if candidates[i].replicas != candidates[j].replicas {
+			return candidates[i].replicas > candidates[j].replicas
+		}
+		return candidates[i].statefulset.Name < candidates[j].statefulset.Name
+	})
+	c := candidates[0]
+	name := c.statefulset.Name
+
+	replicas := c.replicas - 1
+	if err := k8s.ApplyStatefulSetReplicas(ctx, a.client, a.namespace, name, replicas, k8s.PriorityFieldManager); err != nil {
+		logger.Error(err, "Unable to scale down function", "function", name)
+		return
+	}
+
+	logger.Info("Scaled down function for a higher priority", "function", name, "priority", c.priority,
+		"pendingPriority", priority, "replicas", replicas)
+	a.metrics.Preemptions.WithLabelValues(name, a.namespace).Inc()
+	if a.emitter != nil {
+		count := uint64(replicas)
+		a.emitter.Emit(events.NewEvent(events.FunctionPreempted, events.FunctionData{
+			Name:      name,
+			Namespace: a.namespace,
+			Replicas:  &count,
+			Reason:    fmt.Sprintf("scaled down for functions with a priority of %d", priority),
+		}))
+	}
+}
+
+// AdmitDeploy returns an error when a function with the labels can not be deployed
+// because the cluster is saturated
+func (a *PriorityAdmission) AdmitDeploy(namespace, name string, labels map[string]string) error {
+	priority, err := k8s.FunctionPriority(labels)
+	if err != nil {
+		// the deploy handler rejects the invalid label
+		return nil
+	}
+	return a.admit(namespace, name, priority, "deploy")
+}
+
+// AdmitScale returns an error when the function can not be scaled up to replicas
+// because the cluster is saturated, scaling down is always admitted
+func (a *PriorityAdmission) AdmitScale(namespace, name string, replicas int32) error {
+	statefulset, err := a.statefulsets.StatefulSets(namespace).Get(name)
+	if err != nil || statefulset.Spec.Replicas == nil || replicas <= *statefulset.Spec.Replicas {
+		return nil
+	}
+
+	priority, _ := k8s.FunctionPriority(statefulset.Spec.Template.Labels)
+	return a.admit(namespace, name, priority, "scale")
+}
+
+func (a *PriorityAdmission) admit(namespace, name string, priority int32, operation string) error {
+	a.lock.RLock()
+	saturated, pendingPriority := a.saturated, a.pendingPriority
+	a.lock.RUnlock()
+
+	if !saturated || priority >= pendingPriority {
+		return nil
+	}
+
+	a.metrics.Denied.WithLabelValues(name, namespace, operation).Inc()
+	err := fmt.Errorf("the cluster is saturated, functions with a priority below %d are not admitted", pendingPriority)
+	if a.emitter != nil {
+		a.emitter.Emit(events.NewEvent(events.FunctionAdmissionDenied, events.FunctionData{
+			Name:      name,
+			Namespace: namespace,
+			Error:     err.Error(),
+		}))
+	}
+	return err
+}
+
+// minReplicas returns the com.openfaas.scale.min label of the function, a function
+// is never preempted below one replica
+func minReplicas(statefulset *appsv1.StatefulSet) int32 {
+	if value, ok := statefulset.Spec.Template.Labels[LabelMinReplicas]; ok {
+		if min, err := strconv.Atoi(value); err == nil && min > 1 {
+			return int32(min)
+		}
+	}
+	return 1
+}
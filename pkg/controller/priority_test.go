@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newPriorityStatefulSet(name string, replicas int32, labels map[string]string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn", Labels: map[string]string{"faas_function": name}},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+		},
+	}
+}
+
+func newUnschedulablePod(name, priority string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn", Labels: map[string]string{"faas_function": "checkout", "com.openfaas.priority": priority}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{{
+				Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable,
+			}},
+		},
+	}
+}
+
+func newPriorityAdmission(client *fake.Clientset, pods []*corev1.Pod, statefulsets []*appsv1.StatefulSet) (*PriorityAdmission, *metrics.Admission) {
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pod := range pods {
+		podIndexer.Add(pod)
+	}
+	statefulsetIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, statefulset := range statefulsets {
+		statefulsetIndexer.Add(statefulset)
+	}
+
+	m := metrics.NewAdmission(prometheus.NewRegistry())
+	return NewPriorityAdmission(client, corelisters.NewPodLister(podIndexer), appslisters.NewStatefulSetLister(statefulsetIndexer),
+		"openfaas-fn", 2, time.Second, m, nil), m
+}
+
+func Test_PriorityAdmission_PreemptsTheLowestPriority(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	applied := map[string]int32{}
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		obj := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(patch.GetPatch(), obj); err != nil {
+			t.Fatalf("unable to decode the patch: %s", err)
+		}
+		applied[patch.GetName()] = *obj.Spec.Replicas
+		return true, obj, nil
+	})
+
+	admission, m := newPriorityAdmission(client,
+		[]*corev1.Pod{newUnschedulablePod("checkout-3", "100"), newUnschedulablePod("checkout-4", "100")},
+		[]*appsv1.StatefulSet{
+			newPriorityStatefulSet("checkout", 3, map[string]string{"com.openfaas.priority": "100"}),
+			newPriorityStatefulSet("reports", 4, map[string]string{"com.openfaas.priority": "10"}),
+			newPriorityStatefulSet("thumbnails", 3, nil),
+			newPriorityStatefulSet("batch", 2, map[string]string{"com.openfaas.scale.min": "2"}),
+		})
+
+	admission.check(context.Background())
+
+	if len(applied) != 1 || applied["thumbnails"] != 2 {
+		t.Errorf("want thumbnails to be scaled down to 2 replicas, got %v", applied)
+	}
+	if got := testutil.ToFloat64(m.Saturated); got != 1 {
+		t.Errorf("want the saturated gauge to be 1, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.Preemptions.WithLabelValues("thumbnails", "openfaas-fn")); got != 1 {
+		t.Errorf("want one preemption of thumbnails, got %v", got)
+	}
+}
+
+func Test_PriorityAdmission_Admit(t *testing.T) {
+	admission, m := newPriorityAdmission(fake.NewSimpleClientset(),
+		[]*corev1.Pod{newUnschedulablePod("checkout-3", "100"), newUnschedulablePod("checkout-4", "100")},
+		[]*appsv1.StatefulSet{newPriorityStatefulSet("thumbnails", 1, map[string]string{"com.openfaas.priority": "100"})})
+
+	if err := admission.AdmitDeploy("openfaas-fn", "reports", nil); err != nil {
+		t.Fatalf("want the deploy to be admitted before the cluster is saturated, got %s", err)
+	}
+
+	admission.check(context.Background())
+
+	if err := admission.AdmitDeploy("openfaas-fn", "reports", map[string]string{"com.openfaas.priority": "10"}); err == nil {
+		t.Errorf("want the deploy of a lower priority to be denied")
+	}
+	if err := admission.AdmitDeploy("openfaas-fn", "payments", map[string]string{"com.openfaas.priority": "100"}); err != nil {
+		t.Errorf("want the deploy of the same priority to be admitted, got %s", err)
+	}
+	if got := testutil.ToFloat64(m.Denied.WithLabelValues("reports", "openfaas-fn", "deploy")); got != 1 {
+		t.Errorf("want one denied deploy of reports, got %v", got)
+	}
+}
+
+func Test_PriorityAdmission_AdmitScale(t *testing.T) {
+	admission, _ := newPriorityAdmission(fake.NewSimpleClientset(),
+		[]*corev1.Pod{newUnschedulablePod("checkout-3", "100"), newUnschedulablePod("checkout-4", "100")},
+		[]*appsv1.StatefulSet{newPriorityStatefulSet("reports", 1, nil)})
+	admission.check(context.Background())
+
+	if err := admission.AdmitScale("openfaas-fn", "reports", 3); err == nil {
+		t.Errorf("want the scale-up of a lower priority to be denied")
+	}
+	if err := admission.AdmitScale("openfaas-fn", "reports", 1); err != nil {
+		t.Errorf("want a scale to the same replicas to be admitted, got %s", err)
+	}
+}
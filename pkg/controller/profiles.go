@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	v1 "github.com/openfaas/faas-netes/pkg/client/informers/externalversions/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// maxProfileUpdateAttempts is the number of times a StatefulSet update is retried
+// when it conflicts with another change to the same StatefulSet
+const maxProfileUpdateAttempts = 3
+
+// RegisterProfileEventHandlers watches Profiles and re-applies a changed Profile to
+// every function in namespace that references it, so that a change to a Profile
+// rolls out without waiting for the next update of each function.
+func RegisterProfileEventHandlers(profileInformer v1.ProfileInformer, statefulsetLister appslisters.StatefulSetLister, factory k8s.FunctionFactory, namespace string) {
+	profileInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldProfile, ok := oldObj.(*faasv1.Profile)
+			if !ok || oldProfile == nil {
+				return
+			}
+			newProfile, ok := newObj.(*faasv1.Profile)
+			if !ok || newProfile == nil {
+				return
+			}
+
+			// periodic resyncs deliver updates without any change to the spec
+			if reflect.DeepEqual(oldProfile.Spec, newProfile.Spec) {
+				return
+			}
+
+			if err := reapplyProfile(oldProfile, statefulsetLister, factory, namespace); err != nil {
+				logging.Default().Error(err, "Re-applying profile failed", "profile", oldProfile.Name)
+			}
+		},
+	})
+}
+
+// reapplyProfile removes the previous version of the Profile from each function that
+// references it, then applies all of the function's Profiles again in annotation order
+// so that the precedence between Profiles is kept.
+func reapplyProfile(previous *faasv1.Profile, statefulsetLister appslisters.StatefulSetLister, factory k8s.FunctionFactory, namespace string) error {
+	list, err := statefulsetLister.StatefulSets(namespace).List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("error listing functions for profile %s: %w", previous.Name, err)
+	}
+
+	for _, statefulset := range list {
+		if _, ok := statefulset.Spec.Template.Labels["faas_function"]; !ok {
+			continue
+		}
+		if !hasProfile(statefulset.Annotations, previous.Name) {
+			continue
+		}
+
+		logger := logging.Default().WithValues("profile", previous.Name, "function", statefulset.Name, "namespace", statefulset.Namespace)
+		logger.Info("Re-applying profile")
+		if err := reapplyProfileTo(statefulset.Namespace, statefulset.Name, k8s.Profile(previous.Spec), factory); err != nil {
+			logger.Error(err, "Re-applying profile failed")
+		}
+	}
+
+	return nil
+}
+
+func reapplyProfileTo(namespace, name string, previous k8s.Profile, factory k8s.FunctionFactory) error {
+	ctx := context.Background()
+	client := factory.Client.AppsV1().StatefulSets(namespace)
+
+	var err error
+	for attempt := 0; attempt < maxProfileUpdateAttempts; attempt++ {
+		var statefulset *appsv1.StatefulSet
+		statefulset, err = client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("error getting function %s: %w", name, err)
+		}
+
+		var profiles []k8s.Profile
+		profiles, err = factory.GetProfiles(ctx, factory.Config.ProfilesNamespace, statefulset.Annotations)
+		if err != nil {
+			return fmt.Errorf("error getting profiles for function %s: %w", name, err)
+		}
+
+		updated := statefulset.DeepCopy()
+		factory.RemoveProfile(previous, updated)
+		for _, profile := range profiles {
+			if err := factory.ApplyProfile(profile, updated); err != nil {
+				return fmt.Errorf("function %s can not use the changed profile: %w", name, err)
+			}
+		}
+		if err := factory.ConfigurePodSecurity(updated); err != nil {
+			return fmt.Errorf("function %s can not use the changed profile: %w", name, err)
+		}
+
+		if reflect.DeepEqual(statefulset.Spec.Template.Spec, updated.Spec.Template.Spec) {
+			return nil
+		}
+
+		_, err = client.Update(ctx, updated, metav1.UpdateOptions{FieldManager: k8s.FieldManager})
+		if !errors.IsConflict(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("error updating function %s with profiles: %w", name, err)
+	}
+
+	return nil
+}
+
+func hasProfile(annotations map[string]string, name string) bool {
+	for _, profile := range k8s.ParseProfileNames(annotations) {
+		if profile == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	faasfake "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/fake"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_reapplyProfile(t *testing.T) {
+	oldToleration := corev1.Toleration{Key: "gpu", Operator: corev1.TolerationOpExists}
+	newToleration := corev1.Toleration{Key: "gpu-v2", Operator: corev1.TolerationOpExists}
+
+	previous := &faasv1.Profile{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu", Namespace: "openfaas"},
+		Spec:       faasv1.ProfileSpec{Tolerations: []corev1.Toleration{oldToleration}},
+	}
+	current := previous.DeepCopy()
+	current.Spec.Tolerations = []corev1.Toleration{newToleration}
+
+	withProfile := newProfileTestStatefulSet("figlet", "gpu", oldToleration)
+	withoutProfile := newProfileTestStatefulSet("env", "", oldToleration)
+
+	kubeClient := fake.NewSimpleClientset(withProfile, withoutProfile)
+	faasClient := faasfake.NewSimpleClientset(current)
+	factory := k8s.NewFunctionFactory(kubeClient, k8s.DeploymentConfig{ProfilesNamespace: "openfaas"}, faasClient.OpenfaasV1())
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(withProfile)
+	indexer.Add(withoutProfile)
+
+	if err := reapplyProfile(previous, appslisters.NewStatefulSetLister(indexer), factory, "openfaas-fn"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, _ := kubeClient.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	want := []corev1.Toleration{newToleration}
+	if !reflect.DeepEqual(want, got.Spec.Template.Spec.Tolerations) {
+		t.Fatalf("expected tolerations %+v, got %+v", want, got.Spec.Template.Spec.Tolerations)
+	}
+
+	unchanged, _ := kubeClient.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "env", metav1.GetOptions{})
+	want = []corev1.Toleration{oldToleration}
+	if !reflect.DeepEqual(want, unchanged.Spec.Template.Spec.Tolerations) {
+		t.Fatalf("expected function without the profile to keep %+v, got %+v", want, unchanged.Spec.Template.Spec.Tolerations)
+	}
+}
+
+func newProfileTestStatefulSet(name, profile string, toleration corev1.Toleration) *appsv1.StatefulSet {
+	annotations := map[string]string{}
+	if profile != "" {
+		annotations[k8s.ProfileAnnotationKey] = profile
+	}
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "openfaas-fn",
+			Annotations: annotations,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"faas_function": name},
+				},
+				Spec: corev1.PodSpec{
+					Tolerations: []corev1.Toleration{toleration},
+					Containers: []corev1.Container{
+						{Name: name, Image: "ghcr.io/openfaas/" + name + ":latest"},
+					},
+				},
+			},
+		},
+	}
+}
@@ -69,7 +69,7 @@ func Test_Replicas(t *testing.T) {
 
 	for _, s := range scenarios {
 		t.Run(s.name, func(t *testing.T) {
-			deploy := newStatefulSet(s.function, s.deploy, nil, factory)
+			deploy, _, _ := newStatefulSet(s.function, s.deploy, nil, factory)
 			value := deploy.Spec.Replicas
 
 			if s.expected != nil && value != nil {
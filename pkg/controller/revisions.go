@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+// RevisionCollector keeps the ControllerRevisions of functions within the revision
+// history limit of their StatefulSets, for clusters where specs churn faster than the
+// StatefulSet controller prunes them, and deletes the revisions that were left behind
+// by StatefulSets that were deleted without their dependents
+type RevisionCollector struct {
+	client       kubernetes.Interface
+	statefulsets appslisters.StatefulSetLister
+	namespace    string
+	interval     time.Duration
+}
+
+// NewRevisionCollector creates a RevisionCollector for the functions in namespace,
+// the revisions are collected every interval
+func NewRevisionCollector(client kubernetes.Interface, statefulsets appslisters.StatefulSetLister, namespace string, interval time.Duration) *RevisionCollector {
+	return &RevisionCollector{
+		client:       client,
+		statefulsets: statefulsets,
+		namespace:    namespace,
+		interval:     interval,
+	}
+}
+
+// Run collects the revisions until ctx is cancelled
+func (c *RevisionCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.collect(ctx)
+	}
+}
+
+// collect prunes the revisions of each function and then the orphaned revisions
+func (c *RevisionCollector) collect(ctx context.Context) {
+	logger := logging.Default().WithName("revisions")
+
+	requirement, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		return
+	}
+	statefulsets, err := c.statefulsets.StatefulSets(c.namespace).List(labels.NewSelector().Add(*requirement))
+	if err != nil {
+		logger.Error(err, "Unable to list functions")
+		return
+	}
+
+	total := 0
+	for _, statefulset := range statefulsets {
+		deleted, err := k8s.PruneRevisions(ctx, c.client, statefulset, k8s.RevisionHistoryLimit(statefulset))
+		total += len(deleted)
+		if err != nil {
+			logger.Error(err, "Unable to prune the revisions of function", "function", statefulset.Name)
+		}
+	}
+
+	orphans, err := k8s.PruneOrphanRevisions(ctx, c.client, c.namespace, func(name, uid string) bool {
+		statefulset, err := c.statefulsets.StatefulSets(c.namespace).Get(name)
+		if err != nil {
+			// only a missing StatefulSet makes a revision an orphan
+			return !k8s.IsNotFound(err)
+		}
+		return uid == "" || string(statefulset.UID) == uid
+	})
+	if err != nil {
+		logger.Error(err, "Unable to prune orphaned revisions")
+	}
+
+	if total > 0 || len(orphans) > 0 {
+		logger.Info("Pruned function revisions", "deleted", total, "orphans", len(orphans))
+	}
+}
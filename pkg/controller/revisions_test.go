@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_RevisionCollector_Collect(t *testing.T) {
+	controller := true
+	created := metav1.NewTime(time.Now().Add(-time.Hour))
+	newRevision := func(name, function string, revision int64) *appsv1.ControllerRevision {
+		return &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "openfaas-fn", CreationTimestamp: created,
+				Labels: map[string]string{"faas_function": function},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "apps/v1", Kind: "StatefulSet", Name: function, UID: types.UID("uid-" + function), Controller: &controller,
+				}},
+			},
+			Revision: revision,
+		}
+	}
+
+	limit := int32(1)
+	figlet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "uid-figlet", Labels: map[string]string{"faas_function": "figlet"}},
+		Spec: appsv1.StatefulSetSpec{
+			RevisionHistoryLimit: &limit,
+			Selector:             &metav1.LabelSelector{MatchLabels: map[string]string{"faas_function": "figlet"}},
+		},
+		Status: appsv1.StatefulSetStatus{CurrentRevision: "figlet-3", UpdateRevision: "figlet-3"},
+	}
+
+	client := fake.NewSimpleClientset(figlet,
+		newRevision("figlet-1", "figlet", 1),
+		newRevision("figlet-2", "figlet", 2),
+		newRevision("figlet-3", "figlet", 3),
+		newRevision("env-1", "env", 1),
+	)
+	statefulsets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	statefulsets.Add(figlet)
+
+	collector := NewRevisionCollector(client, appslisters.NewStatefulSetLister(statefulsets), "openfaas-fn", time.Hour)
+	collector.collect(context.Background())
+
+	list, err := client.AppsV1().ControllerRevisions("openfaas-fn").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	remaining := map[string]bool{}
+	for _, r := range list.Items {
+		remaining[r.Name] = true
+	}
+
+	if len(remaining) != 2 || !remaining["figlet-2"] || !remaining["figlet-3"] {
+		t.Errorf("want figlet-2 and figlet-3 to be kept, got %v", remaining)
+	}
+}
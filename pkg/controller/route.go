@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ReasonRouteFailed is used for the Event when the Ingress or HTTPRoute of a
+	// Function can not be built or applied
+	ReasonRouteFailed = "RouteFailed"
+)
+
+var (
+	ingressResource   = k8s.IngressResource
+	httpRouteResource = k8s.HTTPRouteResource
+
+	// routeResources are checked for routes to remove, when a Function no longer
+	// sets a host or changes the kind of its route
+	routeResources = k8s.RouteResources
+)
+
+// newRoute creates the Ingress or HTTPRoute for the Service of a Function from its
+// com.openfaas.route.* annotations, nil is returned when the Function does not set a
+// host. The route targets the servicePort and is controlled by the Function.
+func newRoute(function *faasv1.Function, servicePort int32) (*unstructured.Unstructured, schema.GroupVersionResource, error) {
+	route, resource, err := k8s.MakeRoute(function.Spec.Name, function.Namespace, servicePort, annotationsOf(function))
+	if err != nil || route == nil {
+		return nil, resource, err
+	}
+
+	owner := metav1.NewControllerRef(function, schema.GroupVersionKind{
+		Group:   faasv1.SchemeGroupVersion.Group,
+		Version: faasv1.SchemeGroupVersion.Version,
+		Kind:    faasKind,
+	})
+	route.SetOwnerReferences([]metav1.OwnerReference{*owner})
+
+	return route, resource, nil
+}
+
+// syncRoute applies the Ingress or HTTPRoute of the Function, and removes the routes
+// of the other kind, or both when the Function has changed and no longer sets a
+// host. Only routes that are controlled by the Function are removed.
+func (c *Controller) syncRoute(ctx context.Context, function *faasv1.Function, changed bool) error {
+	if c.dynamicclientset == nil {
+		return nil
+	}
+
+	logger := functionLogger(function)
+
+	desired, desiredResource, err := newRoute(function, c.factory.Factory.Config.HTTPPort())
+	if err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonRouteFailed, err.Error())
+		logger.Error(err, "Invalid route annotations")
+		return nil
+	}
+
+	if changed {
+		for _, resource := range routeResources {
+			if desired != nil && resource == desiredResource {
+				continue
+			}
+			if err := c.deleteRoute(ctx, function, resource); err != nil {
+				return err
+			}
+		}
+	}
+
+	if desired == nil {
+		return nil
+	}
+
+	k8s.AddLabels(desired, c.costLabels(function))
+
+	logger.V(2).Info("Applying route", "kind", desired.GetKind())
+	if _, err := c.dynamicclientset.Resource(desiredResource).Namespace(function.Namespace).
+		Apply(ctx, function.Spec.Name, desired, metav1.ApplyOptions{FieldManager: controllerAgentName, Force: true}); err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonRouteFailed,
+			fmt.Sprintf("%s can not be applied: %s", desired.GetKind(), err))
+		return err
+	}
+
+	return nil
+}
+
+func (c *Controller) deleteRoute(ctx context.Context, function *faasv1.Function, resource schema.GroupVersionResource) error {
+	routes := c.dynamicclientset.Resource(resource).Namespace(function.Namespace)
+
+	existing, err := routes.Get(ctx, function.Spec.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !metav1.IsControlledBy(existing, function) {
+		return nil
+	}
+
+	functionLogger(function).Info("Deleting route", "kind", existing.GetKind())
+	if err := routes.Delete(ctx, function.Spec.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// diffRoute returns the changes to the Ingress or HTTPRoute of the Function for the
+// dry-run mode
+func (c *Controller) diffRoute(ctx context.Context, function *faasv1.Function) (string, error) {
+	if c.dynamicclientset == nil {
+		return "", nil
+	}
+
+	desired, desiredResource, err := newRoute(function, c.factory.Factory.Config.HTTPPort())
+	if err != nil {
+		return "", err
+	}
+
+	var changes []string
+	for _, resource := range routeResources {
+		actual, err := c.dynamicclientset.Resource(resource).Namespace(function.Namespace).
+			Get(ctx, function.Spec.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			actual = nil
+		} else if err != nil {
+			return "", err
+		}
+
+		switch {
+		case desired != nil && resource == desiredResource:
+			if actual == nil {
+				changes = append(changes, fmt.Sprintf("%s will be created", resource.Resource))
+			} else if !equality.Semantic.DeepDerivative(desired.Object["spec"], actual.Object["spec"]) {
+				changes = append(changes, cmp.Diff(actual.Object["spec"], desired.Object["spec"]))
+			}
+		case actual != nil && metav1.IsControlledBy(actual, function):
+			changes = append(changes, fmt.Sprintf("%s will be deleted", resource.Resource))
+		}
+	}
+
+	return strings.Join(changes, "\n"), nil
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func newRouteFunction(annotations map[string]string) *faasv1.Function {
+	return &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "1234"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "figlet",
+			Annotations: &annotations,
+		},
+	}
+}
+
+func Test_newRoute_NoHost(t *testing.T) {
+	route, _, err := newRoute(newRouteFunction(map[string]string{"com.openfaas.route.path": "/api"}), k8s.DefaultFunctionPort)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if route != nil {
+		t.Errorf("want no route without a host, got %v", route.Object)
+	}
+}
+
+func Test_newRoute_IngressWithTLS(t *testing.T) {
+	route, resource, err := newRoute(newRouteFunction(map[string]string{
+		"com.openfaas.route.host":       "figlet.example.com",
+		"com.openfaas.route.class":      "nginx",
+		"com.openfaas.route.tls.issuer": "letsencrypt-prod",
+	}), k8s.DefaultFunctionPort)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resource != ingressResource || route.GetKind() != "Ingress" {
+		t.Fatalf("want an Ingress, got %s", route.GetKind())
+	}
+	if owner := metav1.GetControllerOf(route); owner == nil || owner.Name != "figlet" {
+		t.Errorf("want the Ingress to be controlled by the Function, got %v", owner)
+	}
+	if issuer := route.GetAnnotations()["cert-manager.io/cluster-issuer"]; issuer != "letsencrypt-prod" {
+		t.Errorf("want the cert-manager issuer annotation, got %q", issuer)
+	}
+	if class, _, _ := unstructured.NestedString(route.Object, "spec", "ingressClassName"); class != "nginx" {
+		t.Errorf("want the ingress class nginx, got %q", class)
+	}
+
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	paths, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "http", "paths")
+	path := paths[0].(map[string]interface{})
+	if path["path"] != "/" {
+		t.Errorf("want the default path /, got %v", path["path"])
+	}
+	if name, _, _ := unstructured.NestedString(path, "backend", "service", "name"); name != "figlet" {
+		t.Errorf("want the function's Service as the backend, got %q", name)
+	}
+
+	tls, _, _ := unstructured.NestedSlice(route.Object, "spec", "tls")
+	if len(tls) != 1 || tls[0].(map[string]interface{})["secretName"] != "figlet-tls" {
+		t.Errorf("want the TLS secret figlet-tls, got %v", tls)
+	}
+}
+
+func Test_newRoute_HTTPRoute(t *testing.T) {
+	route, resource, err := newRoute(newRouteFunction(map[string]string{
+		"com.openfaas.route.host":    "api.example.com",
+		"com.openfaas.route.path":    "/figlet",
+		"com.openfaas.route.kind":    "HTTPRoute",
+		"com.openfaas.route.gateway": "gateways/public",
+	}), k8s.DefaultFunctionPort)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resource != httpRouteResource {
+		t.Fatalf("want an HTTPRoute, got %s", route.GetKind())
+	}
+
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	if parent := parents[0].(map[string]interface{}); parent["namespace"] != "gateways" || parent["name"] != "public" {
+		t.Errorf("want the parent gateways/public, got %v", parent)
+	}
+
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	matches, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "matches")
+	if value, _, _ := unstructured.NestedString(matches[0].(map[string]interface{}), "path", "value"); value != "/figlet" {
+		t.Errorf("want the path prefix /figlet, got %q", value)
+	}
+}
+
+func Test_newRoute_Invalid(t *testing.T) {
+	cases := map[string]map[string]string{
+		"relative path":        {"com.openfaas.route.host": "a.example.com", "com.openfaas.route.path": "api"},
+		"unknown kind":         {"com.openfaas.route.host": "a.example.com", "com.openfaas.route.kind": "Route"},
+		"HTTPRoute no gateway": {"com.openfaas.route.host": "a.example.com", "com.openfaas.route.kind": "HTTPRoute"},
+	}
+
+	for name, annotations := range cases {
+		if _, _, err := newRoute(newRouteFunction(annotations), k8s.DefaultFunctionPort); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func Test_syncRoute_ReplacesIngressWithHTTPRoute(t *testing.T) {
+	ingressFunction := newRouteFunction(map[string]string{"com.openfaas.route.host": "figlet.example.com"})
+	ingress, _, _ := newRoute(ingressFunction, k8s.DefaultFunctionPort)
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ingressResource:   "IngressList",
+		httpRouteResource: "HTTPRouteList",
+	}, ingress)
+
+	c := &Controller{dynamicclientset: dynamicClient, recorder: record.NewFakeRecorder(10)}
+
+	function := newRouteFunction(map[string]string{
+		"com.openfaas.route.host":    "figlet.example.com",
+		"com.openfaas.route.kind":    "HTTPRoute",
+		"com.openfaas.route.gateway": "public",
+	})
+	// the fake client does not support server-side apply, only the removal is checked
+	c.syncRoute(context.Background(), function, true)
+
+	_, err := dynamicClient.Resource(ingressResource).Namespace("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("want the Ingress to be deleted when the Function uses an HTTPRoute")
+	}
+}
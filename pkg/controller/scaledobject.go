@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-cmp/cmp"
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// LabelMaxReplicas is also used by the OpenFaaS autoscaler
+	LabelMaxReplicas = "com.openfaas.scale.max"
+
+	// ReasonScalingFailed is used for the Event when the ScaledObject of a Function
+	// can not be built or applied
+	ReasonScalingFailed = "ScalingFailed"
+)
+
+// scaledObjectResource is the KEDA ScaledObject, it is managed with the dynamic
+// client so that KEDA is only required when a Function uses it
+var scaledObjectResource = k8s.ScaledObjectResource
+
+// newScaledObject creates the KEDA ScaledObject for the StatefulSet of a Function
+// from its com.openfaas.scale.keda.* annotations, nil is returned when the Function
+// does not set a trigger type. It is controlled by the Function.
+func newScaledObject(function *faasv1.Function) (*unstructured.Unstructured, error) {
+	scaledObject, err := k8s.MakeScaledObject(function.Spec.Name, function.Namespace, annotationsOf(function), labelsOf(function))
+	if err != nil || scaledObject == nil {
+		return nil, err
+	}
+
+	owner := metav1.NewControllerRef(function, schema.GroupVersionKind{
+		Group:   faasv1.SchemeGroupVersion.Group,
+		Version: faasv1.SchemeGroupVersion.Version,
+		Kind:    faasKind,
+	})
+	scaledObject.SetOwnerReferences([]metav1.OwnerReference{*owner})
+
+	return scaledObject, nil
+}
+
+func annotationsOf(function *faasv1.Function) map[string]string {
+	if function.Spec.Annotations == nil {
+		return nil
+	}
+	return *function.Spec.Annotations
+}
+
+func labelsOf(function *faasv1.Function) map[string]string {
+	if function.Spec.Labels == nil {
+		return nil
+	}
+	return *function.Spec.Labels
+}
+
+// syncScaledObject applies the ScaledObject of the Function, or removes it when the
+// Function has changed and no longer sets a trigger. Only ScaledObjects that are
+// controlled by the Function are removed, and nothing is done when KEDA is not
+// installed and the Function does not use it.
+func (c *Controller) syncScaledObject(ctx context.Context, function *faasv1.Function, changed bool) error {
+	if c.dynamicclientset == nil {
+		return nil
+	}
+
+	logger := functionLogger(function)
+	scaledObjects := c.dynamicclientset.Resource(scaledObjectResource).Namespace(function.Namespace)
+
+	desired, err := newScaledObject(function)
+	if err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonScalingFailed, err.Error())
+		logger.Error(err, "Invalid KEDA annotations")
+		return nil
+	}
+
+	if desired == nil {
+		if !changed {
+			return nil
+		}
+
+		existing, err := scaledObjects.Get(ctx, function.Spec.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !metav1.IsControlledBy(existing, function) {
+			return nil
+		}
+
+		logger.Info("Deleting KEDA ScaledObject")
+		if err := scaledObjects.Delete(ctx, function.Spec.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	k8s.AddLabels(desired, c.costLabels(function))
+
+	logger.V(2).Info("Applying KEDA ScaledObject")
+	if _, err := scaledObjects.Apply(ctx, function.Spec.Name, desired, metav1.ApplyOptions{FieldManager: controllerAgentName, Force: true}); err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, ReasonScalingFailed,
+			fmt.Sprintf("KEDA ScaledObject can not be applied: %s", err))
+		return err
+	}
+
+	return nil
+}
+
+// diffScaledObject returns the changes to the ScaledObject of the Function for the
+// dry-run mode
+func (c *Controller) diffScaledObject(ctx context.Context, function *faasv1.Function) (string, error) {
+	if c.dynamicclientset == nil {
+		return "", nil
+	}
+
+	desired, err := newScaledObject(function)
+	if err != nil {
+		return "", err
+	}
+
+	actual, err := c.dynamicclientset.Resource(scaledObjectResource).Namespace(function.Namespace).
+		Get(ctx, function.Spec.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		actual = nil
+	} else if err != nil {
+		return "", err
+	}
+
+	switch {
+	case desired == nil && actual != nil && metav1.IsControlledBy(actual, function):
+		return "scaledobject will be deleted", nil
+	case desired == nil:
+		return "", nil
+	case actual == nil:
+		return "scaledobject will be created", nil
+	}
+
+	if equality.Semantic.DeepDerivative(desired.Object["spec"], actual.Object["spec"]) {
+		return "", nil
+	}
+	return cmp.Diff(actual.Object["spec"], desired.Object["spec"]), nil
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_newScaledObject_NoTrigger(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "kafka-consumer", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "kafka-consumer",
+			Annotations: &map[string]string{"topic": "orders"},
+		},
+	}
+
+	scaledObject, err := newScaledObject(function)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if scaledObject != nil {
+		t.Errorf("want no ScaledObject without a trigger type, got %v", scaledObject.Object)
+	}
+}
+
+func Test_newScaledObject_Kafka(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "kafka-consumer", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name: "kafka-consumer",
+			Annotations: &map[string]string{
+				"com.openfaas.scale.keda.type":                   "kafka",
+				"com.openfaas.scale.keda.metadata.topic":         "orders",
+				"com.openfaas.scale.keda.metadata.lagThreshold":  "10",
+				"com.openfaas.scale.keda.authenticationRef":      "kafka-auth",
+				"com.openfaas.scale.keda.pollingInterval":        "15",
+				"com.openfaas.scale.keda.metadata.consumerGroup": "orders-fn",
+			},
+			Labels: &map[string]string{
+				"com.openfaas.scale.min": "1",
+				"com.openfaas.scale.max": "20",
+			},
+		},
+	}
+
+	scaledObject, err := newScaledObject(function)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if owner := metav1.GetControllerOf(scaledObject); owner == nil || owner.Kind != faasKind || owner.Name != "kafka-consumer" {
+		t.Errorf("want the ScaledObject to be controlled by the Function, got %v", owner)
+	}
+
+	target, _, _ := unstructured.NestedStringMap(scaledObject.Object, "spec", "scaleTargetRef")
+	if target["kind"] != "StatefulSet" || target["name"] != "kafka-consumer" {
+		t.Errorf("want the StatefulSet as the scale target, got %v", target)
+	}
+
+	for field, want := range map[string]int64{"minReplicaCount": 1, "maxReplicaCount": 20, "pollingInterval": 15} {
+		got, _, _ := unstructured.NestedInt64(scaledObject.Object, "spec", field)
+		if got != want {
+			t.Errorf("want %s to be %d, got %d", field, want, got)
+		}
+	}
+	if _, found, _ := unstructured.NestedInt64(scaledObject.Object, "spec", "cooldownPeriod"); found {
+		t.Errorf("want cooldownPeriod to be left to KEDA's default")
+	}
+
+	triggers, _, _ := unstructured.NestedSlice(scaledObject.Object, "spec", "triggers")
+	if len(triggers) != 1 {
+		t.Fatalf("want 1 trigger, got %d", len(triggers))
+	}
+	trigger := triggers[0].(map[string]interface{})
+	if trigger["type"] != "kafka" {
+		t.Errorf("want a kafka trigger, got %v", trigger["type"])
+	}
+
+	metadata, _, _ := unstructured.NestedStringMap(trigger, "metadata")
+	want := map[string]string{"topic": "orders", "lagThreshold": "10", "consumerGroup": "orders-fn"}
+	if len(metadata) != len(want) {
+		t.Errorf("want metadata %v, got %v", want, metadata)
+	}
+	for k, v := range want {
+		if metadata[k] != v {
+			t.Errorf("want metadata %s to be %q, got %q", k, v, metadata[k])
+		}
+	}
+
+	if ref, _, _ := unstructured.NestedString(trigger, "authenticationRef", "name"); ref != "kafka-auth" {
+		t.Errorf("want the authenticationRef kafka-auth, got %q", ref)
+	}
+}
+
+func Test_newScaledObject_InvalidReplicas(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "kafka-consumer", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "kafka-consumer",
+			Annotations: &map[string]string{"com.openfaas.scale.keda.type": "kafka"},
+			Labels:      &map[string]string{"com.openfaas.scale.max": "lots"},
+		},
+	}
+
+	if _, err := newScaledObject(function); err == nil {
+		t.Errorf("want an error for an invalid max replicas label")
+	}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/openfaas/faas-netes/pkg/schedule"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// ScheduledScaler scales functions at the windows of their com.openfaas.scale.schedule
+// annotation, so that predictable daily traffic does not depend only on reactive
+// autoscaling. The replicas are set once when a window fires, the autoscaler may
+// change them until the next window.
+type ScheduledScaler struct {
+	client       kubernetes.Interface
+	statefulsets v1.StatefulSetLister
+	limits       *k8s.ReplicaLimits
+	allowZero    bool
+	location     *time.Location
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewScheduledScaler creates a ScheduledScaler, the cron expressions are evaluated in
+// location and the replicas are kept within limits
+func NewScheduledScaler(client kubernetes.Interface, statefulsets v1.StatefulSetLister, limits *k8s.ReplicaLimits, allowZero bool, location *time.Location) *ScheduledScaler {
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &ScheduledScaler{
+		client:       client,
+		statefulsets: statefulsets,
+		limits:       limits,
+		allowZero:    allowZero,
+		location:     location,
+		now:          time.Now,
+	}
+}
+
+// Run checks the windows at the start of every minute until ctx is cancelled, the
+// windows that were missed while a check was delayed are caught up on
+func (s *ScheduledScaler) Run(ctx context.Context) {
+	last := s.now().In(s.location)
+	for {
+		next := last.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := s.now().In(s.location)
+		s.scale(ctx, last, now)
+		last = now
+	}
+}
+
+// scale applies the replicas of the windows that fired after since and at or before now
+func (s *ScheduledScaler) scale(ctx context.Context, since, now time.Time) {
+	requirement, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		return
+	}
+
+	statefulsets, err := s.statefulsets.List(labels.NewSelector().Add(*requirement))
+	if err != nil {
+		logging.Default().Error(err, "Unable to list functions for the scaling schedules")
+		return
+	}
+
+	for _, statefulset := range statefulsets {
+		value, ok := statefulset.Annotations[schedule.Annotation]
+		if !ok {
+			continue
+		}
+
+		logger := logging.Default().WithValues("function", statefulset.Name, "namespace", statefulset.Namespace)
+
+		windows, err := schedule.Parse(value)
+		if err != nil {
+			logger.Error(err, "Invalid scaling schedule")
+			continue
+		}
+
+		replicas, due := schedule.Due(windows, since, now)
+		if !due {
+			continue
+		}
+
+		if max := s.limits.FunctionMax(ctx, statefulset.Namespace, statefulset.Spec.Template.Labels); replicas > max {
+			replicas = max
+		}
+		if replicas == 0 && !k8s.AllowsZeroReplicas(statefulset.Annotations, s.allowZero) {
+			replicas = 1
+		}
+
+		if statefulset.Spec.Replicas != nil && *statefulset.Spec.Replicas == replicas {
+			continue
+		}
+
+		logger.Info("Scaling on schedule", "replicas", replicas)
+		if replicas == 0 && statefulset.Spec.Replicas != nil && *statefulset.Spec.Replicas > 0 {
+			if err := k8s.SavePreviousReplicas(ctx, s.client, statefulset.Namespace, statefulset.Name, *statefulset.Spec.Replicas); err != nil {
+				logger.Error(err, "Unable to record the previous replicas")
+			}
+		}
+		if err := k8s.ApplyStatefulSetReplicas(ctx, s.client, statefulset.Namespace, statefulset.Name, replicas, k8s.ScheduleFieldManager); err != nil {
+			logger.Error(err, "Unable to scale on schedule")
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_ScheduledScaler_AppliesTheWindowThatFired(t *testing.T) {
+	replicas := int32(2)
+	statefulsets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	statefulsets.Add(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "figlet",
+			Namespace:   "openfaas-fn",
+			Labels:      map[string]string{"faas_function": "figlet"},
+			Annotations: map[string]string{"com.openfaas.scale.schedule": "0 8 * * *=30; 0 20 * * *=0"},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"com.openfaas.scale.max": "20"}},
+			},
+		},
+	})
+	statefulsets.Add(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nodeinfo",
+			Namespace: "openfaas-fn",
+			Labels:    map[string]string{"faas_function": "nodeinfo"},
+		},
+	})
+
+	client := fake.NewSimpleClientset()
+	applied := map[string]int32{}
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		obj := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(patch.GetPatch(), obj); err != nil {
+			t.Fatalf("unable to decode the patch: %s", err)
+		}
+		applied[patch.GetName()] = *obj.Spec.Replicas
+		return true, obj, nil
+	})
+
+	scaler := NewScheduledScaler(client, v1.NewStatefulSetLister(statefulsets), k8s.NewReplicaLimits(100, nil), false, time.UTC)
+
+	morning := time.Date(2023, 6, 5, 8, 0, 0, 0, time.UTC)
+	scaler.scale(context.Background(), morning.Add(-time.Minute), morning)
+	if applied["figlet"] != 20 || len(applied) != 1 {
+		t.Errorf("want figlet to be scaled to the maximum of its label, got %v", applied)
+	}
+
+	evening := time.Date(2023, 6, 5, 20, 0, 0, 0, time.UTC)
+	scaler.scale(context.Background(), evening.Add(-time.Minute), evening)
+	if applied["figlet"] != 1 {
+		t.Errorf("want figlet to be kept at one replica, got %d", applied["figlet"])
+	}
+}
+
+func Test_ScheduledScaler_RecordsThePreviousReplicas(t *testing.T) {
+	replicas := int32(3)
+	statefulsets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	statefulsets.Add(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "figlet",
+			Namespace:   "openfaas-fn",
+			Labels:      map[string]string{"faas_function": "figlet"},
+			Annotations: map[string]string{"com.openfaas.scale.schedule": "0 20 * * *=0"},
+		},
+		Spec: appsv1.StatefulSetSpec{Replicas: &replicas},
+	})
+
+	client := fake.NewSimpleClientset()
+	var patches []appsv1.StatefulSet
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), obj); err != nil {
+			t.Fatalf("unable to decode the patch: %s", err)
+		}
+		patches = append(patches, *obj)
+		return true, obj, nil
+	})
+
+	scaler := NewScheduledScaler(client, v1.NewStatefulSetLister(statefulsets), k8s.NewReplicaLimits(100, nil), true, time.UTC)
+
+	evening := time.Date(2023, 6, 5, 20, 0, 0, 0, time.UTC)
+	scaler.scale(context.Background(), evening.Add(-time.Minute), evening)
+
+	if len(patches) != 2 {
+		t.Fatalf("want the previous replicas and the replicas to be applied, got %d patches", len(patches))
+	}
+	if got := patches[0].Annotations[k8s.AnnotationPreviousReplicas]; got != "3" {
+		t.Errorf("want the previous replicas to be 3, got %q", got)
+	}
+	if got := patches[1].Spec.Replicas; got == nil || *got != 0 {
+		t.Errorf("want figlet to be scaled to zero, got %v", got)
+	}
+}
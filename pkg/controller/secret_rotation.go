@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+// SecretRotator restarts the Pods of functions one ordinal at a time after one of
+// their secrets was rotated. The partition of the StatefulSet is lowered by one
+// each time the restarted Pods are ready, and set back to the partition of the
+// function once every Pod has been restarted.
+type SecretRotator struct {
+	client       kubernetes.Interface
+	statefulsets appslisters.StatefulSetLister
+	namespace    string
+	interval     time.Duration
+	// rollout holds the partition of the functions that do not set one
+	rollout k8s.RolloutConfig
+}
+
+// NewSecretRotator creates a SecretRotator for the functions in namespace, the
+// rotations are checked every interval
+func NewSecretRotator(client kubernetes.Interface, statefulsets appslisters.StatefulSetLister, namespace string, interval time.Duration, rollout k8s.RolloutConfig) *SecretRotator {
+	return &SecretRotator{
+		client:       client,
+		statefulsets: statefulsets,
+		namespace:    namespace,
+		interval:     interval,
+		rollout:      rollout,
+	}
+}
+
+// Run advances the rotations until ctx is cancelled
+func (r *SecretRotator) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.advance(ctx)
+	}
+}
+
+// advance restarts the next Pod of each function with a rotation in progress
+func (r *SecretRotator) advance(ctx context.Context) {
+	logger := logging.Default().WithName("secret-rotation")
+
+	requirement, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		return
+	}
+	statefulsets, err := r.statefulsets.StatefulSets(r.namespace).List(labels.NewSelector().Add(*requirement))
+	if err != nil {
+		logger.Error(err, "Unable to list functions")
+		return
+	}
+
+	for _, statefulset := range statefulsets {
+		rotation := k8s.ParseSecretRotation(statefulset.Annotations)
+		if rotation == nil || !r.restarted(statefulset, rotation) {
+			continue
+		}
+
+		rotatedAt := statefulset.Spec.Template.Annotations[k8s.AnnotationSecretsRotatedAt]
+		if rotation.Partition == 0 {
+			if _, err := k8s.ApplySecretRotation(ctx, r.client, r.namespace, statefulset.Name, rotatedAt, nil, r.partition(statefulset)); err != nil {
+				logger.Error(err, "Unable to complete the secret rotation", "function", statefulset.Name)
+				continue
+			}
+			logger.Info("Restarted function for rotated secret", "function", statefulset.Name, "secret", rotation.Secret,
+				"duration", time.Since(rotation.StartedAt).Round(time.Second).String())
+			continue
+		}
+
+		rotation.Partition--
+		if _, err := k8s.ApplySecretRotation(ctx, r.client, r.namespace, statefulset.Name, rotatedAt, rotation, nil); err != nil {
+			logger.Error(err, "Unable to restart the next Pod for the secret rotation", "function", statefulset.Name)
+			continue
+		}
+		logger.Info("Restarting function for rotated secret", "function", statefulset.Name, "secret", rotation.Secret,
+			"partition", rotation.Partition)
+	}
+}
+
+// restarted returns true once the Pods from the partition of the rotation up have
+// been restarted, and all of the replicas are ready
+func (r *SecretRotator) restarted(statefulset *appsv1.StatefulSet, rotation *k8s.SecretRotation) bool {
+	status := statefulset.Status
+	if status.ObservedGeneration < statefulset.Generation {
+		return false
+	}
+
+	replicas := int32(1)
+	if statefulset.Spec.Replicas != nil {
+		replicas = *statefulset.Spec.Replicas
+	}
+
+	restarted := replicas - rotation.Partition
+	if restarted < 0 {
+		restarted = 0
+	}
+	return status.UpdatedReplicas >= restarted && status.ReadyReplicas >= replicas
+}
+
+// partition returns the partition of the function from its rollout annotations or
+// the rollout settings of the provider, nil when neither sets one
+func (r *SecretRotator) partition(statefulset *appsv1.StatefulSet) *int32 {
+	rollout, err := k8s.RolloutAnnotations(statefulset.Annotations)
+	if err == nil && rollout.Partition != nil {
+		return rollout.Partition
+	}
+	return r.rollout.Partition
+}
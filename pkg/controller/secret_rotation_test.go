@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newRotatingStatefulSet(partition int32, status appsv1.StatefulSetStatus, annotations map[string]string) *appsv1.StatefulSet {
+	replicas := int32(3)
+	rotation, _ := json.Marshal(k8s.SecretRotation{Secret: "api-key", Partition: partition})
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[k8s.AnnotationSecretRotation] = string(rotation)
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "figlet", Namespace: "openfaas-fn", Generation: 2,
+			Labels:      map[string]string{"faas_function": "figlet"},
+			Annotations: annotations,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{k8s.AnnotationSecretsRotatedAt: "2026-10-15T10:00:00Z"},
+			}},
+		},
+		Status: status,
+	}
+}
+
+func advanceRotation(t *testing.T, statefulset *appsv1.StatefulSet) *appsv1.StatefulSet {
+	t.Helper()
+
+	client := fake.NewSimpleClientset()
+	var applied *appsv1.StatefulSet
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		applied = &appsv1.StatefulSet{}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), applied); err != nil {
+			return true, nil, err
+		}
+		return true, applied, nil
+	})
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(statefulset)
+
+	partition := int32(1)
+	rotator := NewSecretRotator(client, appslisters.NewStatefulSetLister(indexer), "openfaas-fn", time.Second, k8s.RolloutConfig{Partition: &partition})
+	rotator.advance(context.Background())
+	return applied
+}
+
+func Test_SecretRotator_RestartsTheNextPod(t *testing.T) {
+	applied := advanceRotation(t, newRotatingStatefulSet(2, appsv1.StatefulSetStatus{
+		ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, ReadyReplicas: 3,
+	}, nil))
+
+	if applied == nil {
+		t.Fatal("want the next Pod to be restarted")
+	}
+	if got := *applied.Spec.UpdateStrategy.RollingUpdate.Partition; got != 1 {
+		t.Errorf("want partition 1, got %d", got)
+	}
+	if rotation := k8s.ParseSecretRotation(applied.Annotations); rotation == nil || rotation.Partition != 1 {
+		t.Errorf("want the rotation to be at partition 1, got %+v", rotation)
+	}
+	if got := applied.Spec.Template.Annotations[k8s.AnnotationSecretsRotatedAt]; got != "2026-10-15T10:00:00Z" {
+		t.Errorf("want the rotated-at annotation to be kept, got %q", got)
+	}
+}
+
+func Test_SecretRotator_WaitsForReadyPods(t *testing.T) {
+	applied := advanceRotation(t, newRotatingStatefulSet(2, appsv1.StatefulSetStatus{
+		ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, ReadyReplicas: 2,
+	}, nil))
+
+	if applied != nil {
+		t.Errorf("want no change while a Pod is not ready")
+	}
+}
+
+func Test_SecretRotator_CompletesWithThePartitionOfTheFunction(t *testing.T) {
+	applied := advanceRotation(t, newRotatingStatefulSet(0, appsv1.StatefulSetStatus{
+		ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3,
+	}, map[string]string{k8s.AnnotationPartition: "2"}))
+
+	if applied == nil {
+		t.Fatal("want the rotation to be completed")
+	}
+	if _, ok := applied.Annotations[k8s.AnnotationSecretRotation]; ok {
+		t.Errorf("want the rotation annotation to be removed")
+	}
+	if got := *applied.Spec.UpdateStrategy.RollingUpdate.Partition; got != 2 {
+		t.Errorf("want the partition of the function, got %d", got)
+	}
+}
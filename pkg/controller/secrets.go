@@ -1,26 +1,45 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 
 	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-)
-
-const (
-	secretsMountPath = "/var/openfaas/secrets"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // UpdateSecrets will update the statefulset spec to include secrets that have been deployed
 // in the kubernetes cluster.  For each requested secret, we inspect the type and add it to the
 // statefulset spec as appropriate: secrets with type `SecretTypeDockercfg` are added as ImagePullSecrets
-// all other secrets are mounted as files in the statefulsets containers.
+// all other secrets are mounted as files in the statefulsets containers. External secrets from Vault
+// are mounted with the Secrets Store CSI driver, at the mount path of the SecretMounts annotations.
 func UpdateSecrets(function *faasv1.Function, statefulset *appsv1.StatefulSet, existingSecrets map[string]*corev1.Secret) error {
+	external, err := k8s.ParseExternalSecrets(function.Spec.Secrets)
+	if err != nil {
+		return err
+	}
+
+	var annotations map[string]string
+	if function.Spec.Annotations != nil {
+		annotations = *function.Spec.Annotations
+	}
+	mounts, err := k8s.ParseSecretMounts(annotations)
+	if err != nil {
+		return err
+	}
+
 	// Add / reference pre-existing secrets within Kubernetes
 	secretVolumeProjections := []corev1.VolumeProjection{}
 
 	for _, secretName := range function.Spec.Secrets {
+		if k8s.IsExternalSecret(secretName) {
+			continue
+		}
+
 		deployedSecret, ok := existingSecrets[secretName]
 		if !ok {
 			return fmt.Errorf("required secret '%s' was not found in the cluster", secretName)
@@ -42,7 +61,7 @@ func UpdateSecrets(function *faasv1.Function, statefulset *appsv1.StatefulSet, e
 
 			projectedPaths := []corev1.KeyToPath{}
 			for secretKey := range deployedSecret.Data {
-				projectedPaths = append(projectedPaths, corev1.KeyToPath{Key: secretKey, Path: secretKey})
+				projectedPaths = append(projectedPaths, corev1.KeyToPath{Key: secretKey, Path: mounts.Path(secretName, secretKey)})
 			}
 
 			projection := &corev1.SecretProjection{Items: projectedPaths}
@@ -55,14 +74,7 @@ func UpdateSecrets(function *faasv1.Function, statefulset *appsv1.StatefulSet, e
 	}
 
 	volumeName := fmt.Sprintf("%s-projected-secrets", function.Spec.Name)
-	projectedSecrets := corev1.Volume{
-		Name: volumeName,
-		VolumeSource: corev1.VolumeSource{
-			Projected: &corev1.ProjectedVolumeSource{
-				Sources: secretVolumeProjections,
-			},
-		},
-	}
+	projectedSecrets := mounts.ProjectedVolume(volumeName, secretVolumeProjections)
 
 	// remove the existing secrets volume, if we can find it. The update volume will be
 	// added below
@@ -78,7 +90,7 @@ func UpdateSecrets(function *faasv1.Function, statefulset *appsv1.StatefulSet, e
 		mount := corev1.VolumeMount{
 			Name:      volumeName,
 			ReadOnly:  true,
-			MountPath: secretsMountPath,
+			MountPath: mounts.MountPath,
 		}
 		// remove the existing secrets volume mount, if we can find it. We update it later.
 		container.VolumeMounts = removeVolumeMount(volumeName, container.VolumeMounts)
@@ -91,6 +103,9 @@ func UpdateSecrets(function *faasv1.Function, statefulset *appsv1.StatefulSet, e
 
 	statefulset.Spec.Template.Spec.Containers = updatedContainers
 
+	k8s.ConfigureExternalSecrets(function.Spec.Name, statefulset, external, mounts.MountPath)
+	k8s.ConfigureSecretsChecksum(statefulset, k8s.SecretsChecksum(function.Spec.Secrets, existingSecrets))
+
 	return nil
 }
 
@@ -121,3 +136,31 @@ func removeVolumeMount(volumeName string, mounts []corev1.VolumeMount) []corev1.
 
 	return newMounts
 }
+
+// syncSecretProviderClass applies the SecretProviderClass for the external secrets of
+// the Function, it is only removed when the Function has changed
+func (c *Controller) syncSecretProviderClass(ctx context.Context, function *faasv1.Function, changed bool) error {
+	hasExternal := false
+	for _, secret := range function.Spec.Secrets {
+		if k8s.IsExternalSecret(secret) {
+			hasExternal = true
+		}
+	}
+	if !hasExternal && !changed {
+		return nil
+	}
+
+	owner := metav1.NewControllerRef(function, schema.GroupVersionKind{
+		Group:   faasv1.SchemeGroupVersion.Group,
+		Version: faasv1.SchemeGroupVersion.Version,
+		Kind:    faasKind,
+	})
+
+	err := k8s.SyncSecretProviderClass(ctx, c.dynamicclientset, function.Spec.Name, function.Namespace,
+		function.Spec.Secrets, c.factory.Factory.Config.SecretsStore, *owner, c.costLabels(function))
+	if err != nil {
+		c.recorder.Event(function, corev1.EventTypeWarning, faasv1.ReasonSecretsFailed,
+			fmt.Sprintf("SecretProviderClass can not be applied: %s", err))
+	}
+	return err
+}
@@ -285,7 +285,7 @@ func validateNewSecretVolumesAndMounts(t *testing.T, statefulset *appsv1.Statefu
 		t.Errorf("Incorrect volume mounts: expected \"testfunc-projected-secrets\", got \"%s\"", mount.Name)
 	}
 
-	if mount.MountPath != secretsMountPath {
-		t.Errorf("Incorrect volume mount path: expected \"%s\", got \"%s\"", secretsMountPath, mount.MountPath)
+	if mount.MountPath != "/var/openfaas/secrets" {
+		t.Errorf("Incorrect volume mount path: expected \"%s\", got \"%s\"", "/var/openfaas/secrets", mount.MountPath)
 	}
 }
@@ -7,17 +7,27 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
 )
 
 // newService creates a new ClusterIP Service for a Function resource. It also sets
 // the appropriate OwnerReferences on the resource so handleObject can discover
-// the Function resource that 'owns' it.
-func newService(function *faasv1.Function) *corev1.Service {
+// the Function resource that 'owns' it. The Service listens on servicePort, which
+// is also the port of the function's container unless it sets the AnnotationPort.
+func newService(function *faasv1.Function, servicePort int32) *corev1.Service {
+	annotations := map[string]string{}
+	if function.Spec.Annotations != nil {
+		annotations = *function.Spec.Annotations
+	}
+
+	// an invalid port is logged when the StatefulSet is created
+	port, _ := k8s.FunctionPort(annotations, servicePort)
+
 	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        function.Spec.Name,
 			Namespace:   function.Namespace,
-			Annotations: map[string]string{"prometheus.io.scrape": "false"},
+			Annotations: k8s.ScrapeAnnotations(annotations),
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(function, schema.GroupVersionKind{
 					Group:   faasv1.SchemeGroupVersion.Group,
@@ -33,13 +43,22 @@ func newService(function *faasv1.Function) *corev1.Service {
 				{
 					Name:     "http",
 					Protocol: corev1.ProtocolTCP,
-					Port:     functionPort,
+					Port:     servicePort,
 					TargetPort: intstr.IntOrString{
 						Type:   intstr.Int,
-						IntVal: int32(functionPort),
+						IntVal: port,
 					},
 				},
 			},
 		},
 	}
 }
+
+// costLabels returns the cost-allocation labels of the Function, they are added to
+// each of the resources that the controller creates for it
+func (c *Controller) costLabels(function *faasv1.Function) map[string]string {
+	if function.Spec.Labels == nil {
+		return nil
+	}
+	return c.factory.Factory.Config.CostAllocationLabels(*function.Spec.Labels)
+}
@@ -2,8 +2,12 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"strings"
+
 	"github.com/google/go-cmp/cmp"
 	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
 	"github.com/openfaas/faas-netes/pkg/k8s"
@@ -12,40 +16,59 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	glog "k8s.io/klog"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 )
 
 const (
+	// annotationFunctionSpecHash is the hash of the FunctionSpec that the
+	// StatefulSet was created from, used to detect changes in the spec
+	annotationFunctionSpecHash = "com.openfaas.function.spec-hash"
+
+	// annotationFunctionSpec held the full FunctionSpec as JSON in earlier
+	// versions, it is replaced by annotationFunctionSpecHash on the next sync
 	annotationFunctionSpec = "com.openfaas.function.spec"
+
+	// annotationPodTemplateHash is the hash of the Pod template that the StatefulSet
+	// was created with, without the labels and annotations of the Function, used to
+	// tell the changes that need the Pods to be replaced from those that do not
+	annotationPodTemplateHash = "com.openfaas.function.template-hash"
 )
 
 // newStatefulset creates a new Statefulset for a Function resource. It also sets
 // the appropriate OwnerReferences on the resource so handleObject can discover
-// the Function resource that 'owns' it.
+// the Function resource that 'owns' it. Any fields that are set by more than one
+// of the Function's Profiles are returned, so they can be reported in the status.
+// A reconcileError is returned when the Profiles can not be retrieved or a secret
+// is missing, rather than creating a StatefulSet without them.
 func newStatefulSet(
 	function *faasv1.Function,
 	existingStatefulSet *appsv1.StatefulSet,
 	existingSecrets map[string]*corev1.Secret,
-	factory FunctionFactory) *appsv1.StatefulSet {
+	factory FunctionFactory) (*appsv1.StatefulSet, []k8s.ProfileConflict, error) {
 
 	ctx := context.TODO()
-	envVars := makeEnvVars(function)
+	logger := functionLogger(function)
+	envVars := k8s.AddDefaultEnv(makeEnvVars(function, factory.Factory.Config.WatchdogEnv.ProcessName()), factory.Factory.DefaultEnv.Values())
 	labels := makeLabels(function)
-	nodeSelector := makeNodeSelector(function.Spec.Constraints)
 	probes, err := factory.MakeProbes(function)
 	if err != nil {
-		glog.Warningf("Function %s probes parsing failed: %v",
-			function.Spec.Name, err)
+		logger.Error(err, "Function probes parsing failed")
+		probes = &k8s.FunctionProbes{}
 	}
 
 	resources, err := makeResources(function)
 	if err != nil {
-		glog.Warningf("Function %s resources parsing failed: %v",
-			function.Spec.Name, err)
+		logger.Error(err, "Function resources parsing failed")
 	}
+	factory.ApplyDefaultResources(resources)
 
 	annotations := makeAnnotations(function)
 
+	port, err := k8s.FunctionPort(annotations, factory.Factory.Config.HTTPPort())
+	if err != nil {
+		logger.Error(err, "Function port parsing failed")
+	}
+
 	allowPrivilegeEscalation := false
 
 	statefulsetSpec := &appsv1.StatefulSet{
@@ -67,7 +90,7 @@ func newStatefulSet(
 				Type: appsv1.RollingUpdateStatefulSetStrategyType,
 				RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
 					MaxUnavailable: &intstr.IntOrString{
-						Type: intstr.Int,
+						Type:   intstr.Int,
 						IntVal: int32(0),
 					},
 				},
@@ -85,13 +108,12 @@ func newStatefulSet(
 					Annotations: annotations,
 				},
 				Spec: corev1.PodSpec{
-					NodeSelector: nodeSelector,
 					Containers: []corev1.Container{
 						{
 							Name:  function.Spec.Name,
 							Image: function.Spec.Image,
 							Ports: []corev1.ContainerPort{
-								{ContainerPort: int32(functionPort), Protocol: corev1.ProtocolTCP},
+								{ContainerPort: port, Protocol: corev1.ProtocolTCP},
 							},
 							ImagePullPolicy: corev1.PullAlways,
 							Env:             envVars,
@@ -110,6 +132,13 @@ func newStatefulSet(
 
 	factory.ConfigureReadOnlyRootFilesystem(function, statefulsetSpec)
 	factory.ConfigureContainerUserID(statefulsetSpec)
+	factory.ConfigureMesh(statefulsetSpec)
+	factory.ConfigureServiceToken(statefulsetSpec)
+	factory.ConfigureTimeout(statefulsetSpec)
+	if err := factory.ConfigureRollout(statefulsetSpec); err != nil {
+		logger.Error(err, "Function rollout annotations parsing failed")
+	}
+	configureCertificate(function, statefulsetSpec)
 
 	var currentAnnotations map[string]string
 	if existingStatefulSet != nil {
@@ -122,73 +151,244 @@ func newStatefulSet(
 	profileNamespace := factory.Factory.Config.ProfilesNamespace
 	profileList, err := factory.GetProfilesToRemove(ctx, profileNamespace, annotations, currentAnnotations)
 	if err != nil {
-		// TODO: a simple warning doesn't seem strong enough if a profile can't be found or there is
-		// some other error
-		glog.Warningf("Function %s can not retrieve required Profiles in %s: %v", function.Spec.Name, profileNamespace, err)
+		// a Profile that has been deleted can not be removed, but should not block the update
+		if !k8s.IsProfileNotFound(err) {
+			return nil, nil, &reconcileError{
+				reason: faasv1.ReasonProfilesFailed,
+				err:    fmt.Errorf("function %s can not retrieve previous Profiles in %s: %w", function.Spec.Name, profileNamespace, err),
+			}
+		}
+		logger.Error(err, "Function can not remove Profiles", "profileNamespace", profileNamespace)
 	}
 	for _, profile := range profileList {
 		factory.RemoveProfile(profile, statefulsetSpec)
 	}
 
 	if _, exists := annotations[k8s.ProfileAnnotationKey]; !exists {
-		glog.Infof("Function %s: no profiles specified", function.Spec.Name)
+		logger.V(2).Info("No profiles specified")
 	}
 
 	profileList, err = factory.GetProfiles(ctx, profileNamespace, annotations)
 	if err != nil {
-		// TODO: a simple warning doesn't seem strong enough if a profile can't be found or there is
-		// some other error
-		glog.Warningf("Function %s can not retrieve required Profiles in %s: %v", function.Spec.Name, profileNamespace, err)
+		reason := faasv1.ReasonProfilesFailed
+		if k8s.IsProfileNotFound(err) {
+			reason = faasv1.ReasonProfileNotFound
+		}
+		return nil, nil, &reconcileError{
+			reason: reason,
+			err:    fmt.Errorf("function %s can not retrieve required Profiles in %s: %w", function.Spec.Name, profileNamespace, err),
+		}
+	}
+	if len(profileList) > 0 {
+		logger.Info("Applying profiles", "profiles", k8s.ParseProfileNames(annotations))
 	}
-	// TODO: remove this or refactor to just print names
-	glog.Infof("Function %s: Applying profiles %+v", function.Spec.Name, profileList)
 	for _, profile := range profileList {
-		factory.ApplyProfile(profile, statefulsetSpec)
+		if err := factory.ApplyProfile(profile, statefulsetSpec); err != nil {
+			return nil, nil, &reconcileError{
+				reason: faasv1.ReasonProfilesFailed,
+				err:    fmt.Errorf("function %s can not use its Profiles: %w", function.Spec.Name, err),
+			}
+		}
+	}
+
+	conflicts := k8s.ProfileConflicts(annotations, profileList)
+
+	if err := k8s.ConfigureConstraints(statefulsetSpec, function.Spec.Constraints); err != nil {
+		return nil, nil, &reconcileError{
+			reason: faasv1.ReasonConstraintsFailed,
+			err:    fmt.Errorf("function %s has %w", function.Spec.Name, err),
+		}
+	}
+
+	// the architectures are only read from the annotation, the registry is not
+	// queried on each sync
+	k8s.ConfigureArchitectures(statefulsetSpec, k8s.ParseArchitectures(annotations[k8s.ArchitecturesAnnotation]))
+	for _, conflict := range conflicts {
+		logger.Info("Profile conflict", "conflict", conflict.String())
+	}
+
+	if err := factory.ConfigurePodSecurity(statefulsetSpec); err != nil {
+		return nil, nil, &reconcileError{
+			reason: faasv1.ReasonPodSecurityFailed,
+			err:    fmt.Errorf("function %s %w", function.Spec.Name, err),
+		}
 	}
 
 	if err := UpdateSecrets(function, statefulsetSpec, existingSecrets); err != nil {
-		// TODO: a simple warning doesn't seem strong enough if we can't update the secrets
-		glog.Warningf("Function %s secrets update failed: %v",
-			function.Spec.Name, err)
+		return nil, nil, &reconcileError{
+			reason: faasv1.ReasonSecretsFailed,
+			err:    fmt.Errorf("function %s secrets update failed: %w", function.Spec.Name, err),
+		}
+	}
+
+	var functionLabels, functionAnnotations map[string]string
+	if function.Spec.Labels != nil {
+		functionLabels = *function.Spec.Labels
+	}
+	if function.Spec.Annotations != nil {
+		functionAnnotations = *function.Spec.Annotations
+	}
+	k8s.RecordFunctionMetadata(statefulsetSpec, functionLabels, functionAnnotations)
+	factory.Factory.Config.WatchdogEnv.RecordProcessEnv(statefulsetSpec)
+
+	templateHash, err := podTemplateHash(function, statefulsetSpec.Spec.Template)
+	if err != nil {
+		logger.Error(err, "Failed to hash pod template")
+	} else {
+		recorded := make(map[string]string, len(statefulsetSpec.Annotations)+1)
+		for k, v := range statefulsetSpec.Annotations {
+			recorded[k] = v
+		}
+		recorded[annotationPodTemplateHash] = templateHash
+		statefulsetSpec.Annotations = recorded
+	}
+
+	return statefulsetSpec, conflicts, nil
+}
+
+// podAnnotationPrefixes are the annotations of a Function that are read from its
+// Pods, by Prometheus or by a mesh that injects its sidecar
+var podAnnotationPrefixes = []string{
+	"prometheus.io",
+	"linkerd.io/",
+	"config.linkerd.io/",
+	"sidecar.istio.io/",
+	"traffic.sidecar.istio.io/",
+	"proxy.istio.io/",
+}
+
+// podTemplateHash returns a hash of the Pod template without the spec hash and the
+// labels and annotations of the Function, so that it only changes when the Pods
+// have to be replaced. The com.openfaas labels are kept in the hash, as they are
+// read from the Pod template, such as for the priority or the scaling limits, and
+// so are the podAnnotationPrefixes.
+func podTemplateHash(function *faasv1.Function, template corev1.PodTemplateSpec) (string, error) {
+	t := template.DeepCopy()
+	delete(t.Annotations, annotationFunctionSpecHash)
+
+	if function.Spec.Annotations != nil {
+		for k := range *function.Spec.Annotations {
+			if !hasAnyPrefix(k, podAnnotationPrefixes) {
+				delete(t.Annotations, k)
+			}
+		}
+	}
+	if function.Spec.Labels != nil {
+		for k := range *function.Spec.Labels {
+			if !strings.HasPrefix(k, "com.openfaas.") {
+				delete(t.Labels, k)
+			}
+		}
+	}
+
+	return k8s.TemplateHash(t)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// podTemplateChanged returns true when the Pods of the existing StatefulSet have to
+// be replaced to apply the desired one. A StatefulSet without a recorded hash is
+// always replaced.
+func podTemplateChanged(existing, desired *appsv1.StatefulSet) bool {
+	prevHash := existing.Annotations[annotationPodTemplateHash]
+	return prevHash == "" || prevHash != desired.Annotations[annotationPodTemplateHash]
+}
+
+// statefulsetMetadataPatch returns a strategic merge patch that applies the labels,
+// annotations and replicas of the desired StatefulSet to the existing one. The Pod
+// template is left as it is, so the Pods are not restarted and keep the previous
+// labels and annotations of the Function until they are next replaced.
+func statefulsetMetadataPatch(existing, desired *appsv1.StatefulSet) ([]byte, error) {
+	original, err := json.Marshal(existing)
+	if err != nil {
+		return nil, err
 	}
 
-	return statefulsetSpec
+	modified := existing.DeepCopy()
+	modified.Labels = desired.Labels
+	modified.Annotations = desired.Annotations
+	modified.Spec.Replicas = desired.Spec.Replicas
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return nil, err
+	}
+
+	return strategicpatch.CreateTwoWayMergePatch(original, modifiedJSON, appsv1.StatefulSet{})
 }
 
-// statefulsetNeedsUpdate determines if the function spec is different from the statefulset spec
-func statefulsetNeedsUpdate(function *faasv1.Function, statefulset *appsv1.StatefulSet) bool {
-	prevFnSpecJson := statefulset.ObjectMeta.Annotations[annotationFunctionSpec]
-	if prevFnSpecJson == "" {
+// statefulsetNeedsUpdate determines if the function spec is different from the statefulset spec,
+// or if the data of its secrets has changed since they were mounted. The secrets are only
+// compared when existingSecrets is not nil.
+func statefulsetNeedsUpdate(function *faasv1.Function, statefulset *appsv1.StatefulSet, existingSecrets map[string]*corev1.Secret) bool {
+	annotations := statefulset.ObjectMeta.Annotations
+	logger := functionLogger(function)
+
+	if prevFnSpecJson, ok := annotations[annotationFunctionSpec]; ok {
+		// the statefulset is updated once to replace the full spec with its hash,
+		// the diff is still logged so that changes made together with an upgrade
+		// can be told apart from the migration
+		prevFnSpec := &faasv1.FunctionSpec{}
+		if err := json.Unmarshal([]byte(prevFnSpecJson), prevFnSpec); err != nil {
+			logger.Error(err, "Failed to parse previous function spec")
+		} else if diff := cmp.Diff(*prevFnSpec, function.Spec); diff != "" {
+			logger.V(2).Info("Change detected", "diff", diff)
+		}
+
+		logger.Info("Migrating the function spec annotation", "from", annotationFunctionSpec, "to", annotationFunctionSpecHash)
+		return true
+	}
+
+	prevHash := annotations[annotationFunctionSpecHash]
+	if prevHash == "" {
 		// is a new statefulset or is an old statefulset that is missing the annotation
 		return true
 	}
 
-	prevFnSpec := &faasv1.FunctionSpec{}
-	err := json.Unmarshal([]byte(prevFnSpecJson), prevFnSpec)
+	hash, err := functionSpecHash(function.Spec)
 	if err != nil {
-		glog.Errorf("Failed to parse previous function spec: %s", err.Error())
+		logger.Error(err, "Failed to hash function spec")
 		return true
 	}
-	prevFn := faasv1.Function{
-		Spec: *prevFnSpec,
+
+	if hash != prevHash {
+		logger.V(2).Info("Change detected", "previousHash", prevHash, "hash", hash)
+		return true
 	}
 
-	if diff := cmp.Diff(prevFn.Spec, function.Spec); diff != "" {
-		glog.V(2).Infof("Change detected for %s diff\n%s", function.Name, diff)
+	if existingSecrets != nil && k8s.SecretsChanged(statefulset, function.Spec.Secrets, existingSecrets) {
+		logger.V(2).Info("Change detected in the data of the secrets")
 		return true
-	} else {
-		glog.V(3).Infof("No changes detected for %s", function.Name)
 	}
 
+	logger.V(3).Info("No changes detected")
 	return false
 }
 
-func makeEnvVars(function *faasv1.Function) []corev1.EnvVar {
+// functionSpecHash returns a deterministic hash of the spec, the JSON encoding
+// sorts map keys so the same spec always produces the same hash
+func functionSpecHash(spec faasv1.FunctionSpec) (string, error) {
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(specJSON)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func makeEnvVars(function *faasv1.Function, processEnv string) []corev1.EnvVar {
 	envVars := []corev1.EnvVar{}
 
 	if len(function.Spec.Handler) > 0 {
 		envVars = append(envVars, corev1.EnvVar{
-			Name:  "fprocess",
+			Name:  processEnv,
 			Value: function.Spec.Handler,
 		})
 	}
@@ -223,9 +423,6 @@ func makeLabels(function *faasv1.Function) map[string]string {
 func makeAnnotations(function *faasv1.Function) map[string]string {
 	annotations := make(map[string]string)
 
-	// disable scraping since the watchdog doesn't expose a metrics endpoint
-	annotations["prometheus.io.scrape"] = "false"
-
 	// copy function annotations
 	if function.Spec.Annotations != nil {
 		for k, v := range *function.Spec.Annotations {
@@ -233,34 +430,22 @@ func makeAnnotations(function *faasv1.Function) map[string]string {
 		}
 	}
 
-	// save function spec in statefulset annotations
+	// disable scraping unless the function exposes its own metrics, the watchdog
+	// doesn't expose a metrics endpoint
+	k8s.DefaultScrapeAnnotation(annotations)
+
+	// save a hash of the function spec in statefulset annotations
 	// used to detect changes in function spec
-	specJSON, err := json.Marshal(function.Spec)
+	hash, err := functionSpecHash(function.Spec)
 	if err != nil {
-		glog.Errorf("Failed to marshal function spec: %s", err.Error())
+		functionLogger(function).Error(err, "Failed to hash function spec")
 		return annotations
 	}
 
-	annotations[annotationFunctionSpec] = string(specJSON)
+	annotations[annotationFunctionSpecHash] = hash
 	return annotations
 }
 
-func makeNodeSelector(constraints []string) map[string]string {
-	selector := make(map[string]string)
-
-	if len(constraints) > 0 {
-		for _, constraint := range constraints {
-			parts := strings.Split(constraint, "=")
-
-			if len(parts) == 2 {
-				selector[parts[0]] = parts[1]
-			}
-		}
-	}
-
-	return selector
-}
-
 func int32p(i int32) *int32 {
 	return &i
 }
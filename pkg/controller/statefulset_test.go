@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_statefulsetNeedsUpdate(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet"},
+		Spec: faasv1.FunctionSpec{
+			Name:  "figlet",
+			Image: "ghcr.io/openfaas/figlet:latest",
+		},
+	}
+	changed := function.DeepCopy()
+	changed.Spec.Image = "ghcr.io/openfaas/figlet:0.2.0"
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		function    *faasv1.Function
+		want        bool
+	}{
+		{
+			name:        "missing annotation",
+			annotations: map[string]string{},
+			function:    function,
+			want:        true,
+		},
+		{
+			name:        "unchanged spec",
+			annotations: makeAnnotations(function),
+			function:    function,
+			want:        false,
+		},
+		{
+			name:        "changed spec",
+			annotations: makeAnnotations(function),
+			function:    changed,
+			want:        true,
+		},
+		{
+			name: "legacy spec annotation is migrated",
+			annotations: map[string]string{
+				annotationFunctionSpec: `{"name":"figlet","image":"ghcr.io/openfaas/figlet:latest","readOnlyRootFilesystem":false}`,
+			},
+			function: function,
+			want:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			statefulset := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "figlet", Annotations: tc.annotations},
+			}
+
+			if got := statefulsetNeedsUpdate(tc.function, statefulset, nil); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_statefulsetNeedsUpdate_SecretsChanged(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet"},
+		Spec: faasv1.FunctionSpec{
+			Name:    "figlet",
+			Image:   "ghcr.io/openfaas/figlet:latest",
+			Secrets: []string{"db"},
+		},
+	}
+	secrets := map[string]*corev1.Secret{
+		"db": {Type: corev1.SecretTypeOpaque, Data: map[string][]byte{"password": []byte("pass")}},
+	}
+
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Annotations: makeAnnotations(function)},
+	}
+	statefulset.Spec.Template.Annotations = map[string]string{
+		k8s.AnnotationSecretsChecksum: k8s.SecretsChecksum(function.Spec.Secrets, secrets),
+	}
+
+	if statefulsetNeedsUpdate(function, statefulset, secrets) {
+		t.Errorf("want no update while the secrets are unchanged")
+	}
+
+	rotated := map[string]*corev1.Secret{
+		"db": {Type: corev1.SecretTypeOpaque, Data: map[string][]byte{"password": []byte("rotated")}},
+	}
+	if !statefulsetNeedsUpdate(function, statefulset, rotated) {
+		t.Errorf("want an update when the data of a secret has changed")
+	}
+	if statefulsetNeedsUpdate(function, statefulset, nil) {
+		t.Errorf("want the secrets to be skipped when they could not be read")
+	}
+}
+
+func Test_podTemplateChanged(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "figlet",
+			Image:       "ghcr.io/openfaas/figlet:latest",
+			Labels:      &map[string]string{"team": "a"},
+			Annotations: &map[string]string{"owner": "a"},
+		},
+	}
+	factory := NewFunctionFactory(fake.NewSimpleClientset(),
+		k8s.DeploymentConfig{
+			LivenessProbe:  &k8s.ProbeConfig{},
+			ReadinessProbe: &k8s.ProbeConfig{},
+		})
+
+	existing, _, err := newStatefulSet(function, nil, nil, factory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		name   string
+		change func(spec *faasv1.FunctionSpec)
+		want   bool
+	}{
+		{name: "label", change: func(spec *faasv1.FunctionSpec) { spec.Labels = &map[string]string{"team": "b"} }},
+		{name: "annotation", change: func(spec *faasv1.FunctionSpec) { spec.Annotations = &map[string]string{"owner": "b", "tier": "gold"} }},
+		{name: "removed metadata", change: func(spec *faasv1.FunctionSpec) { spec.Labels, spec.Annotations = nil, nil }},
+		{name: "image", change: func(spec *faasv1.FunctionSpec) { spec.Image = "ghcr.io/openfaas/figlet:0.2.0" }, want: true},
+		{name: "priority label", change: func(spec *faasv1.FunctionSpec) { spec.Labels = &map[string]string{"com.openfaas.priority": "high"} }, want: true},
+		{name: "probe annotation", change: func(spec *faasv1.FunctionSpec) {
+			spec.Annotations = &map[string]string{"com.openfaas.health.http.path": "/healthz"}
+		}, want: true},
+		{name: "prometheus annotation", change: func(spec *faasv1.FunctionSpec) {
+			spec.Annotations = &map[string]string{"owner": "a", "prometheus.io/port": "8081"}
+		}, want: true},
+		{name: "istio injection annotation", change: func(spec *faasv1.FunctionSpec) {
+			spec.Annotations = &map[string]string{"owner": "a", "sidecar.istio.io/inject": "false"}
+		}, want: true},
+		{name: "linkerd injection annotation", change: func(spec *faasv1.FunctionSpec) {
+			spec.Annotations = &map[string]string{"owner": "a", "linkerd.io/inject": "disabled"}
+		}, want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			updated := function.DeepCopy()
+			tc.change(&updated.Spec)
+
+			desired, _, err := newStatefulSet(updated, existing, nil, factory)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := podTemplateChanged(existing, desired); got != tc.want {
+				t.Fatalf("want the pod template changed: %t, got %t", tc.want, got)
+			}
+		})
+	}
+
+	if !podTemplateChanged(&appsv1.StatefulSet{}, existing) {
+		t.Errorf("want a statefulset without a recorded hash to be replaced")
+	}
+}
+
+func Test_statefulsetMetadataPatch(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "figlet",
+			Image:       "ghcr.io/openfaas/figlet:latest",
+			Annotations: &map[string]string{"owner": "a", "tier": "gold"},
+		},
+	}
+	kubeClient := fake.NewSimpleClientset()
+	factory := NewFunctionFactory(kubeClient,
+		k8s.DeploymentConfig{
+			LivenessProbe:  &k8s.ProbeConfig{},
+			ReadinessProbe: &k8s.ProbeConfig{},
+		})
+
+	existing, _, err := newStatefulSet(function, nil, nil, factory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	kubeClient.Tracker().Add(existing)
+
+	updated := function.DeepCopy()
+	updated.Spec.Annotations = &map[string]string{"owner": "b"}
+	desired, _, err := newStatefulSet(updated, existing, nil, factory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	patch, err := statefulsetMetadataPatch(existing, desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	patched, err := kubeClient.AppsV1().StatefulSets("openfaas-fn").Patch(context.Background(), "figlet", types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := patched.Annotations["owner"]; got != "b" {
+		t.Errorf("want the owner annotation to be updated, got %q", got)
+	}
+	if _, ok := patched.Annotations["tier"]; ok {
+		t.Errorf("want the tier annotation to be removed")
+	}
+	if got := patched.Annotations[annotationFunctionSpecHash]; got != desired.Annotations[annotationFunctionSpecHash] {
+		t.Errorf("want the spec hash to be updated, got %q", got)
+	}
+	if got := patched.Spec.Template.Annotations["owner"]; got != "a" {
+		t.Errorf("want the pod template to be left as it is, got owner %q", got)
+	}
+}
+
+func Test_makeEnvVars_ProcessEnv(t *testing.T) {
+	function := &faasv1.Function{
+		Spec: faasv1.FunctionSpec{Name: "figlet", Handler: "figlet"},
+	}
+
+	envVars := makeEnvVars(function, "HANDLER")
+	if len(envVars) != 1 || envVars[0].Name != "HANDLER" || envVars[0].Value != "figlet" {
+		t.Errorf("want HANDLER=figlet, got %v", envVars)
+	}
+}
+
+func Test_newService_Port(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "figlet",
+			Annotations: &map[string]string{"com.openfaas.port": "3000"},
+		},
+	}
+
+	port := newService(function, 9000).Spec.Ports[0]
+	if port.Port != 9000 || port.TargetPort.IntVal != 3000 {
+		t.Errorf("want port 9000 targeting 3000, got %d targeting %d", port.Port, port.TargetPort.IntVal)
+	}
+}
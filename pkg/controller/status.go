@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileError is returned when the StatefulSet for a Function can not be built,
+// the reason is used for the Event and the Ready condition of the Function
+type reconcileError struct {
+	reason string
+	err    error
+}
+
+func (e *reconcileError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reconcileError) Unwrap() error {
+	return e.err
+}
+
+// updateConditions sets the conditions in the status of the Function. The status is
+// only written when a condition has changed, to avoid generating an update on every
+// sync.
+func (c *Controller) updateConditions(function *faasv1.Function, conditions ...metav1.Condition) error {
+	function = function.DeepCopy()
+
+	changed := false
+	for _, condition := range conditions {
+		if current := meta.FindStatusCondition(function.Status.Conditions, condition.Type); current != nil &&
+			current.Status == condition.Status &&
+			current.Reason == condition.Reason &&
+			current.Message == condition.Message &&
+			current.ObservedGeneration == condition.ObservedGeneration {
+			continue
+		}
+
+		meta.SetStatusCondition(&function.Status.Conditions, condition)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	_, err := c.faasclientset.OpenfaasV1().Functions(function.Namespace).UpdateStatus(context.TODO(), function, metav1.UpdateOptions{})
+	return err
+}
+
+// reconcileSucceeded records that the StatefulSet has been created or updated
+func (c *Controller) reconcileSucceeded(function *faasv1.Function, conflicts []k8s.ProfileConflict) {
+	ready := newCondition(function, faasv1.FunctionReady, metav1.ConditionTrue, faasv1.ReasonSynced,
+		"statefulset has been synced")
+
+	if err := c.updateConditions(function, ready, newProfilesCondition(function, conflicts)); err != nil {
+		functionLogger(function).Error(err, "Updating status failed")
+	}
+}
+
+// reconcileFailed records a reconcileError as an Event and as a Ready=False condition
+// in the Function status. The error is always returned so that the Function is
+// requeued until the cause has been resolved.
+func (c *Controller) reconcileFailed(function *faasv1.Function, err error) error {
+	reconcileErr, ok := err.(*reconcileError)
+	if !ok {
+		return err
+	}
+
+	c.recorder.Event(function, corev1.EventTypeWarning, reconcileErr.reason, err.Error())
+
+	conditions := []metav1.Condition{
+		newCondition(function, faasv1.FunctionReady, metav1.ConditionFalse, reconcileErr.reason, err.Error()),
+	}
+	if reconcileErr.reason == faasv1.ReasonProfileNotFound || reconcileErr.reason == faasv1.ReasonProfilesFailed {
+		conditions = append(conditions,
+			newCondition(function, faasv1.FunctionProfilesApplied, metav1.ConditionFalse, reconcileErr.reason, err.Error()))
+	}
+
+	if statusErr := c.updateConditions(function, conditions...); statusErr != nil {
+		functionLogger(function).Error(statusErr, "Updating status failed")
+	}
+
+	return err
+}
+
+func newProfilesCondition(function *faasv1.Function, conflicts []k8s.ProfileConflict) metav1.Condition {
+	if len(conflicts) == 0 {
+		return newCondition(function, faasv1.FunctionProfilesApplied, metav1.ConditionTrue, faasv1.ReasonProfilesApplied,
+			"all profiles were applied")
+	}
+
+	messages := make([]string, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		messages = append(messages, conflict.String())
+	}
+
+	return newCondition(function, faasv1.FunctionProfilesApplied, metav1.ConditionTrue, faasv1.ReasonProfileConflict,
+		fmt.Sprintf("profiles were applied with conflicts: %s", strings.Join(messages, "; ")))
+}
+
+func newCondition(function *faasv1.Function, conditionType string, status metav1.ConditionStatus, reason, message string) metav1.Condition {
+	return metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: function.Generation,
+		Reason:             reason,
+		Message:            message,
+	}
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	faasfake "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/fake"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_newStatefulSet_MissingSecret(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: faasv1.FunctionSpec{
+			Name:    "figlet",
+			Image:   "ghcr.io/openfaas/figlet:latest",
+			Secrets: []string{"api-key"},
+		},
+	}
+
+	factory := NewFunctionFactory(fake.NewSimpleClientset(),
+		k8s.DeploymentConfig{
+			LivenessProbe:  &k8s.ProbeConfig{},
+			ReadinessProbe: &k8s.ProbeConfig{},
+		})
+
+	statefulset, _, err := newStatefulSet(function, nil, nil, factory)
+	if statefulset != nil {
+		t.Fatalf("expected no statefulset without its secrets")
+	}
+
+	var reconcileErr *reconcileError
+	if !errors.As(err, &reconcileErr) || reconcileErr.reason != faasv1.ReasonSecretsFailed {
+		t.Fatalf("expected a %s reconcile error, got %v", faasv1.ReasonSecretsFailed, err)
+	}
+}
+
+func Test_reconcileFailed_SetsConditions(t *testing.T) {
+	function := &faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", Generation: 2},
+		Spec:       faasv1.FunctionSpec{Name: "figlet"},
+	}
+
+	faasClient := faasfake.NewSimpleClientset(function)
+	recorder := record.NewFakeRecorder(1)
+	c := &Controller{faasclientset: faasClient, recorder: recorder}
+
+	cause := &reconcileError{reason: faasv1.ReasonProfileNotFound, err: errors.New(`profile "gvisr" not found`)}
+	if err := c.reconcileFailed(function, cause); err != cause {
+		t.Fatalf("expected the error to be returned for a requeue, got %v", err)
+	}
+
+	got, _ := faasClient.OpenfaasV1().Functions("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	for _, conditionType := range []string{faasv1.FunctionReady, faasv1.FunctionProfilesApplied} {
+		condition := meta.FindStatusCondition(got.Status.Conditions, conditionType)
+		if condition == nil {
+			t.Fatalf("expected a %s condition", conditionType)
+		}
+		if condition.Status != metav1.ConditionFalse || condition.Reason != faasv1.ReasonProfileNotFound {
+			t.Fatalf("expected %s to be False with reason %s, got %+v", conditionType, faasv1.ReasonProfileNotFound, condition)
+		}
+		if condition.ObservedGeneration != 2 {
+			t.Fatalf("expected observed generation 2, got %d", condition.ObservedGeneration)
+		}
+	}
+
+	select {
+	case event := <-recorder.Events:
+		want := `Warning ProfileNotFound profile "gvisr" not found`
+		if event != want {
+			t.Fatalf("expected event %q, got %q", want, event)
+		}
+	default:
+		t.Fatalf("expected a warning event to be recorded")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package events
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+)
+
+// ContainerHealthHandler emits FunctionNotReady or FunctionSidecarNotReady for each
+// container of a function's Pod that stops being ready, or whose reason changes,
+// it is registered with the Pod informer
+func (e *Emitter) ContainerHealthHandler() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			pod, ok := newObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+
+			for _, event := range containerEvents(oldPod, pod) {
+				e.Emit(event)
+			}
+		},
+	}
+}
+
+// startingReasons are reported while a Pod starts, rather than by a container that
+// stopped being ready or failed
+var startingReasons = map[string]bool{
+	"ContainerCreating": true,
+	"PodInitializing":   true,
+	"NotReady":          true,
+}
+
+// containerEvents returns the events for the containers that are not ready in pod
+// and were ready in oldPod, or that have failed for a new reason
+func containerEvents(oldPod, pod *corev1.Pod) []CloudEvent {
+	before := map[string]string{}
+	for _, container := range k8s.UnreadyContainers(oldPod) {
+		before[container.Name] = container.Reason
+	}
+
+	var cloudEvents []CloudEvent
+	for _, container := range k8s.UnreadyContainers(pod) {
+		reason, wasUnready := before[container.Name]
+		if wasUnready && reason == container.Reason {
+			continue
+		}
+		wasReady := !wasUnready && hasStatus(oldPod, container.Name)
+		if !wasReady && startingReasons[container.Reason] {
+			continue
+		}
+
+		eventType := FunctionSidecarNotReady
+		if container.Function {
+			eventType = FunctionNotReady
+		}
+		cloudEvents = append(cloudEvents, NewEvent(eventType, FunctionData{
+			Name:      pod.Labels["faas_function"],
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			Container: container.Name,
+			Reason:    container.Reason,
+		}))
+	}
+	return cloudEvents
+}
+
+func hasStatus(pod *corev1.Pod, container string) bool {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.Name == container {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package events
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newHealthTestPod(statuses ...corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "figlet-0",
+			Namespace: "openfaas-fn",
+			Labels:    map[string]string{"faas_function": "figlet"},
+		},
+		Status: corev1.PodStatus{ContainerStatuses: statuses},
+	}
+}
+
+func Test_containerEvents(t *testing.T) {
+	ready := func(name string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, Ready: true}
+	}
+	waiting := func(name, reason string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}}
+	}
+
+	cases := []struct {
+		name     string
+		old, pod *corev1.Pod
+		want     []string
+	}{
+		{
+			name: "function container stops being ready",
+			old:  newHealthTestPod(ready("figlet"), ready("istio-proxy")),
+			pod:  newHealthTestPod(corev1.ContainerStatus{Name: "figlet"}, ready("istio-proxy")),
+			want: []string{FunctionNotReady + " figlet NotReady"},
+		},
+		{
+			name: "sidecar crashes",
+			old:  newHealthTestPod(ready("figlet"), ready("istio-proxy")),
+			pod:  newHealthTestPod(ready("figlet"), waiting("istio-proxy", "CrashLoopBackOff")),
+			want: []string{FunctionSidecarNotReady + " istio-proxy CrashLoopBackOff"},
+		},
+		{
+			name: "pod starting",
+			old:  newHealthTestPod(),
+			pod:  newHealthTestPod(waiting("figlet", "ContainerCreating"), waiting("istio-proxy", "ContainerCreating")),
+		},
+		{
+			name: "image can not be pulled while starting",
+			old:  newHealthTestPod(waiting("figlet", "ContainerCreating")),
+			pod:  newHealthTestPod(waiting("figlet", "ErrImagePull")),
+			want: []string{FunctionNotReady + " figlet ErrImagePull"},
+		},
+		{
+			name: "same reason",
+			old:  newHealthTestPod(waiting("figlet", "CrashLoopBackOff")),
+			pod:  newHealthTestPod(waiting("figlet", "CrashLoopBackOff")),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := []string{}
+			for _, event := range containerEvents(tc.old, tc.pod) {
+				got = append(got, event.Type+" "+event.Data.Container+" "+event.Data.Reason)
+				if event.Subject != "openfaas-fn/figlet" || event.Data.Pod != "figlet-0" {
+					t.Errorf("want the function and Pod in the event, got %+v", event)
+				}
+			}
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("want events %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("want event %q, got %q", tc.want[i], got[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package events emits CloudEvents for the lifecycle of functions, so that other
+// systems such as chat-ops, a CMDB or an audit log can react to deployments without
+// polling the API.
+//
+// The events are written in the structured JSON format of the CloudEvents 1.0
+// specification to an HTTP endpoint or to a NATS subject. They are sent in the
+// background and dropped when the sink is not keeping up, so that the API never
+// waits for the sink.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+)
+
+const (
+	// FunctionDeployed is emitted when a function has been created
+	FunctionDeployed = "com.openfaas.function.deployed"
+	// FunctionUpdated is emitted when a function has been updated
+	FunctionUpdated = "com.openfaas.function.updated"
+	// FunctionScaled is emitted when the replicas of a function have been set
+	FunctionScaled = "com.openfaas.function.scaled"
+	// FunctionDeleted is emitted when a function has been removed
+	FunctionDeleted = "com.openfaas.function.deleted"
+	// FunctionRolloutFailed is emitted when a function could not be deployed or
+	// updated because of an error in the cluster, rather than an invalid request
+	FunctionRolloutFailed = "com.openfaas.function.rollout_failed"
+	// FunctionDeleteFailed is emitted when a function could not be removed because
+	// of an error in the cluster
+	FunctionDeleteFailed = "com.openfaas.function.delete_failed"
+	// FunctionNotReady is emitted when the function container of a Pod stops being
+	// ready, and FunctionSidecarNotReady when a sidecar or an init container does
+	FunctionNotReady        = "com.openfaas.function.not_ready"
+	FunctionSidecarNotReady = "com.openfaas.function.sidecar_not_ready"
+	// FunctionPreempted is emitted when a function with a low priority is scaled
+	// down while the cluster is saturated, to make room for one with a higher
+	// priority
+	FunctionPreempted = "com.openfaas.function.preempted"
+	// FunctionAdmissionDenied is emitted when a function with a low priority can
+	// not be deployed or scaled up while the cluster is saturated
+	FunctionAdmissionDenied = "com.openfaas.function.admission_denied"
+
+	// Source is the source of the events emitted by faas-netes
+	Source = "/faas-netes"
+
+	specVersion = "1.0"
+)
+
+// CloudEvent is a CloudEvents 1.0 event in the structured JSON format
+type CloudEvent struct {
+	SpecVersion     string       `json:"specversion"`
+	ID              string       `json:"id"`
+	Source          string       `json:"source"`
+	Type            string       `json:"type"`
+	Subject         string       `json:"subject,omitempty"`
+	Time            time.Time    `json:"time"`
+	DataContentType string       `json:"datacontenttype"`
+	Data            FunctionData `json:"data"`
+}
+
+// FunctionData is the data of a lifecycle event
+type FunctionData struct {
+	Name      string  `json:"name"`
+	Namespace string  `json:"namespace"`
+	Image     string  `json:"image,omitempty"`
+	Replicas  *uint64 `json:"replicas,omitempty"`
+	// Error is the response of the API when a rollout or a delete failed
+	Error string `json:"error,omitempty"`
+	// Pod, Container and Reason identify the container that is not ready
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// NewEvent creates an event of eventType for a function
+func NewEvent(eventType string, data FunctionData) CloudEvent {
+	return CloudEvent{
+		SpecVersion:     specVersion,
+		ID:              newID(),
+		Source:          Source,
+		Type:            eventType,
+		Subject:         data.Namespace + "/" + data.Name,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+}
+
+// Sink delivers events to an external system
+type Sink interface {
+	Send(ctx context.Context, event CloudEvent) error
+}
+
+// Emitter queues events and sends them to a Sink in the background
+type Emitter struct {
+	sink    Sink
+	timeout time.Duration
+	queue   chan CloudEvent
+}
+
+// NewEmitter creates an Emitter that buffers up to size events, Run must be called
+// to send them
+func NewEmitter(sink Sink, size int, timeout time.Duration) *Emitter {
+	return &Emitter{
+		sink:    sink,
+		timeout: timeout,
+		queue:   make(chan CloudEvent, size),
+	}
+}
+
+// Emit queues an event without blocking, the event is dropped when the queue is full
+func (e *Emitter) Emit(event CloudEvent) {
+	select {
+	case e.queue <- event:
+	default:
+		logging.Default().Info("Dropping event, the queue is full", "type", event.Type, "subject", event.Subject)
+	}
+}
+
+// Run sends the queued events until ctx is cancelled, an event that can not be sent
+// is logged and dropped
+func (e *Emitter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-e.queue:
+			sendCtx, cancel := context.WithTimeout(ctx, e.timeout)
+			if err := e.sink.Send(sendCtx, event); err != nil {
+				logging.Default().Error(err, "Unable to send event", "type", event.Type, "subject", event.Subject)
+			}
+			cancel()
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format(time.RFC3339Nano)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_Handler_Deployed(t *testing.T) {
+	e := NewEmitter(nil, 10, time.Second)
+	handler := e.Handler(FunctionDeployed, "openfaas-fn", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	body := `{"service":"figlet","image":"ghcr.io/openfaas/figlet:latest"}`
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body)))
+
+	event := <-e.queue
+	if event.Type != FunctionDeployed || event.SpecVersion != "1.0" || event.ID == "" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event.Subject != "openfaas-fn/figlet" || event.Data.Image != "ghcr.io/openfaas/figlet:latest" {
+		t.Errorf("want the function in the event, got %+v", event)
+	}
+}
+
+func Test_Handler_RolloutFailed(t *testing.T) {
+	e := NewEmitter(nil, 10, time.Second)
+	handler := e.Handler(FunctionUpdated, "openfaas-fn", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unable update StatefulSet", http.StatusInternalServerError)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/system/functions", strings.NewReader(`{"service":"figlet"}`)))
+
+	event := <-e.queue
+	if event.Type != FunctionRolloutFailed || event.Data.Error != "unable update StatefulSet" {
+		t.Errorf("want a rollout_failed event with the error, got %+v", event)
+	}
+}
+
+func Test_Handler_NoEventForInvalidRequest(t *testing.T) {
+	e := NewEmitter(nil, 10, time.Second)
+	handler := e.Handler(FunctionDeployed, "openfaas-fn", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "validation failed", http.StatusBadRequest)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(`{"service":"figlet"}`)))
+
+	if len(e.queue) != 0 {
+		t.Errorf("want no event for a rejected request, got %d", len(e.queue))
+	}
+}
+
+func Test_Handler_Scaled(t *testing.T) {
+	e := NewEmitter(nil, 10, time.Second)
+	router := mux.NewRouter()
+	router.HandleFunc("/system/scale-function/{name}", e.Handler(FunctionScaled, "openfaas-fn", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	body := `{"serviceName":"figlet","replicas":0}`
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/system/scale-function/figlet?namespace=staging", strings.NewReader(body)))
+
+	event := <-e.queue
+	if event.Type != FunctionScaled || event.Subject != "staging/figlet" || event.Data.Replicas == nil || *event.Data.Replicas != 0 {
+		t.Errorf("want a scaled event with 0 replicas, got %+v", event)
+	}
+}
+
+func Test_HTTPSink(t *testing.T) {
+	received := make(chan CloudEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); !strings.HasPrefix(got, "application/cloudevents+json") {
+			t.Errorf("want the structured content type, got %q", got)
+		}
+		event := CloudEvent{}
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL, "", server.Client())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := sink.Send(context.Background(), NewEvent(FunctionDeleted, FunctionData{Name: "figlet", Namespace: "openfaas-fn"})); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if event := <-received; event.Type != FunctionDeleted || event.Data.Name != "figlet" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func Test_NewSink_InvalidScheme(t *testing.T) {
+	if _, err := NewSink("ftp://example.com", "", nil); err == nil {
+		t.Errorf("want an error for an unsupported scheme")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	types "github.com/openfaas/faas-provider/types"
+)
+
+// maxErrorLength limits the response of a failed rollout that is added to its event
+const maxErrorLength = 1024
+
+// Handler emits an event of eventType when next succeeds. The function is read from
+// the request body of the deploy, update, scale and delete endpoints. When a deploy
+// or an update fails with a server error, FunctionRolloutFailed is emitted instead,
+// and FunctionDeleteFailed for a delete.
+func (e *Emitter) Handler(eventType, defaultNamespace string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		data := functionData(eventType, defaultNamespace, r, body)
+		if data.Name == "" {
+			return
+		}
+
+		if rec.status >= 200 && rec.status <= 299 {
+			e.Emit(NewEvent(eventType, data))
+			return
+		}
+		if rec.status < 500 {
+			return
+		}
+
+		data.Error = strings.TrimSpace(rec.body.String())
+		switch eventType {
+		case FunctionDeployed, FunctionUpdated:
+			e.Emit(NewEvent(FunctionRolloutFailed, data))
+		case FunctionDeleted:
+			e.Emit(NewEvent(FunctionDeleteFailed, data))
+		}
+	}
+}
+
+func functionData(eventType, defaultNamespace string, r *http.Request, body []byte) FunctionData {
+	data := FunctionData{Namespace: r.URL.Query().Get("namespace")}
+
+	switch eventType {
+	case FunctionDeployed, FunctionUpdated:
+		req := types.FunctionDeployment{}
+		if err := json.Unmarshal(body, &req); err == nil {
+			data.Name = req.Service
+			data.Image = req.Image
+			if req.Namespace != "" {
+				data.Namespace = req.Namespace
+			}
+		}
+	case FunctionScaled:
+		req := types.ScaleServiceRequest{}
+		if err := json.Unmarshal(body, &req); err == nil {
+			data.Name = req.ServiceName
+			replicas := req.Replicas
+			data.Replicas = &replicas
+		}
+		if name := mux.Vars(r)["name"]; name != "" {
+			data.Name = name
+		}
+	case FunctionDeleted:
+		req := types.DeleteFunctionRequest{}
+		if err := json.Unmarshal(body, &req); err == nil {
+			data.Name = req.FunctionName
+		}
+	}
+
+	if data.Namespace == "" {
+		data.Namespace = defaultNamespace
+	}
+	return data
+}
+
+// statusRecorder keeps the status and the start of the body of an error response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	if r.status >= 500 && r.body.Len() < maxErrorLength {
+		n := maxErrorLength - r.body.Len()
+		if n > len(p) {
+			n = len(p)
+		}
+		r.body.Write(p[:n])
+	}
+	return r.ResponseWriter.Write(p)
+}
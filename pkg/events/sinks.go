@@ -0,0 +1,92 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/nats-io/nats.go"
+)
+
+// contentType is used for events in the structured JSON format
+const contentType = "application/cloudevents+json; charset=utf-8"
+
+// NewSink creates an HTTPSink for an http or https URL, or a NATSSink that publishes
+// to subject for a nats URL
+func NewSink(sinkURL, subject string, client *http.Client) (Sink, error) {
+	u, err := url.Parse(sinkURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid events sink %q: %w", sinkURL, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return &HTTPSink{URL: sinkURL, Client: client}, nil
+	case "nats", "tls":
+		nc, err := nats.Connect(sinkURL, nats.Name("faas-netes-events"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to the events sink: %w", err)
+		}
+		return &NATSSink{Conn: nc, Subject: subject}, nil
+	}
+
+	return nil, fmt.Errorf("invalid events sink %q, use an http, https or nats URL", sinkURL)
+}
+
+// HTTPSink posts each event to a URL
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// Send posts the event, any status other than 2xx is an error
+func (s *HTTPSink) Send(ctx context.Context, event CloudEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status from the events sink: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// NATSSink publishes each event to a subject
+type NATSSink struct {
+	Conn    *nats.Conn
+	Subject string
+}
+
+// Send publishes the event, the content type is set in a header
+func (s *NATSSink) Send(ctx context.Context, event CloudEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(s.Subject)
+	msg.Header.Set("Content-Type", contentType)
+	msg.Data = body
+	return s.Conn.PublishMsg(msg)
+}
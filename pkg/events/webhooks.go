@@ -0,0 +1,145 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader is the HMAC-SHA256 of the body with the shared secret, in the
+	// form sha256=HEX, so that a receiver can verify that the webhook was sent by
+	// faas-netes
+	SignatureHeader = "X-OpenFaaS-Signature-256"
+
+	// DeliveryHeader is the ID of the event, it is the same for each retry so that a
+	// receiver can ignore duplicates
+	DeliveryHeader = "X-OpenFaaS-Delivery"
+
+	// EventHeader is the type of the event
+	EventHeader = "X-OpenFaaS-Event"
+)
+
+// WebhookSink posts each event as JSON to a list of URLs, signed with a shared secret.
+// Failed deliveries are retried with an exponential backoff.
+type WebhookSink struct {
+	URLs    []string
+	Secret  []byte
+	Client  *http.Client
+	Retries int
+	// Backoff is the delay before the first retry, it doubles for each retry
+	Backoff time.Duration
+}
+
+// Sign returns the value of the SignatureHeader for body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send delivers the event to all of the URLs in parallel
+func (s *WebhookSink) Send(ctx context.Context, event CloudEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(s.URLs))
+	for i, url := range s.URLs {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			if err := s.deliver(ctx, url, event, body); err != nil {
+				errs[i] = fmt.Errorf("webhook %s: %w", url, err)
+			}
+		}(i, url)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (s *WebhookSink) deliver(ctx context.Context, url string, event CloudEvent, body []byte) error {
+	backoff := s.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(ctx, url, event, body)
+		if err == nil || !retry || attempt >= s.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %s", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post returns true when a failed delivery may be retried
+func (s *WebhookSink) post(ctx context.Context, url string, event CloudEvent, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, event.ID)
+	if len(s.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return false, nil
+	}
+
+	retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status: %d", res.StatusCode)
+}
+
+// ParseURLs splits a comma separated list of URLs
+func ParseURLs(value string) []string {
+	var urls []string
+	for _, url := range strings.Split(value, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// MultiSink sends each event to all of its sinks
+type MultiSink []Sink
+
+// Send sends the event to each sink, the errors of all sinks are returned
+func (m MultiSink) Send(ctx context.Context, event CloudEvent) error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Send(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
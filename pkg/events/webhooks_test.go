@@ -0,0 +1,90 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package events
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_WebhookSink_SignsAndRetries(t *testing.T) {
+	var attempts int32
+	var deliveries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(SignatureHeader), Sign([]byte("s3cr3t"), body); got != want {
+			t.Errorf("want signature %q, got %q", want, got)
+		}
+		deliveries = append(deliveries, r.Header.Get(DeliveryHeader))
+
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{
+		URLs:    []string{server.URL},
+		Secret:  []byte("s3cr3t"),
+		Client:  server.Client(),
+		Retries: 3,
+		Backoff: time.Millisecond,
+	}
+
+	event := NewEvent(FunctionDeployed, FunctionData{Name: "figlet", Namespace: "openfaas-fn"})
+	if err := sink.Send(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("want 3 attempts, got %d", attempts)
+	}
+	for _, id := range deliveries {
+		if id != event.ID {
+			t.Errorf("want the same delivery ID for each retry, got %q", id)
+		}
+	}
+}
+
+func Test_WebhookSink_NoRetryForClientError(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URLs: []string{server.URL}, Client: server.Client(), Retries: 3, Backoff: time.Millisecond}
+
+	err := sink.Send(context.Background(), NewEvent(FunctionDeleted, FunctionData{Name: "figlet"}))
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("want the status in the error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("want a single attempt, got %d", attempts)
+	}
+}
+
+func Test_Sign(t *testing.T) {
+	// echo -n '{}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13"
+	if got := Sign([]byte("secret"), []byte("{}")); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func Test_ParseURLs(t *testing.T) {
+	got := ParseURLs(" https://a.example.com/hook, ,https://b.example.com ")
+	if len(got) != 2 || got[0] != "https://a.example.com/hook" || got[1] != "https://b.example.com" {
+		t.Errorf("unexpected URLs: %v", got)
+	}
+}
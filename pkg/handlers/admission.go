@@ -0,0 +1,110 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	types "github.com/openfaas/faas-provider/types"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+)
+
+// Admission decides whether a function can be deployed or scaled up while the
+// cluster is saturated
+type Admission interface {
+	AdmitDeploy(namespace, name string, labels map[string]string) error
+	AdmitScale(namespace, name string, replicas int32) error
+}
+
+// MakeDeployAdmissionGuard returns a middleware that rejects the deploy of a
+// function with a 503 when it is not admitted. A body that can not be read is
+// passed on for the handler to report.
+func MakeDeployAdmissionGuard(defaultNamespace string, admission Admission) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, err := readBody(r)
+			if err != nil {
+				next(w, r)
+				return
+			}
+
+			request := types.FunctionDeployment{}
+			if err := json.Unmarshal(body, &request); err != nil {
+				next(w, r)
+				return
+			}
+
+			namespace := defaultNamespace
+			if request.Namespace != "" {
+				namespace = request.Namespace
+			}
+			var labels map[string]string
+			if request.Labels != nil {
+				labels = *request.Labels
+			}
+
+			if err := admission.AdmitDeploy(namespace, request.Service, labels); err != nil {
+				logging.FromContext(r.Context()).Info("Deploy denied", "function", request.Service, "namespace", namespace, "reason", err.Error())
+				respondError(w, withStatus(http.StatusServiceUnavailable, err))
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// MakeScaleAdmissionGuard returns a middleware that rejects a scale-up of a
+// function with a 503 when it is not admitted
+func MakeScaleAdmissionGuard(defaultNamespace string, admission Admission) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, err := readBody(r)
+			if err != nil {
+				next(w, r)
+				return
+			}
+
+			request := types.ScaleServiceRequest{}
+			if err := json.Unmarshal(body, &request); err != nil {
+				next(w, r)
+				return
+			}
+
+			name := mux.Vars(r)["name"]
+			namespace := defaultNamespace
+			if q := r.URL.Query().Get("namespace"); q != "" {
+				namespace = q
+			}
+
+			if err := admission.AdmitScale(namespace, name, int32(request.Replicas)); err != nil {
+				logging.FromContext(r.Context()).Info("Scale-up denied", "function", name, "namespace", namespace, "reason", err.Error())
+				respondError(w, withStatus(http.StatusServiceUnavailable, err))
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// readBody reads the body of the request and restores it, so that it can be read
+// again by the handler
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, io.EOF
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewBuffer(body))
+	return body, nil
+}
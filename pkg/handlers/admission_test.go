@@ -0,0 +1,98 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// saturatedAdmission denies the functions without a priority label, and scaling
+// above 1 replica
+type saturatedAdmission struct{}
+
+func (saturatedAdmission) AdmitDeploy(namespace, name string, labels map[string]string) error {
+	if _, ok := labels["com.openfaas.priority"]; !ok {
+		return fmt.Errorf("the cluster is saturated")
+	}
+	return nil
+}
+
+func (saturatedAdmission) AdmitScale(namespace, name string, replicas int32) error {
+	if replicas > 1 {
+		return fmt.Errorf("the cluster is saturated")
+	}
+	return nil
+}
+
+func Test_MakeDeployAdmissionGuard(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "denies a low priority",
+			body:       `{"service": "reports", "image": "reports:1.0"}`,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "admits a high priority",
+			body:       `{"service": "checkout", "image": "checkout:1.0", "labels": {"com.openfaas.priority": "100"}}`,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "passes on an invalid body",
+			body:       `{`,
+			wantStatus: http.StatusAccepted,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var body string
+			guard := MakeDeployAdmissionGuard("openfaas-fn", saturatedAdmission{})
+			handler := guard(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+				w.WriteHeader(http.StatusAccepted)
+			})
+
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(c.body)))
+
+			if rr.Code != c.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", c.wantStatus, rr.Code, rr.Body.String())
+			}
+			if c.wantStatus == http.StatusAccepted && body != c.body {
+				t.Errorf("want the body to be passed on, got %q", body)
+			}
+		})
+	}
+}
+
+func Test_MakeScaleAdmissionGuard(t *testing.T) {
+	router := mux.NewRouter()
+	guard := MakeScaleAdmissionGuard("openfaas-fn", saturatedAdmission{})
+	router.HandleFunc("/system/scale-function/{name}", guard(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	for body, want := range map[string]int{
+		`{"serviceName": "reports", "replicas": 3}`: http.StatusServiceUnavailable,
+		`{"serviceName": "reports", "replicas": 1}`: http.StatusAccepted,
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/scale-function/reports", strings.NewReader(body)))
+		if rr.Code != want {
+			t.Errorf("%s: want status %d, got %d", body, want, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// configureArchitectures schedules the function to nodes with one of the CPU
+// architectures of its image, and rejects it when the cluster has no such nodes.
+// An image whose architectures can not be read from the registry, for instance
+// because it is private, is deployed without the node affinity.
+func configureArchitectures(ctx context.Context, logger logr.Logger, factory k8s.FunctionFactory, statefulset *appsv1.StatefulSet, annotations map[string]string) error {
+	image := statefulset.Spec.Template.Spec.Containers[0].Image
+
+	architectures, err := factory.ImageArchitectures(ctx, image, annotations)
+	if err != nil {
+		logger.Error(err, "Unable to read the architectures of the image", "image", image)
+		return nil
+	}
+	if len(architectures) == 0 {
+		return nil
+	}
+
+	if err := k8s.CheckNodeArchitectures(ctx, factory.Client, statefulset.Spec.Template.Spec.NodeSelector, architectures); err != nil {
+		switch {
+		case errors.Is(err, k8s.ErrNoCompatibleNodes):
+			return invalid(fmt.Errorf("image %s can not be scheduled: %w", image, err))
+		case k8serrors.IsForbidden(err):
+			// nodes can only be listed with a ClusterRole
+			logger.V(2).Info("Unable to list nodes to check the architectures of the image", "error", err.Error())
+		default:
+			return fmt.Errorf("unable to check the architectures of the nodes: %w", err)
+		}
+	}
+
+	k8s.ConfigureArchitectures(statefulset, architectures)
+	return nil
+}
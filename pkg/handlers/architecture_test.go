@@ -0,0 +1,60 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_MakeDeployHandler_Architectures(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{corev1.LabelArchStable: "arm64"}},
+	})
+	factory := k8s.NewFunctionFactory(client, k8s.DeploymentConfig{
+		LivenessProbe:  &k8s.ProbeConfig{},
+		ReadinessProbe: &k8s.ProbeConfig{},
+	}, nil)
+
+	handler := MakeDeployHandler("openfaas-fn", factory)
+
+	for name, want := range map[string]int{
+		"amd64-only": http.StatusUnprocessableEntity,
+		"multi-arch": http.StatusAccepted,
+	} {
+		architectures := "amd64"
+		if name == "multi-arch" {
+			architectures = "amd64,arm64"
+		}
+		body := `{"service":"` + name + `","image":"ghcr.io/openfaas/figlet","annotations":{"com.openfaas.architectures":"` + architectures + `"}}`
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body)))
+
+		if w.Code != want {
+			t.Errorf("%s: want status %d, got %d: %s", name, want, w.Code, w.Body.String())
+		}
+	}
+
+	statefulset, err := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "multi-arch", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	affinity := statefulset.Spec.Template.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		t.Fatalf("want a required node affinity, got %v", affinity)
+	}
+	expressions := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions
+	if len(expressions) != 1 || expressions[0].Key != corev1.LabelArchStable || strings.Join(expressions[0].Values, ",") != "amd64,arm64" {
+		t.Errorf("want the architectures of the image in the affinity, got %v", expressions)
+	}
+}
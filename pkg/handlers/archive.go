@@ -0,0 +1,250 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+)
+
+// FunctionArchiveVersion is the version of the FunctionArchive format
+const FunctionArchiveVersion = 1
+
+// FunctionArchive holds the functions of a namespace, so that they can be restored
+// into another cluster. The values of the secrets are not included, only their
+// names.
+type FunctionArchive struct {
+	Version   int                `json:"version"`
+	Namespace string             `json:"namespace"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Functions []ArchivedFunction `json:"functions"`
+}
+
+// ArchivedFunction is the request that deploys a function, with its replicas when
+// it was archived
+type ArchivedFunction struct {
+	Function types.FunctionDeployment `json:"function"`
+	Replicas int32                    `json:"replicas"`
+}
+
+// RestoredFunction is the outcome of restoring one function from an archive
+type RestoredFunction struct {
+	Name string `json:"name"`
+	// Status is created, updated or failed
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// MakeArchiveHandler exports the functions of the namespace as a FunctionArchive with
+// a GET, and restores the functions of a FunctionArchive with a POST.
+//
+// A function is restored with deploy, or with update when it already exists, so it
+// is checked like any other function, and its secrets and Profiles must exist
+// before the archive is restored. It is then scaled to the replicas it was archived
+// with, unless it was at zero. The functions are restored into the namespace of the
+// request rather than the one of the archive. The status of the response is the
+// status of the first function that failed, and the body has the outcome of each
+// function. Functions owned by a Function resource are not archived, as they are
+// restored with the resource.
+func MakeArchiveHandler(defaultNamespace string, clientset kubernetes.Interface, statefulSetLister v1.StatefulSetLister, deploy, update http.HandlerFunc, limits *k8s.ReplicaLimits, apiTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			exportArchive(w, r, lookupNamespace, statefulSetLister)
+		case http.MethodPost:
+			restoreArchive(w, r, lookupNamespace, clientset, deploy, update, limits, apiTimeout)
+		default:
+			respondError(w, withStatus(http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method)))
+		}
+	}
+}
+
+func exportArchive(w http.ResponseWriter, r *http.Request, namespace string, statefulSetLister v1.StatefulSetLister) {
+	logger := logging.FromContext(r.Context()).WithValues("namespace", namespace)
+
+	req, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	statefulsets, err := statefulSetLister.StatefulSets(namespace).List(labels.NewSelector().Add(*req))
+	if err != nil {
+		logger.Error(err, "Unable to list functions")
+		respondError(w, err)
+		return
+	}
+
+	sort.Slice(statefulsets, func(i, j int) bool {
+		return statefulsets[i].Name < statefulsets[j].Name
+	})
+
+	archive := FunctionArchive{
+		Version:   FunctionArchiveVersion,
+		Namespace: namespace,
+		CreatedAt: time.Now().UTC(),
+		Functions: []ArchivedFunction{},
+	}
+	for _, item := range statefulsets {
+		if k8s.IsOwnedByFunction(*item) {
+			continue
+		}
+
+		request := k8s.AsFunctionDeployment(*item)
+		if request == nil {
+			continue
+		}
+		archive.Functions = append(archive.Functions, ArchivedFunction{Function: *request, Replicas: archivedReplicas(item)})
+	}
+
+	logger.Info("Functions archived", "functions", len(archive.Functions))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "functions-"+namespace+".json"))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(archive)
+}
+
+func restoreArchive(w http.ResponseWriter, r *http.Request, namespace string, clientset kubernetes.Interface, deploy, update http.HandlerFunc, limits *k8s.ReplicaLimits, apiTimeout time.Duration) {
+	logger := logging.FromContext(r.Context()).WithValues("namespace", namespace)
+
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+
+	body, _ := io.ReadAll(r.Body)
+
+	archive := FunctionArchive{}
+	if err := json.Unmarshal(body, &archive); err != nil {
+		respondError(w, badRequest("failed to unmarshal archive: %s", err))
+		return
+	}
+	if archive.Version != FunctionArchiveVersion {
+		respondError(w, badRequest("archive version must be: %d, got %d", FunctionArchiveVersion, archive.Version))
+		return
+	}
+
+	status := http.StatusOK
+	restored := []RestoredFunction{}
+	for _, archived := range archive.Functions {
+		request := archived.Function
+		request.Namespace = namespace
+
+		result := RestoredFunction{Name: request.Service, Status: "created"}
+		responseStatus, err := callFunctionHandler(r, http.MethodPost, request, deploy)
+		if responseStatus == http.StatusConflict && existsAsFunction(r.Context(), clientset, namespace, request.Service, apiTimeout) {
+			result.Status = "updated"
+			responseStatus, err = callFunctionHandler(r, http.MethodPut, request, update)
+		}
+
+		if err == nil && archived.Replicas > 0 {
+			var functionLabels map[string]string
+			if request.Labels != nil {
+				functionLabels = *request.Labels
+			}
+
+			replicas := archived.Replicas
+			if max := limits.FunctionMax(r.Context(), namespace, functionLabels); replicas > max {
+				replicas = max
+			}
+
+			ctx, cancel := k8s.WithAPITimeout(r.Context(), apiTimeout)
+			err = k8s.ApplyStatefulSetReplicas(ctx, clientset, namespace, request.Service, replicas, k8s.ScaleFieldManager)
+			cancel()
+			if err != nil {
+				responseStatus = http.StatusInternalServerError
+				err = fmt.Errorf("function was restored, but could not be scaled: %w", err)
+			}
+		}
+
+		if err != nil {
+			logger.Error(err, "Unable to restore function", "function", request.Service)
+			result.Status = "failed"
+			result.Error = err.Error()
+			if status == http.StatusOK {
+				status = responseStatus
+			}
+		}
+		restored = append(restored, result)
+	}
+
+	logger.Info("Functions restored", "functions", len(restored), "from", archive.Namespace)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(restored)
+}
+
+// callFunctionHandler calls the deploy, update or delete handler with the request of
+// one function, the error is the message of a response that was not successful
+func callFunctionHandler(r *http.Request, method string, request interface{}, handler http.HandlerFunc) (int, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	req := r.Clone(r.Context())
+	req.Method = method
+	req.URL.Path = "/system/functions"
+	req.URL.RawQuery = ""
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	res := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+	handler(res, req)
+
+	if res.status < http.StatusMultipleChoices {
+		return res.status, nil
+	}
+
+	errorResponse := ErrorResponse{}
+	if err := json.Unmarshal(res.body.Bytes(), &errorResponse); err != nil || errorResponse.Message == "" {
+		return res.status, fmt.Errorf("%s", bytes.TrimSpace(res.body.Bytes()))
+	}
+	return res.status, fmt.Errorf("%s", errorResponse.Message)
+}
+
+// existsAsFunction returns true when the StatefulSet of the name was created for a
+// function, rather than for another workload
+func existsAsFunction(ctx context.Context, clientset kubernetes.Interface, namespace, name string, apiTimeout time.Duration) bool {
+	ctx, cancel := k8s.WithAPITimeout(ctx, apiTimeout)
+	defer cancel()
+
+	statefulset, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	return err == nil && isFunction(statefulset)
+}
+
+func archivedReplicas(statefulset *appsv1.StatefulSet) int32 {
+	if statefulset.Spec.Replicas == nil {
+		return 1
+	}
+	return *statefulset.Spec.Replicas
+}
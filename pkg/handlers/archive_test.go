@@ -0,0 +1,141 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newArchiveStatefulSet(name string, replicas int32) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn", Labels: map[string]string{"faas_function": name}},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"faas_function": name}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: name, Image: "ghcr.io/openfaas/" + name + ":latest"}},
+				},
+			},
+		},
+	}
+}
+
+func Test_MakeArchiveHandler_Export(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(newArchiveStatefulSet("nodeinfo", 0))
+	indexer.Add(newArchiveStatefulSet("figlet", 3))
+
+	handler := MakeArchiveHandler("openfaas-fn", fake.NewSimpleClientset(), v1.NewStatefulSetLister(indexer), nil, nil, nil, 0)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/system/functions/archive", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	archive := FunctionArchive{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &archive); err != nil {
+		t.Fatalf("unable to decode the archive: %s", err)
+	}
+	if archive.Version != FunctionArchiveVersion || archive.Namespace != "openfaas-fn" || len(archive.Functions) != 2 {
+		t.Fatalf("want 2 functions from openfaas-fn, got %+v", archive)
+	}
+	if got := archive.Functions[0]; got.Function.Service != "figlet" || got.Replicas != 3 || got.Function.Image != "ghcr.io/openfaas/figlet:latest" {
+		t.Errorf("want figlet at 3 replicas first, got %+v", got)
+	}
+}
+
+func Test_MakeArchiveHandler_Restore(t *testing.T) {
+	client := fake.NewSimpleClientset(newArchiveStatefulSet("figlet", 1))
+	scaled := map[string]int32{}
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		obj := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(patch.GetPatch(), obj); err != nil {
+			t.Fatalf("unable to decode the patch: %s", err)
+		}
+		scaled[patch.GetName()] = *obj.Spec.Replicas
+		return true, obj, nil
+	})
+
+	calls := []string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request := types.FunctionDeployment{}
+		json.Unmarshal(body, &request)
+		calls = append(calls, r.Method+" "+request.Service+"."+request.Namespace)
+
+		switch {
+		case r.Method == http.MethodPost && request.Service == "figlet":
+			respondError(w, withStatus(http.StatusConflict, io.EOF))
+		case request.Service == "env":
+			respondError(w, invalid(io.EOF))
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}
+
+	archive := `{"version": 1, "namespace": "staging", "functions": [
+		{"function": {"service": "figlet", "image": "figlet", "namespace": "staging"}, "replicas": 3},
+		{"function": {"service": "nodeinfo", "image": "nodeinfo"}, "replicas": 0},
+		{"function": {"service": "env", "image": "env"}, "replicas": 1}
+	]}`
+
+	rr := httptest.NewRecorder()
+	MakeArchiveHandler("openfaas-fn", client, nil, handler, handler, nil, 0)(rr,
+		httptest.NewRequest(http.MethodPost, "/system/functions/archive", strings.NewReader(archive)))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("want the status of the function that failed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	restored := []RestoredFunction{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &restored); err != nil {
+		t.Fatalf("unable to decode the response: %s", err)
+	}
+	statuses := map[string]string{}
+	for _, function := range restored {
+		statuses[function.Name] = function.Status
+	}
+	wantStatuses := map[string]string{"figlet": "updated", "nodeinfo": "created", "env": "failed"}
+	if !reflect.DeepEqual(statuses, wantStatuses) {
+		t.Errorf("want %v, got %v", wantStatuses, statuses)
+	}
+
+	wantCalls := []string{"POST figlet.openfaas-fn", "PUT figlet.openfaas-fn", "POST nodeinfo.openfaas-fn", "POST env.openfaas-fn"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("want calls %v, got %v", wantCalls, calls)
+	}
+	if !reflect.DeepEqual(scaled, map[string]int32{"figlet": 3}) {
+		t.Errorf("want only figlet to be scaled to 3 replicas, got %v", scaled)
+	}
+}
+
+func Test_MakeArchiveHandler_RejectsAnotherVersion(t *testing.T) {
+	rr := httptest.NewRecorder()
+	MakeArchiveHandler("openfaas-fn", fake.NewSimpleClientset(), nil, nil, nil, nil, 0)(rr,
+		httptest.NewRequest(http.MethodPost, "/system/functions/archive", strings.NewReader(`{"version": 2}`)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("want status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
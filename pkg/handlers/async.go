@@ -0,0 +1,89 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// CallbackURLHeader is the URL that the result of an async invocation is posted to
+const CallbackURLHeader = "X-Callback-Url"
+
+// MakeAsyncHandler accepts invocations on /async-function/{name} and publishes them
+// with queuer, the call ID is returned so that the caller can correlate the result
+// posted to the callback URL
+func MakeAsyncHandler(queuer types.RequestQueuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		switch r.Method {
+		case http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+			http.MethodGet:
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		pathVars := mux.Vars(r)
+		functionName := pathVars["name"]
+		if functionName == "" {
+			httputil.Errorf(w, http.StatusBadRequest, "Provide function name in the request path")
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("function", functionName)
+
+		var callbackURL *url.URL
+		if value := r.Header.Get(CallbackURLHeader); value != "" {
+			u, err := url.Parse(value)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				httputil.Errorf(w, http.StatusBadRequest, "Invalid %s: %q", CallbackURLHeader, value)
+				return
+			}
+			callbackURL = u
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			if err != nil {
+				httputil.Errorf(w, http.StatusBadRequest, "Unable to read the request body")
+				return
+			}
+		}
+
+		req := &types.QueueRequest{
+			Function:    functionName,
+			Header:      r.Header,
+			Host:        r.Host,
+			Body:        body,
+			Method:      r.Method,
+			Path:        pathVars["params"],
+			QueryString: r.URL.RawQuery,
+			CallbackURL: callbackURL,
+		}
+
+		if err := queuer.Queue(req); err != nil {
+			logger.Error(err, "Error queuing the invocation")
+			httputil.Errorf(w, http.StatusInternalServerError, "Unable to queue the invocation for: %s.", functionName)
+			return
+		}
+
+		logger.V(1).Info("Invocation queued", "bytes", len(body))
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
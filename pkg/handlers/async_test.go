@@ -0,0 +1,82 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+type fakeQueuer struct {
+	requests []*types.QueueRequest
+	err      error
+}
+
+func (q *fakeQueuer) Queue(req *types.QueueRequest) error {
+	q.requests = append(q.requests, req)
+	return q.err
+}
+
+func Test_MakeAsyncHandler_QueuesRequest(t *testing.T) {
+	queuer := &fakeQueuer{}
+	router := mux.NewRouter()
+	router.HandleFunc("/async-function/{name}{params:/?.*}", MakeAsyncHandler(queuer))
+
+	r := httptest.NewRequest(http.MethodPost, "http://gateway:8080/async-function/figlet.staging/sub?text=1", strings.NewReader("hi"))
+	r.Header.Set(CallbackURLHeader, "http://requestbin:8080/result")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	if len(queuer.requests) != 1 {
+		t.Fatalf("want 1 queued request, got %d", len(queuer.requests))
+	}
+
+	req := queuer.requests[0]
+	if req.Function != "figlet.staging" || req.Path != "/sub" || req.QueryString != "text=1" || string(req.Body) != "hi" {
+		t.Errorf("unexpected queued request: %+v", req)
+	}
+	if req.CallbackURL == nil || req.CallbackURL.String() != "http://requestbin:8080/result" {
+		t.Errorf("want the callback URL to be queued, got %v", req.CallbackURL)
+	}
+}
+
+func Test_MakeAsyncHandler_InvalidCallback(t *testing.T) {
+	queuer := &fakeQueuer{}
+	router := mux.NewRouter()
+	router.HandleFunc("/async-function/{name}", MakeAsyncHandler(queuer))
+
+	r := httptest.NewRequest(http.MethodPost, "/async-function/figlet", nil)
+	r.Header.Set(CallbackURLHeader, "not-a-url")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("want status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if len(queuer.requests) != 0 {
+		t.Errorf("want no queued requests, got %d", len(queuer.requests))
+	}
+}
+
+func Test_MakeAsyncHandler_QueueError(t *testing.T) {
+	queuer := &fakeQueuer{err: errors.New("nats: timeout")}
+	router := mux.NewRouter()
+	router.HandleFunc("/async-function/{name}", MakeAsyncHandler(queuer))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/async-function/figlet", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("want status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// CostAllocation is the CPU, memory and storage requested by the functions that
+// share the value of a cost-allocation label in a namespace
+type CostAllocation struct {
+	Namespace string `json:"namespace"`
+	// Label is the key of the cost-allocation label, it is empty when no cost
+	// labels are configured and the usage is only grouped by namespace
+	Label string `json:"label,omitempty"`
+	// Value of the label, functions without the label are reported with an empty value
+	Value     string `json:"value"`
+	Functions int    `json:"functions"`
+	Replicas  int32  `json:"replicas"`
+	CPU       string `json:"cpu"`
+	Memory    string `json:"memory"`
+	Storage   string `json:"storage"`
+}
+
+// MakeChargebackHandler reports the resources requested by the functions for each
+// team or project, so that their usage can be charged back. The functions are grouped
+// by the first of the costLabels, or by another one with the label query parameter.
+func MakeChargebackHandler(defaultNamespace string, costLabels []string, statefulSetLister v1.StatefulSetLister, client kubernetes.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		lookupNamespace := defaultNamespace
+		if namespace := q.Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		groupBy := ""
+		if len(costLabels) > 0 {
+			groupBy = costLabels[0]
+		}
+		if label := q.Get("label"); len(label) > 0 {
+			if !containsString(costLabels, label) {
+				respondError(w, badRequest("label must be one of the cost labels: %v", costLabels))
+				return
+			}
+			groupBy = label
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("namespace", lookupNamespace)
+
+		req, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		statefulsets, err := statefulSetLister.StatefulSets(lookupNamespace).List(labels.NewSelector().Add(*req))
+		if err != nil {
+			logger.Error(err, "Unable to list functions")
+			respondError(w, err)
+			return
+		}
+
+		claims, err := listClaims(r.Context(), client, lookupNamespace)
+		if err != nil {
+			logger.Error(err, "Unable to list PersistentVolumeClaims")
+			respondError(w, err)
+			return
+		}
+
+		type totals struct {
+			functions            int
+			replicas             int32
+			cpu, memory, storage resource.Quantity
+		}
+		groups := map[string]*totals{}
+		for _, statefulset := range statefulsets {
+			value := ""
+			if groupBy != "" {
+				value = statefulset.Labels[groupBy]
+			}
+
+			group, ok := groups[value]
+			if !ok {
+				group = &totals{
+					cpu:     *resource.NewQuantity(0, resource.DecimalSI),
+					memory:  *resource.NewQuantity(0, resource.BinarySI),
+					storage: *resource.NewQuantity(0, resource.BinarySI),
+				}
+				groups[value] = group
+			}
+
+			usage := k8s.GetFunctionUsage(statefulset, claims)
+			group.functions++
+			group.replicas += usage.Replicas
+			group.cpu.Add(usage.CPU)
+			group.memory.Add(usage.Memory)
+			group.storage.Add(usage.Storage)
+		}
+
+		report := []CostAllocation{}
+		for value, group := range groups {
+			report = append(report, CostAllocation{
+				Namespace: lookupNamespace,
+				Label:     groupBy,
+				Value:     value,
+				Functions: group.functions,
+				Replicas:  group.replicas,
+				CPU:       group.cpu.String(),
+				Memory:    group.memory.String(),
+				Storage:   group.storage.String(),
+			})
+		}
+
+		sort.Slice(report, func(i, j int) bool {
+			return report[i].Value < report[j].Value
+		})
+
+		res, err := json.Marshal(report)
+		if err != nil {
+			logger.Error(err, "Unable to marshal the chargeback report")
+			respondError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(res)
+	}
+}
+
+// listClaims returns the PersistentVolumeClaims of the namespace by name, for
+// k8s.GetFunctionUsage
+func listClaims(ctx context.Context, client kubernetes.Interface, namespace string) (map[string]*corev1.PersistentVolumeClaim, error) {
+	claimList, err := client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]*corev1.PersistentVolumeClaim, len(claimList.Items))
+	for i := range claimList.Items {
+		claims[claimList.Items[i].Name] = &claimList.Items[i]
+	}
+	return claims, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newChargebackStatefulSet(name string, labels map[string]string, replicas int32, cpu, memory string) *appsv1.StatefulSet {
+	labels["faas_function"] = name
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn", Labels: labels},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: name,
+						Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse(cpu),
+							corev1.ResourceMemory: resource.MustParse(memory),
+						}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func Test_MakeChargebackHandler(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(newChargebackStatefulSet("figlet", map[string]string{"team": "payments", "project": "cli"}, 2, "100m", "128Mi"))
+	indexer.Add(newChargebackStatefulSet("env", map[string]string{"team": "payments", "project": "web"}, 1, "50m", "64Mi"))
+	indexer.Add(newChargebackStatefulSet("nodeinfo", map[string]string{}, 1, "10m", "32Mi"))
+
+	handler := MakeChargebackHandler("openfaas-fn", []string{"team", "project"},
+		appslister.NewStatefulSetLister(indexer), fake.NewSimpleClientset())
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/system/chargeback", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var got []CostAllocation
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []CostAllocation{
+		{Namespace: "openfaas-fn", Label: "team", Value: "", Functions: 1, Replicas: 1, CPU: "10m", Memory: "32Mi", Storage: "0"},
+		{Namespace: "openfaas-fn", Label: "team", Value: "payments", Functions: 2, Replicas: 3, CPU: "250m", Memory: "320Mi", Storage: "0"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %+v\n got %+v", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/system/chargeback?label=project", nil))
+	got = nil
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if len(got) != 3 || got[1].Value != "cli" || got[1].CPU != "200m" {
+		t.Fatalf("want the report grouped by project, got %+v", got)
+	}
+}
+
+func Test_MakeChargebackHandler_UnknownLabel(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	handler := MakeChargebackHandler("openfaas-fn", []string{"team"},
+		appslister.NewStatefulSetLister(indexer), fake.NewSimpleClientset())
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/system/chargeback?label=owner", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
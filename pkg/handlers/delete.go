@@ -10,16 +10,19 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
+	"github.com/openfaas/faas-netes/pkg/k8s"
 	"github.com/openfaas/faas-provider/types"
 	appsv1 "k8s.io/api/apps/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
-// MakeDeleteHandler delete a function
-func MakeDeleteHandler(defaultNamespace string, clientset *kubernetes.Clientset) http.HandlerFunc {
+// MakeDeleteHandler delete a function, each call to the Kubernetes API is bounded
+// by apiTimeout
+func MakeDeleteHandler(defaultNamespace string, clientset kubernetes.Interface, dynamicClient dynamic.Interface, reader k8s.CachedReader, apiTimeout time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
@@ -32,13 +35,8 @@ func MakeDeleteHandler(defaultNamespace string, clientset *kubernetes.Clientset)
 			lookupNamespace = namespace
 		}
 
-		if lookupNamespace == "kube-system" {
-			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
-			return
-		}
-
 		if lookupNamespace != defaultNamespace {
-			http.Error(w, fmt.Sprintf("namespace must be: %s", defaultNamespace), http.StatusBadRequest)
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
 			return
 		}
 
@@ -47,42 +45,31 @@ func MakeDeleteHandler(defaultNamespace string, clientset *kubernetes.Clientset)
 		request := types.DeleteFunctionRequest{}
 		err := json.Unmarshal(body, &request)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			respondError(w, badRequest("unable to unmarshal request: %s", err))
 			return
 		}
 
 		if len(request.FunctionName) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
+			respondError(w, badRequest("functionName: is required"))
 			return
 		}
 
-		getOpts := metav1.GetOptions{}
-
 		// This makes sure we don't delete non-labelled statefulsets
-		statefulset, findDeployErr := clientset.AppsV1().
-			StatefulSets(lookupNamespace).
-			Get(context.TODO(), request.FunctionName, getOpts)
-
+		ctx, cancel := k8s.WithAPITimeout(r.Context(), apiTimeout)
+		statefulset, findDeployErr := reader.GetStatefulSet(ctx, lookupNamespace, request.FunctionName)
+		cancel()
 		if findDeployErr != nil {
-			if errors.IsNotFound(findDeployErr) {
-				w.WriteHeader(http.StatusNotFound)
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-
-			w.Write([]byte(findDeployErr.Error()))
+			respondError(w, findDeployErr)
 			return
 		}
 
-		if isFunction(statefulset) {
-			err := deleteFunction(lookupNamespace, clientset, request, w)
-			if err != nil {
-				return
-			}
-		} else {
-			w.WriteHeader(http.StatusBadRequest)
+		if !isFunction(statefulset) {
+			respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("not a function: %s", request.FunctionName)))
+			return
+		}
 
-			w.Write([]byte("Not a function: " + request.FunctionName))
+		if err := deleteFunction(r.Context(), apiTimeout, lookupNamespace, clientset, dynamicClient, request); err != nil {
+			respondError(w, err)
 			return
 		}
 
@@ -99,34 +86,24 @@ func isFunction(statefulset *appsv1.StatefulSet) bool {
 	return false
 }
 
-func deleteFunction(functionNamespace string, clientset *kubernetes.Clientset, request types.DeleteFunctionRequest, w http.ResponseWriter) error {
+func deleteFunction(ctx context.Context, apiTimeout time.Duration, functionNamespace string, clientset kubernetes.Interface, dynamicClient dynamic.Interface, request types.DeleteFunctionRequest) error {
 	foregroundPolicy := metav1.DeletePropagationForeground
 	opts := &metav1.DeleteOptions{PropagationPolicy: &foregroundPolicy}
 
+	deployCtx, cancel := k8s.WithAPITimeout(ctx, apiTimeout)
+	defer cancel()
 	if deployErr := clientset.AppsV1().StatefulSets(functionNamespace).
-		Delete(context.TODO(), request.FunctionName, *opts); deployErr != nil {
-
-		if errors.IsNotFound(deployErr) {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		w.Write([]byte(deployErr.Error()))
-		return fmt.Errorf("error deleting function's statefulset")
+		Delete(deployCtx, request.FunctionName, *opts); deployErr != nil {
+		return fmt.Errorf("error deleting function's statefulset: %w", deployErr)
 	}
 
+	svcCtx, cancel := k8s.WithAPITimeout(ctx, apiTimeout)
+	defer cancel()
 	if svcErr := clientset.CoreV1().
 		Services(functionNamespace).
-		Delete(context.TODO(), request.FunctionName, *opts); svcErr != nil {
-
-		if errors.IsNotFound(svcErr) {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-
-		w.Write([]byte(svcErr.Error()))
-		return fmt.Errorf("error deleting function's service")
+		Delete(svcCtx, request.FunctionName, *opts); svcErr != nil {
+		return fmt.Errorf("error deleting function's service: %w", svcErr)
 	}
-	return nil
+
+	return deleteFunctionResources(ctx, apiTimeout, functionNamespace, clientset, dynamicClient, request.FunctionName)
 }
@@ -0,0 +1,67 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_MakeDeleteHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		url        string
+		body       string
+		wantStatus int
+	}{
+		{name: "deleted", url: "/system/functions", body: `{"functionName": "figlet"}`, wantStatus: http.StatusAccepted},
+		{name: "not found", url: "/system/functions", body: `{"functionName": "nodeinfo"}`, wantStatus: http.StatusNotFound},
+		{name: "not a function", url: "/system/functions", body: `{"functionName": "redis"}`, wantStatus: http.StatusNotFound},
+		{name: "invalid JSON", url: "/system/functions", body: `{"functionName":`, wantStatus: http.StatusBadRequest},
+		{name: "missing name", url: "/system/functions", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "other namespace", url: "/system/functions?namespace=team-b", body: `{"functionName": "figlet"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(
+				&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", Labels: map[string]string{"faas_function": "figlet"}}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}},
+				&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "openfaas-fn"}},
+			)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			reader := k8s.NewCachedReader(client, appslister.NewStatefulSetLister(indexer), corelister.NewServiceLister(indexer))
+
+			handler := MakeDeleteHandler("openfaas-fn", client, nil, reader, k8s.DefaultAPITimeout)
+
+			req := httptest.NewRequest(http.MethodDelete, tc.url, strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code == http.StatusAccepted {
+				return
+			}
+
+			var body ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Status != tc.wantStatus {
+				t.Errorf("want an ErrorResponse with status %d, got %q", tc.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
@@ -5,18 +5,18 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
 
+	"github.com/go-logr/logr"
 	types "github.com/openfaas/faas-provider/types"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -28,9 +28,12 @@ import (
 // initialReplicasCount how many replicas to start of creating for a function
 const initialReplicasCount = 1
 
-// MakeDeployHandler creates a handler to create new functions in the cluster
+// MakeDeployHandler creates a handler to create new functions in the cluster.
+//
+// With wait=true the handler blocks until the Pods of the function are ready, or
+// until the timeout query parameter, and returns the RolloutStatus.
 func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory) http.HandlerFunc {
-	secrets := k8s.NewSecretsClient(factory.Client)
+	secrets := factory.NewSecretsClient()
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -44,14 +47,18 @@ func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory) ht
 		request := types.FunctionDeployment{}
 		err := json.Unmarshal(body, &request)
 		if err != nil {
-			wrappedErr := fmt.Errorf("failed to unmarshal request: %s", err.Error())
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+			respondError(w, badRequest("failed to unmarshal request: %s", err))
 			return
 		}
 
 		if err := ValidateDeployRequest(&request); err != nil {
-			wrappedErr := fmt.Errorf("validation failed: %s", err.Error())
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+			respondError(w, invalid(err))
+			return
+		}
+
+		waitForReady, timeout, err := parseWait(r.URL.Query())
+		if err != nil {
+			respondError(w, badRequest("%s", err))
 			return
 		}
 
@@ -60,81 +67,212 @@ func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory) ht
 			namespace = request.Namespace
 		}
 
+		logger := logging.FromContext(ctx).WithValues("function", request.Service, "namespace", namespace)
+
 		if namespace != functionNamespace {
-			http.Error(w, fmt.Sprintf("namespace must be: %s", functionNamespace), http.StatusBadRequest)
+			respondError(w, badRequest("namespace must be: %s", functionNamespace))
 			return
 		}
+		request.Namespace = namespace
 
-		existingSecrets, err := secrets.GetSecrets(namespace, request.Secrets)
+		if request.Labels != nil {
+			if err := factory.ReplicaLimits.Validate(ctx, namespace, *request.Labels); err != nil {
+				respondError(w, invalid(err))
+				return
+			}
+		}
+
+		collisionCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		if err := k8s.FindNameCollision(collisionCtx, factory.Client, namespace, request.Service); err != nil {
+			if k8s.IsNameCollision(err) {
+				respondError(w, withStatus(http.StatusConflict, err))
+				return
+			}
+			logger.Error(err, "Unable to check the name of the function")
+			respondError(w, fmt.Errorf("unable to check the name of function %s: %w", request.Service, err))
+			return
+		}
+
+		if err := verifyImage(withScanBypass(r, request), factory, namespace, request.Image); err != nil {
+			logger.Error(err, "Image verification failed", "image", request.Image)
+			respondError(w, err)
+			return
+		}
+
+		existingSecrets, err := secrets.GetSecrets(ctx, namespace, request.Secrets)
 		if err != nil {
-			wrappedErr := fmt.Errorf("unable to fetch secrets: %s", err.Error())
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+			respondError(w, secretsError(err))
+			return
+		}
+
+		if err := factory.CheckSecretPolicy(ctx, namespace, existingSecrets); err != nil {
+			respondError(w, invalid(err))
 			return
 		}
 
-		statefulsetSpec, specErr := makeStatefulSetSpec(request, existingSecrets, factory)
+		statefulsetSpec, err := makeStatefulSetSpec(request, existingSecrets, factory)
+		if err != nil {
+			logger.Error(err, "Failed to create statefulset spec")
+			respondError(w, invalid(fmt.Errorf("failed create statefulset spec: %w", err)))
+			return
+		}
 
 		var profileList []k8s.Profile
 		if request.Annotations != nil {
 			profileNamespace := factory.Config.ProfilesNamespace
 			profileList, err = factory.GetProfiles(ctx, profileNamespace, *request.Annotations)
 			if err != nil {
-				wrappedErr := fmt.Errorf("failed create Statefulset spec: %s", err.Error())
-				log.Println(wrappedErr)
-				http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+				logger.Error(err, "Unable to fetch profiles")
+				respondError(w, profileError(err))
 				return
 			}
 		}
 		for _, profile := range profileList {
-			factory.ApplyProfile(profile, statefulsetSpec)
+			if err := factory.ApplyProfile(profile, statefulsetSpec); err != nil {
+				respondError(w, invalid(err))
+				return
+			}
+		}
+		var conflicts []k8s.ProfileConflict
+		if request.Annotations != nil {
+			conflicts = k8s.ProfileConflicts(*request.Annotations, profileList)
+		}
+
+		if err := factory.ConfigurePodSecurity(statefulsetSpec); err != nil {
+			respondError(w, invalid(err))
+			return
+		}
+
+		if err := k8s.ConfigureConstraints(statefulsetSpec, request.Constraints); err != nil {
+			respondError(w, invalid(err))
+			return
+		}
+
+		var annotations map[string]string
+		if request.Annotations != nil {
+			annotations = *request.Annotations
+		}
+		if err := configureArchitectures(ctx, logger, factory, statefulsetSpec, annotations); err != nil {
+			logger.Error(err, "Architecture check failed", "image", request.Image)
+			respondError(w, err)
+			return
 		}
 
-		if specErr != nil {
-			wrappedErr := fmt.Errorf("failed create statefulset spec: %s", specErr.Error())
-			log.Println(wrappedErr)
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+		if err := k8s.SetTemplateHash(&statefulsetSpec.Spec.Template); err != nil {
+			respondError(w, err)
+			return
+		}
+
+		// the Service is built before anything is created, so that an invalid
+		// request does not leave a StatefulSet behind
+		serviceSpec, err := makeServiceSpec(request, factory)
+		if err != nil {
+			logger.Error(err, "Failed to create service spec")
+			respondError(w, invalid(fmt.Errorf("failed create Service spec: %w", err)))
 			return
 		}
 
 		deploy := factory.Client.AppsV1().StatefulSets(namespace)
 
-		_, err = deploy.Create(context.TODO(), statefulsetSpec, metav1.CreateOptions{})
+		createCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		created, err := deploy.Create(createCtx, statefulsetSpec, metav1.CreateOptions{FieldManager: k8s.FieldManager})
 		if err != nil {
-			wrappedErr := fmt.Errorf("unable create Statefulset: %s", err.Error())
-			log.Println(wrappedErr)
-			http.Error(w, wrappedErr.Error(), http.StatusInternalServerError)
+			logger.Error(err, "Unable to create statefulset")
+			respondError(w, fmt.Errorf("unable create Statefulset: %w", err))
 			return
 		}
 
-		log.Printf("Statefulset created: %s.%s\n", request.Service, namespace)
+		logger.Info("Statefulset created")
+
+		applyVPA(ctx, logger, factory, created)
+		applyMeshPolicy(ctx, logger, factory, created)
+		applyPrewarm(ctx, logger, factory, created, nil)
+
+		if hasExternalSecrets(request.Secrets) {
+			syncCtx, cancel := factory.WithAPITimeout(ctx)
+			defer cancel()
+			if err := k8s.SyncSecretProviderClass(syncCtx, factory.Dynamic, request.Service, namespace, request.Secrets,
+				factory.Config.SecretsStore, k8s.StatefulSetOwner(created), factory.Config.CostAllocationLabels(created.Labels)); err != nil {
+				wrappedErr := fmt.Errorf("failed create SecretProviderClass: %w", err)
+				logger.Error(err, "Failed to create SecretProviderClass")
+				respondError(w, withRollback(wrappedErr, rollbackDeploy(logger, factory, created)))
+				return
+			}
+		}
+
+		if err := syncFunctionResources(ctx, factory, created, annotations, requestLabels(request), nil); err != nil {
+			logger.Error(err, "Failed to apply function resources")
+			respondError(w, withRollback(err, rollbackDeploy(logger, factory, created)))
+			return
+		}
 
 		service := factory.Client.CoreV1().Services(namespace)
-		serviceSpec, err := makeServiceSpec(request, factory)
-		if err != nil {
-			wrappedErr := fmt.Errorf("failed create Service spec: %s", err.Error())
-			log.Println(wrappedErr)
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+		serviceCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		if _, err = service.Create(serviceCtx, serviceSpec, metav1.CreateOptions{FieldManager: k8s.FieldManager}); err != nil {
+			wrappedErr := fmt.Errorf("failed create Service: %w", err)
+			logger.Error(err, "Failed to create service")
+			respondError(w, withRollback(wrappedErr, rollbackDeploy(logger, factory, created)))
 			return
 		}
 
-		if _, err = service.Create(context.TODO(), serviceSpec, metav1.CreateOptions{}); err != nil {
-			wrappedErr := fmt.Errorf("failed create Service: %s", err.Error())
-			log.Println(wrappedErr)
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+		logger.Info("Service created")
+
+		writeProfileConflicts(w, logger, conflicts)
+		w.Header().Set(ResourceVersionHeader, created.ResourceVersion)
+		if !waitForReady {
+			w.WriteHeader(http.StatusAccepted)
 			return
 		}
+		writeRolloutStatus(ctx, w, logger, factory.Client, namespace, request.Service, timeout)
+	}
+}
 
-		log.Printf("Service created: %s.%s\n", request.Service, namespace)
+func hasExternalSecrets(secrets []string) bool {
+	for _, secret := range secrets {
+		if k8s.IsExternalSecret(secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// profileError returns the error from GetProfiles with its HTTP status, a
+// reference to a missing Profile is a bad request rather than a server error
+func profileError(err error) error {
+	err = fmt.Errorf("unable to fetch profiles: %w", err)
+	if k8s.IsProfileNotFound(err) {
+		return invalid(err)
+	}
+	return err
+}
 
-		w.WriteHeader(http.StatusAccepted)
+// secretsError returns the error from GetSecrets with its HTTP status, a secret
+// that does not exist is an invalid reference rather than a missing function
+func secretsError(err error) error {
+	err = fmt.Errorf("unable to fetch secrets: %w", err)
+	if k8s.IsNotFound(err) {
+		return invalid(err)
+	}
+	return err
+}
+
+// writeProfileConflicts logs each conflict between the Profiles of a function and
+// returns it to the caller as a Warning header
+func writeProfileConflicts(w http.ResponseWriter, logger logr.Logger, conflicts []k8s.ProfileConflict) {
+	for _, conflict := range conflicts {
+		logger.Info("Profile conflict", "conflict", conflict.String())
+		w.Header().Add("Warning", fmt.Sprintf("299 - %q", conflict.String()))
 	}
 }
 
 func makeStatefulSetSpec(request types.FunctionDeployment, existingSecrets map[string]*corev1.Secret, factory k8s.FunctionFactory) (*appsv1.StatefulSet, error) {
-	envVars := buildEnvVars(&request)
+	envVars := k8s.AddDefaultEnv(buildEnvVars(&request, factory.Config.WatchdogEnv.ProcessName()), factory.DefaultEnv.Values())
 	initialReplicas := int32p(initialReplicasCount)
 	labels := map[string]string{
-		"faas_function": request.Service, 
+		"faas_function": request.Service,
 	}
 
 	if request.Labels != nil {
@@ -146,13 +284,19 @@ func makeStatefulSetSpec(request types.FunctionDeployment, existingSecrets map[s
 		}
 	}
 
-	nodeSelector := createSelector(request.Constraints)
+	// the other constraints are added to the node affinity by ConfigureConstraints
+	// once the Profiles have been applied
+	nodeSelector, _, err := k8s.ParseConstraints(request.Constraints)
+	if err != nil {
+		return nil, err
+	}
 
 	resources, err := createResources(request)
 
 	if err != nil {
 		return nil, err
 	}
+	factory.ApplyDefaultResources(resources)
 
 	annotations, err := buildAnnotations(request)
 	if err != nil {
@@ -164,22 +308,30 @@ func makeStatefulSetSpec(request types.FunctionDeployment, existingSecrets map[s
 		return nil, err
 	}
 
+	port, err := k8s.FunctionPort(annotations, factory.Config.RuntimeHTTPPort)
+	if err != nil {
+		return nil, err
+	}
+
 	statefulSetSpec := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        request.Service,
+			Namespace:   request.Namespace,
 			Annotations: annotations,
-			Labels: labels,
+			Labels:      labels,
 		},
 		Spec: appsv1.StatefulSetSpec{
+			// the selector can not be changed once the StatefulSet exists, so it
+			// only has the name, the labels of the request can then be changed
 			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
+				MatchLabels: map[string]string{"faas_function": request.Service},
 			},
 			Replicas: initialReplicas,
 			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
 				Type: appsv1.RollingUpdateStatefulSetStrategyType,
 				RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
 					MaxUnavailable: &intstr.IntOrString{
-						Type: intstr.Int,
+						Type:   intstr.Int,
 						IntVal: int32(0),
 					},
 				},
@@ -200,7 +352,7 @@ func makeStatefulSetSpec(request types.FunctionDeployment, existingSecrets map[s
 							Ports: []corev1.ContainerPort{
 								{
 									Name:          "http",
-									ContainerPort: factory.Config.RuntimeHTTPPort,
+									ContainerPort: port,
 									Protocol:      corev1.ProtocolTCP,
 								},
 							},
@@ -223,6 +375,24 @@ func makeStatefulSetSpec(request types.FunctionDeployment, existingSecrets map[s
 
 	factory.ConfigureReadOnlyRootFilesystem(request, statefulSetSpec)
 	factory.ConfigureContainerUserID(statefulSetSpec)
+	factory.ConfigureMesh(statefulSetSpec)
+	factory.ConfigureServiceToken(statefulSetSpec)
+	factory.ConfigureTimeout(statefulSetSpec)
+
+	if err := factory.ConfigureRollout(statefulSetSpec); err != nil {
+		return nil, err
+	}
+
+	var functionLabels, functionAnnotations map[string]string
+	if request.Labels != nil {
+		functionLabels = *request.Labels
+	}
+	if request.Annotations != nil {
+		functionAnnotations = *request.Annotations
+	}
+	k8s.RecordFunctionMetadata(statefulSetSpec, functionLabels, functionAnnotations)
+	factory.Config.WatchdogEnv.RecordProcessEnv(statefulSetSpec)
+	k8s.ConfigureCertificate(statefulSetSpec, request.Service, functionAnnotations)
 
 	if err := factory.ConfigureSecrets(request, statefulSetSpec, existingSecrets); err != nil {
 		return nil, err
@@ -231,13 +401,22 @@ func makeStatefulSetSpec(request types.FunctionDeployment, existingSecrets map[s
 	return statefulSetSpec, nil
 }
 
-
 func makeServiceSpec(request types.FunctionDeployment, factory k8s.FunctionFactory) (*corev1.Service, error) {
 	annotations, err := buildAnnotations(request)
 	if err != nil {
 		return nil, err
 	}
 
+	port, err := k8s.FunctionPort(annotations, factory.Config.RuntimeHTTPPort)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels map[string]string
+	if request.Labels != nil {
+		labels = factory.Config.CostAllocationLabels(*request.Labels)
+	}
+
 	serviceSpec := &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Service",
@@ -246,6 +425,7 @@ func makeServiceSpec(request types.FunctionDeployment, factory k8s.FunctionFacto
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        request.Service,
 			Annotations: annotations,
+			Labels:      labels,
 		},
 		Spec: corev1.ServiceSpec{
 			Type: corev1.ServiceTypeClusterIP,
@@ -259,7 +439,7 @@ func makeServiceSpec(request types.FunctionDeployment, factory k8s.FunctionFacto
 					Port:     factory.Config.RuntimeHTTPPort,
 					TargetPort: intstr.IntOrString{
 						Type:   intstr.Int,
-						IntVal: factory.Config.RuntimeHTTPPort,
+						IntVal: port,
 					},
 				},
 			},
@@ -270,11 +450,13 @@ func makeServiceSpec(request types.FunctionDeployment, factory k8s.FunctionFacto
 }
 
 func buildAnnotations(request types.FunctionDeployment) (map[string]string, error) {
-	var annotations map[string]string
+	// the request is copied so that the keys of the function can be recorded without
+	// those added by the provider
+	annotations := map[string]string{}
 	if request.Annotations != nil {
-		annotations = *request.Annotations
-	} else {
-		annotations = map[string]string{}
+		for k, v := range *request.Annotations {
+			annotations[k] = v
+		}
 	}
 
 	if v, ok := annotations["topic"]; ok {
@@ -289,18 +471,16 @@ func buildAnnotations(request types.FunctionDeployment) (map[string]string, erro
 		}
 	}
 
-	if _, ok := annotations["prometheus.io.scrape"]; !ok {
-		annotations["prometheus.io.scrape"] = "false"
-	}
+	k8s.DefaultScrapeAnnotation(annotations)
 	return annotations, nil
 }
 
-func buildEnvVars(request *types.FunctionDeployment) []corev1.EnvVar {
+func buildEnvVars(request *types.FunctionDeployment, processEnv string) []corev1.EnvVar {
 	envVars := []corev1.EnvVar{}
 
 	if len(request.EnvProcess) > 0 {
 		envVars = append(envVars, corev1.EnvVar{
-			Name:  k8s.EnvProcessName,
+			Name:  processEnv,
 			Value: request.EnvProcess,
 		})
 	}
@@ -323,22 +503,6 @@ func int32p(i int32) *int32 {
 	return &i
 }
 
-func createSelector(constraints []string) map[string]string {
-	selector := make(map[string]string)
-
-	if len(constraints) > 0 {
-		for _, constraint := range constraints {
-			parts := strings.Split(constraint, "=")
-
-			if len(parts) == 2 {
-				selector[parts[0]] = parts[1]
-			}
-		}
-	}
-
-	return selector
-}
-
 func createResources(request types.FunctionDeployment) (*corev1.ResourceRequirements, error) {
 	resources := &corev1.ResourceRequirements{
 		Limits:   corev1.ResourceList{},
@@ -389,7 +553,7 @@ func getMinReplicaCount(labels map[string]string) *int32 {
 			return int32p(int32(minReplicas))
 		}
 
-		log.Println(err)
+		logging.Default().V(2).Info("Ignoring invalid minimum replicas", "value", value)
 	}
 
 	return nil
@@ -4,13 +4,22 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/openfaas/faas-netes/pkg/k8s"
 	types "github.com/openfaas/faas-provider/types"
 	"k8s.io/client-go/kubernetes/fake"
 
+	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func Test_buildAnnotations_Empty_In_CreateRequest(t *testing.T) {
@@ -163,7 +172,7 @@ func Test_buildEnvVars_NoSortedKeys(t *testing.T) {
 		EnvVars: inputEnvs,
 	}
 
-	coreEnvs := buildEnvVars(&function)
+	coreEnvs := buildEnvVars(&function, k8s.EnvProcessName)
 
 	if len(coreEnvs) != 0 {
 		t.Errorf("want: %d env-vars, got: %d", 0, len(coreEnvs))
@@ -184,7 +193,7 @@ func Test_buildEnvVars_TwoSortedKeys(t *testing.T) {
 		EnvVars: inputEnvs,
 	}
 
-	coreEnvs := buildEnvVars(&function)
+	coreEnvs := buildEnvVars(&function, k8s.EnvProcessName)
 
 	if coreEnvs[0].Name != firstKey {
 		t.Errorf("first want: %s, got: %s", firstKey, coreEnvs[0].Name)
@@ -209,7 +218,7 @@ func Test_buildEnvVars_FourSortedKeys(t *testing.T) {
 		EnvVars: inputEnvs,
 	}
 
-	coreEnvs := buildEnvVars(&function)
+	coreEnvs := buildEnvVars(&function, k8s.EnvProcessName)
 
 	if coreEnvs[0].Name != firstKey {
 		t.Errorf("first want: %s, got: %s", firstKey, coreEnvs[0].Name)
@@ -231,3 +240,154 @@ func Test_buildEnvVars_FourSortedKeys(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_makeServiceSpec_CostLabels(t *testing.T) {
+	factory := k8s.NewFunctionFactory(fake.NewSimpleClientset(), k8s.DeploymentConfig{
+		CostLabels: []string{"team", "project"},
+	}, nil)
+
+	request := types.FunctionDeployment{
+		Service: "figlet",
+		Labels:  &map[string]string{"team": "payments", "com.openfaas.scale.min": "2"},
+	}
+
+	service, err := makeServiceSpec(request, factory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(service.Labels) != 1 || service.Labels["team"] != "payments" {
+		t.Errorf("want only the team label on the Service, got %v", service.Labels)
+	}
+}
+
+func Test_makeServiceSpec_AnnotatedPort(t *testing.T) {
+	factory := k8s.NewFunctionFactory(fake.NewSimpleClientset(), k8s.DeploymentConfig{
+		RuntimeHTTPPort: 8080,
+	}, nil)
+
+	request := types.FunctionDeployment{
+		Service:     "figlet",
+		Annotations: &map[string]string{k8s.AnnotationPort: "3000"},
+	}
+
+	service, err := makeServiceSpec(request, factory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	port := service.Spec.Ports[0]
+	if port.Port != 8080 || port.TargetPort.IntVal != 3000 {
+		t.Errorf("want port 8080 to target 3000, got %d to %d", port.Port, port.TargetPort.IntVal)
+	}
+}
+
+func Test_MakeDeployHandler_Wait(t *testing.T) {
+	cases := []struct {
+		name       string
+		ready      bool
+		wantStatus int
+	}{
+		{name: "ready", ready: true, wantStatus: http.StatusOK},
+		{name: "timeout", wantStatus: http.StatusAccepted},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if tc.ready {
+				// the name is checked before the StatefulSet is created
+				created := false
+				client.PrependReactor("create", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					created = true
+					return false, nil, nil
+				})
+				client.PrependReactor("get", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if !created {
+						return false, nil, nil
+					}
+					return true, &appsv1.StatefulSet{
+						ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+						Status:     appsv1.StatefulSetStatus{Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1},
+					}, nil
+				})
+			}
+			handler := MakeDeployHandler("openfaas-fn", newRollbackFactory(client))
+
+			body := `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0"}`
+			req := httptest.NewRequest(http.MethodPost, "/system/functions?wait=true&timeout=50ms", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+			var rollout k8s.RolloutStatus
+			if err := json.Unmarshal(rr.Body.Bytes(), &rollout); err != nil {
+				t.Fatalf("want a RolloutStatus, got %q", rr.Body.String())
+			}
+			if rollout.Ready != tc.ready {
+				t.Errorf("want ready to be %t, got %+v", tc.ready, rollout)
+			}
+		})
+	}
+}
+
+func Test_MakeDeployHandler_ErrorStatus(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "invalid JSON", body: `{"service":`, wantStatus: http.StatusBadRequest},
+		{name: "other namespace", body: `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0", "namespace": "team-b"}`, wantStatus: http.StatusBadRequest},
+		{name: "failed validation", body: `{"image": "ghcr.io/openfaas/figlet:0.2.0"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "missing secret", body: `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0", "secrets": ["api-key"]}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "already exists", body: `{"service": "nodeinfo", "image": "ghcr.io/openfaas/nodeinfo:0.2.0"}`, wantStatus: http.StatusConflict},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(&appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "nodeinfo", Namespace: "openfaas-fn"},
+			})
+			handler := MakeDeployHandler("openfaas-fn", newRollbackFactory(client))
+
+			req := httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+
+			var body ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Status != tc.wantStatus {
+				t.Errorf("want an ErrorResponse with status %d, got %q", tc.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func Test_MakeDeployHandler_NameCollision(t *testing.T) {
+	client := fake.NewSimpleClientset(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", Labels: map[string]string{"app": "database"}},
+	})
+	handler := MakeDeployHandler("openfaas-fn", newRollbackFactory(client))
+
+	body := `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0"}`
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body)))
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("want status %d, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "StatefulSet openfaas-fn/figlet") {
+		t.Errorf("want the StatefulSet to be identified, got %s", rr.Body.String())
+	}
+
+	statefulset, err := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err != nil || statefulset.Labels["app"] != "database" {
+		t.Errorf("want the StatefulSet to be left alone, got %v %v", statefulset, err)
+	}
+}
@@ -4,14 +4,78 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// ProcessErrorReasons maps k8serrors.ReasonForError to http status codes
+// ErrorResponse is the body of every error returned by the function and secret
+// handlers, the reason uses the values of the Kubernetes API
+type ErrorResponse struct {
+	Status  int                 `json:"status"`
+	Reason  metav1.StatusReason `json:"reason"`
+	Message string              `json:"message"`
+}
+
+// statusError sets the HTTP status of an error that does not come from the
+// Kubernetes API, such as a request that failed validation
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// withStatus returns err with the HTTP status that respondError writes for it
+func withStatus(status int, err error) error {
+	return &statusError{status: status, err: err}
+}
+
+// badRequest is returned for a request that can not be read, such as a body that
+// is not valid JSON
+func badRequest(format string, a ...interface{}) error {
+	return withStatus(http.StatusBadRequest, fmt.Errorf(format, a...))
+}
+
+// invalid is returned for a request that was read but can not be applied, such
+// as a function that references a secret that does not exist
+func invalid(err error) error {
+	return withStatus(http.StatusUnprocessableEntity, fmt.Errorf("validation failed: %w", err))
+}
+
+// respondError writes err as an ErrorResponse with the status from
+// ProcessErrorReasons
+func respondError(w http.ResponseWriter, err error) {
+	status, reason := ProcessErrorReasons(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Status:  status,
+		Reason:  reason,
+		Message: err.Error(),
+	})
+}
+
+// ProcessErrorReasons maps k8serrors.ReasonForError to http status codes, the
+// status set with withStatus takes precedence
 func ProcessErrorReasons(err error) (int, metav1.StatusReason) {
+	var withStatus *statusError
+	if errors.As(err, &withStatus) {
+		return withStatus.status, reasonForStatus(withStatus.status)
+	}
+
 	reason := k8serrors.ReasonForError(err)
 	switch reason {
 	case metav1.StatusReasonGone, metav1.StatusReasonNotFound:
@@ -32,3 +96,24 @@ func ProcessErrorReasons(err error) (int, metav1.StatusReason) {
 		return http.StatusInternalServerError, metav1.StatusReasonInternalError
 	}
 }
+
+func reasonForStatus(status int) metav1.StatusReason {
+	switch status {
+	case http.StatusBadRequest:
+		return metav1.StatusReasonBadRequest
+	case http.StatusForbidden:
+		return metav1.StatusReasonForbidden
+	case http.StatusNotFound:
+		return metav1.StatusReasonNotFound
+	case http.StatusMethodNotAllowed:
+		return metav1.StatusReasonMethodNotAllowed
+	case http.StatusConflict:
+		return metav1.StatusReasonConflict
+	case http.StatusUnprocessableEntity:
+		return metav1.StatusReasonInvalid
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return metav1.StatusReasonTimeout
+	default:
+		return metav1.StatusReasonInternalError
+	}
+}
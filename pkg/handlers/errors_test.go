@@ -4,8 +4,11 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -36,3 +39,73 @@ func Test_ConflictErrorReason(t *testing.T) {
 		t.Errorf("Unexpected default reason: %s", reason)
 	}
 }
+
+func Test_respondError(t *testing.T) {
+	gr := schema.GroupResource{Group: "apps", Resource: "statefulsets"}
+
+	cases := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantReason metav1.StatusReason
+	}{
+		{
+			name:       "not found from the API",
+			err:        fmt.Errorf("unable to lookup: %w", k8serrors.NewNotFound(gr, "figlet")),
+			wantStatus: http.StatusNotFound,
+			wantReason: metav1.StatusReasonNotFound,
+		},
+		{
+			name:       "already exists from the API",
+			err:        k8serrors.NewAlreadyExists(gr, "figlet"),
+			wantStatus: http.StatusConflict,
+			wantReason: metav1.StatusReasonAlreadyExists,
+		},
+		{
+			name:       "bad request",
+			err:        badRequest("namespace must be: %s", "openfaas-fn"),
+			wantStatus: http.StatusBadRequest,
+			wantReason: metav1.StatusReasonBadRequest,
+		},
+		{
+			name:       "failed validation",
+			err:        invalid(errors.New("service: is required")),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantReason: metav1.StatusReasonInvalid,
+		},
+		{
+			name:       "status set on a wrapped error",
+			err:        fmt.Errorf("unable update StatefulSet: %w", invalid(errors.New("bad constraint"))),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantReason: metav1.StatusReasonInvalid,
+		},
+		{
+			name:       "unknown error",
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantReason: metav1.StatusReasonInternalError,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondError(w, tc.err)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status %d, got %d", tc.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("want a JSON content type, got %q", got)
+			}
+
+			var body ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("want a JSON body, got %q: %s", w.Body.String(), err)
+			}
+			if body.Status != tc.wantStatus || body.Reason != tc.wantReason || body.Message != tc.err.Error() {
+				t.Errorf("want %d %s %q, got %+v", tc.wantStatus, tc.wantReason, tc.err.Error(), body)
+			}
+		})
+	}
+}
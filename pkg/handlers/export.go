@@ -0,0 +1,106 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+)
+
+// MakeExportHandler renders the functions that were deployed through the REST API as
+// Function custom resources, so that they can be committed to a git repository and
+// managed by the operator. The manifests are returned as one YAML stream, a single
+// function is exported with the name query parameter. Functions that are already
+// owned by a Function resource are skipped.
+func MakeExportHandler(defaultNamespace string, statefulSetLister v1.StatefulSetLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		lookupNamespace := defaultNamespace
+		if namespace := q.Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("namespace", lookupNamespace)
+
+		var statefulsets []*appsv1.StatefulSet
+		if name := q.Get("name"); len(name) > 0 {
+			item, err := statefulSetLister.StatefulSets(lookupNamespace).Get(name)
+			if err != nil {
+				if errors.IsNotFound(err) {
+					respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s.%s not found", name, lookupNamespace)))
+					return
+				}
+				logger.Error(err, "Unable to get function", "function", name)
+				respondError(w, err)
+				return
+			}
+			if _, ok := item.Spec.Template.Labels["faas_function"]; !ok {
+				respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s.%s not found", name, lookupNamespace)))
+				return
+			}
+			statefulsets = append(statefulsets, item)
+		} else {
+			req, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+			if err != nil {
+				respondError(w, err)
+				return
+			}
+
+			statefulsets, err = statefulSetLister.StatefulSets(lookupNamespace).List(labels.NewSelector().Add(*req))
+			if err != nil {
+				logger.Error(err, "Unable to list functions")
+				respondError(w, err)
+				return
+			}
+		}
+
+		sort.Slice(statefulsets, func(i, j int) bool {
+			return statefulsets[i].Name < statefulsets[j].Name
+		})
+
+		var out bytes.Buffer
+		for _, item := range statefulsets {
+			if k8s.IsOwnedByFunction(*item) {
+				continue
+			}
+
+			function := k8s.AsFunction(*item)
+			if function == nil {
+				continue
+			}
+
+			manifest, err := yaml.Marshal(function)
+			if err != nil {
+				logger.Error(err, "Unable to marshal function", "function", item.Name)
+				respondError(w, err)
+				return
+			}
+
+			out.WriteString("---\n")
+			out.Write(manifest)
+		}
+
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(out.Bytes())
+	}
+}
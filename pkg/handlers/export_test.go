@@ -0,0 +1,107 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_MakeExportHandler_RoundTrip(t *testing.T) {
+	request := types.FunctionDeployment{
+		Service:                "figlet",
+		Image:                  "ghcr.io/openfaas/figlet:latest",
+		EnvProcess:             "figlet",
+		EnvVars:                map[string]string{"write_debug": "true"},
+		Constraints:            []string{"kubernetes.io/arch=arm64"},
+		Labels:                 &map[string]string{"com.openfaas.scale.min": "2"},
+		Annotations:            &map[string]string{"topic": "cron"},
+		Secrets:                []string{"api-key"},
+		Limits:                 &types.FunctionResources{Memory: "128Mi"},
+		ReadOnlyRootFilesystem: true,
+	}
+
+	factory := k8s.NewFunctionFactory(fake.NewSimpleClientset(), k8s.DeploymentConfig{
+		LivenessProbe:  &k8s.ProbeConfig{},
+		ReadinessProbe: &k8s.ProbeConfig{},
+	}, nil)
+	existingSecrets := map[string]*corev1.Secret{"api-key": {Type: corev1.SecretTypeOpaque}}
+
+	statefulset, err := makeStatefulSetSpec(request, existingSecrets, factory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	statefulset.Namespace = "openfaas-fn"
+
+	owned := statefulset.DeepCopy()
+	owned.Name = "managed"
+	owned.OwnerReferences = []metav1.OwnerReference{{APIVersion: "openfaas.com/v1", Kind: "Function", Name: "managed"}}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(statefulset)
+	indexer.Add(owned)
+
+	handler := MakeExportHandler("openfaas-fn", appslister.NewStatefulSetLister(indexer))
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/system/functions/export", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	documents := strings.Split(strings.TrimPrefix(w.Body.String(), "---\n"), "---\n")
+	if len(documents) != 1 {
+		t.Fatalf("want the function that is owned by a Function to be skipped, got %d documents", len(documents))
+	}
+
+	function := faasv1.Function{}
+	if err := yaml.UnmarshalStrict([]byte(documents[0]), &function); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if function.Kind != "Function" || function.APIVersion != "openfaas.com/v1" || function.Namespace != "openfaas-fn" {
+		t.Errorf("unexpected type or metadata: %+v", function.TypeMeta)
+	}
+
+	want := faasv1.FunctionSpec{
+		Name:                   "figlet",
+		Image:                  request.Image,
+		Handler:                "figlet",
+		Environment:            &map[string]string{"write_debug": "true"},
+		Constraints:            request.Constraints,
+		Labels:                 request.Labels,
+		Annotations:            &map[string]string{"topic": "cron", "prometheus.io.scrape": "false"},
+		Secrets:                request.Secrets,
+		Limits:                 &faasv1.FunctionResources{Memory: "128Mi"},
+		ReadOnlyRootFilesystem: true,
+	}
+	if !reflect.DeepEqual(want, function.Spec) {
+		got, _ := yaml.Marshal(function.Spec)
+		wanted, _ := yaml.Marshal(want)
+		t.Errorf("want spec\n%s\ngot\n%s", wanted, got)
+	}
+}
+
+func Test_MakeExportHandler_NotFound(t *testing.T) {
+	handler := MakeExportHandler("openfaas-fn", newReaderTestLister())
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/system/functions/export?name=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want status 404, got %d", w.Code)
+	}
+}
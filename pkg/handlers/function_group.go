@@ -0,0 +1,446 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/listers/apps/v1"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+)
+
+// GroupFunctionStatus is the status of one function of a FunctionGroup
+type GroupFunctionStatus struct {
+	Name  string `json:"name"`
+	Image string `json:"image,omitempty"`
+	// Found is false when the function of the group does not exist
+	Found           bool  `json:"found"`
+	Replicas        int32 `json:"replicas"`
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+	ReadyReplicas   int32 `json:"readyReplicas"`
+	Ready           bool  `json:"ready"`
+}
+
+// FunctionGroupStatus is the aggregate status of the functions of a FunctionGroup,
+// it is ready once every function is ready
+type FunctionGroupStatus struct {
+	Name      string                `json:"name"`
+	Namespace string                `json:"namespace"`
+	Revision  int64                 `json:"revision"`
+	Ready     bool                  `json:"ready"`
+	Functions []GroupFunctionStatus `json:"functions"`
+}
+
+// GroupFunctionChange is the outcome of deploying a FunctionGroup for one function
+type GroupFunctionChange struct {
+	Name string `json:"name"`
+	// Status is created, updated, deleted, failed or rolled back
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// FunctionGroupResult is the outcome of a deploy or a rollback of a FunctionGroup
+type FunctionGroupResult struct {
+	Name      string                `json:"name"`
+	Revision  int64                 `json:"revision"`
+	Functions []GroupFunctionChange `json:"functions"`
+}
+
+// groupChange is a function that was changed by a deploy of a group, prior and
+// priorService are nil when the function was created
+type groupChange struct {
+	name         string
+	prior        *appsv1.StatefulSet
+	priorService *corev1.Service
+}
+
+// MakeFunctionGroupHandler returns the status of a FunctionGroup with a GET,
+// deploys it with a PUT and deletes it and its functions with a DELETE.
+//
+// The functions of the group are deployed with deploy, or with update when they
+// already exist, and deleted with remove, so each one is checked like any other
+// function. When one of them
+// fails, those that were deployed before it are rolled back, new functions are
+// deleted and the StatefulSets, Services and resources of the others are restored.
+// Once all of them are deployed, the functions that were removed from the group
+// are deleted, a failure to delete one of them is returned as the status. The group
+// is kept in a ConfigMap with its previous revision, which is restored by the
+// rollback handler.
+func MakeFunctionGroupHandler(defaultNamespace string, factory k8s.FunctionFactory, statefulSetLister v1.StatefulSetLister, deploy, update, remove http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			getFunctionGroup(w, r, factory, statefulSetLister, lookupNamespace, name)
+		case http.MethodPut:
+			deployFunctionGroup(w, r, factory, lookupNamespace, name, deploy, update, remove)
+		case http.MethodDelete:
+			deleteFunctionGroup(w, r, factory, lookupNamespace, name, remove)
+		default:
+			respondError(w, withStatus(http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method)))
+		}
+	}
+}
+
+// MakeFunctionGroupRollbackHandler deploys the previous revision of a FunctionGroup
+// with a POST, in the same way as MakeFunctionGroupHandler deploys a new one. The
+// revision that is replaced becomes the previous one, so a second rollback undoes
+// the first.
+func MakeFunctionGroupRollbackHandler(defaultNamespace string, factory k8s.FunctionFactory, deploy, update, remove http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		ctx, cancel := factory.WithAPITimeout(r.Context())
+		current, previous, err := k8s.GetFunctionGroup(ctx, factory.Client, lookupNamespace, name)
+		cancel()
+		if err != nil {
+			respondError(w, functionGroupError(name, err))
+			return
+		}
+		if previous == nil {
+			respondError(w, withStatus(http.StatusConflict, fmt.Errorf("group %s has no previous revision", name)))
+			return
+		}
+
+		applyFunctionGroup(w, r, factory, lookupNamespace, *previous, current, deploy, update, remove)
+	}
+}
+
+func getFunctionGroup(w http.ResponseWriter, r *http.Request, factory k8s.FunctionFactory, statefulSetLister v1.StatefulSetLister, namespace, name string) {
+	ctx, cancel := factory.WithAPITimeout(r.Context())
+	group, _, err := k8s.GetFunctionGroup(ctx, factory.Client, namespace, name)
+	cancel()
+	if err != nil {
+		respondError(w, functionGroupError(name, err))
+		return
+	}
+
+	status := FunctionGroupStatus{
+		Name:      group.Name,
+		Namespace: namespace,
+		Revision:  group.Revision,
+		Ready:     true,
+		Functions: []GroupFunctionStatus{},
+	}
+	for _, function := range group.Functions {
+		functionStatus := GroupFunctionStatus{Name: function.Service}
+
+		statefulset, err := statefulSetLister.StatefulSets(namespace).Get(function.Service)
+		if err == nil && isFunction(statefulset) {
+			rollout := k8s.GetRolloutStatus(statefulset)
+			functionStatus.Found = true
+			functionStatus.Image = statefulset.Spec.Template.Spec.Containers[0].Image
+			functionStatus.Replicas = rollout.Replicas
+			functionStatus.UpdatedReplicas = rollout.UpdatedReplicas
+			functionStatus.ReadyReplicas = rollout.ReadyReplicas
+			functionStatus.Ready = rollout.Ready
+		}
+
+		status.Ready = status.Ready && functionStatus.Ready
+		status.Functions = append(status.Functions, functionStatus)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+func deployFunctionGroup(w http.ResponseWriter, r *http.Request, factory k8s.FunctionFactory, namespace, name string, deploy, update, remove http.HandlerFunc) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+
+	body, _ := io.ReadAll(r.Body)
+
+	group := k8s.FunctionGroup{}
+	if err := json.Unmarshal(body, &group); err != nil {
+		respondError(w, badRequest("failed to unmarshal group: %s", err))
+		return
+	}
+	if group.Name == "" {
+		group.Name = name
+	}
+	if group.Name != name {
+		respondError(w, badRequest("the name of the group must be: %s", name))
+		return
+	}
+	if group.Namespace != "" && group.Namespace != namespace {
+		respondError(w, badRequest("namespace must be: %s", namespace))
+		return
+	}
+	if err := k8s.ValidateFunctionGroup(group); err != nil {
+		respondError(w, badRequest("%s", err))
+		return
+	}
+
+	ctx, cancel := factory.WithAPITimeout(r.Context())
+	current, _, err := k8s.GetFunctionGroup(ctx, factory.Client, namespace, name)
+	cancel()
+	if err != nil && !k8s.IsNotFound(err) {
+		respondError(w, functionGroupError(name, err))
+		return
+	}
+
+	applyFunctionGroup(w, r, factory, namespace, group, current, deploy, update, remove)
+}
+
+// applyFunctionGroup deploys each function of the group, or none of them, then
+// saves the group with current as its previous revision and deletes the functions
+// that are no longer part of it
+func applyFunctionGroup(w http.ResponseWriter, r *http.Request, factory k8s.FunctionFactory, namespace string, group k8s.FunctionGroup, current *k8s.FunctionGroup, deploy, update, remove http.HandlerFunc) {
+	logger := logging.FromContext(r.Context()).WithValues("group", group.Name, "namespace", namespace)
+
+	group.Namespace = namespace
+	group.Revision = 1
+	if current != nil {
+		group.Revision = current.Revision + 1
+	}
+
+	result := FunctionGroupResult{Name: group.Name, Revision: group.Revision, Functions: []GroupFunctionChange{}}
+
+	var changes []groupChange
+	for _, member := range group.Members() {
+		prior, priorService, status, err := applyGroupMember(r, factory, group.Name, member, deploy, update)
+		if err != nil {
+			logger.Error(err, "Unable to deploy the function of the group", "function", member.Service)
+			result.Functions = append(rollbackFunctionGroup(logger, factory, namespace, changes),
+				GroupFunctionChange{Name: member.Service, Status: "failed", Error: err.Error()})
+			result.Revision = 0
+			if current != nil {
+				result.Revision = current.Revision
+			}
+			writeFunctionGroupResult(w, status, result)
+			return
+		}
+
+		changes = append(changes, groupChange{name: member.Service, prior: prior, priorService: priorService})
+		change := GroupFunctionChange{Name: member.Service, Status: "created"}
+		if prior != nil {
+			change.Status = "updated"
+		}
+		result.Functions = append(result.Functions, change)
+	}
+
+	ctx, cancel := factory.WithAPITimeout(r.Context())
+	err := k8s.SaveFunctionGroup(ctx, factory.Client, namespace, &group, current)
+	cancel()
+	if err != nil {
+		logger.Error(err, "Unable to save the group")
+		result.Functions = rollbackFunctionGroup(logger, factory, namespace, changes)
+		if current != nil {
+			result.Revision = current.Revision
+		}
+		writeFunctionGroupResult(w, http.StatusInternalServerError, result)
+		return
+	}
+
+	pruned, status := pruneFunctionGroup(r, logger, factory, namespace, group, remove)
+	result.Functions = append(result.Functions, pruned...)
+
+	logger.Info("Group deployed", "revision", group.Revision, "functions", len(group.Functions))
+	writeFunctionGroupResult(w, status, result)
+}
+
+// applyGroupMember deploys one function of a group, prior and priorService are the
+// StatefulSet and Service before it was updated, they are nil when the function was
+// created
+func applyGroupMember(r *http.Request, factory k8s.FunctionFactory, groupName string, member types.FunctionDeployment, deploy, update http.HandlerFunc) (*appsv1.StatefulSet, *corev1.Service, int, error) {
+	ctx, cancel := factory.WithAPITimeout(r.Context())
+	existing, err := factory.Client.AppsV1().StatefulSets(member.Namespace).Get(ctx, member.Service, metav1.GetOptions{})
+	cancel()
+
+	if k8s.IsNotFound(err) {
+		status, err := callFunctionHandler(r, http.MethodPost, member, deploy)
+		return nil, nil, status, err
+	}
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("unable to lookup function statefulset %s: %w", member.Service, err)
+	}
+
+	if !isFunction(existing) {
+		return nil, nil, http.StatusConflict, fmt.Errorf("statefulset %s is not a function", member.Service)
+	}
+	labels, _ := k8s.FunctionMetadata(existing)
+	if other := labels[k8s.LabelFunctionGroup]; other != "" && other != groupName {
+		return nil, nil, http.StatusConflict, fmt.Errorf("function %s belongs to group %s", member.Service, other)
+	}
+
+	ctx, cancel = factory.WithAPITimeout(r.Context())
+	service, err := factory.Client.CoreV1().Services(member.Namespace).Get(ctx, member.Service, metav1.GetOptions{})
+	cancel()
+	if k8s.IsNotFound(err) {
+		service = nil
+	} else if err != nil {
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("unable to lookup function service %s: %w", member.Service, err)
+	}
+
+	status, err := callFunctionHandler(r, http.MethodPut, member, update)
+	return existing, service, status, err
+}
+
+// rollbackFunctionGroup undoes the changes of a group in reverse order, a function
+// that was created is deleted and the StatefulSet, Service and resources of an
+// updated one are restored
+func rollbackFunctionGroup(logger logr.Logger, factory k8s.FunctionFactory, namespace string, changes []groupChange) []GroupFunctionChange {
+	rolledBack := make([]GroupFunctionChange, len(changes))
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+
+		var err error
+		if change.prior == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+			err = deleteFunction(ctx, factory.Config.APITimeout, namespace, factory.Client, factory.Dynamic, types.DeleteFunctionRequest{FunctionName: change.name})
+			cancel()
+		} else {
+			err = rollbackStatefulSet(factory, change.prior)
+			if err == nil && change.priorService != nil {
+				err = rollbackService(factory, change.priorService)
+			}
+		}
+
+		rolledBack[i] = GroupFunctionChange{Name: change.name, Status: "rolled back"}
+		if err != nil {
+			logger.Error(err, "Unable to roll back the function of the group", "function", change.name)
+			rolledBack[i] = GroupFunctionChange{Name: change.name, Status: "failed", Error: fmt.Sprintf("unable to roll back: %s", err)}
+		}
+	}
+	return rolledBack
+}
+
+// pruneFunctionGroup deletes the functions that are labelled with the group, but
+// that are no longer part of it. The status is the one of the first function that
+// could not be deleted, or http.StatusOK.
+func pruneFunctionGroup(r *http.Request, logger logr.Logger, factory k8s.FunctionFactory, namespace string, group k8s.FunctionGroup, remove http.HandlerFunc) ([]GroupFunctionChange, int) {
+	members, err := listGroupMembers(r.Context(), factory, namespace, group.Name)
+	if err != nil {
+		logger.Error(err, "Unable to list the functions of the group")
+		return nil, http.StatusInternalServerError
+	}
+
+	keep := map[string]bool{}
+	for _, function := range group.Functions {
+		keep[function.Service] = true
+	}
+
+	pruned := []GroupFunctionChange{}
+	status := http.StatusOK
+	for _, name := range members {
+		if keep[name] {
+			continue
+		}
+
+		change := GroupFunctionChange{Name: name, Status: "deleted"}
+		if deleteStatus, err := callFunctionHandler(r, http.MethodDelete, types.DeleteFunctionRequest{FunctionName: name}, remove); err != nil && deleteStatus != http.StatusNotFound {
+			logger.Error(err, "Unable to delete the function removed from the group", "function", name)
+			change = GroupFunctionChange{Name: name, Status: "failed", Error: err.Error()}
+			if status == http.StatusOK {
+				status = deleteStatus
+			}
+		}
+		pruned = append(pruned, change)
+	}
+	return pruned, status
+}
+
+func deleteFunctionGroup(w http.ResponseWriter, r *http.Request, factory k8s.FunctionFactory, namespace, name string, remove http.HandlerFunc) {
+	logger := logging.FromContext(r.Context()).WithValues("group", name, "namespace", namespace)
+
+	members, err := listGroupMembers(r.Context(), factory, namespace, name)
+	if err != nil {
+		logger.Error(err, "Unable to list the functions of the group")
+		respondError(w, err)
+		return
+	}
+
+	for _, member := range members {
+		if status, err := callFunctionHandler(r, http.MethodDelete, types.DeleteFunctionRequest{FunctionName: member}, remove); err != nil && status != http.StatusNotFound {
+			logger.Error(err, "Unable to delete the function of the group", "function", member)
+			respondError(w, withStatus(status, err))
+			return
+		}
+	}
+
+	ctx, cancel := factory.WithAPITimeout(r.Context())
+	defer cancel()
+	if err := k8s.DeleteFunctionGroup(ctx, factory.Client, namespace, name); err != nil {
+		// the functions of a group whose ConfigMap was removed are still deleted
+		if !k8s.IsNotFound(err) || len(members) == 0 {
+			respondError(w, functionGroupError(name, err))
+			return
+		}
+	}
+
+	logger.Info("Group deleted", "functions", len(members))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// listGroupMembers returns the names of the functions labelled with the group
+func listGroupMembers(ctx context.Context, factory k8s.FunctionFactory, namespace, name string) ([]string, error) {
+	ctx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+
+	statefulsets, err := factory.Client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: k8s.LabelFunctionGroup + "=" + name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, statefulset := range statefulsets.Items {
+		if isFunction(&statefulset) {
+			names = append(names, statefulset.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// functionGroupError returns the error of reading a FunctionGroup with its status
+func functionGroupError(name string, err error) error {
+	if k8s.IsNotFound(err) {
+		return withStatus(http.StatusNotFound, fmt.Errorf("group %s not found", name))
+	}
+	return err
+}
+
+func writeFunctionGroupResult(w http.ResponseWriter, status int, result FunctionGroupResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,352 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+)
+
+func newGroupStatefulSet(name, image string, labels map[string]string) *appsv1.StatefulSet {
+	statefulset := newArchiveStatefulSet(name, 1)
+	statefulset.Spec.Template.Spec.Containers[0].Image = image
+	for k, v := range labels {
+		statefulset.Labels[k] = v
+		statefulset.Spec.Template.Labels[k] = v
+	}
+	return statefulset
+}
+
+// groupHandlers stand in for the deploy, update and delete handlers, they change the
+// StatefulSets of the fake client and fail for the functions in fail
+type groupHandlers struct {
+	t      *testing.T
+	client *fake.Clientset
+	fail   map[string]bool
+	calls  []string
+}
+
+func (h *groupHandlers) deploy(w http.ResponseWriter, r *http.Request) {
+	request := h.read(r)
+	if h.fail[request.Service] {
+		respondError(w, invalid(io.EOF))
+		return
+	}
+
+	ctx := context.Background()
+	h.client.AppsV1().StatefulSets(request.Namespace).Create(ctx, newGroupStatefulSet(request.Service, request.Image, *request.Labels), metav1.CreateOptions{})
+	h.client.CoreV1().Services(request.Namespace).Create(ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: request.Service, Namespace: request.Namespace}}, metav1.CreateOptions{})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *groupHandlers) update(w http.ResponseWriter, r *http.Request) {
+	request := h.read(r)
+	if h.fail[request.Service] {
+		respondError(w, invalid(io.EOF))
+		return
+	}
+
+	ctx := context.Background()
+	h.client.AppsV1().StatefulSets(request.Namespace).Update(ctx, newGroupStatefulSet(request.Service, request.Image, *request.Labels), metav1.UpdateOptions{})
+	if service, err := h.client.CoreV1().Services(request.Namespace).Get(ctx, request.Service, metav1.GetOptions{}); err == nil {
+		service.Annotations = map[string]string{"image": request.Image}
+		h.client.CoreV1().Services(request.Namespace).Update(ctx, service, metav1.UpdateOptions{})
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *groupHandlers) remove(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	request := types.DeleteFunctionRequest{}
+	json.Unmarshal(body, &request)
+	h.calls = append(h.calls, r.Method+" "+request.FunctionName)
+	if h.fail[request.FunctionName] {
+		respondError(w, invalid(io.EOF))
+		return
+	}
+
+	if err := deleteFunction(r.Context(), 0, "openfaas-fn", h.client, nil, request); err != nil {
+		respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *groupHandlers) read(r *http.Request) types.FunctionDeployment {
+	body, _ := io.ReadAll(r.Body)
+	request := types.FunctionDeployment{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		h.t.Fatalf("unable to decode the request: %s", err)
+	}
+	h.calls = append(h.calls, r.Method+" "+request.Service)
+	return request
+}
+
+func (h *groupHandlers) groupRequest(method, path, body string) *httptest.ResponseRecorder {
+	factory := newRollbackFactory(h.client)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/system/group/{name}", MakeFunctionGroupHandler("openfaas-fn", factory, nil, h.deploy, h.update, h.remove))
+	router.HandleFunc("/system/group/{name}/rollback", MakeFunctionGroupRollbackHandler("openfaas-fn", factory, h.deploy, h.update, h.remove))
+
+	h.calls = nil
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rr
+}
+
+func Test_MakeFunctionGroupHandler_DeployAndRollback(t *testing.T) {
+	client := fake.NewSimpleClientset(newGroupStatefulSet("figlet", "figlet:0.1.0", nil))
+	h := &groupHandlers{t: t, client: client}
+
+	rr := h.groupRequest(http.MethodPut, "/system/group/shop", `{
+		"envVars": {"LOG_LEVEL": "info", "REGION": "eu"},
+		"secrets": ["db"],
+		"functions": [
+			{"service": "figlet", "image": "figlet:0.2.0"},
+			{"service": "nodeinfo", "image": "nodeinfo:0.1.0", "envVars": {"LOG_LEVEL": "debug"}}
+		]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if want := []string{"PUT figlet", "POST nodeinfo"}; !reflect.DeepEqual(h.calls, want) {
+		t.Errorf("want calls %v, got %v", want, h.calls)
+	}
+
+	current, previous, err := k8s.GetFunctionGroup(context.Background(), client, "openfaas-fn", "shop")
+	if err != nil {
+		t.Fatalf("want the group to be saved, got %s", err)
+	}
+	if current.Revision != 1 || previous != nil {
+		t.Errorf("want revision 1 without a previous revision, got %d and %v", current.Revision, previous)
+	}
+
+	nodeinfo, _ := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "nodeinfo", metav1.GetOptions{})
+	if nodeinfo.Labels[k8s.LabelFunctionGroup] != "shop" {
+		t.Errorf("want nodeinfo to be labelled with the group, got %v", nodeinfo.Labels)
+	}
+
+	// figlet is removed from the group, so it is deleted once nodeinfo is updated
+	rr = h.groupRequest(http.MethodPut, "/system/group/shop", `{"functions": [{"service": "nodeinfo", "image": "nodeinfo:0.2.0"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if want := []string{"PUT nodeinfo", "DELETE figlet"}; !reflect.DeepEqual(h.calls, want) {
+		t.Errorf("want calls %v, got %v", want, h.calls)
+	}
+
+	rr = h.groupRequest(http.MethodPost, "/system/group/shop/rollback", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if want := []string{"POST figlet", "PUT nodeinfo"}; !reflect.DeepEqual(h.calls, want) {
+		t.Errorf("want the first revision to be deployed again, got calls %v", h.calls)
+	}
+
+	current, previous, _ = k8s.GetFunctionGroup(context.Background(), client, "openfaas-fn", "shop")
+	if current.Revision != 3 || len(current.Functions) != 2 || previous == nil || previous.Revision != 2 {
+		t.Errorf("want revision 3 with both functions and revision 2 as the previous one, got %+v and %+v", current, previous)
+	}
+}
+
+func Test_MakeFunctionGroupHandler_Members(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	h := &groupHandlers{t: t, client: client}
+
+	requests := map[string]types.FunctionDeployment{}
+	router := mux.NewRouter()
+	router.HandleFunc("/system/group/{name}", MakeFunctionGroupHandler("openfaas-fn", newRollbackFactory(client), nil,
+		func(w http.ResponseWriter, r *http.Request) {
+			request := types.FunctionDeployment{}
+			json.NewDecoder(r.Body).Decode(&request)
+			requests[request.Service] = request
+			w.WriteHeader(http.StatusAccepted)
+		}, h.update, h.remove))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/system/group/shop", strings.NewReader(`{
+		"envVars": {"LOG_LEVEL": "info", "REGION": "eu"},
+		"secrets": ["db"],
+		"functions": [{"service": "nodeinfo", "image": "nodeinfo", "envVars": {"LOG_LEVEL": "debug"}, "secrets": ["api-key"]}]}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	nodeinfo := requests["nodeinfo"]
+	if want := map[string]string{"LOG_LEVEL": "debug", "REGION": "eu"}; !reflect.DeepEqual(nodeinfo.EnvVars, want) {
+		t.Errorf("want the environment of the group under that of the function %v, got %v", want, nodeinfo.EnvVars)
+	}
+	if want := []string{"api-key", "db"}; !reflect.DeepEqual(nodeinfo.Secrets, want) {
+		t.Errorf("want the secrets %v, got %v", want, nodeinfo.Secrets)
+	}
+	if nodeinfo.Namespace != "openfaas-fn" || (*nodeinfo.Labels)[k8s.LabelFunctionGroup] != "shop" {
+		t.Errorf("want the function in openfaas-fn with the label of the group, got %s and %v", nodeinfo.Namespace, nodeinfo.Labels)
+	}
+}
+
+func Test_MakeFunctionGroupHandler_RollsBackOnFailure(t *testing.T) {
+	client := fake.NewSimpleClientset(newGroupStatefulSet("figlet", "figlet:0.1.0", nil), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", Annotations: map[string]string{"image": "figlet:0.1.0"}},
+	})
+	h := &groupHandlers{t: t, client: client, fail: map[string]bool{"env": true}}
+
+	rr := h.groupRequest(http.MethodPut, "/system/group/shop", `{"functions": [
+		{"service": "figlet", "image": "figlet:0.2.0"},
+		{"service": "nodeinfo", "image": "nodeinfo:0.1.0"},
+		{"service": "env", "image": "env:0.1.0"}
+	]}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("want the status of the function that failed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	result := FunctionGroupResult{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unable to decode the response: %s", err)
+	}
+	statuses := map[string]string{}
+	for _, function := range result.Functions {
+		statuses[function.Name] = function.Status
+	}
+	if want := map[string]string{"figlet": "rolled back", "nodeinfo": "rolled back", "env": "failed"}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("want statuses %v, got %v", want, statuses)
+	}
+
+	ctx := context.Background()
+	figlet, _ := client.AppsV1().StatefulSets("openfaas-fn").Get(ctx, "figlet", metav1.GetOptions{})
+	if image := figlet.Spec.Template.Spec.Containers[0].Image; image != "figlet:0.1.0" {
+		t.Errorf("want the image of figlet to be restored, got %s", image)
+	}
+	service, _ := client.CoreV1().Services("openfaas-fn").Get(ctx, "figlet", metav1.GetOptions{})
+	if image := service.Annotations["image"]; image != "figlet:0.1.0" {
+		t.Errorf("want the Service of figlet to be restored, got %s", image)
+	}
+	if _, err := client.AppsV1().StatefulSets("openfaas-fn").Get(ctx, "nodeinfo", metav1.GetOptions{}); !k8s.IsNotFound(err) {
+		t.Errorf("want the new function to be deleted, got %v", err)
+	}
+	if _, _, err := k8s.GetFunctionGroup(ctx, client, "openfaas-fn", "shop"); !k8s.IsNotFound(err) {
+		t.Errorf("want the group not to be saved, got %v", err)
+	}
+}
+
+func Test_MakeFunctionGroupHandler_ReportsPruneFailure(t *testing.T) {
+	labels := map[string]string{k8s.LabelFunctionGroup: "shop"}
+	client := fake.NewSimpleClientset(newGroupStatefulSet("figlet", "figlet:0.1.0", labels), newGroupStatefulSet("env", "env:0.1.0", labels))
+	h := &groupHandlers{t: t, client: client, fail: map[string]bool{"env": true}}
+
+	rr := h.groupRequest(http.MethodPut, "/system/group/shop", `{"functions": [{"service": "figlet", "image": "figlet:0.2.0"}]}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("want the status of the function that could not be removed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	result := FunctionGroupResult{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unable to decode the response: %s", err)
+	}
+	if n := len(result.Functions); n != 2 || result.Functions[1].Name != "env" || result.Functions[1].Status != "failed" {
+		t.Errorf("want env to be reported as failed, got %+v", result.Functions)
+	}
+}
+
+func Test_MakeFunctionGroupHandler_Conflicts(t *testing.T) {
+	owned := newGroupStatefulSet("figlet", "figlet", map[string]string{k8s.LabelFunctionGroup: "blog"})
+	owned.Annotations = map[string]string{k8s.AnnotationFunctionLabels: k8s.LabelFunctionGroup}
+	foreign := newGroupStatefulSet("redis", "redis", nil)
+	delete(foreign.Labels, "faas_function")
+
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "function of another group", body: `{"functions": [{"service": "figlet", "image": "figlet"}]}`, want: http.StatusConflict},
+		{name: "statefulset of another workload", body: `{"functions": [{"service": "redis", "image": "redis"}]}`, want: http.StatusConflict},
+		{name: "duplicate functions", body: `{"functions": [{"service": "env", "image": "env"}, {"service": "env", "image": "env"}]}`, want: http.StatusBadRequest},
+		{name: "no functions", body: `{"functions": []}`, want: http.StatusBadRequest},
+		{name: "another name", body: `{"name": "blog", "functions": [{"service": "env", "image": "env"}]}`, want: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &groupHandlers{t: t, client: fake.NewSimpleClientset(owned.DeepCopy(), foreign.DeepCopy())}
+
+			rr := h.groupRequest(http.MethodPut, "/system/group/shop", tc.body)
+			if rr.Code != tc.want {
+				t.Errorf("want status %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func Test_MakeFunctionGroupHandler_StatusAndDelete(t *testing.T) {
+	ready := newGroupStatefulSet("figlet", "figlet:0.2.0", map[string]string{k8s.LabelFunctionGroup: "shop"})
+	ready.Status = appsv1.StatefulSetStatus{Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+
+	client := fake.NewSimpleClientset(ready.DeepCopy(), &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}})
+	group := &k8s.FunctionGroup{Name: "shop", Revision: 4, Functions: []types.FunctionDeployment{{Service: "figlet"}, {Service: "nodeinfo"}}}
+	if err := k8s.SaveFunctionGroup(context.Background(), client, "openfaas-fn", group, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(ready)
+
+	h := &groupHandlers{t: t, client: client}
+	router := mux.NewRouter()
+	router.HandleFunc("/system/group/{name}", MakeFunctionGroupHandler("openfaas-fn", newRollbackFactory(client), v1.NewStatefulSetLister(indexer), h.deploy, h.update, h.remove))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/system/group/shop", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	status := FunctionGroupStatus{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("unable to decode the status: %s", err)
+	}
+	if status.Revision != 4 || status.Ready || len(status.Functions) != 2 {
+		t.Fatalf("want revision 4 that is not ready with 2 functions, got %+v", status)
+	}
+	if figlet := status.Functions[0]; !figlet.Found || !figlet.Ready || figlet.Image != "figlet:0.2.0" {
+		t.Errorf("want figlet to be ready, got %+v", figlet)
+	}
+	if nodeinfo := status.Functions[1]; nodeinfo.Found || nodeinfo.Ready {
+		t.Errorf("want nodeinfo to be missing, got %+v", nodeinfo)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/system/group/shop", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("want status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	if want := []string{"DELETE figlet"}; !reflect.DeepEqual(h.calls, want) {
+		t.Errorf("want calls %v, got %v", want, h.calls)
+	}
+	if _, _, err := k8s.GetFunctionGroup(context.Background(), client, "openfaas-fn", "shop"); !k8s.IsNotFound(err) {
+		t.Errorf("want the group to be deleted, got %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/system/group/shop", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want status %d after the delete, got %d", http.StatusNotFound, rr.Code)
+	}
+}
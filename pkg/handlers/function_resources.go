@@ -0,0 +1,141 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// syncFunctionResources applies the objects that a function asks for with its
+// annotations, such as a KEDA ScaledObject, an Ingress or an egress NetworkPolicy,
+// and removes the ones it no longer sets. They are owned by the StatefulSet, so
+// that they are removed together with it.
+//
+// previous is the StatefulSet before an update, or nil for a new function. An
+// object is only synced when the function sets its annotation now or did before,
+// so that the optional APIs are not called by functions that do not use them.
+func syncFunctionResources(ctx context.Context, factory k8s.FunctionFactory, statefulset *appsv1.StatefulSet, annotations, labels map[string]string, previous *appsv1.StatefulSet) error {
+	owner := k8s.StatefulSetOwner(statefulset)
+	costLabels := factory.Config.CostAllocationLabels(statefulset.Labels)
+
+	var previousAnnotations map[string]string
+	if previous != nil {
+		_, previousAnnotations = k8s.FunctionMetadata(previous)
+	}
+	uses := func(key string) bool {
+		_, ok := annotations[key]
+		_, had := previousAnnotations[key]
+		return ok || had
+	}
+
+	if uses(k8s.AnnotationKedaType) {
+		scaledObjectCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		if err := k8s.SyncScaledObject(scaledObjectCtx, factory.Dynamic, statefulset.Name, statefulset.Namespace,
+			annotations, labels, owner, costLabels); err != nil {
+			return fmt.Errorf("unable to apply ScaledObject: %w", err)
+		}
+	}
+
+	if uses(k8s.AnnotationPrometheusQuery) {
+		hpaCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		if err := k8s.SyncHPA(hpaCtx, factory.Client, statefulset.Name, statefulset.Namespace,
+			annotations, labels, owner, costLabels); err != nil {
+			return fmt.Errorf("unable to apply HorizontalPodAutoscaler: %w", err)
+		}
+	}
+
+	if uses(k8s.AnnotationRouteHost) {
+		routeCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		if err := k8s.SyncRoute(routeCtx, factory.Dynamic, statefulset.Name, statefulset.Namespace,
+			factory.Config.HTTPPort(), annotations, owner, costLabels); err != nil {
+			return fmt.Errorf("unable to apply route: %w", err)
+		}
+	}
+
+	if uses(k8s.AnnotationTLSIssuer) {
+		certificateCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		if err := k8s.SyncCertificate(certificateCtx, factory.Dynamic, factory.Client, statefulset.Name, statefulset.Namespace,
+			annotations, owner, costLabels); err != nil {
+			return fmt.Errorf("unable to apply Certificate: %w", err)
+		}
+	}
+
+	if uses(k8s.AnnotationEgress) {
+		egressCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		if err := k8s.SyncEgressPolicy(egressCtx, factory.Dynamic, statefulset.Name, statefulset.Namespace,
+			annotations, owner, costLabels); err != nil {
+			return fmt.Errorf("unable to apply egress policy: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteFunctionResources removes the objects that were created from the annotations
+// of a function. The garbage collector would remove them with the StatefulSet, they
+// are deleted here so that a function of the same name does not find them.
+func deleteFunctionResources(ctx context.Context, apiTimeout time.Duration, functionNamespace string, clientset kubernetes.Interface, dynamicClient dynamic.Interface, functionName string) error {
+	hpaCtx, cancel := k8s.WithAPITimeout(ctx, apiTimeout)
+	defer cancel()
+	if err := k8s.DeleteHPA(hpaCtx, clientset, functionNamespace, functionName); err != nil {
+		return fmt.Errorf("error deleting function's HorizontalPodAutoscaler: %w", err)
+	}
+
+	if dynamicClient == nil {
+		return nil
+	}
+
+	scaledObjectCtx, cancel := k8s.WithAPITimeout(ctx, apiTimeout)
+	defer cancel()
+	if err := k8s.DeleteOwnedResource(scaledObjectCtx, dynamicClient, k8s.ScaledObjectResource, functionNamespace, functionName, functionName); err != nil {
+		return fmt.Errorf("error deleting function's ScaledObject: %w", err)
+	}
+
+	for _, resource := range k8s.RouteResources {
+		routeCtx, cancel := k8s.WithAPITimeout(ctx, apiTimeout)
+		err := k8s.DeleteOwnedResource(routeCtx, dynamicClient, resource, functionNamespace, functionName, functionName)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error deleting function's route: %w", err)
+		}
+	}
+
+	certificateCtx, cancel := k8s.WithAPITimeout(ctx, apiTimeout)
+	defer cancel()
+	if err := k8s.DeleteCertificate(certificateCtx, dynamicClient, clientset, functionNamespace, functionName); err != nil {
+		return fmt.Errorf("error deleting function's Certificate: %w", err)
+	}
+
+	for _, resource := range k8s.EgressResources {
+		egressCtx, cancel := k8s.WithAPITimeout(ctx, apiTimeout)
+		err := k8s.DeleteOwnedResource(egressCtx, dynamicClient, resource, functionNamespace, k8s.EgressPolicyName(functionName), functionName)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error deleting function's egress policy: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// requestLabels returns the labels of a deploy request
+func requestLabels(request types.FunctionDeployment) map[string]string {
+	if request.Labels == nil {
+		return nil
+	}
+	return *request.Labels
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newFunctionResource(resource schema.GroupVersionResource, kind, name string, owners []metav1.OwnerReference) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion(resource.GroupVersion().String())
+	object.SetKind(kind)
+	object.SetName(name)
+	object.SetNamespace("openfaas-fn")
+	object.SetOwnerReferences(owners)
+	return object
+}
+
+func newFunctionResourcesDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		k8s.ScaledObjectResource:        "ScaledObjectList",
+		k8s.IngressResource:             "IngressList",
+		k8s.HTTPRouteResource:           "HTTPRouteList",
+		k8s.CertificateResource:         "CertificateList",
+		k8s.NetworkPolicyResource:       "NetworkPolicyList",
+		k8s.CiliumNetworkPolicyResource: "CiliumNetworkPolicyList",
+	}, objects...)
+}
+
+func forbidAll(action k8stesting.Action) (bool, runtime.Object, error) {
+	return true, nil, k8serrors.NewForbidden(action.GetResource().GroupResource(), "", nil)
+}
+
+func Test_syncFunctionResources_SkipsUnusedAPIs(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	dynamicClient := newFunctionResourcesDynamicClient()
+	client.PrependReactor("*", "*", forbidAll)
+	dynamicClient.PrependReactor("*", "*", forbidAll)
+
+	factory := k8s.NewFunctionFactory(client, k8s.DeploymentConfig{}, nil)
+	factory.Dynamic = dynamicClient
+
+	statefulset := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}}
+	if err := syncFunctionResources(context.Background(), factory, statefulset, map[string]string{}, nil, statefulset.DeepCopy()); err != nil {
+		t.Fatalf("want no error for a function without the annotations, got: %s", err)
+	}
+	if actions := len(client.Actions()) + len(dynamicClient.Actions()); actions != 0 {
+		t.Errorf("want no calls to the API, got %d", actions)
+	}
+}
+
+func Test_syncFunctionResources_RemovesRouteOfPreviousAnnotation(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+	dynamicClient := newFunctionResourcesDynamicClient(
+		newFunctionResource(k8s.IngressResource, "Ingress", "figlet", []metav1.OwnerReference{owner}),
+	)
+
+	factory := k8s.NewFunctionFactory(fake.NewSimpleClientset(), k8s.DeploymentConfig{}, nil)
+	factory.Dynamic = dynamicClient
+
+	statefulset := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}}
+	previous := statefulset.DeepCopy()
+	previous.Annotations = map[string]string{k8s.AnnotationRouteHost: "figlet.example.com"}
+
+	if err := syncFunctionResources(context.Background(), factory, statefulset, map[string]string{}, nil, previous); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := dynamicClient.Resource(k8s.IngressResource).Namespace("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("want the Ingress to be removed when the host annotation is removed")
+	}
+}
+
+func Test_deleteFunctionResources_IgnoresForbidden(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	dynamicClient := newFunctionResourcesDynamicClient()
+	client.PrependReactor("*", "*", forbidAll)
+	dynamicClient.PrependReactor("*", "*", forbidAll)
+
+	if err := deleteFunctionResources(context.Background(), k8s.DefaultAPITimeout, "openfaas-fn", client, dynamicClient, "figlet"); err != nil {
+		t.Errorf("want the optional APIs to be skipped without access, got: %s", err)
+	}
+}
+
+func Test_deleteFunctionResources(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		k8s.ScaledObjectResource: "ScaledObjectList",
+		k8s.IngressResource:      "IngressList",
+		k8s.HTTPRouteResource:    "HTTPRouteList",
+		k8s.CertificateResource:  "CertificateList",
+	},
+		newFunctionResource(k8s.ScaledObjectResource, "ScaledObject", "figlet", []metav1.OwnerReference{owner}),
+		newFunctionResource(k8s.IngressResource, "Ingress", "figlet", []metav1.OwnerReference{owner}),
+		newFunctionResource(k8s.HTTPRouteResource, "HTTPRoute", "figlet", nil),
+		newFunctionResource(k8s.CertificateResource, "Certificate", "figlet-serving-cert", []metav1.OwnerReference{owner}),
+	)
+
+	if err := deleteFunctionResources(context.Background(), k8s.DefaultAPITimeout, "openfaas-fn", fake.NewSimpleClientset(), dynamicClient, "figlet"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, tc := range []struct {
+		resource    schema.GroupVersionResource
+		name        string
+		wantDeleted bool
+	}{
+		{k8s.ScaledObjectResource, "figlet", true},
+		{k8s.IngressResource, "figlet", true},
+		{k8s.HTTPRouteResource, "figlet", false},
+		{k8s.CertificateResource, "figlet-serving-cert", true},
+	} {
+		_, err := dynamicClient.Resource(tc.resource).Namespace("openfaas-fn").Get(context.Background(), tc.name, metav1.GetOptions{})
+		if deleted := err != nil; deleted != tc.wantDeleted {
+			t.Errorf("%s: want deleted %v, got %v", tc.resource.Resource, tc.wantDeleted, deleted)
+		}
+	}
+}
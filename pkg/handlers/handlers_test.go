@@ -6,6 +6,7 @@ package handlers
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	types "github.com/openfaas/faas-provider/types"
@@ -18,8 +19,8 @@ func Test_validateService_ValidCharacters(t *testing.T) {
 	}{
 		{"lower", "abz"},
 		{"includes hyphen", "test-function"},
-		{"can start with a digit", "1abz"},
 		{"can end with a digit", "abz1"},
+		{"52 characters", strings.Repeat("a", 52)},
 	}
 
 	for _, testCase := range cases {
@@ -46,6 +47,8 @@ func Test_validateService_InvalidCharacters(t *testing.T) {
 		{"includes underscore", "test_function"},
 		{"ends with hyphen", "testfunction-"},
 		{"starts with hyphen", "-testfunction"},
+		{"starts with a digit", "1abz"},
+		{"more than 52 characters", strings.Repeat("a", 53)},
 	}
 
 	for _, testCase := range cases {
@@ -0,0 +1,44 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/openfaas/faas-netes/pkg/imagepolicy"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// verifyImage checks the image against the image policy of the factory, when one is
+// configured. Images that are denied by the policy are rejected as forbidden.
+func verifyImage(ctx context.Context, factory k8s.FunctionFactory, namespace, image string) error {
+	if factory.ImageVerifier == nil {
+		return nil
+	}
+
+	if err := factory.ImageVerifier.Verify(ctx, namespace, image); err != nil {
+		if errors.Is(err, imagepolicy.ErrDenied) {
+			return withStatus(http.StatusForbidden, fmt.Errorf("image %s is not allowed in namespace %s: %w", image, namespace, err))
+		}
+		return fmt.Errorf("unable to verify image %s: %w", image, err)
+	}
+
+	return nil
+}
+
+// withScanBypass returns the context of the request, which asks for the
+// vulnerability scan of the image to be skipped for the basic auth user when the
+// function has the scan bypass annotation
+func withScanBypass(r *http.Request, request types.FunctionDeployment) context.Context {
+	if request.Annotations == nil || (*request.Annotations)[imagepolicy.AnnotationScanBypass] != "true" {
+		return r.Context()
+	}
+
+	user, _, _ := r.BasicAuth()
+	return imagepolicy.WithScanBypass(r.Context(), user)
+}
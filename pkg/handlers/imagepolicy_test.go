@@ -0,0 +1,75 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/imagepolicy"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type denyImages struct {
+	allowed string
+}
+
+func (d denyImages) Verify(ctx context.Context, namespace, image string) error {
+	if image == d.allowed {
+		return nil
+	}
+	return fmt.Errorf("no signatures found: %w", imagepolicy.ErrDenied)
+}
+
+func Test_MakeDeployHandler_RejectsDeniedImage(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	factory := k8s.NewFunctionFactory(client, k8s.DeploymentConfig{
+		LivenessProbe:  &k8s.ProbeConfig{},
+		ReadinessProbe: &k8s.ProbeConfig{},
+	}, nil)
+	factory.ImageVerifier = denyImages{allowed: "ghcr.io/openfaas/figlet:signed"}
+
+	handler := MakeDeployHandler("openfaas-fn", factory)
+
+	// the denied image is deployed first, the allowed one would otherwise
+	// create the function and the second deploy would be a conflict
+	for _, tc := range []struct {
+		image string
+		want  int
+	}{
+		{"ghcr.io/openfaas/figlet:unsigned", http.StatusForbidden},
+		{"ghcr.io/openfaas/figlet:signed", http.StatusAccepted},
+	} {
+		client.ClearActions()
+		body := fmt.Sprintf(`{"service":"figlet","image":%q}`, tc.image)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body)))
+
+		if w.Code != tc.want {
+			t.Errorf("%s: want status %d, got %d: %s", tc.image, tc.want, w.Code, w.Body.String())
+		}
+	}
+
+	list, _ := client.AppsV1().StatefulSets("openfaas-fn").List(context.Background(), metav1.ListOptions{})
+	if len(list.Items) != 1 || list.Items[0].Spec.Template.Spec.Containers[0].Image != "ghcr.io/openfaas/figlet:signed" {
+		t.Errorf("want only the signed image to be deployed, got %d statefulsets", len(list.Items))
+	}
+}
+
+func Test_verifyImage_RegistryError(t *testing.T) {
+	factory := k8s.FunctionFactory{ImageVerifier: imagepolicy.NewVerifier(&imagepolicy.Policy{
+		Default: imagepolicy.NamespacePolicy{Signatures: &imagepolicy.SignaturePolicy{}},
+	}, nil)}
+
+	err := verifyImage(context.Background(), factory, "openfaas-fn", "INVALID::ref")
+	if status, _ := ProcessErrorReasons(err); err == nil || status != http.StatusInternalServerError {
+		t.Errorf("want an internal error when the image cannot be checked, got %d: %v", status, err)
+	}
+}
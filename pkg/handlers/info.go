@@ -35,7 +35,7 @@ func MakeInfoHandler(version, sha string) http.HandlerFunc {
 
 		jsonOut, err := json.Marshal(infoResponse)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			respondError(w, err)
 			return
 		}
 
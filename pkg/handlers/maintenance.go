@@ -0,0 +1,163 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MaintenanceLookup returns the Maintenance of a function, it is nil when the
+// function is not in maintenance
+type MaintenanceLookup interface {
+	Maintenance(name string) *k8s.Maintenance
+}
+
+// MaintenanceRequest is the body of a PUT to put a function into maintenance, each
+// field is optional
+type MaintenanceRequest struct {
+	// StatusCode of the answer to the invocations, 503 by default
+	StatusCode int `json:"statusCode,omitempty"`
+	// RetryAfter is sent as the Retry-After header, such as "5m"
+	RetryAfter string `json:"retryAfter,omitempty"`
+	// Body is a static body for the answer
+	Body string `json:"body,omitempty"`
+	// ContentType of the Body, text/plain by default
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// MakeMaintenanceGuard returns a middleware for the function proxy that answers
+// the invocations of functions in maintenance without resolving them, so that
+// a function that is scaled to zero is not scaled up
+func MakeMaintenanceGuard(lookup MaintenanceLookup) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			functionName := mux.Vars(r)["name"]
+			m := lookup.Maintenance(functionName)
+			if m == nil {
+				next(w, r)
+				return
+			}
+
+			if r.Body != nil {
+				defer r.Body.Close()
+			}
+
+			if m.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(m.RetryAfter.Seconds()))))
+			}
+
+			body := m.Body
+			contentType := m.ContentType
+			if body == "" {
+				body = fmt.Sprintf("The function %s is in maintenance.", functionName)
+				contentType = ""
+			}
+			if contentType == "" {
+				contentType = defaultContentType
+			}
+
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(m.StatusCode)
+			io.WriteString(w, body)
+		}
+	}
+}
+
+// MakeMaintenanceHandler puts a function into maintenance with a PUT, its
+// invocations are then answered with the MaintenanceRequest until it is taken out
+// with a DELETE. The function is not changed otherwise, so it can be scaled down
+// or migrated in the meantime.
+func MakeMaintenanceHandler(defaultNamespace string, clientset kubernetes.Interface, apiTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		functionName := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		var m *k8s.Maintenance
+		if r.Method == http.MethodPut {
+			req := MaintenanceRequest{}
+			if r.Body != nil {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+					respondError(w, badRequest("unable to unmarshal request: %s", err))
+					return
+				}
+			}
+
+			var err error
+			if m, err = parseMaintenanceRequest(req); err != nil {
+				respondError(w, invalid(err))
+				return
+			}
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("function", functionName, "namespace", lookupNamespace)
+
+		ctx, cancel := k8s.WithAPITimeout(r.Context(), apiTimeout)
+		defer cancel()
+
+		if _, err := clientset.AppsV1().StatefulSets(lookupNamespace).Get(ctx, functionName, metav1.GetOptions{}); err != nil {
+			if errors.IsNotFound(err) {
+				respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s not found", functionName)))
+				return
+			}
+			logger.Error(err, "Unable to lookup function statefulset")
+			respondError(w, fmt.Errorf("unable to lookup function statefulset %s: %w", functionName, err))
+			return
+		}
+
+		if err := k8s.ApplyMaintenance(ctx, clientset, lookupNamespace, functionName, m); err != nil {
+			logger.Error(err, "Unable to update function statefulset")
+			respondError(w, fmt.Errorf("unable to update function statefulset %s: %w", functionName, err))
+			return
+		}
+
+		logger.Info("Changed function maintenance", "maintenance", m != nil)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// parseMaintenanceRequest validates the request in the same way as the
+// annotations that it is stored in
+func parseMaintenanceRequest(req MaintenanceRequest) (*k8s.Maintenance, error) {
+	annotations := map[string]string{k8s.AnnotationMaintenance: "true"}
+	if req.StatusCode != 0 {
+		annotations[k8s.AnnotationMaintenanceStatus] = strconv.Itoa(req.StatusCode)
+	}
+	if req.RetryAfter != "" {
+		annotations[k8s.AnnotationMaintenanceRetryAfter] = req.RetryAfter
+	}
+	if req.Body != "" {
+		annotations[k8s.AnnotationMaintenanceBody] = req.Body
+	}
+	if req.ContentType != "" {
+		annotations[k8s.AnnotationMaintenanceContentType] = req.ContentType
+	}
+	return k8s.ParseMaintenance(annotations)
+}
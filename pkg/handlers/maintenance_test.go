@@ -0,0 +1,192 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type staticMaintenance map[string]*k8s.Maintenance
+
+func (s staticMaintenance) Maintenance(name string) *k8s.Maintenance {
+	return s[name]
+}
+
+func Test_MakeMaintenanceGuard(t *testing.T) {
+	lookup := staticMaintenance{
+		"figlet": {StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Millisecond * 1500},
+		"env":    {StatusCode: http.StatusOK, Body: `{"status": "migrating"}`, ContentType: "application/json"},
+	}
+
+	cases := []struct {
+		name            string
+		function        string
+		wantStatus      int
+		wantBody        string
+		wantContentType string
+		wantRetryAfter  string
+	}{
+		{
+			name:            "answers with 503 and Retry-After",
+			function:        "figlet",
+			wantStatus:      http.StatusServiceUnavailable,
+			wantBody:        "The function figlet is in maintenance.",
+			wantContentType: "text/plain",
+			wantRetryAfter:  "2",
+		},
+		{
+			name:            "serves the static response",
+			function:        "env",
+			wantStatus:      http.StatusOK,
+			wantBody:        `{"status": "migrating"}`,
+			wantContentType: "application/json",
+		},
+		{
+			name:       "invokes functions not in maintenance",
+			function:   "nodeinfo",
+			wantStatus: http.StatusTeapot,
+			wantBody:   "invoked",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			next := func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("invoked"))
+			}
+
+			router := mux.NewRouter()
+			router.HandleFunc("/function/{name}", MakeMaintenanceGuard(lookup)(next))
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/function/"+c.function, strings.NewReader("input")))
+
+			if rr.Code != c.wantStatus {
+				t.Errorf("want status %d, got %d", c.wantStatus, rr.Code)
+			}
+			if rr.Body.String() != c.wantBody {
+				t.Errorf("want body %q, got %q", c.wantBody, rr.Body.String())
+			}
+			if c.wantContentType != "" && rr.Header().Get("Content-Type") != c.wantContentType {
+				t.Errorf("want Content-Type %q, got %q", c.wantContentType, rr.Header().Get("Content-Type"))
+			}
+			if got := rr.Header().Get("Retry-After"); got != c.wantRetryAfter {
+				t.Errorf("want Retry-After %q, got %q", c.wantRetryAfter, got)
+			}
+		})
+	}
+}
+
+func newMaintenanceClient(applied *[]map[string]string) *fake.Clientset {
+	client := fake.NewSimpleClientset(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+	})
+
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), obj); err != nil {
+			return true, nil, err
+		}
+		*applied = append(*applied, obj.Annotations)
+		return true, obj, nil
+	})
+	return client
+}
+
+func Test_MakeMaintenanceHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		want       []map[string]string
+	}{
+		{
+			name:       "puts the function into maintenance",
+			method:     http.MethodPut,
+			body:       `{"retryAfter": "5m", "body": "back soon"}`,
+			wantStatus: http.StatusAccepted,
+			want: []map[string]string{{
+				k8s.AnnotationMaintenance:           "true",
+				k8s.AnnotationMaintenanceStatus:     "503",
+				k8s.AnnotationMaintenanceRetryAfter: "5m0s",
+				k8s.AnnotationMaintenanceBody:       "back soon",
+			}},
+		},
+		{
+			name:       "puts the function into maintenance without a body",
+			method:     http.MethodPut,
+			wantStatus: http.StatusAccepted,
+			want: []map[string]string{{
+				k8s.AnnotationMaintenance:       "true",
+				k8s.AnnotationMaintenanceStatus: "503",
+			}},
+		},
+		{
+			name:       "takes the function out of maintenance",
+			method:     http.MethodDelete,
+			wantStatus: http.StatusAccepted,
+			want:       []map[string]string{{k8s.AnnotationMaintenance: "false"}},
+		},
+		{
+			name:       "rejects an invalid status code",
+			method:     http.MethodPut,
+			body:       `{"statusCode": 42}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "rejects an invalid body",
+			method:     http.MethodPut,
+			body:       `{"retryAfter": 5}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var applied []map[string]string
+			client := newMaintenanceClient(&applied)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/system/function/{name}/maintenance", MakeMaintenanceHandler("openfaas-fn", client, time.Second))
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(c.method, "/system/function/figlet/maintenance", strings.NewReader(c.body)))
+
+			if rr.Code != c.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", c.wantStatus, rr.Code, rr.Body.String())
+			}
+			if !reflect.DeepEqual(applied, c.want) {
+				t.Errorf("want annotations applied: %v, got: %v", c.want, applied)
+			}
+		})
+	}
+}
+
+func Test_MakeMaintenanceHandler_NotFound(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/system/function/{name}/maintenance", MakeMaintenanceHandler("openfaas-fn", fake.NewSimpleClientset(), time.Second))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/system/function/figlet/maintenance", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
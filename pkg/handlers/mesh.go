@@ -0,0 +1,25 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// applyMeshPolicy creates the DestinationRule or ServiceProfile of a function when
+// the mesh mode is enabled, a failure is logged rather than failing the deployment
+func applyMeshPolicy(ctx context.Context, logger logr.Logger, factory k8s.FunctionFactory, statefulset *appsv1.StatefulSet) {
+	if factory.Config.MeshMode == "" || factory.Dynamic == nil {
+		return
+	}
+
+	if err := k8s.ApplyMeshPolicy(ctx, factory.Dynamic, factory.Config.MeshMode, statefulset,
+		factory.Config.CostAllocationLabels(statefulset.Labels)); err != nil {
+		logger.Error(err, "Unable to apply the mesh policy", "mesh", factory.Config.MeshMode)
+	}
+}
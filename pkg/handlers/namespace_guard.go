@@ -0,0 +1,113 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// NamespaceLabel must be set to "true" on a namespace other than the default
+	// namespace before functions or secrets can be managed in it
+	NamespaceLabel = "openfaas"
+)
+
+// systemNamespaces are never managed through the provider API
+var systemNamespaces = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// MakeNamespaceGuard returns a middleware that rejects a request for a system
+// namespace, or for a namespace other than defaultNamespace that is not labelled
+// openfaas=true. The namespace is read from the namespace query parameter, or
+// from the namespace field of the JSON body of a POST, PUT or DELETE request.
+func MakeNamespaceGuard(defaultNamespace string, clientset kubernetes.Interface) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			namespace, err := requestNamespace(r, defaultNamespace)
+			if err != nil {
+				respondError(w, badRequest("%s", err))
+				return
+			}
+
+			if err := verifyNamespace(r.Context(), defaultNamespace, namespace, clientset); err != nil {
+				respondError(w, err)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// verifyNamespace returns an error with its HTTP status when the namespace is a
+// system namespace, or is not defaultNamespace and is not labelled openfaas=true
+func verifyNamespace(ctx context.Context, defaultNamespace, namespace string, clientset kubernetes.Interface) error {
+	if containsString(systemNamespaces, namespace) {
+		return withStatus(http.StatusForbidden, fmt.Errorf("unable to manage the system namespace %s", namespace))
+	}
+
+	if namespace == defaultNamespace {
+		return nil
+	}
+
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return withStatus(http.StatusNotFound, fmt.Errorf("namespace %s not found", namespace))
+	} else if errors.IsForbidden(err) {
+		// a Role instead of a ClusterRole can not read namespaces
+		return withStatus(http.StatusForbidden, fmt.Errorf("unable to verify the label of namespace %s", namespace))
+	} else if err != nil {
+		logging.FromContext(ctx).Error(err, "Unable to get namespace", "namespace", namespace)
+		return withStatus(http.StatusInternalServerError, fmt.Errorf("unable to get namespace %s", namespace))
+	}
+
+	if ns.Labels[NamespaceLabel] != "true" {
+		return withStatus(http.StatusForbidden, fmt.Errorf("namespace %s must have the label %s=true", namespace, NamespaceLabel))
+	}
+	return nil
+}
+
+// requestNamespace returns the namespace of a request, the body is restored so
+// that it can be read again by the handler
+func requestNamespace(r *http.Request, defaultNamespace string) (string, error) {
+	if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+		return namespace, nil
+	}
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodDelete:
+	default:
+		return defaultNamespace, nil
+	}
+
+	if r.Body == nil {
+		return defaultNamespace, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the request body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewBuffer(body))
+
+	// the handler reports a body that is not valid JSON
+	req := struct {
+		Namespace string `json:"namespace"`
+	}{}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.Namespace) == 0 {
+		return defaultNamespace, nil
+	}
+
+	return req.Namespace, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_NamespaceGuard(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{NamespaceLabel: "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+	)
+	guard := MakeNamespaceGuard("openfaas-fn", client)
+
+	cases := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+	}{
+		{name: "default namespace", method: http.MethodGet, url: "/system/functions", wantStatus: http.StatusOK},
+		{name: "labelled namespace in query", method: http.MethodGet, url: "/system/functions?namespace=team-a", wantStatus: http.StatusOK},
+		{name: "labelled namespace in body", method: http.MethodPost, url: "/system/functions", body: `{"service":"figlet","namespace":"team-a"}`, wantStatus: http.StatusOK},
+		{name: "unlabelled namespace", method: http.MethodPut, url: "/system/functions", body: `{"service":"figlet","namespace":"team-b"}`, wantStatus: http.StatusForbidden},
+		{name: "missing namespace", method: http.MethodDelete, url: "/system/functions?namespace=team-c", wantStatus: http.StatusNotFound},
+		{name: "system namespace", method: http.MethodPost, url: "/system/scale-function/figlet?namespace=kube-system", wantStatus: http.StatusForbidden},
+		{name: "invalid body is left to the handler", method: http.MethodPost, url: "/system/functions", body: `{`, wantStatus: http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotBody string
+			next := func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				gotBody = string(body)
+				w.WriteHeader(http.StatusOK)
+			}
+
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			guard(next)(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code == http.StatusOK && gotBody != tc.body {
+				t.Errorf("want the body to be restored as %q, got %q", tc.body, gotBody)
+			}
+		})
+	}
+}
@@ -10,12 +10,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	glog "k8s.io/klog"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
 )
 
 // MakeNamespacesLister builds a list of namespaces with an "openfaas" tag, or the default name
@@ -30,8 +30,8 @@ func MakeNamespacesLister(defaultNamespace string, clientset kubernetes.Interfac
 
 		out, err := json.Marshal(namespaces)
 		if err != nil {
-			glog.Errorf("Failed to list namespaces: %s", err.Error())
-			http.Error(w, "Failed to list namespaces", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error(err, "Failed to list namespaces")
+			respondError(w, fmt.Errorf("unable to list namespaces: %w", err))
 			return
 		}
 
@@ -68,7 +68,7 @@ func NewNamespaceResolver(defaultNamespace string, kube kubernetes.Interface) Na
 			body, _ := io.ReadAll(r.Body)
 			err := json.Unmarshal(body, &req)
 			if err != nil {
-				log.Printf("error while getting namespace: %s\n", err)
+				logging.FromContext(r.Context()).Error(err, "Error while getting namespace")
 				return "", fmt.Errorf("unable to unmarshal json request")
 			}
 
@@ -89,9 +89,9 @@ func NewNamespaceResolver(defaultNamespace string, kube kubernetes.Interface) Na
 }
 
 // ListNamespaces lists all namespaces annotated with openfaas true
-func ListNamespaces(defaultNamespace string, clientset kubernetes.Interface) []string {
+func ListNamespaces(ctx context.Context, defaultNamespace string, clientset kubernetes.Interface) []string {
 	listOptions := metav1.ListOptions{}
-	namespaces, err := clientset.CoreV1().Namespaces().List(context.TODO(), listOptions)
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, listOptions)
 
 	set := []string{}
 
@@ -99,7 +99,7 @@ func ListNamespaces(defaultNamespace string, clientset kubernetes.Interface) []s
 	// the Role will not be able to list namespaces, so all functions are in the
 	// defaultNamespace
 	if err != nil {
-		log.Printf("Error listing namespaces: %s", err.Error())
+		logging.Default().Error(err, "Error listing namespaces")
 		set = append(set, defaultNamespace)
 		return set
 	}
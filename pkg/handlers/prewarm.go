@@ -0,0 +1,31 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// applyPrewarm creates, updates or removes the pre-warm DaemonSet of a function for
+// its com.openfaas.prewarm label, a failure is logged rather than failing the deployment.
+// previous is the StatefulSet before an update, the DaemonSet is only looked up when
+// either of them has the label.
+func applyPrewarm(ctx context.Context, logger logr.Logger, factory k8s.FunctionFactory, statefulset, previous *appsv1.StatefulSet) {
+	if !k8s.IsPrewarmed(statefulset.Spec.Template.Labels) &&
+		(previous == nil || !k8s.IsPrewarmed(previous.Spec.Template.Labels)) {
+		return
+	}
+
+	syncCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+
+	if err := k8s.SyncPrewarm(syncCtx, factory.Client, statefulset, factory.Config.PrewarmImage,
+		factory.Config.CostAllocationLabels(statefulset.Labels)); err != nil {
+		logger.Error(err, "Unable to sync the pre-warm DaemonSet")
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PromoteRequest copies a function, such as from a staging namespace into the
+// namespace of the provider. Each override is optional.
+type PromoteRequest struct {
+	// SourceNamespace is the namespace of the function that is copied, the default
+	// namespace when empty
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+	// Namespace is where the copy is deployed, the default namespace when empty
+	Namespace string `json:"namespace,omitempty"`
+	// Service is the name of the copy, the name of the function when empty
+	Service string `json:"service,omitempty"`
+	// Image replaces the image of the function
+	Image string `json:"image,omitempty"`
+	// Tag replaces the tag or digest of the image of the function
+	Tag string `json:"tag,omitempty"`
+	// Replicas the copy is scaled to once it is created, instead of its minimum
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// MakePromoteHandler copies a function with a POST, with its environment, secrets,
+// labels, annotations, Profiles, constraints and resources. The copy is created by
+// deploy, so it is checked in the same way as any other new function, and the
+// secrets and Profiles that it refers to must exist where it is deployed.
+//
+// With wait=true the handler blocks until the Pods of the copy are ready, or until
+// the timeout query parameter, and returns the RolloutStatus.
+func MakePromoteHandler(defaultNamespace string, clientset kubernetes.Interface, deploy http.HandlerFunc, limits *k8s.ReplicaLimits, apiTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		req := PromoteRequest{}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				respondError(w, badRequest("failed to unmarshal request: %s", err))
+				return
+			}
+		}
+
+		waitForReady, timeout, err := parseWait(r.URL.Query())
+		if err != nil {
+			respondError(w, badRequest("%s", err))
+			return
+		}
+
+		namespace := defaultNamespace
+		if len(req.Namespace) > 0 {
+			namespace = req.Namespace
+		}
+		if namespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		sourceNamespace := defaultNamespace
+		if len(req.SourceNamespace) > 0 {
+			sourceNamespace = req.SourceNamespace
+		}
+
+		service := functionName
+		if len(req.Service) > 0 {
+			service = req.Service
+		}
+
+		if sourceNamespace == namespace && service == functionName {
+			respondError(w, badRequest("the copy of function %s needs another name or namespace", functionName))
+			return
+		}
+		if req.Replicas != nil && *req.Replicas < 1 {
+			respondError(w, badRequest("replicas must be 1 or more, got %d", *req.Replicas))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("function", functionName, "sourceNamespace", sourceNamespace,
+			"service", service, "namespace", namespace)
+
+		if err := verifyNamespace(r.Context(), defaultNamespace, sourceNamespace, clientset); err != nil {
+			respondError(w, err)
+			return
+		}
+
+		getCtx, cancel := k8s.WithAPITimeout(r.Context(), apiTimeout)
+		defer cancel()
+
+		statefulset, err := clientset.AppsV1().StatefulSets(sourceNamespace).Get(getCtx, functionName, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s.%s not found", functionName, sourceNamespace)))
+				return
+			}
+			if errors.IsForbidden(err) {
+				// a Role can only read the functions in its own namespace
+				respondError(w, withStatus(http.StatusForbidden, fmt.Errorf("unable to read the functions in namespace %s", sourceNamespace)))
+				return
+			}
+			logger.Error(err, "Unable to lookup function statefulset")
+			respondError(w, fmt.Errorf("unable to lookup function statefulset %s: %w", functionName, err))
+			return
+		}
+		if _, ok := statefulset.Spec.Template.Labels["faas_function"]; !ok {
+			respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s.%s not found", functionName, sourceNamespace)))
+			return
+		}
+
+		request := k8s.AsFunctionDeployment(*statefulset)
+		request.Service = service
+		request.Namespace = namespace
+		if len(req.Image) > 0 {
+			request.Image = req.Image
+		}
+		if len(req.Tag) > 0 {
+			request.Image = withImageTag(request.Image, req.Tag)
+		}
+
+		deployBody, err := json.Marshal(request)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		deployReq := r.Clone(r.Context())
+		deployReq.Method = http.MethodPost
+		deployReq.URL.Path = "/system/functions"
+		deployReq.URL.RawQuery = ""
+		deployReq.Body = io.NopCloser(bytes.NewReader(deployBody))
+		deployReq.ContentLength = int64(len(deployBody))
+
+		deployed := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		deploy(deployed, deployReq)
+
+		for key, values := range deployed.header {
+			w.Header()[key] = values
+		}
+		if deployed.status >= http.StatusMultipleChoices {
+			w.WriteHeader(deployed.status)
+			w.Write(deployed.body.Bytes())
+			return
+		}
+
+		logger.Info("Function promoted", "image", request.Image)
+
+		if req.Replicas != nil {
+			var labels map[string]string
+			if request.Labels != nil {
+				labels = *request.Labels
+			}
+
+			replicas := *req.Replicas
+			if max := limits.FunctionMax(r.Context(), namespace, labels); replicas > max {
+				replicas = max
+			}
+
+			scaleCtx, cancel := k8s.WithAPITimeout(r.Context(), apiTimeout)
+			defer cancel()
+
+			// the replicas are applied as a scale, so that the autoscaler takes them
+			// over from here
+			if err := k8s.ApplyStatefulSetReplicas(scaleCtx, clientset, namespace, service, replicas, k8s.ScaleFieldManager); err != nil {
+				logger.Error(err, "Unable to scale the promoted function")
+				respondError(w, fmt.Errorf("function %s was created, but could not be scaled: %w", service, err))
+				return
+			}
+		}
+
+		if !waitForReady {
+			w.WriteHeader(deployed.status)
+			w.Write(deployed.body.Bytes())
+			return
+		}
+		writeRolloutStatus(r.Context(), w, logger, clientset, namespace, service, timeout)
+	}
+}
+
+// withImageTag replaces the tag or digest of an image, a port of the registry is
+// not mistaken for a tag
+func withImageTag(image, tag string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	if strings.HasPrefix(tag, "sha256:") {
+		return image + "@" + tag
+	}
+	return image + ":" + tag
+}
+
+// bufferedResponse keeps the response of a handler in memory, so that it can be
+// written after the steps that follow it
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *bufferedResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *bufferedResponse) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.status = status
+	r.wroteHeader = true
+}
+
+func (r *bufferedResponse) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_MakePromoteHandler(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging", Labels: map[string]string{NamespaceLabel: "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "scratch"}},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "staging"},
+			Spec: appsv1.StatefulSetSpec{
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"faas_function": "figlet", "team": "web"}},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:  "figlet",
+							Image: "registry:5000/figlet:0.1.0",
+							Env:   []corev1.EnvVar{{Name: "fprocess", Value: "figlet"}, {Name: "LOG_LEVEL", Value: "debug"}},
+						}},
+					},
+				},
+			},
+		},
+	)
+
+	var scaled int32
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), obj); err != nil {
+			t.Fatalf("unable to decode the patch: %s", err)
+		}
+		scaled = *obj.Spec.Replicas
+		return true, obj, nil
+	})
+
+	var deployed types.FunctionDeployment
+	deploy := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &deployed); err != nil {
+			t.Fatalf("unable to decode the deploy request: %s", err)
+		}
+		if deployed.Service == "conflict" {
+			respondError(w, withStatus(http.StatusConflict, io.EOF))
+			return
+		}
+		w.Header().Set(ResourceVersionHeader, "42")
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/system/function/{name}/promote", MakePromoteHandler("openfaas-fn", client, deploy, nil, 0))
+
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "copy to itself", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "another target namespace", body: `{"sourceNamespace": "staging", "namespace": "prod"}`, wantStatus: http.StatusBadRequest},
+		{name: "unlabelled source namespace", body: `{"sourceNamespace": "scratch"}`, wantStatus: http.StatusForbidden},
+		{name: "unknown function", body: `{"service": "figlet-copy"}`, wantStatus: http.StatusNotFound},
+		{name: "deploy fails", body: `{"sourceNamespace": "staging", "service": "conflict"}`, wantStatus: http.StatusConflict},
+		{name: "promotes with overrides", body: `{"sourceNamespace": "staging", "tag": "0.2.0", "replicas": 3}`, wantStatus: http.StatusAccepted},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/function/figlet/promote", strings.NewReader(tc.body)))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if deployed.Service != "figlet" || deployed.Namespace != "openfaas-fn" {
+		t.Errorf("want figlet to be deployed to openfaas-fn, got %s.%s", deployed.Service, deployed.Namespace)
+	}
+	if deployed.Image != "registry:5000/figlet:0.2.0" {
+		t.Errorf("want the tag to be replaced, got %s", deployed.Image)
+	}
+	if deployed.EnvProcess != "figlet" || deployed.EnvVars["LOG_LEVEL"] != "debug" {
+		t.Errorf("want the process and environment to be copied, got %q %v", deployed.EnvProcess, deployed.EnvVars)
+	}
+	if deployed.Labels == nil || (*deployed.Labels)["team"] != "web" {
+		t.Errorf("want the labels to be copied, got %v", deployed.Labels)
+	}
+	if scaled != 3 {
+		t.Errorf("want the copy to be scaled to 3 replicas, got %d", scaled)
+	}
+}
+
+func Test_withImageTag(t *testing.T) {
+	cases := []struct {
+		image string
+		tag   string
+		want  string
+	}{
+		{image: "figlet", tag: "0.2.0", want: "figlet:0.2.0"},
+		{image: "ghcr.io/openfaas/figlet:0.1.0", tag: "0.2.0", want: "ghcr.io/openfaas/figlet:0.2.0"},
+		{image: "registry:5000/figlet", tag: "0.2.0", want: "registry:5000/figlet:0.2.0"},
+		{image: "figlet:0.1.0@sha256:abc", tag: "sha256:def", want: "figlet@sha256:def"},
+	}
+
+	for _, tc := range cases {
+		if got := withImageTag(tc.image, tc.tag); got != tc.want {
+			t.Errorf("withImageTag(%q, %q): want %q, got %q", tc.image, tc.tag, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/openfaas/faas-netes/pkg/tracing"
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/proxy"
+	"golang.org/x/net/http2"
+)
+
+const defaultContentType = "text/plain"
+
+// proxyBufferSize matches the buffer size used by io.Copy
+const proxyBufferSize = 32 * 1024
+
+// proxyBuffers are used to stream responses from functions to the caller, a buffer
+// is only held while one response is copied so large payloads do not allocate a new
+// buffer for every invocation
+var proxyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, proxyBufferSize)
+		return &buf
+	},
+}
+
+// ProxyConfig tunes the connection pool that is shared by all function invocations
+type ProxyConfig struct {
+	// Timeout for the whole request to the function, including reading the body
+	Timeout time.Duration
+
+	// MaxIdleConns across all functions
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the number of idle connections kept for each function
+	// pod, and should be close to the concurrency of the busiest function
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept before it is closed
+	IdleConnTimeout time.Duration
+
+	// KeepAlive period for the TCP connections to functions
+	KeepAlive time.Duration
+
+	// HTTP2 uses HTTP/2 with prior knowledge (h2c) instead of HTTP/1.1, the
+	// requests to each pod are multiplexed over a single connection and the
+	// settings for idle connections do not apply
+	HTTP2 bool
+}
+
+// NewProxyClient creates the http.Client used by the function proxy. Connections
+// are re-used between requests, so that high-throughput callers do not open a new
+// connection, and use a new ephemeral port, for each invocation.
+func NewProxyClient(config ProxyConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   config.Timeout,
+		KeepAlive: config.KeepAlive,
+	}
+
+	var transport http.RoundTripper
+	if config.HTTP2 {
+		transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			// ping connections that have not received a frame, so that a connection
+			// to a pod that was removed is closed instead of timing out requests
+			ReadIdleTimeout: config.KeepAlive,
+		}
+	} else {
+		transport = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          config.MaxIdleConns,
+			MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+			IdleConnTimeout:       config.IdleConnTimeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1500 * time.Millisecond,
+		}
+	}
+
+	return &http.Client{
+		// the transport continues the caller's trace and passes the traceparent
+		// header on to the function
+		Transport: tracing.Transport(transport),
+		Timeout:   config.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// TimeoutLookup returns the timeout of the invocations of a function, it is zero
+// when the function does not have a timeout of its own
+type TimeoutLookup interface {
+	Timeout(name string) time.Duration
+}
+
+// MakeProxyHandler invokes functions with the given client, it behaves the same way
+// as the proxy from faas-provider, which does not allow its transport to be tuned.
+// Invocations that do not reach a ready replica are retried with the retrier, and
+// their results are recorded in the breaker. The timeout of a function from the
+// timeouts replaces the timeout of the client. The last three are optional.
+func MakeProxyHandler(client *http.Client, resolver proxy.BaseURLResolver, retrier *Retrier, breaker *k8s.CircuitBreaker, timeouts TimeoutLookup) http.HandlerFunc {
+	if resolver == nil {
+		panic("MakeProxyHandler: empty proxy handler resolver, cannot be nil")
+	}
+
+	// the timeout of a function is applied to the context of the invocation
+	unbounded := *client
+	unbounded.Timeout = 0
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		client := client
+		if timeouts != nil {
+			if timeout := timeouts.Timeout(mux.Vars(r)["name"]); timeout > 0 {
+				ctx, cancel := context.WithTimeout(r.Context(), timeout)
+				defer cancel()
+				r = r.WithContext(ctx)
+				client = &unbounded
+				extendDeadlines(w, timeout)
+			}
+		}
+
+		switch r.Method {
+		case http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+			http.MethodGet,
+			http.MethodOptions,
+			http.MethodHead:
+			proxyRequest(w, r, client, resolver, retrier, breaker)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func proxyRequest(w http.ResponseWriter, originalReq *http.Request, client *http.Client, resolver proxy.BaseURLResolver, retrier *Retrier, breaker *k8s.CircuitBreaker) {
+	pathVars := mux.Vars(originalReq)
+	functionName := pathVars["name"]
+	if functionName == "" {
+		httputil.Errorf(w, http.StatusBadRequest, "Provide function name in the request path")
+		return
+	}
+
+	ctx := k8s.WithAffinityKey(originalReq.Context(), originalReq.Header.Get(k8s.AffinityKeyHeader))
+	logger := logging.FromContext(ctx).WithValues("function", functionName)
+
+	if isUpgrade(originalReq) {
+		functionAddr, err := resolve(ctx, resolver, functionName)
+		if err != nil {
+			logger.Error(err, "Resolver error, no endpoints for function")
+			httputil.Errorf(w, http.StatusServiceUnavailable, "No endpoints available for: %s.", functionName)
+			return
+		}
+		defer startInvocation(resolver, functionAddr.Host)()
+		proxyUpgrade(w, originalReq, functionName, functionAddr, pathVars["params"], client.Timeout, breaker, logger)
+		return
+	}
+
+	// the body is buffered so that it can be sent again, otherwise it is streamed
+	var body []byte
+	replayable := retrier.replayable(originalReq)
+	if replayable && originalReq.Body != nil {
+		var err error
+		if body, err = io.ReadAll(originalReq.Body); err != nil {
+			httputil.Errorf(w, http.StatusBadRequest, "Failed to read the request body: %s.", err)
+			return
+		}
+	}
+	retrier.deposit()
+
+	var response *http.Response
+	var seconds time.Duration
+	for attempt := 0; ; attempt++ {
+		functionAddr, err := resolve(ctx, resolver, functionName)
+		if err != nil {
+			logger.Error(err, "Resolver error, no endpoints for function")
+			httputil.Errorf(w, http.StatusServiceUnavailable, "No endpoints available for: %s.", functionName)
+			return
+		}
+
+		proxyReq, err := buildProxyRequest(originalReq, functionAddr, pathVars["params"])
+		if err != nil {
+			httputil.Errorf(w, http.StatusInternalServerError, "Failed to resolve service: %s.", functionName)
+			return
+		}
+		if body != nil {
+			proxyReq.Body = io.NopCloser(bytes.NewReader(body))
+			proxyReq.ContentLength = int64(len(body))
+		}
+
+		finished := startInvocation(resolver, functionAddr.Host)
+		start := time.Now()
+		response, err = client.Do(proxyReq.WithContext(ctx))
+		seconds = time.Since(start)
+
+		failed := failedInvocation(ctx, response, err)
+		if ctx.Err() == nil {
+			breaker.Record(functionAddr.Host, err == nil && !failed)
+		}
+
+		if failed && replayable && attempt < retrier.config.Attempts && retrier.withdraw() {
+			if err == nil {
+				io.Copy(io.Discard, response.Body)
+				response.Body.Close()
+			}
+			finished()
+			logger.V(1).Info("Retrying invocation", "url", proxyReq.URL.String(), "attempt", attempt+1, "error", err)
+			if retrier.wait(ctx) {
+				continue
+			}
+			httputil.Errorf(w, http.StatusServiceUnavailable, "Can't reach service for: %s.", functionName)
+			return
+		}
+
+		defer finished()
+		if err != nil {
+			logger.Error(err, "Error with proxy request", "url", proxyReq.URL.String())
+			httputil.Errorf(w, http.StatusInternalServerError, "Can't reach service for: %s.", functionName)
+			return
+		}
+		break
+	}
+	defer response.Body.Close()
+
+	logger.V(1).Info("Invocation completed", "status", response.StatusCode, "seconds", seconds.Seconds())
+
+	copyHeaders(w.Header(), response.Header)
+	w.Header().Set("Content-Type", getContentType(originalReq.Header, response.Header))
+
+	w.WriteHeader(response.StatusCode)
+	if err := copyResponse(w, response); err != nil {
+		logger.Error(err, "Error copying the response")
+	}
+}
+
+// extendDeadlines lets the server of the provider read the request and write the
+// response of a function whose timeout is longer than its own timeouts
+func extendDeadlines(w http.ResponseWriter, timeout time.Duration) {
+	deadline := time.Now().Add(timeout + time.Second)
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+}
+
+// connectionTracker is implemented by resolvers that balance the invocations on
+// those in progress, such as k8s.FunctionLookup
+type connectionTracker interface {
+	Started(host string)
+	Finished(host string)
+}
+
+// startInvocation records an invocation to the host with the resolver, the
+// returned func records its end
+func startInvocation(resolver proxy.BaseURLResolver, host string) func() {
+	tracker, ok := resolver.(connectionTracker)
+	if !ok {
+		return func() {}
+	}
+
+	tracker.Started(host)
+	return func() { tracker.Finished(host) }
+}
+
+// contextResolver is implemented by resolvers that may wait for a function to
+// become ready, such as k8s.ScaleFromZeroResolver, the wait ends with the request
+type contextResolver interface {
+	ResolveContext(ctx context.Context, name string) (url.URL, error)
+}
+
+func resolve(ctx context.Context, resolver proxy.BaseURLResolver, name string) (url.URL, error) {
+	if r, ok := resolver.(contextResolver); ok {
+		return r.ResolveContext(ctx, name)
+	}
+	return resolver.Resolve(name)
+}
+
+// copyResponse streams the body of the response to the caller without reading it
+// into memory. Streamed responses such as server-sent events, or chunked responses
+// without a length, are flushed after each write so the caller receives them as the
+// function produces them.
+func copyResponse(w http.ResponseWriter, response *http.Response) error {
+	bufPtr := proxyBuffers.Get().(*[]byte)
+	defer proxyBuffers.Put(bufPtr)
+
+	var dst io.Writer = writerOnly{w}
+	if flusher, ok := w.(http.Flusher); ok && isStreamed(response) {
+		dst = flushWriter{w: w, flusher: flusher}
+	}
+
+	_, err := io.CopyBuffer(dst, response.Body, *bufPtr)
+	return err
+}
+
+func isStreamed(response *http.Response) bool {
+	return response.ContentLength < 0 ||
+		strings.HasPrefix(response.Header.Get("Content-Type"), "text/event-stream")
+}
+
+// writerOnly hides interfaces such as io.ReaderFrom, so that io.CopyBuffer uses
+// the pooled buffer
+type writerOnly struct {
+	io.Writer
+}
+
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.flusher.Flush()
+	return n, err
+}
+
+// buildProxyRequest preserves the headers of the original request and sets the
+// X-Forwarded headers
+func buildProxyRequest(originalReq *http.Request, baseURL url.URL, extraPath string) (*http.Request, error) {
+	upstreamURL := url.URL{
+		Scheme:   baseURL.Scheme,
+		Host:     baseURL.Host,
+		Path:     extraPath,
+		RawQuery: originalReq.URL.RawQuery,
+	}
+
+	upstreamReq, err := http.NewRequest(originalReq.Method, upstreamURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	copyHeaders(upstreamReq.Header, originalReq.Header)
+
+	if len(originalReq.Host) > 0 && upstreamReq.Header.Get("X-Forwarded-Host") == "" {
+		upstreamReq.Header["X-Forwarded-Host"] = []string{originalReq.Host}
+	}
+	if upstreamReq.Header.Get("X-Forwarded-For") == "" {
+		upstreamReq.Header["X-Forwarded-For"] = []string{originalReq.RemoteAddr}
+	}
+
+	if originalReq.Body != nil {
+		upstreamReq.Body = originalReq.Body
+		upstreamReq.ContentLength = originalReq.ContentLength
+	}
+
+	return upstreamReq, nil
+}
+
+func copyHeaders(destination http.Header, source http.Header) {
+	for k, v := range source {
+		vClone := make([]string, len(v))
+		copy(vClone, v)
+		destination[k] = vClone
+	}
+}
+
+func getContentType(request http.Header, response http.Header) string {
+	if contentType := response.Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+	if contentType := request.Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+	return defaultContentType
+}
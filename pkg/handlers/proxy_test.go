@@ -0,0 +1,263 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/tracing"
+)
+
+type staticResolver struct {
+	url url.URL
+}
+
+func (r staticResolver) Resolve(name string) (url.URL, error) {
+	return r.url, nil
+}
+
+func Test_MakeProxyHandler_ReusesConnections(t *testing.T) {
+	var connections int32
+	function := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sub/path" {
+			t.Errorf("expected the sub-path to be proxied, got %q", r.URL.Path)
+		}
+		w.Write([]byte(r.Header.Get("X-Forwarded-Host")))
+	}))
+	function.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	function.Start()
+	defer function.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	client := NewProxyClient(ProxyConfig{
+		Timeout:             time.Second * 5,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     time.Minute,
+		KeepAlive:           time.Second * 30,
+	})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(client, staticResolver{url: *functionURL}, nil, nil, nil))
+
+	for i := 0; i < 5; i++ {
+		r := httptest.NewRequest(http.MethodPost, "http://gateway:8080/function/figlet/sub/path", strings.NewReader("hi"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		if got := w.Body.String(); got != "gateway:8080" {
+			t.Fatalf("expected X-Forwarded-Host gateway:8080, got %q", got)
+		}
+	}
+
+	if got := atomic.LoadInt32(&connections); got != 1 {
+		t.Fatalf("expected the connection to be re-used, got %d connections", got)
+	}
+}
+
+func Test_MakeProxyHandler_StreamsLargeBody(t *testing.T) {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer function.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	client := NewProxyClient(ProxyConfig{Timeout: time.Second * 10, MaxIdleConns: 1, MaxIdleConnsPerHost: 1})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(client, staticResolver{url: *functionURL}, nil, nil, nil))
+
+	payload := bytes.Repeat([]byte("openfaas"), 1024*1024)
+	r := httptest.NewRequest(http.MethodPost, "/function/upload", bytes.NewReader(payload))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), payload) {
+		t.Fatalf("expected the %d byte payload to be returned, got %d bytes", len(payload), w.Body.Len())
+	}
+}
+
+func Test_MakeProxyHandler_FlushesEventStream(t *testing.T) {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+	}))
+	defer function.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	client := NewProxyClient(ProxyConfig{Timeout: time.Second * 5})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(client, staticResolver{url: *functionURL}, nil, nil, nil))
+
+	r := httptest.NewRequest(http.MethodGet, "/function/events", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if !w.Flushed {
+		t.Fatalf("expected the event stream to be flushed")
+	}
+	if got := w.Body.String(); got != "data: 1\n\n" {
+		t.Fatalf("expected the event to be proxied, got %q", got)
+	}
+}
+
+func Benchmark_MakeProxyHandler(b *testing.B) {
+	payload := bytes.Repeat([]byte("openfaas"), 128*1024)
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer function.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	client := NewProxyClient(ProxyConfig{Timeout: time.Second * 10, MaxIdleConns: 10, MaxIdleConnsPerHost: 10, IdleConnTimeout: time.Minute})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(client, staticResolver{url: *functionURL}, nil, nil, nil))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		router.ServeHTTP(discardResponseWriter{header: http.Header{}}, r)
+	}
+}
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d discardResponseWriter) Header() http.Header         { return d.header }
+func (d discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (d discardResponseWriter) WriteHeader(int)             {}
+
+func Test_MakeProxyHandler_PropagatesTraceparent(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), "faas-netes", "test"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("traceparent")))
+	}))
+	defer function.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	client := NewProxyClient(ProxyConfig{Timeout: time.Second * 5})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", tracing.Handler("invoke", MakeProxyHandler(client, staticResolver{url: *functionURL}, nil, nil, nil)))
+
+	r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	r.Header.Set("traceparent", traceparent)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	got := w.Body.String()
+	if !strings.HasPrefix(got, "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Fatalf("expected the function to receive the trace id of %s, got %q", traceparent, got)
+	}
+}
+
+type staticTimeouts map[string]time.Duration
+
+func (t staticTimeouts) Timeout(name string) time.Duration {
+	return t[name]
+}
+
+func Test_MakeProxyHandler_FunctionTimeout(t *testing.T) {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Millisecond * 300):
+			w.Write([]byte("done"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer function.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	client := NewProxyClient(ProxyConfig{Timeout: time.Millisecond * 100})
+	timeouts := staticTimeouts{"slow": time.Second * 2, "fast": time.Millisecond * 50}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(client, staticResolver{url: *functionURL}, nil, nil, timeouts))
+
+	cases := map[string]int{
+		// the timeout of the function is longer than the client's
+		"slow": http.StatusOK,
+		"env":  http.StatusInternalServerError,
+		"fast": http.StatusInternalServerError,
+	}
+	for name, want := range cases {
+		r := httptest.NewRequest(http.MethodGet, "http://gateway:8080/function/"+name, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != want {
+			t.Errorf("%s: want status code %d, got %d", name, want, w.Code)
+		}
+	}
+}
+
+// trackingResolver counts the invocations in progress to its URL
+type trackingResolver struct {
+	staticResolver
+	inFlight int32
+	started  int32
+}
+
+func (r *trackingResolver) Started(host string) {
+	atomic.AddInt32(&r.inFlight, 1)
+	atomic.AddInt32(&r.started, 1)
+}
+
+func (r *trackingResolver) Finished(host string) {
+	atomic.AddInt32(&r.inFlight, -1)
+}
+
+func Test_MakeProxyHandler_TracksInvocations(t *testing.T) {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hi"))
+	}))
+	defer function.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	resolver := &trackingResolver{staticResolver: staticResolver{url: *functionURL}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(NewProxyClient(ProxyConfig{Timeout: time.Second * 5}), resolver, nil, nil, nil))
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, "http://gateway:8080/function/figlet", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if got := atomic.LoadInt32(&resolver.started); got != 3 {
+		t.Errorf("want 3 invocations to be started, got %d", got)
+	}
+	if got := atomic.LoadInt32(&resolver.inFlight); got != 0 {
+		t.Errorf("want every invocation to be finished, got %d in progress", got)
+	}
+}
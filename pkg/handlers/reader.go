@@ -6,21 +6,29 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 
 	types "github.com/openfaas/faas-provider/types"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	v1 "k8s.io/client-go/listers/apps/v1"
-	glog "k8s.io/klog"
+	corelisters "k8s.io/client-go/listers/core/v1"
 
 	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
 )
 
+// FunctionListItem is a function in the list, with what is running for it
+type FunctionListItem struct {
+	types.FunctionStatus
+	k8s.RuntimeStatus
+}
+
 // MakeFunctionReader handler for reading functions deployed in the cluster as statefulsets.
-func MakeFunctionReader(defaultNamespace string, statefulSetLister v1.StatefulSetLister) http.HandlerFunc {
+// The functions are read from the informer cache, the resourceVersion observed by the
+// cache is returned in the ResourceVersionHeader. Each function includes the digest of
+// its running image and whether a rollout is in progress, read from its Pods.
+func MakeFunctionReader(defaultNamespace string, statefulSetLister v1.StatefulSetLister, podLister corelisters.PodLister, versions ResourceVersionSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		q := r.URL.Query()
@@ -33,39 +41,45 @@ func MakeFunctionReader(defaultNamespace string, statefulSetLister v1.StatefulSe
 		}
 
 		if lookupNamespace != defaultNamespace {
-			http.Error(w, fmt.Sprintf("namespace must be: %s", defaultNamespace), http.StatusBadRequest)
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
 			return
 		}
 
-		if lookupNamespace == "kube-system" {
-			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
-			return
+		if requested := q.Get("resourceVersion"); requested != "" {
+			if err := waitForResourceVersion(r.Context(), versions, requested); err != nil {
+				respondError(w, err)
+				return
+			}
 		}
 
-		functions, err := getServiceList(lookupNamespace, statefulSetLister)
+		// read the version before the list, so the list is at least as new as the token
+		resourceVersion := versions.LastSyncResourceVersion()
+
+		logger := logging.FromContext(r.Context()).WithValues("namespace", lookupNamespace)
+
+		functions, err := getServiceList(lookupNamespace, statefulSetLister, podLister)
 		if err != nil {
-			log.Println(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+			logger.Error(err, "Unable to list functions")
+			respondError(w, err)
 			return
 		}
 
 		functionBytes, err := json.Marshal(functions)
 		if err != nil {
-			glog.Errorf("Failed to marshal functions: %s", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Failed to marshal functions"))
+			logger.Error(err, "Failed to marshal functions")
+			respondError(w, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(ResourceVersionHeader, resourceVersion)
 		w.WriteHeader(http.StatusOK)
 		w.Write(functionBytes)
 	}
 }
 
-func getServiceList(functionNamespace string, statefulSetLister v1.StatefulSetLister) ([]types.FunctionStatus, error) {
-	functions := []types.FunctionStatus{}
+func getServiceList(functionNamespace string, statefulSetLister v1.StatefulSetLister, podLister corelisters.PodLister) ([]FunctionListItem, error) {
+	functions := []FunctionListItem{}
 
 	sel := labels.NewSelector()
 	req, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
@@ -83,9 +97,18 @@ func getServiceList(functionNamespace string, statefulSetLister v1.StatefulSetLi
 	for _, item := range res {
 		if item != nil {
 			function := k8s.AsFunctionStatus(*item)
-			if function != nil {
-				functions = append(functions, *function)
+			if function == nil {
+				continue
+			}
+
+			pods, err := podLister.Pods(functionNamespace).List(labels.SelectorFromSet(labels.Set{"faas_function": item.Name}))
+			if err != nil {
+				return nil, err
 			}
+			functions = append(functions, FunctionListItem{
+				FunctionStatus: *function,
+				RuntimeStatus:  k8s.GetRuntimeStatus(item, pods),
+			})
 		}
 	}
 
@@ -0,0 +1,138 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// advancingVersions moves forward by one each time it is read
+type advancingVersions struct {
+	version int64
+}
+
+func (v *advancingVersions) LastSyncResourceVersion() string {
+	return strconv.FormatInt(atomic.AddInt64(&v.version, 1), 10)
+}
+
+func newReaderTestLister() appslister.StatefulSetLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "figlet",
+			Namespace: "openfaas-fn",
+			Labels:    map[string]string{"faas_function": "figlet"},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"faas_function": "figlet"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet", Image: "ghcr.io/openfaas/figlet:latest"}},
+				},
+			},
+		},
+	})
+	return appslister.NewStatefulSetLister(indexer)
+}
+
+func newReaderTestPodLister(pods ...*corev1.Pod) corelister.PodLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pod := range pods {
+		indexer.Add(pod)
+	}
+	return corelister.NewPodLister(indexer)
+}
+
+func Test_MakeFunctionReader_ResourceVersion(t *testing.T) {
+	versions := &advancingVersions{version: 10}
+	handler := MakeFunctionReader("openfaas-fn", newReaderTestLister(), newReaderTestPodLister(), versions)
+
+	r := httptest.NewRequest(http.MethodGet, "/system/functions?resourceVersion=14", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	got, _ := strconv.Atoi(w.Header().Get(ResourceVersionHeader))
+	if got < 14 {
+		t.Fatalf("expected a resourceVersion of at least 14, got %q", w.Header().Get(ResourceVersionHeader))
+	}
+
+	functions := []types.FunctionStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &functions); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(functions) != 1 || functions[0].Name != "figlet" {
+		t.Fatalf("expected the figlet function, got %+v", functions)
+	}
+}
+
+func Test_MakeFunctionReader_InvalidResourceVersion(t *testing.T) {
+	handler := MakeFunctionReader("openfaas-fn", newReaderTestLister(), newReaderTestPodLister(), &advancingVersions{})
+
+	r := httptest.NewRequest(http.MethodGet, "/system/functions?resourceVersion=latest", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+}
+
+func Test_MakeFunctionReader_RuntimeStatus(t *testing.T) {
+	digest := "sha256:4a1b2c"
+	pods := newReaderTestPodLister(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "figlet-0",
+			Namespace: "openfaas-fn",
+			Labels:    map[string]string{"faas_function": "figlet"},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:    "figlet",
+				Ready:   true,
+				ImageID: "ghcr.io/openfaas/figlet@" + digest,
+			}},
+		},
+	})
+	handler := MakeFunctionReader("openfaas-fn", newReaderTestLister(), pods, &advancingVersions{})
+
+	r := httptest.NewRequest(http.MethodGet, "/system/functions", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	functions := []FunctionListItem{}
+	if err := json.Unmarshal(w.Body.Bytes(), &functions); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(functions) != 1 {
+		t.Fatalf("expected one function, got %+v", functions)
+	}
+	if functions[0].ImageDigest != digest {
+		t.Errorf("expected the digest %q, got %q", digest, functions[0].ImageDigest)
+	}
+	// the StatefulSet has no status, so its rollout has not been observed yet
+	if !functions[0].RolloutInProgress {
+		t.Errorf("expected a rollout in progress")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/dynamic"
+)
+
+// applyVPA creates the VerticalPodAutoscaler of a function when the recommendations
+// are enabled, a failure is logged rather than failing the deployment
+func applyVPA(ctx context.Context, logger logr.Logger, factory k8s.FunctionFactory, statefulset *appsv1.StatefulSet) {
+	if !factory.Config.VPARecommendations || factory.Dynamic == nil {
+		return
+	}
+
+	if err := k8s.ApplyVPA(ctx, factory.Dynamic, statefulset, factory.Config.CostAllocationLabels(statefulset.Labels)); err != nil {
+		logger.Error(err, "Unable to apply the VerticalPodAutoscaler")
+	}
+}
+
+// MakeRecommendationsReader returns the CPU and memory recommended by the
+// VerticalPodAutoscaler of a function, together with its current requests and limits
+func MakeRecommendationsReader(defaultNamespace string, client dynamic.Interface, reader k8s.CachedReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("function", functionName, "namespace", lookupNamespace)
+
+		statefulset, err := reader.GetStatefulSet(r.Context(), lookupNamespace, functionName)
+		if err != nil {
+			if k8s.IsNotFound(err) {
+				respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s not found", functionName)))
+				return
+			}
+			logger.Error(err, "Unable to fetch statefulset")
+			respondError(w, err)
+			return
+		}
+
+		recommendations, err := k8s.GetVPARecommendations(r.Context(), client, lookupNamespace, functionName)
+		if err != nil {
+			if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("no VerticalPodAutoscaler for function %s", functionName)))
+				return
+			}
+			logger.Error(err, "Unable to fetch the VerticalPodAutoscaler")
+			respondError(w, err)
+			return
+		}
+
+		for i, recommendation := range recommendations {
+			for _, container := range statefulset.Spec.Template.Spec.Containers {
+				if container.Name != recommendation.Container {
+					continue
+				}
+				recommendations[i].Requests = resourceStrings(container.Resources.Requests)
+				recommendations[i].Limits = resourceStrings(container.Resources.Limits)
+			}
+		}
+
+		body, err := json.Marshal(recommendations)
+		if err != nil {
+			logger.Error(err, "Failed to marshal recommendations")
+			respondError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+func resourceStrings(resources corev1.ResourceList) map[string]string {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(resources))
+	for name, quantity := range resources {
+		values[string(name)] = quantity.String()
+	}
+	return values
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_MakeRecommendationsReader(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "figlet",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	vpa := k8s.MakeVPA(statefulset)
+	unstructured.SetNestedSlice(vpa.Object, []interface{}{
+		map[string]interface{}{
+			"containerName": "figlet",
+			"target":        map[string]interface{}{"cpu": "25m"},
+		},
+	}, "status", "recommendation", "containerRecommendations")
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{k8s.VPAResource: "VerticalPodAutoscalerList"}, vpa)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(statefulset)
+	reader := k8s.NewCachedReader(fake.NewSimpleClientset(), appslister.NewStatefulSetLister(indexer), corelister.NewServiceLister(indexer))
+
+	handler := MakeRecommendationsReader("openfaas-fn", dynamicClient, reader)
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/system/function/figlet/recommendations", nil), map[string]string{"name": "figlet"})
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	recommendations := []k8s.ContainerRecommendation{}
+	if err := json.Unmarshal(w.Body.Bytes(), &recommendations); err != nil {
+		t.Fatalf("unable to decode the response: %s", err)
+	}
+	if len(recommendations) != 1 {
+		t.Fatalf("want 1 recommendation, got %d", len(recommendations))
+	}
+	if got := recommendations[0]; got.Target["cpu"] != "25m" || got.Requests["cpu"] != "500m" {
+		t.Errorf("want the target and the current requests, got %+v", got)
+	}
+
+	r = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/system/function/nodeinfo/recommendations", nil), map[string]string{"name": "nodeinfo"})
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want status 404 for an unknown function, got %d", w.Code)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ReplicaCache keeps the function status returned by the replica reader for a short
+// time, so that a burst of scrapes from the gateway is answered from memory. Entries
+// are removed as soon as the informer observes a change to the function's StatefulSet.
+//
+// Functions that are not found are cached too, so that a gateway polling a removed
+// function does not cause a request to the API server for every scrape.
+type ReplicaCache struct {
+	ttl     time.Duration
+	entries map[string]replicaCacheEntry
+	lock    sync.RWMutex
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type replicaCacheEntry struct {
+	// function is nil when the function was not found
+	function *types.FunctionStatus
+	expires  time.Time
+}
+
+// NewReplicaCache creates a ReplicaCache, a ttl of zero or less disables the cache
+func NewReplicaCache(ttl time.Duration) *ReplicaCache {
+	return &ReplicaCache{
+		ttl:     ttl,
+		entries: map[string]replicaCacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached status, ok is false when there is no entry or it has expired
+func (c *ReplicaCache) Get(namespace, name string) (function *types.FunctionStatus, ok bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.lock.RLock()
+	entry, found := c.entries[namespace+"/"+name]
+	c.lock.RUnlock()
+
+	if !found || c.now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.function, true
+}
+
+// Set stores the status of a function, function can be nil for a function that
+// was not found
+func (c *ReplicaCache) Set(namespace, name string, function *types.FunctionStatus) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// expired entries are removed here rather than with a timer, the number of
+	// entries is bounded by the functions that are being scraped
+	now := c.now()
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.entries[namespace+"/"+name] = replicaCacheEntry{
+		function: function,
+		expires:  now.Add(c.ttl),
+	}
+}
+
+// Invalidate removes the entry for a function
+func (c *ReplicaCache) Invalidate(namespace, name string) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	delete(c.entries, namespace+"/"+name)
+	c.lock.Unlock()
+}
+
+// RegisterEventHandlers invalidates the entry for a function whenever its StatefulSet
+// is added, changed or removed
+func (c *ReplicaCache) RegisterEventHandlers(informer cache.SharedIndexInformer) {
+	invalidate := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+
+		statefulset, ok := obj.(*appsv1.StatefulSet)
+		if !ok || statefulset == nil {
+			return
+		}
+		c.Invalidate(statefulset.Namespace, statefulset.Name)
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: invalidate,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			invalidate(newObj)
+		},
+		DeleteFunc: invalidate,
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_ReplicaCache_Expires(t *testing.T) {
+	now := time.Now()
+	replicaCache := NewReplicaCache(time.Second * 2)
+	replicaCache.now = func() time.Time { return now }
+
+	replicaCache.Set("openfaas-fn", "figlet", &types.FunctionStatus{Name: "figlet", Replicas: 2})
+	replicaCache.Set("openfaas-fn", "removed", nil)
+
+	if function, ok := replicaCache.Get("openfaas-fn", "figlet"); !ok || function.Replicas != 2 {
+		t.Fatalf("expected a cached status with 2 replicas, got %v %v", function, ok)
+	}
+	if function, ok := replicaCache.Get("openfaas-fn", "removed"); !ok || function != nil {
+		t.Fatalf("expected a cached not found entry, got %v %v", function, ok)
+	}
+
+	now = now.Add(time.Second * 3)
+	if _, ok := replicaCache.Get("openfaas-fn", "figlet"); ok {
+		t.Fatalf("expected the entry to have expired")
+	}
+}
+
+func Test_ReplicaCache_Invalidate(t *testing.T) {
+	replicaCache := NewReplicaCache(time.Minute)
+	replicaCache.Set("openfaas-fn", "figlet", &types.FunctionStatus{Name: "figlet"})
+
+	replicaCache.Invalidate("openfaas-fn", "figlet")
+	if _, ok := replicaCache.Get("openfaas-fn", "figlet"); ok {
+		t.Fatalf("expected the entry to be removed")
+	}
+}
+
+func Test_ReplicaCache_Disabled(t *testing.T) {
+	for _, replicaCache := range []*ReplicaCache{nil, NewReplicaCache(0)} {
+		replicaCache.Set("openfaas-fn", "figlet", &types.FunctionStatus{Name: "figlet"})
+		if _, ok := replicaCache.Get("openfaas-fn", "figlet"); ok {
+			t.Fatalf("expected a disabled cache to never return an entry")
+		}
+	}
+}
+
+func Test_MakeReplicaReader_UsesCache(t *testing.T) {
+	replicas := int32(1)
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet", Image: "ghcr.io/openfaas/figlet:latest"}},
+				},
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset(statefulset)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	reader := k8s.NewCachedReader(client, appslister.NewStatefulSetLister(indexer), corelister.NewServiceLister(indexer))
+
+	handler := MakeReplicaReader("openfaas-fn", reader, NewReplicaCache(time.Minute), &advancingVersions{})
+	scrape := func() int {
+		r := httptest.NewRequest(http.MethodGet, "/system/function/figlet", nil)
+		r = mux.SetURLVars(r, map[string]string{"name": "figlet"})
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	if code := scrape(); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+
+	client.AppsV1().StatefulSets("openfaas-fn").Delete(context.Background(), "figlet", metav1.DeleteOptions{})
+	client.ClearActions()
+
+	if code := scrape(); code != http.StatusOK {
+		t.Fatalf("expected the cached status, got %d", code)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Fatalf("expected no requests to the API server, got %v", actions)
+	}
+}
+
+func Test_MakeReplicaReader_ResourceVersionSkipsCache(t *testing.T) {
+	replicas := int32(1)
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet", Image: "ghcr.io/openfaas/figlet:latest"}},
+				},
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset(statefulset)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	reader := k8s.NewCachedReader(client, appslister.NewStatefulSetLister(indexer), corelister.NewServiceLister(indexer))
+
+	handler := MakeReplicaReader("openfaas-fn", reader, NewReplicaCache(time.Minute), &advancingVersions{version: 10})
+	scrape := func(target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r = mux.SetURLVars(r, map[string]string{"name": "figlet"})
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := scrape("/system/function/figlet?resourceVersion=14")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if got, _ := strconv.Atoi(w.Header().Get(ResourceVersionHeader)); got < 14 {
+		t.Fatalf("expected a resourceVersion of at least 14, got %q", w.Header().Get(ResourceVersionHeader))
+	}
+
+	client.AppsV1().StatefulSets("openfaas-fn").Delete(context.Background(), "figlet", metav1.DeleteOptions{})
+
+	if w := scrape("/system/function/figlet?resourceVersion=20"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected the cache to be skipped for a resourceVersion, got %d", w.Code)
+	}
+}
@@ -5,25 +5,31 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
 	types "github.com/openfaas/faas-provider/types"
 	"k8s.io/apimachinery/pkg/api/errors"
-	v1 "k8s.io/client-go/listers/apps/v1"
-	glog "k8s.io/klog"
 )
 
-// MaxReplicas licensed for OpenFaaS CE is 5/5
-const MaxReplicas = 20000
-
-// MakeReplicaReader reads the amount of replicas for a statefulset
-func MakeReplicaReader(defaultNamespace string, lister v1.StatefulSetLister) http.HandlerFunc {
+// MaxReplicas is the maximum replicas of a function when none is configured, see
+// k8s.ReplicaLimits for the maximum of a namespace or a function
+const MaxReplicas = k8s.DefaultMaxReplicas
+
+// MakeReplicaReader reads the amount of replicas for a statefulset, the result is
+// cached in replicaCache which may be nil to always read the StatefulSet.
+//
+// The resourceVersion observed by the informer cache is returned in the
+// ResourceVersionHeader. With the resourceVersion query parameter from a deploy or
+// update, the handler waits until the cache has observed the write and skips
+// replicaCache.
+func MakeReplicaReader(defaultNamespace string, reader k8s.CachedReader, replicaCache *ReplicaCache, versions ResourceVersionSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		vars := mux.Vars(r)
@@ -39,46 +45,68 @@ func MakeReplicaReader(defaultNamespace string, lister v1.StatefulSetLister) htt
 		}
 
 		if lookupNamespace != defaultNamespace {
-			http.Error(w, fmt.Sprintf("namespace must be: %s", defaultNamespace), http.StatusBadRequest)
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
 			return
 		}
 
+		requested := q.Get("resourceVersion")
+		if requested != "" {
+			if err := waitForResourceVersion(r.Context(), versions, requested); err != nil {
+				respondError(w, err)
+				return
+			}
+		}
+
+		// read the version before the function, so the function is at least as new
+		// as the token
+		resourceVersion := versions.LastSyncResourceVersion()
+
+		logger := logging.FromContext(r.Context()).WithValues("function", functionName, "namespace", lookupNamespace)
 		s := time.Now()
 
-		function, err := getService(lookupNamespace, functionName, lister)
-		if err != nil {
-			log.Printf("Unable to fetch service: %s %s\n", functionName, namespace)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		var function *types.FunctionStatus
+		cached := false
+		if requested == "" {
+			function, cached = replicaCache.Get(lookupNamespace, functionName)
+		}
+		if !cached {
+			var err error
+			function, err = getService(r.Context(), lookupNamespace, functionName, reader)
+			if err != nil {
+				logger.Error(err, "Unable to fetch service")
+				respondError(w, err)
+				return
+			}
+
+			replicaCache.Set(lookupNamespace, functionName, function)
 		}
 
 		if function == nil {
-			w.WriteHeader(http.StatusNotFound)
+			respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s not found", functionName)))
 			return
 		}
 
 		d := time.Since(s)
-		log.Printf("Replicas: %s.%s, (%d/%d) %dms\n", functionName, lookupNamespace, function.AvailableReplicas, function.Replicas, d.Milliseconds())
+		logger.V(1).Info("Replicas", "availableReplicas", function.AvailableReplicas, "replicas", function.Replicas, "ms", d.Milliseconds())
 
 		functionBytes, err := json.Marshal(function)
 		if err != nil {
-			glog.Errorf("Failed to marshal function: %s", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Failed to marshal function"))
+			logger.Error(err, "Failed to marshal function")
+			respondError(w, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(ResourceVersionHeader, resourceVersion)
 		w.WriteHeader(http.StatusOK)
 		w.Write(functionBytes)
 	}
 }
 
 // getService returns a function/service or nil if not found
-func getService(functionNamespace string, functionName string, lister v1.StatefulSetLister) (*types.FunctionStatus, error) {
+func getService(ctx context.Context, functionNamespace string, functionName string, reader k8s.CachedReader) (*types.FunctionStatus, error) {
 
-	item, err := lister.StatefulSets(functionNamespace).
-		Get(functionName)
+	item, err := reader.GetStatefulSet(ctx, functionNamespace, functionName)
 
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -5,24 +5,29 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
 	"github.com/openfaas/faas-provider/types"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
-// MakeReplicaUpdater updates desired count of replicas
-func MakeReplicaUpdater(defaultNamespace string, clientset *kubernetes.Clientset) http.HandlerFunc {
+// MakeReplicaUpdater updates desired count of replicas, the count is dampened by the
+// stabilizer and capped at the maximum of the function from limits. A function can
+// only be scaled to zero when allowZero is set or its com.openfaas.scale.allow-zero
+// annotation allows it.
+//
+// With wait=true the handler blocks until the StatefulSet has the new count of ready
+// replicas, or until the timeout query parameter, and returns the ScaleProgress so
+// that the caller knows when the added capacity is serving.
+func MakeReplicaUpdater(defaultNamespace string, clientset kubernetes.Interface, limits *k8s.ReplicaLimits, allowZero bool, stabilizer *ScaleStabilizer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Update replicas")
-
 		vars := mux.Vars(r)
 
 		functionName := vars["name"]
@@ -36,7 +41,15 @@ func MakeReplicaUpdater(defaultNamespace string, clientset *kubernetes.Clientset
 		}
 
 		if lookupNamespace != defaultNamespace {
-			http.Error(w, fmt.Sprintf("namespace must be: %s", defaultNamespace), http.StatusBadRequest)
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("function", functionName, "namespace", lookupNamespace)
+
+		waitForReady, timeout, err := parseWait(q)
+		if err != nil {
+			respondError(w, badRequest("%s", err))
 			return
 		}
 
@@ -47,20 +60,12 @@ func MakeReplicaUpdater(defaultNamespace string, clientset *kubernetes.Clientset
 			bytesIn, _ := io.ReadAll(r.Body)
 			marshalErr := json.Unmarshal(bytesIn, &req)
 			if marshalErr != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				msg := "Cannot parse request. Please pass valid JSON."
-				w.Write([]byte(msg))
-				log.Println(msg, marshalErr)
+				logger.Error(marshalErr, "Unable to parse scale request")
+				respondError(w, badRequest("unable to unmarshal request: %s", marshalErr))
 				return
 			}
 		}
 
-		if req.Replicas == 0 {
-			http.Error(w, "replicas cannot be set to 0 in OpenFaaS CE",
-				http.StatusBadRequest)
-			return
-		}
-
 		options := metav1.GetOptions{
 			TypeMeta: metav1.TypeMeta{
 				Kind:       "StatefulSet",
@@ -68,33 +73,73 @@ func MakeReplicaUpdater(defaultNamespace string, clientset *kubernetes.Clientset
 			},
 		}
 
-		statefulset, err := clientset.AppsV1().StatefulSets(lookupNamespace).Get(context.TODO(), functionName, options)
+		statefulset, err := clientset.AppsV1().StatefulSets(lookupNamespace).Get(r.Context(), functionName, options)
 
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Unable to lookup function statefulset " + functionName))
-			log.Println(err)
+			if !k8s.IsNotFound(err) {
+				logger.Error(err, "Unable to lookup function statefulset")
+			}
+			respondError(w, fmt.Errorf("unable to lookup function statefulset %s: %w", functionName, err))
+			return
+		}
+
+		if req.Replicas == 0 && !k8s.AllowsZeroReplicas(statefulset.Annotations, allowZero) {
+			respondError(w, invalid(fmt.Errorf("replicas cannot be set to 0 in OpenFaaS CE")))
 			return
 		}
 
 		oldReplicas := *statefulset.Spec.Replicas
-		replicas := int32(req.Replicas)
-		if replicas >= MaxReplicas {
-			replicas = MaxReplicas
+		replicas := stabilizer.Stabilize(lookupNamespace+"/"+functionName, oldReplicas, int32(req.Replicas))
+		if max := limits.FunctionMax(r.Context(), lookupNamespace, statefulset.Spec.Template.Labels); replicas > max {
+			replicas = max
 		}
 
-		log.Printf("Set replicas - %s %s, %d/%d\n", functionName, lookupNamespace, replicas, oldReplicas)
+		logger.Info("Set replicas", "replicas", replicas, "previousReplicas", oldReplicas, "requestedReplicas", req.Replicas)
 
-		statefulset.Spec.Replicas = &replicas
+		if replicas == 0 && oldReplicas > 0 {
+			if err := k8s.SavePreviousReplicas(r.Context(), clientset, lookupNamespace, functionName, oldReplicas); err != nil {
+				logger.Error(err, "Unable to record the previous replicas")
+			}
+		}
 
-		if _, err = clientset.AppsV1().StatefulSets(lookupNamespace).
-			Update(context.TODO(), statefulset, metav1.UpdateOptions{}); err != nil {
+		// only the replicas are applied, so that scaling does not conflict with an
+		// update of the function that is in progress
+		if err = k8s.ApplyStatefulSetReplicas(r.Context(), clientset, lookupNamespace, functionName, replicas, k8s.ScaleFieldManager); err != nil {
 
-			log.Printf("unable to update function statefulset: %s, %s", functionName, err)
-			http.Error(w, fmt.Sprintf("unable to update function statefulset: %s", functionName), http.StatusInternalServerError)
+			logger.Error(err, "Unable to update function statefulset")
+			respondError(w, fmt.Errorf("unable to update function statefulset %s: %w", functionName, err))
 			return
 		}
 
-		w.WriteHeader(http.StatusAccepted)
+		if !waitForReady {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		progress, err := k8s.WaitForReadyReplicas(r.Context(), clientset, lookupNamespace, functionName, replicas, timeout)
+		if err != nil {
+			logger.Error(err, "Unable to read the progress of the function statefulset")
+			respondError(w, fmt.Errorf("unable to read the progress of function statefulset %s: %w", functionName, err))
+			return
+		}
+
+		logger.Info("Waited for replicas", "ready", progress.Ready, "readyReplicas", progress.ReadyReplicas)
+
+		res, err := json.Marshal(progress)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		// the scale was accepted either way, Ready is false when the timeout was
+		// reached before all of the replicas were ready
+		status := http.StatusOK
+		if !progress.Ready {
+			status = http.StatusAccepted
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(res)
 	}
 }
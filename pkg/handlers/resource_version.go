@@ -0,0 +1,60 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ResourceVersionHeader carries a consistency token for the list of functions.
+//
+// The deploy and update handlers return the resourceVersion of the StatefulSet that
+// was written, and the function and replica readers return the resourceVersion that
+// their cache has observed. A client that needs to read its own write passes the
+// token from the write as the resourceVersion query parameter of the list or of the
+// status of a function, which then waits until the cache has caught up.
+const ResourceVersionHeader = "X-Resource-Version"
+
+// resourceVersionTimeout is how long a list waits for the cache to observe the
+// requested resourceVersion
+const resourceVersionTimeout = time.Second * 5
+
+// ResourceVersionSource returns the latest resourceVersion observed by a cache, it is
+// implemented by cache.SharedIndexInformer
+type ResourceVersionSource interface {
+	LastSyncResourceVersion() string
+}
+
+// waitForResourceVersion blocks until the source has observed at least the requested
+// resourceVersion. The values are compared as numbers, which holds for the API server
+// backed by etcd, and a value that is not a number is rejected.
+func waitForResourceVersion(ctx context.Context, source ResourceVersionSource, requested string) error {
+	want, err := strconv.ParseUint(requested, 10, 64)
+	if err != nil {
+		return badRequest("invalid resourceVersion: %q", requested)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resourceVersionTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+
+	for {
+		if got, err := strconv.ParseUint(source.LastSyncResourceVersion(), 10, 64); err == nil && got >= want {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return withStatus(http.StatusGatewayTimeout, fmt.Errorf("timed out waiting for resourceVersion %s, the cache is at %q",
+				requested, source.LastSyncResourceVersion()))
+		case <-ticker.C:
+		}
+	}
+}
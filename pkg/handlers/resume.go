@@ -0,0 +1,106 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MakeResumeHandler scales a function that is at zero replicas back to the count it
+// had before it was scaled to zero, from its com.openfaas.scale.previous-replicas
+// annotation, capped at the maximum of the function from limits. A function that is
+// already running is left as it is.
+//
+// wait=true blocks until the replicas are ready, in the same way as the replica
+// updater, and returns the ScaleProgress.
+func MakeResumeHandler(defaultNamespace string, clientset kubernetes.Interface, limits *k8s.ReplicaLimits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		q := r.URL.Query()
+		lookupNamespace := defaultNamespace
+		if namespace := q.Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		waitForReady, timeout, err := parseWait(q)
+		if err != nil {
+			respondError(w, badRequest("%s", err))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("function", functionName, "namespace", lookupNamespace)
+
+		statefulset, err := clientset.AppsV1().StatefulSets(lookupNamespace).Get(r.Context(), functionName, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s not found", functionName)))
+				return
+			}
+			logger.Error(err, "Unable to lookup function statefulset")
+			respondError(w, fmt.Errorf("unable to lookup function statefulset %s: %w", functionName, err))
+			return
+		}
+
+		replicas := int32(1)
+		if statefulset.Spec.Replicas != nil {
+			replicas = *statefulset.Spec.Replicas
+		}
+
+		if replicas == 0 {
+			replicas = k8s.PreviousReplicas(statefulset.Annotations)
+			if max := limits.FunctionMax(r.Context(), lookupNamespace, statefulset.Spec.Template.Labels); replicas > max {
+				replicas = max
+			}
+
+			logger.Info("Resuming function", "replicas", replicas)
+			if err := k8s.ApplyStatefulSetReplicas(r.Context(), clientset, lookupNamespace, functionName, replicas, k8s.ScaleFieldManager); err != nil {
+				logger.Error(err, "Unable to update function statefulset")
+				respondError(w, fmt.Errorf("unable to update function statefulset %s: %w", functionName, err))
+				return
+			}
+		}
+
+		if !waitForReady {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		progress, err := k8s.WaitForReadyReplicas(r.Context(), clientset, lookupNamespace, functionName, replicas, timeout)
+		if err != nil {
+			logger.Error(err, "Unable to read the progress of the function statefulset")
+			respondError(w, fmt.Errorf("unable to read the progress of function statefulset %s: %w", functionName, err))
+			return
+		}
+
+		res, err := json.Marshal(progress)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		status := http.StatusOK
+		if !progress.Ready {
+			status = http.StatusAccepted
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(res)
+	}
+}
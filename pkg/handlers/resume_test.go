@@ -0,0 +1,107 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newResumeClient(replicas int32, annotations map[string]string, applied *[]int32) *fake.Clientset {
+	client := fake.NewSimpleClientset(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "figlet",
+			Namespace:   "openfaas-fn",
+			Annotations: annotations,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{k8s.LabelMaxReplicas: "5"}},
+			},
+		},
+	})
+
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), obj); err != nil {
+			return true, nil, err
+		}
+		*applied = append(*applied, *obj.Spec.Replicas)
+		return true, obj, nil
+	})
+	return client
+}
+
+func Test_MakeResumeHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		replicas    int32
+		annotations map[string]string
+		want        []int32
+	}{
+		{
+			name:        "restores the previous replicas",
+			annotations: map[string]string{k8s.AnnotationPreviousReplicas: "3"},
+			want:        []int32{3},
+		},
+		{
+			name:        "caps the previous replicas at the maximum",
+			annotations: map[string]string{k8s.AnnotationPreviousReplicas: "8"},
+			want:        []int32{5},
+		},
+		{
+			name: "resumes with one replica without the annotation",
+			want: []int32{1},
+		},
+		{
+			name:        "leaves a running function",
+			replicas:    2,
+			annotations: map[string]string{k8s.AnnotationPreviousReplicas: "3"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var applied []int32
+			client := newResumeClient(c.replicas, c.annotations, &applied)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/system/function/{name}/resume", MakeResumeHandler("openfaas-fn", client, k8s.NewReplicaLimits(10, nil)))
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/function/figlet/resume", nil))
+
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("want status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+			}
+			if len(applied) != len(c.want) || (len(applied) > 0 && applied[0] != c.want[0]) {
+				t.Errorf("want replicas applied: %v, got: %v", c.want, applied)
+			}
+		})
+	}
+}
+
+func Test_MakeResumeHandler_NotFound(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/system/function/{name}/resume", MakeResumeHandler("openfaas-fn", fake.NewSimpleClientset(), nil))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/function/figlet/resume", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
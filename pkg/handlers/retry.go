@@ -0,0 +1,132 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// retryBurst is the most retries that can be made before any invocations have
+// added to the budget
+const retryBurst = 10
+
+// RetryConfig is the retry policy of the invocation proxy
+type RetryConfig struct {
+	// Attempts is the most retries of one invocation, 0 disables retries
+	Attempts int
+
+	// Backoff is the wait before each retry
+	Backoff time.Duration
+
+	// Budget is the most retries as a percentage of the invocations, so that
+	// retries do not multiply the load on a function that is failing as a whole
+	Budget int
+
+	// MaxBodySize is the largest request body that is buffered so that it can be
+	// sent again, invocations with a larger or streamed body are not retried
+	MaxBodySize int64
+}
+
+// Retrier retries invocations that failed to reach a function, or were rejected
+// by a replica that is not ready, with a shared budget for all functions
+type Retrier struct {
+	config RetryConfig
+
+	lock   sync.Mutex
+	tokens float64
+}
+
+// NewRetrier creates a Retrier, a nil Retrier does not retry
+func NewRetrier(config RetryConfig) *Retrier {
+	return &Retrier{
+		config: config,
+		tokens: retryBurst,
+	}
+}
+
+// replayable is true when the request can be sent again, its body must then be
+// buffered
+func (r *Retrier) replayable(req *http.Request) bool {
+	if r == nil || r.config.Attempts <= 0 {
+		return false
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	return req.ContentLength >= 0 && req.ContentLength <= r.config.MaxBodySize
+}
+
+// deposit adds the share of an invocation to the budget
+func (r *Retrier) deposit() {
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.tokens += float64(r.config.Budget) / 100
+	if r.tokens > retryBurst {
+		r.tokens = retryBurst
+	}
+}
+
+// withdraw takes a retry from the budget, it is false when the budget is spent
+func (r *Retrier) withdraw() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// wait for the backoff, it is false when ctx is cancelled first
+func (r *Retrier) wait(ctx context.Context) bool {
+	if r.config.Backoff <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(r.config.Backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// failedInvocation is true when the function was not reached or the replica was
+// not able to serve the invocation, errors returned by the function itself are
+// not retried
+func failedInvocation(ctx context.Context, response *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return notConnected(err)
+	}
+	return response.StatusCode == http.StatusBadGateway || response.StatusCode == http.StatusServiceUnavailable
+}
+
+// notConnected is true when no connection could be made to the replica, so the
+// request was not written. Other errors, such as a timeout, may happen after the
+// function has received the request and it is not sent again.
+func notConnected(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && !opErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
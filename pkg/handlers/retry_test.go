@@ -0,0 +1,167 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+)
+
+// roundRobinResolver resolves each of the URLs in turn, like a function with more
+// than one replica
+type roundRobinResolver struct {
+	urls []url.URL
+	next int32
+}
+
+func (r *roundRobinResolver) Resolve(name string) (url.URL, error) {
+	i := atomic.AddInt32(&r.next, 1) - 1
+	return r.urls[int(i)%len(r.urls)], nil
+}
+
+func newReplicas(t *testing.T) (*roundRobinResolver, *int32) {
+	var failed int32
+	crashing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failed, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(crashing.Close)
+
+	ready := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	t.Cleanup(ready.Close)
+
+	crashingURL, _ := url.Parse(crashing.URL)
+	readyURL, _ := url.Parse(ready.URL)
+	return &roundRobinResolver{urls: []url.URL{*crashingURL, *readyURL}}, &failed
+}
+
+func Test_MakeProxyHandler_RetriesOnAnotherReplica(t *testing.T) {
+	resolver, failed := newReplicas(t)
+	retrier := NewRetrier(RetryConfig{Attempts: 2, Budget: 20, MaxBodySize: 1024})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(NewProxyClient(ProxyConfig{Timeout: time.Second * 5}), resolver, retrier, nil, nil))
+
+	r := httptest.NewRequest(http.MethodPost, "http://gateway:8080/function/figlet", strings.NewReader("hi"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || w.Body.String() != "hi" {
+		t.Fatalf("want the body from the ready replica, got %d: %q", w.Code, w.Body.String())
+	}
+	if atomic.LoadInt32(failed) != 1 {
+		t.Errorf("want 1 request to the crashing replica, got %d", atomic.LoadInt32(failed))
+	}
+}
+
+func Test_MakeProxyHandler_DoesNotRetryStreamedBody(t *testing.T) {
+	resolver, _ := newReplicas(t)
+	retrier := NewRetrier(RetryConfig{Attempts: 2, Budget: 20, MaxBodySize: 1024})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(NewProxyClient(ProxyConfig{Timeout: time.Second * 5}), resolver, retrier, nil, nil))
+
+	r := httptest.NewRequest(http.MethodPost, "http://gateway:8080/function/figlet", io.NopCloser(strings.NewReader("hi")))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want the response of the crashing replica, got %d", w.Code)
+	}
+}
+
+func Test_MakeProxyHandler_OpensCircuitOfCrashingReplica(t *testing.T) {
+	resolver, _ := newReplicas(t)
+	breaker := k8s.NewCircuitBreaker(2, time.Minute)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(NewProxyClient(ProxyConfig{Timeout: time.Second * 5}), resolver, nil, breaker, nil))
+
+	for i := 0; i < 4; i++ {
+		r := httptest.NewRequest(http.MethodGet, "http://gateway:8080/function/figlet", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if !breaker.Open(resolver.urls[0].Host) {
+		t.Error("want the circuit of the crashing replica to be open")
+	}
+	if breaker.Open(resolver.urls[1].Host) {
+		t.Error("want the circuit of the ready replica to be closed")
+	}
+}
+
+func Test_failedInvocation(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: "http://10.0.0.1:8080", Err: &net.OpError{
+		Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED},
+	}}
+	dialTimeout := &url.Error{Op: "Post", URL: "http://10.0.0.1:8080", Err: &net.OpError{
+		Op: "dial", Net: "tcp", Err: context.DeadlineExceeded,
+	}}
+	reset := &url.Error{Op: "Post", URL: "http://10.0.0.1:8080", Err: &net.OpError{
+		Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET},
+	}}
+
+	cases := []struct {
+		name   string
+		status int
+		err    error
+		want   bool
+	}{
+		{name: "connection refused", err: refused, want: true},
+		{name: "dial timeout", err: dialTimeout, want: false},
+		{name: "reset after the request was written", err: reset, want: false},
+		{name: "response ended early", err: &url.Error{Op: "Post", URL: "http://10.0.0.1:8080", Err: io.ErrUnexpectedEOF}, want: false},
+		{name: "bad gateway", status: http.StatusBadGateway, want: true},
+		{name: "service unavailable", status: http.StatusServiceUnavailable, want: true},
+		{name: "error of the function", status: http.StatusInternalServerError, want: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var response *http.Response
+			if tc.err == nil {
+				response = &http.Response{StatusCode: tc.status}
+			}
+			if got := failedInvocation(context.Background(), response, tc.err); got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_Retrier_Budget(t *testing.T) {
+	retrier := NewRetrier(RetryConfig{Attempts: 1, Budget: 50})
+
+	for i := 0; i < retryBurst; i++ {
+		if !retrier.withdraw() {
+			t.Fatalf("want a burst of %d retries, got %d", retryBurst, i)
+		}
+	}
+	if retrier.withdraw() {
+		t.Fatal("want the budget to be spent")
+	}
+
+	retrier.deposit()
+	retrier.deposit()
+	if !retrier.withdraw() {
+		t.Error("want a retry for every 2 invocations")
+	}
+}
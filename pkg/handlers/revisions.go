@@ -0,0 +1,92 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PurgeRevisionsResponse lists the ControllerRevisions that were deleted
+type PurgeRevisionsResponse struct {
+	Deleted []string `json:"deleted"`
+}
+
+// MakePurgeRevisionsHandler deletes the old ControllerRevisions of a function with
+// a DELETE. keep is the number of old revisions that are left, 0 by default, the
+// current and update revisions and the revisions of running Pods are always kept.
+func MakePurgeRevisionsHandler(defaultNamespace string, clientset kubernetes.Interface, apiTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+
+		q := r.URL.Query()
+		lookupNamespace := defaultNamespace
+		if namespace := q.Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		keep := int32(0)
+		if value := q.Get("keep"); value != "" {
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || n < 0 {
+				respondError(w, badRequest("keep must be a whole number of 0 or more, got %q", value))
+				return
+			}
+			keep = int32(n)
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("function", functionName, "namespace", lookupNamespace)
+
+		ctx, cancel := k8s.WithAPITimeout(r.Context(), apiTimeout)
+		defer cancel()
+
+		statefulset, err := clientset.AppsV1().StatefulSets(lookupNamespace).Get(ctx, functionName, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				respondError(w, withStatus(http.StatusNotFound, fmt.Errorf("function %s not found", functionName)))
+				return
+			}
+			logger.Error(err, "Unable to lookup function statefulset")
+			respondError(w, fmt.Errorf("unable to lookup function statefulset %s: %w", functionName, err))
+			return
+		}
+
+		deleted, err := k8s.PruneRevisions(ctx, clientset, statefulset, keep)
+		if err != nil {
+			logger.Error(err, "Unable to purge the revisions of the function", "deleted", len(deleted))
+			respondError(w, fmt.Errorf("unable to purge the revisions of function %s: %w", functionName, err))
+			return
+		}
+
+		logger.Info("Purged function revisions", "deleted", len(deleted), "keep", keep)
+
+		if deleted == nil {
+			deleted = []string{}
+		}
+		res, err := json.Marshal(PurgeRevisionsResponse{Deleted: deleted})
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(res)
+	}
+}
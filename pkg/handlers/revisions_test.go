@@ -0,0 +1,72 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_MakePurgeRevisionsHandler(t *testing.T) {
+	controller := true
+	owner := []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet", UID: "1234", Controller: &controller}}
+	labels := map[string]string{"faas_function": "figlet"}
+
+	client := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "1234"},
+			Spec:       appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+			Status:     appsv1.StatefulSetStatus{CurrentRevision: "figlet-3", UpdateRevision: "figlet-3"},
+		},
+		&appsv1.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Name: "figlet-1", Namespace: "openfaas-fn", Labels: labels, OwnerReferences: owner}, Revision: 1},
+		&appsv1.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Name: "figlet-2", Namespace: "openfaas-fn", Labels: labels, OwnerReferences: owner}, Revision: 2},
+		&appsv1.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Name: "figlet-3", Namespace: "openfaas-fn", Labels: labels, OwnerReferences: owner}, Revision: 3},
+	)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/system/function/{name}/revisions", MakePurgeRevisionsHandler("openfaas-fn", client, 0))
+
+	cases := []struct {
+		name       string
+		url        string
+		wantStatus int
+		want       []string
+	}{
+		{name: "rejects an invalid keep", url: "/system/function/figlet/revisions?keep=-1", wantStatus: http.StatusBadRequest},
+		{name: "unknown function", url: "/system/function/env/revisions", wantStatus: http.StatusNotFound},
+		{name: "keeps one old revision", url: "/system/function/figlet/revisions?keep=1", wantStatus: http.StatusOK, want: []string{"figlet-1"}},
+		{name: "purges the old revisions", url: "/system/function/figlet/revisions", wantStatus: http.StatusOK, want: []string{"figlet-2"}},
+		{name: "nothing left to purge", url: "/system/function/figlet/revisions", wantStatus: http.StatusOK, want: []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, tc.url, nil))
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			res := PurgeRevisionsResponse{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("unable to decode the response: %s", err)
+			}
+			if !reflect.DeepEqual(res.Deleted, tc.want) {
+				t.Errorf("want deleted %v, got %v", tc.want, res.Deleted)
+			}
+		})
+	}
+}
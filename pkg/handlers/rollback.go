@@ -0,0 +1,124 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// rollbackTimeout bounds a rollback, which is not cancelled with the request so
+// that a client that disconnects does not leave a function half updated
+const rollbackTimeout = 30 * time.Second
+
+// withRollback adds the outcome of a rollback to the error of the step that failed
+func withRollback(err, rollbackErr error) error {
+	if rollbackErr != nil {
+		return fmt.Errorf("%w, unable to roll back: %s", err, rollbackErr)
+	}
+	return fmt.Errorf("%w, the changes were rolled back", err)
+}
+
+// rollbackDeploy deletes the StatefulSet that a deploy created, the objects owned by
+// it such as the SecretProviderClass are garbage collected
+func rollbackDeploy(logger logr.Logger, factory k8s.FunctionFactory, created *appsv1.StatefulSet) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	propagation := metav1.DeletePropagationBackground
+	err := factory.Client.AppsV1().StatefulSets(created.Namespace).Delete(ctx, created.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		Preconditions:     &metav1.Preconditions{UID: &created.UID},
+	})
+	if err != nil {
+		logger.Error(err, "Unable to roll back statefulset")
+		return err
+	}
+	logger.Info("Statefulset removed after a failed deploy")
+	return nil
+}
+
+// rollbackStatefulSet restores the StatefulSet of a function to prior, the state
+// before an update, together with the objects that the update applied from it,
+// such as the SecretProviderClass, the route or the pre-warm DaemonSet. The current
+// replicas are kept, as they may have been scaled since.
+func rollbackStatefulSet(factory k8s.FunctionFactory, prior *appsv1.StatefulSet) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	statefulsets := factory.Client.AppsV1().StatefulSets(prior.Namespace)
+	var updated, restored *appsv1.StatefulSet
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := statefulsets.Get(ctx, prior.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		updated = current.DeepCopy()
+
+		current.Labels = prior.Labels
+		current.Annotations = prior.Annotations
+		replicas := current.Spec.Replicas
+		current.Spec = *prior.Spec.DeepCopy()
+		current.Spec.Replicas = replicas
+
+		restored, err = statefulsets.Update(ctx, current, metav1.UpdateOptions{FieldManager: k8s.FieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to restore StatefulSet: %w", err)
+	}
+
+	if err := k8s.SyncSecretProviderClass(ctx, factory.Dynamic, prior.Name, prior.Namespace, k8s.ReadFunctionSecretsSpec(*prior),
+		factory.Config.SecretsStore, k8s.StatefulSetOwner(restored), factory.Config.CostAllocationLabels(restored.Labels)); err != nil {
+		return fmt.Errorf("unable to restore SecretProviderClass: %w", err)
+	}
+
+	logger := logging.FromContext(ctx)
+	applyVPA(ctx, logger, factory, restored)
+	applyMeshPolicy(ctx, logger, factory, restored)
+	applyPrewarm(ctx, logger, factory, restored, updated)
+
+	labels, annotations := k8s.FunctionMetadata(prior)
+	if err := syncFunctionResources(ctx, factory, restored, annotations, labels, updated); err != nil {
+		return fmt.Errorf("unable to restore the resources of the function: %w", err)
+	}
+	return nil
+}
+
+// rollbackService restores the Service of a function to prior, the state before an
+// update
+func rollbackService(factory k8s.FunctionFactory, prior *corev1.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	services := factory.Client.CoreV1().Services(prior.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := services.Get(ctx, prior.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		current.Labels = prior.Labels
+		current.Annotations = prior.Annotations
+		current.Spec.Ports = prior.Spec.Ports
+		current.Spec.Selector = prior.Spec.Selector
+
+		_, err = services.Update(ctx, current, metav1.UpdateOptions{FieldManager: k8s.FieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to restore Service: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newRollbackFactory(client *fake.Clientset) k8s.FunctionFactory {
+	factory := k8s.NewFunctionFactory(client, k8s.DeploymentConfig{
+		LivenessProbe:  &k8s.ProbeConfig{},
+		ReadinessProbe: &k8s.ProbeConfig{},
+	}, nil)
+	factory.NamespaceAnnotations = k8s.NewNamespaceAnnotations(client)
+	return factory
+}
+
+func Test_MakeDeployHandler_RollsBackWhenServiceFails(t *testing.T) {
+	// a Service that can not be created makes the deploy fail after the StatefulSet
+	// was created
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewAlreadyExists(corev1.Resource("services"), "figlet")
+	})
+	handler := MakeDeployHandler("openfaas-fn", newRollbackFactory(client))
+
+	body := `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0"}`
+	req := httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("want status %d, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "rolled back") {
+		t.Errorf("want the error to report the rollback, got %q", rr.Body.String())
+	}
+
+	if _, err := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{}); err == nil {
+		t.Errorf("want the StatefulSet to be removed")
+	}
+}
+
+func Test_rollbackStatefulSet_RestoresPriorSpec(t *testing.T) {
+	replicas := int32(2)
+	existing := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "figlet",
+			Namespace:   "openfaas-fn",
+			Annotations: map[string]string{"com.openfaas.owner": "team-a"},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"faas_function": "figlet"}},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet", Image: "ghcr.io/openfaas/figlet:0.1.0"}},
+				},
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset(existing)
+	factory := newRollbackFactory(client)
+
+	request := types.FunctionDeployment{Service: "figlet", Image: "ghcr.io/openfaas/figlet:0.2.0"}
+	_, prior, _, err := updateStatefulSetSpec(context.Background(), "openfaas-fn", factory, request, map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the function is scaled while it is being updated
+	scaled, _ := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	scaledReplicas := int32(5)
+	scaled.Spec.Replicas = &scaledReplicas
+	if _, err := client.AppsV1().StatefulSets("openfaas-fn").Update(context.Background(), scaled, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := rollbackStatefulSet(factory, prior); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, _ := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if image := got.Spec.Template.Spec.Containers[0].Image; image != "ghcr.io/openfaas/figlet:0.1.0" {
+		t.Errorf("want the image to be restored, got %s", image)
+	}
+	if owner := got.Annotations["com.openfaas.owner"]; owner != "team-a" {
+		t.Errorf("want the annotations to be restored, got %v", got.Annotations)
+	}
+	if got.Spec.Replicas == nil || *got.Spec.Replicas != scaledReplicas {
+		t.Errorf("want the current replicas to be kept, got %v", got.Spec.Replicas)
+	}
+}
+
+func Test_MakeUpdateHandler_RollsBackResourcesWhenServiceFails(t *testing.T) {
+	replicas := int32(1)
+	existing := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"faas_function": "figlet"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"faas_function": "figlet"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet", Image: "ghcr.io/openfaas/figlet:0.1.0"}},
+				},
+			},
+		},
+	}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}}
+
+	client := fake.NewSimpleClientset(existing, service)
+	client.PrependReactor("patch", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewInternalError(errors.New("service unavailable"))
+	})
+	factory := newRollbackFactory(client)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	reader := k8s.NewCachedReader(client, appslister.NewStatefulSetLister(indexer), corelister.NewServiceLister(indexer))
+	handler := MakeUpdateHandler("openfaas-fn", factory, reader)
+
+	body := `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0", "labels": {"com.openfaas.prewarm": "true"}}`
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPut, "/system/functions", strings.NewReader(body)))
+
+	if rr.Code < http.StatusBadRequest {
+		t.Fatalf("want the update to fail, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "rolled back") {
+		t.Errorf("want the error to report the rollback, got %q", rr.Body.String())
+	}
+
+	if _, err := client.AppsV1().DaemonSets("openfaas-fn").Get(context.Background(), k8s.PrewarmName("figlet"), metav1.GetOptions{}); err == nil {
+		t.Errorf("want the pre-warm DaemonSet that the update created to be removed by the rollback")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+// MakeSecretRotationHandler rotates a secret with a POST of its new value, in the
+// same body as an update of the secret. The Pods of each function that uses the
+// secret are then restarted one ordinal at a time, from the highest, by the
+// controller.SecretRotator. A GET returns the progress for each function.
+func MakeSecretRotationHandler(defaultNamespace string, kube kubernetes.Interface, statefulsets appslisters.StatefulSetLister, unsealer *k8s.SecretUnsealer, apiTimeout time.Duration) http.HandlerFunc {
+	secrets := SecretsHandler{
+		Secrets:  k8s.NewSecretsClient(kube, apiTimeout),
+		Unsealer: unsealer,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		secretName := mux.Vars(r)["name"]
+
+		lookupNamespace := defaultNamespace
+		if namespace := r.URL.Query().Get("namespace"); len(namespace) > 0 {
+			lookupNamespace = namespace
+		}
+
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("secret", secretName, "namespace", lookupNamespace)
+
+		functions, err := functionsUsingSecret(statefulsets, lookupNamespace, secretName)
+		if err != nil {
+			logger.Error(err, "Unable to list functions")
+			respondError(w, err)
+			return
+		}
+
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			req := secretRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, badRequest("unable to unmarshal secret: %s", err))
+				return
+			}
+			secret := req.Secret
+			if secret.Name != "" && secret.Name != secretName {
+				respondError(w, badRequest("the name of the secret must be %s, got %s", secretName, secret.Name))
+				return
+			}
+			if secret.Namespace != "" && secret.Namespace != lookupNamespace {
+				respondError(w, badRequest("the namespace of the secret must be %s, got %s", lookupNamespace, secret.Namespace))
+				return
+			}
+			secret.Name = secretName
+			secret.Namespace = lookupNamespace
+
+			if err := secrets.unseal(&secret, req.Sealed); err != nil {
+				logger.Error(err, "Secret unseal error")
+				respondError(w, invalid(err))
+				return
+			}
+			if err := secrets.Secrets.Replace(r.Context(), secret); err != nil {
+				respondError(w, err)
+				return
+			}
+			logger.Info("Secret rotated", "functions", len(functions))
+
+			now := time.Now()
+			for i, statefulset := range functions {
+				ctx, cancel := k8s.WithAPITimeout(r.Context(), apiTimeout)
+				started, err := k8s.StartSecretRotation(ctx, kube, statefulset, secretName, now)
+				cancel()
+				if err != nil {
+					logger.Error(err, "Unable to restart function for the rotated secret", "function", statefulset.Name)
+					respondError(w, fmt.Errorf("the secret was rotated, but function %s could not be restarted: %w", statefulset.Name, err))
+					return
+				}
+				functions[i] = started
+			}
+			status = http.StatusAccepted
+		}
+
+		progress := make([]k8s.SecretRotationProgress, 0, len(functions))
+		for _, statefulset := range functions {
+			progress = append(progress, k8s.GetSecretRotationProgress(statefulset))
+		}
+
+		res, err := json.Marshal(progress)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(res)
+	}
+}
+
+// functionsUsingSecret returns the StatefulSets of the functions that use the
+// secret, sorted by name
+func functionsUsingSecret(statefulsets appslisters.StatefulSetLister, namespace, secret string) ([]*appsv1.StatefulSet, error) {
+	requirement, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		return nil, err
+	}
+	all, err := statefulsets.StatefulSets(namespace).List(labels.NewSelector().Add(*requirement))
+	if err != nil {
+		return nil, err
+	}
+
+	var functions []*appsv1.StatefulSet
+	for _, statefulset := range all {
+		if k8s.UsesSecret(statefulset, secret) {
+			functions = append(functions, statefulset)
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+	return functions, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newSecretFunction(name string, replicas int32, secret string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn", Labels: map[string]string{"faas_function": name}},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{{
+					Name: name + "-projected-secrets",
+					VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{{
+						Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: secret}},
+					}}}},
+				}},
+			}},
+		},
+	}
+}
+
+func Test_MakeSecretRotationHandler(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: "openfaas-fn"},
+		Data:       map[string][]byte{"api-key": []byte("old")},
+	})
+	applied := map[string]*appsv1.StatefulSet{}
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		obj := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(patch.GetPatch(), obj); err != nil {
+			return true, nil, err
+		}
+		applied[patch.GetName()] = obj
+		return true, obj, nil
+	})
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(newSecretFunction("figlet", 3, "api-key"))
+	indexer.Add(newSecretFunction("env", 1, "db-password"))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/system/secret/{name}/rotate", MakeSecretRotationHandler("openfaas-fn", client, appslisters.NewStatefulSetLister(indexer), nil, 0))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/secret/api-key/rotate", strings.NewReader(`{"value": "new"}`)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("want status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+
+	secret, err := client.CoreV1().Secrets("openfaas-fn").Get(context.Background(), "api-key", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := string(secret.Data["api-key"]); got != "new" {
+		t.Errorf("want the secret to be rotated, got %q", got)
+	}
+
+	if _, ok := applied["env"]; ok || len(applied) != 1 {
+		t.Errorf("want only figlet to be restarted, got %v", applied)
+	}
+	if rotation := k8s.ParseSecretRotation(applied["figlet"].Annotations); rotation == nil || rotation.Partition != 2 {
+		t.Errorf("want the restart of figlet to start at ordinal 2, got %+v", rotation)
+	}
+
+	progress := []k8s.SecretRotationProgress{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &progress); err != nil {
+		t.Fatalf("unable to decode the response: %s", err)
+	}
+	if len(progress) != 1 || progress[0].Function != "figlet" || progress[0].Done {
+		t.Errorf("want the progress of figlet, got %+v", progress)
+	}
+}
+
+func Test_MakeSecretRotationHandler_RejectsAnotherName(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	router := mux.NewRouter()
+	router.HandleFunc("/system/secret/{name}/rotate", MakeSecretRotationHandler("openfaas-fn", fake.NewSimpleClientset(), appslisters.NewStatefulSetLister(indexer), nil, 0))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/secret/api-key/rotate", strings.NewReader(`{"name": "other", "value": "new"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("want status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+}
@@ -5,28 +5,42 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
 	types "github.com/openfaas/faas-provider/types"
 	"k8s.io/client-go/kubernetes"
 )
 
 // MakeSecretHandler makes a handler for Create/List/Delete/Update of
-// secrets in the Kubernetes API
-func MakeSecretHandler(defaultNamespace string, kube kubernetes.Interface) http.HandlerFunc {
+// secrets in the Kubernetes API, sealed values are unsealed with unsealer when it
+// is not nil. Each call to the API is bounded by apiTimeout.
+func MakeSecretHandler(defaultNamespace string, kube kubernetes.Interface, unsealer *k8s.SecretUnsealer, apiTimeout time.Duration) http.HandlerFunc {
 	handler := SecretsHandler{
 		LookupNamespace: NewNamespaceResolver(defaultNamespace, kube),
-		Secrets:         k8s.NewSecretsClient(kube),
+		Secrets:         k8s.NewSecretsClient(kube, apiTimeout),
+		Unsealer:        unsealer,
 	}
 	return handler.ServeHTTP
 }
 
+// secretRequest is the body of a create or replace, Sealed marks the value as sealed
+// for the cluster with kubeseal --raw, so that it is unsealed before it is stored
+type secretRequest struct {
+	types.Secret
+	Sealed bool `json:"sealed,omitempty"`
+}
+
 // SecretsHandler enabling to create openfaas secrets across namespaces
 type SecretsHandler struct {
 	Secrets         k8s.SecretsClient
 	LookupNamespace NamespaceResolver
+	// Unsealer is optional, sealed values are rejected when it is nil
+	Unsealer *k8s.SecretUnsealer
 }
 
 func (h SecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -37,14 +51,12 @@ func (h SecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	lookupNamespace, err := h.LookupNamespace(r)
 	if err != nil {
 		switch err.Error() {
-		case "unable to unmarshal Secret request":
-			http.Error(w, err.Error(), http.StatusBadRequest)
 		case "unable to manage secrets within the specified namespace":
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			respondError(w, withStatus(http.StatusForbidden, err))
 		default:
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			respondError(w, withStatus(http.StatusBadRequest, err))
 		}
+		return
 	}
 
 	switch r.Method {
@@ -57,17 +69,16 @@ func (h SecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		h.deleteSecret(lookupNamespace, w, r)
 	default:
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		respondError(w, withStatus(http.StatusMethodNotAllowed, fmt.Errorf("method %s is not supported", r.Method)))
 	}
 }
 
 func (h SecretsHandler) listSecrets(namespace string, w http.ResponseWriter, r *http.Request) {
-	res, err := h.Secrets.List(namespace)
+	res, err := h.Secrets.List(r.Context(), namespace)
 	if err != nil {
-		status, reason := ProcessErrorReasons(err)
-		log.Printf("Secret list error reason: %s, %v\n", reason, err)
-		w.WriteHeader(status)
+		_, reason := ProcessErrorReasons(err)
+		logging.FromContext(r.Context()).Error(err, "Secret list error", "namespace", namespace, "reason", reason)
+		respondError(w, err)
 		return
 	}
 
@@ -80,8 +91,8 @@ func (h SecretsHandler) listSecrets(namespace string, w http.ResponseWriter, r *
 	}
 	secretsBytes, err := json.Marshal(secrets)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("Secrets json marshal error: %v\n", err)
+		logging.FromContext(r.Context()).Error(err, "Secrets json marshal error")
+		respondError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -90,44 +101,58 @@ func (h SecretsHandler) listSecrets(namespace string, w http.ResponseWriter, r *
 }
 
 func (h SecretsHandler) createSecret(namespace string, w http.ResponseWriter, r *http.Request) {
-	secret := types.Secret{}
-	err := json.NewDecoder(r.Body).Decode(&secret)
+	req := secretRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Secret unmarshal error: %v\n", err)
+		logging.FromContext(r.Context()).Error(err, "Secret unmarshal error")
+		respondError(w, badRequest("unable to unmarshal secret: %s", err))
 		return
 	}
 
+	secret := req.Secret
 	secret.Namespace = namespace
-	err = h.Secrets.Create(secret)
+	if err := h.unseal(&secret, req.Sealed); err != nil {
+		logging.FromContext(r.Context()).Error(err, "Secret unseal error", "secret", secret.Name, "namespace", namespace)
+		respondError(w, invalid(err))
+		return
+	}
+
+	err = h.Secrets.Create(r.Context(), secret)
 	if err != nil {
-		status, reason := ProcessErrorReasons(err)
-		log.Printf("Secret create error reason: %s, %v\n", reason, err)
-		w.WriteHeader(status)
+		_, reason := ProcessErrorReasons(err)
+		logging.FromContext(r.Context()).Error(err, "Secret create error", "namespace", namespace, "reason", reason)
+		respondError(w, err)
 		return
 	}
-	log.Printf("Secret %s create\n", secret.Name)
+	logging.FromContext(r.Context()).Info("Secret created", "secret", secret.Name, "namespace", namespace)
 	w.WriteHeader(http.StatusAccepted)
 }
 
 func (h SecretsHandler) replaceSecret(namespace string, w http.ResponseWriter, r *http.Request) {
-	secret := types.Secret{}
-	err := json.NewDecoder(r.Body).Decode(&secret)
+	req := secretRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Secret unmarshal error: %v\n", err)
+		logging.FromContext(r.Context()).Error(err, "Secret unmarshal error")
+		respondError(w, badRequest("unable to unmarshal secret: %s", err))
 		return
 	}
 
+	secret := req.Secret
 	secret.Namespace = namespace
-	err = h.Secrets.Replace(secret)
+	if err := h.unseal(&secret, req.Sealed); err != nil {
+		logging.FromContext(r.Context()).Error(err, "Secret unseal error", "secret", secret.Name, "namespace", namespace)
+		respondError(w, invalid(err))
+		return
+	}
+
+	err = h.Secrets.Replace(r.Context(), secret)
 	if err != nil {
-		status, reason := ProcessErrorReasons(err)
-		log.Printf("Secret update error reason: %s, %v\n", reason, err)
-		w.WriteHeader(status)
+		_, reason := ProcessErrorReasons(err)
+		logging.FromContext(r.Context()).Error(err, "Secret update error", "namespace", namespace, "reason", reason)
+		respondError(w, err)
 		return
 	}
-	log.Printf("Secret %s updated", secret.Name)
+	logging.FromContext(r.Context()).Info("Secret updated", "secret", secret.Name, "namespace", namespace)
 	w.WriteHeader(http.StatusAccepted)
 }
 
@@ -135,18 +160,41 @@ func (h SecretsHandler) deleteSecret(namespace string, w http.ResponseWriter, r
 	secret := types.Secret{}
 	err := json.NewDecoder(r.Body).Decode(&secret)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Secret unmarshal error: %v\n", err)
+		logging.FromContext(r.Context()).Error(err, "Secret unmarshal error")
+		respondError(w, badRequest("unable to unmarshal secret: %s", err))
 		return
 	}
 
-	err = h.Secrets.Delete(namespace, secret.Name)
+	err = h.Secrets.Delete(r.Context(), namespace, secret.Name)
 	if err != nil {
-		status, reason := ProcessErrorReasons(err)
-		log.Printf("Secret delete error reason: %s, %v\n", reason, err)
-		w.WriteHeader(status)
+		_, reason := ProcessErrorReasons(err)
+		logging.FromContext(r.Context()).Error(err, "Secret delete error", "namespace", namespace, "reason", reason)
+		respondError(w, err)
 		return
 	}
-	log.Printf("Secret %s deleted\n", secret.Name)
+	logging.FromContext(r.Context()).Info("Secret deleted", "secret", secret.Name, "namespace", namespace)
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// unseal replaces the value with its plaintext when the request marks it as sealed,
+// other values are stored as they are
+func (h SecretsHandler) unseal(secret *types.Secret, sealed bool) error {
+	if !sealed {
+		return nil
+	}
+	value := secret.RawValue
+	if len(value) == 0 {
+		value = []byte(secret.Value)
+	}
+	if h.Unsealer == nil {
+		return errors.New("sealed secrets are not enabled, the sealing keys must be set with sealed_secrets_key_file")
+	}
+
+	plaintext, err := h.Unsealer.Unseal(secret.Namespace, secret.Name, value)
+	if err != nil {
+		return err
+	}
+	secret.RawValue = plaintext
+	secret.Value = ""
+	return nil
+}
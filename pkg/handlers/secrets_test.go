@@ -14,6 +14,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/openfaas/faas-netes/pkg/k8s"
 	types "github.com/openfaas/faas-provider/types"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	testclient "k8s.io/client-go/kubernetes/fake"
@@ -25,7 +26,7 @@ const secretLabelValue = "openfaas"
 func Test_SecretsHandler(t *testing.T) {
 	namespace := "of-fnc"
 	kube := testclient.NewSimpleClientset()
-	secretsHandler := MakeSecretHandler(namespace, kube).ServeHTTP
+	secretsHandler := MakeSecretHandler(namespace, kube, nil, k8s.DefaultAPITimeout).ServeHTTP
 	secretName := "testsecret"
 
 	t.Run("create managed secrets", func(t *testing.T) {
@@ -273,7 +274,7 @@ func Test_SecretsHandler(t *testing.T) {
 func Test_SecretsHandler_ListEmpty(t *testing.T) {
 	namespace := "of-fnc"
 	kube := testclient.NewSimpleClientset()
-	secretsHandler := MakeSecretHandler(namespace, kube).ServeHTTP
+	secretsHandler := MakeSecretHandler(namespace, kube, nil, k8s.DefaultAPITimeout).ServeHTTP
 
 	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
 	w := httptest.NewRecorder()
@@ -290,3 +291,46 @@ func Test_SecretsHandler_ListEmpty(t *testing.T) {
 		t.Errorf(`want empty list to be valid json i.e. "[]", but was %q`, string(body))
 	}
 }
+
+func Test_SecretsHandler_SealedWithoutUnsealer(t *testing.T) {
+	namespace := "of-fnc"
+	kube := testclient.NewSimpleClientset()
+	secretsHandler := MakeSecretHandler(namespace, kube, nil, k8s.DefaultAPITimeout).ServeHTTP
+
+	payload := `{"name": "api-key", "value": "AgBy3i4OJSWK+PiTySYZZA==", "sealed": true}`
+	req := httptest.NewRequest("POST", "http://example.com/foo", strings.NewReader(payload))
+	w := httptest.NewRecorder()
+
+	secretsHandler(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want status code '%d', got '%d'", http.StatusUnprocessableEntity, w.Code)
+	}
+	if _, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "api-key", metav1.GetOptions{}); err == nil {
+		t.Errorf("want the sealed value not to be stored")
+	}
+}
+
+func Test_SecretsHandler_StoresUnmarkedValue(t *testing.T) {
+	namespace := "of-fnc"
+	kube := testclient.NewSimpleClientset()
+	secretsHandler := MakeSecretHandler(namespace, kube, nil, k8s.DefaultAPITimeout).ServeHTTP
+
+	// only a value with the sealed field is unsealed, whatever its content
+	payload := `{"name": "api-key", "value": "sealed:AgBy3i4OJSWK+PiTySYZZA=="}`
+	req := httptest.NewRequest("POST", "http://example.com/foo", strings.NewReader(payload))
+	w := httptest.NewRecorder()
+
+	secretsHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusAccepted, w.Code)
+	}
+	secret, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "api-key", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want the secret to be stored: %s", err)
+	}
+	if got := string(secret.Data["api-key"]); got != "sealed:AgBy3i4OJSWK+PiTySYZZA==" {
+		t.Errorf("want the value to be stored as it is, got %q", got)
+	}
+}
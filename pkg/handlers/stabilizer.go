@@ -0,0 +1,113 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// StabilizationConfig dampens the replicas that are requested from the replica
+// updater, by the autoscaler or an idler, so that the replicas of a function do not
+// flap when its metrics oscillate
+type StabilizationConfig struct {
+	// UpWindow is how far back the requests are considered before scaling up, the
+	// function is scaled up to the lowest replicas requested within the window
+	UpWindow time.Duration
+
+	// DownWindow is how far back the requests are considered before scaling down,
+	// the function is scaled down to the highest replicas requested within the window
+	DownWindow time.Duration
+
+	// MaxUpStep is the most replicas that are added by one request, 0 is unlimited
+	MaxUpStep int32
+
+	// MaxDownStep is the most replicas that are removed by one request, 0 is unlimited
+	MaxDownStep int32
+}
+
+// ScaleStabilizer applies a StabilizationConfig to the requests for each function,
+// the behaviour follows the stabilization windows of the HorizontalPodAutoscaler. A
+// nil ScaleStabilizer returns the requested replicas.
+type ScaleStabilizer struct {
+	config  StabilizationConfig
+	lock    sync.Mutex
+	history map[string][]scaleRequest
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type scaleRequest struct {
+	replicas int32
+	time     time.Time
+}
+
+// NewScaleStabilizer creates a ScaleStabilizer, nil is returned when config has
+// no windows or step limits
+func NewScaleStabilizer(config StabilizationConfig) *ScaleStabilizer {
+	if config == (StabilizationConfig{}) {
+		return nil
+	}
+
+	return &ScaleStabilizer{
+		config:  config,
+		history: map[string][]scaleRequest{},
+		now:     time.Now,
+	}
+}
+
+// Stabilize records the request for desired replicas of the function with key, and
+// returns the replicas that it should be scaled to from current
+func (s *ScaleStabilizer) Stabilize(key string, current, desired int32) int32 {
+	if s == nil {
+		return desired
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	window := s.config.UpWindow
+	if s.config.DownWindow > window {
+		window = s.config.DownWindow
+	}
+
+	// the requests that are older than both windows are no longer needed
+	history := s.history[key][:0]
+	for _, request := range s.history[key] {
+		if now.Sub(request.time) <= window {
+			history = append(history, request)
+		}
+	}
+	history = append(history, scaleRequest{replicas: desired, time: now})
+	s.history[key] = history
+
+	replicas := desired
+	for _, request := range history {
+		switch {
+		case desired > current && now.Sub(request.time) <= s.config.UpWindow && request.replicas < replicas:
+			replicas = request.replicas
+		case desired < current && now.Sub(request.time) <= s.config.DownWindow && request.replicas > replicas:
+			replicas = request.replicas
+		}
+	}
+
+	// a window never moves the replicas in the opposite direction of the request
+	if desired > current && replicas < current {
+		replicas = current
+	}
+	if desired < current && replicas > current {
+		replicas = current
+	}
+
+	if s.config.MaxUpStep > 0 && replicas > current+s.config.MaxUpStep {
+		replicas = current + s.config.MaxUpStep
+	}
+	if s.config.MaxDownStep > 0 && replicas < current-s.config.MaxDownStep {
+		replicas = current - s.config.MaxDownStep
+	}
+
+	return replicas
+}
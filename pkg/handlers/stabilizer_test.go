@@ -0,0 +1,72 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ScaleStabilizer_DownWindow(t *testing.T) {
+	now := time.Now()
+	stabilizer := NewScaleStabilizer(StabilizationConfig{DownWindow: time.Minute})
+	stabilizer.now = func() time.Time { return now }
+
+	if got := stabilizer.Stabilize("openfaas-fn/figlet", 5, 10); got != 10 {
+		t.Errorf("want to scale up straight away, got %d", got)
+	}
+
+	now = now.Add(10 * time.Second)
+	if got := stabilizer.Stabilize("openfaas-fn/figlet", 10, 2); got != 10 {
+		t.Errorf("want to stay at the highest request within the window, got %d", got)
+	}
+
+	now = now.Add(55 * time.Second)
+	if got := stabilizer.Stabilize("openfaas-fn/figlet", 10, 4); got != 4 {
+		t.Errorf("want the highest request within the window, got %d", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got := stabilizer.Stabilize("openfaas-fn/figlet", 4, 1); got != 1 {
+		t.Errorf("want to scale down once the window has passed, got %d", got)
+	}
+}
+
+func Test_ScaleStabilizer_UpWindow(t *testing.T) {
+	now := time.Now()
+	stabilizer := NewScaleStabilizer(StabilizationConfig{UpWindow: time.Minute})
+	stabilizer.now = func() time.Time { return now }
+
+	stabilizer.Stabilize("openfaas-fn/figlet", 2, 2)
+
+	now = now.Add(10 * time.Second)
+	if got := stabilizer.Stabilize("openfaas-fn/figlet", 2, 8); got != 2 {
+		t.Errorf("want to stay at the lowest request within the window, got %d", got)
+	}
+
+	if got := stabilizer.Stabilize("openfaas-fn/nodeinfo", 2, 8); got != 8 {
+		t.Errorf("want each function to have its own history, got %d", got)
+	}
+}
+
+func Test_ScaleStabilizer_Steps(t *testing.T) {
+	stabilizer := NewScaleStabilizer(StabilizationConfig{MaxUpStep: 2, MaxDownStep: 1})
+
+	if got := stabilizer.Stabilize("openfaas-fn/figlet", 1, 10); got != 3 {
+		t.Errorf("want 3 replicas, got %d", got)
+	}
+	if got := stabilizer.Stabilize("openfaas-fn/figlet", 3, 0); got != 2 {
+		t.Errorf("want 2 replicas, got %d", got)
+	}
+}
+
+func Test_ScaleStabilizer_Disabled(t *testing.T) {
+	stabilizer := NewScaleStabilizer(StabilizationConfig{})
+	if stabilizer != nil {
+		t.Fatal("want no stabilizer without windows or steps")
+	}
+	if got := stabilizer.Stabilize("openfaas-fn/figlet", 10, 1); got != 1 {
+		t.Errorf("want the requested replicas, got %d", got)
+	}
+}
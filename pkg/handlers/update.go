@@ -8,19 +8,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"time"
+	"sort"
 
 	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
 
 	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// MakeUpdateHandler update specified function
-func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory) http.HandlerFunc {
+// MakeUpdateHandler update specified function.
+//
+// With wait=true the handler blocks until the Pods of the function are at the new
+// revision and ready, or until the timeout query parameter, and returns the
+// RolloutStatus.
+func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory, reader k8s.CachedReader) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		if r.Body != nil {
@@ -32,14 +37,19 @@ func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory) htt
 		request := types.FunctionDeployment{}
 		err := json.Unmarshal(body, &request)
 		if err != nil {
-			wrappedErr := fmt.Errorf("unable to unmarshal request: %s", err.Error())
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+			respondError(w, badRequest("unable to unmarshal request: %s", err))
 			return
 		}
 
-		if err := ValidateDeployRequest(&request); err != nil {
-			wrappedErr := fmt.Errorf("validation failed: %s", err.Error())
-			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
+		patch := metadataPatch{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			respondError(w, badRequest("unable to unmarshal request: %s", err))
+			return
+		}
+
+		waitForReady, timeout, err := parseWait(r.URL.Query())
+		if err != nil {
+			respondError(w, badRequest("%s", err))
 			return
 		}
 
@@ -49,183 +59,334 @@ func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory) htt
 		}
 
 		if lookupNamespace != defaultNamespace {
-			http.Error(w, fmt.Sprintf("namespace must be: %s", defaultNamespace), http.StatusBadRequest)
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
 			return
 		}
+		request.Namespace = lookupNamespace
 
-		if lookupNamespace == "kube-system" {
-			http.Error(w, "unable to list within the kube-system namespace", http.StatusUnauthorized)
+		if err := mergeMetadata(ctx, factory, &request, patch); err != nil {
+			respondError(w, err)
 			return
 		}
 
+		if err := ValidateDeployRequest(&request); err != nil {
+			respondError(w, invalid(err))
+			return
+		}
+
+		if request.Labels != nil {
+			if err := factory.ReplicaLimits.Validate(ctx, lookupNamespace, *request.Labels); err != nil {
+				respondError(w, invalid(err))
+				return
+			}
+		}
+
+		logger := logging.FromContext(ctx).WithValues("function", request.Service, "namespace", lookupNamespace)
+
 		annotations, err := buildAnnotations(request)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			respondError(w, invalid(err))
 			return
 		}
 
-		if err, status := updateStatefulSetSpec(ctx, lookupNamespace, factory, request, annotations); err != nil {
-			if !k8s.IsNotFound(err) {
-				log.Printf("error updating StatefulSet: %s.%s, error: %s\n", request.Service, lookupNamespace, err)
+		if err := verifyImage(withScanBypass(r, request), factory, lookupNamespace, request.Image); err != nil {
+			logger.Error(err, "Image verification failed", "image", request.Image)
+			respondError(w, err)
+			return
+		}
 
-				return
+		conflicts, prior, resourceVersion, err := updateStatefulSetSpec(ctx, lookupNamespace, factory, request, annotations)
+		if err != nil {
+			if !k8s.IsNotFound(err) {
+				logger.Error(err, "Error updating statefulset")
 			}
 
-			wrappedErr := fmt.Errorf("unable update StatefulSet: %s.%s, error: %s", request.Service, lookupNamespace, err.Error())
-			http.Error(w, wrappedErr.Error(), status)
+			respondError(w, fmt.Errorf("unable update StatefulSet: %s.%s, error: %w", request.Service, lookupNamespace, err))
 			return
 		}
 
-		if err, status := updateService(lookupNamespace, factory, request, annotations); err != nil {
+		if err := updateService(ctx, lookupNamespace, factory, reader, request, annotations); err != nil {
 			if !k8s.IsNotFound(err) {
-				log.Printf("error updating service: %s.%s, error: %s\n", request.Service, lookupNamespace, err)
+				logger.Error(err, "Error updating service")
+			}
+
+			// the StatefulSet has already been updated, so it is restored to match
+			// the Service that could not be changed
+			rollbackErr := rollbackStatefulSet(factory, prior)
+			if rollbackErr != nil {
+				logger.Error(rollbackErr, "Unable to roll back statefulset")
 			}
 
-			wrappedErr := fmt.Errorf("unable update Service: %s.%s, error: %s", request.Service, request.Namespace, err.Error())
-			http.Error(w, wrappedErr.Error(), status)
+			wrappedErr := fmt.Errorf("unable update Service: %s.%s, error: %w", request.Service, request.Namespace, err)
+			respondError(w, withRollback(wrappedErr, rollbackErr))
+			return
+		}
+
+		writeProfileConflicts(w, logger, conflicts)
+		w.Header().Set(ResourceVersionHeader, resourceVersion)
+		if !waitForReady {
+			w.WriteHeader(http.StatusAccepted)
 			return
 		}
+		writeRolloutStatus(ctx, w, logger, factory.Client, lookupNamespace, request.Service, timeout)
+	}
+}
+
+// metadataPatch reads the labels and annotations of an update request, where a
+// null value removes a key
+type metadataPatch struct {
+	Labels      map[string]*string `json:"labels"`
+	Annotations map[string]*string `json:"annotations"`
+}
+
+// mergeMetadata applies the labels or annotations of the request to those of the
+// function when they remove a key with a null value, the other keys of the function
+// are then kept. Without a null value the request replaces them, as before.
+func mergeMetadata(ctx context.Context, factory k8s.FunctionFactory, request *types.FunctionDeployment, patch metadataPatch) error {
+	mergeLabels, mergeAnnotations := k8s.HasRemovals(patch.Labels), k8s.HasRemovals(patch.Annotations)
+	if request.Service == "" || (!mergeLabels && !mergeAnnotations) {
+		return nil
+	}
+
+	getCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+	existing, err := factory.Client.AppsV1().
+		StatefulSets(request.Namespace).
+		Get(getCtx, request.Service, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 
-		w.WriteHeader(http.StatusAccepted)
+	labels, annotations := k8s.FunctionMetadata(existing)
+	if mergeLabels {
+		merged := k8s.MergeMetadata(labels, patch.Labels)
+		request.Labels = &merged
+	}
+	if mergeAnnotations {
+		merged := k8s.MergeMetadata(annotations, patch.Annotations)
+		request.Annotations = &merged
 	}
+	return nil
 }
 
+// updateStatefulSetSpec builds the desired StatefulSet from the request and applies it
+// with server-side apply, so that fields set by other writers such as the autoscaler or
+// an HPA are merged instead of being overwritten by a stale copy. Only the fields that
+// the provider owns are applied, the replicas are left to the scaler. The StatefulSet
+// from before the update is returned as prior, it is restored when a later step of
+// the update fails.
 func updateStatefulSetSpec(
 	ctx context.Context,
 	functionNamespace string,
 	factory k8s.FunctionFactory,
 	request types.FunctionDeployment,
-	annotations map[string]string) (err error, httpStatus int) {
-
-	getOpts := metav1.GetOptions{}
+	annotations map[string]string) (conflicts []k8s.ProfileConflict, prior *appsv1.StatefulSet, resourceVersion string, err error) {
 
-	statefulset, findDeployErr := factory.Client.AppsV1().
+	getCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+	existing, findDeployErr := factory.Client.AppsV1().
 		StatefulSets(functionNamespace).
-		Get(context.TODO(), request.Service, getOpts)
+		Get(getCtx, request.Service, metav1.GetOptions{})
 
 	if findDeployErr != nil {
-		return findDeployErr, http.StatusNotFound
+		return nil, nil, "", findDeployErr
 	}
 
-	if len(statefulset.Spec.Template.Spec.Containers) > 0 {
-		statefulset.Spec.Template.Spec.Containers[0].Image = request.Image
-
-		statefulset.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullAlways
+	secrets := factory.NewSecretsClient()
+	existingSecrets, err := secrets.GetSecrets(ctx, functionNamespace, request.Secrets)
+	if err != nil {
+		return nil, nil, "", secretsError(err)
+	}
 
-		statefulset.Spec.Template.Spec.Containers[0].Env = buildEnvVars(&request)
+	if err := factory.CheckSecretPolicy(ctx, functionNamespace, existingSecrets); err != nil {
+		return nil, nil, "", invalid(err)
+	}
 
-		factory.ConfigureReadOnlyRootFilesystem(request, statefulset)
-		factory.ConfigureContainerUserID(statefulset)
+	statefulset, err := makeStatefulSetSpec(request, existingSecrets, factory)
+	if err != nil {
+		return nil, nil, "", invalid(err)
+	}
+	statefulset.Namespace = functionNamespace
 
-		statefulset.Spec.Template.Spec.NodeSelector = createSelector(request.Constraints)
+	// the selector can not be changed after the StatefulSet has been created
+	statefulset.Spec.Selector = existing.Spec.Selector.DeepCopy()
+	if err := checkSelectorLabels(statefulset.Spec.Selector, statefulset.Spec.Template.Labels); err != nil {
+		return nil, nil, "", invalid(err)
+	}
 
-		labels := map[string]string{
-			"faas_function": request.Service,
-			"uid":           fmt.Sprintf("%d", time.Now().Nanosecond()),
+	// the replicas are owned by the scaler and are left out of the apply, so that
+	// an update never resets a scaled function, they are only raised when the
+	// current value is below a requested minimum
+	statefulset.Spec.Replicas = nil
+	replicas := int32(1)
+	if existing.Spec.Replicas != nil {
+		replicas = *existing.Spec.Replicas
+	}
+	raise := false
+	if request.Labels != nil {
+		if min := getMinReplicaCount(*request.Labels); min != nil && replicas < *min {
+			replicas = *min
+			raise = true
 		}
+	}
 
-		if request.Labels != nil {
-			if min := getMinReplicaCount(*request.Labels); min != nil {
-				statefulset.Spec.Replicas = min
-			}
+	statefulset.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullAlways
 
-			for k, v := range *request.Labels {
-				labels[k] = v
-			}
+	// the desired state is built from scratch, so Profiles that are no longer
+	// requested are removed by the apply and only the current ones are added
+	profileList, err := factory.GetProfiles(ctx, factory.Config.ProfilesNamespace, annotations)
+	if err != nil {
+		return nil, nil, "", profileError(err)
+	}
+	for _, profile := range profileList {
+		if err := factory.ApplyProfile(profile, statefulset); err != nil {
+			return nil, nil, "", invalid(err)
 		}
+	}
+	conflicts = k8s.ProfileConflicts(annotations, profileList)
 
-		// statefulset.Labels = labels
-		statefulset.Spec.Template.ObjectMeta.Labels = labels
+	if err := factory.ConfigurePodSecurity(statefulset); err != nil {
+		return nil, nil, "", invalid(err)
+	}
 
-		// store the current annotations so that we can diff the annotations
-		// and determine which profiles need to be removed
-		currentAnnotations := statefulset.Annotations
-		statefulset.Annotations = annotations
-		statefulset.Spec.Template.Annotations = annotations
-		statefulset.Spec.Template.ObjectMeta.Annotations = annotations
+	if err := k8s.ConfigureConstraints(statefulset, request.Constraints); err != nil {
+		return nil, nil, "", invalid(err)
+	}
 
-		resources, resourceErr := createResources(request)
-		if resourceErr != nil {
-			return resourceErr, http.StatusBadRequest
-		}
+	if err := configureArchitectures(ctx, logging.FromContext(ctx), factory, statefulset, annotations); err != nil {
+		return nil, nil, "", err
+	}
 
-		statefulset.Spec.Template.Spec.Containers[0].Resources = *resources
+	// the Pods are only replaced when the template changes, so that an update
+	// with the same spec is a no-op
+	if err := k8s.SetTemplateHash(&statefulset.Spec.Template); err != nil {
+		return nil, nil, "", err
+	}
 
-		secrets := k8s.NewSecretsClient(factory.Client)
-		existingSecrets, err := secrets.GetSecrets(functionNamespace, request.Secrets)
-		if err != nil {
-			return err, http.StatusBadRequest
-		}
+	applyConfig, err := k8s.StatefulSetApplyConfiguration(statefulset)
+	if err != nil {
+		return nil, nil, "", err
+	}
 
-		err = factory.ConfigureSecrets(request, statefulset, existingSecrets)
-		if err != nil {
-			log.Println(err)
-			return err, http.StatusBadRequest
-		}
+	upgradeCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+	if err := k8s.UpgradeStatefulSetManagedFields(upgradeCtx, factory.Client, existing); err != nil {
+		return nil, nil, "", err
+	}
 
-		probes, err := factory.MakeProbes(request)
-		if err != nil {
-			return err, http.StatusBadRequest
+	// the scaler must own the replicas before they are left out of the apply,
+	// otherwise they would be removed and defaulted back to one
+	replicasApplied := false
+	if raise || !k8s.OwnsReplicas(existing, k8s.ScaleFieldManager) {
+		replicasCtx, cancel := factory.WithAPITimeout(ctx)
+		defer cancel()
+		if err := k8s.ApplyStatefulSetReplicas(replicasCtx, factory.Client, functionNamespace, request.Service, replicas, k8s.ScaleFieldManager); err != nil {
+			return nil, nil, "", err
 		}
+		replicasApplied = true
+	}
 
-		statefulset.Spec.Template.Spec.Containers[0].LivenessProbe = probes.Liveness
-		statefulset.Spec.Template.Spec.Containers[0].ReadinessProbe = probes.Readiness
-
-		// compare the annotations from args to the cache copy of the statefulset annotations
-		// at this point we have already updated the annotations to the new value, if we
-		// compare to that it will produce an empty list
-		profileNamespace := factory.Config.ProfilesNamespace
-		profileList, err := factory.GetProfilesToRemove(ctx, profileNamespace, annotations, currentAnnotations)
-		if err != nil {
-			return err, http.StatusBadRequest
-		}
-		for _, profile := range profileList {
-			factory.RemoveProfile(profile, statefulset)
+	applyCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+	applied, applyErr := factory.Client.AppsV1().
+		StatefulSets(functionNamespace).
+		Apply(applyCtx, applyConfig, metav1.ApplyOptions{FieldManager: k8s.FieldManager, Force: true})
+	if applyErr != nil {
+		if replicasApplied {
+			applyErr = withRollback(applyErr, rollbackStatefulSet(factory, existing))
 		}
+		return nil, nil, "", applyErr
+	}
 
-		profileList, err = factory.GetProfiles(ctx, profileNamespace, annotations)
-		if err != nil {
-			return err, http.StatusBadRequest
-		}
-		for _, profile := range profileList {
-			factory.ApplyProfile(profile, statefulset)
-		}
+	// functions deployed before the recommendations were enabled get a VPA on
+	// their next update
+	applyVPA(ctx, logging.FromContext(ctx), factory, applied)
+	applyMeshPolicy(ctx, logging.FromContext(ctx), factory, applied)
+	applyPrewarm(ctx, logging.FromContext(ctx), factory, applied, existing)
+
+	syncCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+	if err := k8s.SyncSecretProviderClass(syncCtx, factory.Dynamic, request.Service, functionNamespace, request.Secrets,
+		factory.Config.SecretsStore, k8s.StatefulSetOwner(applied), factory.Config.CostAllocationLabels(applied.Labels)); err != nil {
+		err = fmt.Errorf("unable to apply SecretProviderClass: %w", err)
+		return nil, nil, "", withRollback(err, rollbackStatefulSet(factory, existing))
 	}
 
-	if _, updateErr := factory.Client.AppsV1().
-		StatefulSets(functionNamespace).
-		Update(context.TODO(), statefulset, metav1.UpdateOptions{}); updateErr != nil {
+	if err := syncFunctionResources(ctx, factory, applied, annotations, requestLabels(request), existing); err != nil {
+		return nil, nil, "", withRollback(err, rollbackStatefulSet(factory, existing))
+	}
 
-		return updateErr, http.StatusInternalServerError
+	return conflicts, existing, applied.ResourceVersion, nil
+}
+
+// checkSelectorLabels returns an error when the labels of the Pod template would no
+// longer match the selector of the StatefulSet. Functions deployed by earlier releases
+// have each of their labels in the selector, which can not be changed, so those
+// labels can not be removed or changed without deploying the function again.
+func checkSelectorLabels(selector *metav1.LabelSelector, labels map[string]string) error {
+	if selector == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(selector.MatchLabels))
+	for k := range selector.MatchLabels {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	return nil, http.StatusAccepted
+	for _, k := range keys {
+		value, ok := labels[k]
+		if !ok {
+			return fmt.Errorf("label %s is part of the selector of the function and can not be removed, delete and deploy the function to remove it", k)
+		}
+		if want := selector.MatchLabels[k]; value != want {
+			return fmt.Errorf("label %s is part of the selector of the function and can not be changed from %q, delete and deploy the function to change it", k, want)
+		}
+	}
+	return nil
 }
 
 func updateService(
+	ctx context.Context,
 	functionNamespace string,
 	factory k8s.FunctionFactory,
+	reader k8s.CachedReader,
 	request types.FunctionDeployment,
-	annotations map[string]string) (err error, httpStatus int) {
-
-	getOpts := metav1.GetOptions{}
-
-	service, findServiceErr := factory.Client.CoreV1().
-		Services(functionNamespace).
-		Get(context.TODO(), request.Service, getOpts)
+	annotations map[string]string) error {
 
+	getCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+	existing, findServiceErr := reader.GetService(getCtx, functionNamespace, request.Service)
 	if findServiceErr != nil {
-		return findServiceErr, http.StatusNotFound
+		return findServiceErr
 	}
 
+	service, err := makeServiceSpec(request, factory)
+	if err != nil {
+		return invalid(err)
+	}
+	service.Namespace = functionNamespace
 	service.Annotations = annotations
 
-	if _, updateErr := factory.Client.CoreV1().
+	applyConfig, err := k8s.ServiceApplyConfiguration(service)
+	if err != nil {
+		return err
+	}
+
+	upgradeCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+	if err := k8s.UpgradeServiceManagedFields(upgradeCtx, factory.Client, existing); err != nil {
+		return err
+	}
+
+	applyCtx, cancel := factory.WithAPITimeout(ctx)
+	defer cancel()
+	if _, applyErr := factory.Client.CoreV1().
 		Services(functionNamespace).
-		Update(context.TODO(), service, metav1.UpdateOptions{}); updateErr != nil {
+		Apply(applyCtx, applyConfig, metav1.ApplyOptions{FieldManager: k8s.FieldManager, Force: true}); applyErr != nil {
 
-		return updateErr, http.StatusInternalServerError
+		return applyErr
 	}
 
-	return nil, http.StatusAccepted
+	return nil
 }
@@ -0,0 +1,231 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_updateStatefulSetSpec_KeepsScaledReplicas(t *testing.T) {
+	cases := []struct {
+		name     string
+		minScale string
+		want     int32
+	}{
+		{name: "without a minimum", want: 3},
+		{name: "minimum below the current replicas", minScale: "2", want: 3},
+		{name: "minimum above the current replicas", minScale: "5", want: 5},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			replicas := int32(3)
+			existing := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &replicas,
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"faas_function": "figlet"}},
+				},
+			}
+
+			client := fake.NewSimpleClientset(existing)
+			factory := k8s.NewFunctionFactory(client, k8s.DeploymentConfig{
+				LivenessProbe:  &k8s.ProbeConfig{},
+				ReadinessProbe: &k8s.ProbeConfig{},
+			}, nil)
+
+			labels := map[string]string{}
+			if tc.minScale != "" {
+				labels["com.openfaas.scale.min"] = tc.minScale
+			}
+			request := types.FunctionDeployment{
+				Service: "figlet",
+				Image:   "ghcr.io/openfaas/figlet:0.2.0",
+				Labels:  &labels,
+			}
+
+			if _, _, _, err := updateStatefulSetSpec(context.Background(), "openfaas-fn", factory, request, map[string]string{}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			got, _ := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+			if *got.Spec.Replicas != tc.want {
+				t.Fatalf("expected %d replicas, got %d", tc.want, *got.Spec.Replicas)
+			}
+			if image := got.Spec.Template.Spec.Containers[0].Image; image != request.Image {
+				t.Fatalf("expected image %s, got %s", request.Image, image)
+			}
+		})
+	}
+}
+
+func Test_updateStatefulSetSpec_SameSpecKeepsPods(t *testing.T) {
+	replicas := int32(1)
+	existing := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"faas_function": "figlet"}},
+		},
+	}
+
+	client := fake.NewSimpleClientset(existing)
+	factory := k8s.NewFunctionFactory(client, k8s.DeploymentConfig{
+		LivenessProbe:  &k8s.ProbeConfig{},
+		ReadinessProbe: &k8s.ProbeConfig{},
+	}, nil)
+
+	update := func(image string) string {
+		request := types.FunctionDeployment{Service: "figlet", Image: image}
+		if _, _, _, err := updateStatefulSetSpec(context.Background(), "openfaas-fn", factory, request, map[string]string{}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got, _ := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+		return got.Spec.Template.Labels[k8s.TemplateHashLabel]
+	}
+
+	first := update("ghcr.io/openfaas/figlet:0.2.0")
+	if first == "" {
+		t.Fatalf("want the %s label on the pod template", k8s.TemplateHashLabel)
+	}
+	if second := update("ghcr.io/openfaas/figlet:0.2.0"); second != first {
+		t.Errorf("want the same pod template for the same spec, got %s then %s", first, second)
+	}
+	if third := update("ghcr.io/openfaas/figlet:0.2.1"); third == first {
+		t.Errorf("want a new pod template for a new image, got %s for both", third)
+	}
+}
+
+func Test_mergeMetadata(t *testing.T) {
+	existing := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "figlet",
+			Namespace: "openfaas-fn",
+			Annotations: map[string]string{
+				"topic":                           "orders",
+				k8s.ScrapeAnnotation:              "false",
+				k8s.AnnotationFunctionLabels:      "team,tier",
+				k8s.AnnotationFunctionAnnotations: "topic",
+			},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+					"faas_function": "figlet",
+					"team":          "payments",
+					"tier":          "gold",
+				}},
+			},
+		},
+	}
+	factory := k8s.NewFunctionFactory(fake.NewSimpleClientset(existing), k8s.DeploymentConfig{}, nil)
+
+	body := `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0",
+		"labels": {"tier": null, "project": "checkout"},
+		"annotations": {"topic": "payments"}}`
+
+	request := types.FunctionDeployment{}
+	patch := metadataPatch{}
+	json.Unmarshal([]byte(body), &request)
+	json.Unmarshal([]byte(body), &patch)
+	request.Namespace = "openfaas-fn"
+
+	if err := mergeMetadata(context.Background(), factory, &request, patch); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	wantLabels := map[string]string{"team": "payments", "project": "checkout"}
+	if !reflect.DeepEqual(wantLabels, *request.Labels) {
+		t.Errorf("want labels %v, got %v", wantLabels, *request.Labels)
+	}
+	// without a null value the annotations of the request replace the function's
+	wantAnnotations := map[string]string{"topic": "payments"}
+	if !reflect.DeepEqual(wantAnnotations, *request.Annotations) {
+		t.Errorf("want annotations %v, got %v", wantAnnotations, *request.Annotations)
+	}
+}
+
+func Test_MakeUpdateHandler_NotFound(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	reader := k8s.NewCachedReader(client, appslister.NewStatefulSetLister(indexer), corelister.NewServiceLister(indexer))
+	handler := MakeUpdateHandler("openfaas-fn", newRollbackFactory(client), reader)
+
+	body := `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0"}`
+	req := httptest.NewRequest(http.MethodPut, "/system/functions", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("want status %d, got %d: %s", http.StatusNotFound, rr.Code, rr.Body.String())
+	}
+	var res ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil || res.Reason != metav1.StatusReasonNotFound {
+		t.Errorf("want an ErrorResponse with reason NotFound, got %q", rr.Body.String())
+	}
+}
+
+func Test_MakeUpdateHandler_SelectorLabels(t *testing.T) {
+	cases := []struct {
+		name     string
+		selector map[string]string
+		want     int
+	}{
+		{name: "selector of a deploy", want: http.StatusAccepted},
+		{name: "selector with the labels of an earlier release",
+			selector: map[string]string{"faas_function": "figlet", "tier": "gold"}, want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			factory := newRollbackFactory(client)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			reader := k8s.NewCachedReader(client, appslister.NewStatefulSetLister(indexer), corelister.NewServiceLister(indexer))
+
+			deploy := `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0", "labels": {"tier": "gold", "team": "payments"}}`
+			rr := httptest.NewRecorder()
+			MakeDeployHandler("openfaas-fn", factory)(rr, httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(deploy)))
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("want status %d for the deploy, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+			}
+
+			if tc.selector != nil {
+				existing, _ := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+				existing.Spec.Selector = &metav1.LabelSelector{MatchLabels: tc.selector}
+				client.AppsV1().StatefulSets("openfaas-fn").Update(context.Background(), existing, metav1.UpdateOptions{})
+			}
+
+			update := `{"service": "figlet", "image": "ghcr.io/openfaas/figlet:0.2.0", "labels": {"tier": null}}`
+			rr = httptest.NewRecorder()
+			MakeUpdateHandler("openfaas-fn", factory, reader)(rr, httptest.NewRequest(http.MethodPut, "/system/functions", strings.NewReader(update)))
+			if rr.Code != tc.want {
+				t.Fatalf("want status %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+
+			got, _ := client.AppsV1().StatefulSets("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+			for k, v := range got.Spec.Selector.MatchLabels {
+				if got.Spec.Template.Labels[k] != v {
+					t.Errorf("want the template labels %v to match the selector %v", got.Spec.Template.Labels, got.Spec.Selector.MatchLabels)
+				}
+			}
+		})
+	}
+}
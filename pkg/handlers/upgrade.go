@@ -0,0 +1,116 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-provider/httputil"
+)
+
+// isUpgrade is true for a request that switches the connection to another
+// protocol, such as WebSocket
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyUpgrade sends the request to the function on its own connection, when the
+// function switches protocols the connection of the caller is hijacked and the
+// bytes are copied both ways until either side closes. The deadlines of the
+// provider's server do not apply once the protocol has switched.
+func proxyUpgrade(w http.ResponseWriter, originalReq *http.Request, functionName string, functionAddr url.URL, extraPath string, dialTimeout time.Duration, breaker *k8s.CircuitBreaker, logger logr.Logger) {
+	proxyReq, err := buildProxyRequest(originalReq, functionAddr, extraPath)
+	if err != nil {
+		httputil.Errorf(w, http.StatusInternalServerError, "Failed to resolve service: %s.", functionName)
+		return
+	}
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	upstream, err := dialer.DialContext(originalReq.Context(), "tcp", functionAddr.Host)
+	if err != nil {
+		breaker.Record(functionAddr.Host, false)
+		logger.Error(err, "Error with proxy request", "url", proxyReq.URL.String())
+		httputil.Errorf(w, http.StatusInternalServerError, "Can't reach service for: %s.", functionName)
+		return
+	}
+	defer upstream.Close()
+
+	upstreamReader := bufio.NewReader(upstream)
+	if err := proxyReq.Write(upstream); err != nil {
+		logger.Error(err, "Error with proxy request", "url", proxyReq.URL.String())
+		httputil.Errorf(w, http.StatusInternalServerError, "Can't reach service for: %s.", functionName)
+		return
+	}
+
+	response, err := http.ReadResponse(upstreamReader, proxyReq)
+	if err != nil {
+		breaker.Record(functionAddr.Host, false)
+		logger.Error(err, "Error with proxy request", "url", proxyReq.URL.String())
+		httputil.Errorf(w, http.StatusInternalServerError, "Can't reach service for: %s.", functionName)
+		return
+	}
+	defer response.Body.Close()
+	breaker.Record(functionAddr.Host, !failedInvocation(originalReq.Context(), response, nil))
+
+	// the function declined to switch protocols
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		copyHeaders(w.Header(), response.Header)
+		w.WriteHeader(response.StatusCode)
+		if err := copyResponse(w, response); err != nil {
+			logger.Error(err, "Error copying the response")
+		}
+		return
+	}
+
+	caller, callerBuf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		logger.Error(err, "Unable to hijack the connection for the upgrade")
+		httputil.Errorf(w, http.StatusInternalServerError, "Unable to upgrade the connection for: %s.", functionName)
+		return
+	}
+	defer caller.Close()
+	caller.SetDeadline(time.Time{})
+
+	fmt.Fprintf(callerBuf, "HTTP/1.1 %s\r\n", response.Status)
+	response.Header.Write(callerBuf)
+	callerBuf.WriteString("\r\n")
+	if err := callerBuf.Flush(); err != nil {
+		logger.Error(err, "Error writing the upgrade response")
+		return
+	}
+
+	start := time.Now()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, callerBuf)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(caller, upstreamReader)
+		done <- struct{}{}
+	}()
+
+	// the deferred closes end the other copy
+	<-done
+	logger.V(1).Info("Upgraded connection closed", "protocol", response.Header.Get("Upgrade"), "seconds", time.Since(start).Seconds())
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// newEchoFunction switches to an echo protocol and writes back each byte it reads
+func newEchoFunction(t *testing.T) *url.URL {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+		io.Copy(conn, buf)
+	}))
+	t.Cleanup(function.Close)
+
+	functionURL, _ := url.Parse(function.URL)
+	return functionURL
+}
+
+func newUpgradeProvider(t *testing.T, functionURL *url.URL) string {
+	client := NewProxyClient(ProxyConfig{Timeout: time.Second * 5})
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}{params:/?.*}", MakeProxyHandler(client, staticResolver{url: *functionURL}, nil, nil, nil))
+
+	provider := httptest.NewUnstartedServer(router)
+	// the deadline must not apply once the protocol has switched
+	provider.Config.WriteTimeout = time.Millisecond * 200
+	provider.Start()
+	t.Cleanup(provider.Close)
+
+	return provider.Listener.Addr().String()
+}
+
+func Test_MakeProxyHandler_UpgradesConnection(t *testing.T) {
+	addr := newUpgradeProvider(t, newEchoFunction(t))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+
+	io.WriteString(conn, "GET /function/echo HTTP/1.1\r\nHost: gateway\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Upgrade") != "echo" {
+		t.Fatalf("want the protocol to be switched, got %d %v", response.StatusCode, response.Header)
+	}
+
+	// outlive the write timeout of the provider
+	time.Sleep(time.Millisecond * 300)
+
+	for _, message := range []string{"ping", "pong"} {
+		io.WriteString(conn, message)
+		got := make([]byte, len(message))
+		if _, err := io.ReadFull(reader, got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != message {
+			t.Errorf("want %q to be echoed, got %q", message, got)
+		}
+	}
+}
+
+func Test_MakeProxyHandler_UpgradeDeclined(t *testing.T) {
+	addr := newUpgradeProvider(t, newEchoFunction(t))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/function/echo", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("want the status of the function, got %d", response.StatusCode)
+	}
+}
+
+func Test_isUpgrade(t *testing.T) {
+	cases := []struct {
+		connection string
+		upgrade    string
+		want       bool
+	}{
+		{connection: "Upgrade", upgrade: "websocket", want: true},
+		{connection: "keep-alive, upgrade", upgrade: "websocket", want: true},
+		{connection: "keep-alive", upgrade: "websocket", want: false},
+		{connection: "Upgrade", upgrade: "", want: false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/function/echo", nil)
+		r.Header.Set("Connection", c.connection)
+		if c.upgrade != "" {
+			r.Header.Set("Upgrade", c.upgrade)
+		}
+		if got := isUpgrade(r); got != c.want {
+			t.Errorf("Connection: %q, Upgrade: %q, want %t, got %t", c.connection, c.upgrade, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logging"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// NamespaceUsage is the CPU, memory and storage requested by the functions of a
+// namespace, and what is left of its ResourceQuotas
+type NamespaceUsage struct {
+	Namespace string `json:"namespace"`
+	Functions int    `json:"functions"`
+	Replicas  int32  `json:"replicas"`
+	CPU       string `json:"cpu"`
+	Memory    string `json:"memory"`
+	Storage   string `json:"storage"`
+	// Quota has the tightest of the ResourceQuotas of the namespace for each of
+	// their resources, such as requests.cpu or count/statefulsets.apps. It is empty
+	// when the namespace has no ResourceQuota.
+	Quota map[corev1.ResourceName]QuotaUsage `json:"quota,omitempty"`
+}
+
+// QuotaUsage is the limit of a ResourceQuota for one resource, what is used of it
+// by all of the workloads in the namespace and the headroom that is left
+type QuotaUsage struct {
+	Quota     string `json:"quota"`
+	Hard      string `json:"hard"`
+	Used      string `json:"used"`
+	Remaining string `json:"remaining"`
+}
+
+// MakeNamespaceUsageHandler reports the resources requested by the functions of
+// a namespace and the headroom against its ResourceQuotas, so that a tenant can
+// check the capacity that is left before deploying
+func MakeNamespaceUsageHandler(defaultNamespace string, statefulSetLister v1.StatefulSetLister, client kubernetes.Interface, apiTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lookupNamespace := mux.Vars(r)["ns"]
+		if lookupNamespace != defaultNamespace {
+			respondError(w, badRequest("namespace must be: %s", defaultNamespace))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithValues("namespace", lookupNamespace)
+
+		req, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		statefulsets, err := statefulSetLister.StatefulSets(lookupNamespace).List(labels.NewSelector().Add(*req))
+		if err != nil {
+			logger.Error(err, "Unable to list functions")
+			respondError(w, err)
+			return
+		}
+
+		ctx, cancel := k8s.WithAPITimeout(r.Context(), apiTimeout)
+		defer cancel()
+
+		claims, err := listClaims(ctx, client, lookupNamespace)
+		if err != nil {
+			logger.Error(err, "Unable to list PersistentVolumeClaims")
+			respondError(w, err)
+			return
+		}
+
+		quotas, err := client.CoreV1().ResourceQuotas(lookupNamespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			logger.Error(err, "Unable to list ResourceQuotas")
+			respondError(w, err)
+			return
+		}
+
+		cpu := *resource.NewQuantity(0, resource.DecimalSI)
+		memory := *resource.NewQuantity(0, resource.BinarySI)
+		storage := *resource.NewQuantity(0, resource.BinarySI)
+
+		usage := NamespaceUsage{Namespace: lookupNamespace}
+		for _, statefulset := range statefulsets {
+			functionUsage := k8s.GetFunctionUsage(statefulset, claims)
+			usage.Functions++
+			usage.Replicas += functionUsage.Replicas
+			cpu.Add(functionUsage.CPU)
+			memory.Add(functionUsage.Memory)
+			storage.Add(functionUsage.Storage)
+		}
+		usage.CPU = cpu.String()
+		usage.Memory = memory.String()
+		usage.Storage = storage.String()
+		usage.Quota = quotaHeadroom(quotas.Items)
+
+		res, err := json.Marshal(usage)
+		if err != nil {
+			logger.Error(err, "Unable to marshal the namespace usage")
+			respondError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(res)
+	}
+}
+
+// quotaHeadroom returns the QuotaUsage of each resource from the ResourceQuota
+// with the least remaining, as that is the one which rejects a deployment first
+func quotaHeadroom(quotas []corev1.ResourceQuota) map[corev1.ResourceName]QuotaUsage {
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	tightest := map[corev1.ResourceName]resource.Quantity{}
+	headroom := map[corev1.ResourceName]QuotaUsage{}
+	for _, quota := range quotas {
+		for name, hard := range quota.Spec.Hard {
+			used := quota.Status.Used[name]
+			remaining := hard.DeepCopy()
+			remaining.Sub(used)
+			if remaining.Sign() < 0 {
+				remaining = *resource.NewQuantity(0, hard.Format)
+			}
+
+			if current, ok := tightest[name]; ok && remaining.Cmp(current) >= 0 {
+				continue
+			}
+			tightest[name] = remaining
+			headroom[name] = QuotaUsage{
+				Quota:     quota.Name,
+				Hard:      hard.String(),
+				Used:      used.String(),
+				Remaining: remaining.String(),
+			}
+		}
+	}
+	return headroom
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newResourceQuota(name string, hard, used corev1.ResourceList) *corev1.ResourceQuota {
+	return &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn"},
+		Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+	}
+}
+
+func Test_MakeNamespaceUsageHandler(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(newChargebackStatefulSet("figlet", map[string]string{}, 2, "100m", "128Mi"))
+	indexer.Add(newChargebackStatefulSet("env", map[string]string{}, 1, "50m", "64Mi"))
+
+	client := fake.NewSimpleClientset(
+		newResourceQuota("compute", corev1.ResourceList{
+			corev1.ResourceRequestsCPU:    resource.MustParse("2"),
+			corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+		}, corev1.ResourceList{
+			corev1.ResourceRequestsCPU:    resource.MustParse("500m"),
+			corev1.ResourceRequestsMemory: resource.MustParse("1200Mi"),
+		}),
+		newResourceQuota("team", corev1.ResourceList{
+			corev1.ResourceRequestsCPU: resource.MustParse("1"),
+		}, corev1.ResourceList{
+			corev1.ResourceRequestsCPU: resource.MustParse("500m"),
+		}),
+	)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/system/namespaces/{ns}/usage", MakeNamespaceUsageHandler("openfaas-fn", appslister.NewStatefulSetLister(indexer), client, time.Second))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/namespaces/openfaas-fn/usage", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var got NamespaceUsage
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := NamespaceUsage{
+		Namespace: "openfaas-fn",
+		Functions: 2,
+		Replicas:  3,
+		CPU:       "250m",
+		Memory:    "320Mi",
+		Storage:   "0",
+		Quota: map[corev1.ResourceName]QuotaUsage{
+			corev1.ResourceRequestsCPU:    {Quota: "team", Hard: "1", Used: "500m", Remaining: "500m"},
+			corev1.ResourceRequestsMemory: {Quota: "compute", Hard: "1Gi", Used: "1200Mi", Remaining: "0"},
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %+v\n got %+v", want, got)
+	}
+}
+
+func Test_MakeNamespaceUsageHandler_WithoutQuota(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/system/namespaces/{ns}/usage", MakeNamespaceUsageHandler("openfaas-fn", appslister.NewStatefulSetLister(indexer), fake.NewSimpleClientset(), time.Second))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/namespaces/openfaas-fn/usage", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var got NamespaceUsage
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.Functions != 0 || got.Quota != nil {
+		t.Errorf("want no functions and no quota, got %+v", got)
+	}
+}
+
+func Test_MakeNamespaceUsageHandler_OtherNamespace(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/system/namespaces/{ns}/usage", MakeNamespaceUsageHandler("openfaas-fn", appslister.NewStatefulSetLister(indexer), fake.NewSimpleClientset(), time.Second))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/namespaces/kube-system/usage", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("want status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -7,24 +7,32 @@ package handlers
 import (
 	"fmt"
 	"regexp"
-	"strconv"
 
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/schedule"
 	types "github.com/openfaas/faas-provider/types"
 )
 
-// Regex for RFC-1123 validation:
+// Regex for DNS-1035 validation, which starts with a letter:
 //
-//	k8s.io/kubernetes/pkg/util/validation/validation.go
-var validDNS = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+//	k8s.io/apimachinery/pkg/util/validation/validation.go
+var dns1035 = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
 
-// validates that the service name is valid for Kubernetes
+// maxServiceLength keeps the controller-revision-hash label of the Pods of a
+// function, which is its name, a dash and a hash of up to 10 characters, within the
+// 63 characters of a label value
+const maxServiceLength = 52
+
+// validates that the service name is a DNS-1035 label, which Kubernetes requires
+// for the name of the Service of the function
 func validateService(service string) error {
-	matched := validDNS.MatchString(service)
-	if matched {
-		return nil
+	if !dns1035.MatchString(service) {
+		return fmt.Errorf("service: (%s) is invalid, must be a valid DNS entry", service)
 	}
-
-	return fmt.Errorf("service: (%s) is invalid, must be a valid DNS entry", service)
+	if len(service) > maxServiceLength {
+		return fmt.Errorf("service: (%s) is invalid, must be no more than %d characters", service, maxServiceLength)
+	}
+	return nil
 }
 
 // ValidateDeployRequest validates that the service name is valid for Kubernetes
@@ -47,6 +55,108 @@ func ValidateDeployRequest(request *types.FunctionDeployment) error {
 		return err
 	}
 
+	if err := validateScalingSchedule(request); err != nil {
+		return err
+	}
+
+	if err := validateRunAs(request); err != nil {
+		return err
+	}
+
+	if err := validateServiceToken(request); err != nil {
+		return err
+	}
+
+	if _, _, err := k8s.ParseConstraints(request.Constraints); err != nil {
+		return err
+	}
+
+	if request.Annotations != nil {
+		if err := k8s.ValidateScrapeAnnotations(*request.Annotations); err != nil {
+			return err
+		}
+		if _, err := k8s.RolloutAnnotations(*request.Annotations); err != nil {
+			return err
+		}
+		if _, err := k8s.ProbeHandler(*request.Annotations, false, 0); err != nil {
+			return err
+		}
+		if _, err := k8s.FunctionTimeout(*request.Annotations); err != nil {
+			return err
+		}
+		if _, err := k8s.ParseSecretMounts(*request.Annotations); err != nil {
+			return err
+		}
+		if strategy, ok := (*request.Annotations)[k8s.AnnotationLoadBalancing]; ok {
+			if err := k8s.ValidateLoadBalancing(strategy); err != nil {
+				return err
+			}
+		}
+		if _, err := k8s.ParseMaintenance(*request.Annotations); err != nil {
+			return err
+		}
+		if _, err := k8s.MakeScaledObject(request.Service, "", *request.Annotations, requestLabels(*request)); err != nil {
+			return err
+		}
+		if _, err := k8s.MakeHPA(request.Service, "", *request.Annotations, requestLabels(*request)); err != nil {
+			return err
+		}
+		if _, _, err := k8s.MakeRoute(request.Service, "", k8s.DefaultFunctionPort, *request.Annotations); err != nil {
+			return err
+		}
+		if _, err := k8s.MakeCertificate(request.Service, "", *request.Annotations); err != nil {
+			return err
+		}
+		if _, _, err := k8s.MakeEgressPolicy(request.Service, "", *request.Annotations); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateRunAs(request *types.FunctionDeployment) error {
+	if request.Annotations == nil {
+		return nil
+	}
+
+	annotations := *request.Annotations
+	if value, ok := annotations[k8s.AnnotationRunAsUser]; ok {
+		if _, err := k8s.ParseUserID(value); err != nil {
+			return fmt.Errorf("%s is invalid: %w", k8s.AnnotationRunAsUser, err)
+		}
+	}
+	if value, ok := annotations[k8s.AnnotationRunAsGroup]; ok {
+		if _, err := k8s.ParseGroupID(value); err != nil {
+			return fmt.Errorf("%s is invalid: %w", k8s.AnnotationRunAsGroup, err)
+		}
+	}
+	return nil
+}
+
+func validateServiceToken(request *types.FunctionDeployment) error {
+	if request.Annotations == nil {
+		return nil
+	}
+
+	if value, ok := (*request.Annotations)[k8s.AnnotationTokenExpiration]; ok {
+		if _, err := k8s.ParseTokenExpiration(value); err != nil {
+			return fmt.Errorf("%s is invalid: %w", k8s.AnnotationTokenExpiration, err)
+		}
+	}
+	return nil
+}
+
+func validateScalingSchedule(request *types.FunctionDeployment) error {
+	if request.Annotations == nil {
+		return nil
+	}
+
+	if value, ok := (*request.Annotations)[schedule.Annotation]; ok {
+		if _, err := schedule.Parse(value); err != nil {
+			return fmt.Errorf("%s is invalid: %w", schedule.Annotation, err)
+		}
+	}
 	return nil
 }
 
@@ -73,20 +183,8 @@ func validateScalingLabels(request *types.FunctionDeployment) error {
 		return fmt.Errorf("com.openfaas.scale.type not available for Community Edition")
 	}
 
-	if v, ok := labels["com.openfaas.scale.max"]; ok {
-		if vv, err := strconv.Atoi(v); err == nil {
-			if vv > MaxReplicas {
-				return fmt.Errorf("com.openfaas.scale.max is set too high for Community Edition")
-			}
-		}
-	}
-
-	if v, ok := labels["com.openfaas.scale.min"]; ok {
-		if vv, err := strconv.Atoi(v); err == nil {
-			if vv > MaxReplicas {
-				return fmt.Errorf("com.openfaas.scale.min is set too high for Community Edition")
-			}
-		}
+	if _, err := k8s.FunctionPriority(labels); err != nil {
+		return err
 	}
 
 	return nil
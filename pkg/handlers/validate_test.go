@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/openfaas/faas-provider/types"
@@ -40,3 +41,84 @@ func Test_validateScalingLabels(t *testing.T) {
 	}
 
 }
+
+func Test_validateScalingSchedule(t *testing.T) {
+	valid := map[string]string{"com.openfaas.scale.schedule": "0 8 * * 1-5=10; 0 20 * * *=2"}
+	if err := validateScalingSchedule(&types.FunctionDeployment{Annotations: &valid}); err != nil {
+		t.Errorf("want a valid schedule, got %s", err)
+	}
+
+	invalid := map[string]string{"com.openfaas.scale.schedule": "0 8 * *=10"}
+	if err := validateScalingSchedule(&types.FunctionDeployment{Annotations: &invalid}); err == nil {
+		t.Error("want an error for an invalid schedule")
+	}
+}
+
+func Test_validateRunAs(t *testing.T) {
+	valid := map[string]string{"com.openfaas.security.run-as-user": "1000", "com.openfaas.security.run-as-group": "0"}
+	if err := validateRunAs(&types.FunctionDeployment{Annotations: &valid}); err != nil {
+		t.Errorf("want a valid user and group, got %s", err)
+	}
+
+	root := map[string]string{"com.openfaas.security.run-as-user": "0"}
+	if err := validateRunAs(&types.FunctionDeployment{Annotations: &root}); err == nil {
+		t.Error("want an error for the root user")
+	}
+}
+
+func Test_ValidateDeployRequest_Constraints(t *testing.T) {
+	request := types.FunctionDeployment{
+		Service:     "figlet",
+		Image:       "ghcr.io/openfaas/figlet:latest",
+		Constraints: []string{"topology.kubernetes.io/zone in (a,b)", "zone:a"},
+	}
+
+	err := ValidateDeployRequest(&request)
+	if err == nil || !strings.Contains(err.Error(), `"zone:a"`) {
+		t.Fatalf("want the invalid constraint to be reported, got %v", err)
+	}
+
+	request.Constraints = []string{"topology.kubernetes.io/zone in (a,b)", "!spot"}
+	if err := ValidateDeployRequest(&request); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func Test_ValidateDeployRequest_ScrapeAnnotations(t *testing.T) {
+	request := types.FunctionDeployment{
+		Service: "figlet",
+		Image:   "ghcr.io/openfaas/figlet:latest",
+		Annotations: &map[string]string{
+			"prometheus.io/scrape": "true",
+			"prometheus.io/port":   "http",
+		},
+	}
+
+	err := ValidateDeployRequest(&request)
+	if err == nil || !strings.Contains(err.Error(), "prometheus.io/port") {
+		t.Fatalf("want the invalid port to be reported, got %v", err)
+	}
+
+	(*request.Annotations)["prometheus.io/port"] = "8081"
+	if err := ValidateDeployRequest(&request); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func Test_ValidateDeployRequest_Timeout(t *testing.T) {
+	request := types.FunctionDeployment{
+		Service:     "figlet",
+		Image:       "ghcr.io/openfaas/figlet:latest",
+		Annotations: &map[string]string{"com.openfaas.timeout": "soon"},
+	}
+
+	err := ValidateDeployRequest(&request)
+	if err == nil || !strings.Contains(err.Error(), "com.openfaas.timeout") {
+		t.Fatalf("want the invalid timeout to be reported, got %v", err)
+	}
+
+	(*request.Annotations)["com.openfaas.timeout"] = "2m"
+	if err := ValidateDeployRequest(&request); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultWaitTimeout is how long a handler waits for the replicas of a function
+	// to become ready when wait=true is set without a timeout
+	defaultWaitTimeout = time.Minute
+
+	// maxWaitTimeout bounds the timeout that can be requested
+	maxWaitTimeout = time.Minute * 10
+)
+
+// parseWait reads the wait and timeout query parameters, a handler that is passed
+// wait=true blocks until the replicas of the function are ready, or until timeout
+func parseWait(q url.Values) (bool, time.Duration, error) {
+	value := q.Get("wait")
+	if value == "" {
+		return false, 0, nil
+	}
+
+	wait, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, 0, fmt.Errorf("invalid value for wait: %q", value)
+	}
+	if !wait {
+		return false, 0, nil
+	}
+
+	timeout := defaultWaitTimeout
+	if value := q.Get("timeout"); value != "" {
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return false, 0, fmt.Errorf("invalid value for timeout: %q", value)
+		}
+		if timeout > maxWaitTimeout {
+			return false, 0, fmt.Errorf("timeout must be at most %s", maxWaitTimeout)
+		}
+	}
+
+	return true, timeout, nil
+}
+
+// writeRolloutStatus waits for the rollout of a function that has been deployed or
+// updated and writes its RolloutStatus. The change was accepted either way, the
+// status is 200 once the rollout is complete and 202 when the timeout was reached.
+func writeRolloutStatus(ctx context.Context, w http.ResponseWriter, logger logr.Logger, client kubernetes.Interface, namespace, name string, timeout time.Duration) {
+	rollout, err := k8s.WaitForRollout(ctx, client, namespace, name, timeout)
+	if err != nil {
+		logger.Error(err, "Unable to read the rollout status of the function statefulset")
+		respondError(w, fmt.Errorf("unable to read the rollout status of function statefulset %s: %w", name, err))
+		return
+	}
+
+	logger.Info("Waited for rollout", "ready", rollout.Ready, "updatedReplicas", rollout.UpdatedReplicas, "readyReplicas", rollout.ReadyReplicas)
+
+	res, err := json.Marshal(rollout)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !rollout.Ready {
+		status = http.StatusAccepted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(res)
+}
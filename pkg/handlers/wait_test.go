@@ -0,0 +1,40 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func Test_parseWait(t *testing.T) {
+	cases := []struct {
+		query   string
+		wait    bool
+		timeout time.Duration
+		wantErr bool
+	}{
+		{query: ""},
+		{query: "wait=false&timeout=10s"},
+		{query: "wait=true", wait: true, timeout: defaultWaitTimeout},
+		{query: "wait=true&timeout=90s", wait: true, timeout: time.Second * 90},
+		{query: "wait=yes", wantErr: true},
+		{query: "wait=true&timeout=-1s", wantErr: true},
+		{query: "wait=true&timeout=1h", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(c.query)
+			wait, timeout, err := parseWait(q)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("want error: %v, got: %v", c.wantErr, err)
+			}
+			if wait != c.wait || timeout != c.timeout {
+				t.Errorf("want wait: %v timeout: %s, got wait: %v timeout: %s", c.wait, c.timeout, wait, timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	annotationSignature   = "dev.cosignproject.cosign/signature"
+	annotationCertificate = "dev.sigstore.cosign/certificate"
+	annotationChain       = "dev.sigstore.cosign/chain"
+)
+
+var (
+	// oidIssuer is the OIDC issuer in certificates from Fulcio before v1.2
+	oidIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	// oidIssuerV2 is the DER encoded OIDC issuer in certificates from Fulcio
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// simpleSigning is the payload that is signed by cosign
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// signatureTag is where cosign stores the signatures of a manifest
+func signatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// verifySignatures returns nil when one of the cosign signatures of the image is
+// valid for the policy
+func verifySignatures(ctx context.Context, registry *registryClient, ref Reference, digest string, policy *SignaturePolicy) error {
+	sigs, err := registry.manifest(ctx, ref, signatureTag(digest))
+	if err != nil {
+		var notFound errNotFound
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("%w: no cosign signature found for %s", ErrDenied, ref)
+		}
+		return fmt.Errorf("unable to read the signatures of %s: %w", ref, err)
+	}
+
+	var reasons []string
+	for _, layer := range sigs.Layers {
+		signature, err := base64.StdEncoding.DecodeString(layer.Annotations[annotationSignature])
+		if err != nil || len(signature) == 0 {
+			reasons = append(reasons, "invalid signature annotation")
+			continue
+		}
+
+		payload, err := registry.blob(ctx, ref, layer.Digest)
+		if err != nil {
+			return fmt.Errorf("unable to read the signature payload of %s: %w", ref, err)
+		}
+
+		if err := verifyPayload(payload, digest); err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+
+		if err := verifyLayer(policy, payload, signature, layer.Annotations); err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+
+		return nil
+	}
+
+	if len(reasons) == 0 {
+		reasons = append(reasons, "no signatures")
+	}
+	return fmt.Errorf("%w: no valid cosign signature for %s: %s", ErrDenied, ref, strings.Join(reasons, "; "))
+}
+
+// verifyPayload checks that the signed payload is for the image's digest, so that
+// a signature can not be copied to another image
+func verifyPayload(payload []byte, digest string) error {
+	signed := simpleSigning{}
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+	if signed.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Errorf("signature is for digest %s", signed.Critical.Image.DockerManifestDigest)
+	}
+	return nil
+}
+
+func verifyLayer(policy *SignaturePolicy, payload, signature []byte, annotations map[string]string) error {
+	for _, key := range policy.keys {
+		if verifySignature(key, payload, signature) == nil {
+			return nil
+		}
+	}
+
+	certPEM := annotations[annotationCertificate]
+	if certPEM == "" || len(policy.Keyless) == 0 {
+		return fmt.Errorf("signature does not match the public keys")
+	}
+
+	cert, err := verifyCertificate(policy, certPEM, annotations[annotationChain])
+	if err != nil {
+		return err
+	}
+
+	if err := verifySignature(cert.PublicKey, payload, signature); err != nil {
+		return fmt.Errorf("signature does not match the certificate: %w", err)
+	}
+	return nil
+}
+
+// verifyCertificate checks the keyless certificate against the roots and returns it
+// when it was issued to one of the identities. The certificate is only valid for a
+// few minutes after signing, so its chain is checked at the time it was issued.
+func verifyCertificate(policy *SignaturePolicy, certPEM, chainPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("invalid certificate annotation")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM([]byte(chainPEM))
+
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         policy.roots,
+		Intermediates: intermediates,
+		CurrentTime:   cert.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, fmt.Errorf("certificate is not issued by the fulcioRoots: %w", err)
+	}
+
+	issuer := certificateIssuer(cert)
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		subjects = append(subjects, u.String())
+	}
+
+	for _, identity := range policy.Keyless {
+		if identity.Issuer != issuer {
+			continue
+		}
+		for _, subject := range subjects {
+			if subject == identity.Subject {
+				return cert, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("certificate for %v from %q does not match the keyless identities", subjects, issuer)
+}
+
+func certificateIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &issuer, "utf8"); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(oidIssuer):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+func verifySignature(key crypto.PublicKey, payload, signature []byte) error {
+	digest := sha256.Sum256(payload)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(k, digest[:], signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(k, payload, signature) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return fmt.Errorf("invalid signature")
+}
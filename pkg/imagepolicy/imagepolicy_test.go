@@ -0,0 +1,284 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRegistry serves an image and its cosign signature
+type fakeRegistry struct {
+	server    *httptest.Server
+	manifests map[string][]byte
+	blobs     map[string][]byte
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+	r.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.Path, "/v2/functions/figlet")
+		switch {
+		case strings.HasPrefix(path, "/manifests/"):
+			body, ok := r.manifests[strings.TrimPrefix(path, "/manifests/")]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			w.Write(body)
+		case strings.HasPrefix(path, "/blobs/"):
+			body, ok := r.blobs[strings.TrimPrefix(path, "/blobs/")]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			w.Write(body)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(r.server.Close)
+
+	r.manifests["latest"] = []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`)
+	return r
+}
+
+func (r *fakeRegistry) image() string {
+	return strings.TrimPrefix(r.server.URL, "https://") + "/functions/figlet:latest"
+}
+
+func (r *fakeRegistry) digest() string {
+	sum := sha256.Sum256(r.manifests["latest"])
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// sign adds a signature over the payload for digest, with the given annotations
+func (r *fakeRegistry) sign(t *testing.T, key *ecdsa.PrivateKey, digest string, annotations map[string]string) {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"figlet"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, digest))
+	sum := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layerDigest := "sha256:" + hex.EncodeToString(sum[:])
+	r.blobs[layerDigest] = payload
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotationSignature] = base64.StdEncoding.EncodeToString(signature)
+
+	sig := map[string]interface{}{
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"layers": []interface{}{map[string]interface{}{
+			"mediaType":   "application/vnd.dev.cosign.simplesigning.v1+json",
+			"digest":      layerDigest,
+			"annotations": annotations,
+		}},
+	}
+	body, _ := json.Marshal(sig)
+	r.manifests[signatureTag(r.digest())] = body
+}
+
+func publicKeyPEM(t *testing.T, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func keyPolicy(t *testing.T, key *ecdsa.PrivateKey) *Policy {
+	policy, err := Parse([]byte(fmt.Sprintf("default:\n  signatures:\n    publicKeys:\n    - %q\n", publicKeyPEM(t, key))))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return policy
+}
+
+func Test_Verify_PublicKey(t *testing.T) {
+	registry := newFakeRegistry(t)
+	key := newKey(t)
+	registry.sign(t, key, registry.digest(), nil)
+
+	verifier := NewVerifier(keyPolicy(t, key), registry.server.Client())
+	if err := verifier.Verify(context.Background(), "openfaas-fn", registry.image()); err != nil {
+		t.Fatalf("want the signed image to be accepted, got %s", err)
+	}
+}
+
+func Test_Verify_Unsigned(t *testing.T) {
+	registry := newFakeRegistry(t)
+
+	verifier := NewVerifier(keyPolicy(t, newKey(t)), registry.server.Client())
+	err := verifier.Verify(context.Background(), "openfaas-fn", registry.image())
+	if !errors.Is(err, ErrDenied) {
+		t.Fatalf("want ErrDenied for an unsigned image, got %v", err)
+	}
+}
+
+func Test_Verify_OtherKey(t *testing.T) {
+	registry := newFakeRegistry(t)
+	registry.sign(t, newKey(t), registry.digest(), nil)
+
+	verifier := NewVerifier(keyPolicy(t, newKey(t)), registry.server.Client())
+	if err := verifier.Verify(context.Background(), "openfaas-fn", registry.image()); !errors.Is(err, ErrDenied) {
+		t.Fatalf("want ErrDenied for a signature from another key, got %v", err)
+	}
+}
+
+func Test_Verify_SignatureForOtherDigest(t *testing.T) {
+	registry := newFakeRegistry(t)
+	key := newKey(t)
+	registry.sign(t, key, "sha256:"+strings.Repeat("0", 64), nil)
+
+	verifier := NewVerifier(keyPolicy(t, key), registry.server.Client())
+	if err := verifier.Verify(context.Background(), "openfaas-fn", registry.image()); !errors.Is(err, ErrDenied) {
+		t.Fatalf("want ErrDenied for a signature copied from another image, got %v", err)
+	}
+}
+
+func Test_Verify_NamespaceWithoutPolicy(t *testing.T) {
+	policy, err := Parse([]byte("namespaces:\n  staging: {}\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the registry is never called when no signature is required
+	verifier := NewVerifier(policy, nil)
+	if err := verifier.Verify(context.Background(), "staging", "127.0.0.1:1/functions/figlet:latest"); err != nil {
+		t.Fatalf("want no verification, got %s", err)
+	}
+}
+
+func Test_Verify_Keyless(t *testing.T) {
+	rootKey := newKey(t)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, _ := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	root, _ := x509.ParseCertificate(rootDER)
+
+	issuer, _ := asn1.MarshalWithParams("https://token.actions.githubusercontent.com", "utf8")
+	signingKey := newKey(t)
+	leafTemplate := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		NotBefore:      time.Now().Add(-2 * time.Hour),
+		NotAfter:       time.Now().Add(-2*time.Hour + 10*time.Minute),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses: []string{"release@example.com"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidIssuerV2, Value: issuer},
+		},
+	}
+	// the root must have been valid when the short-lived certificate was issued
+	rootTemplate.NotBefore = time.Now().Add(-3 * time.Hour)
+	rootDER, _ = x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	root, _ = x509.ParseCertificate(rootDER)
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &signingKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := newFakeRegistry(t)
+	registry.sign(t, signingKey, registry.digest(), map[string]string{
+		annotationCertificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})),
+	})
+
+	rootPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}))
+	for subject, allowed := range map[string]bool{"release@example.com": true, "someone@example.com": false} {
+		policy, err := Parse([]byte(fmt.Sprintf(`default:
+  signatures:
+    fulcioRoots: %q
+    keyless:
+    - issuer: https://token.actions.githubusercontent.com
+      subject: %s
+`, rootPEM, subject)))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		err = NewVerifier(policy, registry.server.Client()).Verify(context.Background(), "openfaas-fn", registry.image())
+		if allowed && err != nil {
+			t.Errorf("want the certificate for %s to be accepted, got %s", subject, err)
+		}
+		if !allowed && !errors.Is(err, ErrDenied) {
+			t.Errorf("want ErrDenied for the identity %s, got %v", subject, err)
+		}
+	}
+}
+
+func Test_Parse_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":      "default:\n  signature: {}\n",
+		"no keys":            "default:\n  signatures: {}\n",
+		"invalid key":        "default:\n  signatures:\n    publicKeys: [\"not a key\"]\n",
+		"keyless without CA": "default:\n  signatures:\n    keyless:\n    - issuer: https://accounts.google.com\n      subject: a@example.com\n",
+	}
+
+	for name, policy := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(policy)); err == nil {
+				t.Errorf("want an error")
+			}
+		})
+	}
+}
+
+func Test_ParseReference(t *testing.T) {
+	cases := map[string]Reference{
+		"alpine":                        {Registry: "docker.io", Repository: "library/alpine", Tag: "latest"},
+		"functions/figlet:0.1.0":        {Registry: "docker.io", Repository: "functions/figlet", Tag: "0.1.0"},
+		"ghcr.io/openfaas/figlet:0.1.0": {Registry: "ghcr.io", Repository: "openfaas/figlet", Tag: "0.1.0"},
+		"localhost:5000/figlet":         {Registry: "localhost:5000", Repository: "figlet", Tag: "latest"},
+		"ghcr.io/openfaas/figlet@sha256:abc": {
+			Registry: "ghcr.io", Repository: "openfaas/figlet", Digest: "sha256:abc",
+		},
+	}
+
+	for image, want := range cases {
+		got, err := ParseReference(image)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", image, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: want %+v, got %+v", image, want, got)
+		}
+	}
+}
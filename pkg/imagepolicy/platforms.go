@@ -0,0 +1,85 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ArchitectureResolver reads the CPU architectures that an image was built for from
+// its registry, so that functions are only scheduled to nodes that can run them
+type ArchitectureResolver struct {
+	registry *registryClient
+}
+
+// NewArchitectureResolver creates an ArchitectureResolver, the client is used to read
+// the manifests from the registries and may be nil
+func NewArchitectureResolver(client *http.Client) *ArchitectureResolver {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &ArchitectureResolver{registry: &registryClient{client: client}}
+}
+
+// Architectures returns the linux architectures of the image, i.e. amd64 and arm64
+// for a multi-arch image, or the architecture in the config of a single image
+func (a *ArchitectureResolver) Architectures(ctx context.Context, image string) ([]string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	tagOrDigest := ref.Digest
+	if tagOrDigest == "" {
+		tagOrDigest = ref.Tag
+	}
+
+	m, err := a.registry.manifest(ctx, ref, tagOrDigest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the manifest of %s: %w", ref, err)
+	}
+
+	if len(m.Manifests) > 0 {
+		seen := map[string]bool{}
+		architectures := []string{}
+		for _, platform := range m.Manifests {
+			// attestations are stored in the index with an unknown platform
+			if platform.Platform.OS != "linux" || seen[platform.Platform.Architecture] {
+				continue
+			}
+			seen[platform.Platform.Architecture] = true
+			architectures = append(architectures, platform.Platform.Architecture)
+		}
+		sort.Strings(architectures)
+		return architectures, nil
+	}
+
+	if m.Config.Digest == "" {
+		return nil, fmt.Errorf("manifest of %s has no config", ref)
+	}
+
+	body, err := a.registry.blob(ctx, ref, m.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the config of %s: %w", ref, err)
+	}
+
+	config := struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	}{}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("unable to decode the config of %s: %w", ref, err)
+	}
+	if config.Architecture == "" {
+		return nil, nil
+	}
+
+	return []string{config.Architecture}, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_Architectures_Index(t *testing.T) {
+	registry := newFakeRegistry(t)
+	registry.manifests["latest"] = []byte(`{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[
+		{"digest":"sha256:a","platform":{"os":"linux","architecture":"arm64"}},
+		{"digest":"sha256:b","platform":{"os":"linux","architecture":"amd64"}},
+		{"digest":"sha256:c","platform":{"os":"unknown","architecture":"unknown"}},
+		{"digest":"sha256:d","platform":{"os":"windows","architecture":"amd64"}}]}`)
+
+	resolver := NewArchitectureResolver(registry.server.Client())
+	architectures, err := resolver.Architectures(context.Background(), registry.image())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"amd64", "arm64"}
+	if !reflect.DeepEqual(want, architectures) {
+		t.Fatalf("want %v, got %v", want, architectures)
+	}
+}
+
+func Test_Architectures_SingleImage(t *testing.T) {
+	registry := newFakeRegistry(t)
+
+	config := []byte(`{"os":"linux","architecture":"arm64"}`)
+	sum := sha256.Sum256(config)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	registry.blobs[digest] = config
+	registry.manifests["latest"] = []byte(fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":%q},"layers":[]}`, digest))
+
+	resolver := NewArchitectureResolver(registry.server.Client())
+	architectures, err := resolver.Architectures(context.Background(), registry.image())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"arm64"}
+	if !reflect.DeepEqual(want, architectures) {
+		t.Fatalf("want %v, got %v", want, architectures)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package imagepolicy checks the images of functions before they are deployed.
+//
+// The policy is read from a YAML file, the default applies to all namespaces and
+// may be replaced for a namespace. The registries and repositories of the images may
+// be restricted with allow and deny patterns. When signatures are required, the image
+// must have a cosign signature that verifies with one of the public keys, or with a
+// keyless certificate issued to one of the identities. When a vulnerability policy
+// is set, the image is scanned and rejected when it has too many vulnerabilities at
+// or above a severity.
+package imagepolicy
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Policy for the images of functions
+type Policy struct {
+	// Default applies to the namespaces that are not listed in Namespaces
+	Default NamespacePolicy `json:"default"`
+
+	// Namespaces replaces the default policy for a namespace
+	Namespaces map[string]NamespacePolicy `json:"namespaces,omitempty"`
+}
+
+// NamespacePolicy is the policy for the functions in a namespace
+type NamespacePolicy struct {
+	// Registries restricts where the images are pulled from when set
+	Registries *RegistryPolicy `json:"registries,omitempty"`
+
+	// Signatures requires a cosign signature when set
+	Signatures *SignaturePolicy `json:"signatures,omitempty"`
+
+	// Vulnerabilities requires a scan of the image when set
+	Vulnerabilities *VulnerabilityPolicy `json:"vulnerabilities,omitempty"`
+}
+
+// SignaturePolicy lists the keys and identities that may sign images, a signature
+// from any of them is accepted
+type SignaturePolicy struct {
+	// PublicKeys in PEM format, as created by cosign generate-key-pair
+	PublicKeys []string `json:"publicKeys,omitempty"`
+
+	// Keyless identities whose certificates are issued by one of the FulcioRoots
+	Keyless []KeylessIdentity `json:"keyless,omitempty"`
+
+	// FulcioRoots are the PEM certificates that issue the keyless certificates, they
+	// are required for keyless identities. The transparency log is not checked.
+	FulcioRoots string `json:"fulcioRoots,omitempty"`
+
+	keys  []crypto.PublicKey
+	roots *x509.CertPool
+}
+
+// KeylessIdentity is the subject of a keyless certificate, i.e. an email address or
+// the URI of a CI workflow, and the OIDC issuer that authenticated it
+type KeylessIdentity struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+// Load reads and validates the policy file
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image policy: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse parses and validates a policy
+func Parse(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("unable to parse image policy: %w", err)
+	}
+
+	if err := policy.Default.init(); err != nil {
+		return nil, fmt.Errorf("default: %w", err)
+	}
+	for namespace, p := range policy.Namespaces {
+		if err := p.init(); err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+		policy.Namespaces[namespace] = p
+	}
+
+	return policy, nil
+}
+
+// For returns the policy for a namespace
+func (p *Policy) For(namespace string) NamespacePolicy {
+	if policy, ok := p.Namespaces[namespace]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+func (p *NamespacePolicy) init() error {
+	if p.Registries != nil {
+		if err := p.Registries.init(); err != nil {
+			return fmt.Errorf("registries: %w", err)
+		}
+	}
+	if p.Signatures != nil {
+		if err := p.Signatures.init(); err != nil {
+			return err
+		}
+	}
+	if p.Vulnerabilities != nil {
+		if err := p.Vulnerabilities.init(); err != nil {
+			return fmt.Errorf("vulnerabilities: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SignaturePolicy) init() error {
+	if len(s.PublicKeys) == 0 && len(s.Keyless) == 0 {
+		return fmt.Errorf("signatures require at least one public key or keyless identity")
+	}
+
+	for i, key := range s.PublicKeys {
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return fmt.Errorf("public key %d is not PEM encoded", i)
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("public key %d: %w", i, err)
+		}
+		s.keys = append(s.keys, pub)
+	}
+
+	if len(s.Keyless) > 0 {
+		s.roots = x509.NewCertPool()
+		if !s.roots.AppendCertsFromPEM([]byte(s.FulcioRoots)) {
+			return fmt.Errorf("keyless identities require the PEM certificates in fulcioRoots")
+		}
+	}
+
+	for i, identity := range s.Keyless {
+		if identity.Issuer == "" || identity.Subject == "" {
+			return fmt.Errorf("keyless identity %d requires an issuer and a subject", i)
+		}
+	}
+
+	return nil
+}
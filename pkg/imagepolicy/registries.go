@@ -0,0 +1,101 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks a pattern as a regular expression instead of a glob
+const regexPrefix = "regex:"
+
+// RegistryPolicy restricts the registries and repositories that images are pulled
+// from. The patterns match the registry and repository of the image without the tag,
+// for instance docker.io/library/alpine or ghcr.io/openfaas/figlet.
+//
+// A pattern is a glob where * matches within one path segment and ** matches any
+// number of segments, or a regular expression when it starts with "regex:".
+type RegistryPolicy struct {
+	// Allow lists the images that may be deployed, any image is allowed when empty
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny lists the images that may not be deployed, even when they are allowed
+	Deny []string `json:"deny,omitempty"`
+
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+func (r *RegistryPolicy) init() error {
+	var err error
+	if r.allow, err = compilePatterns(r.Allow); err != nil {
+		return fmt.Errorf("allow: %w", err)
+	}
+	if r.deny, err = compilePatterns(r.Deny); err != nil {
+		return fmt.Errorf("deny: %w", err)
+	}
+	return nil
+}
+
+// check returns an error wrapping ErrDenied when the image is denied or not allowed
+func (r *RegistryPolicy) check(ref Reference) error {
+	name := ref.Registry + "/" + ref.Repository
+
+	for i, pattern := range r.deny {
+		if pattern.MatchString(name) {
+			return fmt.Errorf("%w: %s matches the deny pattern %q", ErrDenied, name, r.Deny[i])
+		}
+	}
+
+	if len(r.allow) == 0 {
+		return nil
+	}
+	for _, pattern := range r.allow {
+		if pattern.MatchString(name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s does not match any of the allowed registries", ErrDenied, name)
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		expr := globToRegexp(pattern)
+		if strings.HasPrefix(pattern, regexPrefix) {
+			expr = "^(?:" + strings.TrimPrefix(pattern, regexPrefix) + ")$"
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// globToRegexp converts a glob, where * does not match a "/" and ** does, into an
+// anchored regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_Verify_Registries(t *testing.T) {
+	policy, err := Parse([]byte(`default:
+  registries:
+    allow:
+    - ghcr.io/openfaas/**
+    - docker.io/functions/*
+    - regex:registry\.example\.com/team-(a|b)/.+
+    deny:
+    - ghcr.io/openfaas/internal/*
+namespaces:
+  dev: {}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		namespace string
+		image     string
+		allowed   bool
+	}{
+		{"openfaas-fn", "ghcr.io/openfaas/figlet:0.1.0", true},
+		{"openfaas-fn", "ghcr.io/openfaas/team/figlet:0.1.0", true},
+		{"openfaas-fn", "functions/alpine:latest", true},
+		{"openfaas-fn", "docker.io/functions/nested/alpine:latest", false},
+		{"openfaas-fn", "alpine:latest", false},
+		{"openfaas-fn", "ghcr.io/openfaas/internal/billing:0.1.0", false},
+		{"openfaas-fn", "registry.example.com/team-a/api@sha256:abc", true},
+		{"openfaas-fn", "registry.example.com/team-c/api", false},
+		{"openfaas-fn", "ghcr.io/openfaas.evil/figlet", false},
+		{"dev", "alpine:latest", true},
+	}
+
+	verifier := NewVerifier(policy, nil)
+	for _, c := range cases {
+		err := verifier.Verify(context.Background(), c.namespace, c.image)
+		if c.allowed && err != nil {
+			t.Errorf("%s in %s: want allowed, got %s", c.image, c.namespace, err)
+		}
+		if !c.allowed && !errors.Is(err, ErrDenied) {
+			t.Errorf("%s in %s: want ErrDenied, got %v", c.image, c.namespace, err)
+		}
+	}
+}
+
+func Test_Parse_InvalidRegistryPattern(t *testing.T) {
+	if _, err := Parse([]byte("default:\n  registries:\n    deny: [\"regex:(\"]\n")); err == nil {
+		t.Errorf("want an error for an invalid regular expression")
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// manifestTypes are accepted when resolving the digest of an image
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// maxManifestSize limits the manifests and signature payloads that are read
+const maxManifestSize = 4 << 20
+
+// Reference is a parsed image name
+type Reference struct {
+	// Registry is the host of the registry, i.e. docker.io or ghcr.io
+	Registry string
+	// Repository is the path of the image, i.e. library/alpine
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image name in the same way as the container runtime, an
+// image without a registry is pulled from the Docker Hub
+func ParseReference(image string) (Reference, error) {
+	ref := Reference{}
+	name := image
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !strings.HasPrefix(ref.Digest, "sha256:") {
+			return ref, fmt.Errorf("unsupported digest in image %q", image)
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	if name == "" {
+		return ref, fmt.Errorf("invalid image %q", image)
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Registry = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Registry = "docker.io"
+		ref.Repository = name
+	}
+
+	if ref.Registry == "docker.io" && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	return ref, nil
+}
+
+// String returns the full name of the image
+func (r Reference) String() string {
+	name := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+	return name
+}
+
+// host is the address of the registry's API
+func (r Reference) host() string {
+	if r.Registry == "docker.io" {
+		return "registry-1.docker.io"
+	}
+	return r.Registry
+}
+
+// registryClient reads manifests and blobs from a registry with the anonymous
+// token flow of the distribution API
+type registryClient struct {
+	client *http.Client
+}
+
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	// Manifests is only set for an image index, with one manifest per platform
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+	Layers []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// errNotFound is returned when a manifest or blob does not exist
+type errNotFound struct {
+	what string
+}
+
+func (e errNotFound) Error() string {
+	return e.what + " not found"
+}
+
+// resolve returns the digest of the image's manifest
+func (c *registryClient) resolve(ctx context.Context, ref Reference) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+
+	res, err := c.get(ctx, ref, "/manifests/"+ref.Tag, manifestTypes)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxManifestSize))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if header := res.Header.Get("Docker-Content-Digest"); header != "" && header != digest {
+		return "", fmt.Errorf("digest of %s does not match the registry: %s", ref, header)
+	}
+
+	return digest, nil
+}
+
+// manifest reads a manifest by tag or digest
+func (c *registryClient) manifest(ctx context.Context, ref Reference, tagOrDigest string) (*manifest, error) {
+	res, err := c.get(ctx, ref, "/manifests/"+tagOrDigest, manifestTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	m := &manifest{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxManifestSize)).Decode(m); err != nil {
+		return nil, fmt.Errorf("unable to decode manifest %s: %w", tagOrDigest, err)
+	}
+	return m, nil
+}
+
+// blob reads a blob and checks its digest
+func (c *registryClient) blob(ctx context.Context, ref Reference, digest string) ([]byte, error) {
+	res, err := c.get(ctx, ref, "/blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxManifestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s does not match its digest", digest)
+	}
+	return body, nil
+}
+
+func (c *registryClient) get(ctx context.Context, ref Reference, path string, accept []string) (*http.Response, error) {
+	u := "https://" + ref.host() + "/v2/" + ref.Repository + path
+
+	do := func(token string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(accept) > 0 {
+			req.Header.Set("Accept", strings.Join(accept, ","))
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return c.client.Do(req)
+	}
+
+	res, err := do("")
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+
+		token, err := c.token(ctx, challenge, ref.Repository)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = do(token); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		res.Body.Close()
+		return nil, errNotFound{what: ref.Registry + "/" + ref.Repository + path}
+	case res.StatusCode != http.StatusOK:
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d from %s", res.StatusCode, u)
+	}
+
+	return res, nil
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token requests an anonymous pull token for the repository
+func (c *registryClient) token(ctx context.Context, challenge, repository string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("authentication challenge without a realm")
+	}
+
+	q := url.Values{}
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	q.Set("scope", "repository:"+repository+":pull")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d from the token service", res.StatusCode)
+	}
+
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxManifestSize)).Decode(&body); err != nil {
+		return "", err
+	}
+
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrDenied is returned when an image does not meet the policy
+var ErrDenied = errors.New("image denied by policy")
+
+// Verifier checks images against a Policy
+type Verifier struct {
+	policy   *Policy
+	registry *registryClient
+	scanner  *http.Client
+}
+
+// NewVerifier creates a Verifier, the client is used to read the manifests and
+// signatures from the registries and to call the vulnerability scanner, it may be
+// nil
+func NewVerifier(policy *Policy, client *http.Client) *Verifier {
+	// scanning an image that the scanner has not seen before takes a while
+	scanner := client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+		scanner = &http.Client{Timeout: 2 * time.Minute}
+	}
+
+	return &Verifier{
+		policy:   policy,
+		registry: &registryClient{client: client},
+		scanner:  scanner,
+	}
+}
+
+// Verify returns an error wrapping ErrDenied when the image may not be deployed to
+// the namespace, other errors mean that the image could not be checked
+func (v *Verifier) Verify(ctx context.Context, namespace, image string) error {
+	policy := v.policy.For(namespace)
+	if policy.Registries == nil && policy.Signatures == nil && policy.Vulnerabilities == nil {
+		return nil
+	}
+
+	ref, err := ParseReference(image)
+	if err != nil {
+		return err
+	}
+
+	if policy.Registries != nil {
+		if err := policy.Registries.check(ref); err != nil {
+			return err
+		}
+	}
+
+	if policy.Signatures != nil {
+		digest, err := v.registry.resolve(ctx, ref)
+		if err != nil {
+			return err
+		}
+
+		if err := verifySignatures(ctx, v.registry, ref, digest, policy.Signatures); err != nil {
+			return err
+		}
+	}
+
+	if policy.Vulnerabilities != nil {
+		if user, ok := scanBypass(ctx); ok {
+			if !policy.Vulnerabilities.canBypass(user) {
+				return fmt.Errorf("%w: %s may only be set by one of the bypass users", ErrDenied, AnnotationScanBypass)
+			}
+			return nil
+		}
+
+		if err := policy.Vulnerabilities.check(ctx, v.scanner, image); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
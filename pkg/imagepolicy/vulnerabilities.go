@@ -0,0 +1,211 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// FormatTrivy is the JSON report of trivy image --format json
+	FormatTrivy = "trivy"
+	// FormatGrype is the JSON report of grype -o json
+	FormatGrype = "grype"
+
+	// AnnotationScanBypass skips the vulnerability scan of a function's image when
+	// it is "true", only for the users listed in bypassUsers
+	AnnotationScanBypass = "com.openfaas.image.scan-bypass"
+)
+
+// severities in increasing order, Negligible is reported by Grype
+var severities = map[string]int{
+	"UNKNOWN":    0,
+	"NEGLIGIBLE": 1,
+	"LOW":        1,
+	"MEDIUM":     2,
+	"HIGH":       3,
+	"CRITICAL":   4,
+}
+
+// VulnerabilityPolicy rejects images with too many vulnerabilities, as reported by
+// a scanner that runs as a service, i.e. Trivy or Grype behind a small HTTP adapter.
+//
+// The image is sent to the scanner as {"image": "<image>"} in a POST request and the
+// response must be the JSON report of the scanner in Format. An image that can not
+// be scanned is not deployed.
+type VulnerabilityPolicy struct {
+	// Scanner is the URL of the scanner
+	Scanner string `json:"scanner"`
+
+	// Format of the report, trivy or grype, the default is trivy
+	Format string `json:"format,omitempty"`
+
+	// Severity is the lowest severity that is counted, the default is CRITICAL
+	Severity string `json:"severity,omitempty"`
+
+	// MaxCount is the number of counted vulnerabilities that is tolerated, the
+	// default of 0 rejects an image with any of them
+	MaxCount int `json:"maxCount,omitempty"`
+
+	// BypassUsers may skip the scan of an image with the
+	// com.openfaas.image.scan-bypass annotation, i.e. to deploy a fix while a
+	// vulnerability in the base image has no patch
+	BypassUsers []string `json:"bypassUsers,omitempty"`
+
+	severity int
+}
+
+func (v *VulnerabilityPolicy) init() error {
+	if _, err := url.ParseRequestURI(v.Scanner); err != nil {
+		return fmt.Errorf("invalid scanner URL %q: %w", v.Scanner, err)
+	}
+
+	switch v.Format {
+	case "":
+		v.Format = FormatTrivy
+	case FormatTrivy, FormatGrype:
+	default:
+		return fmt.Errorf("invalid format %q, use %s or %s", v.Format, FormatTrivy, FormatGrype)
+	}
+
+	if v.Severity == "" {
+		v.Severity = "CRITICAL"
+	}
+	severity, ok := severities[strings.ToUpper(v.Severity)]
+	if !ok {
+		return fmt.Errorf("invalid severity %q, use LOW, MEDIUM, HIGH or CRITICAL", v.Severity)
+	}
+	v.severity = severity
+
+	if v.MaxCount < 0 {
+		return fmt.Errorf("maxCount must not be negative, got: %d", v.MaxCount)
+	}
+	return nil
+}
+
+// canBypass returns true when the user may skip the scan
+func (v *VulnerabilityPolicy) canBypass(user string) bool {
+	for _, u := range v.BypassUsers {
+		if u != "" && u == user {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error wrapping ErrDenied when the image has more vulnerabilities
+// at or above the severity than MaxCount
+func (v *VulnerabilityPolicy) check(ctx context.Context, client *http.Client, image string) error {
+	body, err := json.Marshal(map[string]string{"image": image})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.Scanner, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to scan image: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("unable to scan image, scanner returned %d: %s", res.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	ids, err := v.countedVulnerabilities(res.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read the scan report: %w", err)
+	}
+
+	if len(ids) > v.MaxCount {
+		const shown = 5
+		listed := ids
+		if len(listed) > shown {
+			listed = listed[:shown]
+		}
+		return fmt.Errorf("%w: %d vulnerabilities with severity %s or higher, at most %d allowed (%s)",
+			ErrDenied, len(ids), strings.ToUpper(v.Severity), v.MaxCount, strings.Join(listed, ", "))
+	}
+	return nil
+}
+
+// countedVulnerabilities returns the IDs of the vulnerabilities in the report that
+// are at or above the severity, each ID is counted once
+func (v *VulnerabilityPolicy) countedVulnerabilities(r io.Reader) ([]string, error) {
+	type finding struct{ id, severity string }
+	var findings []finding
+
+	switch v.Format {
+	case FormatGrype:
+		report := struct {
+			Matches []struct {
+				Vulnerability struct {
+					ID       string `json:"id"`
+					Severity string `json:"severity"`
+				} `json:"vulnerability"`
+			} `json:"matches"`
+		}{}
+		if err := json.NewDecoder(r).Decode(&report); err != nil {
+			return nil, err
+		}
+		for _, match := range report.Matches {
+			findings = append(findings, finding{match.Vulnerability.ID, match.Vulnerability.Severity})
+		}
+
+	default:
+		report := struct {
+			Results []struct {
+				Vulnerabilities []struct {
+					VulnerabilityID string `json:"VulnerabilityID"`
+					Severity        string `json:"Severity"`
+				} `json:"Vulnerabilities"`
+			} `json:"Results"`
+		}{}
+		if err := json.NewDecoder(r).Decode(&report); err != nil {
+			return nil, err
+		}
+		for _, result := range report.Results {
+			for _, vulnerability := range result.Vulnerabilities {
+				findings = append(findings, finding{vulnerability.VulnerabilityID, vulnerability.Severity})
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	var ids []string
+	for _, f := range findings {
+		if severities[strings.ToUpper(f.severity)] < v.severity || seen[f.id] {
+			continue
+		}
+		seen[f.id] = true
+		ids = append(ids, f.id)
+	}
+	return ids, nil
+}
+
+type scanBypassKey struct{}
+
+// WithScanBypass requests that the vulnerability scan is skipped for the user, it
+// is only skipped when the user is one of the bypassUsers of the policy
+func WithScanBypass(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, scanBypassKey{}, user)
+}
+
+func scanBypass(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(scanBypassKey{}).(string)
+	return user, ok
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package imagepolicy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const trivyReport = `{"Results":[
+	{"Target":"alpine","Vulnerabilities":[
+		{"VulnerabilityID":"CVE-2024-0001","Severity":"CRITICAL"},
+		{"VulnerabilityID":"CVE-2024-0002","Severity":"HIGH"}
+	]},
+	{"Target":"app","Vulnerabilities":[
+		{"VulnerabilityID":"CVE-2024-0001","Severity":"CRITICAL"},
+		{"VulnerabilityID":"CVE-2024-0003","Severity":"LOW"}
+	]}
+]}`
+
+const grypeReport = `{"matches":[
+	{"vulnerability":{"id":"CVE-2024-0001","severity":"Critical"}},
+	{"vulnerability":{"id":"CVE-2024-0002","severity":"High"}},
+	{"vulnerability":{"id":"CVE-2024-0004","severity":"Negligible"}}
+]}`
+
+// newScanner serves report for each scan and records the scanned images
+func newScanner(t *testing.T, report string, scanned *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			Image string `json:"image"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*scanned = append(*scanned, req.Image)
+		fmt.Fprint(w, report)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newVulnerabilityVerifier(t *testing.T, policy string) *Verifier {
+	p, err := Parse([]byte(policy))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return NewVerifier(p, nil)
+}
+
+func Test_Verify_Vulnerabilities(t *testing.T) {
+	var scanned []string
+	scanner := newScanner(t, trivyReport, &scanned)
+
+	cases := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{name: "critical is denied by default", policy: "scanner: " + scanner.URL, wantErr: true},
+		{name: "critical within maxCount", policy: "scanner: " + scanner.URL + "\n    maxCount: 1"},
+		{name: "high above maxCount", policy: "scanner: " + scanner.URL + "\n    severity: high\n    maxCount: 1", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			verifier := newVulnerabilityVerifier(t, "default:\n  vulnerabilities:\n    "+tc.policy)
+			err := verifier.Verify(context.Background(), "openfaas-fn", "ghcr.io/openfaas/figlet:latest")
+
+			if tc.wantErr && !errors.Is(err, ErrDenied) {
+				t.Fatalf("want the image to be denied, got %v", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+
+	if len(scanned) != len(cases) || scanned[0] != "ghcr.io/openfaas/figlet:latest" {
+		t.Errorf("want the image to be scanned for each deploy, got %v", scanned)
+	}
+}
+
+func Test_Verify_VulnerabilitiesGrype(t *testing.T) {
+	var scanned []string
+	scanner := newScanner(t, grypeReport, &scanned)
+
+	verifier := newVulnerabilityVerifier(t, "default:\n  vulnerabilities:\n    scanner: "+scanner.URL+"\n    format: grype\n    severity: HIGH\n    maxCount: 2")
+	if err := verifier.Verify(context.Background(), "openfaas-fn", "ghcr.io/openfaas/figlet:latest"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func Test_Verify_ScannerUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database is updating", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	verifier := newVulnerabilityVerifier(t, "default:\n  vulnerabilities:\n    scanner: "+server.URL)
+	err := verifier.Verify(context.Background(), "openfaas-fn", "ghcr.io/openfaas/figlet:latest")
+	if err == nil || errors.Is(err, ErrDenied) {
+		t.Fatalf("want an error that is not a denial, got %v", err)
+	}
+}
+
+func Test_Verify_ScanBypass(t *testing.T) {
+	var scanned []string
+	scanner := newScanner(t, trivyReport, &scanned)
+
+	verifier := newVulnerabilityVerifier(t, "default:\n  vulnerabilities:\n    scanner: "+scanner.URL+"\n    bypassUsers: [admin]")
+
+	ctx := WithScanBypass(context.Background(), "admin")
+	if err := verifier.Verify(ctx, "openfaas-fn", "ghcr.io/openfaas/figlet:latest"); err != nil {
+		t.Fatalf("want the scan to be skipped for admin, got %s", err)
+	}
+
+	ctx = WithScanBypass(context.Background(), "developer")
+	if err := verifier.Verify(ctx, "openfaas-fn", "ghcr.io/openfaas/figlet:latest"); !errors.Is(err, ErrDenied) {
+		t.Fatalf("want the bypass to be denied for developer, got %v", err)
+	}
+
+	if len(scanned) != 0 {
+		t.Errorf("want no scans, got %v", scanned)
+	}
+}
+
+func Test_Parse_InvalidVulnerabilities(t *testing.T) {
+	cases := map[string]string{
+		"missing scanner":  "default:\n  vulnerabilities:\n    severity: HIGH",
+		"unknown format":   "default:\n  vulnerabilities:\n    scanner: http://trivy:8080\n    format: clair",
+		"unknown severity": "default:\n  vulnerabilities:\n    scanner: http://trivy:8080\n    severity: SEVERE",
+		"negative count":   "default:\n  vulnerabilities:\n    scanner: http://trivy:8080\n    maxCount: -1",
+	}
+
+	for name, policy := range cases {
+		if _, err := Parse([]byte(policy)); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	v1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	// AppArmorAnnotationPrefix is followed by the name of a container, the
+	// annotation is read by the kubelet on every supported Kubernetes version.
+	// The appArmorProfile field of the securityContext replaces it from
+	// Kubernetes 1.30, which keeps the annotation and the field in sync.
+	AppArmorAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+
+	AppArmorRuntimeDefault = "RuntimeDefault"
+	AppArmorLocalhost      = "Localhost"
+	AppArmorUnconfined     = "Unconfined"
+)
+
+// appArmorProfile returns the value of the AppArmor annotation for the profile
+func appArmorProfile(appArmor *v1.AppArmor) string {
+	switch appArmor.Type {
+	case AppArmorLocalhost:
+		return "localhost/" + appArmor.LocalhostProfile
+	case AppArmorUnconfined:
+		return "unconfined"
+	default:
+		return "runtime/default"
+	}
+}
+
+// applyAppArmor sets the AppArmor profile of each container of the Pod template
+func applyAppArmor(appArmor *v1.AppArmor, statefulset *appsv1.StatefulSet) {
+	template := &statefulset.Spec.Template
+	if len(template.Spec.Containers) == 0 {
+		return
+	}
+
+	annotations := cloneStringMap(template.Annotations)
+	for _, container := range template.Spec.Containers {
+		annotations[AppArmorAnnotationPrefix+container.Name] = appArmorProfile(appArmor)
+	}
+	template.Annotations = annotations
+}
+
+// removeAppArmor is the inverse of applyAppArmor, the annotations are only removed
+// when they still have the Profile's value
+func removeAppArmor(appArmor *v1.AppArmor, statefulset *appsv1.StatefulSet) {
+	template := &statefulset.Spec.Template
+	if len(template.Annotations) == 0 {
+		return
+	}
+
+	annotations := cloneStringMap(template.Annotations)
+	for _, container := range template.Spec.Containers {
+		key := AppArmorAnnotationPrefix + container.Name
+		if annotations[key] == appArmorProfile(appArmor) {
+			delete(annotations, key)
+		}
+	}
+	template.Annotations = annotations
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	appsv1apply "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/csaupgrade"
+)
+
+// Field managers used for server-side apply, each component that writes to a
+// function's StatefulSet or Service uses its own manager so that concurrent
+// writers only conflict on the fields they both set.
+const (
+	// FieldManager is used by the deploy and update handlers
+	FieldManager = "faas-netes"
+	// ScaleFieldManager is used by the replica updater, which is called by the
+	// gateway to scale functions
+	ScaleFieldManager = "faas-netes-scaler"
+	// ValidationFieldManager is used to keep the replicas of functions within
+	// the supported range
+	ValidationFieldManager = "faas-netes-validation"
+	// ScheduleFieldManager is used to scale functions at the windows of their
+	// scaling schedule
+	ScheduleFieldManager = "faas-netes-schedule"
+	// ResumeFieldManager records the replicas of functions that are scaled to
+	// zero, so that they can be resumed
+	ResumeFieldManager = "faas-netes-resume"
+	// MaintenanceFieldManager puts functions into maintenance and takes them out
+	MaintenanceFieldManager = "faas-netes-maintenance"
+	// DrainFieldManager records the progress of moving functions off nodes that
+	// are cordoned or drained
+	DrainFieldManager = "faas-netes-drain"
+	// PriorityFieldManager scales down functions with a low priority while the
+	// cluster is saturated
+	PriorityFieldManager = "faas-netes-priority"
+	// SecretRotationFieldManager restarts the Pods of functions one ordinal at a
+	// time after one of their secrets was rotated
+	SecretRotationFieldManager = "faas-netes-secret-rotation"
+)
+
+// StatefulSetApplyConfiguration converts a desired StatefulSet into an apply
+// configuration, the status is never included
+func StatefulSetApplyConfiguration(statefulset *appsv1.StatefulSet) (*appsv1apply.StatefulSetApplyConfiguration, error) {
+	applyConfig := appsv1apply.StatefulSet(statefulset.Name, statefulset.Namespace)
+	if err := convertApplyConfiguration(statefulset, applyConfig); err != nil {
+		return nil, fmt.Errorf("unable to convert statefulset %s: %w", statefulset.Name, err)
+	}
+
+	applyConfig.WithKind("StatefulSet").WithAPIVersion("apps/v1")
+	applyConfig.Status = nil
+	return applyConfig, nil
+}
+
+// ServiceApplyConfiguration converts a desired Service into an apply configuration,
+// the status is never included
+func ServiceApplyConfiguration(service *corev1.Service) (*corev1apply.ServiceApplyConfiguration, error) {
+	applyConfig := corev1apply.Service(service.Name, service.Namespace)
+	if err := convertApplyConfiguration(service, applyConfig); err != nil {
+		return nil, fmt.Errorf("unable to convert service %s: %w", service.Name, err)
+	}
+
+	applyConfig.WithKind("Service").WithAPIVersion("v1")
+	applyConfig.Status = nil
+	return applyConfig, nil
+}
+
+// UpgradeStatefulSetManagedFields moves the fields owned by the client-side updates of
+// FieldManager to its server-side apply manager. Without this, fields that are removed
+// from the function after an upgrade would be kept by the old update manager.
+func UpgradeStatefulSetManagedFields(ctx context.Context, client kubernetes.Interface, statefulset *appsv1.StatefulSet) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(statefulset, sets.New(FieldManager), FieldManager)
+	if err != nil || patch == nil {
+		return err
+	}
+
+	_, err = client.AppsV1().StatefulSets(statefulset.Namespace).
+		Patch(ctx, statefulset.Name, types.JSONPatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// UpgradeServiceManagedFields is the same as UpgradeStatefulSetManagedFields for
+// the function's Service
+func UpgradeServiceManagedFields(ctx context.Context, client kubernetes.Interface, service *corev1.Service) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(service, sets.New(FieldManager), FieldManager)
+	if err != nil || patch == nil {
+		return err
+	}
+
+	_, err = client.CoreV1().Services(service.Namespace).
+		Patch(ctx, service.Name, types.JSONPatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// ApplyStatefulSetReplicas applies only the replicas of a StatefulSet as the given
+// field manager, so that scaling never conflicts with an update of the function
+func ApplyStatefulSetReplicas(ctx context.Context, client kubernetes.Interface, namespace, name string, replicas int32, manager string) error {
+	applyConfig := appsv1apply.StatefulSet(name, namespace).
+		WithSpec(appsv1apply.StatefulSetSpec().WithReplicas(replicas))
+
+	_, err := client.AppsV1().StatefulSets(namespace).
+		Apply(ctx, applyConfig, metav1.ApplyOptions{FieldManager: manager, Force: true})
+	return err
+}
+
+// OwnsReplicas returns true when the field manager has applied the replicas of
+// the StatefulSet
+func OwnsReplicas(statefulset *appsv1.StatefulSet, manager string) bool {
+	for _, entry := range statefulset.ManagedFields {
+		if entry.Manager != manager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+
+		fields := map[string]map[string]interface{}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if _, ok := fields["f:spec"]["f:replicas"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// convertApplyConfiguration copies the fields that are set in obj into the apply
+// configuration, the typed objects and apply configurations share the same json
+// field names
+func convertApplyConfiguration(obj interface{}, applyConfig interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, applyConfig)
+}
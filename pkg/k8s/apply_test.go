@@ -0,0 +1,100 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_StatefulSetApplyConfiguration(t *testing.T) {
+	replicas := int32(2)
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet", Image: "ghcr.io/openfaas/figlet:latest"}},
+				},
+			},
+		},
+		Status: appsv1.StatefulSetStatus{Replicas: 1},
+	}
+
+	applyConfig, err := StatefulSetApplyConfiguration(statefulset)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if *applyConfig.Kind != "StatefulSet" || *applyConfig.APIVersion != "apps/v1" {
+		t.Fatalf("expected apps/v1 StatefulSet, got %s %s", *applyConfig.APIVersion, *applyConfig.Kind)
+	}
+	if *applyConfig.Name != "figlet" || *applyConfig.Namespace != "openfaas-fn" {
+		t.Fatalf("expected figlet.openfaas-fn, got %s.%s", *applyConfig.Name, *applyConfig.Namespace)
+	}
+	if *applyConfig.Spec.Replicas != 2 {
+		t.Fatalf("expected 2 replicas, got %d", *applyConfig.Spec.Replicas)
+	}
+	if applyConfig.Spec.Template.Spec.Containers[0].Image == nil {
+		t.Fatalf("expected the container image to be set")
+	}
+
+	data, _ := json.Marshal(applyConfig)
+	if strings.Contains(string(data), `"status"`) {
+		t.Fatalf("expected no status in the apply configuration, got %s", string(data))
+	}
+}
+
+func Test_ServiceApplyConfiguration(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "figlet",
+			Namespace:   "openfaas-fn",
+			Annotations: map[string]string{"prometheus.io.scrape": "false"},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"faas_function": "figlet"},
+		},
+	}
+
+	applyConfig, err := ServiceApplyConfiguration(service)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if *applyConfig.Kind != "Service" || *applyConfig.APIVersion != "v1" {
+		t.Fatalf("expected v1 Service, got %s %s", *applyConfig.APIVersion, *applyConfig.Kind)
+	}
+	if applyConfig.Annotations["prometheus.io.scrape"] != "false" {
+		t.Fatalf("expected the annotations to be copied, got %v", applyConfig.Annotations)
+	}
+	if applyConfig.Status != nil {
+		t.Fatalf("expected no status in the apply configuration")
+	}
+}
+
+func Test_OwnsReplicas(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			ManagedFields: []metav1.ManagedFieldsEntry{{
+				Manager:   ScaleFieldManager,
+				Operation: metav1.ManagedFieldsOperationApply,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)},
+			}},
+		},
+	}
+
+	if !OwnsReplicas(statefulset, ScaleFieldManager) {
+		t.Fatalf("expected %s to own the replicas", ScaleFieldManager)
+	}
+	if OwnsReplicas(statefulset, FieldManager) {
+		t.Fatalf("expected %s not to own the replicas", FieldManager)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ArchitecturesAnnotation lists the CPU architectures that the image of a function
+// was built for, as a comma separated list i.e. "amd64,arm64". It takes precedence
+// over the architectures that are read from the registry.
+const ArchitecturesAnnotation = "com.openfaas.architectures"
+
+// ErrNoCompatibleNodes is returned when no node in the cluster has one of the
+// architectures of a function's image
+var ErrNoCompatibleNodes = errors.New("no nodes with a compatible architecture")
+
+// ArchitectureResolver reads the CPU architectures of an image from its registry
+type ArchitectureResolver interface {
+	Architectures(ctx context.Context, image string) ([]string, error)
+}
+
+// ParseArchitectures splits the comma separated architectures of the annotation
+func ParseArchitectures(value string) []string {
+	seen := map[string]bool{}
+	architectures := []string{}
+	for _, architecture := range strings.Split(value, ",") {
+		if architecture = strings.TrimSpace(architecture); architecture != "" && !seen[architecture] {
+			seen[architecture] = true
+			architectures = append(architectures, architecture)
+		}
+	}
+	sort.Strings(architectures)
+	return architectures
+}
+
+// ImageArchitectures returns the architectures of the function's image from its
+// annotation, or from the registry when an ArchitectureResolver is configured. No
+// architectures are returned when neither is available.
+func (f *FunctionFactory) ImageArchitectures(ctx context.Context, image string, annotations map[string]string) ([]string, error) {
+	if value, ok := annotations[ArchitecturesAnnotation]; ok {
+		return ParseArchitectures(value), nil
+	}
+
+	if f.ArchitectureResolver == nil {
+		return nil, nil
+	}
+
+	return f.ArchitectureResolver.Architectures(ctx, image)
+}
+
+// ConfigureArchitectures requires the Pods of the function to be scheduled to nodes
+// with one of the architectures. The requirement is added to each of the required
+// node selector terms, so that an affinity from a Profile is kept.
+func ConfigureArchitectures(statefulset *appsv1.StatefulSet, architectures []string) {
+	if len(architectures) == 0 {
+		return
+	}
+
+	requireNodeAffinity(statefulset, corev1.NodeSelectorRequirement{
+		Key:      corev1.LabelArchStable,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   architectures,
+	})
+}
+
+// CheckNodeArchitectures returns ErrNoCompatibleNodes when none of the nodes that
+// match the nodeSelector of the function has one of the architectures
+func CheckNodeArchitectures(ctx context.Context, client kubernetes.Interface, nodeSelector map[string]string, architectures []string) error {
+	if len(architectures) == 0 {
+		return nil
+	}
+
+	req, err := labels.NewRequirement(corev1.LabelArchStable, selection.In, architectures)
+	if err != nil {
+		return err
+	}
+	selector := labels.SelectorFromSet(nodeSelector).Add(*req)
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: selector.String(), Limit: 1})
+	if err != nil {
+		return err
+	}
+
+	if len(nodes.Items) == 0 {
+		return fmt.Errorf("%w: the image supports %s", ErrNoCompatibleNodes, strings.Join(architectures, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeArchitectureResolver struct {
+	architectures []string
+}
+
+func (f fakeArchitectureResolver) Architectures(ctx context.Context, image string) ([]string, error) {
+	return f.architectures, nil
+}
+
+func Test_ParseArchitectures(t *testing.T) {
+	got := ParseArchitectures(" arm64, amd64,,arm64")
+	want := []string{"amd64", "arm64"}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func Test_ImageArchitectures_AnnotationOverridesRegistry(t *testing.T) {
+	factory := FunctionFactory{ArchitectureResolver: fakeArchitectureResolver{architectures: []string{"amd64", "arm64"}}}
+
+	got, err := factory.ImageArchitectures(context.Background(), "figlet", map[string]string{ArchitecturesAnnotation: "arm64"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := []string{"arm64"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	got, err = factory.ImageArchitectures(context.Background(), "figlet", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := []string{"amd64", "arm64"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func Test_ConfigureArchitectures_KeepsProfileAffinity(t *testing.T) {
+	zone := corev1.NodeSelectorRequirement{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}
+	statefulset := &appsv1.StatefulSet{}
+	statefulset.Spec.Template.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{zone}}},
+			},
+		},
+	}
+
+	ConfigureArchitectures(statefulset, []string{"arm64"})
+
+	terms := statefulset.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	want := []corev1.NodeSelectorRequirement{
+		zone,
+		{Key: corev1.LabelArchStable, Operator: corev1.NodeSelectorOpIn, Values: []string{"arm64"}},
+	}
+	if len(terms) != 1 || !reflect.DeepEqual(want, terms[0].MatchExpressions) {
+		t.Fatalf("want %v, got %v", want, terms)
+	}
+}
+
+func Test_ConfigureArchitectures_NoArchitectures(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{}
+
+	ConfigureArchitectures(statefulset, nil)
+
+	if statefulset.Spec.Template.Spec.Affinity != nil {
+		t.Fatalf("want no affinity, got %v", statefulset.Spec.Template.Spec.Affinity)
+	}
+}
+
+func Test_CheckNodeArchitectures(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-1",
+			Labels: map[string]string{corev1.LabelArchStable: "amd64", "pool": "default"},
+		},
+	})
+
+	if err := CheckNodeArchitectures(context.Background(), client, nil, []string{"amd64", "arm64"}); err != nil {
+		t.Fatalf("want a compatible node, got %s", err)
+	}
+
+	err := CheckNodeArchitectures(context.Background(), client, nil, []string{"arm64"})
+	if !errors.Is(err, ErrNoCompatibleNodes) {
+		t.Fatalf("want ErrNoCompatibleNodes, got %v", err)
+	}
+
+	err = CheckNodeArchitectures(context.Background(), client, map[string]string{"pool": "gpu"}, []string{"amd64"})
+	if !errors.Is(err, ErrNoCompatibleNodes) {
+		t.Fatalf("want ErrNoCompatibleNodes for the constraints, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+)
+
+// CachedReader reads StatefulSets and Services from the shared informer caches
+// and only falls back to the API server when an object is missing from the cache,
+// for example just after a function has been deployed.
+//
+// Objects are returned from the cache and must be copied before they are modified.
+type CachedReader struct {
+	Client            kubernetes.Interface
+	StatefulSetLister appslister.StatefulSetLister
+	ServiceLister     corelister.ServiceLister
+}
+
+func NewCachedReader(client kubernetes.Interface, statefulSetLister appslister.StatefulSetLister, serviceLister corelister.ServiceLister) CachedReader {
+	return CachedReader{
+		Client:            client,
+		StatefulSetLister: statefulSetLister,
+		ServiceLister:     serviceLister,
+	}
+}
+
+// GetStatefulSet returns the named StatefulSet, a not found error is only returned
+// when the StatefulSet is missing from both the cache and the API server
+func (r CachedReader) GetStatefulSet(ctx context.Context, namespace, name string) (*appsv1.StatefulSet, error) {
+	statefulset, err := r.StatefulSetLister.StatefulSets(namespace).Get(name)
+	if err == nil || !IsNotFound(err) {
+		return statefulset, err
+	}
+
+	return r.Client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// GetService returns the named Service, a not found error is only returned when
+// the Service is missing from both the cache and the API server
+func (r CachedReader) GetService(ctx context.Context, namespace, name string) (*corev1.Service, error) {
+	service, err := r.ServiceLister.Services(namespace).Get(name)
+	if err == nil || !IsNotFound(err) {
+		return service, err
+	}
+
+	return r.Client.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_CachedReader_ReadsFromCache(t *testing.T) {
+	cached := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}}
+
+	client := fake.NewSimpleClientset()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(cached)
+
+	reader := NewCachedReader(client,
+		appslister.NewStatefulSetLister(indexer),
+		corelister.NewServiceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})))
+
+	got, err := reader.GetStatefulSet(context.Background(), "openfaas-fn", "figlet")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != cached {
+		t.Fatalf("expected the cached statefulset to be returned")
+	}
+	if len(client.Actions()) != 0 {
+		t.Fatalf("expected no API calls, got %d", len(client.Actions()))
+	}
+}
+
+func Test_CachedReader_FallsBackOnCacheMiss(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}},
+	)
+
+	reader := NewCachedReader(client,
+		appslister.NewStatefulSetLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+		corelister.NewServiceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})))
+
+	if _, err := reader.GetStatefulSet(context.Background(), "openfaas-fn", "figlet"); err != nil {
+		t.Fatalf("expected statefulset from the API, got error: %s", err)
+	}
+	if _, err := reader.GetService(context.Background(), "openfaas-fn", "figlet"); err != nil {
+		t.Fatalf("expected service from the API, got error: %s", err)
+	}
+
+	if _, err := reader.GetService(context.Background(), "openfaas-fn", "env"); !IsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
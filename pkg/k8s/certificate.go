@@ -0,0 +1,191 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// tlsAnnotationPrefix is the prefix of the annotations that request a serving
+	// certificate for a function that terminates TLS itself
+	tlsAnnotationPrefix = "com.openfaas.tls."
+
+	// AnnotationTLSIssuer is the cert-manager issuer of the function's certificate,
+	// a Certificate is only created when it is set
+	AnnotationTLSIssuer = tlsAnnotationPrefix + "issuer"
+
+	// AnnotationTLSIssuerKind is either ClusterIssuer, the default, or Issuer for an
+	// issuer in the namespace of the function
+	AnnotationTLSIssuerKind = tlsAnnotationPrefix + "issuer-kind"
+
+	// AnnotationTLSDNSNames are added to the DNS names of the Service of the
+	// function, as a comma separated list
+	AnnotationTLSDNSNames = tlsAnnotationPrefix + "dns-names"
+
+	// tlsVolumeName is the volume of the certificate's Secret
+	tlsVolumeName = "tls-certificate"
+
+	// TLSMountPath is where tls.crt, tls.key and ca.crt are mounted in the function
+	TLSMountPath = "/var/openfaas/tls"
+)
+
+// CertificateResource is the cert-manager Certificate, it is managed with the
+// dynamic client so that cert-manager is only required when a function uses it
+var CertificateResource = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+
+// CertificateName is the name of the Certificate of a function and of the Secret
+// that cert-manager writes the key pair to
+func CertificateName(functionName string) string {
+	return functionName + "-serving-cert"
+}
+
+// MakeCertificate creates the cert-manager Certificate for the Service of a function
+// from its com.openfaas.tls.* annotations, nil is returned when the function does
+// not set an issuer. The owner is set by the caller.
+func MakeCertificate(name, namespace string, annotations map[string]string) (*unstructured.Unstructured, error) {
+	issuer := annotations[AnnotationTLSIssuer]
+	if issuer == "" {
+		return nil, nil
+	}
+
+	kind := annotations[AnnotationTLSIssuerKind]
+	switch kind {
+	case "":
+		kind = "ClusterIssuer"
+	case "ClusterIssuer", "Issuer":
+	default:
+		return nil, fmt.Errorf("invalid value for %s: %q, use ClusterIssuer or Issuer", AnnotationTLSIssuerKind, kind)
+	}
+
+	dnsNames := []interface{}{
+		name,
+		name + "." + namespace,
+		name + "." + namespace + ".svc",
+		name + "." + namespace + ".svc.cluster.local",
+	}
+	for _, dnsName := range strings.Split(annotations[AnnotationTLSDNSNames], ",") {
+		if dnsName = strings.TrimSpace(dnsName); dnsName != "" {
+			dnsNames = append(dnsNames, dnsName)
+		}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": CertificateResource.GroupVersion().String(),
+		"kind":       "Certificate",
+		"metadata": map[string]interface{}{
+			"name":      CertificateName(name),
+			"namespace": namespace,
+			"labels":    map[string]interface{}{"faas_function": name},
+		},
+		"spec": map[string]interface{}{
+			"secretName": CertificateName(name),
+			"dnsNames":   dnsNames,
+			"usages":     []interface{}{"server auth"},
+			"issuerRef": map[string]interface{}{
+				"name":  issuer,
+				"kind":  kind,
+				"group": "cert-manager.io",
+			},
+		},
+	}}, nil
+}
+
+// ConfigureCertificate mounts the Secret of the function's Certificate at
+// TLSMountPath. The Pods are not started until cert-manager has issued it.
+func ConfigureCertificate(statefulset *appsv1.StatefulSet, functionName string, annotations map[string]string) {
+	if annotations[AnnotationTLSIssuer] == "" {
+		return
+	}
+
+	statefulset.Spec.Template.Spec.Volumes = append(statefulset.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: tlsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: CertificateName(functionName)},
+		},
+	})
+
+	container := &statefulset.Spec.Template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      tlsVolumeName,
+		MountPath: TLSMountPath,
+		ReadOnly:  true,
+	})
+}
+
+// SyncCertificate applies the Certificate of a function, or removes it together with
+// its Secret when the function no longer sets an issuer. The labels are added to
+// the Certificate.
+func SyncCertificate(ctx context.Context, client dynamic.Interface, clientset kubernetes.Interface, functionName, namespace string, annotations map[string]string, owner metav1.OwnerReference, labels map[string]string) error {
+	certificate, err := MakeCertificate(functionName, namespace, annotations)
+	if err != nil {
+		return err
+	}
+
+	if client == nil {
+		if certificate != nil {
+			return fmt.Errorf("%s is not supported without a dynamic client", AnnotationTLSIssuer)
+		}
+		return nil
+	}
+
+	if certificate == nil {
+		return DeleteCertificate(ctx, client, clientset, namespace, functionName)
+	}
+
+	certificate.SetOwnerReferences([]metav1.OwnerReference{owner})
+	AddLabels(certificate, labels)
+
+	_, err = client.Resource(CertificateResource).Namespace(namespace).
+		Apply(ctx, certificate.GetName(), certificate, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
+
+// DeleteCertificate removes the Certificate of a function when it is owned by its
+// StatefulSet, and the Secret that cert-manager wrote for it. cert-manager keeps the
+// Secret of a deleted Certificate by default.
+func DeleteCertificate(ctx context.Context, client dynamic.Interface, clientset kubernetes.Interface, namespace, functionName string) error {
+	name := CertificateName(functionName)
+	certificates := client.Resource(CertificateResource).Namespace(namespace)
+
+	existing, err := certificates.Get(ctx, name, metav1.GetOptions{})
+	if IsNotFound(err) || IsUnavailable(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !IsOwnedByStatefulSet(existing, functionName) {
+		return nil
+	}
+
+	if err := certificates.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	secrets := clientset.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if IsNotFound(err) || IsUnavailable(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if secret.Annotations["cert-manager.io/certificate-name"] != name {
+		return nil
+	}
+	if err := secrets.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
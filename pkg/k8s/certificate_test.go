@@ -0,0 +1,68 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_MakeCertificate_InvalidIssuerKind(t *testing.T) {
+	_, err := MakeCertificate("figlet", "openfaas-fn", map[string]string{
+		AnnotationTLSIssuer:     "internal-ca",
+		AnnotationTLSIssuerKind: "Vault",
+	})
+	if err == nil {
+		t.Errorf("want an error for an unknown issuer kind")
+	}
+}
+
+func Test_SyncCertificate_RemovesCertificateAndSecret(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+	certificate, _ := MakeCertificate("figlet", "openfaas-fn", map[string]string{AnnotationTLSIssuer: "internal-ca"})
+	certificate.SetOwnerReferences([]metav1.OwnerReference{owner})
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		CertificateResource: "CertificateList",
+	}, certificate)
+	clientset := fake.NewSimpleClientset(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:        "figlet-serving-cert",
+		Namespace:   "openfaas-fn",
+		Annotations: map[string]string{"cert-manager.io/certificate-name": "figlet-serving-cert"},
+	}})
+
+	if err := SyncCertificate(context.Background(), dynamicClient, clientset, "figlet", "openfaas-fn", map[string]string{}, owner, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := dynamicClient.Resource(CertificateResource).Namespace("openfaas-fn").
+		Get(context.Background(), "figlet-serving-cert", metav1.GetOptions{}); err == nil {
+		t.Errorf("want the Certificate to be deleted when the function no longer sets an issuer")
+	}
+	if _, err := clientset.CoreV1().Secrets("openfaas-fn").
+		Get(context.Background(), "figlet-serving-cert", metav1.GetOptions{}); err == nil {
+		t.Errorf("want the Secret of the Certificate to be deleted")
+	}
+}
+
+func Test_DeleteCertificate_KeepsCertificateOfOthers(t *testing.T) {
+	certificate, _ := MakeCertificate("figlet", "openfaas-fn", map[string]string{AnnotationTLSIssuer: "internal-ca"})
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		CertificateResource: "CertificateList",
+	}, certificate)
+
+	if err := DeleteCertificate(context.Background(), dynamicClient, fake.NewSimpleClientset(), "openfaas-fn", "figlet"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := dynamicClient.Resource(CertificateResource).Namespace("openfaas-fn").
+		Get(context.Background(), "figlet-serving-cert", metav1.GetOptions{}); err != nil {
+		t.Errorf("want a Certificate that is not owned by the function to be kept, got: %s", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CircuitBreaker stops invocations from being sent to an endpoint of a function
+// after it failed a number of times in a row, such as a replica that is crashing
+// during a rollout. The endpoint is tried again once the cooldown has passed, the
+// first result after that closes the circuit or opens it for another cooldown.
+//
+// Endpoints are keyed by the host and port of the Pod, which are unique in the
+// cluster, so one breaker is shared by all functions.
+type CircuitBreaker struct {
+	// Failures in a row that open the circuit of an endpoint
+	Failures int
+
+	// Cooldown is how long an open circuit rejects invocations
+	Cooldown time.Duration
+
+	now func() time.Time
+
+	lock      sync.Mutex
+	endpoints map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	open     bool
+	openedAt time.Time
+}
+
+// NewCircuitBreaker creates a CircuitBreaker, a nil breaker never opens
+func NewCircuitBreaker(failures int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Failures:  failures,
+		Cooldown:  cooldown,
+		now:       time.Now,
+		endpoints: map[string]*circuit{},
+	}
+}
+
+// Open is true while the circuit of the endpoint is open and its cooldown has not
+// passed
+func (b *CircuitBreaker) Open(host string) bool {
+	if b == nil {
+		return false
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c, ok := b.endpoints[host]
+	return ok && c.open && b.now().Sub(c.openedAt) < b.Cooldown
+}
+
+// Record the result of an invocation sent to the endpoint
+func (b *CircuitBreaker) Record(host string, success bool) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if success {
+		delete(b.endpoints, host)
+		return
+	}
+
+	c, ok := b.endpoints[host]
+	if !ok {
+		c = &circuit{}
+		b.endpoints[host] = c
+	}
+	c.failures++
+
+	// a failure after the cooldown opens the circuit again straight away
+	if c.open || c.failures >= b.Failures {
+		c.open = true
+		c.openedAt = b.now()
+		b.removeStale()
+	}
+}
+
+// Forget the circuits of the endpoints at the addresses, so that an address that
+// is given to a new Pod starts with a closed circuit
+func (b *CircuitBreaker) Forget(addresses map[string]bool) {
+	if b == nil || len(addresses) == 0 {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for host := range b.endpoints {
+		address, _, err := net.SplitHostPort(host)
+		if err != nil {
+			address = host
+		}
+		if addresses[address] {
+			delete(b.endpoints, host)
+		}
+	}
+}
+
+// EndpointSliceEventHandler forgets the endpoints that were removed from an
+// EndpointSlice, such as the Pods of a function that was scaled down or rolled out
+func (b *CircuitBreaker) EndpointSliceEventHandler() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSlice, ok := oldObj.(*discoveryv1.EndpointSlice)
+			if !ok {
+				return
+			}
+			slice, ok := newObj.(*discoveryv1.EndpointSlice)
+			if !ok {
+				return
+			}
+
+			removed := sliceAddresses(oldSlice)
+			for address := range sliceAddresses(slice) {
+				delete(removed, address)
+			}
+			b.Forget(removed)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			slice, ok := obj.(*discoveryv1.EndpointSlice)
+			if !ok {
+				return
+			}
+			b.Forget(sliceAddresses(slice))
+		},
+	}
+}
+
+// sliceAddresses returns the addresses of all of the endpoints of the slice, ready
+// or not
+func sliceAddresses(slice *discoveryv1.EndpointSlice) map[string]bool {
+	addresses := map[string]bool{}
+	for _, e := range slice.Endpoints {
+		for _, address := range e.Addresses {
+			addresses[address] = true
+		}
+	}
+	return addresses
+}
+
+// removeStale forgets the endpoints that have not been tried for a while, which
+// are usually Pods that were removed
+func (b *CircuitBreaker) removeStale() {
+	for host, c := range b.endpoints {
+		if c.open && b.now().Sub(c.openedAt) > b.Cooldown*10 {
+			delete(b.endpoints, host)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_CircuitBreaker_OpensAfterFailuresInARow(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(3, time.Second*10)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Record("10.0.0.1:8080", false)
+	breaker.Record("10.0.0.1:8080", false)
+	breaker.Record("10.0.0.1:8080", true)
+	breaker.Record("10.0.0.1:8080", false)
+	breaker.Record("10.0.0.1:8080", false)
+	if breaker.Open("10.0.0.1:8080") {
+		t.Fatal("want a success to reset the failures")
+	}
+
+	breaker.Record("10.0.0.1:8080", false)
+	if !breaker.Open("10.0.0.1:8080") {
+		t.Fatal("want the circuit to open after 3 failures in a row")
+	}
+	if breaker.Open("10.0.0.2:8080") {
+		t.Error("want the other endpoints to be unaffected")
+	}
+}
+
+func Test_CircuitBreaker_TriesAgainAfterCooldown(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Second*10)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Record("10.0.0.1:8080", false)
+	now = now.Add(time.Second * 11)
+	if breaker.Open("10.0.0.1:8080") {
+		t.Fatal("want the endpoint to be tried after the cooldown")
+	}
+
+	breaker.Record("10.0.0.1:8080", false)
+	if !breaker.Open("10.0.0.1:8080") {
+		t.Fatal("want a failed try to open the circuit again")
+	}
+
+	now = now.Add(time.Second * 11)
+	breaker.Record("10.0.0.1:8080", true)
+	if breaker.Open("10.0.0.1:8080") || len(breaker.endpoints) != 0 {
+		t.Error("want a successful try to close the circuit")
+	}
+}
+
+func Test_CircuitBreaker_Nil(t *testing.T) {
+	var breaker *CircuitBreaker
+	breaker.Record("10.0.0.1:8080", false)
+	if breaker.Open("10.0.0.1:8080") {
+		t.Error("want a nil breaker to never open")
+	}
+}
+
+func Test_CircuitBreaker_ForgetsRemovedEndpoints(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Second*10)
+	breaker.Record("10.0.0.1:8080", false)
+	breaker.Record("10.0.0.2:8080", false)
+
+	oldSlice := &discoveryv1.EndpointSlice{Endpoints: []discoveryv1.Endpoint{
+		{Addresses: []string{"10.0.0.1"}},
+		{Addresses: []string{"10.0.0.2"}},
+	}}
+	slice := &discoveryv1.EndpointSlice{Endpoints: []discoveryv1.Endpoint{
+		{Addresses: []string{"10.0.0.2"}},
+	}}
+
+	handler := breaker.EndpointSliceEventHandler()
+	handler.OnUpdate(oldSlice, slice)
+	if _, ok := breaker.endpoints["10.0.0.1:8080"]; ok {
+		t.Error("want the circuit of the removed endpoint to be forgotten")
+	}
+	if !breaker.Open("10.0.0.2:8080") {
+		t.Error("want the circuit of the remaining endpoint to stay open")
+	}
+
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Obj: slice})
+	if len(breaker.endpoints) != 0 {
+		t.Errorf("want all circuits to be forgotten when the slice is deleted, got %d", len(breaker.endpoints))
+	}
+}
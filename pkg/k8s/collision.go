@@ -0,0 +1,56 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NameCollisionError is returned when a StatefulSet or Service already has the
+// name of a function that is being deployed
+type NameCollisionError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Function is true when the object was created for a function
+	Function bool
+}
+
+func (c *NameCollisionError) Error() string {
+	if c.Kind == "StatefulSet" && c.Function {
+		return fmt.Sprintf("function %s already exists in namespace %s", c.Name, c.Namespace)
+	}
+	if c.Function {
+		return fmt.Sprintf("the name %s is taken by %s %s/%s, which was left behind by a function of the same name",
+			c.Name, c.Kind, c.Namespace, c.Name)
+	}
+	return fmt.Sprintf("the name %s is taken by %s %s/%s, which is not managed by OpenFaaS", c.Name, c.Kind, c.Namespace, c.Name)
+}
+
+// FindNameCollision returns a NameCollisionError for the StatefulSet or Service that
+// already has the name of a new function, so that a deploy does not take over an
+// object that belongs to another workload. It returns nil when the name is free.
+func FindNameCollision(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	statefulset, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		_, function := statefulset.Labels["faas_function"]
+		return &NameCollisionError{Kind: "StatefulSet", Namespace: namespace, Name: name, Function: function}
+	} else if !IsNotFound(err) {
+		return err
+	}
+
+	service, err := client.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		_, function := service.Spec.Selector["faas_function"]
+		return &NameCollisionError{Kind: "Service", Namespace: namespace, Name: name, Function: function}
+	} else if !IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
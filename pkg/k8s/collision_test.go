@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_FindNameCollision(t *testing.T) {
+	cases := []struct {
+		name    string
+		objects []runtime.Object
+		want    string
+	}{
+		{name: "free"},
+		{
+			name:    "function",
+			objects: []runtime.Object{&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", Labels: map[string]string{"faas_function": "figlet"}}}},
+			want:    "function figlet already exists",
+		},
+		{
+			name:    "another StatefulSet",
+			objects: []runtime.Object{&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}}},
+			want:    "StatefulSet openfaas-fn/figlet, which is not managed by OpenFaaS",
+		},
+		{
+			name:    "another Service",
+			objects: []runtime.Object{&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}}},
+			want:    "Service openfaas-fn/figlet, which is not managed by OpenFaaS",
+		},
+		{
+			name: "Service of a function",
+			objects: []runtime.Object{&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"faas_function": "figlet"}},
+			}},
+			want: "Service openfaas-fn/figlet, which was left behind by a function",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := FindNameCollision(context.Background(), fake.NewSimpleClientset(tc.objects...), "openfaas-fn", "figlet")
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("want no collision, got %s", err)
+				}
+				return
+			}
+
+			if !IsNameCollision(err) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("want a collision with %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
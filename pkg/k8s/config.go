@@ -3,6 +3,12 @@
 
 package k8s
 
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
 // ProbeConfig holds the deployment liveness and readiness options
 type ProbeConfig struct {
 	InitialDelaySeconds int32
@@ -12,13 +18,60 @@ type ProbeConfig struct {
 
 // DeploymentConfig holds the global deployment options
 type DeploymentConfig struct {
+	// RuntimeHTTPPort is the port of the Service of each function, and of its
+	// container unless it sets the AnnotationPort
 	RuntimeHTTPPort int32
-	HTTPProbe       bool
-	ReadinessProbe  *ProbeConfig
-	LivenessProbe   *ProbeConfig
+	// WatchdogEnv are the names of the environment variables that are set for the
+	// watchdog of each function
+	WatchdogEnv    WatchdogEnv
+	HTTPProbe      bool
+	ReadinessProbe *ProbeConfig
+	LivenessProbe  *ProbeConfig
 	// SetNonRootUser will override the function image user to ensure that it is not root. When
-	// true, the user will set to 12000 for all functions.
+	// true, the user will set to NonRootUserID for all functions.
 	SetNonRootUser bool
+	// NonRootUserID is the UID of functions when SetNonRootUser is true, it defaults
+	// to SecurityContextUserID
+	NonRootUserID int64
+	// NonRootGroupID is the GID of functions when SetNonRootUser is true, the group
+	// of the image is used when it is 0
+	NonRootGroupID int64
+	// ForceReadOnlyRootFilesystem makes the root filesystem of every function
+	// read-only, even when the request sets readOnlyRootFilesystem to false
+	ForceReadOnlyRootFilesystem bool
+	// RestrictedPodSecurity makes the StatefulSets of functions compliant with the
+	// restricted Pod Security Standard, functions that can not comply are rejected.
+	RestrictedPodSecurity bool
 	// ProfilesNamespace defines which namespace is used to look up available Profiles.
 	ProfilesNamespace string
+	// VPARecommendations creates a VerticalPodAutoscaler in recommendation mode for
+	// each function, the FunctionFactory must have a Dynamic client.
+	VPARecommendations bool
+	// SecretsStore configures the SecretProviderClass for the external secrets of
+	// functions
+	SecretsStore SecretsStoreConfig
+	// MeshMode is MeshIstio or MeshLinkerd to add the functions to a service mesh, the
+	// FunctionFactory must have a Dynamic client for the mesh resources
+	MeshMode string
+	// PrewarmImage provides the busybox binary and the long running container of
+	// the pre-warm DaemonSets, DefaultPrewarmImage is used when it is empty
+	PrewarmImage string
+	// SecretSelector is a label selector that the secrets mounted by functions must
+	// match, all secrets may be mounted when it is empty
+	SecretSelector string
+	// CostLabels are the keys of the function labels, such as team or project, that
+	// are copied to each of the resources created for a function for chargeback
+	CostLabels []string
+	// APITimeout bounds each call to the Kubernetes API made for a request, there is
+	// no limit other than the request's context when it is zero
+	APITimeout time.Duration
+	// DefaultResources are the requests and limits of functions that do not set
+	// their own, so that they can be scheduled under a LimitRange
+	DefaultResources corev1.ResourceRequirements
+	// Rollout is the revision history limit and rolling update strategy of the
+	// StatefulSets of functions, replaced per function by its rollout annotations
+	Rollout RolloutConfig
+	// Live is optional, when set its settings replace the probes and SetNonRootUser
+	// so that they can be reloaded, see Current
+	Live *LiveConfig
 }
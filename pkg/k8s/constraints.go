@@ -0,0 +1,125 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+var nodeSelectorOperators = map[selection.Operator]corev1.NodeSelectorOperator{
+	selection.In:           corev1.NodeSelectorOpIn,
+	selection.NotIn:        corev1.NodeSelectorOpNotIn,
+	selection.NotEquals:    corev1.NodeSelectorOpNotIn,
+	selection.Exists:       corev1.NodeSelectorOpExists,
+	selection.DoesNotExist: corev1.NodeSelectorOpDoesNotExist,
+	selection.GreaterThan:  corev1.NodeSelectorOpGt,
+	selection.LessThan:     corev1.NodeSelectorOpLt,
+}
+
+// ParseConstraints parses the constraints of a function, which use the syntax of
+// label selectors. Equality constraints such as "disktype=ssd" are returned as the
+// node selector, the others such as "zone in (a,b)", "zone!=c", "gpu" or "!spot"
+// are returned as requirements for the node affinity. All of the constraints that
+// can not be parsed are listed in the error.
+func ParseConstraints(constraints []string) (map[string]string, []corev1.NodeSelectorRequirement, error) {
+	nodeSelector := map[string]string{}
+	var requirements []corev1.NodeSelectorRequirement
+	var invalid []string
+
+	for _, constraint := range constraints {
+		parsed, err := labels.ParseToRequirements(constraint)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%q: %s", constraint, err))
+			continue
+		}
+		if len(parsed) == 0 {
+			invalid = append(invalid, fmt.Sprintf("%q: is empty", constraint))
+			continue
+		}
+
+		for _, requirement := range parsed {
+			key, values := requirement.Key(), requirement.Values().List()
+
+			switch requirement.Operator() {
+			case selection.Equals, selection.DoubleEquals:
+				if existing, ok := nodeSelector[key]; ok && existing != values[0] {
+					invalid = append(invalid, fmt.Sprintf("%q: conflicts with %s=%s", constraint, key, existing))
+					continue
+				}
+				nodeSelector[key] = values[0]
+			default:
+				requirements = append(requirements, corev1.NodeSelectorRequirement{
+					Key:      key,
+					Operator: nodeSelectorOperators[requirement.Operator()],
+					Values:   values,
+				})
+			}
+		}
+	}
+
+	if len(invalid) > 0 {
+		return nil, nil, fmt.Errorf("invalid constraints %s", strings.Join(invalid, ", "))
+	}
+	return nodeSelector, requirements, nil
+}
+
+// ConfigureConstraints sets the node selector of the function and adds the other
+// constraints to each of the required node selector terms. It is called after the
+// Profiles have been applied, so that the constraints are added to an affinity
+// from a Profile rather than being replaced by it.
+func ConfigureConstraints(statefulset *appsv1.StatefulSet, constraints []string) error {
+	nodeSelector, requirements, err := ParseConstraints(constraints)
+	if err != nil {
+		return err
+	}
+
+	statefulset.Spec.Template.Spec.NodeSelector = nodeSelector
+	requireNodeAffinity(statefulset, requirements...)
+	return nil
+}
+
+// requireNodeAffinity adds the requirements to each of the required node selector
+// terms of the Pod template, replacing any expression for the same key
+func requireNodeAffinity(statefulset *appsv1.StatefulSet, requirements ...corev1.NodeSelectorRequirement) {
+	if len(requirements) == 0 {
+		return
+	}
+
+	spec := &statefulset.Spec.Template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+
+	required := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		required = &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{}}}
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = required
+	}
+
+	keys := map[string]bool{}
+	for _, requirement := range requirements {
+		keys[requirement.Key] = true
+	}
+
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+
+		expressions := []corev1.NodeSelectorRequirement{}
+		for _, expression := range term.MatchExpressions {
+			if !keys[expression.Key] {
+				expressions = append(expressions, expression)
+			}
+		}
+		term.MatchExpressions = append(expressions, requirements...)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_ParseConstraints(t *testing.T) {
+	nodeSelector, requirements, err := ParseConstraints([]string{
+		"disktype=ssd",
+		"kubernetes.io/arch==arm64",
+		"topology.kubernetes.io/zone in (eu-west-1a, eu-west-1b)",
+		"node.kubernetes.io/instance-type!=t3.micro",
+		"nvidia.com/gpu",
+		"!spot",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	wantSelector := map[string]string{"disktype": "ssd", "kubernetes.io/arch": "arm64"}
+	if !reflect.DeepEqual(wantSelector, nodeSelector) {
+		t.Errorf("want node selector %v, got %v", wantSelector, nodeSelector)
+	}
+
+	wantRequirements := []corev1.NodeSelectorRequirement{
+		{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"eu-west-1a", "eu-west-1b"}},
+		{Key: "node.kubernetes.io/instance-type", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"t3.micro"}},
+		{Key: "nvidia.com/gpu", Operator: corev1.NodeSelectorOpExists, Values: []string{}},
+		{Key: "spot", Operator: corev1.NodeSelectorOpDoesNotExist, Values: []string{}},
+	}
+	if !reflect.DeepEqual(wantRequirements, requirements) {
+		t.Errorf("want requirements\n%+v\ngot\n%+v", wantRequirements, requirements)
+	}
+}
+
+func Test_ParseConstraints_ListsInvalid(t *testing.T) {
+	_, _, err := ParseConstraints([]string{"disktype=ssd", "zone:eu-west-1a", "disktype=hdd", "gpu in ()x"})
+	if err == nil {
+		t.Fatalf("want an error")
+	}
+
+	for _, invalid := range []string{`"zone:eu-west-1a"`, `"disktype=hdd": conflicts with disktype=ssd`, `"gpu in ()x"`} {
+		if !strings.Contains(err.Error(), invalid) {
+			t.Errorf("want %s to be listed, got %s", invalid, err)
+		}
+	}
+	if strings.Contains(err.Error(), `"disktype=ssd"`) {
+		t.Errorf("want only the invalid constraints to be listed, got %s", err)
+	}
+}
+
+func Test_ConfigureConstraints_KeepsProfileAffinity(t *testing.T) {
+	zone := corev1.NodeSelectorRequirement{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}
+	statefulset := &appsv1.StatefulSet{}
+	statefulset.Spec.Template.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{zone}}},
+			},
+		},
+	}
+
+	if err := ConfigureConstraints(statefulset, []string{"disktype=ssd", "!spot"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := statefulset.Spec.Template.Spec.NodeSelector; !reflect.DeepEqual(map[string]string{"disktype": "ssd"}, got) {
+		t.Errorf("want the node selector disktype=ssd, got %v", got)
+	}
+
+	terms := statefulset.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	want := []corev1.NodeSelectorRequirement{
+		zone,
+		{Key: "spot", Operator: corev1.NodeSelectorOpDoesNotExist, Values: []string{}},
+	}
+	if !reflect.DeepEqual(want, terms[0].MatchExpressions) {
+		t.Errorf("want expressions\n%+v\ngot\n%+v", want, terms[0].MatchExpressions)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ContainerHealth tells apart the Pods of a function that are not ready because of
+// the function's own container from those held back by a sidecar, such as the proxy
+// of a service mesh, or by an init container
+type ContainerHealth struct {
+	// FunctionNotReady is the count of Pods whose function container is not ready
+	FunctionNotReady int32 `json:"functionNotReady"`
+	// SidecarsNotReady is the count of Pods with a sidecar that is not ready or an
+	// init container that has not completed
+	SidecarsNotReady int32 `json:"sidecarsNotReady"`
+	// Reasons lists each container that is not ready once, with the reason that
+	// was reported for it i.e. "istio-proxy: CrashLoopBackOff"
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// UnreadyContainer is a container of a function's Pod that is not ready
+type UnreadyContainer struct {
+	Name string
+	// Function is true for the function's own container, false for a sidecar or an
+	// init container
+	Function bool
+	// Reason is the reason of the container's waiting or terminated state, or
+	// NotReady when it is running without passing its readiness probe
+	Reason string
+}
+
+// UnreadyContainers returns the containers of the Pod that are not ready, the
+// function container is the one named after the function
+func UnreadyContainers(pod *corev1.Pod) []UnreadyContainer {
+	function := pod.Labels["faas_function"]
+	unready := []UnreadyContainer{}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.State.Terminated != nil && status.State.Terminated.ExitCode == 0 {
+			continue
+		}
+		unready = append(unready, UnreadyContainer{Name: status.Name, Reason: containerReason(status)})
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			continue
+		}
+		unready = append(unready, UnreadyContainer{
+			Name:     status.Name,
+			Function: status.Name == function,
+			Reason:   containerReason(status),
+		})
+	}
+	return unready
+}
+
+// GetContainerHealth aggregates the state of the containers of a function's Pods
+func GetContainerHealth(pods []*corev1.Pod) ContainerHealth {
+	health := ContainerHealth{}
+	reasons := map[string]bool{}
+
+	for _, pod := range pods {
+		functionNotReady, sidecarNotReady := false, false
+		for _, container := range UnreadyContainers(pod) {
+			if container.Function {
+				functionNotReady = true
+			} else {
+				sidecarNotReady = true
+			}
+			reasons[fmt.Sprintf("%s: %s", container.Name, container.Reason)] = true
+		}
+
+		if functionNotReady {
+			health.FunctionNotReady++
+		}
+		if sidecarNotReady {
+			health.SidecarsNotReady++
+		}
+	}
+
+	for reason := range reasons {
+		health.Reasons = append(health.Reasons, reason)
+	}
+	sort.Strings(health.Reasons)
+	return health
+}
+
+func containerReason(status corev1.ContainerStatus) string {
+	switch {
+	case status.State.Waiting != nil && status.State.Waiting.Reason != "":
+		return status.State.Waiting.Reason
+	case status.State.Terminated != nil && status.State.Terminated.Reason != "":
+		return status.State.Terminated.Reason
+	}
+	return "NotReady"
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_GetContainerHealth(t *testing.T) {
+	pod := func(name string, init []corev1.ContainerStatus, containers ...corev1.ContainerStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"faas_function": "figlet"}},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: init,
+				ContainerStatuses:     containers,
+			},
+		}
+	}
+	crashing := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+	completed := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}}
+
+	pods := []*corev1.Pod{
+		pod("figlet-0", []corev1.ContainerStatus{{Name: "istio-init", State: completed}},
+			corev1.ContainerStatus{Name: "figlet", Ready: true},
+			corev1.ContainerStatus{Name: "istio-proxy", Ready: true}),
+		pod("figlet-1", []corev1.ContainerStatus{{Name: "istio-init", State: completed}},
+			corev1.ContainerStatus{Name: "figlet"},
+			corev1.ContainerStatus{Name: "istio-proxy", State: crashing}),
+		pod("figlet-2", []corev1.ContainerStatus{{Name: "istio-init", State: crashing}},
+			corev1.ContainerStatus{Name: "figlet", Ready: true},
+			corev1.ContainerStatus{Name: "istio-proxy", Ready: true}),
+	}
+
+	got := GetContainerHealth(pods)
+	want := ContainerHealth{
+		FunctionNotReady: 1,
+		SidecarsNotReady: 2,
+		Reasons:          []string{"figlet: NotReady", "istio-init: CrashLoopBackOff", "istio-proxy: CrashLoopBackOff"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
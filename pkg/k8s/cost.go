@@ -0,0 +1,108 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ParseCostLabels splits the comma separated keys of the cost-allocation labels
+func ParseCostLabels(value string) []string {
+	keys := []string{}
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// CostAllocationLabels returns the labels of a function that are listed in
+// CostLabels, they are copied to each of the resources created for the function
+// so that its usage can be charged back to a team or a project
+func (c DeploymentConfig) CostAllocationLabels(labels map[string]string) map[string]string {
+	var costLabels map[string]string
+	for _, key := range c.CostLabels {
+		if value, ok := labels[key]; ok {
+			if costLabels == nil {
+				costLabels = map[string]string{}
+			}
+			costLabels[key] = value
+		}
+	}
+	return costLabels
+}
+
+// AddLabels merges labels into the labels of obj
+func AddLabels(obj metav1.Object, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+
+	merged := cloneStringMap(obj.GetLabels())
+	for k, v := range labels {
+		merged[k] = v
+	}
+	obj.SetLabels(merged)
+}
+
+// FunctionUsage is the CPU, memory and storage requested by all of the replicas of
+// a function
+type FunctionUsage struct {
+	Replicas int32
+	CPU      resource.Quantity
+	Memory   resource.Quantity
+	Storage  resource.Quantity
+}
+
+// GetFunctionUsage adds up the requests of the containers of the StatefulSet for
+// each of its desired replicas. The storage of the volumeClaimTemplates is counted
+// for each replica, a PersistentVolumeClaim that is mounted by the Pods is shared
+// and counted once, it is looked up in claims by name.
+func GetFunctionUsage(statefulset *appsv1.StatefulSet, claims map[string]*corev1.PersistentVolumeClaim) FunctionUsage {
+	usage := FunctionUsage{Replicas: 1}
+	if statefulset.Spec.Replicas != nil {
+		usage.Replicas = *statefulset.Spec.Replicas
+	}
+
+	replicas := int64(usage.Replicas)
+	for _, container := range statefulset.Spec.Template.Spec.Containers {
+		if cpu, ok := container.Resources.Requests[corev1.ResourceCPU]; ok {
+			usage.CPU.Add(multiply(cpu, replicas))
+		}
+		if memory, ok := container.Resources.Requests[corev1.ResourceMemory]; ok {
+			usage.Memory.Add(multiply(memory, replicas))
+		}
+	}
+
+	for _, template := range statefulset.Spec.VolumeClaimTemplates {
+		if storage, ok := template.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			usage.Storage.Add(multiply(storage, replicas))
+		}
+	}
+
+	for _, volume := range statefulset.Spec.Template.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		claim, ok := claims[volume.PersistentVolumeClaim.ClaimName]
+		if !ok {
+			continue
+		}
+		if storage, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			usage.Storage.Add(storage)
+		}
+	}
+
+	return usage
+}
+
+func multiply(q resource.Quantity, n int64) resource.Quantity {
+	return *resource.NewMilliQuantity(q.MilliValue()*n, q.Format)
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ParseCostLabels(t *testing.T) {
+	got := ParseCostLabels(" team, project,,")
+	if want := []string{"team", "project"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func Test_CostAllocationLabels(t *testing.T) {
+	config := DeploymentConfig{CostLabels: []string{"team", "project"}}
+
+	got := config.CostAllocationLabels(map[string]string{"team": "payments", "faas_function": "figlet"})
+	if want := map[string]string{"team": "payments"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	if got := config.CostAllocationLabels(map[string]string{"faas_function": "figlet"}); got != nil {
+		t.Fatalf("want no labels, got %v", got)
+	}
+}
+
+func Test_AddLabels_DoesNotChangeSharedMap(t *testing.T) {
+	shared := map[string]string{"faas_function": "figlet"}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Labels: shared}}
+
+	AddLabels(service, map[string]string{"team": "payments"})
+
+	if want := map[string]string{"faas_function": "figlet", "team": "payments"}; !reflect.DeepEqual(want, service.Labels) {
+		t.Fatalf("want %v, got %v", want, service.Labels)
+	}
+	if len(shared) != 1 {
+		t.Fatalf("the original labels must not be changed, got %v", shared)
+	}
+}
+
+func Test_GetFunctionUsage(t *testing.T) {
+	replicas := int32(3)
+	statefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "figlet",
+						Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("100m"),
+							corev1.ResourceMemory: resource.MustParse("128Mi"),
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "cache",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "cache"},
+						},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				Spec: corev1.PersistentVolumeClaimSpec{
+					Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("1Gi"),
+					}},
+				},
+			}},
+		},
+	}
+
+	claims := map[string]*corev1.PersistentVolumeClaim{
+		"cache": {
+			Spec: corev1.PersistentVolumeClaimSpec{
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse("5Gi"),
+				}},
+			},
+		},
+	}
+
+	usage := GetFunctionUsage(statefulset, claims)
+
+	if usage.Replicas != 3 {
+		t.Errorf("want 3 replicas, got %d", usage.Replicas)
+	}
+	if got := usage.CPU.String(); got != "300m" {
+		t.Errorf("want 300m CPU, got %s", got)
+	}
+	if got := usage.Memory.String(); got != "384Mi" {
+		t.Errorf("want 384Mi memory, got %s", got)
+	}
+	// one claim per replica and the shared claim once
+	if got := usage.Storage.String(); got != "8Gi" {
+		t.Errorf("want 8Gi storage, got %s", got)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+)
+
+// DefaultEnv reads the environment variables that are set for every function from
+// a ConfigMap, such as the proxy settings or the path to a CA bundle of the cluster
+type DefaultEnv struct {
+	lister    corelister.ConfigMapLister
+	namespace string
+	name      string
+}
+
+// NewDefaultEnv returns a DefaultEnv for the ConfigMap, which is read from lister
+func NewDefaultEnv(lister corelister.ConfigMapLister, namespace, name string) *DefaultEnv {
+	return &DefaultEnv{lister: lister, namespace: namespace, name: name}
+}
+
+// Values returns the data of the ConfigMap, it is nil when the DefaultEnv is nil
+// or the ConfigMap does not exist
+func (d *DefaultEnv) Values() map[string]string {
+	if d == nil {
+		return nil
+	}
+
+	configMap, err := d.lister.ConfigMaps(d.namespace).Get(d.name)
+	if err != nil {
+		return nil
+	}
+	return configMap.Data
+}
+
+// AddDefaultEnv adds the defaults to the environment variables of a function,
+// unless the function sets a variable of the same name. The variables are sorted
+// by name when a default is added.
+func AddDefaultEnv(envVars []corev1.EnvVar, defaults map[string]string) []corev1.EnvVar {
+	if len(defaults) == 0 {
+		return envVars
+	}
+
+	set := make(map[string]bool, len(envVars))
+	for _, env := range envVars {
+		set[env.Name] = true
+	}
+
+	merged := envVars
+	for name, value := range defaults {
+		if !set[name] {
+			merged = append(merged, corev1.EnvVar{Name: name, Value: value})
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Name < merged[j].Name
+	})
+	return merged
+}
@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_AddDefaultEnv(t *testing.T) {
+	envVars := []corev1.EnvVar{{Name: "fprocess", Value: "cat"}, {Name: "HTTP_PROXY", Value: "http://function:3128"}}
+	defaults := map[string]string{"HTTP_PROXY": "http://proxy:3128", "NO_PROXY": ".svc"}
+
+	got := AddDefaultEnv(envVars, defaults)
+
+	want := []corev1.EnvVar{
+		{Name: "HTTP_PROXY", Value: "http://function:3128"},
+		{Name: "NO_PROXY", Value: ".svc"},
+		{Name: "fprocess", Value: "cat"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func Test_AddDefaultEnv_NoDefaults(t *testing.T) {
+	envVars := []corev1.EnvVar{{Name: "fprocess", Value: "cat"}, {Name: "A", Value: "1"}}
+
+	got := AddDefaultEnv(envVars, nil)
+
+	if !reflect.DeepEqual(got, envVars) {
+		t.Errorf("want the variables unchanged, got %v", got)
+	}
+}
+
+func Test_DefaultEnv_Values(t *testing.T) {
+	var unset *DefaultEnv
+	if values := unset.Values(); values != nil {
+		t.Errorf("want no values without a DefaultEnv, got %v", values)
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	lister := corelister.NewConfigMapLister(indexer)
+
+	defaultEnv := NewDefaultEnv(lister, "openfaas", "function-env")
+	if values := defaultEnv.Values(); values != nil {
+		t.Errorf("want no values without the ConfigMap, got %v", values)
+	}
+
+	indexer.Add(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "function-env", Namespace: "openfaas"},
+		Data:       map[string]string{"SSL_CERT_FILE": "/etc/ssl/ca.pem"},
+	})
+	if values := defaultEnv.Values(); values["SSL_CERT_FILE"] != "/etc/ssl/ca.pem" {
+		t.Errorf("want SSL_CERT_FILE from the ConfigMap, got %v", values)
+	}
+}
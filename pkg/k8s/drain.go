@@ -0,0 +1,79 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1apply "k8s.io/client-go/applyconfigurations/apps/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AnnotationDrainStatus is set on the StatefulSet of a function while its Pods are
+// moved off nodes that are cordoned or drained, with the DrainStatus as JSON
+const AnnotationDrainStatus = "com.openfaas.drain.status"
+
+// DrainStatus is the progress of moving the Pods of a function off the nodes that
+// are cordoned or drained
+type DrainStatus struct {
+	// Nodes are the cordoned nodes that still run Pods of the function
+	Nodes []string `json:"nodes"`
+	// Pending is the count of Pods left on the Nodes
+	Pending int32 `json:"pending"`
+	// Evicting is the Pod that is being moved, the next one is only evicted once
+	// it runs on another node and is ready
+	Evicting string `json:"evicting,omitempty"`
+	// Blocked is why the next Pod is not evicted yet, such as a
+	// PodDisruptionBudget or a Pod that is not ready
+	Blocked string `json:"blocked,omitempty"`
+}
+
+// IsNodeDraining is true for a node that is cordoned, which kubectl drain does
+// before it evicts the Pods
+func IsNodeDraining(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == corev1.TaintNodeUnschedulable && taint.Effect == corev1.TaintEffectNoSchedule {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDrainStatus returns the DrainStatus recorded in the annotations of a
+// StatefulSet, it is nil when none of the function's Pods are being moved
+func ParseDrainStatus(annotations map[string]string) *DrainStatus {
+	value, ok := annotations[AnnotationDrainStatus]
+	if !ok {
+		return nil
+	}
+
+	status := &DrainStatus{}
+	if err := json.Unmarshal([]byte(value), status); err != nil {
+		return nil
+	}
+	return status
+}
+
+// ApplyDrainStatus records the DrainStatus on the StatefulSet of a function, a nil
+// status removes it
+func ApplyDrainStatus(ctx context.Context, client kubernetes.Interface, namespace, name string, status *DrainStatus) error {
+	applyConfig := appsv1apply.StatefulSet(name, namespace)
+	if status != nil {
+		value, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		applyConfig.WithAnnotations(map[string]string{AnnotationDrainStatus: string(value)})
+	}
+
+	_, err := client.AppsV1().StatefulSets(namespace).
+		Apply(ctx, applyConfig, metav1.ApplyOptions{FieldManager: DrainFieldManager, Force: true})
+	return err
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_IsNodeDraining(t *testing.T) {
+	cases := []struct {
+		name string
+		node corev1.Node
+		want bool
+	}{
+		{name: "schedulable"},
+		{name: "cordoned", node: corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}}, want: true},
+		{
+			name: "unschedulable taint",
+			node: corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}}},
+			want: true,
+		},
+		{
+			name: "other taint",
+			node: corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: "gpu", Effect: corev1.TaintEffectNoSchedule}}}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := IsNodeDraining(&c.node); got != c.want {
+				t.Errorf("want %t, got %t", c.want, got)
+			}
+		})
+	}
+}
+
+func Test_ParseDrainStatus(t *testing.T) {
+	annotations := map[string]string{AnnotationDrainStatus: `{"nodes":["node-1"],"pending":2,"evicting":"figlet-2"}`}
+
+	want := &DrainStatus{Nodes: []string{"node-1"}, Pending: 2, Evicting: "figlet-2"}
+	if got := ParseDrainStatus(annotations); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	if got := ParseDrainStatus(map[string]string{}); got != nil {
+		t.Errorf("want no status without the annotation, got %+v", got)
+	}
+}
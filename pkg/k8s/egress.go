@@ -0,0 +1,273 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// AnnotationEgress is the comma separated allowlist of the endpoints that a
+	// function may call, each one is a host or CIDR with an optional port, i.e.
+	// "api.stripe.com:443,10.0.0.0/8". All other egress, except DNS, is denied.
+	AnnotationEgress = "com.openfaas.egress"
+
+	// AnnotationEgressKind is either NetworkPolicy, the default, or
+	// CiliumNetworkPolicy, which is required for hostnames
+	AnnotationEgressKind = AnnotationEgress + ".kind"
+
+	egressKindNetworkPolicy       = "NetworkPolicy"
+	egressKindCiliumNetworkPolicy = "CiliumNetworkPolicy"
+)
+
+var (
+	NetworkPolicyResource       = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+	CiliumNetworkPolicyResource = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumnetworkpolicies"}
+
+	// EgressResources are checked for policies to remove, when a function no longer
+	// sets an allowlist or changes the kind of its policy
+	EgressResources = []schema.GroupVersionResource{NetworkPolicyResource, CiliumNetworkPolicyResource}
+)
+
+// egressRule is an entry of the allowlist, either host or cidr is set and a port
+// of 0 allows all ports
+type egressRule struct {
+	host string
+	cidr string
+	port int64
+}
+
+// EgressPolicyName is the name of the NetworkPolicy or CiliumNetworkPolicy of a
+// function
+func EgressPolicyName(functionName string) string {
+	return functionName + "-egress"
+}
+
+// parseEgress parses the value of the com.openfaas.egress annotation, an IP
+// address is allowed as a single host CIDR
+func parseEgress(value string) ([]egressRule, error) {
+	var rules []egressRule
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		address, port := entry, ""
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			if address, port, err = net.SplitHostPort(entry); err != nil {
+				address, port = entry, ""
+			}
+		}
+
+		rule := egressRule{}
+		if port != "" {
+			p, err := strconv.ParseInt(port, 10, 32)
+			if err != nil || p < 1 || p > 65535 {
+				return nil, fmt.Errorf("invalid port in %s: %q", AnnotationEgress, entry)
+			}
+			rule.port = p
+		}
+
+		if _, cidr, err := net.ParseCIDR(address); err == nil {
+			rule.cidr = cidr.String()
+		} else if ip := net.ParseIP(address); ip != nil {
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			rule.cidr = fmt.Sprintf("%s/%d", ip.String(), bits)
+		} else if strings.ContainsAny(address, "/ ") {
+			return nil, fmt.Errorf("invalid host in %s: %q", AnnotationEgress, entry)
+		} else {
+			rule.host = address
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s has no entries", AnnotationEgress)
+	}
+	return rules, nil
+}
+
+// MakeEgressPolicy creates the NetworkPolicy or CiliumNetworkPolicy that restricts
+// the egress of a function to its com.openfaas.egress allowlist, nil is returned
+// when the function does not set one. Both are managed with the dynamic client, so
+// that Cilium is only required when a function uses it. The owner is set by the
+// caller.
+func MakeEgressPolicy(name, namespace string, annotations map[string]string) (*unstructured.Unstructured, schema.GroupVersionResource, error) {
+	value, ok := annotations[AnnotationEgress]
+	if !ok {
+		return nil, schema.GroupVersionResource{}, nil
+	}
+
+	rules, err := parseEgress(value)
+	if err != nil {
+		return nil, schema.GroupVersionResource{}, err
+	}
+
+	metadata := map[string]interface{}{
+		"name":      EgressPolicyName(name),
+		"namespace": namespace,
+		"labels":    map[string]interface{}{"faas_function": name},
+	}
+	selector := map[string]interface{}{
+		"matchLabels": map[string]interface{}{"faas_function": name},
+	}
+
+	switch kind := annotations[AnnotationEgressKind]; kind {
+	case "", egressKindNetworkPolicy:
+		for _, rule := range rules {
+			if rule.host != "" {
+				return nil, NetworkPolicyResource, fmt.Errorf("host %s in %s requires %s: %s", rule.host, AnnotationEgress, AnnotationEgressKind, egressKindCiliumNetworkPolicy)
+			}
+		}
+		return makeNetworkPolicy(rules, selector, metadata), NetworkPolicyResource, nil
+
+	case egressKindCiliumNetworkPolicy:
+		return makeCiliumNetworkPolicy(rules, selector, metadata), CiliumNetworkPolicyResource, nil
+
+	default:
+		return nil, schema.GroupVersionResource{}, fmt.Errorf("invalid value for %s: %q, use %s or %s", AnnotationEgressKind, kind, egressKindNetworkPolicy, egressKindCiliumNetworkPolicy)
+	}
+}
+
+func makeNetworkPolicy(rules []egressRule, selector, metadata map[string]interface{}) *unstructured.Unstructured {
+	// names are resolved by any DNS server, such as the cluster DNS
+	egress := []interface{}{
+		map[string]interface{}{
+			"ports": []interface{}{
+				map[string]interface{}{"protocol": "UDP", "port": int64(53)},
+				map[string]interface{}{"protocol": "TCP", "port": int64(53)},
+			},
+		},
+	}
+
+	for _, rule := range rules {
+		to := map[string]interface{}{
+			"to": []interface{}{
+				map[string]interface{}{"ipBlock": map[string]interface{}{"cidr": rule.cidr}},
+			},
+		}
+		if rule.port > 0 {
+			to["ports"] = []interface{}{
+				map[string]interface{}{"protocol": "TCP", "port": rule.port},
+			}
+		}
+		egress = append(egress, to)
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": NetworkPolicyResource.GroupVersion().String(),
+		"kind":       egressKindNetworkPolicy,
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"podSelector": selector,
+			"policyTypes": []interface{}{"Egress"},
+			"egress":      egress,
+		},
+	}}
+}
+
+func makeCiliumNetworkPolicy(rules []egressRule, selector, metadata map[string]interface{}) *unstructured.Unstructured {
+	// the DNS proxy of Cilium learns the addresses of the allowed hosts, so the
+	// lookups must go to the cluster DNS
+	egress := []interface{}{
+		map[string]interface{}{
+			"toEndpoints": []interface{}{
+				map[string]interface{}{
+					"matchLabels": map[string]interface{}{
+						"k8s:io.kubernetes.pod.namespace": "kube-system",
+						"k8s:k8s-app":                     "kube-dns",
+					},
+				},
+			},
+			"toPorts": []interface{}{
+				map[string]interface{}{
+					"ports": []interface{}{map[string]interface{}{"port": "53", "protocol": "ANY"}},
+					"rules": map[string]interface{}{
+						"dns": []interface{}{map[string]interface{}{"matchPattern": "*"}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, rule := range rules {
+		to := map[string]interface{}{}
+		if rule.host != "" {
+			to["toFQDNs"] = []interface{}{map[string]interface{}{"matchName": rule.host}}
+		} else {
+			to["toCIDR"] = []interface{}{rule.cidr}
+		}
+		if rule.port > 0 {
+			to["toPorts"] = []interface{}{
+				map[string]interface{}{
+					"ports": []interface{}{
+						map[string]interface{}{"port": strconv.FormatInt(rule.port, 10), "protocol": "TCP"},
+					},
+				},
+			}
+		}
+		egress = append(egress, to)
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": CiliumNetworkPolicyResource.GroupVersion().String(),
+		"kind":       egressKindCiliumNetworkPolicy,
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"endpointSelector": selector,
+			"egress":           egress,
+		},
+	}}
+}
+
+// SyncEgressPolicy applies the egress policy of a function, and removes the policy
+// of the other kind, or both when the function no longer sets an allowlist. Only
+// policies that are owned by the StatefulSet of the function are removed.
+func SyncEgressPolicy(ctx context.Context, client dynamic.Interface, functionName, namespace string, annotations map[string]string, owner metav1.OwnerReference, labels map[string]string) error {
+	policy, policyResource, err := MakeEgressPolicy(functionName, namespace, annotations)
+	if err != nil {
+		return err
+	}
+
+	if client == nil {
+		if policy != nil {
+			return fmt.Errorf("%s is not supported without a dynamic client", AnnotationEgress)
+		}
+		return nil
+	}
+
+	for _, resource := range EgressResources {
+		if policy != nil && resource == policyResource {
+			continue
+		}
+		if err := DeleteOwnedResource(ctx, client, resource, namespace, EgressPolicyName(functionName), functionName); err != nil {
+			return err
+		}
+	}
+
+	if policy == nil {
+		return nil
+	}
+
+	policy.SetOwnerReferences([]metav1.OwnerReference{owner})
+	AddLabels(policy, labels)
+
+	_, err = client.Resource(policyResource).Namespace(namespace).
+		Apply(ctx, policy.GetName(), policy, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func Test_parseEgress(t *testing.T) {
+	rules, err := parseEgress("api.stripe.com:443, 10.0.0.0/8,192.168.1.10:5432,10.1.0.0/16:8080")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []egressRule{
+		{host: "api.stripe.com", port: 443},
+		{cidr: "10.0.0.0/8"},
+		{cidr: "192.168.1.10/32", port: 5432},
+		{cidr: "10.1.0.0/16", port: 8080},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("want %d rules, got %+v", len(want), rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d: want %+v, got %+v", i, want[i], rules[i])
+		}
+	}
+}
+
+func Test_parseEgress_Invalid(t *testing.T) {
+	for _, value := range []string{"", "api.stripe.com:https", "10.0.0.0/8:70000", "10.0.0.0/33"} {
+		if _, err := parseEgress(value); err == nil {
+			t.Errorf("%q: want an error", value)
+		}
+	}
+}
+
+func Test_SyncEgressPolicy_RemovesOwnedPolicyWithoutAllowlist(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+	policy, _, _ := MakeEgressPolicy("figlet", "openfaas-fn", map[string]string{AnnotationEgress: "10.0.0.0/8"})
+	policy.SetOwnerReferences([]metav1.OwnerReference{owner})
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		NetworkPolicyResource:       "NetworkPolicyList",
+		CiliumNetworkPolicyResource: "CiliumNetworkPolicyList",
+	}, policy)
+
+	if err := SyncEgressPolicy(context.Background(), dynamicClient, "figlet", "openfaas-fn", map[string]string{}, owner, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := dynamicClient.Resource(NetworkPolicyResource).Namespace("openfaas-fn").Get(context.Background(), "figlet-egress", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("want the NetworkPolicy to be deleted when the function no longer sets an allowlist")
+	}
+}
@@ -4,7 +4,11 @@
 package k8s
 
 import (
+	"errors"
+	"fmt"
+
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 )
 
 // isNotFound tests if the error is a kubernetes API error that indicates that the object
@@ -12,3 +16,37 @@ import (
 func IsNotFound(err error) bool {
 	return k8serrors.IsNotFound(err) || k8serrors.IsGone(err)
 }
+
+// IsUnavailable tests if the error means that an optional API can not be used, as it
+// is not installed or the controller has not been granted access to it
+func IsUnavailable(err error) bool {
+	return meta.IsNoMatchError(err) || k8serrors.IsForbidden(err)
+}
+
+// ProfileNotFoundError is returned when a function references a Profile that does
+// not exist in the Profiles namespace
+type ProfileNotFoundError struct {
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e *ProfileNotFoundError) Error() string {
+	return fmt.Sprintf("profile %q not found in namespace %q", e.Name, e.Namespace)
+}
+
+func (e *ProfileNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// IsProfileNotFound tests if the error, or any error it wraps, is a ProfileNotFoundError
+func IsProfileNotFound(err error) bool {
+	var notFound *ProfileNotFoundError
+	return errors.As(err, &notFound)
+}
+
+// IsNameCollision tests if the error, or any error it wraps, is a NameCollisionError
+func IsNameCollision(err error) bool {
+	var collision *NameCollisionError
+	return errors.As(err, &collision)
+}
@@ -5,6 +5,7 @@ package k8s
 
 import (
 	"context"
+	"time"
 
 	vv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
 	openfaasv1 "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/typed/openfaas/v1"
@@ -12,7 +13,9 @@ import (
 	v1 "github.com/openfaas/faas-netes/pkg/client/listers/openfaas/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	corelister "k8s.io/client-go/listers/core/v1"
 )
 
 // NamespacedProfiler is a subset of the v1.ProfileLister that is needed for the function factory
@@ -26,31 +29,64 @@ type FunctionFactory struct {
 	Client   kubernetes.Interface
 	Config   DeploymentConfig
 	Profiler NamespacedProfiler
+	// SecretLister is optional, when set the secrets for functions are read from
+	// the informer cache instead of the API
+	SecretLister corelister.SecretLister
+	// Dynamic is used for the resources of add-ons whose CRDs may not be installed,
+	// such as the VerticalPodAutoscaler
+	Dynamic dynamic.Interface
+	// ImageVerifier is optional, when set the image of a function is checked before
+	// the StatefulSet is created or updated
+	ImageVerifier ImageVerifier
+	// ArchitectureResolver is optional, when set the architectures of a function's
+	// image are read from its registry unless they are given by an annotation
+	ArchitectureResolver ArchitectureResolver
+	// ReplicaLimits is optional, when nil the scale labels of functions are checked
+	// against DefaultMaxReplicas
+	ReplicaLimits *ReplicaLimits
+	// NamespaceAnnotations is optional, when set the annotations of namespaces can
+	// override the UID, GID and secret selector of the functions in them
+	NamespaceAnnotations *NamespaceAnnotations
+	// DefaultEnv is optional, when set its environment variables are added to every
+	// function that does not set them
+	DefaultEnv *DefaultEnv
+}
+
+// ImageVerifier checks that an image may be deployed to a namespace
+type ImageVerifier interface {
+	Verify(ctx context.Context, namespace, image string) error
 }
 
 func NewFunctionFactory(clientset kubernetes.Interface, config DeploymentConfig, faasclient openfaasv1.OpenfaasV1Interface) FunctionFactory {
 	return FunctionFactory{
 		Client:   clientset,
 		Config:   config,
-		Profiler: &Lister{f: faasclient},
+		Profiler: &Lister{f: faasclient, timeout: config.APITimeout},
 	}
 }
 
+// Lister reads Profiles from the API rather than an informer, the lister interface
+// has no context so each call is bounded by the timeout instead
 type Lister struct {
-	f openfaasv1.OpenfaasV1Interface
+	f       openfaasv1.OpenfaasV1Interface
+	timeout time.Duration
 }
 
 func (l *Lister) Profiles(namespace string) v1.ProfileNamespaceLister {
-	return &NamespaceLister{f: l.f, ns: namespace}
+	return &NamespaceLister{f: l.f, ns: namespace, timeout: l.timeout}
 }
 
 type NamespaceLister struct {
-	f  openfaasv1.OpenfaasV1Interface
-	ns string
+	f       openfaasv1.OpenfaasV1Interface
+	ns      string
+	timeout time.Duration
 }
 
 func (l *NamespaceLister) Get(name string) (ret *vv1.Profile, err error) {
-	value, err := l.f.Profiles(l.ns).Get(context.Background(), name, metav1.GetOptions{})
+	ctx, cancel := WithAPITimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	value, err := l.f.Profiles(l.ns).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +95,10 @@ func (l *NamespaceLister) Get(name string) (ret *vv1.Profile, err error) {
 }
 
 func (l *NamespaceLister) List(selector labels.Selector) (ret []*vv1.Profile, err error) {
-	list, err := l.f.Profiles(l.ns).List(context.Background(), metav1.ListOptions{LabelSelector: selector.String()})
+	ctx, cancel := WithAPITimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	list, err := l.f.Profiles(l.ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
 
 	if err != nil {
 		return nil, err
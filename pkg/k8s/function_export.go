@@ -0,0 +1,171 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"sort"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AsFunction converts the StatefulSet of a function into the Function custom resource
+// that deploys it with the operator. This is the inverse of the deploy handler, the
+// labels and the environment added by faas-netes are not included.
+func AsFunction(item appsv1.StatefulSet) *faasv1.Function {
+	status := AsFunctionStatus(item)
+	if status == nil {
+		return nil
+	}
+
+	container := item.Spec.Template.Spec.Containers[0]
+
+	spec := faasv1.FunctionSpec{
+		Name:        item.Name,
+		Image:       status.Image,
+		Handler:     status.EnvProcess,
+		Annotations: copyMap(item.Spec.Template.Annotations),
+		Secrets:     status.Secrets,
+	}
+	if spec.Annotations != nil {
+		// the checksum is set again from the secrets by the operator
+		delete(*spec.Annotations, AnnotationSecretsChecksum)
+		if len(*spec.Annotations) == 0 {
+			spec.Annotations = nil
+		}
+	}
+
+	labels := copyMap(item.Spec.Template.Labels)
+	if labels != nil {
+		delete(*labels, "faas_function")
+		if len(*labels) == 0 {
+			labels = nil
+		}
+	}
+	spec.Labels = labels
+
+	processEnv := ProcessEnvName(&item)
+	environment := map[string]string{}
+	for _, env := range container.Env {
+		if env.Name == processEnv || env.ValueFrom != nil {
+			continue
+		}
+		environment[env.Name] = env.Value
+	}
+	if len(environment) > 0 {
+		spec.Environment = &environment
+	}
+
+	for key, value := range item.Spec.Template.Spec.NodeSelector {
+		spec.Constraints = append(spec.Constraints, key+"="+value)
+	}
+	sort.Strings(spec.Constraints)
+
+	spec.Limits = asFunctionResources(status.Limits)
+	spec.Requests = asFunctionResources(status.Requests)
+
+	if sc := container.SecurityContext; sc != nil && sc.ReadOnlyRootFilesystem != nil {
+		spec.ReadOnlyRootFilesystem = *sc.ReadOnlyRootFilesystem
+	}
+
+	return &faasv1.Function{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: faasv1.SchemeGroupVersion.String(),
+			Kind:       "Function",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+		},
+		Spec: spec,
+	}
+}
+
+// IsOwnedByFunction returns true when the StatefulSet is managed by the operator
+func IsOwnedByFunction(item appsv1.StatefulSet) bool {
+	for _, owner := range item.OwnerReferences {
+		if owner.Kind == "Function" && owner.APIVersion == faasv1.SchemeGroupVersion.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// asFunctionResources omits the quantities that are not set, which are read as "0"
+func asFunctionResources(resources *types.FunctionResources) *faasv1.FunctionResources {
+	if resources == nil {
+		return nil
+	}
+
+	r := &faasv1.FunctionResources{Memory: resources.Memory, CPU: resources.CPU}
+	if r.Memory == "0" {
+		r.Memory = ""
+	}
+	if r.CPU == "0" {
+		r.CPU = ""
+	}
+	return r
+}
+
+func copyMap(m map[string]string) *map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return &c
+}
+
+// AsFunctionDeployment converts the StatefulSet of a function into the request that
+// deploys it again, such as into another namespace. The secrets and the Profiles
+// are referred to by name, so they must exist where the request is deployed. The
+// labels and the environment added by faas-netes are not included.
+func AsFunctionDeployment(item appsv1.StatefulSet) *types.FunctionDeployment {
+	status := AsFunctionStatus(item)
+	if status == nil {
+		return nil
+	}
+
+	container := item.Spec.Template.Spec.Containers[0]
+	labels, annotations := FunctionMetadata(&item)
+
+	request := &types.FunctionDeployment{
+		Service:     item.Name,
+		Image:       status.Image,
+		Namespace:   item.Namespace,
+		EnvProcess:  status.EnvProcess,
+		Secrets:     status.Secrets,
+		Labels:      copyMap(labels),
+		Annotations: copyMap(annotations),
+		Limits:      status.Limits,
+		Requests:    status.Requests,
+	}
+
+	processEnv := ProcessEnvName(&item)
+	for _, env := range container.Env {
+		if env.Name == processEnv || env.ValueFrom != nil {
+			continue
+		}
+		if request.EnvVars == nil {
+			request.EnvVars = map[string]string{}
+		}
+		request.EnvVars[env.Name] = env.Value
+	}
+
+	for key, value := range item.Spec.Template.Spec.NodeSelector {
+		request.Constraints = append(request.Constraints, key+"="+value)
+	}
+	sort.Strings(request.Constraints)
+
+	if sc := container.SecurityContext; sc != nil && sc.ReadOnlyRootFilesystem != nil {
+		request.ReadOnlyRootFilesystem = *sc.ReadOnlyRootFilesystem
+	}
+
+	return request
+}
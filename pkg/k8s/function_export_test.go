@@ -0,0 +1,99 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_AsFunction_OmitsProviderFields(t *testing.T) {
+	statefulset := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"faas_function": "figlet"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "figlet",
+						Image: "ghcr.io/openfaas/figlet:latest",
+						Env: []corev1.EnvVar{
+							{Name: EnvProcessName, Value: "figlet"},
+							{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	function := AsFunction(statefulset)
+	if function.Spec.Labels != nil {
+		t.Errorf("want the faas_function label to be omitted, got %v", *function.Spec.Labels)
+	}
+	if function.Spec.Environment != nil {
+		t.Errorf("want fprocess and fields from the downward API to be omitted, got %v", *function.Spec.Environment)
+	}
+	if function.Spec.Handler != "figlet" {
+		t.Errorf("want the handler to be read from fprocess, got %q", function.Spec.Handler)
+	}
+	if function.Spec.Limits != nil || function.Spec.Requests != nil {
+		t.Errorf("want no resources, got %v %v", function.Spec.Limits, function.Spec.Requests)
+	}
+	if IsOwnedByFunction(statefulset) {
+		t.Errorf("want the statefulset not to be owned by a Function")
+	}
+}
+
+func Test_AsFunctionDeployment(t *testing.T) {
+	readOnly := true
+	statefulset := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "figlet",
+			Namespace:   "staging",
+			Annotations: map[string]string{AnnotationFunctionLabels: "team", AnnotationFunctionAnnotations: "com.openfaas.profile", "com.openfaas.profile": "gpu"},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"faas_function": "figlet", "team": "web"}},
+				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{"disk": "ssd"},
+					Containers: []corev1.Container{{
+						Name:            "figlet",
+						Image:           "ghcr.io/openfaas/figlet:latest",
+						SecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnly},
+						Env: []corev1.EnvVar{
+							{Name: EnvProcessName, Value: "figlet"},
+							{Name: "LOG_LEVEL", Value: "debug"},
+							{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	request := AsFunctionDeployment(statefulset)
+	if request.Service != "figlet" || request.Namespace != "staging" || request.EnvProcess != "figlet" {
+		t.Errorf("want figlet.staging running figlet, got %s.%s running %q", request.Service, request.Namespace, request.EnvProcess)
+	}
+	if len(request.EnvVars) != 1 || request.EnvVars["LOG_LEVEL"] != "debug" {
+		t.Errorf("want only LOG_LEVEL in the environment, got %v", request.EnvVars)
+	}
+	if request.Labels == nil || len(*request.Labels) != 1 || (*request.Labels)["team"] != "web" {
+		t.Errorf("want only the team label, got %v", request.Labels)
+	}
+	if request.Annotations == nil || (*request.Annotations)["com.openfaas.profile"] != "gpu" {
+		t.Errorf("want the profile annotation, got %v", request.Annotations)
+	}
+	if len(request.Constraints) != 1 || request.Constraints[0] != "disk=ssd" {
+		t.Errorf("want the disk=ssd constraint, got %v", request.Constraints)
+	}
+	if !request.ReadOnlyRootFilesystem {
+		t.Errorf("want a read-only root filesystem")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LabelFunctionGroup is set on the functions of a FunctionGroup with the name of
+	// the group, and on the ConfigMap that holds the group
+	LabelFunctionGroup = "com.openfaas.group"
+
+	// functionGroupConfigMapPrefix is the prefix of the name of the ConfigMap of a
+	// FunctionGroup
+	functionGroupConfigMapPrefix = "openfaas-group-"
+
+	functionGroupCurrentKey  = "group.json"
+	functionGroupPreviousKey = "previous.json"
+)
+
+// FunctionGroup is a set of functions that are deployed, rolled back and deleted
+// together, such as the functions of one application
+type FunctionGroup struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// EnvVars are set on each function of the group, unless the function sets a
+	// variable of the same name
+	EnvVars map[string]string `json:"envVars,omitempty"`
+	// Secrets are mounted into each function of the group, in addition to its own
+	Secrets []string `json:"secrets,omitempty"`
+	// Functions are the requests that deploy each function of the group
+	Functions []types.FunctionDeployment `json:"functions"`
+	// Revision is set by the provider, it is raised each time the group is deployed
+	// or rolled back
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// ValidateFunctionGroup checks the name of the group and that each of its functions
+// has a unique name, the functions themselves are checked when they are deployed
+func ValidateFunctionGroup(group FunctionGroup) error {
+	if errs := validation.IsDNS1123Label(group.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid group name %q: %s", group.Name, strings.Join(errs, ", "))
+	}
+	if len(functionGroupConfigMapPrefix+group.Name) > validation.DNS1123LabelMaxLength {
+		return fmt.Errorf("invalid group name %q: must be no more than %d characters", group.Name, validation.DNS1123LabelMaxLength-len(functionGroupConfigMapPrefix))
+	}
+	if len(group.Functions) == 0 {
+		return fmt.Errorf("group %s has no functions", group.Name)
+	}
+
+	seen := map[string]bool{}
+	for _, function := range group.Functions {
+		if function.Service == "" {
+			return fmt.Errorf("group %s has a function without a service name", group.Name)
+		}
+		if seen[function.Service] {
+			return fmt.Errorf("group %s has more than one function named %s", group.Name, function.Service)
+		}
+		seen[function.Service] = true
+	}
+	return nil
+}
+
+// Members returns the request of each function of the group, with the EnvVars and
+// Secrets of the group and the LabelFunctionGroup
+func (g FunctionGroup) Members() []types.FunctionDeployment {
+	members := make([]types.FunctionDeployment, 0, len(g.Functions))
+	for _, function := range g.Functions {
+		member := function
+		member.Namespace = g.Namespace
+
+		envVars := make(map[string]string, len(g.EnvVars)+len(function.EnvVars))
+		for k, v := range g.EnvVars {
+			envVars[k] = v
+		}
+		for k, v := range function.EnvVars {
+			envVars[k] = v
+		}
+		member.EnvVars = envVars
+
+		secrets := append([]string{}, function.Secrets...)
+		for _, secret := range g.Secrets {
+			if !contains(secrets, secret) {
+				secrets = append(secrets, secret)
+			}
+		}
+		member.Secrets = secrets
+
+		labels := map[string]string{}
+		if function.Labels != nil {
+			for k, v := range *function.Labels {
+				labels[k] = v
+			}
+		}
+		labels[LabelFunctionGroup] = g.Name
+		member.Labels = &labels
+
+		members = append(members, member)
+	}
+	return members
+}
+
+// FunctionGroupConfigMapName returns the name of the ConfigMap of a FunctionGroup
+func FunctionGroupConfigMapName(name string) string {
+	return functionGroupConfigMapPrefix + name
+}
+
+// GetFunctionGroup reads the current and the previous revision of a FunctionGroup
+// from its ConfigMap, previous is nil until the group has been deployed twice
+func GetFunctionGroup(ctx context.Context, client kubernetes.Interface, namespace, name string) (current, previous *FunctionGroup, err error) {
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, FunctionGroupConfigMapName(name), metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current = &FunctionGroup{}
+	if err := json.Unmarshal([]byte(configMap.Data[functionGroupCurrentKey]), current); err != nil {
+		return nil, nil, fmt.Errorf("unable to read group %s: %w", name, err)
+	}
+
+	if value, ok := configMap.Data[functionGroupPreviousKey]; ok {
+		previous = &FunctionGroup{}
+		if err := json.Unmarshal([]byte(value), previous); err != nil {
+			return nil, nil, fmt.Errorf("unable to read the previous revision of group %s: %w", name, err)
+		}
+	}
+	return current, previous, nil
+}
+
+// SaveFunctionGroup creates or updates the ConfigMap of a FunctionGroup with its
+// current and previous revisions
+func SaveFunctionGroup(ctx context.Context, client kubernetes.Interface, namespace string, current, previous *FunctionGroup) error {
+	data := map[string]string{}
+	for key, group := range map[string]*FunctionGroup{functionGroupCurrentKey: current, functionGroupPreviousKey: previous} {
+		if group == nil {
+			continue
+		}
+		value, err := json.Marshal(group)
+		if err != nil {
+			return err
+		}
+		data[key] = string(value)
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      FunctionGroupConfigMapName(current.Name),
+			Namespace: namespace,
+			Labels:    map[string]string{LabelFunctionGroup: current.Name, secretLabel: secretLabelValue},
+		},
+		Data: data,
+	}
+
+	_, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{FieldManager: FieldManager})
+	if k8serrors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{FieldManager: FieldManager})
+	}
+	return err
+}
+
+// DeleteFunctionGroup deletes the ConfigMap of a FunctionGroup, the functions of the
+// group are not deleted
+func DeleteFunctionGroup(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	return client.CoreV1().ConfigMaps(namespace).Delete(ctx, FunctionGroupConfigMapName(name), metav1.DeleteOptions{})
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_ValidateFunctionGroup(t *testing.T) {
+	figlet := types.FunctionDeployment{Service: "figlet"}
+
+	cases := []struct {
+		name    string
+		group   FunctionGroup
+		wantErr bool
+	}{
+		{name: "valid", group: FunctionGroup{Name: "shop", Functions: []types.FunctionDeployment{figlet}}},
+		{name: "invalid name", group: FunctionGroup{Name: "Shop", Functions: []types.FunctionDeployment{figlet}}, wantErr: true},
+		{name: "name too long", group: FunctionGroup{Name: strings.Repeat("a", 50), Functions: []types.FunctionDeployment{figlet}}, wantErr: true},
+		{name: "no functions", group: FunctionGroup{Name: "shop"}, wantErr: true},
+		{name: "function without a name", group: FunctionGroup{Name: "shop", Functions: []types.FunctionDeployment{{}}}, wantErr: true},
+		{name: "duplicate functions", group: FunctionGroup{Name: "shop", Functions: []types.FunctionDeployment{figlet, figlet}}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateFunctionGroup(tc.group)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("want error: %t, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_SaveFunctionGroup(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	first := &FunctionGroup{Name: "shop", Revision: 1, Functions: []types.FunctionDeployment{{Service: "figlet"}}}
+	if err := SaveFunctionGroup(ctx, client, "openfaas-fn", first, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	second := &FunctionGroup{Name: "shop", Revision: 2, Functions: []types.FunctionDeployment{{Service: "nodeinfo"}}}
+	if err := SaveFunctionGroup(ctx, client, "openfaas-fn", second, first); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	current, previous, err := GetFunctionGroup(ctx, client, "openfaas-fn", "shop")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if current.Revision != 2 || current.Functions[0].Service != "nodeinfo" {
+		t.Errorf("want the second revision as the current one, got %+v", current)
+	}
+	if previous == nil || previous.Revision != 1 {
+		t.Errorf("want the first revision as the previous one, got %+v", previous)
+	}
+
+	if err := DeleteFunctionGroup(ctx, client, "openfaas-fn", "shop"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, _, err := GetFunctionGroup(ctx, client, "openfaas-fn", "shop"); !IsNotFound(err) {
+		t.Errorf("want the group to be deleted, got %v", err)
+	}
+}
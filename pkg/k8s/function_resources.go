@@ -0,0 +1,47 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// IsOwnedByStatefulSet returns true when the object is owned by the StatefulSet of
+// the function, as set with StatefulSetOwner
+func IsOwnedByStatefulSet(object metav1.Object, functionName string) bool {
+	for _, ref := range object.GetOwnerReferences() {
+		if ref.Kind == "StatefulSet" && ref.Name == functionName {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteOwnedResource deletes the named object of the resource when it is owned by
+// the StatefulSet of the function, an object that was created by someone else is
+// left as it is. Nothing is done when the resource is not installed or the
+// controller has no access to it.
+func DeleteOwnedResource(ctx context.Context, client dynamic.Interface, resource schema.GroupVersionResource, namespace, name, functionName string) error {
+	objects := client.Resource(resource).Namespace(namespace)
+
+	existing, err := objects.Get(ctx, name, metav1.GetOptions{})
+	if IsNotFound(err) || IsUnavailable(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !IsOwnedByStatefulSet(existing, functionName) {
+		return nil
+	}
+
+	if err := objects.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -45,8 +45,9 @@ func AsFunctionStatus(item appsv1.StatefulSet) *types.FunctionStatus {
 		function.Limits = lim
 	}
 
+	processEnv := ProcessEnvName(&item)
 	for _, v := range functionContainer.Env {
-		if EnvProcessName == v.Name {
+		if processEnv == v.Name {
 			function.EnvProcess = v.Value
 		}
 	}
@@ -0,0 +1,121 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// AnnotationTimeout is how long one invocation of the function may take, as a
+// duration such as "2m" or a number of seconds. It replaces the read timeout of
+// the provider for the invocations of the function.
+const AnnotationTimeout = "com.openfaas.timeout"
+
+// terminationGraceExtra is added to the timeout of a function for its termination
+// grace period, so that the watchdog can finish the invocations in progress
+const terminationGraceExtra = 5 * time.Second
+
+// FunctionTimeout returns the AnnotationTimeout of a function, it is zero when the
+// annotation is not set
+func FunctionTimeout(annotations map[string]string) (time.Duration, error) {
+	value, ok := annotations[AnnotationTimeout]
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, fmt.Errorf("invalid %s annotation: %q, must be a duration or a number of seconds", AnnotationTimeout, value)
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s annotation: %q, must be greater than zero", AnnotationTimeout, value)
+	}
+	return timeout, nil
+}
+
+// ConfigureTimeout applies the AnnotationTimeout to the function container, the
+// timeouts of the watchdog are set unless the function sets them itself, the
+// probes time out no later than an invocation and the termination grace period
+// lets the invocations in progress finish
+func (f *FunctionFactory) ConfigureTimeout(statefulset *appsv1.StatefulSet) {
+	spec := &statefulset.Spec.Template.Spec
+	if len(spec.Containers) == 0 {
+		return
+	}
+
+	// an invalid timeout is rejected when the function is deployed
+	timeout, err := FunctionTimeout(statefulset.Annotations)
+	if err != nil || timeout == 0 {
+		return
+	}
+
+	container := &spec.Containers[0]
+	for _, name := range f.Config.WatchdogEnv.timeouts() {
+		if !hasEnv(container.Env, name) {
+			container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: timeout.String()})
+		}
+	}
+
+	seconds := int32(math.Ceil(timeout.Seconds()))
+	for _, probe := range []*corev1.Probe{container.ReadinessProbe, container.LivenessProbe} {
+		if probe != nil && probe.TimeoutSeconds > seconds {
+			probe.TimeoutSeconds = seconds
+		}
+	}
+
+	grace := int64(math.Ceil((timeout + terminationGraceExtra).Seconds()))
+	if grace > corev1.DefaultTerminationGracePeriodSeconds {
+		spec.TerminationGracePeriodSeconds = &grace
+	}
+}
+
+func hasEnv(env []corev1.EnvVar, name string) bool {
+	for _, e := range env {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FunctionTimeouts reads the AnnotationTimeout of functions from the StatefulSets
+// in the informer's cache, for the invocation proxy
+type FunctionTimeouts struct {
+	DefaultNamespace string
+	StatefulSets     v1.StatefulSetLister
+}
+
+// NewFunctionTimeouts creates FunctionTimeouts
+func NewFunctionTimeouts(defaultNamespace string, statefulsets v1.StatefulSetLister) *FunctionTimeouts {
+	return &FunctionTimeouts{
+		DefaultNamespace: defaultNamespace,
+		StatefulSets:     statefulsets,
+	}
+}
+
+// Timeout returns the timeout of the function, which may be suffixed with its
+// namespace, it is zero when the function has no timeout of its own
+func (t *FunctionTimeouts) Timeout(name string) time.Duration {
+	namespace := getNamespace(name, t.DefaultNamespace)
+	statefulset, err := t.StatefulSets.StatefulSets(namespace).Get(strings.TrimSuffix(name, "."+namespace))
+	if err != nil {
+		return 0
+	}
+
+	timeout, _ := FunctionTimeout(statefulset.Annotations)
+	return timeout
+}
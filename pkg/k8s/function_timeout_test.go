@@ -0,0 +1,134 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_FunctionTimeout(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "2m", want: time.Minute * 2},
+		{value: "90", want: time.Second * 90},
+		{value: "0s", wantErr: true},
+		{value: "-5", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := FunctionTimeout(map[string]string{AnnotationTimeout: c.value})
+		if (err != nil) != c.wantErr {
+			t.Errorf("%q: want error: %t, got %v", c.value, c.wantErr, err)
+		}
+		if got != c.want {
+			t.Errorf("%q: want %s, got %s", c.value, c.want, got)
+		}
+	}
+
+	if got, err := FunctionTimeout(map[string]string{}); got != 0 || err != nil {
+		t.Errorf("want no timeout without the annotation, got %s, %v", got, err)
+	}
+}
+
+func Test_ConfigureTimeout(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationTimeout: "2m"}},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:           "figlet",
+						Env:            []corev1.EnvVar{{Name: "exec_timeout", Value: "30s"}},
+						ReadinessProbe: &corev1.Probe{TimeoutSeconds: 1},
+					}},
+				},
+			},
+		},
+	}
+
+	factory := FunctionFactory{}
+	factory.ConfigureTimeout(statefulset)
+
+	spec := statefulset.Spec.Template.Spec
+	want := map[string]string{"read_timeout": "2m0s", "write_timeout": "2m0s", "exec_timeout": "30s"}
+	for _, env := range spec.Containers[0].Env {
+		if want[env.Name] != env.Value {
+			t.Errorf("want %s=%s, got %s", env.Name, want[env.Name], env.Value)
+		}
+		delete(want, env.Name)
+	}
+	if len(want) != 0 {
+		t.Errorf("want the watchdog timeouts to be set, missing %v", want)
+	}
+
+	if spec.TerminationGracePeriodSeconds == nil || *spec.TerminationGracePeriodSeconds != 125 {
+		t.Errorf("want a grace period of 125s, got %v", spec.TerminationGracePeriodSeconds)
+	}
+	if spec.Containers[0].ReadinessProbe.TimeoutSeconds != 1 {
+		t.Errorf("want the probe timeout to be kept, got %d", spec.Containers[0].ReadinessProbe.TimeoutSeconds)
+	}
+}
+
+func Test_ConfigureTimeout_ShortTimeout(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationTimeout: "1500ms"}},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:          "figlet",
+						LivenessProbe: &corev1.Probe{TimeoutSeconds: 5},
+					}},
+				},
+			},
+		},
+	}
+
+	factory := FunctionFactory{}
+	factory.ConfigureTimeout(statefulset)
+
+	spec := statefulset.Spec.Template.Spec
+	if spec.Containers[0].LivenessProbe.TimeoutSeconds != 2 {
+		t.Errorf("want the probe to time out with the function, got %ds", spec.Containers[0].LivenessProbe.TimeoutSeconds)
+	}
+	if spec.TerminationGracePeriodSeconds != nil {
+		t.Errorf("want the default grace period, got %d", *spec.TerminationGracePeriodSeconds)
+	}
+}
+
+func Test_FunctionTimeouts(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name: "figlet", Namespace: "openfaas-fn", Annotations: map[string]string{AnnotationTimeout: "2m"},
+	}})
+	indexer.Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name: "figlet", Namespace: "staging-fn", Annotations: map[string]string{AnnotationTimeout: "30s"},
+	}})
+	indexer.Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "env", Namespace: "openfaas-fn"}})
+
+	timeouts := NewFunctionTimeouts("openfaas-fn", v1.NewStatefulSetLister(indexer))
+
+	cases := map[string]time.Duration{
+		"figlet":            time.Minute * 2,
+		"figlet.staging-fn": time.Second * 30,
+		"env":               0,
+		"missing":           0,
+	}
+	for name, want := range cases {
+		if got := timeouts.Timeout(name); got != want {
+			t.Errorf("%s: want %s, got %s", name, want, got)
+		}
+	}
+}
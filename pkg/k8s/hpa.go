@@ -0,0 +1,249 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// prometheusAnnotationPrefix is the prefix of the annotations that scale a
+	// function with a HorizontalPodAutoscaler on a metric from Prometheus
+	prometheusAnnotationPrefix = "com.openfaas.scale.prometheus."
+
+	// AnnotationPrometheusQuery is a PromQL series selector, such as
+	// gateway_function_invocation_started{function_name="figlet.openfaas-fn"}, it is
+	// read through the external metrics API of prometheus-adapter, which sums the
+	// series. An HPA is only created when it is set.
+	AnnotationPrometheusQuery = prometheusAnnotationPrefix + "query"
+
+	// AnnotationPrometheusTarget is the target value of the metric, a quantity such
+	// as 100 or 500m
+	AnnotationPrometheusTarget = prometheusAnnotationPrefix + "target"
+
+	// AnnotationPrometheusTargetType is AverageValue, the default, to divide the
+	// metric by the replicas before it is compared to the target, or Value
+	AnnotationPrometheusTargetType = prometheusAnnotationPrefix + "target-type"
+)
+
+var (
+	// seriesSelector matches a metric name with optional label matchers
+	seriesSelector = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(?:\{(.*)\})?\s*$`)
+
+	// labelMatcher matches one equality matcher of a series selector, only these
+	// can be sent to the external metrics API as a label selector
+	labelMatcher = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*"([^"]*)"\s*$`)
+)
+
+// parseSeriesSelector splits a PromQL series selector into the name of the
+// external metric and the labels of its selector
+func parseSeriesSelector(query string) (string, map[string]string, error) {
+	match := seriesSelector.FindStringSubmatch(query)
+	if match == nil {
+		return "", nil, fmt.Errorf("invalid value for %s: %q must be a series selector such as metric{label=\"value\"}", AnnotationPrometheusQuery, query)
+	}
+
+	var labels map[string]string
+	for _, matcher := range strings.Split(match[2], ",") {
+		if strings.TrimSpace(matcher) == "" {
+			continue
+		}
+		label := labelMatcher.FindStringSubmatch(matcher)
+		if label == nil {
+			return "", nil, fmt.Errorf("invalid value for %s: %q, only label=\"value\" matchers are supported", AnnotationPrometheusQuery, strings.TrimSpace(matcher))
+		}
+		if errs := validation.IsQualifiedName(label[1]); len(errs) > 0 {
+			return "", nil, fmt.Errorf("invalid value for %s: label %q: %s", AnnotationPrometheusQuery, label[1], strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(label[2]); len(errs) > 0 {
+			return "", nil, fmt.Errorf("invalid value for %s: value %q: %s", AnnotationPrometheusQuery, label[2], strings.Join(errs, ", "))
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[label[1]] = label[2]
+	}
+
+	return match[1], labels, nil
+}
+
+// MakeHPA creates the HorizontalPodAutoscaler for the StatefulSet of a function from
+// its com.openfaas.scale.prometheus.* annotations, nil is returned when the function
+// does not set a query. The min and max replicas are read from the
+// LabelMinReplicas and LabelMaxReplicas labels. The owner is set by the caller.
+func MakeHPA(name, namespace string, annotations, labels map[string]string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	query := annotations[AnnotationPrometheusQuery]
+	if query == "" {
+		return nil, nil
+	}
+	if _, ok := annotations[AnnotationKedaType]; ok {
+		return nil, fmt.Errorf("%s can not be used with %s, KEDA creates its own HPA", AnnotationPrometheusQuery, AnnotationKedaType)
+	}
+
+	metricName, selectorLabels, err := parseSeriesSelector(query)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := annotations[AnnotationPrometheusTarget]
+	if !ok {
+		return nil, fmt.Errorf("%s is required with %s", AnnotationPrometheusTarget, AnnotationPrometheusQuery)
+	}
+	target, err := resource.ParseQuantity(value)
+	if err != nil || target.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid value for %s: %q must be a quantity greater than zero", AnnotationPrometheusTarget, value)
+	}
+
+	metricTarget := autoscalingv2.MetricTarget{}
+	switch targetType := autoscalingv2.MetricTargetType(annotations[AnnotationPrometheusTargetType]); targetType {
+	case "", autoscalingv2.AverageValueMetricType:
+		metricTarget.Type = autoscalingv2.AverageValueMetricType
+		metricTarget.AverageValue = &target
+	case autoscalingv2.ValueMetricType:
+		metricTarget.Type = autoscalingv2.ValueMetricType
+		metricTarget.Value = &target
+	default:
+		return nil, fmt.Errorf("invalid value for %s: %q, use %s or %s", AnnotationPrometheusTargetType, targetType,
+			autoscalingv2.AverageValueMetricType, autoscalingv2.ValueMetricType)
+	}
+
+	minReplicas, maxReplicas := int32(1), int32(DefaultMaxReplicas)
+	for _, f := range []struct {
+		key   string
+		value *int32
+	}{
+		{LabelMinReplicas, &minReplicas},
+		{LabelMaxReplicas, &maxReplicas},
+	} {
+		value, ok := labels[f.key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid value for %s: %q must be at least 1 for an HPA", f.key, value)
+		}
+		*f.value = int32(n)
+	}
+	if maxReplicas < minReplicas {
+		return nil, fmt.Errorf("invalid value for %s: %d is less than %s", LabelMaxReplicas, maxReplicas, LabelMinReplicas)
+	}
+
+	metric := autoscalingv2.MetricIdentifier{Name: metricName}
+	if selectorLabels != nil {
+		metric.Selector = &metav1.LabelSelector{MatchLabels: selectorLabels}
+	}
+
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"faas_function": name},
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "StatefulSet",
+				Name:       name,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: maxReplicas,
+			Metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ExternalMetricSourceType,
+				External: &autoscalingv2.ExternalMetricSource{
+					Metric: metric,
+					Target: metricTarget,
+				},
+			}},
+		},
+	}, nil
+}
+
+// SyncHPA creates or updates the HorizontalPodAutoscaler of a function, or removes
+// it when the function no longer sets a query. Only an HPA that is owned by the
+// StatefulSet of the function is changed or removed, the labels are added to it.
+func SyncHPA(ctx context.Context, clientset kubernetes.Interface, functionName, namespace string, annotations, functionLabels map[string]string, owner metav1.OwnerReference, labels map[string]string) error {
+	desired, err := MakeHPA(functionName, namespace, annotations, functionLabels)
+	if err != nil {
+		return err
+	}
+
+	hpas := clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace)
+
+	existing, err := hpas.Get(ctx, functionName, metav1.GetOptions{})
+	if IsNotFound(err) || (desired == nil && IsUnavailable(err)) {
+		existing = nil
+	} else if err != nil {
+		return err
+	}
+
+	if existing != nil && !IsOwnedByStatefulSet(existing, functionName) {
+		if desired != nil {
+			return fmt.Errorf("HorizontalPodAutoscaler %s already exists and is not managed by the function", functionName)
+		}
+		return nil
+	}
+
+	if desired == nil {
+		if existing == nil {
+			return nil
+		}
+		if err := hpas.Delete(ctx, functionName, metav1.DeleteOptions{}); err != nil && !IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	desired.OwnerReferences = []metav1.OwnerReference{owner}
+	AddLabels(desired, labels)
+
+	if existing == nil {
+		_, err := hpas.Create(ctx, desired, metav1.CreateOptions{FieldManager: FieldManager})
+		return err
+	}
+
+	if equality.Semantic.DeepDerivative(desired.Spec, existing.Spec) &&
+		equality.Semantic.DeepEqual(desired.Labels, existing.Labels) {
+		return nil
+	}
+
+	existing = existing.DeepCopy()
+	existing.Spec = desired.Spec
+	existing.Labels = desired.Labels
+	_, err = hpas.Update(ctx, existing, metav1.UpdateOptions{FieldManager: FieldManager})
+	return err
+}
+
+// DeleteHPA removes the HorizontalPodAutoscaler of a function when it is owned by
+// its StatefulSet
+func DeleteHPA(ctx context.Context, clientset kubernetes.Interface, namespace, functionName string) error {
+	hpas := clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace)
+
+	existing, err := hpas.Get(ctx, functionName, metav1.GetOptions{})
+	if IsNotFound(err) || IsUnavailable(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !IsOwnedByStatefulSet(existing, functionName) {
+		return nil
+	}
+
+	if err := hpas.Delete(ctx, functionName, metav1.DeleteOptions{}); err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_parseSeriesSelector(t *testing.T) {
+	name, labels, err := parseSeriesSelector(`gateway_function_invocation_started{function_name="figlet.openfaas-fn", code="200"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if name != "gateway_function_invocation_started" || labels["function_name"] != "figlet.openfaas-fn" || labels["code"] != "200" {
+		t.Errorf("want the metric and its two labels, got %s %v", name, labels)
+	}
+
+	if _, _, err := parseSeriesSelector(`gateway_function_invocation_started{code=~"5.."}`); err == nil {
+		t.Errorf("want an error for a regular expression matcher")
+	}
+}
+
+func Test_SyncHPA_CreatesAndRemovesHPA(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+	clientset := fake.NewSimpleClientset()
+	annotations := map[string]string{
+		AnnotationPrometheusQuery:  `gateway_function_invocation_started{function_name="figlet.openfaas-fn"}`,
+		AnnotationPrometheusTarget: "50",
+	}
+
+	err := SyncHPA(context.Background(), clientset, "figlet", "openfaas-fn", annotations,
+		map[string]string{LabelMaxReplicas: "10"}, owner, map[string]string{"team": "payments"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	hpa, err := clientset.AutoscalingV2().HorizontalPodAutoscalers("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want the HPA to be created: %s", err)
+	}
+	if hpa.Spec.MaxReplicas != 10 || !IsOwnedByStatefulSet(hpa, "figlet") || hpa.Labels["team"] != "payments" {
+		t.Errorf("want an HPA with 10 replicas owned by the StatefulSet, got %+v", hpa.ObjectMeta)
+	}
+
+	if err := SyncHPA(context.Background(), clientset, "figlet", "openfaas-fn", map[string]string{}, nil, owner, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := clientset.AutoscalingV2().HorizontalPodAutoscalers("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{}); err == nil {
+		t.Errorf("want the HPA to be removed when the function no longer sets a query")
+	}
+}
+
+func Test_SyncHPA_KeepsUnmanagedHPA(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+	clientset := fake.NewSimpleClientset(&autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+	})
+	annotations := map[string]string{
+		AnnotationPrometheusQuery:  "gateway_function_invocation_started",
+		AnnotationPrometheusTarget: "50",
+	}
+
+	if err := SyncHPA(context.Background(), clientset, "figlet", "openfaas-fn", annotations, nil, owner, nil); err == nil {
+		t.Errorf("want an error when an HPA of the same name is not managed by the function")
+	}
+
+	if err := DeleteHPA(context.Background(), clientset, "openfaas-fn", "figlet"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := clientset.AutoscalingV2().HorizontalPodAutoscalers("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{}); err != nil {
+		t.Errorf("want an HPA that is not owned by the function to be kept, got: %s", err)
+	}
+}
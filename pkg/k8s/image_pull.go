@@ -0,0 +1,90 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// imagePullReasons are the reasons of a waiting container whose image could not
+// be pulled
+var imagePullReasons = map[string]bool{
+	"ErrImagePull":        true,
+	"ImagePullBackOff":    true,
+	"InvalidImageName":    true,
+	"ErrImageNeverPull":   true,
+	"ErrImageInspect":     true,
+	"RegistryUnavailable": true,
+}
+
+// ImagePullError is an image that could not be pulled for a container of the
+// function's Pods, such as a tag that does not exist in the registry
+type ImagePullError struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	// Reason is ErrImagePull, ImagePullBackOff or InvalidImageName for example
+	Reason string `json:"reason"`
+	// Message is the error of the kubelet, with the error of the registry for
+	// ErrImagePull
+	Message string `json:"message,omitempty"`
+	// Pods is the count of Pods that report the error
+	Pods int32 `json:"pods"`
+}
+
+// GetImagePullErrors returns the containers of the Pods that are waiting for
+// an image that could not be pulled, the same error of several Pods is reported
+// once
+func GetImagePullErrors(pods []*corev1.Pod) []ImagePullError {
+	index := map[ImagePullError]int{}
+	var pullErrors []ImagePullError
+
+	for _, pod := range pods {
+		for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+			for _, status := range statuses {
+				if status.State.Waiting == nil || !imagePullReasons[status.State.Waiting.Reason] {
+					continue
+				}
+
+				key := ImagePullError{
+					Container: status.Name,
+					Image:     status.Image,
+					Reason:    status.State.Waiting.Reason,
+					Message:   status.State.Waiting.Message,
+				}
+				if i, ok := index[key]; ok {
+					pullErrors[i].Pods++
+					continue
+				}
+				index[key] = len(pullErrors)
+				key.Pods = 1
+				pullErrors = append(pullErrors, key)
+			}
+		}
+	}
+
+	sort.SliceStable(pullErrors, func(i, j int) bool {
+		return pullErrors[i].Container < pullErrors[j].Container
+	})
+	return pullErrors
+}
+
+// IsImagePullEvent is true for a Warning Event of the kubelet about an image of a
+// Pod that could not be pulled. The repeated back-off Events are left out, the
+// Event of the failed pull has the error of the registry.
+func IsImagePullEvent(event *corev1.Event) bool {
+	if event.Type != corev1.EventTypeWarning || event.InvolvedObject.Kind != "Pod" {
+		return false
+	}
+
+	switch event.Reason {
+	case "Failed":
+		return strings.HasPrefix(event.Message, "Failed to pull image")
+	case "InspectFailed", "ErrImageNeverPull":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newWaitingPod(container, image, reason, message string) *corev1.Pod {
+	return &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  container,
+				Image: image,
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}},
+			}},
+		},
+	}
+}
+
+func Test_GetImagePullErrors(t *testing.T) {
+	pods := []*corev1.Pod{
+		newWaitingPod("figlet", "functions/figlet:0.99", "ErrImagePull", "rpc error: code = NotFound desc = not found"),
+		newWaitingPod("figlet", "functions/figlet:0.99", "ErrImagePull", "rpc error: code = NotFound desc = not found"),
+		newWaitingPod("figlet", "functions/figlet:0.99", "ImagePullBackOff", `Back-off pulling image "functions/figlet:0.99"`),
+		newWaitingPod("figlet", "functions/figlet:0.99", "ContainerCreating", ""),
+		{Status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "init",
+			Image: "busybox:::",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "InvalidImageName"}},
+		}}}},
+	}
+
+	want := []ImagePullError{
+		{Container: "figlet", Image: "functions/figlet:0.99", Reason: "ErrImagePull", Message: "rpc error: code = NotFound desc = not found", Pods: 2},
+		{Container: "figlet", Image: "functions/figlet:0.99", Reason: "ImagePullBackOff", Message: `Back-off pulling image "functions/figlet:0.99"`, Pods: 1},
+		{Container: "init", Image: "busybox:::", Reason: "InvalidImageName", Pods: 1},
+	}
+	if got := GetImagePullErrors(pods); !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v\ngot: %+v", want, got)
+	}
+}
+
+func Test_GetImagePullErrors_None(t *testing.T) {
+	pods := []*corev1.Pod{newWaitingPod("figlet", "functions/figlet:latest", "CrashLoopBackOff", "")}
+
+	if got := GetImagePullErrors(pods); got != nil {
+		t.Errorf("want no errors, got: %+v", got)
+	}
+}
+
+func Test_IsImagePullEvent(t *testing.T) {
+	cases := []struct {
+		name  string
+		event corev1.Event
+		want  bool
+	}{
+		{
+			name:  "failed pull",
+			event: corev1.Event{Type: corev1.EventTypeWarning, Reason: "Failed", Message: `Failed to pull image "functions/figlet:0.99": not found`},
+			want:  true,
+		},
+		{
+			name:  "invalid image name",
+			event: corev1.Event{Type: corev1.EventTypeWarning, Reason: "InspectFailed", Message: `Failed to apply default image tag "busybox:::"`},
+			want:  true,
+		},
+		{
+			name:  "back-off",
+			event: corev1.Event{Type: corev1.EventTypeWarning, Reason: "BackOff", Message: `Back-off pulling image "functions/figlet:0.99"`},
+		},
+		{
+			name:  "other failure",
+			event: corev1.Event{Type: corev1.EventTypeWarning, Reason: "Failed", Message: "Error: ErrImagePull"},
+		},
+		{
+			name:  "normal event",
+			event: corev1.Event{Type: corev1.EventTypeNormal, Reason: "Pulled", Message: `Successfully pulled image "functions/figlet:latest"`},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.event.InvolvedObject = corev1.ObjectReference{Kind: "Pod", Name: "figlet-0"}
+			if got := IsImagePullEvent(&c.event); got != c.want {
+				t.Errorf("want %t, got %t", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import "sync"
+
+// LiveSettings are the settings of the DeploymentConfig that can be changed while
+// the provider is running, they are used for the functions deployed or updated
+// after the change
+type LiveSettings struct {
+	HTTPProbe      bool
+	ReadinessProbe ProbeConfig
+	LivenessProbe  ProbeConfig
+	SetNonRootUser bool
+}
+
+// LiveConfig holds the LiveSettings that were loaded last, it is shared by each
+// copy of the DeploymentConfig
+type LiveConfig struct {
+	lock     sync.RWMutex
+	settings LiveSettings
+}
+
+// NewLiveConfig returns a LiveConfig with the initial settings
+func NewLiveConfig(settings LiveSettings) *LiveConfig {
+	return &LiveConfig{settings: settings}
+}
+
+// Load returns the settings that were stored last
+func (c *LiveConfig) Load() LiveSettings {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.settings
+}
+
+// Store replaces the settings
+func (c *LiveConfig) Store(settings LiveSettings) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.settings = settings
+}
+
+// Current returns a copy of the config with the LiveSettings that were stored last,
+// or the config itself when it has no LiveConfig
+func (c DeploymentConfig) Current() DeploymentConfig {
+	if c.Live == nil {
+		return c
+	}
+
+	settings := c.Live.Load()
+	c.HTTPProbe = settings.HTTPProbe
+	c.ReadinessProbe = &settings.ReadinessProbe
+	c.LivenessProbe = &settings.LivenessProbe
+	c.SetNonRootUser = settings.SetNonRootUser
+	return c
+}
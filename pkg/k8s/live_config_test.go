@@ -0,0 +1,34 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+)
+
+func Test_MakeProbes_UsesReloadedSettings(t *testing.T) {
+	f := mockFactory()
+	f.Config.Live = NewLiveConfig(LiveSettings{
+		ReadinessProbe: ProbeConfig{PeriodSeconds: 2, TimeoutSeconds: 1},
+		LivenessProbe:  ProbeConfig{PeriodSeconds: 2, TimeoutSeconds: 1},
+	})
+
+	// a copy of the factory shares the settings
+	handlerFactory := f
+	f.Config.Live.Store(LiveSettings{
+		HTTPProbe:      true,
+		ReadinessProbe: ProbeConfig{PeriodSeconds: 5, TimeoutSeconds: 3},
+		LivenessProbe:  ProbeConfig{PeriodSeconds: 10, TimeoutSeconds: 3},
+	})
+
+	probes, err := handlerFactory.MakeProbes(types.FunctionDeployment{Service: "testfunc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probes.Readiness.HTTPGet == nil || probes.Readiness.PeriodSeconds != 5 || probes.Liveness.PeriodSeconds != 10 {
+		t.Errorf("want the reloaded probes, got readiness %+v and liveness %+v", probes.Readiness, probes.Liveness)
+	}
+}
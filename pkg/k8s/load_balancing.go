@@ -0,0 +1,187 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AnnotationLoadBalancing selects how the invocations of a function are spread
+	// over its ready endpoints, one of the LoadBalancing strategies
+	AnnotationLoadBalancing = "com.openfaas.load-balancing"
+
+	// AffinityKeyHeader is the header with the key of the ordinal-affinity
+	// strategy, the invocations with the same key go to the same replica
+	AffinityKeyHeader = "X-Affinity-Key"
+
+	// LoadBalancingRandom picks a ready endpoint at random
+	LoadBalancingRandom = "random"
+	// LoadBalancingRoundRobin picks each ready endpoint in turn
+	LoadBalancingRoundRobin = "round-robin"
+	// LoadBalancingLeastConnections picks the ready endpoint with the fewest
+	// invocations in progress through this provider
+	LoadBalancingLeastConnections = "least-connections"
+	// LoadBalancingOrdinalAffinity picks the replica whose StatefulSet ordinal
+	// matches the hash of the AffinityKeyHeader, or the next ready one
+	LoadBalancingOrdinalAffinity = "ordinal-affinity"
+)
+
+// ValidateLoadBalancing checks the name of a load-balancing strategy
+func ValidateLoadBalancing(strategy string) error {
+	switch strategy {
+	case LoadBalancingRandom, LoadBalancingRoundRobin, LoadBalancingLeastConnections, LoadBalancingOrdinalAffinity:
+		return nil
+	}
+	return fmt.Errorf("invalid load-balancing strategy: %q, must be one of %s, %s, %s or %s", strategy,
+		LoadBalancingRandom, LoadBalancingRoundRobin, LoadBalancingLeastConnections, LoadBalancingOrdinalAffinity)
+}
+
+type affinityKey struct{}
+
+// WithAffinityKey returns a copy of ctx with the key of the ordinal-affinity
+// strategy
+func WithAffinityKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, affinityKey{}, key)
+}
+
+// endpoint is a ready endpoint of a function
+type endpoint struct {
+	host string
+	// ordinal of the StatefulSet Pod behind the endpoint, -1 when it is not known
+	ordinal int
+}
+
+// podOrdinal returns the ordinal of a StatefulSet Pod from its name, such as 2
+// for figlet-2
+func podOrdinal(name string) int {
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return -1
+	}
+	ordinal, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return -1
+	}
+	return ordinal
+}
+
+// strategy returns the load-balancing strategy of the function from the
+// annotations of its StatefulSet, or the DefaultLoadBalancing
+func (l *FunctionLookup) strategy(namespace, name string) (string, int) {
+	strategy := l.DefaultLoadBalancing
+	replicas := 0
+	if l.StatefulSets != nil {
+		if statefulset, err := l.StatefulSets.StatefulSets(namespace).Get(name); err == nil {
+			if value, ok := statefulset.Annotations[AnnotationLoadBalancing]; ok {
+				strategy = value
+			}
+			if statefulset.Spec.Replicas != nil {
+				replicas = int(*statefulset.Spec.Replicas)
+			}
+		}
+	}
+	return strategy, replicas
+}
+
+// pick chooses one of the ready endpoints of a function with its strategy, the
+// endpoints are sorted by host
+func (l *FunctionLookup) pick(ctx context.Context, namespace, name string, endpoints []endpoint) endpoint {
+	strategy, replicas := l.strategy(namespace, name)
+
+	switch strategy {
+	case LoadBalancingRoundRobin:
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		if l.next == nil {
+			l.next = map[string]int{}
+		}
+		key := namespace + "/" + name
+		next := l.next[key] % len(endpoints)
+		l.next[key] = next + 1
+		return endpoints[next]
+
+	case LoadBalancingLeastConnections:
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		// start at a random endpoint so that ties are spread
+		offset := rand.Intn(len(endpoints))
+		least := endpoints[offset]
+		for i := 1; i < len(endpoints); i++ {
+			candidate := endpoints[(offset+i)%len(endpoints)]
+			if l.inFlight[candidate.host] < l.inFlight[least.host] {
+				least = candidate
+			}
+		}
+		return least
+
+	case LoadBalancingOrdinalAffinity:
+		if key, ok := ctx.Value(affinityKey{}).(string); ok {
+			if e, ok := byOrdinal(key, replicas, endpoints); ok {
+				return e
+			}
+		}
+	}
+
+	return endpoints[rand.Intn(len(endpoints))]
+}
+
+// byOrdinal returns the endpoint of the ordinal for the key, or of the next ready
+// ordinal, so that a key only moves while its replica is not ready
+func byOrdinal(key string, replicas int, endpoints []endpoint) (endpoint, bool) {
+	ordinals := map[int]endpoint{}
+	for _, e := range endpoints {
+		if e.ordinal >= 0 {
+			ordinals[e.ordinal] = e
+			if e.ordinal >= replicas {
+				replicas = e.ordinal + 1
+			}
+		}
+	}
+	if len(ordinals) == 0 {
+		return endpoint{}, false
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	ordinal := int(h.Sum32() % uint32(replicas))
+	for i := 0; i < replicas; i++ {
+		if e, ok := ordinals[(ordinal+i)%replicas]; ok {
+			return e, true
+		}
+	}
+	return endpoint{}, false
+}
+
+// Started records an invocation in progress to the host, for the
+// least-connections strategy
+func (l *FunctionLookup) Started(host string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.inFlight == nil {
+		l.inFlight = map[string]int{}
+	}
+	l.inFlight[host]++
+}
+
+// Finished records the end of an invocation to the host
+func (l *FunctionLookup) Finished(host string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.inFlight[host] <= 1 {
+		delete(l.inFlight, host)
+		return
+	}
+	l.inFlight[host]--
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newBalancedLookup resolves figlet to 3 replicas with the strategy
+func newBalancedLookup(strategy string, ready ...bool) *FunctionLookup {
+	slice := newTestEndpointSlice("openfaas-fn", "figlet", nil)
+	for i, r := range ready {
+		r := r
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{fmt.Sprintf("10.0.0.%d", i+1)},
+			Conditions: discoveryv1.EndpointConditions{Ready: &r},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: fmt.Sprintf("figlet-%d", i)},
+		})
+	}
+	endpointSlices := cache.NewIndexer(cache.MetaNamespaceKeyFunc, EndpointSliceIndexers)
+	endpointSlices.Add(slice)
+
+	replicas := int32(len(ready))
+	statefulsets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	statefulsets.Add(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "figlet",
+			Namespace:   "openfaas-fn",
+			Annotations: map[string]string{AnnotationLoadBalancing: strategy},
+		},
+		Spec: appsv1.StatefulSetSpec{Replicas: &replicas},
+	})
+
+	lookup := NewFunctionLookup("openfaas-fn", endpointSlices)
+	lookup.StatefulSets = v1.NewStatefulSetLister(statefulsets)
+	lookup.DefaultLoadBalancing = LoadBalancingRandom
+	return lookup
+}
+
+func Test_FunctionLookup_RoundRobin(t *testing.T) {
+	lookup := newBalancedLookup(LoadBalancingRoundRobin, true, true, true)
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		u, err := lookup.Resolve("figlet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, u.Host)
+	}
+
+	want := []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080", "10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func Test_FunctionLookup_LeastConnections(t *testing.T) {
+	lookup := newBalancedLookup(LoadBalancingLeastConnections, true, true, true)
+	lookup.Started("10.0.0.1:8080")
+	lookup.Started("10.0.0.3:8080")
+	lookup.Started("10.0.0.3:8080")
+
+	for i := 0; i < 10; i++ {
+		u, err := lookup.Resolve("figlet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Host != "10.0.0.2:8080" {
+			t.Fatalf("want the endpoint without invocations, got %s", u.Host)
+		}
+	}
+
+	lookup.Finished("10.0.0.1:8080")
+	lookup.Started("10.0.0.2:8080")
+	lookup.Started("10.0.0.2:8080")
+	if u, _ := lookup.Resolve("figlet"); u.Host != "10.0.0.1:8080" {
+		t.Errorf("want the endpoint whose invocation finished, got %s", u.Host)
+	}
+}
+
+func Test_FunctionLookup_OrdinalAffinity(t *testing.T) {
+	lookup := newBalancedLookup(LoadBalancingOrdinalAffinity, true, true, true)
+	ctx := WithAffinityKey(context.Background(), "customer-42")
+
+	first, err := lookup.ResolveContext(ctx, "figlet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if u, _ := lookup.ResolveContext(ctx, "figlet"); u.Host != first.Host {
+			t.Fatalf("want each invocation with the key on %s, got %s", first.Host, u.Host)
+		}
+	}
+
+	// the key moves to the next ordinal while its replica is not ready
+	ready := []bool{true, true, true}
+	for i := range ready {
+		if fmt.Sprintf("10.0.0.%d:8080", i+1) == first.Host {
+			ready[i] = false
+		}
+	}
+	lookup = newBalancedLookup(LoadBalancingOrdinalAffinity, ready...)
+	moved, err := lookup.ResolveContext(ctx, "figlet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Host == first.Host {
+		t.Errorf("want another replica while %s is not ready", first.Host)
+	}
+}
+
+func Test_ValidateLoadBalancing(t *testing.T) {
+	for _, strategy := range []string{LoadBalancingRandom, LoadBalancingRoundRobin, LoadBalancingLeastConnections, LoadBalancingOrdinalAffinity} {
+		if err := ValidateLoadBalancing(strategy); err != nil {
+			t.Errorf("%s: unexpected error: %s", strategy, err)
+		}
+	}
+	if err := ValidateLoadBalancing("sticky"); err == nil {
+		t.Error("want an error for an unknown strategy")
+	}
+}
+
+func Test_podOrdinal(t *testing.T) {
+	cases := map[string]int{"figlet-0": 0, "nodeinfo-http-12": 12, "figlet": -1, "figlet-abc": -1}
+	for name, want := range cases {
+		if got := podOrdinal(name); got != want {
+			t.Errorf("%s: want %d, got %d", name, want, got)
+		}
+	}
+}
@@ -5,9 +5,9 @@ package k8s
 
 import (
 	"context"
-	"log"
 	"strings"
 
+	"github.com/openfaas/faas-netes/pkg/logging"
 	"github.com/openfaas/faas-provider/logs"
 	"k8s.io/client-go/kubernetes"
 )
@@ -38,7 +38,7 @@ func (l LogRequestor) Query(ctx context.Context, r logs.Request) (<-chan logs.Me
 
 	logStream, err := GetLogs(ctx, l.client, r.Name, ns, int64(r.Tail), r.Since, r.Follow)
 	if err != nil {
-		log.Printf("LogRequestor: get logs failed: %s\n", err)
+		logging.FromContext(ctx).Error(err, "LogRequestor: get logs failed", "function", r.Name, "namespace", ns)
 		return nil, err
 	}
 
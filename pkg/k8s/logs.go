@@ -5,10 +5,11 @@ import (
 	"bytes"
 	"context"
 	"io"
-	"log"
 	"strings"
 	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/openfaas/faas-netes/pkg/logging"
 	"github.com/pkg/errors"
 	"k8s.io/client-go/informers/internalinterfaces"
 
@@ -90,8 +91,9 @@ func GetLogs(ctx context.Context, client kubernetes.Interface, functionName, nam
 
 // podLogs returns a stream of logs lines from the specified pod
 func podLogs(ctx context.Context, i v1.PodInterface, pod, container, namespace string, tail int64, since *time.Time, follow bool, dst chan<- Log) error {
-	log.Printf("Logger: starting log stream for %s\n", pod)
-	defer log.Printf("Logger: stopping log stream for %s\n", pod)
+	logger := logging.FromContext(ctx).WithValues("function", container, "namespace", namespace, "pod", pod)
+	logger.Info("Starting log stream")
+	defer logger.Info("Stopping log stream")
 
 	opts := &corev1.PodLogOptions{
 		Follow:     follow,
@@ -143,7 +145,7 @@ func extractTimestampAndMsg(logText string) (string, time.Time) {
 	parts := strings.SplitN(logText, " ", 2)
 	ts, err := time.Parse(time.RFC3339Nano, parts[0])
 	if err != nil {
-		log.Printf("error: invalid timestamp '%s'\n", parts[0])
+		logging.Default().V(2).Info("Invalid timestamp in log line", "timestamp", parts[0])
 		return "", time.Time{}
 	}
 
@@ -168,17 +170,19 @@ func parseSince(r *time.Time) *int64 {
 // startFunctionPodInformer will gather the list of existing Pods for the function, it will then watch
 // and watch for newly added or deleted function instances.
 func startFunctionPodInformer(ctx context.Context, client kubernetes.Interface, functionName, namespace string) (<-chan string, error) {
+	logger := logging.FromContext(ctx).WithValues("function", functionName, "namespace", namespace)
+
 	functionSelector := &metav1.LabelSelector{
 		MatchLabels: map[string]string{"faas_function": functionName},
 	}
 	selector, err := metav1.LabelSelectorAsSelector(functionSelector)
 	if err != nil {
 		err = errors.Wrap(err, "unable to build function selector")
-		log.Printf("PodInformer: %s", err)
+		logger.Error(err, "PodInformer failed")
 		return nil, err
 	}
 
-	log.Printf("PodInformer: starting informer for %s in: %s\n", selector.String(), namespace)
+	logger.Info("PodInformer: starting informer", "selector", selector.String())
 	factory := informers.NewFilteredSharedInformerFactory(
 		client,
 		podInformerResync,
@@ -189,21 +193,22 @@ func startFunctionPodInformer(ctx context.Context, client kubernetes.Interface,
 	podInformer := factory.Core().V1().Pods()
 	podsResp, err := client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
 	if err != nil {
-		log.Printf("PodInformer: %s", err)
+		logger.Error(err, "PodInformer failed")
 		return nil, err
 	}
 
 	pods := podsResp.Items
 	if len(pods) == 0 {
 		err = errors.New("no matching instances found")
-		log.Printf("PodInformer: %s", err)
+		logger.Info("PodInformer: no matching instances found")
 		return nil, err
 	}
 
 	// prepare channel with enough space for the current instance set
 	added := make(chan string, len(pods))
 	podInformer.Informer().AddEventHandler(&podLoggerEventHandler{
-		added: added,
+		added:  added,
+		logger: logger,
 	})
 
 	// will add existing pods to the chan and then listen for any new pods
@@ -226,11 +231,12 @@ type podLoggerEventHandler struct {
 	cache.ResourceEventHandler
 	added   chan<- string
 	deleted chan<- string
+	logger  logr.Logger
 }
 
 func (h *podLoggerEventHandler) OnAdd(obj interface{}, isInInitialList bool) {
 	pod := obj.(*corev1.Pod)
-	log.Printf("PodInformer: adding instance: %s", pod.Name)
+	h.logger.Info("PodInformer: adding instance", "pod", pod.Name)
 	h.added <- pod.Name
 }
 
@@ -0,0 +1,147 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1apply "k8s.io/client-go/applyconfigurations/apps/v1"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+const (
+	// AnnotationMaintenance puts a function into maintenance when it is "true", its
+	// invocations are answered by the provider without reaching the function
+	AnnotationMaintenance = "com.openfaas.maintenance"
+	// AnnotationMaintenanceStatus is the status code of the answer, 503 by default
+	AnnotationMaintenanceStatus = "com.openfaas.maintenance.status"
+	// AnnotationMaintenanceRetryAfter is sent as the Retry-After header, as a
+	// duration or a number of seconds
+	AnnotationMaintenanceRetryAfter = "com.openfaas.maintenance.retry-after"
+	// AnnotationMaintenanceBody is the static body of the answer
+	AnnotationMaintenanceBody = "com.openfaas.maintenance.body"
+	// AnnotationMaintenanceContentType is the Content-Type of the body, text/plain
+	// by default
+	AnnotationMaintenanceContentType = "com.openfaas.maintenance.content-type"
+)
+
+// Maintenance is the answer to the invocations of a function in maintenance
+type Maintenance struct {
+	StatusCode  int
+	RetryAfter  time.Duration
+	Body        string
+	ContentType string
+}
+
+// ParseMaintenance returns the Maintenance of a function from its annotations, it
+// is nil when the function is not in maintenance
+func ParseMaintenance(annotations map[string]string) (*Maintenance, error) {
+	if value, ok := annotations[AnnotationMaintenance]; !ok || value == "false" {
+		return nil, nil
+	} else if value != "true" {
+		return nil, fmt.Errorf("invalid %s annotation: %q, must be true or false", AnnotationMaintenance, value)
+	}
+
+	m := &Maintenance{
+		StatusCode:  http.StatusServiceUnavailable,
+		Body:        annotations[AnnotationMaintenanceBody],
+		ContentType: annotations[AnnotationMaintenanceContentType],
+	}
+
+	if value, ok := annotations[AnnotationMaintenanceStatus]; ok {
+		code, err := strconv.Atoi(value)
+		if err != nil || code < 200 || code > 599 {
+			return nil, fmt.Errorf("invalid %s annotation: %q, must be a status code", AnnotationMaintenanceStatus, value)
+		}
+		m.StatusCode = code
+	}
+
+	if value, ok := annotations[AnnotationMaintenanceRetryAfter]; ok {
+		retryAfter, err := time.ParseDuration(value)
+		if err != nil {
+			seconds, convErr := strconv.Atoi(value)
+			if convErr != nil {
+				return nil, fmt.Errorf("invalid %s annotation: %q, must be a duration or a number of seconds", AnnotationMaintenanceRetryAfter, value)
+			}
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		if retryAfter < 0 {
+			return nil, fmt.Errorf("invalid %s annotation: %q, must not be negative", AnnotationMaintenanceRetryAfter, value)
+		}
+		m.RetryAfter = retryAfter
+	}
+
+	return m, nil
+}
+
+// Annotations returns the annotations that put a function into this maintenance
+func (m Maintenance) Annotations() map[string]string {
+	annotations := map[string]string{AnnotationMaintenance: "true"}
+	if m.StatusCode != 0 {
+		annotations[AnnotationMaintenanceStatus] = strconv.Itoa(m.StatusCode)
+	}
+	if m.RetryAfter > 0 {
+		annotations[AnnotationMaintenanceRetryAfter] = m.RetryAfter.String()
+	}
+	if m.Body != "" {
+		annotations[AnnotationMaintenanceBody] = m.Body
+	}
+	if m.ContentType != "" {
+		annotations[AnnotationMaintenanceContentType] = m.ContentType
+	}
+	return annotations
+}
+
+// ApplyMaintenance puts the function into maintenance, or takes it out when m is
+// nil. The annotations are applied to the StatefulSet by their own field manager,
+// so the Pods are not restarted and an update of the function keeps them. Taking
+// the function out sets AnnotationMaintenance to "false", which also overrides
+// the annotation when it was deployed with the function.
+func ApplyMaintenance(ctx context.Context, client kubernetes.Interface, namespace, name string, m *Maintenance) error {
+	annotations := map[string]string{AnnotationMaintenance: "false"}
+	if m != nil {
+		annotations = m.Annotations()
+	}
+	applyConfig := appsv1apply.StatefulSet(name, namespace).WithAnnotations(annotations)
+
+	_, err := client.AppsV1().StatefulSets(namespace).
+		Apply(ctx, applyConfig, metav1.ApplyOptions{FieldManager: MaintenanceFieldManager, Force: true})
+	return err
+}
+
+// FunctionMaintenance reads the Maintenance of functions from the StatefulSets in
+// the informer's cache, for the invocation proxy
+type FunctionMaintenance struct {
+	DefaultNamespace string
+	StatefulSets     v1.StatefulSetLister
+}
+
+// NewFunctionMaintenance creates FunctionMaintenance
+func NewFunctionMaintenance(defaultNamespace string, statefulsets v1.StatefulSetLister) *FunctionMaintenance {
+	return &FunctionMaintenance{
+		DefaultNamespace: defaultNamespace,
+		StatefulSets:     statefulsets,
+	}
+}
+
+// Maintenance returns the Maintenance of the function, which may be suffixed with
+// its namespace, it is nil when the function is not in maintenance
+func (f *FunctionMaintenance) Maintenance(name string) *Maintenance {
+	namespace := getNamespace(name, f.DefaultNamespace)
+	statefulset, err := f.StatefulSets.StatefulSets(namespace).Get(strings.TrimSuffix(name, "."+namespace))
+	if err != nil {
+		return nil
+	}
+
+	// an invalid annotation is rejected when the function is deployed
+	m, _ := ParseMaintenance(statefulset.Annotations)
+	return m
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_ParseMaintenance(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        *Maintenance
+		wantErr     bool
+	}{
+		{
+			name: "not in maintenance without the annotation",
+		},
+		{
+			name:        "not in maintenance when false",
+			annotations: map[string]string{AnnotationMaintenance: "false", AnnotationMaintenanceStatus: "200"},
+		},
+		{
+			name:        "503 by default",
+			annotations: map[string]string{AnnotationMaintenance: "true"},
+			want:        &Maintenance{StatusCode: 503},
+		},
+		{
+			name: "static response",
+			annotations: map[string]string{
+				AnnotationMaintenance:            "true",
+				AnnotationMaintenanceStatus:      "200",
+				AnnotationMaintenanceRetryAfter:  "5m",
+				AnnotationMaintenanceBody:        `{"status": "migrating"}`,
+				AnnotationMaintenanceContentType: "application/json",
+			},
+			want: &Maintenance{StatusCode: 200, RetryAfter: time.Minute * 5, Body: `{"status": "migrating"}`, ContentType: "application/json"},
+		},
+		{
+			name:        "retry-after in seconds",
+			annotations: map[string]string{AnnotationMaintenance: "true", AnnotationMaintenanceRetryAfter: "120"},
+			want:        &Maintenance{StatusCode: 503, RetryAfter: time.Minute * 2},
+		},
+		{
+			name:        "invalid value",
+			annotations: map[string]string{AnnotationMaintenance: "yes"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid status",
+			annotations: map[string]string{AnnotationMaintenance: "true", AnnotationMaintenanceStatus: "99"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid retry-after",
+			annotations: map[string]string{AnnotationMaintenance: "true", AnnotationMaintenanceRetryAfter: "soon"},
+			wantErr:     true,
+		},
+		{
+			name:        "negative retry-after",
+			annotations: map[string]string{AnnotationMaintenance: "true", AnnotationMaintenanceRetryAfter: "-1m"},
+			wantErr:     true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseMaintenance(c.annotations)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("want an error, got: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want: %+v, got: %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func Test_Maintenance_Annotations(t *testing.T) {
+	want := &Maintenance{StatusCode: 200, RetryAfter: time.Second * 90, Body: "back soon", ContentType: "text/html"}
+
+	got, err := ParseMaintenance(want.Annotations())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+}
+
+func Test_ApplyMaintenance(t *testing.T) {
+	cases := []struct {
+		name        string
+		maintenance *Maintenance
+		want        map[string]string
+	}{
+		{
+			name:        "puts the function into maintenance",
+			maintenance: &Maintenance{StatusCode: 503, RetryAfter: time.Minute},
+			want: map[string]string{
+				AnnotationMaintenance:           "true",
+				AnnotationMaintenanceStatus:     "503",
+				AnnotationMaintenanceRetryAfter: "1m0s",
+			},
+		},
+		{
+			name: "takes the function out of maintenance",
+			want: map[string]string{AnnotationMaintenance: "false"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			var applied *appsv1.StatefulSet
+			client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				patch := action.(k8stesting.PatchAction)
+				if patch.GetPatchType() != types.ApplyPatchType {
+					t.Errorf("want an apply patch, got: %s", patch.GetPatchType())
+				}
+				applied = &appsv1.StatefulSet{}
+				if err := json.Unmarshal(patch.GetPatch(), applied); err != nil {
+					return true, nil, err
+				}
+				return true, applied, nil
+			})
+
+			if err := ApplyMaintenance(context.Background(), client, "openfaas-fn", "figlet", c.maintenance); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if applied == nil {
+				t.Fatal("want the statefulset to be applied")
+			}
+			if !reflect.DeepEqual(applied.Annotations, c.want) {
+				t.Errorf("want annotations: %v, got: %v", c.want, applied.Annotations)
+			}
+		})
+	}
+}
+
+func Test_FunctionMaintenance(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name: "figlet", Namespace: "openfaas-fn", Annotations: map[string]string{AnnotationMaintenance: "true"},
+	}})
+	indexer.Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name: "figlet", Namespace: "staging-fn", Annotations: map[string]string{AnnotationMaintenance: "true", AnnotationMaintenanceStatus: "200"},
+	}})
+	indexer.Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Name: "env", Namespace: "openfaas-fn", Annotations: map[string]string{AnnotationMaintenance: "false"},
+	}})
+
+	maintenance := NewFunctionMaintenance("openfaas-fn", v1.NewStatefulSetLister(indexer))
+
+	cases := map[string]*Maintenance{
+		"figlet":            {StatusCode: 503},
+		"figlet.staging-fn": {StatusCode: 200},
+		"env":               nil,
+		"missing":           nil,
+	}
+	for name, want := range cases {
+		if got := maintenance.Maintenance(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want %+v, got %+v", name, want, got)
+		}
+	}
+}
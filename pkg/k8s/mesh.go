@@ -0,0 +1,152 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// MeshIstio injects the Istio sidecar and creates a DestinationRule with mTLS
+	MeshIstio = "istio"
+	// MeshLinkerd injects the Linkerd proxy and creates a ServiceProfile
+	MeshLinkerd = "linkerd"
+
+	// watchdogMetricsPort is scraped by Prometheus, which is usually not part of the
+	// mesh, so it is excluded from the proxy
+	watchdogMetricsPort = 8081
+)
+
+var (
+	// DestinationRuleResource and ServiceProfileResource are managed with the dynamic
+	// client, so that the CRDs are only required when the mesh mode is enabled
+	DestinationRuleResource = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "destinationrules"}
+	ServiceProfileResource  = schema.GroupVersionResource{Group: "linkerd.io", Version: "v1alpha2", Resource: "serviceprofiles"}
+)
+
+// ValidateMeshMode returns an error when mode is not empty, MeshIstio or MeshLinkerd
+func ValidateMeshMode(mode string) error {
+	switch mode {
+	case "", MeshIstio, MeshLinkerd:
+		return nil
+	}
+	return fmt.Errorf("invalid mesh mode %q, use %s or %s", mode, MeshIstio, MeshLinkerd)
+}
+
+// ConfigureMesh adds the injection annotations of the mesh to the Pods of the
+// function. With Istio the HTTP probes are rewritten by the sidecar, so that the
+// kubelet can reach them when mTLS is enforced. Annotations that are set by the
+// function are kept, so that a function can opt out with an injection of "false".
+func (f *FunctionFactory) ConfigureMesh(statefulset *appsv1.StatefulSet) {
+	var meshAnnotations map[string]string
+	metricsPort := strconv.Itoa(watchdogMetricsPort)
+
+	switch f.Config.MeshMode {
+	case MeshIstio:
+		meshAnnotations = map[string]string{
+			"sidecar.istio.io/inject":                      "true",
+			"sidecar.istio.io/rewriteAppHTTPProbers":       "true",
+			"traffic.sidecar.istio.io/excludeInboundPorts": metricsPort,
+		}
+	case MeshLinkerd:
+		meshAnnotations = map[string]string{
+			"linkerd.io/inject":                    "enabled",
+			"config.linkerd.io/skip-inbound-ports": metricsPort,
+		}
+	default:
+		return
+	}
+
+	// the template may share its annotations with the StatefulSet and the request
+	annotations := make(map[string]string, len(statefulset.Spec.Template.Annotations)+len(meshAnnotations))
+	for k, v := range statefulset.Spec.Template.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range meshAnnotations {
+		if _, ok := annotations[k]; !ok {
+			annotations[k] = v
+		}
+	}
+	statefulset.Spec.Template.Annotations = annotations
+}
+
+// MakeMeshPolicy creates the DestinationRule or the ServiceProfile for the Service of
+// a function, nil is returned when the mesh mode is not enabled. It is owned by the
+// StatefulSet so that it is removed with the function.
+func MakeMeshPolicy(mode string, statefulset *appsv1.StatefulSet) (*unstructured.Unstructured, schema.GroupVersionResource) {
+	host := fmt.Sprintf("%s.%s.svc.cluster.local", statefulset.Name, statefulset.Namespace)
+
+	var policy *unstructured.Unstructured
+	var resource schema.GroupVersionResource
+
+	switch mode {
+	case MeshIstio:
+		resource = DestinationRuleResource
+		policy = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": resource.GroupVersion().String(),
+			"kind":       "DestinationRule",
+			"metadata": map[string]interface{}{
+				"name":      statefulset.Name,
+				"namespace": statefulset.Namespace,
+			},
+			"spec": map[string]interface{}{
+				"host": host,
+				"trafficPolicy": map[string]interface{}{
+					"tls": map[string]interface{}{"mode": "ISTIO_MUTUAL"},
+				},
+			},
+		}}
+
+	case MeshLinkerd:
+		// function invocations are not idempotent, so they are not retried by the proxy
+		resource = ServiceProfileResource
+		policy = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": resource.GroupVersion().String(),
+			"kind":       "ServiceProfile",
+			"metadata": map[string]interface{}{
+				"name":      host,
+				"namespace": statefulset.Namespace,
+			},
+			"spec": map[string]interface{}{
+				"routes": []interface{}{
+					map[string]interface{}{
+						"name":        "invoke",
+						"condition":   map[string]interface{}{"pathRegex": "/.*"},
+						"isRetryable": false,
+					},
+				},
+			},
+		}}
+
+	default:
+		return nil, resource
+	}
+
+	policy.SetLabels(map[string]string{"faas_function": statefulset.Name})
+	policy.SetOwnerReferences([]metav1.OwnerReference{StatefulSetOwner(statefulset)})
+
+	return policy, resource
+}
+
+// ApplyMeshPolicy creates or updates the DestinationRule or ServiceProfile of the
+// function for the mesh mode, the labels are added to the ones of the policy
+func ApplyMeshPolicy(ctx context.Context, client dynamic.Interface, mode string, statefulset *appsv1.StatefulSet, labels map[string]string) error {
+	policy, resource := MakeMeshPolicy(mode, statefulset)
+	if policy == nil {
+		return nil
+	}
+	AddLabels(policy, labels)
+
+	_, err := client.Resource(resource).Namespace(statefulset.Namespace).
+		Apply(ctx, policy.GetName(), policy, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
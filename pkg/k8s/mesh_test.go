@@ -0,0 +1,80 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newMeshStatefulSet(annotations map[string]string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "1234", Annotations: annotations},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			},
+		},
+	}
+}
+
+func Test_ConfigureMesh_Istio(t *testing.T) {
+	factory := FunctionFactory{Config: DeploymentConfig{MeshMode: MeshIstio}}
+	annotations := map[string]string{"sidecar.istio.io/inject": "false"}
+	statefulset := newMeshStatefulSet(annotations)
+
+	factory.ConfigureMesh(statefulset)
+
+	got := statefulset.Spec.Template.Annotations
+	if got["sidecar.istio.io/inject"] != "false" {
+		t.Errorf("want the function's injection annotation to be kept, got %q", got["sidecar.istio.io/inject"])
+	}
+	if got["sidecar.istio.io/rewriteAppHTTPProbers"] != "true" {
+		t.Errorf("want the probes to be rewritten by the sidecar")
+	}
+	if got["traffic.sidecar.istio.io/excludeInboundPorts"] != "8081" {
+		t.Errorf("want the metrics port to be excluded, got %q", got["traffic.sidecar.istio.io/excludeInboundPorts"])
+	}
+	if len(annotations) != 1 || len(statefulset.Annotations) != 1 {
+		t.Errorf("want the annotations of the request and the StatefulSet to be unchanged, got %v", annotations)
+	}
+}
+
+func Test_ConfigureMesh_Disabled(t *testing.T) {
+	factory := FunctionFactory{}
+	statefulset := newMeshStatefulSet(nil)
+
+	factory.ConfigureMesh(statefulset)
+	if statefulset.Spec.Template.Annotations != nil {
+		t.Errorf("want no annotations without a mesh mode, got %v", statefulset.Spec.Template.Annotations)
+	}
+}
+
+func Test_MakeMeshPolicy(t *testing.T) {
+	statefulset := newMeshStatefulSet(nil)
+
+	rule, resource := MakeMeshPolicy(MeshIstio, statefulset)
+	if resource != DestinationRuleResource || rule.GetName() != "figlet" {
+		t.Fatalf("want a DestinationRule figlet, got %s %s", rule.GetKind(), rule.GetName())
+	}
+	if mode, _, _ := unstructured.NestedString(rule.Object, "spec", "trafficPolicy", "tls", "mode"); mode != "ISTIO_MUTUAL" {
+		t.Errorf("want mTLS, got %q", mode)
+	}
+	if owners := rule.GetOwnerReferences(); len(owners) != 1 || owners[0].UID != "1234" {
+		t.Errorf("want the DestinationRule to be owned by the StatefulSet, got %v", owners)
+	}
+
+	profile, resource := MakeMeshPolicy(MeshLinkerd, statefulset)
+	if resource != ServiceProfileResource || profile.GetName() != "figlet.openfaas-fn.svc.cluster.local" {
+		t.Fatalf("want a ServiceProfile for the FQDN of the Service, got %s %s", profile.GetKind(), profile.GetName())
+	}
+
+	if policy, _ := MakeMeshPolicy("", statefulset); policy != nil {
+		t.Errorf("want no policy without a mesh mode")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	// AnnotationFunctionLabels and AnnotationFunctionAnnotations record the keys of
+	// the labels and annotations that were set from the function, so that they can
+	// be told apart from those set by the provider or by other controllers
+	AnnotationFunctionLabels      = "com.openfaas.function.labels"
+	AnnotationFunctionAnnotations = "com.openfaas.function.annotations"
+)
+
+// systemLabels are set by the provider rather than from the function
+var systemLabels = []string{"faas_function", "app", "controller", "uid", TemplateHashLabel}
+
+// systemAnnotations are set by the provider rather than from the function, the
+// ScrapeAnnotation only when the function does not configure scraping
+var systemAnnotations = []string{ScrapeAnnotation, AnnotationFunctionLabels, AnnotationFunctionAnnotations, annotationExternalSecrets, AnnotationProcessEnv, AnnotationDrainStatus, AnnotationSecretRotation, AnnotationProfileVolumes, AnnotationProfileVolumeMounts}
+
+// RecordFunctionMetadata records the keys of the function's labels and annotations
+// on the StatefulSet
+func RecordFunctionMetadata(statefulset *appsv1.StatefulSet, labels, annotations map[string]string) {
+	recorded := cloneStringMap(statefulset.Annotations)
+	recorded[AnnotationFunctionLabels] = joinKeys(labels)
+	recorded[AnnotationFunctionAnnotations] = joinKeys(annotations)
+	statefulset.Annotations = recorded
+}
+
+// FunctionMetadata returns the labels and annotations that were last set from the
+// function. For a StatefulSet created before the keys were recorded, they are the
+// labels of the Pod template and the annotations of the StatefulSet without those
+// set by the provider.
+func FunctionMetadata(statefulset *appsv1.StatefulSet) (labels, annotations map[string]string) {
+	labels, annotations = map[string]string{}, map[string]string{}
+	templateLabels := statefulset.Spec.Template.Labels
+
+	labelKeys, recorded := statefulset.Annotations[AnnotationFunctionLabels]
+	if !recorded {
+		for k, v := range templateLabels {
+			if !contains(systemLabels, k) {
+				labels[k] = v
+			}
+		}
+		for k, v := range statefulset.Annotations {
+			if !contains(systemAnnotations, k) || (k == ScrapeAnnotation && v != "false") {
+				annotations[k] = v
+			}
+		}
+		return labels, annotations
+	}
+
+	for _, k := range splitKeys(labelKeys) {
+		if v, ok := templateLabels[k]; ok {
+			labels[k] = v
+		}
+	}
+	for _, k := range splitKeys(statefulset.Annotations[AnnotationFunctionAnnotations]) {
+		if v, ok := statefulset.Annotations[k]; ok {
+			annotations[k] = v
+		}
+	}
+	return labels, annotations
+}
+
+// MergeMetadata applies a patch to the labels or annotations of a function, a key
+// with a nil value is removed and the others are set
+func MergeMetadata(current map[string]string, patch map[string]*string) map[string]string {
+	merged := cloneStringMap(current)
+	for k, v := range patch {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = *v
+	}
+	return merged
+}
+
+// HasRemovals returns true when the patch removes at least one key
+func HasRemovals(patch map[string]*string) bool {
+	for _, v := range patch {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// KeepExternalLabels adds the labels of the existing StatefulSet that were set by
+// other controllers to the desired labels, so that an update only removes the
+// labels that were removed from the function. The desired labels are returned when
+// there is no existing StatefulSet.
+func KeepExternalLabels(desired map[string]string, existing *appsv1.StatefulSet) map[string]string {
+	if existing == nil {
+		return desired
+	}
+	keys, recorded := existing.Annotations[AnnotationFunctionLabels]
+	return keepExternal(desired, existing.Labels, keys, recorded, systemLabels)
+}
+
+// KeepExternalAnnotations is the same as KeepExternalLabels for the annotations of
+// the StatefulSet, or of another object of the function such as its Service
+func KeepExternalAnnotations(desired, current map[string]string, existing *appsv1.StatefulSet) map[string]string {
+	if existing == nil {
+		return desired
+	}
+	keys, recorded := existing.Annotations[AnnotationFunctionAnnotations]
+	return keepExternal(desired, current, keys, recorded, systemAnnotations)
+}
+
+// keepExternal adds the keys of current that are neither recorded as the function's
+// nor set by the provider to desired. Without a record the desired keys replace all
+// of the current ones.
+func keepExternal(desired, current map[string]string, functionKeys string, recorded bool, system []string) map[string]string {
+	if !recorded {
+		return desired
+	}
+
+	kept := cloneStringMap(desired)
+	owned := splitKeys(functionKeys)
+	for k, v := range current {
+		if _, ok := kept[k]; ok || contains(owned, k) || contains(system, k) {
+			continue
+		}
+		kept[k] = v
+	}
+	return kept
+}
+
+func joinKeys(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func splitKeys(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newMetadataStatefulSet(labels, annotations map[string]string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Labels: labels, Annotations: annotations},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			},
+		},
+	}
+}
+
+func Test_FunctionMetadata_Recorded(t *testing.T) {
+	statefulset := newMetadataStatefulSet(
+		map[string]string{"faas_function": "figlet", "team": "payments", "argocd.argoproj.io/instance": "fn"},
+		map[string]string{ScrapeAnnotation: "false", "topic": "orders", "kubectl.kubernetes.io/restartedAt": "now"},
+	)
+	RecordFunctionMetadata(statefulset, map[string]string{"team": "payments"}, map[string]string{"topic": "orders"})
+
+	labels, annotations := FunctionMetadata(statefulset)
+	if want := map[string]string{"team": "payments"}; !reflect.DeepEqual(want, labels) {
+		t.Errorf("want labels %v, got %v", want, labels)
+	}
+	if want := map[string]string{"topic": "orders"}; !reflect.DeepEqual(want, annotations) {
+		t.Errorf("want annotations %v, got %v", want, annotations)
+	}
+}
+
+func Test_FunctionMetadata_Legacy(t *testing.T) {
+	statefulset := newMetadataStatefulSet(
+		map[string]string{"faas_function": "figlet", "uid": "12345", "team": "payments"},
+		map[string]string{ScrapeAnnotation: "false", "topic": "orders"},
+	)
+
+	labels, annotations := FunctionMetadata(statefulset)
+	if want := map[string]string{"team": "payments"}; !reflect.DeepEqual(want, labels) {
+		t.Errorf("want labels %v, got %v", want, labels)
+	}
+	if want := map[string]string{"topic": "orders"}; !reflect.DeepEqual(want, annotations) {
+		t.Errorf("want annotations %v, got %v", want, annotations)
+	}
+}
+
+func Test_MergeMetadata(t *testing.T) {
+	value := "checkout"
+	merged := MergeMetadata(
+		map[string]string{"team": "payments", "tier": "gold"},
+		map[string]*string{"tier": nil, "project": &value, "missing": nil},
+	)
+
+	want := map[string]string{"team": "payments", "project": "checkout"}
+	if !reflect.DeepEqual(want, merged) {
+		t.Errorf("want %v, got %v", want, merged)
+	}
+}
+
+func Test_KeepExternalLabels(t *testing.T) {
+	existing := newMetadataStatefulSet(
+		map[string]string{"team": "payments", "tier": "gold", "argocd.argoproj.io/instance": "fn", "faas_function": "figlet"},
+		map[string]string{},
+	)
+	RecordFunctionMetadata(existing, map[string]string{"team": "payments", "tier": "gold"}, nil)
+
+	// tier was removed from the function
+	got := KeepExternalLabels(map[string]string{"team": "payments"}, existing)
+	want := map[string]string{"team": "payments", "argocd.argoproj.io/instance": "fn"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// without a record the desired labels replace the existing ones
+	legacy := newMetadataStatefulSet(map[string]string{"argocd.argoproj.io/instance": "fn"}, map[string]string{})
+	if got := KeepExternalLabels(map[string]string{"team": "payments"}, legacy); !reflect.DeepEqual(map[string]string{"team": "payments"}, got) {
+		t.Errorf("want only the desired labels without a record, got %v", got)
+	}
+
+	// a StatefulSet that is created has no existing labels
+	if got := KeepExternalLabels(map[string]string{"team": "payments"}, nil); !reflect.DeepEqual(map[string]string{"team": "payments"}, got) {
+		t.Errorf("want the desired labels without an existing StatefulSet, got %v", got)
+	}
+	if got := KeepExternalAnnotations(map[string]string{"topic": "orders"}, nil, nil); !reflect.DeepEqual(map[string]string{"topic": "orders"}, got) {
+		t.Errorf("want the desired annotations without an existing StatefulSet, got %v", got)
+	}
+}
+
+func Test_KeepExternalAnnotations(t *testing.T) {
+	existing := newMetadataStatefulSet(map[string]string{}, map[string]string{
+		"topic":                             "orders",
+		ScrapeAnnotation:                    "false",
+		"kubectl.kubernetes.io/restartedAt": "now",
+	})
+	RecordFunctionMetadata(existing, nil, map[string]string{"topic": "orders"})
+
+	// the function now sets the slash form of the scrape annotation and drops topic
+	got := KeepExternalAnnotations(map[string]string{PrometheusScrapeAnnotation: "true"}, existing.Annotations, existing)
+	want := map[string]string{PrometheusScrapeAnnotation: "true", "kubectl.kubernetes.io/restartedAt": "now"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
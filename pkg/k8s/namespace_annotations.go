@@ -0,0 +1,75 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaceAnnotationsTTL is how long the annotations of a namespace are cached
+const namespaceAnnotationsTTL = time.Minute
+
+// NamespaceAnnotations reads the annotations of namespaces that override the
+// defaults for the functions in them, they are cached so that building the
+// StatefulSet of a function does not read its namespace each time. A nil
+// NamespaceAnnotations has no annotations for any namespace.
+type NamespaceAnnotations struct {
+	client kubernetes.Interface
+
+	lock       sync.Mutex
+	namespaces map[string]cachedAnnotations
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type cachedAnnotations struct {
+	annotations map[string]string
+	expires     time.Time
+}
+
+// NewNamespaceAnnotations creates a NamespaceAnnotations that reads namespaces
+// with client
+func NewNamespaceAnnotations(client kubernetes.Interface) *NamespaceAnnotations {
+	return &NamespaceAnnotations{
+		client:     client,
+		namespaces: map[string]cachedAnnotations{},
+		now:        time.Now,
+	}
+}
+
+// Get returns the annotations of a namespace, a namespace that can not be read has
+// no annotations
+func (n *NamespaceAnnotations) Get(ctx context.Context, namespace string) map[string]string {
+	if n == nil || namespace == "" {
+		return nil
+	}
+
+	n.lock.Lock()
+	cached, ok := n.namespaces[namespace]
+	n.lock.Unlock()
+	if ok && n.now().Before(cached.expires) {
+		return cached.annotations
+	}
+
+	var annotations map[string]string
+	ns, err := n.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		logging.FromContext(ctx).V(2).Info("Unable to read the annotations of the namespace", "namespace", namespace, "error", err.Error())
+	} else {
+		annotations = ns.Annotations
+	}
+
+	n.lock.Lock()
+	n.namespaces[namespace] = cachedAnnotations{annotations: annotations, expires: n.now().Add(namespaceAnnotationsTTL)}
+	n.lock.Unlock()
+
+	return annotations
+}
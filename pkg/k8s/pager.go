@@ -0,0 +1,22 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PaginateInformerList makes the initial list of an informer paginated, it is used
+// with informers.WithTweakListOptions.
+//
+// Informers list with resourceVersion "0" so that the list is served from the watch
+// cache of the API server, which ignores the page size and returns every object in a
+// single response that can time out with thousands of functions. Without a
+// resourceVersion the list is read in pages of 500 using continue tokens. Watches
+// never set a limit and are left unchanged.
+func PaginateInformerList(options *metav1.ListOptions) {
+	if options.Limit > 0 && options.ResourceVersion == "0" {
+		options.ResourceVersion = ""
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_PaginateInformerList(t *testing.T) {
+	cases := []struct {
+		name    string
+		options metav1.ListOptions
+		want    string
+	}{
+		{
+			name:    "initial list from the watch cache is paginated",
+			options: metav1.ListOptions{ResourceVersion: "0", Limit: 500},
+			want:    "",
+		},
+		{
+			name:    "relist from a known resource version is unchanged",
+			options: metav1.ListOptions{ResourceVersion: "1234", Limit: 500},
+			want:    "1234",
+		},
+		{
+			name:    "watch is unchanged",
+			options: metav1.ListOptions{ResourceVersion: "0", Watch: true},
+			want:    "0",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := tc.options
+			PaginateInformerList(&options)
+
+			if options.ResourceVersion != tc.want {
+				t.Fatalf("expected resource version %q, got %q", tc.want, options.ResourceVersion)
+			}
+			if options.Limit != tc.options.Limit {
+				t.Fatalf("expected the limit to be unchanged, got %d", options.Limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConfigurePodSecurity makes the StatefulSet of a function compliant with the
+// restricted Pod Security Standard when RestrictedPodSecurity is set, it must be
+// called after the Profiles have been applied. The function runs as a non-root user
+// with the RuntimeDefault seccomp profile, and each container drops all of its
+// capabilities and can not escalate its privileges.
+//
+// Settings that can not be changed without breaking the function, such as a
+// hostPath volume from a Profile, are returned as an error instead.
+func (f *FunctionFactory) ConfigurePodSecurity(statefulset *appsv1.StatefulSet) error {
+	if !f.Config.RestrictedPodSecurity {
+		return nil
+	}
+
+	spec := &statefulset.Spec.Template.Spec
+	if spec.SecurityContext == nil {
+		spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	runAsNonRoot := true
+	spec.SecurityContext.RunAsNonRoot = &runAsNonRoot
+	if spec.SecurityContext.SeccompProfile == nil {
+		spec.SecurityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	}
+
+	for i := range spec.InitContainers {
+		restrictContainer(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		restrictContainer(&spec.Containers[i])
+	}
+
+	return ValidateRestrictedPodSecurity(&statefulset.Spec.Template.Spec)
+}
+
+func restrictContainer(container *corev1.Container) {
+	if container.SecurityContext == nil {
+		container.SecurityContext = &corev1.SecurityContext{}
+	}
+
+	allowPrivilegeEscalation := false
+	container.SecurityContext.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+
+	if container.SecurityContext.Capabilities == nil {
+		container.SecurityContext.Capabilities = &corev1.Capabilities{}
+	}
+	container.SecurityContext.Capabilities.Drop = []corev1.Capability{"ALL"}
+}
+
+// restrictedVolumeTypes are the volume sources allowed by the restricted Pod
+// Security Standard
+var restrictedVolumeTypes = map[string]func(corev1.VolumeSource) bool{
+	"configMap":             func(v corev1.VolumeSource) bool { return v.ConfigMap != nil },
+	"csi":                   func(v corev1.VolumeSource) bool { return v.CSI != nil },
+	"downwardAPI":           func(v corev1.VolumeSource) bool { return v.DownwardAPI != nil },
+	"emptyDir":              func(v corev1.VolumeSource) bool { return v.EmptyDir != nil },
+	"ephemeral":             func(v corev1.VolumeSource) bool { return v.Ephemeral != nil },
+	"persistentVolumeClaim": func(v corev1.VolumeSource) bool { return v.PersistentVolumeClaim != nil },
+	"projected":             func(v corev1.VolumeSource) bool { return v.Projected != nil },
+	"secret":                func(v corev1.VolumeSource) bool { return v.Secret != nil },
+}
+
+// ValidateRestrictedPodSecurity returns the settings of a Pod that violate the
+// restricted Pod Security Standard, as a single error
+func ValidateRestrictedPodSecurity(spec *corev1.PodSpec) error {
+	var violations []string
+
+	if spec.HostNetwork || spec.HostPID || spec.HostIPC {
+		violations = append(violations, "host namespaces are not allowed")
+	}
+
+	for _, volume := range spec.Volumes {
+		allowed := false
+		for _, isType := range restrictedVolumeTypes {
+			if isType(volume.VolumeSource) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violations = append(violations, fmt.Sprintf("volume %s has a restricted type", volume.Name))
+		}
+	}
+
+	podNonRoot := false
+	podSeccomp := false
+	if sc := spec.SecurityContext; sc != nil {
+		podNonRoot = sc.RunAsNonRoot != nil && *sc.RunAsNonRoot
+		podSeccomp = allowedSeccompProfile(sc.SeccompProfile)
+		if sc.SeccompProfile != nil && !podSeccomp {
+			violations = append(violations, fmt.Sprintf("seccomp profile %s is not allowed", sc.SeccompProfile.Type))
+		}
+		if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+			violations = append(violations, "runAsUser must not be 0")
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		violations = append(violations, containerViolations(container, podNonRoot, podSeccomp)...)
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("restricted pod security: %s", strings.Join(violations, ", "))
+	}
+	return nil
+}
+
+func containerViolations(container corev1.Container, podNonRoot, podSeccomp bool) []string {
+	var violations []string
+	violation := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf("container %s: ", container.Name)+fmt.Sprintf(format, args...))
+	}
+
+	for _, port := range container.Ports {
+		if port.HostPort != 0 {
+			violation("host ports are not allowed")
+			break
+		}
+	}
+
+	sc := container.SecurityContext
+	if sc == nil {
+		sc = &corev1.SecurityContext{}
+	}
+
+	if sc.Privileged != nil && *sc.Privileged {
+		violation("privileged is not allowed")
+	}
+	if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+		violation("allowPrivilegeEscalation must be false")
+	}
+	if sc.RunAsNonRoot != nil && !*sc.RunAsNonRoot || sc.RunAsNonRoot == nil && !podNonRoot {
+		violation("runAsNonRoot must be true")
+	}
+	if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+		violation("runAsUser must not be 0")
+	}
+	if sc.SeccompProfile != nil && !allowedSeccompProfile(sc.SeccompProfile) || sc.SeccompProfile == nil && !podSeccomp {
+		violation("seccomp profile must be RuntimeDefault or Localhost")
+	}
+
+	dropsAll := false
+	if sc.Capabilities != nil {
+		for _, capability := range sc.Capabilities.Drop {
+			if capability == "ALL" {
+				dropsAll = true
+			}
+		}
+		for _, capability := range sc.Capabilities.Add {
+			if capability != "NET_BIND_SERVICE" {
+				violation("capability %s is not allowed", capability)
+			}
+		}
+	}
+	if !dropsAll {
+		violation("all capabilities must be dropped")
+	}
+
+	return violations
+}
+
+func allowedSeccompProfile(profile *corev1.SeccompProfile) bool {
+	return profile != nil &&
+		(profile.Type == corev1.SeccompProfileTypeRuntimeDefault || profile.Type == corev1.SeccompProfileTypeLocalhost)
+}
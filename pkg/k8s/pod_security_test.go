@@ -0,0 +1,145 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newPodSecurityStatefulSet() *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init"}},
+					Containers:     []corev1.Container{{Name: "figlet"}},
+					Volumes: []corev1.Volume{{
+						Name:         "temp",
+						VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func Test_ConfigurePodSecurity_Disabled(t *testing.T) {
+	factory := mockFactory()
+	statefulset := newPodSecurityStatefulSet()
+
+	if err := factory.ConfigurePodSecurity(statefulset); err != nil {
+		t.Fatal(err)
+	}
+	if statefulset.Spec.Template.Spec.SecurityContext != nil {
+		t.Errorf("want the pod security context to be unchanged")
+	}
+}
+
+func Test_ConfigurePodSecurity_Restricted(t *testing.T) {
+	factory := mockFactory()
+	factory.Config.RestrictedPodSecurity = true
+	statefulset := newPodSecurityStatefulSet()
+
+	if err := factory.ConfigurePodSecurity(statefulset); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := statefulset.Spec.Template.Spec
+	if spec.SecurityContext.RunAsNonRoot == nil || !*spec.SecurityContext.RunAsNonRoot {
+		t.Errorf("want runAsNonRoot to be true")
+	}
+	if spec.SecurityContext.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+		t.Errorf("want the RuntimeDefault seccomp profile, got %s", spec.SecurityContext.SeccompProfile.Type)
+	}
+
+	for _, container := range append(spec.InitContainers, spec.Containers...) {
+		sc := container.SecurityContext
+		if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+			t.Errorf("container %s: want allowPrivilegeEscalation to be false", container.Name)
+		}
+		if len(sc.Capabilities.Drop) != 1 || sc.Capabilities.Drop[0] != "ALL" {
+			t.Errorf("container %s: want all capabilities to be dropped, got %v", container.Name, sc.Capabilities.Drop)
+		}
+	}
+}
+
+func Test_ConfigurePodSecurity_RejectsViolations(t *testing.T) {
+	privileged := true
+	rootUser := int64(0)
+
+	cases := []struct {
+		name   string
+		modify func(*corev1.PodSpec)
+		want   string
+	}{
+		{
+			name: "hostPath volume",
+			modify: func(spec *corev1.PodSpec) {
+				spec.Volumes = append(spec.Volumes, corev1.Volume{
+					Name:         "spiffe",
+					VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/run/spire"}},
+				})
+			},
+			want: "volume spiffe has a restricted type",
+		},
+		{
+			name:   "host network",
+			modify: func(spec *corev1.PodSpec) { spec.HostNetwork = true },
+			want:   "host namespaces are not allowed",
+		},
+		{
+			name: "privileged container",
+			modify: func(spec *corev1.PodSpec) {
+				spec.Containers[0].SecurityContext = &corev1.SecurityContext{Privileged: &privileged}
+			},
+			want: "container figlet: privileged is not allowed",
+		},
+		{
+			name: "added capability",
+			modify: func(spec *corev1.PodSpec) {
+				spec.Containers[0].SecurityContext = &corev1.SecurityContext{
+					Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}},
+				}
+			},
+			want: "container figlet: capability NET_ADMIN is not allowed",
+		},
+		{
+			name: "root user from a profile",
+			modify: func(spec *corev1.PodSpec) {
+				spec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: &rootUser}
+			},
+			want: "runAsUser must not be 0",
+		},
+		{
+			name: "unconfined seccomp profile",
+			modify: func(spec *corev1.PodSpec) {
+				spec.SecurityContext = &corev1.PodSecurityContext{
+					SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined},
+				}
+			},
+			want: "seccomp profile Unconfined is not allowed",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := mockFactory()
+			factory.Config.RestrictedPodSecurity = true
+			statefulset := newPodSecurityStatefulSet()
+			tc.modify(&statefulset.Spec.Template.Spec)
+
+			err := factory.ConfigurePodSecurity(statefulset)
+			if err == nil {
+				t.Fatalf("want an error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("want the error to contain %q, got %q", tc.want, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AnnotationPort is the port that the function's container listens on, when it
+	// is not the port of the watchdog. The Service keeps the port of the watchdog
+	// and targets this one, so that callers are not affected.
+	AnnotationPort = "com.openfaas.port"
+	// AnnotationHealthPath is the path of the function's HTTP health check, setting
+	// it uses an HTTP probe even when the provider is configured with exec probes
+	AnnotationHealthPath = "com.openfaas.health.http.path"
+
+	// defaultHealthPath is the health check of the watchdog
+	defaultHealthPath = "/_/health"
+
+	// DefaultFunctionPort is the port of the OpenFaaS watchdog, it is the port of
+	// the Service of each function unless the provider is configured with another
+	DefaultFunctionPort int32 = 8080
+)
+
+// HTTPPort returns the RuntimeHTTPPort, or the DefaultFunctionPort when it is
+// not set
+func (c DeploymentConfig) HTTPPort() int32 {
+	if c.RuntimeHTTPPort == 0 {
+		return DefaultFunctionPort
+	}
+	return c.RuntimeHTTPPort
+}
+
+// FunctionPort returns the port of the function's container from its annotations,
+// or defaultPort when it is not set
+func FunctionPort(annotations map[string]string, defaultPort int32) (int32, error) {
+	value, ok := annotations[AnnotationPort]
+	if !ok {
+		return defaultPort, nil
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return defaultPort, fmt.Errorf("%s must be a port between 1 and 65535, got %q", AnnotationPort, value)
+	}
+	return int32(port), nil
+}
+
+// HealthPath returns the path of the function's HTTP health check from its
+// annotations, or an empty string when it is not set
+func HealthPath(annotations map[string]string) (string, error) {
+	value, ok := annotations[AnnotationHealthPath]
+	if !ok {
+		return "", nil
+	}
+
+	if !strings.HasPrefix(value, "/") {
+		return "", fmt.Errorf("%s must be an absolute path, got %q", AnnotationHealthPath, value)
+	}
+	return value, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LabelPrewarm set to "true" keeps the image of a function on every node that the
+	// function can be scheduled on, so that a scale from zero does not wait for a pull
+	LabelPrewarm = "com.openfaas.prewarm"
+
+	// LabelPrewarmFor selects the Pods of the pre-warm DaemonSet of a function, they
+	// do not have the faas_function label so that they never receive invocations
+	LabelPrewarmFor = "com.openfaas.prewarm-for"
+
+	// DefaultPrewarmImage provides the static binary that the function image runs to
+	// exit straight away, and the container that keeps the Pod running
+	DefaultPrewarmImage = "busybox:1.36"
+
+	prewarmVolume = "prewarm"
+	prewarmPath   = "/prewarm"
+	prewarmUserID = int64(65534)
+)
+
+// IsPrewarmed returns true when the labels enable the pre-warm of the image
+func IsPrewarmed(labels map[string]string) bool {
+	return labels[LabelPrewarm] == "true"
+}
+
+// PrewarmName is the name of the pre-warm DaemonSet of a function
+func PrewarmName(function string) string {
+	return function + "-prewarm"
+}
+
+// MakePrewarmDaemonSet creates the DaemonSet that pulls the image of the function on
+// each node that its Pods can be scheduled on. The function image is only started to
+// run a copy of the static busybox binary from image, which exits, so neither the
+// function nor its entrypoint are run. The DaemonSet is owned by the StatefulSet so
+// that it is removed with the function.
+func MakePrewarmDaemonSet(statefulset *appsv1.StatefulSet, image string) *appsv1.DaemonSet {
+	if image == "" {
+		image = DefaultPrewarmImage
+	}
+
+	no, yes := false, true
+	userID := prewarmUserID
+
+	template := statefulset.Spec.Template.Spec
+	function := template.Containers[0]
+	labels := map[string]string{LabelPrewarmFor: statefulset.Name}
+
+	// the Pod affinities of the function spread its replicas, they do not apply
+	// to a DaemonSet
+	var affinity *corev1.Affinity
+	if template.Affinity != nil && template.Affinity.NodeAffinity != nil {
+		affinity = &corev1.Affinity{NodeAffinity: template.Affinity.NodeAffinity}
+	}
+
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1m"),
+			corev1.ResourceMemory: resource.MustParse("4Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("16Mi"),
+		},
+	}
+	securityContext := &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &no,
+		ReadOnlyRootFilesystem:   &yes,
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+	mount := []corev1.VolumeMount{{Name: prewarmVolume, MountPath: prewarmPath}}
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            PrewarmName(statefulset.Name),
+			Namespace:       statefulset.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{StatefulSetOwner(statefulset)},
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					// the scheduling constraints of the function, so that the image
+					// is only pulled on the nodes where it may run
+					NodeSelector:                 template.NodeSelector,
+					Affinity:                     affinity,
+					Tolerations:                  template.Tolerations,
+					ImagePullSecrets:             template.ImagePullSecrets,
+					ServiceAccountName:           template.ServiceAccountName,
+					AutomountServiceAccountToken: &no,
+					PriorityClassName:            template.PriorityClassName,
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot:   &yes,
+						RunAsUser:      &userID,
+						SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+					},
+					InitContainers: []corev1.Container{
+						{
+							Name:            "install",
+							Image:           image,
+							Command:         []string{"cp", "/bin/busybox", prewarmPath + "/busybox"},
+							Resources:       resources,
+							SecurityContext: securityContext,
+							VolumeMounts:    mount,
+						},
+						{
+							Name:            "pull",
+							Image:           function.Image,
+							ImagePullPolicy: function.ImagePullPolicy,
+							Command:         []string{prewarmPath + "/busybox", "true"},
+							Resources:       resources,
+							SecurityContext: securityContext,
+							VolumeMounts:    mount,
+						},
+					},
+					Containers: []corev1.Container{{
+						Name:            "sleep",
+						Image:           image,
+						Command:         []string{"sleep", "2147483647"},
+						Resources:       resources,
+						SecurityContext: securityContext,
+					}},
+					Volumes: []corev1.Volume{{
+						Name:         prewarmVolume,
+						VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// SyncPrewarm creates or updates the pre-warm DaemonSet of the StatefulSet when the
+// function has the com.openfaas.prewarm label, and deletes it when the label has been
+// removed. The labels are added to the ones of the DaemonSet.
+func SyncPrewarm(ctx context.Context, client kubernetes.Interface, statefulset *appsv1.StatefulSet, image string, labels map[string]string) error {
+	daemonsets := client.AppsV1().DaemonSets(statefulset.Namespace)
+	name := PrewarmName(statefulset.Name)
+
+	if !IsPrewarmed(statefulset.Spec.Template.Labels) {
+		err := daemonsets.Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !IsNotFound(err) && !IsUnavailable(err) {
+			return err
+		}
+		return nil
+	}
+
+	daemonset := MakePrewarmDaemonSet(statefulset, image)
+	AddLabels(daemonset, labels)
+
+	existing, err := daemonsets.Get(ctx, name, metav1.GetOptions{})
+	if IsNotFound(err) {
+		_, err = daemonsets.Create(ctx, daemonset, metav1.CreateOptions{FieldManager: FieldManager})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// an update that does not change the template does not restart the Pods, so
+	// the DaemonSet is updated with each update of the function
+	existing.Labels = daemonset.Labels
+	existing.OwnerReferences = daemonset.OwnerReferences
+	existing.Spec.Template = daemonset.Spec.Template
+	_, err = daemonsets.Update(ctx, existing, metav1.UpdateOptions{FieldManager: FieldManager})
+	return err
+}
@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newPrewarmStatefulSet(labels map[string]string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "1234"},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					NodeSelector:     map[string]string{"kubernetes.io/arch": "arm64"},
+					ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+					Affinity: &corev1.Affinity{
+						NodeAffinity:    &corev1.NodeAffinity{},
+						PodAntiAffinity: &corev1.PodAntiAffinity{},
+					},
+					Containers: []corev1.Container{{Name: "figlet", Image: "ghcr.io/openfaas/figlet:0.1.0"}},
+				},
+			},
+		},
+	}
+}
+
+func Test_MakePrewarmDaemonSet(t *testing.T) {
+	daemonset := MakePrewarmDaemonSet(newPrewarmStatefulSet(nil), "")
+
+	if daemonset.Name != "figlet-prewarm" {
+		t.Errorf("want name figlet-prewarm, got %s", daemonset.Name)
+	}
+	if _, ok := daemonset.Spec.Template.Labels["faas_function"]; ok {
+		t.Errorf("want no faas_function label on the Pods, got %v", daemonset.Spec.Template.Labels)
+	}
+	if len(daemonset.OwnerReferences) != 1 || daemonset.OwnerReferences[0].UID != "1234" {
+		t.Errorf("want the DaemonSet to be owned by the StatefulSet, got %v", daemonset.OwnerReferences)
+	}
+
+	spec := daemonset.Spec.Template.Spec
+	if spec.NodeSelector["kubernetes.io/arch"] != "arm64" {
+		t.Errorf("want the node selector of the function, got %v", spec.NodeSelector)
+	}
+	if len(spec.ImagePullSecrets) != 1 || spec.ImagePullSecrets[0].Name != "registry" {
+		t.Errorf("want the image pull secrets of the function, got %v", spec.ImagePullSecrets)
+	}
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil || spec.Affinity.PodAntiAffinity != nil {
+		t.Errorf("want only the node affinity of the function, got %+v", spec.Affinity)
+	}
+
+	pull := spec.InitContainers[1]
+	if pull.Image != "ghcr.io/openfaas/figlet:0.1.0" {
+		t.Errorf("want the function image to be pulled, got %s", pull.Image)
+	}
+	if len(pull.Command) != 2 || pull.Command[0] != "/prewarm/busybox" {
+		t.Errorf("want the function image to run busybox, got %v", pull.Command)
+	}
+	if got := spec.Containers[0].Image; got != DefaultPrewarmImage {
+		t.Errorf("want the default pre-warm image, got %s", got)
+	}
+}
+
+func Test_SyncPrewarm(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	statefulset := newPrewarmStatefulSet(map[string]string{LabelPrewarm: "true"})
+	if err := SyncPrewarm(ctx, client, statefulset, "", map[string]string{"team": "payments"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	created, err := client.AppsV1().DaemonSets("openfaas-fn").Get(ctx, "figlet-prewarm", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want the DaemonSet to be created, got %s", err)
+	}
+	if created.Labels["team"] != "payments" {
+		t.Errorf("want the cost labels on the DaemonSet, got %v", created.Labels)
+	}
+
+	statefulset.Spec.Template.Spec.Containers[0].Image = "ghcr.io/openfaas/figlet:0.2.0"
+	if err := SyncPrewarm(ctx, client, statefulset, "", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	updated, _ := client.AppsV1().DaemonSets("openfaas-fn").Get(ctx, "figlet-prewarm", metav1.GetOptions{})
+	if got := updated.Spec.Template.Spec.InitContainers[1].Image; got != "ghcr.io/openfaas/figlet:0.2.0" {
+		t.Errorf("want the DaemonSet to pull the new image, got %s", got)
+	}
+
+	statefulset.Spec.Template.Labels = nil
+	if err := SyncPrewarm(ctx, client, statefulset, "", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := client.AppsV1().DaemonSets("openfaas-fn").Get(ctx, "figlet-prewarm", metav1.GetOptions{}); !IsNotFound(err) {
+		t.Errorf("want the DaemonSet to be removed with the label, got %v", err)
+	}
+
+	if err := SyncPrewarm(ctx, client, statefulset, "", nil); err != nil {
+		t.Errorf("want no error when there is no DaemonSet, got %s", err)
+	}
+}
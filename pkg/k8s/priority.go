@@ -0,0 +1,44 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// LabelPriority is the priority of a function while the cluster is saturated, a
+// higher value is more important. Functions without the label have a priority of 0.
+const LabelPriority = "com.openfaas.priority"
+
+// FunctionPriority returns the priority from the labels of a function, or of the
+// Pod template of its StatefulSet
+func FunctionPriority(labels map[string]string) (int32, error) {
+	value, ok := labels[LabelPriority]
+	if !ok {
+		return 0, nil
+	}
+
+	priority, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %q must be an integer", LabelPriority, value)
+	}
+	return int32(priority), nil
+}
+
+// IsPodUnschedulable is true for a Pod that is pending because the scheduler
+// found no node with room for it
+func IsPodUnschedulable(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodPending || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled {
+			return condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable
+		}
+	}
+	return false
+}
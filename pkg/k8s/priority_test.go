@@ -0,0 +1,70 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_FunctionPriority(t *testing.T) {
+	cases := []struct {
+		name    string
+		labels  map[string]string
+		want    int32
+		wantErr bool
+	}{
+		{name: "default", want: 0},
+		{name: "high", labels: map[string]string{LabelPriority: "100"}, want: 100},
+		{name: "negative", labels: map[string]string{LabelPriority: "-5"}, want: -5},
+		{name: "invalid", labels: map[string]string{LabelPriority: "high"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := FunctionPriority(c.labels)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("want error: %t, got: %v", c.wantErr, err)
+			}
+			if got != c.want {
+				t.Errorf("want %d, got %d", c.want, got)
+			}
+		})
+	}
+}
+
+func Test_IsPodUnschedulable(t *testing.T) {
+	unschedulable := corev1.PodCondition{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable}
+
+	cases := []struct {
+		name string
+		pod  corev1.Pod
+		want bool
+	}{
+		{
+			name: "unschedulable",
+			pod:  corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending, Conditions: []corev1.PodCondition{unschedulable}}},
+			want: true,
+		},
+		{
+			name: "pending for its image",
+			pod: corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending, Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+			}}},
+		},
+		{
+			name: "running",
+			pod:  corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := IsPodUnschedulable(&c.pod); got != c.want {
+				t.Errorf("want %t, got %t", c.want, got)
+			}
+		})
+	}
+}
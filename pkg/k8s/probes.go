@@ -4,60 +4,139 @@
 package k8s
 
 import (
+	"fmt"
 	"path/filepath"
+	"strings"
 
 	types "github.com/openfaas/faas-provider/types"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+const (
+	// AnnotationHealthType selects the probe of a function, one of ProbeHTTP,
+	// ProbeExec or ProbeTCP, for images that do not serve HTTP such as gRPC servers
+	// or queue consumers
+	AnnotationHealthType = "com.openfaas.health.type"
+	// AnnotationHealthExecCommand is the command of an exec probe, split on spaces,
+	// setting it uses an exec probe unless another type is selected
+	AnnotationHealthExecCommand = "com.openfaas.health.exec.command"
+
+	ProbeHTTP = "http"
+	ProbeExec = "exec"
+	ProbeTCP  = "tcp"
+)
+
 type FunctionProbes struct {
 	Liveness  *corev1.Probe
 	Readiness *corev1.Probe
 }
 
 // MakeProbes returns the liveness and readiness probes
-// by default the health check runs `cat /tmp/.lock` every ten seconds
+// by default the health check runs `cat /tmp/.lock` every ten seconds.
+// The port and HTTP health check path can be overridden with the
+// AnnotationPort and AnnotationHealthPath annotations of the function,
+// and the type of probe with the AnnotationHealthType.
 func (f *FunctionFactory) MakeProbes(r types.FunctionDeployment) (*FunctionProbes, error) {
-	var handler corev1.ProbeHandler
+	annotations := map[string]string{}
+	if r.Annotations != nil {
+		annotations = *r.Annotations
+	}
 
-	if f.Config.HTTPProbe {
-		handler = corev1.ProbeHandler{
-			HTTPGet: &corev1.HTTPGetAction{
-				Path: "/_/health",
-				Port: intstr.IntOrString{
-					Type:   intstr.Int,
-					IntVal: int32(f.Config.RuntimeHTTPPort),
-				},
-			},
-		}
-	} else {
-		path := filepath.Join("/tmp/", ".lock")
-		handler = corev1.ProbeHandler{
-			Exec: &corev1.ExecAction{
-				Command: []string{"cat", path},
-			},
-		}
+	config := f.Config.Current()
+	handler, err := ProbeHandler(annotations, config.HTTPProbe, config.RuntimeHTTPPort)
+	if err != nil {
+		return nil, err
 	}
 
 	probes := FunctionProbes{}
 	probes.Readiness = &corev1.Probe{
 		ProbeHandler:        handler,
-		InitialDelaySeconds: f.Config.ReadinessProbe.InitialDelaySeconds,
-		TimeoutSeconds:      int32(f.Config.ReadinessProbe.TimeoutSeconds),
-		PeriodSeconds:       int32(f.Config.ReadinessProbe.PeriodSeconds),
+		InitialDelaySeconds: config.ReadinessProbe.InitialDelaySeconds,
+		TimeoutSeconds:      int32(config.ReadinessProbe.TimeoutSeconds),
+		PeriodSeconds:       int32(config.ReadinessProbe.PeriodSeconds),
 		SuccessThreshold:    1,
 		FailureThreshold:    3,
 	}
 
 	probes.Liveness = &corev1.Probe{
 		ProbeHandler:        handler,
-		InitialDelaySeconds: f.Config.LivenessProbe.InitialDelaySeconds,
-		TimeoutSeconds:      int32(f.Config.LivenessProbe.TimeoutSeconds),
-		PeriodSeconds:       int32(f.Config.LivenessProbe.PeriodSeconds),
+		InitialDelaySeconds: config.LivenessProbe.InitialDelaySeconds,
+		TimeoutSeconds:      int32(config.LivenessProbe.TimeoutSeconds),
+		PeriodSeconds:       int32(config.LivenessProbe.PeriodSeconds),
 		SuccessThreshold:    1,
 		FailureThreshold:    3,
 	}
 
 	return &probes, nil
 }
+
+// ProbeHandler returns the handler of the probes of a function from its annotations.
+// Without the AnnotationHealthType, the probe is an HTTP probe when the health path
+// is set and an exec probe when the command is set, otherwise httpProbe selects
+// between the HTTP probe of the watchdog and `cat /tmp/.lock`.
+func ProbeHandler(annotations map[string]string, httpProbe bool, defaultPort int32) (corev1.ProbeHandler, error) {
+	port, err := FunctionPort(annotations, defaultPort)
+	if err != nil {
+		return corev1.ProbeHandler{}, err
+	}
+	healthPath, err := HealthPath(annotations)
+	if err != nil {
+		return corev1.ProbeHandler{}, err
+	}
+	command, hasCommand := annotations[AnnotationHealthExecCommand]
+
+	probeType, ok := annotations[AnnotationHealthType]
+	switch {
+	case ok:
+	case healthPath != "":
+		probeType = ProbeHTTP
+	case hasCommand:
+		probeType = ProbeExec
+	case httpProbe:
+		probeType = ProbeHTTP
+	default:
+		probeType = ProbeExec
+	}
+
+	switch probeType {
+	case ProbeHTTP:
+		if healthPath == "" {
+			healthPath = defaultHealthPath
+		}
+		return corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: healthPath,
+				Port: intstr.IntOrString{
+					Type:   intstr.Int,
+					IntVal: port,
+				},
+			},
+		}, nil
+	case ProbeExec:
+		args := []string{"cat", filepath.Join("/tmp/", ".lock")}
+		if hasCommand {
+			args = strings.Fields(command)
+			if len(args) == 0 {
+				return corev1.ProbeHandler{}, fmt.Errorf("%s must not be empty", AnnotationHealthExecCommand)
+			}
+		}
+		return corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: args,
+			},
+		}, nil
+	case ProbeTCP:
+		return corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.IntOrString{
+					Type:   intstr.Int,
+					IntVal: port,
+				},
+			},
+		}, nil
+	}
+
+	return corev1.ProbeHandler{}, fmt.Errorf("%s must be one of %s, %s or %s, got %q",
+		AnnotationHealthType, ProbeHTTP, ProbeExec, ProbeTCP, probeType)
+}
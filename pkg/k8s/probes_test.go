@@ -4,9 +4,11 @@
 package k8s
 
 import (
+	"strings"
 	"testing"
 
 	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func Test_makeProbes_useExec(t *testing.T) {
@@ -100,3 +102,101 @@ func Test_makeProbes_useCustomDurationHTTPProbe(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_makeProbes_annotatedPortAndHealthPath(t *testing.T) {
+	f := mockFactory()
+
+	request := types.FunctionDeployment{
+		Service: "testfunc",
+		Annotations: &map[string]string{
+			AnnotationPort:       "3000",
+			AnnotationHealthPath: "/healthz",
+		},
+	}
+
+	probes, err := f.MakeProbes(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, probe := range []*corev1.Probe{probes.Readiness, probes.Liveness} {
+		if probe.HTTPGet == nil {
+			t.Fatalf("want an HTTPGet handler when the health path is set, got %+v", probe.ProbeHandler)
+		}
+		if probe.HTTPGet.Path != "/healthz" || probe.HTTPGet.Port.IntVal != 3000 {
+			t.Errorf("want /healthz on port 3000, got %s on port %d", probe.HTTPGet.Path, probe.HTTPGet.Port.IntVal)
+		}
+	}
+}
+
+func Test_makeProbes_invalidAnnotations(t *testing.T) {
+	f := mockFactory()
+
+	for _, annotations := range []map[string]string{
+		{AnnotationPort: "http"},
+		{AnnotationPort: "70000"},
+		{AnnotationHealthPath: "healthz"},
+		{AnnotationHealthType: "grpc"},
+		{AnnotationHealthExecCommand: " "},
+	} {
+		request := types.FunctionDeployment{Service: "testfunc", Annotations: &annotations}
+		if _, err := f.MakeProbes(request); err == nil {
+			t.Errorf("want an error for %v", annotations)
+		}
+	}
+}
+
+func Test_makeProbes_annotatedType(t *testing.T) {
+	f := mockFactory()
+	f.Config.HTTPProbe = true
+	f.Config.RuntimeHTTPPort = 8080
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		check       func(corev1.ProbeHandler) bool
+	}{
+		{
+			name:        "tcp on the watchdog port",
+			annotations: map[string]string{AnnotationHealthType: ProbeTCP},
+			check: func(h corev1.ProbeHandler) bool {
+				return h.TCPSocket != nil && h.TCPSocket.Port.IntVal == 8080
+			},
+		},
+		{
+			name:        "tcp on the annotated port",
+			annotations: map[string]string{AnnotationHealthType: ProbeTCP, AnnotationPort: "50051"},
+			check: func(h corev1.ProbeHandler) bool {
+				return h.TCPSocket != nil && h.TCPSocket.Port.IntVal == 50051
+			},
+		},
+		{
+			name:        "exec with the default command",
+			annotations: map[string]string{AnnotationHealthType: ProbeExec},
+			check: func(h corev1.ProbeHandler) bool {
+				return h.Exec != nil && strings.Join(h.Exec.Command, " ") == "cat /tmp/.lock"
+			},
+		},
+		{
+			name:        "exec command without a type",
+			annotations: map[string]string{AnnotationHealthExecCommand: "/bin/grpc_health_probe -addr=:50051"},
+			check: func(h corev1.ProbeHandler) bool {
+				return h.Exec != nil && len(h.Exec.Command) == 2 && h.Exec.Command[0] == "/bin/grpc_health_probe"
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := types.FunctionDeployment{Service: "testfunc", Annotations: &tc.annotations}
+
+			probes, err := f.MakeProbes(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.check(probes.Readiness.ProbeHandler) || !tc.check(probes.Liveness.ProbeHandler) {
+				t.Errorf("unexpected probe handler %+v", probes.Readiness.ProbeHandler)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package k8s
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	v1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
@@ -13,6 +15,14 @@ import (
 
 const ProfileAnnotationKey = "com.openfaas.profile"
 
+const (
+	// AnnotationProfileVolumes and AnnotationProfileVolumeMounts record the names of
+	// the volumes and volumeMounts that were added by Profiles, so that removing a
+	// Profile never removes those of the function itself
+	AnnotationProfileVolumes      = "com.openfaas.profile.volumes"
+	AnnotationProfileVolumeMounts = "com.openfaas.profile.volume-mounts"
+)
+
 // ProfileClient defines the interface for CRUD operations on profiles
 // and applying faas-netes profiles to function Deployments.
 type ProfileClient interface {
@@ -37,6 +47,9 @@ func (c profileCRDClient) Get(ctx context.Context, namespace string, names ...st
 		// Note Lister interfaces do not have context yet
 		profile, err := c.client.Profiles(namespace).Get(name)
 		if err != nil {
+			if IsNotFound(err) {
+				return nil, &ProfileNotFoundError{Namespace: namespace, Name: name, Err: err}
+			}
 			return nil, err
 		}
 		resp = append(resp, Profile(profile.Spec))
@@ -51,7 +64,8 @@ func (f FunctionFactory) NewProfileClient() ProfileClient {
 }
 
 // GetProfiles retrieves in the names string, names is the raw csv value in the
-// function annotation
+// function annotation. A ProfileNotFoundError is returned when any of the
+// referenced Profiles does not exist.
 func (f FunctionFactory) GetProfiles(ctx context.Context, namespace string, annotations map[string]string) ([]Profile, error) {
 	if len(annotations) == 0 {
 		return nil, nil
@@ -115,12 +129,66 @@ func ProfilesToRemove(requested, existing map[string]string) []string {
 	return toRemove
 }
 
-// ApplyProfile adds or mutates the configuration of the Deployment with the values defined
-// in the Profile. Profiles are not merged, if two profiles are applied, the last Profile will
-// override preceding Profiles with overlapping configurations.
-func (f FunctionFactory) ApplyProfile(profile Profile, statefulset *appsv1.StatefulSet) {
-	if len(profile.Tolerations) > 0 {
-		statefulset.Spec.Template.Spec.Tolerations = append(statefulset.Spec.Template.Spec.Tolerations, profile.Tolerations...)
+// ApplyProfile adds or mutates the configuration of the StatefulSet with the values defined
+// in the Profile. When more than one Profile is requested, they are applied in the order
+// they are listed in the `com.openfaas.profile` annotation using these precedence rules:
+//
+//   - list values (tolerations, topologySpreadConstraints) are merged, a value that is
+//     already present is not added a second time
+//   - named values (volumes, volumeMounts) are merged by name, a later Profile replaces an
+//     entry with the same name. An error is returned when the function itself already has
+//     a different entry with that name, the names added by Profiles are recorded in the
+//     AnnotationProfileVolumes and AnnotationProfileVolumeMounts annotations
+//   - single values (runtimeClassName, priorityClassName, affinity, spiffe, appArmor) are
+//     replaced, the last Profile wins
+//   - each non-nil field of the podSecurityContext is merged, the last Profile wins
+//
+// Use ProfileConflicts to detect when the requested Profiles set the same field.
+func (f FunctionFactory) ApplyProfile(profile Profile, statefulset *appsv1.StatefulSet) error {
+	ownedVolumes := splitKeys(statefulset.Annotations[AnnotationProfileVolumes])
+	for _, volume := range profile.Volumes {
+		for _, existing := range statefulset.Spec.Template.Spec.Volumes {
+			if existing.Name == volume.Name && !contains(ownedVolumes, volume.Name) && !reflect.DeepEqual(existing, volume) {
+				return fmt.Errorf("profile volume %s conflicts with a volume of the function", volume.Name)
+			}
+		}
+	}
+
+	var ownedMounts []string
+	if len(profile.VolumeMounts) > 0 && len(statefulset.Spec.Template.Spec.Containers) > 0 {
+		ownedMounts = splitKeys(statefulset.Annotations[AnnotationProfileVolumeMounts])
+		for _, mount := range profile.VolumeMounts {
+			for _, existing := range statefulset.Spec.Template.Spec.Containers[0].VolumeMounts {
+				if existing.Name == mount.Name && !contains(ownedMounts, mount.Name) && !reflect.DeepEqual(existing, mount) {
+					return fmt.Errorf("profile volumeMount %s conflicts with a volumeMount of the function", mount.Name)
+				}
+			}
+		}
+	}
+
+	for _, toleration := range profile.Tolerations {
+		if !containsToleration(statefulset.Spec.Template.Spec.Tolerations, toleration) {
+			statefulset.Spec.Template.Spec.Tolerations = append(statefulset.Spec.Template.Spec.Tolerations, toleration)
+		}
+	}
+
+	for _, constraint := range profile.TopologySpreadConstraints {
+		if !containsTopologySpreadConstraint(statefulset.Spec.Template.Spec.TopologySpreadConstraints, constraint) {
+			statefulset.Spec.Template.Spec.TopologySpreadConstraints = append(statefulset.Spec.Template.Spec.TopologySpreadConstraints, *constraint.DeepCopy())
+		}
+	}
+
+	if profile.RuntimeClassName != nil {
+		runtimeClassName := *profile.RuntimeClassName
+		statefulset.Spec.Template.Spec.RuntimeClassName = &runtimeClassName
+	}
+
+	if profile.PriorityClassName != nil {
+		statefulset.Spec.Template.Spec.PriorityClassName = *profile.PriorityClassName
+	}
+
+	if profile.Affinity != nil {
+		statefulset.Spec.Template.Spec.Affinity = profile.Affinity.DeepCopy()
 	}
 
 	if profile.PodSecurityContext != nil {
@@ -128,8 +196,35 @@ func (f FunctionFactory) ApplyProfile(profile Profile, statefulset *appsv1.State
 			statefulset.Spec.Template.Spec.SecurityContext = &corev1.PodSecurityContext{}
 		}
 
-		profile.PodSecurityContext.DeepCopyInto(statefulset.Spec.Template.Spec.SecurityContext)
+		mergePodSecurityContext(statefulset.Spec.Template.Spec.SecurityContext, profile.PodSecurityContext)
+	}
+
+	for _, volume := range profile.Volumes {
+		volumes := removeVolume(volume.Name, statefulset.Spec.Template.Spec.Volumes)
+		statefulset.Spec.Template.Spec.Volumes = append(volumes, volume)
+		ownedVolumes = addKey(ownedVolumes, volume.Name)
+	}
+	setProfileKeys(statefulset, AnnotationProfileVolumes, ownedVolumes)
+
+	if len(profile.VolumeMounts) > 0 && len(statefulset.Spec.Template.Spec.Containers) > 0 {
+		container := &statefulset.Spec.Template.Spec.Containers[0]
+		for _, mount := range profile.VolumeMounts {
+			mounts := removeVolumeMount(mount.Name, container.VolumeMounts)
+			container.VolumeMounts = append(mounts, mount)
+			ownedMounts = addKey(ownedMounts, mount.Name)
+		}
+		setProfileKeys(statefulset, AnnotationProfileVolumeMounts, ownedMounts)
+	}
+
+	if profile.SPIFFE != nil {
+		applySPIFFE(profile.SPIFFE, statefulset)
 	}
+
+	if profile.AppArmor != nil {
+		applyAppArmor(profile.AppArmor, statefulset)
+	}
+
+	return nil
 }
 
 // RemoveProfile is the inverse of Apply, removing the mutations that the Profile would have applied
@@ -148,13 +243,45 @@ func (f FunctionFactory) RemoveProfile(profile Profile, statefulset *appsv1.Stat
 		statefulset.Spec.Template.Spec.Tolerations = newTolerations
 	}
 
-	if profile.PodSecurityContext != nil {
+	for _, profileConstraint := range profile.TopologySpreadConstraints {
+		newConstraints := statefulset.Spec.Template.Spec.TopologySpreadConstraints[:0]
+		for _, constraint := range statefulset.Spec.Template.Spec.TopologySpreadConstraints {
+			if !reflect.DeepEqual(profileConstraint, constraint) {
+				newConstraints = append(newConstraints, constraint)
+			}
+		}
+
+		statefulset.Spec.Template.Spec.TopologySpreadConstraints = newConstraints
+	}
+
+	// only reset values that still match the Profile, otherwise they have been
+	// set by another Profile or the function itself
+	if profile.Affinity != nil {
+		if reflect.DeepEqual(profile.Affinity, statefulset.Spec.Template.Spec.Affinity) {
+			statefulset.Spec.Template.Spec.Affinity = nil
+		}
+	}
+
+	if profile.RuntimeClassName != nil {
+		current := statefulset.Spec.Template.Spec.RuntimeClassName
+		if current != nil && *current == *profile.RuntimeClassName {
+			statefulset.Spec.Template.Spec.RuntimeClassName = nil
+		}
+	}
+
+	if profile.PriorityClassName != nil {
+		if statefulset.Spec.Template.Spec.PriorityClassName == *profile.PriorityClassName {
+			statefulset.Spec.Template.Spec.PriorityClassName = ""
+		}
+	}
+
+	if profile.PodSecurityContext != nil && statefulset.Spec.Template.Spec.SecurityContext != nil {
 		sc := statefulset.Spec.Template.Spec.SecurityContext
 
 		if reflect.DeepEqual(profile.PodSecurityContext.SELinuxOptions, sc.SELinuxOptions) {
 			statefulset.Spec.Template.Spec.SecurityContext.SELinuxOptions = nil
 		}
-		if reflect.DeepEqual(profile.PodSecurityContext.SELinuxOptions, sc.WindowsOptions) {
+		if reflect.DeepEqual(profile.PodSecurityContext.WindowsOptions, sc.WindowsOptions) {
 			statefulset.Spec.Template.Spec.SecurityContext.WindowsOptions = nil
 		}
 		if profile.PodSecurityContext.RunAsUser != nil {
@@ -176,4 +303,202 @@ func (f FunctionFactory) RemoveProfile(profile Profile, statefulset *appsv1.Stat
 			statefulset.Spec.Template.Spec.SecurityContext.Sysctls = nil
 		}
 	}
+
+	// only the volumes and volumeMounts recorded as added by a Profile are removed,
+	// those of the function are kept even when they have the same name
+	ownedVolumes := splitKeys(statefulset.Annotations[AnnotationProfileVolumes])
+	for _, volume := range profile.Volumes {
+		if contains(ownedVolumes, volume.Name) {
+			statefulset.Spec.Template.Spec.Volumes = removeVolume(volume.Name, statefulset.Spec.Template.Spec.Volumes)
+			ownedVolumes = removeKey(ownedVolumes, volume.Name)
+		}
+	}
+	setProfileKeys(statefulset, AnnotationProfileVolumes, ownedVolumes)
+
+	if len(statefulset.Spec.Template.Spec.Containers) > 0 {
+		container := &statefulset.Spec.Template.Spec.Containers[0]
+		ownedMounts := splitKeys(statefulset.Annotations[AnnotationProfileVolumeMounts])
+		for _, mount := range profile.VolumeMounts {
+			if contains(ownedMounts, mount.Name) {
+				container.VolumeMounts = removeVolumeMount(mount.Name, container.VolumeMounts)
+				ownedMounts = removeKey(ownedMounts, mount.Name)
+			}
+		}
+		setProfileKeys(statefulset, AnnotationProfileVolumeMounts, ownedMounts)
+	}
+
+	if profile.SPIFFE != nil {
+		removeSPIFFE(profile.SPIFFE, statefulset)
+	}
+
+	if profile.AppArmor != nil {
+		removeAppArmor(profile.AppArmor, statefulset)
+	}
+}
+
+// ProfileConflict describes a field that is set to different values by more than one of
+// the Profiles requested by a function.
+type ProfileConflict struct {
+	// Field is the path of the Profile field using the json names, e.g. `runtimeClassName`
+	// or `podSecurityContext.runAsUser`
+	Field string
+	// Profiles are the names of the Profiles that set the field, in the order they were
+	// applied, the value from the last Profile is used
+	Profiles []string
+}
+
+func (c ProfileConflict) String() string {
+	return fmt.Sprintf("%s is set by profiles %s, the value from %s is used",
+		c.Field, strings.Join(c.Profiles, ", "), c.Profiles[len(c.Profiles)-1])
+}
+
+// ProfileConflicts returns the fields that are set to different values by more than one
+// of the Profiles. The profiles must be in the same order as the names in the profile
+// annotation, as returned by GetProfiles. Merged list values such as tolerations are never
+// considered to be a conflict. The result is sorted by Field.
+func ProfileConflicts(annotations map[string]string, profiles []Profile) []ProfileConflict {
+	names := ParseProfileNames(annotations)
+
+	type setBy struct {
+		profile string
+		value   interface{}
+	}
+	fields := map[string][]setBy{}
+	record := func(field, profile string, value interface{}) {
+		fields[field] = append(fields[field], setBy{profile: profile, value: value})
+	}
+
+	for idx, profile := range profiles {
+		name := fmt.Sprintf("#%d", idx)
+		if idx < len(names) {
+			name = names[idx]
+		}
+
+		if profile.RuntimeClassName != nil {
+			record("runtimeClassName", name, *profile.RuntimeClassName)
+		}
+		if profile.PriorityClassName != nil {
+			record("priorityClassName", name, *profile.PriorityClassName)
+		}
+		if profile.Affinity != nil {
+			record("affinity", name, profile.Affinity)
+		}
+		if profile.PodSecurityContext != nil {
+			sc := reflect.ValueOf(profile.PodSecurityContext).Elem()
+			for i := 0; i < sc.NumField(); i++ {
+				if sc.Field(i).IsZero() {
+					continue
+				}
+				tag := strings.Split(sc.Type().Field(i).Tag.Get("json"), ",")[0]
+				record("podSecurityContext."+tag, name, sc.Field(i).Interface())
+			}
+		}
+		for _, volume := range profile.Volumes {
+			record(fmt.Sprintf("volumes[%s]", volume.Name), name, volume)
+		}
+		for _, mount := range profile.VolumeMounts {
+			record(fmt.Sprintf("volumeMounts[%s]", mount.Name), name, mount)
+		}
+		if profile.SPIFFE != nil {
+			record("spiffe", name, profile.SPIFFE)
+		}
+		if profile.AppArmor != nil {
+			record("appArmor", name, profile.AppArmor)
+		}
+	}
+
+	conflicts := []ProfileConflict{}
+	for field, values := range fields {
+		if len(values) < 2 {
+			continue
+		}
+
+		conflicting := false
+		for _, v := range values[1:] {
+			if !reflect.DeepEqual(values[0].value, v.value) {
+				conflicting = true
+				break
+			}
+		}
+		if !conflicting {
+			continue
+		}
+
+		conflict := ProfileConflict{Field: field}
+		for _, v := range values {
+			conflict.Profiles = append(conflict.Profiles, v.profile)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Field < conflicts[j].Field
+	})
+
+	return conflicts
+}
+
+// setProfileKeys records the names in the annotation of the StatefulSet, the
+// annotation is removed when there are none
+func setProfileKeys(statefulset *appsv1.StatefulSet, annotation string, names []string) {
+	if len(names) == 0 {
+		if _, ok := statefulset.Annotations[annotation]; ok {
+			annotations := cloneStringMap(statefulset.Annotations)
+			delete(annotations, annotation)
+			statefulset.Annotations = annotations
+		}
+		return
+	}
+
+	annotations := cloneStringMap(statefulset.Annotations)
+	annotations[annotation] = strings.Join(names, ",")
+	statefulset.Annotations = annotations
+}
+
+func addKey(keys []string, key string) []string {
+	if contains(keys, key) {
+		return keys
+	}
+	keys = append(keys, key)
+	sort.Strings(keys)
+	return keys
+}
+
+func removeKey(keys []string, key string) []string {
+	kept := keys[:0]
+	for _, k := range keys {
+		if k != key {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+// mergePodSecurityContext copies each non-nil field of src into dst
+func mergePodSecurityContext(dst, src *corev1.PodSecurityContext) {
+	in := reflect.ValueOf(src.DeepCopy()).Elem()
+	out := reflect.ValueOf(dst).Elem()
+	for i := 0; i < in.NumField(); i++ {
+		if !in.Field(i).IsZero() {
+			out.Field(i).Set(in.Field(i))
+		}
+	}
+}
+
+func containsToleration(tolerations []corev1.Toleration, toleration corev1.Toleration) bool {
+	for _, t := range tolerations {
+		if reflect.DeepEqual(t, toleration) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTopologySpreadConstraint(constraints []corev1.TopologySpreadConstraint, constraint corev1.TopologySpreadConstraint) bool {
+	for _, c := range constraints {
+		if reflect.DeepEqual(c, constraint) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,12 +1,18 @@
 package k8s
 
 import (
+	"context"
 	"reflect"
+	"strings"
 	"testing"
 
+	v1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	faasfake "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/fake"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 const testProfile = `
@@ -288,6 +294,558 @@ func Test_PodSecurityProfile_Remove(t *testing.T) {
 	}
 }
 
+func Test_RuntimeAndPriorityClassProfile_Apply(t *testing.T) {
+	runtimeClass := "gvisor"
+	priorityClass := "critical"
+	p := Profile{RuntimeClassName: &runtimeClass, PriorityClassName: &priorityClass}
+
+	basicStatefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest"},
+					},
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.ApplyProfile(p, basicStatefulset)
+
+	spec := basicStatefulset.Spec.Template.Spec
+	if spec.RuntimeClassName == nil || *spec.RuntimeClassName != runtimeClass {
+		t.Fatalf("expected runtimeClassName %q, got %v", runtimeClass, spec.RuntimeClassName)
+	}
+	if spec.PriorityClassName != priorityClass {
+		t.Fatalf("expected priorityClassName %q, got %q", priorityClass, spec.PriorityClassName)
+	}
+}
+
+func Test_RuntimeAndPriorityClassProfile_Remove(t *testing.T) {
+	runtimeClass := "gvisor"
+	priorityClass := "critical"
+	p := Profile{RuntimeClassName: &runtimeClass, PriorityClassName: &priorityClass}
+
+	otherRuntimeClass := "kata"
+	basicStatefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest"},
+					},
+					RuntimeClassName:  &otherRuntimeClass,
+					PriorityClassName: priorityClass,
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.RemoveProfile(p, basicStatefulset)
+
+	spec := basicStatefulset.Spec.Template.Spec
+	if spec.RuntimeClassName == nil || *spec.RuntimeClassName != otherRuntimeClass {
+		t.Fatalf("expected runtimeClassName set by another source to be kept, got %v", spec.RuntimeClassName)
+	}
+	if spec.PriorityClassName != "" {
+		t.Fatalf("expected priorityClassName to be removed, got %q", spec.PriorityClassName)
+	}
+}
+
+func Test_VolumesProfile_Apply(t *testing.T) {
+	caBundle := corev1.Volume{
+		Name: "ca-bundle",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "ca-bundle"},
+			},
+		},
+	}
+	caMount := corev1.VolumeMount{Name: "ca-bundle", MountPath: "/etc/ssl/certs", ReadOnly: true}
+
+	p := Profile{
+		Volumes:      []corev1.Volume{caBundle},
+		VolumeMounts: []corev1.VolumeMount{caMount},
+	}
+
+	tmpVolume := corev1.Volume{Name: "temp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	tmpMount := corev1.VolumeMount{Name: "temp", MountPath: "/tmp"}
+	basicStatefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest", VolumeMounts: []corev1.VolumeMount{tmpMount}},
+					},
+					Volumes: []corev1.Volume{tmpVolume},
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.ApplyProfile(p, basicStatefulset)
+	// applying the same profile twice must not duplicate the volume or mount
+	factory.ApplyProfile(p, basicStatefulset)
+
+	expectedVolumes := []corev1.Volume{tmpVolume, caBundle}
+	gotVolumes := basicStatefulset.Spec.Template.Spec.Volumes
+	if !reflect.DeepEqual(expectedVolumes, gotVolumes) {
+		t.Fatalf("expected volumes %+v\n got %+v", expectedVolumes, gotVolumes)
+	}
+
+	expectedMounts := []corev1.VolumeMount{tmpMount, caMount}
+	gotMounts := basicStatefulset.Spec.Template.Spec.Containers[0].VolumeMounts
+	if !reflect.DeepEqual(expectedMounts, gotMounts) {
+		t.Fatalf("expected mounts %+v\n got %+v", expectedMounts, gotMounts)
+	}
+}
+
+func Test_VolumesProfile_Remove(t *testing.T) {
+	caBundle := corev1.Volume{
+		Name: "ca-bundle",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "ca-bundle"},
+			},
+		},
+	}
+	caMount := corev1.VolumeMount{Name: "ca-bundle", MountPath: "/etc/ssl/certs", ReadOnly: true}
+
+	p := Profile{
+		Volumes:      []corev1.Volume{caBundle},
+		VolumeMounts: []corev1.VolumeMount{caMount},
+	}
+
+	tmpVolume := corev1.Volume{Name: "temp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	tmpMount := corev1.VolumeMount{Name: "temp", MountPath: "/tmp"}
+	basicStatefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				AnnotationProfileVolumes:      "ca-bundle",
+				AnnotationProfileVolumeMounts: "ca-bundle",
+			},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest", VolumeMounts: []corev1.VolumeMount{tmpMount, caMount}},
+					},
+					Volumes: []corev1.Volume{tmpVolume, caBundle},
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.RemoveProfile(p, basicStatefulset)
+
+	expectedVolumes := []corev1.Volume{tmpVolume}
+	gotVolumes := basicStatefulset.Spec.Template.Spec.Volumes
+	if !reflect.DeepEqual(expectedVolumes, gotVolumes) {
+		t.Fatalf("expected volumes %+v\n got %+v", expectedVolumes, gotVolumes)
+	}
+
+	expectedMounts := []corev1.VolumeMount{tmpMount}
+	gotMounts := basicStatefulset.Spec.Template.Spec.Containers[0].VolumeMounts
+	if !reflect.DeepEqual(expectedMounts, gotMounts) {
+		t.Fatalf("expected mounts %+v\n got %+v", expectedMounts, gotMounts)
+	}
+
+	if _, ok := basicStatefulset.Annotations[AnnotationProfileVolumes]; ok {
+		t.Errorf("want the record of the profile volumes to be removed, got %v", basicStatefulset.Annotations)
+	}
+}
+
+func Test_VolumesProfile_KeepsVolumesOfTheFunction(t *testing.T) {
+	tmpVolume := corev1.Volume{Name: "temp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	tmpMount := corev1.VolumeMount{Name: "temp", MountPath: "/tmp"}
+	newStatefulSet := func() *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			Spec: appsv1.StatefulSetSpec{
+				Template: apiv1.PodTemplateSpec{
+					Spec: apiv1.PodSpec{
+						Containers: []apiv1.Container{
+							{Name: "testfunc", Image: "alpine:latest", VolumeMounts: []corev1.VolumeMount{tmpMount}},
+						},
+						Volumes: []corev1.Volume{tmpVolume},
+					},
+				},
+			},
+		}
+	}
+
+	factory := mockFactory()
+
+	// a Profile volume with the name of a volume of the function is rejected
+	memoryVolume := corev1.Volume{Name: "temp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}}}
+	statefulset := newStatefulSet()
+	if err := factory.ApplyProfile(Profile{Volumes: []corev1.Volume{memoryVolume}}, statefulset); err == nil {
+		t.Fatalf("want an error for a profile volume with the name of a volume of the function")
+	}
+	if !reflect.DeepEqual([]corev1.Volume{tmpVolume}, statefulset.Spec.Template.Spec.Volumes) {
+		t.Errorf("want the volume of the function to be kept, got %+v", statefulset.Spec.Template.Spec.Volumes)
+	}
+
+	// removing a Profile only removes what it added
+	statefulset = newStatefulSet()
+	p := Profile{
+		Volumes:      []corev1.Volume{tmpVolume},
+		VolumeMounts: []corev1.VolumeMount{tmpMount},
+	}
+	factory.RemoveProfile(p, statefulset)
+	if !reflect.DeepEqual([]corev1.Volume{tmpVolume}, statefulset.Spec.Template.Spec.Volumes) {
+		t.Errorf("want the volume of the function to be kept, got %+v", statefulset.Spec.Template.Spec.Volumes)
+	}
+	if !reflect.DeepEqual([]corev1.VolumeMount{tmpMount}, statefulset.Spec.Template.Spec.Containers[0].VolumeMounts) {
+		t.Errorf("want the mount of the function to be kept, got %+v", statefulset.Spec.Template.Spec.Containers[0].VolumeMounts)
+	}
+}
+
+func Test_SPIFFEProfile_Apply(t *testing.T) {
+	p := Profile{
+		SPIFFE: &v1.SPIFFE{
+			Labels: map[string]string{"spiffe.io/spire-managed-identity": "true"},
+		},
+	}
+
+	labels := map[string]string{"faas_function": "testfunc"}
+	basicStatefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest", Env: []corev1.EnvVar{{Name: "write_debug", Value: "true"}}},
+					},
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.ApplyProfile(p, basicStatefulset)
+	// applying the same profile twice must not duplicate the volume, mount or env
+	factory.ApplyProfile(p, basicStatefulset)
+
+	if got := basicStatefulset.Spec.Template.Labels["spiffe.io/spire-managed-identity"]; got != "true" {
+		t.Fatalf("expected the SPIRE label on the Pod template, got %q", got)
+	}
+	if _, ok := basicStatefulset.Spec.Selector.MatchLabels["spiffe.io/spire-managed-identity"]; ok {
+		t.Fatalf("the selector must not be changed")
+	}
+
+	readOnly := true
+	expectedVolumes := []corev1.Volume{{
+		Name:         SPIFFEVolumeName,
+		VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "csi.spiffe.io", ReadOnly: &readOnly}},
+	}}
+	if got := basicStatefulset.Spec.Template.Spec.Volumes; !reflect.DeepEqual(expectedVolumes, got) {
+		t.Fatalf("expected volumes %+v\n got %+v", expectedVolumes, got)
+	}
+
+	container := basicStatefulset.Spec.Template.Spec.Containers[0]
+	expectedMounts := []corev1.VolumeMount{{Name: SPIFFEVolumeName, MountPath: "/spiffe-workload-api", ReadOnly: true}}
+	if !reflect.DeepEqual(expectedMounts, container.VolumeMounts) {
+		t.Fatalf("expected mounts %+v\n got %+v", expectedMounts, container.VolumeMounts)
+	}
+
+	expectedEnv := []corev1.EnvVar{
+		{Name: "write_debug", Value: "true"},
+		{Name: "SPIFFE_ENDPOINT_SOCKET", Value: "unix:///spiffe-workload-api/spire-agent.sock"},
+	}
+	if !reflect.DeepEqual(expectedEnv, container.Env) {
+		t.Fatalf("expected env %+v\n got %+v", expectedEnv, container.Env)
+	}
+}
+
+func Test_SPIFFEProfile_HostPath(t *testing.T) {
+	p := Profile{
+		SPIFFE: &v1.SPIFFE{HostPath: "/run/spire/sockets", SocketName: "agent.sock"},
+	}
+
+	basicStatefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{Name: "testfunc", Image: "alpine:latest"}},
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.ApplyProfile(p, basicStatefulset)
+
+	volume := basicStatefulset.Spec.Template.Spec.Volumes[0]
+	if volume.HostPath == nil || volume.HostPath.Path != "/run/spire/sockets" || volume.CSI != nil {
+		t.Fatalf("expected a hostPath volume, got %+v", volume)
+	}
+
+	env := basicStatefulset.Spec.Template.Spec.Containers[0].Env
+	if len(env) != 1 || env[0].Value != "unix:///spiffe-workload-api/agent.sock" {
+		t.Fatalf("expected the socket name in %s, got %+v", SPIFFEEndpointSocketEnv, env)
+	}
+}
+
+func Test_SPIFFEProfile_Remove(t *testing.T) {
+	p := Profile{
+		SPIFFE: &v1.SPIFFE{
+			Labels: map[string]string{"spiffe.io/spire-managed-identity": "true"},
+		},
+	}
+
+	tmpVolume := corev1.Volume{Name: "temp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	tmpMount := corev1.VolumeMount{Name: "temp", MountPath: "/tmp"}
+	basicStatefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"faas_function": "testfunc"}},
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest", VolumeMounts: []corev1.VolumeMount{tmpMount}},
+					},
+					Volumes: []corev1.Volume{tmpVolume},
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.ApplyProfile(p, basicStatefulset)
+	factory.RemoveProfile(p, basicStatefulset)
+
+	expectedLabels := map[string]string{"faas_function": "testfunc"}
+	if got := basicStatefulset.Spec.Template.Labels; !reflect.DeepEqual(expectedLabels, got) {
+		t.Fatalf("expected labels %+v\n got %+v", expectedLabels, got)
+	}
+
+	expectedVolumes := []corev1.Volume{tmpVolume}
+	if got := basicStatefulset.Spec.Template.Spec.Volumes; !reflect.DeepEqual(expectedVolumes, got) {
+		t.Fatalf("expected volumes %+v\n got %+v", expectedVolumes, got)
+	}
+
+	container := basicStatefulset.Spec.Template.Spec.Containers[0]
+	expectedMounts := []corev1.VolumeMount{tmpMount}
+	if !reflect.DeepEqual(expectedMounts, container.VolumeMounts) {
+		t.Fatalf("expected mounts %+v\n got %+v", expectedMounts, container.VolumeMounts)
+	}
+	if len(container.Env) != 0 {
+		t.Fatalf("expected %s to be removed, got %+v", SPIFFEEndpointSocketEnv, container.Env)
+	}
+}
+
+func Test_AppArmorProfile_Apply(t *testing.T) {
+	p := Profile{
+		AppArmor: &v1.AppArmor{Type: "Localhost", LocalhostProfile: "openfaas-function"},
+	}
+
+	basicStatefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"prometheus.io/scrape": "false"}},
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest"},
+						{Name: "log-shipper", Image: "fluent-bit:latest"},
+					},
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.ApplyProfile(p, basicStatefulset)
+
+	expected := map[string]string{
+		"prometheus.io/scrape": "false",
+		"container.apparmor.security.beta.kubernetes.io/testfunc":    "localhost/openfaas-function",
+		"container.apparmor.security.beta.kubernetes.io/log-shipper": "localhost/openfaas-function",
+	}
+	if got := basicStatefulset.Spec.Template.Annotations; !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected annotations %+v\n got %+v", expected, got)
+	}
+
+	factory.RemoveProfile(p, basicStatefulset)
+
+	expected = map[string]string{"prometheus.io/scrape": "false"}
+	if got := basicStatefulset.Spec.Template.Annotations; !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected annotations %+v\n got %+v", expected, got)
+	}
+}
+
+func Test_AppArmorProfile_RuntimeDefault(t *testing.T) {
+	for profileType, want := range map[string]string{
+		"RuntimeDefault": "runtime/default",
+		"Unconfined":     "unconfined",
+	} {
+		got := appArmorProfile(&v1.AppArmor{Type: profileType})
+		if got != want {
+			t.Errorf("%s: want %q, got %q", profileType, want, got)
+		}
+	}
+}
+
 func intp(v int64) *int64 {
 	return &v
 }
+
+func Test_MultipleProfiles_Apply(t *testing.T) {
+	toleration := apiv1.Toleration{Key: "key1", Operator: "Equal", Value: "value1", Effect: "NoExecute"}
+	gvisor := "gvisor"
+	kata := "kata"
+
+	first := Profile{
+		Tolerations:      []apiv1.Toleration{toleration},
+		RuntimeClassName: &gvisor,
+		PodSecurityContext: &apiv1.PodSecurityContext{
+			RunAsUser:  intp(1000),
+			RunAsGroup: intp(3000),
+		},
+	}
+	second := Profile{
+		Tolerations:      []apiv1.Toleration{toleration},
+		RuntimeClassName: &kata,
+		PodSecurityContext: &apiv1.PodSecurityContext{
+			RunAsUser: intp(2000),
+		},
+	}
+
+	basicStatefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest"},
+					},
+				},
+			},
+		},
+	}
+
+	factory := mockFactory()
+	factory.ApplyProfile(first, basicStatefulset)
+	factory.ApplyProfile(second, basicStatefulset)
+
+	spec := basicStatefulset.Spec.Template.Spec
+	if len(spec.Tolerations) != 1 {
+		t.Fatalf("expected duplicate tolerations to be merged, got %+v", spec.Tolerations)
+	}
+	if spec.RuntimeClassName == nil || *spec.RuntimeClassName != kata {
+		t.Fatalf("expected runtimeClassName from the last profile %q, got %v", kata, spec.RuntimeClassName)
+	}
+
+	expectedSecurityContext := &apiv1.PodSecurityContext{
+		RunAsUser:  intp(2000),
+		RunAsGroup: intp(3000),
+	}
+	if !reflect.DeepEqual(expectedSecurityContext, spec.SecurityContext) {
+		t.Fatalf("expected %+v\n got %+v", expectedSecurityContext, spec.SecurityContext)
+	}
+}
+
+func Test_ProfileConflicts(t *testing.T) {
+	gvisor := "gvisor"
+	kata := "kata"
+
+	cases := []struct {
+		name     string
+		profiles []Profile
+		expected []ProfileConflict
+	}{
+		{
+			name:     "a single profile has no conflicts",
+			profiles: []Profile{{RuntimeClassName: &gvisor}},
+			expected: []ProfileConflict{},
+		},
+		{
+			name: "the same value in two profiles is not a conflict",
+			profiles: []Profile{
+				{RuntimeClassName: &gvisor},
+				{RuntimeClassName: &gvisor},
+			},
+			expected: []ProfileConflict{},
+		},
+		{
+			name: "merged tolerations are not a conflict",
+			profiles: []Profile{
+				{Tolerations: []apiv1.Toleration{{Key: "key1"}}},
+				{Tolerations: []apiv1.Toleration{{Key: "key2"}}},
+			},
+			expected: []ProfileConflict{},
+		},
+		{
+			name: "different values are reported in annotation order",
+			profiles: []Profile{
+				{
+					RuntimeClassName:   &gvisor,
+					PodSecurityContext: &apiv1.PodSecurityContext{RunAsUser: intp(1000), RunAsGroup: intp(3000)},
+				},
+				{
+					RuntimeClassName:   &kata,
+					PodSecurityContext: &apiv1.PodSecurityContext{RunAsUser: intp(2000), RunAsGroup: intp(3000)},
+				},
+			},
+			expected: []ProfileConflict{
+				{Field: "podSecurityContext.runAsUser", Profiles: []string{"first", "second"}},
+				{Field: "runtimeClassName", Profiles: []string{"first", "second"}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			names := []string{"first", "second"}[:len(tc.profiles)]
+			annotations := map[string]string{ProfileAnnotationKey: strings.Join(names, ",")}
+
+			got := ProfileConflicts(annotations, tc.profiles)
+			if !reflect.DeepEqual(tc.expected, got) {
+				t.Fatalf("expected %+v\n got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func Test_ProfileConflict_String(t *testing.T) {
+	conflict := ProfileConflict{Field: "runtimeClassName", Profiles: []string{"first", "second"}}
+
+	want := "runtimeClassName is set by profiles first, second, the value from second is used"
+	if got := conflict.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func Test_GetProfiles_NotFound(t *testing.T) {
+	runtimeClass := "gvisor"
+	faasClient := faasfake.NewSimpleClientset(&v1.Profile{
+		ObjectMeta: metav1.ObjectMeta{Name: "gvisor", Namespace: "openfaas"},
+		Spec:       v1.ProfileSpec{RuntimeClassName: &runtimeClass},
+	})
+	factory := NewFunctionFactory(fake.NewSimpleClientset(), DeploymentConfig{}, faasClient.OpenfaasV1())
+
+	profiles, err := factory.GetProfiles(context.Background(), "openfaas", map[string]string{ProfileAnnotationKey: "gvisor"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(profiles) != 1 || *profiles[0].RuntimeClassName != runtimeClass {
+		t.Fatalf("expected the gvisor profile, got %+v", profiles)
+	}
+
+	_, err = factory.GetProfiles(context.Background(), "openfaas", map[string]string{ProfileAnnotationKey: "gvisor,gvisr"})
+	if !IsProfileNotFound(err) {
+		t.Fatalf("expected a ProfileNotFoundError, got %v", err)
+	}
+
+	want := `profile "gvisr" not found in namespace "openfaas"`
+	if err.Error() != want {
+		t.Fatalf("expected %q, got %q", want, err.Error())
+	}
+	if !IsNotFound(err) {
+		t.Fatalf("expected the error to wrap the API not found error")
+	}
+}
@@ -5,45 +5,69 @@
 package k8s
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
+	"net"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
-	corelister "k8s.io/client-go/listers/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
-// watchdogPort for the OpenFaaS function watchdog
-const watchdogPort = 8080
+// endpointSliceServiceIndex indexes EndpointSlices by the namespace and name of
+// the Service that owns them
+const endpointSliceServiceIndex = "service"
+
+// EndpointSliceIndexers must be added to the EndpointSlice informer before it is
+// started, so that the slices of a function can be found without a list
+var EndpointSliceIndexers = cache.Indexers{
+	endpointSliceServiceIndex: func(obj interface{}) ([]string, error) {
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			return nil, nil
+		}
+
+		service := slice.Labels[discoveryv1.LabelServiceName]
+		if service == "" {
+			return nil, nil
+		}
+		return []string{slice.Namespace + "/" + service}, nil
+	},
+}
 
-func NewFunctionLookup(ns string, lister corelister.EndpointsLister) *FunctionLookup {
+// NewFunctionLookup resolves functions from the EndpointSlices in the indexer of
+// an informer, which are updated as soon as pods become ready or are removed.
+func NewFunctionLookup(ns string, indexer cache.Indexer) *FunctionLookup {
 	return &FunctionLookup{
 		DefaultNamespace: ns,
-		EndpointLister:   lister,
-		Listers:          map[string]corelister.EndpointsNamespaceLister{},
-		lock:             sync.RWMutex{},
+		EndpointSlices:   indexer,
 	}
 }
 
 type FunctionLookup struct {
 	DefaultNamespace string
-	EndpointLister   corelister.EndpointsLister
-	Listers          map[string]corelister.EndpointsNamespaceLister
+	EndpointSlices   cache.Indexer
 
-	lock sync.RWMutex
-}
+	// Breaker leaves out the endpoints whose circuit is open, it is optional
+	Breaker *CircuitBreaker
 
-func (f *FunctionLookup) GetLister(ns string) corelister.EndpointsNamespaceLister {
-	f.lock.RLock()
-	defer f.lock.RUnlock()
-	return f.Listers[ns]
-}
+	// StatefulSets are read for the AnnotationLoadBalancing of each function, the
+	// DefaultLoadBalancing is used without them
+	StatefulSets         v1.StatefulSetLister
+	DefaultLoadBalancing string
 
-func (f *FunctionLookup) SetLister(ns string, lister corelister.EndpointsNamespaceLister) {
-	f.lock.Lock()
-	defer f.lock.Unlock()
-	f.Listers[ns] = lister
+	// DefaultPort is used when the EndpointSlices of a function have no "http"
+	// port, it is the DefaultFunctionPort when it is zero
+	DefaultPort int32
+
+	lock     sync.Mutex
+	next     map[string]int
+	inFlight map[string]int
 }
 
 func getNamespace(name, defaultNamespace string) string {
@@ -55,6 +79,12 @@ func getNamespace(name, defaultNamespace string) string {
 }
 
 func (l *FunctionLookup) Resolve(name string) (url.URL, error) {
+	return l.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext picks a ready endpoint of the function with its load-balancing
+// strategy, the key of the ordinal-affinity strategy is read from ctx
+func (l *FunctionLookup) ResolveContext(ctx context.Context, name string) (url.URL, error) {
 	functionName := name
 	namespace := getNamespace(name, l.DefaultNamespace)
 	if err := l.verifyNamespace(namespace); err != nil {
@@ -65,33 +95,32 @@ func (l *FunctionLookup) Resolve(name string) (url.URL, error) {
 		functionName = strings.TrimSuffix(name, "."+namespace)
 	}
 
-	nsEndpointLister := l.GetLister(namespace)
-
-	if nsEndpointLister == nil {
-		l.SetLister(namespace, l.EndpointLister.Endpoints(namespace))
-
-		nsEndpointLister = l.GetLister(namespace)
-	}
-
-	svc, err := nsEndpointLister.Get(functionName)
+	slices, err := l.EndpointSlices.ByIndex(endpointSliceServiceIndex, namespace+"/"+functionName)
 	if err != nil {
 		return url.URL{}, fmt.Errorf("error listing \"%s.%s\": %s", functionName, namespace, err.Error())
 	}
 
-	if len(svc.Subsets) == 0 {
-		return url.URL{}, fmt.Errorf("no subsets available for \"%s.%s\"", functionName, namespace)
+	if len(slices) == 0 {
+		return url.URL{}, fmt.Errorf("no endpoints available for \"%s.%s\"", functionName, namespace)
 	}
 
-	all := len(svc.Subsets[0].Addresses)
-	if len(svc.Subsets[0].Addresses) == 0 {
-		return url.URL{}, fmt.Errorf("no addresses in subset for \"%s.%s\"", functionName, namespace)
+	ready := readyEndpoints(slices, l.DefaultPort)
+	if len(ready) == 0 {
+		return url.URL{}, fmt.Errorf("no ready endpoints for \"%s.%s\"", functionName, namespace)
 	}
 
-	target := rand.Intn(all)
-
-	serviceIP := svc.Subsets[0].Addresses[target].IP
+	endpoints := make([]endpoint, 0, len(ready))
+	for _, e := range ready {
+		if !l.Breaker.Open(e.host) {
+			endpoints = append(endpoints, e)
+		}
+	}
+	if len(endpoints) == 0 {
+		return url.URL{}, fmt.Errorf("the circuit is open for each endpoint of \"%s.%s\"", functionName, namespace)
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].host < endpoints[j].host })
 
-	urlStr := fmt.Sprintf("http://%s:%d", serviceIP, watchdogPort)
+	urlStr := fmt.Sprintf("http://%s", l.pick(ctx, namespace, functionName, endpoints).host)
 
 	urlRes, err := url.Parse(urlStr)
 	if err != nil {
@@ -101,6 +130,63 @@ func (l *FunctionLookup) Resolve(name string) (url.URL, error) {
 	return *urlRes, nil
 }
 
+// readyEndpoints returns the ready endpoints with the port of the function, a
+// Service may have more than one slice, for example when it has many pods or is
+// dual-stack
+func readyEndpoints(slices []interface{}, defaultPort int32) []endpoint {
+	port := strconv.Itoa(int(slicePort(slices, defaultPort)))
+
+	var endpoints []endpoint
+	for _, obj := range slices {
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok || slice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+
+		for _, e := range slice.Endpoints {
+			// a nil condition must be interpreted as ready
+			if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+				continue
+			}
+			if len(e.Addresses) == 0 {
+				continue
+			}
+
+			ordinal := -1
+			if e.TargetRef != nil {
+				ordinal = podOrdinal(e.TargetRef.Name)
+			}
+			endpoints = append(endpoints, endpoint{
+				host:    net.JoinHostPort(e.Addresses[0], port),
+				ordinal: ordinal,
+			})
+		}
+	}
+	return endpoints
+}
+
+// slicePort returns the port of the function's Pods from the "http" port of its
+// EndpointSlices, which differs from the defaultPort when the function sets the
+// AnnotationPort
+func slicePort(slices []interface{}, defaultPort int32) int32 {
+	for _, obj := range slices {
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			continue
+		}
+
+		for _, port := range slice.Ports {
+			if port.Name != nil && *port.Name == "http" && port.Port != nil {
+				return *port.Port
+			}
+		}
+	}
+	if defaultPort == 0 {
+		return DefaultFunctionPort
+	}
+	return defaultPort
+}
+
 func (l *FunctionLookup) verifyNamespace(name string) error {
 	if name != "kube-system" {
 		return nil
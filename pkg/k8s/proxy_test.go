@@ -1,56 +1,46 @@
 package k8s
 
 import (
-	"fmt"
 	"strings"
 	"testing"
+	"time"
 
-	corelister "k8s.io/client-go/listers/core/v1"
-
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
-type FakeLister struct {
-}
-
-func (f FakeLister) List(selector labels.Selector) (ret []*corev1.Endpoints, err error) {
-	return nil, nil
-}
-
-func (f FakeLister) Endpoints(namespace string) corelister.EndpointsNamespaceLister {
-
-	return FakeNSLister{}
-}
-
-type FakeNSLister struct {
-}
-
-func (f FakeNSLister) List(selector labels.Selector) (ret []*corev1.Endpoints, err error) {
-	return nil, nil
-}
-
-func (f FakeNSLister) Get(name string) (*corev1.Endpoints, error) {
-
-	// make sure that we only send the function name to the lister
-	if strings.Contains(name, ".") {
-		return nil, fmt.Errorf("can not look up function name with a dot!")
+func newTestEndpointSlice(namespace, service string, ready *bool, addresses ...string) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      service + "-" + strings.Join(addresses, "-"),
+			Namespace: namespace,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
 	}
 
-	ep := corev1.Endpoints{
-		Subsets: []corev1.EndpointSubset{{
-			Addresses: []corev1.EndpointAddress{{IP: "127.0.0.1"}},
-		}},
+	for _, address := range addresses {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{address},
+			Conditions: discoveryv1.EndpointConditions{Ready: ready},
+		})
 	}
-
-	return &ep, nil
+	return slice
 }
 
 func Test_FunctionLookup(t *testing.T) {
+	ready := true
+	notReady := false
 
-	lister := FakeLister{}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, EndpointSliceIndexers)
+	indexer.Add(newTestEndpointSlice("testDefault", "testfunc", &ready, "127.0.0.1"))
+	indexer.Add(newTestEndpointSlice("othernamespace", "testfunc", nil, "127.0.0.1"))
+	indexer.Add(newTestEndpointSlice("testDefault", "scaling", &notReady, "10.0.0.2"))
+	indexer.Add(newTestEndpointSlice("testDefault", "scaling", &ready, "127.0.0.1"))
+	indexer.Add(newTestEndpointSlice("testDefault", "starting", &notReady, "10.0.0.3"))
 
-	resolver := NewFunctionLookup("testDefault", lister)
+	resolver := NewFunctionLookup("testDefault", indexer)
 
 	cases := []struct {
 		name     string
@@ -73,6 +63,21 @@ func Test_FunctionLookup(t *testing.T) {
 			funcName: "testfunc.kube-system",
 			expError: "namespace not allowed",
 		},
+		{
+			name:     "endpoints that are not ready are skipped",
+			funcName: "scaling",
+			expUrl:   "http://127.0.0.1:8080",
+		},
+		{
+			name:     "function without ready endpoints returns an error",
+			funcName: "starting",
+			expError: "no ready endpoints",
+		},
+		{
+			name:     "function without endpointslices returns an error",
+			funcName: "missing",
+			expError: "no endpoints available",
+		},
 	}
 
 	for _, tc := range cases {
@@ -92,3 +97,67 @@ func Test_FunctionLookup(t *testing.T) {
 		})
 	}
 }
+
+func Test_FunctionLookup_IPv6(t *testing.T) {
+	slice := newTestEndpointSlice("openfaas-fn", "figlet", nil, "fd00::1")
+	slice.AddressType = discoveryv1.AddressTypeIPv6
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, EndpointSliceIndexers)
+	indexer.Add(slice)
+
+	url, err := NewFunctionLookup("openfaas-fn", indexer).Resolve("figlet")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	want := "http://[fd00::1]:8080"
+	if url.String() != want {
+		t.Fatalf("expected url %s, got %s", want, url.String())
+	}
+}
+
+func Test_FunctionLookup_AnnotatedPort(t *testing.T) {
+	name, port := "http", int32(3000)
+	slice := newTestEndpointSlice("openfaas-fn", "figlet", nil, "10.0.0.1")
+	slice.Ports = []discoveryv1.EndpointPort{{Name: &name, Port: &port}}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, EndpointSliceIndexers)
+	indexer.Add(slice)
+
+	url, err := NewFunctionLookup("openfaas-fn", indexer).Resolve("figlet")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	want := "http://10.0.0.1:3000"
+	if url.String() != want {
+		t.Fatalf("expected url %s, got %s", want, url.String())
+	}
+}
+
+func Test_FunctionLookup_SkipsOpenCircuits(t *testing.T) {
+	ready := true
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, EndpointSliceIndexers)
+	indexer.Add(newTestEndpointSlice("openfaas-fn", "figlet", &ready, "10.0.0.1", "10.0.0.2"))
+
+	breaker := NewCircuitBreaker(1, time.Minute)
+	breaker.Record("10.0.0.1:8080", false)
+
+	resolver := NewFunctionLookup("openfaas-fn", indexer)
+	resolver.Breaker = breaker
+
+	for i := 0; i < 20; i++ {
+		got, err := resolver.Resolve("figlet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Host != "10.0.0.2:8080" {
+			t.Fatalf("want the endpoint with a closed circuit, got %s", got.Host)
+		}
+	}
+
+	breaker.Record("10.0.0.2:8080", false)
+	if _, err := resolver.Resolve("figlet"); err == nil || !strings.Contains(err.Error(), "circuit is open") {
+		t.Errorf("want an error when every circuit is open, got %v", err)
+	}
+}
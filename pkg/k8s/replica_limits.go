@@ -0,0 +1,164 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultMaxReplicas is the maximum replicas of a function when no maximum is
+	// configured
+	DefaultMaxReplicas = 20000
+
+	// LabelMaxReplicas lowers the maximum replicas of a single function, it can not
+	// raise it above the maximum of the function's namespace
+	LabelMaxReplicas = "com.openfaas.scale.max"
+
+	// LabelMinReplicas is the minimum replicas of a function
+	LabelMinReplicas = "com.openfaas.scale.min"
+
+	// AnnotationAllowZeroReplicas set to "true" or "false" on a function overrides
+	// whether it may be left at zero replicas, instead of being scaled back to one
+	AnnotationAllowZeroReplicas = "com.openfaas.scale.allow-zero"
+
+	// NamespaceMaxReplicasAnnotation on a namespace replaces the configured maximum
+	// replicas for the functions in it
+	NamespaceMaxReplicasAnnotation = "openfaas.com/max-replicas"
+
+	// namespaceLimitTTL is how long the maximum of a namespace is cached, so that
+	// the validation of each change to a StatefulSet does not read its namespace
+	namespaceLimitTTL = time.Minute
+)
+
+// ReplicaLimits resolves the maximum replicas of a function from, in order of
+// precedence, its com.openfaas.scale.max label, the openfaas.com/max-replicas
+// annotation of its namespace and the configured maximum. A nil ReplicaLimits
+// uses DefaultMaxReplicas for all functions.
+type ReplicaLimits struct {
+	max    int32
+	client kubernetes.Interface
+
+	lock       sync.Mutex
+	namespaces map[string]namespaceLimit
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type namespaceLimit struct {
+	max     int32
+	expires time.Time
+}
+
+// NewReplicaLimits creates ReplicaLimits with max as the maximum for namespaces
+// without an annotation, client is used to read the annotations of namespaces and
+// may be nil to ignore them
+func NewReplicaLimits(max int32, client kubernetes.Interface) *ReplicaLimits {
+	if max <= 0 {
+		max = DefaultMaxReplicas
+	}
+
+	return &ReplicaLimits{
+		max:        max,
+		client:     client,
+		namespaces: map[string]namespaceLimit{},
+		now:        time.Now,
+	}
+}
+
+// NamespaceMax returns the maximum replicas of the functions in a namespace
+func (l *ReplicaLimits) NamespaceMax(ctx context.Context, namespace string) int32 {
+	if l == nil {
+		return DefaultMaxReplicas
+	}
+	if l.client == nil {
+		return l.max
+	}
+
+	l.lock.Lock()
+	cached, ok := l.namespaces[namespace]
+	l.lock.Unlock()
+	if ok && l.now().Before(cached.expires) {
+		return cached.max
+	}
+
+	max := l.max
+	ns, err := l.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		// the configured maximum applies when the namespace can not be read
+		logging.FromContext(ctx).V(2).Info("Unable to read the maximum replicas of the namespace", "namespace", namespace, "error", err.Error())
+	} else if value, ok := ns.Annotations[NamespaceMaxReplicasAnnotation]; ok {
+		if parsed, err := parseMaxReplicas(value); err != nil {
+			logging.FromContext(ctx).Info("Ignoring invalid annotation", "namespace", namespace, "annotation", NamespaceMaxReplicasAnnotation, "value", value)
+		} else {
+			max = parsed
+		}
+	}
+
+	l.lock.Lock()
+	l.namespaces[namespace] = namespaceLimit{max: max, expires: l.now().Add(namespaceLimitTTL)}
+	l.lock.Unlock()
+
+	return max
+}
+
+// FunctionMax returns the maximum replicas of a function with the given labels
+func (l *ReplicaLimits) FunctionMax(ctx context.Context, namespace string, labels map[string]string) int32 {
+	max := l.NamespaceMax(ctx, namespace)
+
+	if value, ok := labels[LabelMaxReplicas]; ok {
+		if parsed, err := parseMaxReplicas(value); err == nil && parsed < max {
+			max = parsed
+		}
+	}
+	return max
+}
+
+// Validate returns an error when the minimum or maximum replicas in the labels of a
+// function are above the maximum of its namespace
+func (l *ReplicaLimits) Validate(ctx context.Context, namespace string, labels map[string]string) error {
+	max := l.NamespaceMax(ctx, namespace)
+
+	for _, label := range []string{LabelMaxReplicas, LabelMinReplicas} {
+		value, ok := labels[label]
+		if !ok {
+			continue
+		}
+		if replicas, err := strconv.Atoi(value); err == nil && replicas > int(max) {
+			return fmt.Errorf("%s is set too high, the maximum for namespace %s is %d", label, namespace, max)
+		}
+	}
+	return nil
+}
+
+// AllowsZeroReplicas returns true when a function may be left at zero replicas, for
+// scale-to-zero tooling or KEDA, allowZero is the default for all functions
+func AllowsZeroReplicas(annotations map[string]string, allowZero bool) bool {
+	if value, ok := annotations[AnnotationAllowZeroReplicas]; ok {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return allowZero
+}
+
+func parseMaxReplicas(value string) (int32, error) {
+	parsed, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if parsed <= 0 {
+		return 0, fmt.Errorf("must be greater than zero")
+	}
+	return int32(parsed), nil
+}
@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_ReplicaLimits_FunctionMax(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openfaas-fn"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "staging",
+			Annotations: map[string]string{NamespaceMaxReplicasAnnotation: "5"},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "invalid",
+			Annotations: map[string]string{NamespaceMaxReplicasAnnotation: "lots"},
+		}},
+	)
+	limits := NewReplicaLimits(50, client)
+
+	cases := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		want      int32
+	}{
+		{name: "configured maximum", namespace: "openfaas-fn", want: 50},
+		{name: "namespace annotation", namespace: "staging", want: 5},
+		{name: "invalid namespace annotation", namespace: "invalid", want: 50},
+		{name: "namespace that can not be read", namespace: "missing", want: 50},
+		{name: "label lowers the maximum", namespace: "openfaas-fn", labels: map[string]string{LabelMaxReplicas: "10"}, want: 10},
+		{name: "label can not raise the maximum", namespace: "staging", labels: map[string]string{LabelMaxReplicas: "10"}, want: 5},
+		{name: "invalid label", namespace: "openfaas-fn", labels: map[string]string{LabelMaxReplicas: "0"}, want: 50},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := limits.FunctionMax(context.Background(), tc.namespace, tc.labels); got != tc.want {
+				t.Errorf("want %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ReplicaLimits_CachesNamespaces(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openfaas-fn"}})
+	limits := NewReplicaLimits(50, client)
+
+	limits.NamespaceMax(context.Background(), "openfaas-fn")
+	limits.NamespaceMax(context.Background(), "openfaas-fn")
+
+	if got := len(client.Actions()); got != 1 {
+		t.Errorf("want the namespace to be read once, got %d reads", got)
+	}
+}
+
+func Test_ReplicaLimits_Validate(t *testing.T) {
+	limits := NewReplicaLimits(20, nil)
+
+	if err := limits.Validate(context.Background(), "openfaas-fn", map[string]string{LabelMaxReplicas: "20", LabelMinReplicas: "2"}); err != nil {
+		t.Errorf("want labels within the maximum to be valid, got %s", err)
+	}
+
+	err := limits.Validate(context.Background(), "openfaas-fn", map[string]string{LabelMinReplicas: "21"})
+	if err == nil {
+		t.Fatal("want an error for a minimum above the maximum")
+	}
+	if want := "com.openfaas.scale.min is set too high, the maximum for namespace openfaas-fn is 20"; err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func Test_ReplicaLimits_Nil(t *testing.T) {
+	var limits *ReplicaLimits
+	if got := limits.FunctionMax(context.Background(), "openfaas-fn", nil); got != DefaultMaxReplicas {
+		t.Errorf("want %d, got %d", DefaultMaxReplicas, got)
+	}
+}
+
+func Test_AllowsZeroReplicas(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		allowZero   bool
+		want        bool
+	}{
+		{name: "default", want: false},
+		{name: "allowed for all functions", allowZero: true, want: true},
+		{name: "allowed by the annotation", annotations: map[string]string{AnnotationAllowZeroReplicas: "true"}, want: true},
+		{name: "disallowed by the annotation", annotations: map[string]string{AnnotationAllowZeroReplicas: "false"}, allowZero: true, want: false},
+		{name: "invalid annotation", annotations: map[string]string{AnnotationAllowZeroReplicas: "maybe"}, allowZero: true, want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := AllowsZeroReplicas(tc.annotations, tc.allowZero); got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
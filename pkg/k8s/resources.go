@@ -0,0 +1,81 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ParseDefaultResources parses the requests and limits that are given to functions
+// that do not set their own, an empty value leaves that resource unset
+func ParseDefaultResources(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) (corev1.ResourceRequirements, error) {
+	resources := corev1.ResourceRequirements{
+		Limits:   corev1.ResourceList{},
+		Requests: corev1.ResourceList{},
+	}
+
+	values := []struct {
+		list  corev1.ResourceList
+		name  corev1.ResourceName
+		value string
+	}{
+		{resources.Requests, corev1.ResourceCPU, cpuRequest},
+		{resources.Requests, corev1.ResourceMemory, memoryRequest},
+		{resources.Limits, corev1.ResourceCPU, cpuLimit},
+		{resources.Limits, corev1.ResourceMemory, memoryLimit},
+	}
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+		qty, err := resource.ParseQuantity(v.value)
+		if err != nil {
+			return resources, fmt.Errorf("%s: %w", v.name, err)
+		}
+		v.list[v.name] = qty
+	}
+
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return resources, fmt.Errorf("%s: request %s is greater than the limit %s", name, request.String(), limit.String())
+		}
+	}
+	return resources, nil
+}
+
+// ApplyDefaultResources sets the default requests and limits for each resource that
+// the function did not set. A default request is lowered to the function's limit,
+// and a default limit raised to its request, so that the two remain valid.
+func (f *FunctionFactory) ApplyDefaultResources(resources *corev1.ResourceRequirements) {
+	defaults := f.Config.DefaultResources
+
+	for name, request := range defaults.Requests {
+		if _, ok := resources.Requests[name]; ok {
+			continue
+		}
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			request = limit
+		}
+		if resources.Requests == nil {
+			resources.Requests = corev1.ResourceList{}
+		}
+		resources.Requests[name] = request.DeepCopy()
+	}
+
+	for name, limit := range defaults.Limits {
+		if _, ok := resources.Limits[name]; ok {
+			continue
+		}
+		if request, ok := resources.Requests[name]; ok && request.Cmp(limit) > 0 {
+			limit = request
+		}
+		if resources.Limits == nil {
+			resources.Limits = corev1.ResourceList{}
+		}
+		resources.Limits[name] = limit.DeepCopy()
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func Test_ParseDefaultResources(t *testing.T) {
+	resources, err := ParseDefaultResources("50m", "64Mi", "", "128Mi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := resources.Requests.Cpu().String(); got != "50m" {
+		t.Errorf("want a cpu request of 50m, got %s", got)
+	}
+	if got := resources.Limits.Memory().String(); got != "128Mi" {
+		t.Errorf("want a memory limit of 128Mi, got %s", got)
+	}
+	if _, ok := resources.Limits[corev1.ResourceCPU]; ok {
+		t.Errorf("want no cpu limit, got %s", resources.Limits.Cpu().String())
+	}
+
+	if _, err := ParseDefaultResources("fifty", "", "", ""); err == nil {
+		t.Errorf("want an error for an invalid quantity")
+	}
+	if _, err := ParseDefaultResources("", "256Mi", "", "128Mi"); err == nil {
+		t.Errorf("want an error for a request greater than the limit")
+	}
+}
+
+func Test_ApplyDefaultResources(t *testing.T) {
+	defaults, err := ParseDefaultResources("50m", "64Mi", "", "256Mi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	factory := FunctionFactory{Config: DeploymentConfig{DefaultResources: defaults}}
+
+	cases := []struct {
+		name          string
+		resources     corev1.ResourceRequirements
+		wantCPU       string
+		wantMemory    string
+		wantMemoryLim string
+	}{
+		{
+			name:          "unset",
+			resources:     corev1.ResourceRequirements{},
+			wantCPU:       "50m",
+			wantMemory:    "64Mi",
+			wantMemoryLim: "256Mi",
+		},
+		{
+			name: "set by the function",
+			resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("100m"),
+					corev1.ResourceMemory: resource.MustParse("128Mi"),
+				},
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+			wantCPU:       "100m",
+			wantMemory:    "128Mi",
+			wantMemoryLim: "1Gi",
+		},
+		{
+			name: "limit below the default request",
+			resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("32Mi")},
+			},
+			wantCPU:       "50m",
+			wantMemory:    "32Mi",
+			wantMemoryLim: "32Mi",
+		},
+		{
+			name: "request above the default limit",
+			resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+			},
+			wantCPU:       "50m",
+			wantMemory:    "512Mi",
+			wantMemoryLim: "512Mi",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resources := tc.resources
+			factory.ApplyDefaultResources(&resources)
+
+			if got := resources.Requests.Cpu().String(); got != tc.wantCPU {
+				t.Errorf("want a cpu request of %s, got %s", tc.wantCPU, got)
+			}
+			if got := resources.Requests.Memory().String(); got != tc.wantMemory {
+				t.Errorf("want a memory request of %s, got %s", tc.wantMemory, got)
+			}
+			if got := resources.Limits.Memory().String(); got != tc.wantMemoryLim {
+				t.Errorf("want a memory limit of %s, got %s", tc.wantMemoryLim, got)
+			}
+			if _, ok := resources.Limits[corev1.ResourceCPU]; ok {
+				t.Errorf("want no cpu limit, got %s", resources.Limits.Cpu().String())
+			}
+		})
+	}
+}
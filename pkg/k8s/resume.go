@@ -0,0 +1,40 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1apply "k8s.io/client-go/applyconfigurations/apps/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AnnotationPreviousReplicas holds the count of replicas of a function before it was
+// last scaled to zero, it is restored when the function is resumed
+const AnnotationPreviousReplicas = "com.openfaas.scale.previous-replicas"
+
+// SavePreviousReplicas records replicas in the AnnotationPreviousReplicas annotation
+// of the StatefulSet, before it is scaled to zero. The annotation is applied by its
+// own field manager, so that it is kept by the applies of the other components.
+func SavePreviousReplicas(ctx context.Context, client kubernetes.Interface, namespace, name string, replicas int32) error {
+	applyConfig := appsv1apply.StatefulSet(name, namespace).
+		WithAnnotations(map[string]string{AnnotationPreviousReplicas: strconv.Itoa(int(replicas))})
+
+	_, err := client.AppsV1().StatefulSets(namespace).
+		Apply(ctx, applyConfig, metav1.ApplyOptions{FieldManager: ResumeFieldManager, Force: true})
+	return err
+}
+
+// PreviousReplicas returns the replicas recorded by SavePreviousReplicas, a function
+// that was never scaled to zero by faas-netes is resumed with one replica
+func PreviousReplicas(annotations map[string]string) int32 {
+	if value, ok := annotations[AnnotationPreviousReplicas]; ok {
+		if replicas, err := strconv.ParseInt(value, 10, 32); err == nil && replicas > 0 {
+			return int32(replicas)
+		}
+	}
+	return 1
+}
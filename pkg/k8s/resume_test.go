@@ -0,0 +1,24 @@
+package k8s
+
+import "testing"
+
+func Test_PreviousReplicas(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        int32
+	}{
+		{name: "no annotation", want: 1},
+		{name: "recorded", annotations: map[string]string{AnnotationPreviousReplicas: "4"}, want: 4},
+		{name: "zero", annotations: map[string]string{AnnotationPreviousReplicas: "0"}, want: 1},
+		{name: "invalid", annotations: map[string]string{AnnotationPreviousReplicas: "four"}, want: 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := PreviousReplicas(tc.annotations); got != tc.want {
+				t.Errorf("want %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
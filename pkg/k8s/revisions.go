@@ -0,0 +1,134 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultRevisionHistoryLimit is the number of old ControllerRevisions that
+// Kubernetes keeps for a StatefulSet without a revision history limit
+const DefaultRevisionHistoryLimit = int32(10)
+
+// orphanRevisionMinAge is how old an orphaned revision must be before it is
+// deleted, so that the StatefulSet of a new function can reach the informer cache
+const orphanRevisionMinAge = time.Minute
+
+// RevisionHistoryLimit returns the number of old ControllerRevisions that are kept
+// for the StatefulSet of a function
+func RevisionHistoryLimit(statefulset *appsv1.StatefulSet) int32 {
+	if statefulset.Spec.RevisionHistoryLimit != nil {
+		return *statefulset.Spec.RevisionHistoryLimit
+	}
+	return DefaultRevisionHistoryLimit
+}
+
+// PruneRevisions deletes the oldest ControllerRevisions of the StatefulSet until at
+// most keep old revisions are left. The current and update revisions are never
+// deleted, nor are the revisions that are still used by a Pod of the function. It
+// returns the names of the deleted revisions.
+func PruneRevisions(ctx context.Context, client kubernetes.Interface, statefulset *appsv1.StatefulSet, keep int32) ([]string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(statefulset.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	listOptions := metav1.ListOptions{LabelSelector: selector.String()}
+
+	revisions, err := client.AppsV1().ControllerRevisions(statefulset.Namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.CoreV1().Pods(statefulset.Namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	live := map[string]bool{
+		statefulset.Status.CurrentRevision: true,
+		statefulset.Status.UpdateRevision:  true,
+	}
+	for _, pod := range pods.Items {
+		live[pod.Labels[appsv1.StatefulSetRevisionLabel]] = true
+	}
+
+	var old []appsv1.ControllerRevision
+	for _, revision := range revisions.Items {
+		owner := metav1.GetControllerOf(&revision)
+		if owner == nil || owner.UID != statefulset.UID || live[revision.Name] {
+			continue
+		}
+		old = append(old, revision)
+	}
+	if int32(len(old)) <= keep {
+		return nil, nil
+	}
+
+	sort.Slice(old, func(i, j int) bool {
+		return old[i].Revision < old[j].Revision
+	})
+
+	var deleted []string
+	for _, revision := range old[:int32(len(old))-keep] {
+		err := client.AppsV1().ControllerRevisions(statefulset.Namespace).Delete(ctx, revision.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &revision.UID},
+		})
+		if err != nil && !IsNotFound(err) {
+			return deleted, err
+		}
+		deleted = append(deleted, revision.Name)
+	}
+	return deleted, nil
+}
+
+// PruneOrphanRevisions deletes the ControllerRevisions of functions whose
+// StatefulSet no longer exists, such as when it was deleted with the orphan
+// propagation policy. exists reports whether the StatefulSet of a function exists,
+// with any UID when uid is empty. Revisions created in the last minute are left
+// for the next pass. The revisions are listed in pages of 500, and the
+// names of the deleted revisions are returned.
+func PruneOrphanRevisions(ctx context.Context, client kubernetes.Interface, namespace string, exists func(name, uid string) bool) ([]string, error) {
+	revisions := client.AppsV1().ControllerRevisions(namespace)
+	options := metav1.ListOptions{LabelSelector: "faas_function", Limit: 500}
+
+	var deleted []string
+	for {
+		page, err := revisions.List(ctx, options)
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, revision := range page.Items {
+			if time.Since(revision.CreationTimestamp.Time) < orphanRevisionMinAge {
+				continue
+			}
+			if owner := metav1.GetControllerOf(&revision); owner != nil {
+				if owner.Kind != "StatefulSet" || exists(owner.Name, string(owner.UID)) {
+					continue
+				}
+			} else if exists(revision.Labels["faas_function"], "") {
+				// the StatefulSet adopts the revisions that match its selector
+				continue
+			}
+
+			err := revisions.Delete(ctx, revision.Name, metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{UID: &revision.UID},
+			})
+			if err != nil && !IsNotFound(err) {
+				return deleted, err
+			}
+			deleted = append(deleted, revision.Name)
+		}
+
+		if page.Continue == "" {
+			return deleted, nil
+		}
+		options.Continue = page.Continue
+	}
+}
@@ -0,0 +1,109 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newRevision(name string, revision int64, owner types.UID, created time.Time) *appsv1.ControllerRevision {
+	r := &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "openfaas-fn",
+			Labels:            map[string]string{"faas_function": "figlet"},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Revision: revision,
+	}
+	if owner != "" {
+		controller := true
+		r.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet", UID: owner, Controller: &controller,
+		}}
+	}
+	return r
+}
+
+func revisionNames(t *testing.T, client *fake.Clientset) []string {
+	t.Helper()
+
+	list, err := client.AppsV1().ControllerRevisions("openfaas-fn").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var names []string
+	for _, r := range list.Items {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Test_PruneRevisions(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "1234"},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"faas_function": "figlet"}},
+		},
+		Status: appsv1.StatefulSetStatus{CurrentRevision: "figlet-5", UpdateRevision: "figlet-6"},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "figlet-0", Namespace: "openfaas-fn",
+		Labels: map[string]string{"faas_function": "figlet", appsv1.StatefulSetRevisionLabel: "figlet-1"},
+	}}
+
+	objects := []runtime.Object{pod}
+	for i, name := range []string{"figlet-1", "figlet-2", "figlet-3", "figlet-4", "figlet-5", "figlet-6"} {
+		objects = append(objects, newRevision(name, int64(i+1), "1234", old))
+	}
+	objects = append(objects, newRevision("other", 1, "5678", old))
+	client := fake.NewSimpleClientset(objects...)
+
+	deleted, err := PruneRevisions(context.Background(), client, statefulset, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if want := []string{"figlet-2", "figlet-3"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("want deleted revisions %v, got %v", want, deleted)
+	}
+	if want := []string{"figlet-1", "figlet-4", "figlet-5", "figlet-6", "other"}; !reflect.DeepEqual(revisionNames(t, client), want) {
+		t.Errorf("want remaining revisions %v, got %v", want, revisionNames(t, client))
+	}
+}
+
+func Test_PruneOrphanRevisions(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	client := fake.NewSimpleClientset(
+		newRevision("figlet-1", 1, "1234", old),
+		newRevision("figlet-2", 2, "5678", old),
+		newRevision("figlet-3", 3, "5678", time.Now()),
+		newRevision("figlet-4", 4, "", old),
+	)
+
+	exists := func(name, uid string) bool {
+		return name == "figlet" && (uid == "" || uid == "1234")
+	}
+	deleted, err := PruneOrphanRevisions(context.Background(), client, "openfaas-fn", exists)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if want := []string{"figlet-2"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("want deleted revisions %v, got %v", want, deleted)
+	}
+	if want := []string{"figlet-1", "figlet-3", "figlet-4"}; !reflect.DeepEqual(revisionNames(t, client), want) {
+		t.Errorf("want remaining revisions %v, got %v", want, revisionNames(t, client))
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// AnnotationRevisionHistoryLimit is the number of old ControllerRevisions kept
+	// for the function's StatefulSet
+	AnnotationRevisionHistoryLimit = "com.openfaas.rollout.revision-history-limit"
+	// AnnotationMaxUnavailable is the number or percentage of Pods that may be
+	// unavailable during a rolling update
+	AnnotationMaxUnavailable = "com.openfaas.rollout.max-unavailable"
+	// AnnotationPartition holds back the Pods with an ordinal below the partition
+	// at the previous revision, for a staged rollout
+	AnnotationPartition = "com.openfaas.rollout.partition"
+)
+
+// RolloutConfig tunes the rolling updates of the StatefulSet of a function, each
+// setting that is nil keeps the value of the StatefulSet
+type RolloutConfig struct {
+	RevisionHistoryLimit *int32
+	MaxUnavailable       *intstr.IntOrString
+	Partition            *int32
+}
+
+// ParseRolloutConfig parses the revision history limit, the maximum unavailable
+// Pods as a number or percentage, and the partition, an empty value is left unset
+func ParseRolloutConfig(revisionHistoryLimit, maxUnavailable, partition string) (RolloutConfig, error) {
+	return parseRollout([3]string{"revision history limit", "max unavailable", "partition"},
+		revisionHistoryLimit, maxUnavailable, partition)
+}
+
+// RolloutAnnotations parses the rollout annotations of a function
+func RolloutAnnotations(annotations map[string]string) (RolloutConfig, error) {
+	return parseRollout([3]string{AnnotationRevisionHistoryLimit, AnnotationMaxUnavailable, AnnotationPartition},
+		annotations[AnnotationRevisionHistoryLimit], annotations[AnnotationMaxUnavailable], annotations[AnnotationPartition])
+}
+
+// parseRollout parses the rollout settings, names are used in the errors
+func parseRollout(names [3]string, revisionHistoryLimit, maxUnavailable, partition string) (RolloutConfig, error) {
+	rollout := RolloutConfig{}
+
+	if revisionHistoryLimit != "" {
+		limit, err := parseNonNegative(revisionHistoryLimit)
+		if err != nil {
+			return rollout, fmt.Errorf("%s %w", names[0], err)
+		}
+		rollout.RevisionHistoryLimit = &limit
+	}
+
+	if maxUnavailable != "" {
+		value := intstr.Parse(maxUnavailable)
+		if value.Type == intstr.String {
+			percent, err := strconv.Atoi(strings.TrimSuffix(maxUnavailable, "%"))
+			if err != nil || !strings.HasSuffix(maxUnavailable, "%") || percent < 0 || percent > 100 {
+				return rollout, fmt.Errorf("%s must be a number or a percentage, got %q", names[1], maxUnavailable)
+			}
+		} else if value.IntVal < 0 {
+			return rollout, fmt.Errorf("%s must not be negative, got %q", names[1], maxUnavailable)
+		}
+		rollout.MaxUnavailable = &value
+	}
+
+	if partition != "" {
+		p, err := parseNonNegative(partition)
+		if err != nil {
+			return rollout, fmt.Errorf("%s %w", names[2], err)
+		}
+		rollout.Partition = &p
+	}
+
+	return rollout, nil
+}
+
+// ConfigureRollout sets the revision history limit and rolling update strategy of
+// the StatefulSet from the rollout annotations of the function, falling back to
+// the rollout settings of the provider
+func (f *FunctionFactory) ConfigureRollout(statefulset *appsv1.StatefulSet) error {
+	rollout, err := RolloutAnnotations(statefulset.Annotations)
+	if err != nil {
+		return err
+	}
+
+	defaults := f.Config.Rollout
+	if rollout.RevisionHistoryLimit == nil {
+		rollout.RevisionHistoryLimit = defaults.RevisionHistoryLimit
+	}
+	if rollout.MaxUnavailable == nil {
+		rollout.MaxUnavailable = defaults.MaxUnavailable
+	}
+	if rollout.Partition == nil {
+		rollout.Partition = defaults.Partition
+	}
+
+	spec := &statefulset.Spec
+	if rollout.RevisionHistoryLimit != nil {
+		limit := *rollout.RevisionHistoryLimit
+		spec.RevisionHistoryLimit = &limit
+	}
+	if rollout.MaxUnavailable == nil && rollout.Partition == nil {
+		return nil
+	}
+
+	spec.UpdateStrategy.Type = appsv1.RollingUpdateStatefulSetStrategyType
+	if spec.UpdateStrategy.RollingUpdate == nil {
+		spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{}
+	}
+	if rollout.MaxUnavailable != nil {
+		maxUnavailable := *rollout.MaxUnavailable
+		spec.UpdateStrategy.RollingUpdate.MaxUnavailable = &maxUnavailable
+	}
+	if rollout.Partition != nil {
+		partition := *rollout.Partition
+		spec.UpdateStrategy.RollingUpdate.Partition = &partition
+	}
+	return nil
+}
+
+func parseNonNegative(value string) (int32, error) {
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("must be a whole number of 0 or more, got %q", value)
+	}
+	return int32(n), nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RolloutStatus is the progress of a deploy or update of a function
+type RolloutStatus struct {
+	// Replicas is the desired count of replicas
+	Replicas int32 `json:"replicas"`
+	// UpdatedReplicas is the count of Pods at the latest revision of the function
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+	// ReadyReplicas is the count of Pods that are ready to serve invocations
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// Revision is the latest revision of the StatefulSet
+	Revision string `json:"revision"`
+	// Ready is true once the Pods that are not held back by a partition are at the
+	// latest revision and all of the replicas are ready
+	Ready bool `json:"ready"`
+}
+
+// GetRolloutStatus reads the progress of the rollout of a StatefulSet from its
+// status, which is only trusted once the controller has observed the latest
+// generation of the StatefulSet
+func GetRolloutStatus(statefulset *appsv1.StatefulSet) RolloutStatus {
+	replicas := int32(1)
+	if statefulset.Spec.Replicas != nil {
+		replicas = *statefulset.Spec.Replicas
+	}
+
+	// the Pods below the partition are kept at the previous revision
+	wantUpdated := replicas
+	if rollingUpdate := statefulset.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil {
+		wantUpdated -= *rollingUpdate.Partition
+		if wantUpdated < 0 {
+			wantUpdated = 0
+		}
+	}
+
+	status := statefulset.Status
+	rollout := RolloutStatus{
+		Replicas:        replicas,
+		UpdatedReplicas: status.UpdatedReplicas,
+		ReadyReplicas:   status.ReadyReplicas,
+		Revision:        status.UpdateRevision,
+	}
+
+	rollout.Ready = status.ObservedGeneration >= statefulset.Generation &&
+		status.Replicas == replicas &&
+		status.UpdatedReplicas >= wantUpdated &&
+		status.ReadyReplicas >= replicas
+	return rollout
+}
+
+// WaitForRollout waits for up to timeout for the rollout of the StatefulSet to
+// complete, the status that was last observed is returned when the timeout is
+// reached, with Ready set to false
+func WaitForRollout(ctx context.Context, client kubernetes.Interface, namespace, name string, timeout time.Duration) (RolloutStatus, error) {
+	return waitForRollout(ctx, client, namespace, name, defaultScaleProgressInterval, timeout)
+}
+
+func waitForRollout(ctx context.Context, client kubernetes.Interface, namespace, name string, interval, timeout time.Duration) (RolloutStatus, error) {
+	rollout := RolloutStatus{}
+
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		statefulset, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		rollout = GetRolloutStatus(statefulset)
+		return rollout.Ready, nil
+	})
+	if err != nil && !wait.Interrupted(err) {
+		return rollout, err
+	}
+
+	return rollout, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_GetRolloutStatus(t *testing.T) {
+	replicas, partition := int32(3), int32(1)
+
+	cases := []struct {
+		name      string
+		partition *int32
+		status    appsv1.StatefulSetStatus
+		want      bool
+	}{
+		{
+			name:   "complete",
+			status: appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3},
+			want:   true,
+		},
+		{
+			name:   "generation not observed",
+			status: appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3},
+		},
+		{
+			name:   "pods at the previous revision",
+			status: appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, ReadyReplicas: 3},
+		},
+		{
+			name:   "updated pod not ready",
+			status: appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 2},
+		},
+		{
+			name:      "pods held back by the partition",
+			partition: &partition,
+			status:    appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, ReadyReplicas: 3},
+			want:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			statefulset := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &replicas,
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+						RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: tc.partition},
+					},
+				},
+				Status: tc.status,
+			}
+
+			if got := GetRolloutStatus(statefulset); got.Ready != tc.want {
+				t.Errorf("want ready to be %t, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_WaitForRollout(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", Generation: 1},
+	}
+	client := fake.NewSimpleClientset(statefulset)
+
+	// the only Pod is updated and becomes ready on the third read
+	reads := 0
+	client.PrependReactor("get", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reads++
+		s := statefulset.DeepCopy()
+		if reads >= 3 {
+			s.Status = appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, UpdateRevision: "figlet-7d9f"}
+		}
+		return true, s, nil
+	})
+
+	rollout, err := waitForRollout(context.Background(), client, "openfaas-fn", "figlet", time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rollout.Ready || rollout.Revision != "figlet-7d9f" {
+		t.Errorf("want the rollout of figlet-7d9f to be complete, got: %+v", rollout)
+	}
+}
+
+func Test_WaitForRollout_ReturnsStatusAfterTimeout(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", Generation: 1},
+		Status:     appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 1, ReadyReplicas: 1},
+	}
+	client := fake.NewSimpleClientset(statefulset)
+
+	rollout, err := waitForRollout(context.Background(), client, "openfaas-fn", "figlet", time.Millisecond, time.Millisecond*20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rollout.Ready || rollout.ReadyReplicas != 1 {
+		t.Errorf("want the last observed status without the rollout being complete, got: %+v", rollout)
+	}
+}
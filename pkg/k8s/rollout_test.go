@@ -0,0 +1,120 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func Test_ParseRolloutConfig(t *testing.T) {
+	cases := []struct {
+		name                 string
+		revisionHistoryLimit string
+		maxUnavailable       string
+		partition            string
+		wantErr              bool
+	}{
+		{name: "empty"},
+		{name: "numbers", revisionHistoryLimit: "3", maxUnavailable: "1", partition: "2"},
+		{name: "percentage", maxUnavailable: "25%"},
+		{name: "negative limit", revisionHistoryLimit: "-1", wantErr: true},
+		{name: "negative max unavailable", maxUnavailable: "-1", wantErr: true},
+		{name: "percentage over 100", maxUnavailable: "150%", wantErr: true},
+		{name: "not a percentage", maxUnavailable: "half", wantErr: true},
+		{name: "invalid partition", partition: "first", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRolloutConfig(tc.revisionHistoryLimit, tc.maxUnavailable, tc.partition)
+			if tc.wantErr && err == nil {
+				t.Fatalf("want an error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func Test_RolloutAnnotations_ErrorNamesAnnotation(t *testing.T) {
+	_, err := RolloutAnnotations(map[string]string{AnnotationPartition: "-1"})
+	if err == nil || !strings.Contains(err.Error(), AnnotationPartition) {
+		t.Fatalf("want the annotation in the error, got %v", err)
+	}
+}
+
+func Test_ConfigureRollout(t *testing.T) {
+	defaults, err := ParseRolloutConfig("3", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	factory := FunctionFactory{Config: DeploymentConfig{Rollout: defaults}}
+
+	newStatefulSet := func(annotations map[string]string) *appsv1.StatefulSet {
+		limit := int32(10)
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec: appsv1.StatefulSetSpec{
+				RevisionHistoryLimit: &limit,
+				UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+					Type: appsv1.RollingUpdateStatefulSetStrategyType,
+					RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+						MaxUnavailable: &intstr.IntOrString{Type: intstr.Int, IntVal: 0},
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("provider defaults", func(t *testing.T) {
+		statefulset := newStatefulSet(nil)
+		if err := factory.ConfigureRollout(statefulset); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := *statefulset.Spec.RevisionHistoryLimit; got != 3 {
+			t.Errorf("want a revision history limit of 3, got %d", got)
+		}
+		rollingUpdate := statefulset.Spec.UpdateStrategy.RollingUpdate
+		if got := rollingUpdate.MaxUnavailable.String(); got != "0" {
+			t.Errorf("want max unavailable to be kept at 0, got %s", got)
+		}
+		if rollingUpdate.Partition != nil {
+			t.Errorf("want no partition, got %d", *rollingUpdate.Partition)
+		}
+	})
+
+	t.Run("function annotations", func(t *testing.T) {
+		statefulset := newStatefulSet(map[string]string{
+			AnnotationRevisionHistoryLimit: "1",
+			AnnotationMaxUnavailable:       "50%",
+			AnnotationPartition:            "2",
+		})
+		if err := factory.ConfigureRollout(statefulset); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := *statefulset.Spec.RevisionHistoryLimit; got != 1 {
+			t.Errorf("want a revision history limit of 1, got %d", got)
+		}
+		rollingUpdate := statefulset.Spec.UpdateStrategy.RollingUpdate
+		if got := rollingUpdate.MaxUnavailable.String(); got != "50%" {
+			t.Errorf("want max unavailable of 50%%, got %s", got)
+		}
+		if rollingUpdate.Partition == nil || *rollingUpdate.Partition != 2 {
+			t.Errorf("want a partition of 2, got %v", rollingUpdate.Partition)
+		}
+	})
+
+	t.Run("invalid annotation", func(t *testing.T) {
+		statefulset := newStatefulSet(map[string]string{AnnotationMaxUnavailable: "all"})
+		if err := factory.ConfigureRollout(statefulset); err == nil {
+			t.Fatalf("want an error")
+		}
+	})
+}
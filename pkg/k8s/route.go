@@ -0,0 +1,206 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// routeAnnotationPrefix is the prefix of the annotations that expose a function
+	// on its own domain, without the OpenFaaS gateway
+	routeAnnotationPrefix = "com.openfaas.route."
+
+	// AnnotationRouteHost is the domain of the function, an Ingress or HTTPRoute is
+	// only created when it is set
+	AnnotationRouteHost = routeAnnotationPrefix + "host"
+
+	// AnnotationRoutePath is the path prefix that is routed to the function, the
+	// default is /. The path is not rewritten.
+	AnnotationRoutePath = routeAnnotationPrefix + "path"
+
+	// AnnotationRouteKind is either Ingress, the default, or HTTPRoute for the
+	// Gateway API
+	AnnotationRouteKind = routeAnnotationPrefix + "kind"
+
+	// AnnotationRouteClass is the IngressClass of an Ingress
+	AnnotationRouteClass = routeAnnotationPrefix + "class"
+
+	// AnnotationRouteGateway is the parent Gateway of an HTTPRoute, in the form
+	// NAME or NAMESPACE/NAME
+	AnnotationRouteGateway = routeAnnotationPrefix + "gateway"
+
+	// AnnotationRouteIssuer is the cert-manager ClusterIssuer that creates the TLS
+	// certificate of an Ingress. The TLS of an HTTPRoute is set on its Gateway.
+	AnnotationRouteIssuer = routeAnnotationPrefix + "tls.issuer"
+
+	routeKindIngress   = "Ingress"
+	routeKindHTTPRoute = "HTTPRoute"
+)
+
+var (
+	IngressResource   = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	HTTPRouteResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "httproutes"}
+
+	// RouteResources are checked for routes to remove, when a function no longer
+	// sets a host or changes the kind of its route
+	RouteResources = []schema.GroupVersionResource{IngressResource, HTTPRouteResource}
+)
+
+// MakeRoute creates the Ingress or HTTPRoute for the Service of a function from its
+// com.openfaas.route.* annotations, nil is returned when the function does not set a
+// host. Both are managed with the dynamic client, so that the Gateway API is only
+// required when a function uses it. The route targets the servicePort, the owner is
+// set by the caller.
+func MakeRoute(name, namespace string, servicePort int32, annotations map[string]string) (*unstructured.Unstructured, schema.GroupVersionResource, error) {
+	host := annotations[AnnotationRouteHost]
+	if host == "" {
+		return nil, schema.GroupVersionResource{}, nil
+	}
+
+	path := annotations[AnnotationRoutePath]
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, schema.GroupVersionResource{}, fmt.Errorf("invalid value for %s: %q must start with /", AnnotationRoutePath, path)
+	}
+
+	metadata := map[string]interface{}{
+		"name":      name,
+		"namespace": namespace,
+		"labels":    map[string]interface{}{"faas_function": name},
+	}
+
+	switch kind := annotations[AnnotationRouteKind]; kind {
+	case "", routeKindIngress:
+		return makeIngress(name, servicePort, host, path, annotations, metadata), IngressResource, nil
+
+	case routeKindHTTPRoute:
+		gateway := annotations[AnnotationRouteGateway]
+		if gateway == "" {
+			return nil, HTTPRouteResource, fmt.Errorf("%s is required for an HTTPRoute", AnnotationRouteGateway)
+		}
+		return makeHTTPRoute(name, servicePort, host, path, gateway, metadata), HTTPRouteResource, nil
+
+	default:
+		return nil, schema.GroupVersionResource{}, fmt.Errorf("invalid value for %s: %q, use %s or %s", AnnotationRouteKind, kind, routeKindIngress, routeKindHTTPRoute)
+	}
+}
+
+func makeIngress(name string, port int32, host, path string, annotations map[string]string, metadata map[string]interface{}) *unstructured.Unstructured {
+	rule := map[string]interface{}{
+		"host": host,
+		"http": map[string]interface{}{
+			"paths": []interface{}{
+				map[string]interface{}{
+					"path":     path,
+					"pathType": "Prefix",
+					"backend": map[string]interface{}{
+						"service": map[string]interface{}{
+							"name": name,
+							"port": map[string]interface{}{"number": int64(port)},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	spec := map[string]interface{}{
+		"rules": []interface{}{rule},
+	}
+	if class := annotations[AnnotationRouteClass]; class != "" {
+		spec["ingressClassName"] = class
+	}
+	if issuer := annotations[AnnotationRouteIssuer]; issuer != "" {
+		metadata["annotations"] = map[string]interface{}{"cert-manager.io/cluster-issuer": issuer}
+		spec["tls"] = []interface{}{
+			map[string]interface{}{
+				"hosts":      []interface{}{host},
+				"secretName": name + "-tls",
+			},
+		}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": IngressResource.GroupVersion().String(),
+		"kind":       routeKindIngress,
+		"metadata":   metadata,
+		"spec":       spec,
+	}}
+}
+
+func makeHTTPRoute(name string, port int32, host, path, gateway string, metadata map[string]interface{}) *unstructured.Unstructured {
+	parent := map[string]interface{}{"name": gateway}
+	if namespace, gatewayName, ok := strings.Cut(gateway, "/"); ok {
+		parent = map[string]interface{}{"namespace": namespace, "name": gatewayName}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": HTTPRouteResource.GroupVersion().String(),
+		"kind":       routeKindHTTPRoute,
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{parent},
+			"hostnames":  []interface{}{host},
+			"rules": []interface{}{
+				map[string]interface{}{
+					"matches": []interface{}{
+						map[string]interface{}{
+							"path": map[string]interface{}{"type": "PathPrefix", "value": path},
+						},
+					},
+					"backendRefs": []interface{}{
+						map[string]interface{}{"name": name, "port": int64(port)},
+					},
+				},
+			},
+		},
+	}}
+}
+
+// SyncRoute applies the Ingress or HTTPRoute of a function, and removes the routes of
+// the other kind, or both when the function no longer sets a host. Only routes that
+// are owned by the StatefulSet of the function are removed.
+func SyncRoute(ctx context.Context, client dynamic.Interface, functionName, namespace string, servicePort int32, annotations map[string]string, owner metav1.OwnerReference, labels map[string]string) error {
+	route, routeResource, err := MakeRoute(functionName, namespace, servicePort, annotations)
+	if err != nil {
+		return err
+	}
+
+	if client == nil {
+		if route != nil {
+			return fmt.Errorf("%s is not supported without a dynamic client", AnnotationRouteHost)
+		}
+		return nil
+	}
+
+	for _, resource := range RouteResources {
+		if route != nil && resource == routeResource {
+			continue
+		}
+		if err := DeleteOwnedResource(ctx, client, resource, namespace, functionName, functionName); err != nil {
+			return err
+		}
+	}
+
+	if route == nil {
+		return nil
+	}
+
+	route.SetOwnerReferences([]metav1.OwnerReference{owner})
+	AddLabels(route, labels)
+
+	_, err = client.Resource(routeResource).Namespace(namespace).
+		Apply(ctx, functionName, route, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
@@ -0,0 +1,51 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func Test_MakeRoute_HTTPRoute(t *testing.T) {
+	route, resource, err := MakeRoute("figlet", "openfaas-fn", 8080, map[string]string{
+		AnnotationRouteHost:    "figlet.example.com",
+		AnnotationRouteKind:    "HTTPRoute",
+		AnnotationRouteGateway: "gateways/public",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resource != HTTPRouteResource || len(route.GetOwnerReferences()) != 0 {
+		t.Fatalf("want an HTTPRoute without an owner, got %s %v", route.GetKind(), route.GetOwnerReferences())
+	}
+
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	if namespace, _, _ := unstructured.NestedString(parents[0].(map[string]interface{}), "namespace"); namespace != "gateways" {
+		t.Errorf("want the Gateway in the gateways namespace, got %q", namespace)
+	}
+}
+
+func Test_SyncRoute_RemovesOwnedRoutesWithoutHost(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+	ingress, _, _ := MakeRoute("figlet", "openfaas-fn", 8080, map[string]string{AnnotationRouteHost: "figlet.example.com"})
+	ingress.SetOwnerReferences([]metav1.OwnerReference{owner})
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		IngressResource:   "IngressList",
+		HTTPRouteResource: "HTTPRouteList",
+	}, ingress)
+
+	if err := SyncRoute(context.Background(), dynamicClient, "figlet", "openfaas-fn", 8080, map[string]string{}, owner, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := dynamicClient.Resource(IngressResource).Namespace("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("want the Ingress to be deleted when the function no longer sets a host")
+	}
+}
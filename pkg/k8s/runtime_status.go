@@ -0,0 +1,93 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RuntimeStatus is what is running for a function, as opposed to its desired spec
+type RuntimeStatus struct {
+	// ImageDigest is the digest of the image run by the Pods at the latest revision
+	// of the function, it is empty until one of them is ready
+	ImageDigest string `json:"imageDigest,omitempty"`
+	// RolloutInProgress is true while the Pods are being moved to the latest
+	// revision of the function or are not all ready
+	RolloutInProgress bool `json:"rolloutInProgress"`
+	// Health tells apart the Pods held back by the function container from those
+	// held back by a sidecar
+	Health ContainerHealth `json:"health"`
+	// ImagePullErrors lists the images that could not be pulled for the Pods, such
+	// as a tag that does not exist
+	ImagePullErrors []ImagePullError `json:"imagePullErrors,omitempty"`
+	// Drain is the progress of moving the Pods off nodes that are cordoned or
+	// drained, it is only set while there are Pods left on them
+	Drain *DrainStatus `json:"drain,omitempty"`
+}
+
+// FilterFunctionPods restricts a list or watch to the Pods of functions, it is used
+// with informers.WithTweakListOptions for the Pod informer
+func FilterFunctionPods(options *metav1.ListOptions) {
+	PaginateInformerList(options)
+	options.LabelSelector = "faas_function"
+}
+
+// GetRuntimeStatus joins the status of the StatefulSet of a function with the
+// container statuses of its Pods
+func GetRuntimeStatus(statefulset *appsv1.StatefulSet, pods []*corev1.Pod) RuntimeStatus {
+	return RuntimeStatus{
+		ImageDigest:       ImageDigest(statefulset, pods),
+		RolloutInProgress: !GetRolloutStatus(statefulset).Ready,
+		Health:            GetContainerHealth(pods),
+		ImagePullErrors:   GetImagePullErrors(pods),
+		Drain:             ParseDrainStatus(statefulset.Annotations),
+	}
+}
+
+// ImageDigest returns the digest of the function's image, from the image itself when
+// it is pinned by digest, otherwise from the first ready Pod at the latest revision
+func ImageDigest(statefulset *appsv1.StatefulSet, pods []*corev1.Pod) string {
+	containers := statefulset.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return ""
+	}
+	if digest := digestOf(containers[0].Image); digest != "" {
+		return digest
+	}
+
+	sorted := make([]*corev1.Pod, len(pods))
+	copy(sorted, pods)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	revision := statefulset.Status.UpdateRevision
+	for _, pod := range sorted {
+		if revision != "" && pod.Labels[appsv1.ControllerRevisionHashLabelKey] != revision {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != containers[0].Name || !status.Ready {
+				continue
+			}
+			if digest := digestOf(status.ImageID); digest != "" {
+				return digest
+			}
+		}
+	}
+	return ""
+}
+
+// digestOf returns the digest of an image reference such as
+// docker.io/functions/figlet@sha256:..., or an empty string when there is none
+func digestOf(image string) string {
+	i := strings.LastIndex(image, "@")
+	if i < 0 {
+		return ""
+	}
+	return image[i+1:]
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ImageDigest(t *testing.T) {
+	pod := func(name, revision, imageID string, ready bool) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{appsv1.ControllerRevisionHashLabelKey: revision},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "sidecar", Ready: true, ImageID: "docker.io/library/envoy@sha256:envoy"},
+					{Name: "figlet", Ready: ready, ImageID: imageID},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name  string
+		image string
+		pods  []*corev1.Pod
+		want  string
+	}{
+		{
+			name:  "pinned by digest",
+			image: "ghcr.io/openfaas/figlet@sha256:pinned",
+			want:  "sha256:pinned",
+		},
+		{
+			name:  "first ready pod at the latest revision",
+			image: "ghcr.io/openfaas/figlet:latest",
+			pods: []*corev1.Pod{
+				pod("figlet-2", "figlet-new", "ghcr.io/openfaas/figlet@sha256:two", true),
+				pod("figlet-0", "figlet-old", "ghcr.io/openfaas/figlet@sha256:old", true),
+				pod("figlet-1", "figlet-new", "ghcr.io/openfaas/figlet@sha256:one", true),
+			},
+			want: "sha256:one",
+		},
+		{
+			name:  "pod not ready",
+			image: "ghcr.io/openfaas/figlet:latest",
+			pods:  []*corev1.Pod{pod("figlet-0", "figlet-new", "ghcr.io/openfaas/figlet@sha256:new", false)},
+		},
+		{
+			name:  "image id without a digest",
+			image: "ghcr.io/openfaas/figlet:latest",
+			pods:  []*corev1.Pod{pod("figlet-0", "figlet-new", "sha256:config", true)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			statefulset := &appsv1.StatefulSet{
+				Spec: appsv1.StatefulSetSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "figlet", Image: tc.image}}},
+					},
+				},
+				Status: appsv1.StatefulSetStatus{UpdateRevision: "figlet-new"},
+			}
+
+			if got := ImageDigest(statefulset, tc.pods); got != tc.want {
+				t.Errorf("want digest %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_GetRuntimeStatus_RolloutInProgress(t *testing.T) {
+	replicas := int32(2)
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Generation: 3},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "figlet", Image: "ghcr.io/openfaas/figlet:latest"}}},
+			},
+		},
+		Status: appsv1.StatefulSetStatus{ObservedGeneration: 3, Replicas: 2, UpdatedReplicas: 1, ReadyReplicas: 2},
+	}
+
+	if got := GetRuntimeStatus(statefulset, nil); !got.RolloutInProgress {
+		t.Errorf("want a rollout in progress, got %+v", got)
+	}
+
+	statefulset.Status.UpdatedReplicas = 2
+	if got := GetRuntimeStatus(statefulset, nil); got.RolloutInProgress {
+		t.Errorf("want the rollout to be complete, got %+v", got)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// defaultScaleFromZeroInterval is how often the endpoints are checked while waiting
+// for a function to become ready
+const defaultScaleFromZeroInterval = 50 * time.Millisecond
+
+// ScaleFromZeroResolver resolves functions with a FunctionLookup. A function that
+// has no ready endpoints is scaled up to one replica when it is at zero, then the
+// resolver waits for an endpoint to become ready, so that the first invocation of a
+// function that was scaled to zero succeeds instead of failing with a 503.
+type ScaleFromZeroResolver struct {
+	Lookup       *FunctionLookup
+	Client       kubernetes.Interface
+	StatefulSets v1.StatefulSetLister
+
+	// Timeout bounds the wait for a ready endpoint
+	Timeout time.Duration
+
+	// Interval between the checks for a ready endpoint, the endpoints are read from
+	// the informer so the checks do not call the API server
+	Interval time.Duration
+}
+
+// NewScaleFromZeroResolver creates a ScaleFromZeroResolver that waits for up to
+// timeout for a function to become ready
+func NewScaleFromZeroResolver(lookup *FunctionLookup, client kubernetes.Interface, statefulsets v1.StatefulSetLister, timeout time.Duration) *ScaleFromZeroResolver {
+	return &ScaleFromZeroResolver{
+		Lookup:       lookup,
+		Client:       client,
+		StatefulSets: statefulsets,
+		Timeout:      timeout,
+		Interval:     defaultScaleFromZeroInterval,
+	}
+}
+
+// Resolve implements proxy.BaseURLResolver, the wait is only bounded by Timeout
+func (r *ScaleFromZeroResolver) Resolve(name string) (url.URL, error) {
+	return r.ResolveContext(context.Background(), name)
+}
+
+// Started records an invocation in progress to the host with the Lookup
+func (r *ScaleFromZeroResolver) Started(host string) {
+	r.Lookup.Started(host)
+}
+
+// Finished records the end of an invocation to the host with the Lookup
+func (r *ScaleFromZeroResolver) Finished(host string) {
+	r.Lookup.Finished(host)
+}
+
+// ResolveContext returns the URL of a ready endpoint of the function, the wait ends
+// early when ctx is cancelled
+func (r *ScaleFromZeroResolver) ResolveContext(ctx context.Context, name string) (url.URL, error) {
+	functionURL, resolveErr := r.Lookup.ResolveContext(ctx, name)
+	if resolveErr == nil {
+		return functionURL, nil
+	}
+
+	namespace := getNamespace(name, r.Lookup.DefaultNamespace)
+	if err := r.Lookup.verifyNamespace(namespace); err != nil {
+		return url.URL{}, err
+	}
+	functionName := strings.TrimSuffix(name, "."+namespace)
+
+	statefulset, err := r.StatefulSets.StatefulSets(namespace).Get(functionName)
+	if errors.IsNotFound(err) {
+		return url.URL{}, resolveErr
+	} else if err != nil {
+		return url.URL{}, err
+	}
+	if _, ok := statefulset.Labels["faas_function"]; !ok {
+		return url.URL{}, resolveErr
+	}
+
+	logger := logging.FromContext(ctx).WithValues("function", functionName, "namespace", namespace)
+
+	// a function that is already scaling up, or whose pods are not ready yet, is
+	// waited for without being scaled again
+	if statefulset.Spec.Replicas != nil && *statefulset.Spec.Replicas == 0 {
+		logger.Info("Scaling from zero")
+		if err := ApplyStatefulSetReplicas(ctx, r.Client, namespace, functionName, 1, ScaleFieldManager); err != nil {
+			return url.URL{}, fmt.Errorf("unable to scale \"%s.%s\" from zero: %w", functionName, namespace, err)
+		}
+	}
+
+	start := time.Now()
+	err = wait.PollUntilContextTimeout(ctx, r.Interval, r.Timeout, true, func(context.Context) (bool, error) {
+		functionURL, resolveErr = r.Lookup.ResolveContext(ctx, name)
+		return resolveErr == nil, nil
+	})
+	if err != nil {
+		return url.URL{}, fmt.Errorf("no ready endpoints for \"%s.%s\" after %s: %w", functionName, namespace, r.Timeout, resolveErr)
+	}
+
+	logger.V(1).Info("Function is ready", "seconds", time.Since(start).Seconds())
+	return functionURL, nil
+}
@@ -0,0 +1,99 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newScaleFromZeroResolver(replicas int32) (*ScaleFromZeroResolver, cache.Indexer, *fake.Clientset) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "figlet",
+			Namespace: "openfaas-fn",
+			Labels:    map[string]string{"faas_function": "figlet"},
+		},
+		Spec: appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+
+	statefulsets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	statefulsets.Add(statefulset)
+
+	endpointSlices := cache.NewIndexer(cache.MetaNamespaceKeyFunc, EndpointSliceIndexers)
+	client := fake.NewSimpleClientset(statefulset)
+
+	resolver := NewScaleFromZeroResolver(NewFunctionLookup("openfaas-fn", endpointSlices), client, v1.NewStatefulSetLister(statefulsets), time.Second)
+	resolver.Interval = time.Millisecond
+	return resolver, endpointSlices, client
+}
+
+func Test_ScaleFromZeroResolver_ScalesUpAndWaitsForAnEndpoint(t *testing.T) {
+	resolver, endpointSlices, client := newScaleFromZeroResolver(0)
+
+	ready := true
+	client.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		// the endpoint becomes ready some time after the function was scaled up
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			endpointSlices.Add(newTestEndpointSlice("openfaas-fn", "figlet", &ready, "10.0.0.1"))
+		}()
+		return true, &appsv1.StatefulSet{}, nil
+	})
+
+	got, err := resolver.ResolveContext(context.Background(), "figlet")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.String() != "http://10.0.0.1:8080" {
+		t.Errorf("want http://10.0.0.1:8080, got %s", got.String())
+	}
+
+	patches := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	if patches != 1 {
+		t.Errorf("want the function to be scaled once, got %d patches", patches)
+	}
+}
+
+func Test_ScaleFromZeroResolver_DoesNotScaleAFunctionThatIsStarting(t *testing.T) {
+	resolver, _, client := newScaleFromZeroResolver(1)
+	resolver.Timeout = 10 * time.Millisecond
+
+	_, err := resolver.ResolveContext(context.Background(), "figlet")
+	if err == nil {
+		t.Fatal("want an error when no endpoint becomes ready")
+	}
+
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("want no patch for a function with replicas, got %v", action)
+		}
+	}
+}
+
+func Test_ScaleFromZeroResolver_UnknownFunction(t *testing.T) {
+	resolver, _, client := newScaleFromZeroResolver(0)
+
+	start := time.Now()
+	if _, err := resolver.ResolveContext(context.Background(), "nodeinfo"); err == nil {
+		t.Fatal("want an error for a function that does not exist")
+	}
+	if time.Since(start) >= resolver.Timeout {
+		t.Errorf("want an unknown function to fail without waiting")
+	}
+	if len(client.Actions()) != 0 {
+		t.Errorf("want no calls to the API server, got %v", client.Actions())
+	}
+}
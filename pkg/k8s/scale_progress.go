@@ -0,0 +1,72 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultScaleProgressInterval is how often the StatefulSet is read while waiting
+// for it to reach the desired number of ready replicas
+const defaultScaleProgressInterval = time.Second
+
+// ScaleProgress is the status of a function that is being scaled to Replicas
+type ScaleProgress struct {
+	// Replicas is the desired count of replicas
+	Replicas int32 `json:"replicas"`
+	// CurrentReplicas is the count of Pods created by the StatefulSet
+	CurrentReplicas int32 `json:"currentReplicas"`
+	// ReadyReplicas is the count of Pods that are ready to serve invocations
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// Ready is true once the StatefulSet has Replicas Pods and all of them are ready
+	Ready bool `json:"ready"`
+}
+
+// GetScaleProgress reads the progress of a StatefulSet towards replicas from its
+// status, the status is only trusted once the controller has observed the latest
+// generation of the StatefulSet
+func GetScaleProgress(statefulset *appsv1.StatefulSet, replicas int32) ScaleProgress {
+	status := statefulset.Status
+	progress := ScaleProgress{
+		Replicas:        replicas,
+		CurrentReplicas: status.Replicas,
+		ReadyReplicas:   status.ReadyReplicas,
+	}
+
+	progress.Ready = status.ObservedGeneration >= statefulset.Generation &&
+		status.Replicas == replicas &&
+		status.ReadyReplicas >= replicas
+	return progress
+}
+
+// WaitForReadyReplicas waits for up to timeout for the StatefulSet to have replicas
+// ready Pods. A StatefulSet starts its Pods one at a time, so the progress that was
+// last observed is returned when the timeout is reached, with Ready set to false.
+func WaitForReadyReplicas(ctx context.Context, client kubernetes.Interface, namespace, name string, replicas int32, timeout time.Duration) (ScaleProgress, error) {
+	return waitForReadyReplicas(ctx, client, namespace, name, replicas, defaultScaleProgressInterval, timeout)
+}
+
+func waitForReadyReplicas(ctx context.Context, client kubernetes.Interface, namespace, name string, replicas int32, interval, timeout time.Duration) (ScaleProgress, error) {
+	progress := ScaleProgress{Replicas: replicas}
+
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		statefulset, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		progress = GetScaleProgress(statefulset, replicas)
+		return progress.Ready, nil
+	})
+	if err != nil && !wait.Interrupted(err) {
+		return progress, err
+	}
+
+	return progress, nil
+}
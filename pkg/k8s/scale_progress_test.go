@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_GetScaleProgress(t *testing.T) {
+	cases := []struct {
+		name   string
+		status appsv1.StatefulSetStatus
+		ready  bool
+	}{
+		{
+			name:   "all replicas ready",
+			status: appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 3, ReadyReplicas: 3},
+			ready:  true,
+		},
+		{
+			name:   "pods still starting",
+			status: appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 2, ReadyReplicas: 1},
+		},
+		{
+			name:   "pods still terminating after a scale down",
+			status: appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 4, ReadyReplicas: 4},
+		},
+		{
+			name:   "generation not observed",
+			status: appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 3, ReadyReplicas: 3},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			statefulset := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Status:     c.status,
+			}
+
+			progress := GetScaleProgress(statefulset, 3)
+			if progress.Ready != c.ready {
+				t.Errorf("want ready: %v, got: %v", c.ready, progress.Ready)
+			}
+			if progress.ReadyReplicas != c.status.ReadyReplicas {
+				t.Errorf("want readyReplicas: %d, got: %d", c.status.ReadyReplicas, progress.ReadyReplicas)
+			}
+		})
+	}
+}
+
+func Test_WaitForReadyReplicas(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+	}
+	client := fake.NewSimpleClientset(statefulset)
+
+	// a Pod becomes ready on each read
+	ready := int32(0)
+	client.PrependReactor("get", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		ready++
+		s := statefulset.DeepCopy()
+		s.Status = appsv1.StatefulSetStatus{Replicas: ready, ReadyReplicas: ready}
+		return true, s, nil
+	})
+
+	progress, err := waitForReadyReplicas(context.Background(), client, "openfaas-fn", "figlet", 3, time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !progress.Ready || progress.ReadyReplicas != 3 {
+		t.Errorf("want 3 ready replicas, got: %+v", progress)
+	}
+}
+
+func Test_WaitForReadyReplicas_ReturnsProgressAfterTimeout(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Status:     appsv1.StatefulSetStatus{Replicas: 2, ReadyReplicas: 1},
+	}
+	client := fake.NewSimpleClientset(statefulset)
+
+	progress, err := waitForReadyReplicas(context.Background(), client, "openfaas-fn", "figlet", 3, time.Millisecond, time.Millisecond*20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Ready {
+		t.Errorf("want the function to not be ready")
+	}
+	if progress.CurrentReplicas != 2 || progress.ReadyReplicas != 1 {
+		t.Errorf("want the last observed progress, got: %+v", progress)
+	}
+}
+
+func Test_WaitForReadyReplicas_NotFound(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	if _, err := waitForReadyReplicas(context.Background(), client, "openfaas-fn", "figlet", 1, time.Millisecond, time.Second); err == nil {
+		t.Errorf("want an error for a missing statefulset")
+	}
+}
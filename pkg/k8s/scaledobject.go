@@ -0,0 +1,137 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// kedaAnnotationPrefix is the prefix of the annotations that configure the KEDA
+	// ScaledObject of a function
+	kedaAnnotationPrefix = "com.openfaas.scale.keda."
+
+	// AnnotationKedaType is the type of the KEDA trigger, i.e. kafka or prometheus,
+	// a ScaledObject is only created when it is set
+	AnnotationKedaType = kedaAnnotationPrefix + "type"
+
+	// AnnotationKedaMetadata is the prefix of the trigger's metadata, for instance
+	// com.openfaas.scale.keda.metadata.topic: orders
+	AnnotationKedaMetadata = kedaAnnotationPrefix + "metadata."
+
+	// AnnotationKedaAuthenticationRef is the name of a TriggerAuthentication in the
+	// function's namespace
+	AnnotationKedaAuthenticationRef = kedaAnnotationPrefix + "authenticationRef"
+
+	AnnotationKedaPollingInterval = kedaAnnotationPrefix + "pollingInterval"
+	AnnotationKedaCooldownPeriod  = kedaAnnotationPrefix + "cooldownPeriod"
+)
+
+// ScaledObjectResource is the KEDA ScaledObject, it is managed with the dynamic
+// client so that KEDA is only required when a function uses it
+var ScaledObjectResource = schema.GroupVersionResource{Group: "keda.sh", Version: "v1alpha1", Resource: "scaledobjects"}
+
+// MakeScaledObject creates the KEDA ScaledObject for the StatefulSet of a function
+// from its com.openfaas.scale.keda.* annotations, nil is returned when the function
+// does not set a trigger type. The min and max replicas are read from the
+// LabelMinReplicas and LabelMaxReplicas labels. The owner is set by the caller.
+func MakeScaledObject(name, namespace string, annotations, labels map[string]string) (*unstructured.Unstructured, error) {
+	triggerType := annotations[AnnotationKedaType]
+	if triggerType == "" {
+		return nil, nil
+	}
+
+	metadata := map[string]interface{}{}
+	for key, value := range annotations {
+		if name := strings.TrimPrefix(key, AnnotationKedaMetadata); name != key && name != "" {
+			metadata[name] = value
+		}
+	}
+
+	trigger := map[string]interface{}{
+		"type":     triggerType,
+		"metadata": metadata,
+	}
+	if ref := annotations[AnnotationKedaAuthenticationRef]; ref != "" {
+		trigger["authenticationRef"] = map[string]interface{}{"name": ref}
+	}
+
+	spec := map[string]interface{}{
+		"scaleTargetRef": map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "StatefulSet",
+			"name":       name,
+		},
+		"triggers": []interface{}{trigger},
+	}
+
+	fields := []struct {
+		field  string
+		values map[string]string
+		key    string
+	}{
+		{"pollingInterval", annotations, AnnotationKedaPollingInterval},
+		{"cooldownPeriod", annotations, AnnotationKedaCooldownPeriod},
+		{"minReplicaCount", labels, LabelMinReplicas},
+		{"maxReplicaCount", labels, LabelMaxReplicas},
+	}
+	for _, f := range fields {
+		value, ok := f.values[f.key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid value for %s: %q", f.key, value)
+		}
+		spec[f.field] = n
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": ScaledObjectResource.GroupVersion().String(),
+		"kind":       "ScaledObject",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{"faas_function": name},
+		},
+		"spec": spec,
+	}}, nil
+}
+
+// SyncScaledObject applies the ScaledObject of a function, or removes the one that
+// is owned by its StatefulSet when the function no longer sets a trigger. The labels
+// are added to the ScaledObject.
+func SyncScaledObject(ctx context.Context, client dynamic.Interface, functionName, namespace string, annotations, functionLabels map[string]string, owner metav1.OwnerReference, labels map[string]string) error {
+	scaledObject, err := MakeScaledObject(functionName, namespace, annotations, functionLabels)
+	if err != nil {
+		return err
+	}
+
+	if client == nil {
+		if scaledObject != nil {
+			return fmt.Errorf("%s is not supported without a dynamic client", AnnotationKedaType)
+		}
+		return nil
+	}
+
+	if scaledObject == nil {
+		return DeleteOwnedResource(ctx, client, ScaledObjectResource, namespace, functionName, functionName)
+	}
+
+	scaledObject.SetOwnerReferences([]metav1.OwnerReference{owner})
+	AddLabels(scaledObject, labels)
+
+	_, err = client.Resource(ScaledObjectResource).Namespace(namespace).
+		Apply(ctx, functionName, scaledObject, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestScaledObject(t *testing.T, owners []metav1.OwnerReference) *unstructured.Unstructured {
+	scaledObject, err := MakeScaledObject("figlet", "openfaas-fn", map[string]string{AnnotationKedaType: "kafka"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	scaledObject.SetOwnerReferences(owners)
+	return scaledObject
+}
+
+func Test_SyncScaledObject_RemovesOwnedScaledObject(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ScaledObjectResource: "ScaledObjectList",
+	}, newTestScaledObject(t, []metav1.OwnerReference{owner}))
+
+	if err := SyncScaledObject(context.Background(), dynamicClient, "figlet", "openfaas-fn", map[string]string{}, nil, owner, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := dynamicClient.Resource(ScaledObjectResource).Namespace("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err == nil {
+		t.Errorf("want the ScaledObject to be deleted when the function no longer sets a trigger")
+	}
+}
+
+func Test_SyncScaledObject_KeepsScaledObjectOfOthers(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ScaledObjectResource: "ScaledObjectList",
+	}, newTestScaledObject(t, nil))
+
+	if err := SyncScaledObject(context.Background(), dynamicClient, "figlet", "openfaas-fn", map[string]string{}, nil, owner, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := dynamicClient.Resource(ScaledObjectResource).Namespace("openfaas-fn").Get(context.Background(), "figlet", metav1.GetOptions{})
+	if err != nil {
+		t.Errorf("want a ScaledObject that is not owned by the function to be kept, got: %s", err)
+	}
+}
+
+func Test_SyncScaledObject_RequiresDynamicClient(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "figlet"}
+
+	if err := SyncScaledObject(context.Background(), nil, "figlet", "openfaas-fn", map[string]string{}, nil, owner, nil); err != nil {
+		t.Errorf("want no error without a trigger, got: %s", err)
+	}
+
+	annotations := map[string]string{AnnotationKedaType: "kafka"}
+	if err := SyncScaledObject(context.Background(), nil, "figlet", "openfaas-fn", annotations, nil, owner, nil); err == nil {
+		t.Errorf("want an error when a trigger is set without a dynamic client")
+	}
+}
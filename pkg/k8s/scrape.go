@@ -0,0 +1,101 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ScrapeAnnotation is set to false on functions that do not configure scraping,
+	// since the watchdog does not expose a metrics endpoint
+	ScrapeAnnotation = "prometheus.io.scrape"
+
+	// PrometheusScrapeAnnotation, PrometheusPortAnnotation and PrometheusPathAnnotation
+	// are read by the Prometheus configurations that discover pods by annotation,
+	// for functions that expose their own metrics
+	PrometheusScrapeAnnotation = "prometheus.io/scrape"
+	PrometheusPortAnnotation   = "prometheus.io/port"
+	PrometheusPathAnnotation   = "prometheus.io/path"
+)
+
+// scrapeAnnotations lists each setting with both of the forms that Prometheus
+// reads as the same label, i.e. prometheus_io_scrape
+var scrapeAnnotations = map[string][]string{
+	"scrape": {ScrapeAnnotation, PrometheusScrapeAnnotation},
+	"port":   {"prometheus.io.port", PrometheusPortAnnotation},
+	"path":   {"prometheus.io.path", PrometheusPathAnnotation},
+}
+
+// DefaultScrapeAnnotation disables scraping of the function unless it was set with
+// either form of the scrape annotation, setting both would leave it to Prometheus
+// to pick one of the values
+func DefaultScrapeAnnotation(annotations map[string]string) {
+	for _, key := range scrapeAnnotations["scrape"] {
+		if _, ok := annotations[key]; ok {
+			return
+		}
+	}
+	annotations[ScrapeAnnotation] = "false"
+}
+
+// ScrapeAnnotations returns the scrape, port and path annotations of a function
+// with the default applied, for the objects such as the Service that do not carry
+// all of its annotations
+func ScrapeAnnotations(annotations map[string]string) map[string]string {
+	scrape := map[string]string{}
+	for _, keys := range scrapeAnnotations {
+		for _, key := range keys {
+			if v, ok := annotations[key]; ok {
+				scrape[key] = v
+			}
+		}
+	}
+	DefaultScrapeAnnotation(scrape)
+	return scrape
+}
+
+// ValidateScrapeAnnotations checks the scrape, port and path annotations, the two
+// forms of a setting must agree when both are given
+func ValidateScrapeAnnotations(annotations map[string]string) error {
+	for _, setting := range []string{"scrape", "port", "path"} {
+		var value, from string
+		for _, key := range scrapeAnnotations[setting] {
+			v, ok := annotations[key]
+			if !ok {
+				continue
+			}
+			if from != "" && v != value {
+				return fmt.Errorf("%s: %q conflicts with %s: %q", key, v, from, value)
+			}
+			value, from = v, key
+
+			if err := validateScrapeValue(setting, v); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateScrapeValue(setting, value string) error {
+	switch setting {
+	case "scrape":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be true or false, got %q", value)
+		}
+	case "port":
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("must be a port between 1 and 65535, got %q", value)
+		}
+	case "path":
+		if !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("must be an absolute path, got %q", value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_DefaultScrapeAnnotation(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        map[string]string
+	}{
+		{
+			name:        "disabled by default",
+			annotations: map[string]string{},
+			want:        map[string]string{ScrapeAnnotation: "false"},
+		},
+		{
+			name:        "enabled with the dotted form",
+			annotations: map[string]string{ScrapeAnnotation: "true"},
+			want:        map[string]string{ScrapeAnnotation: "true"},
+		},
+		{
+			name: "enabled with the slash form",
+			annotations: map[string]string{
+				PrometheusScrapeAnnotation: "true",
+				PrometheusPortAnnotation:   "8081",
+			},
+			want: map[string]string{
+				PrometheusScrapeAnnotation: "true",
+				PrometheusPortAnnotation:   "8081",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			DefaultScrapeAnnotation(tc.annotations)
+			if !reflect.DeepEqual(tc.annotations, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, tc.annotations)
+			}
+		})
+	}
+}
+
+func Test_ScrapeAnnotations(t *testing.T) {
+	got := ScrapeAnnotations(map[string]string{
+		"topic":                    "orders",
+		PrometheusScrapeAnnotation: "true",
+		PrometheusPortAnnotation:   "8081",
+		PrometheusPathAnnotation:   "/custom/metrics",
+	})
+
+	want := map[string]string{
+		PrometheusScrapeAnnotation: "true",
+		PrometheusPortAnnotation:   "8081",
+		PrometheusPathAnnotation:   "/custom/metrics",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func Test_ValidateScrapeAnnotations(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{name: "none"},
+		{
+			name: "valid",
+			annotations: map[string]string{
+				PrometheusScrapeAnnotation: "true",
+				PrometheusPortAnnotation:   "8081",
+				PrometheusPathAnnotation:   "/metrics",
+			},
+		},
+		{
+			name: "both forms agree",
+			annotations: map[string]string{
+				ScrapeAnnotation:           "true",
+				PrometheusScrapeAnnotation: "true",
+			},
+		},
+		{
+			name: "both forms conflict",
+			annotations: map[string]string{
+				ScrapeAnnotation:           "false",
+				PrometheusScrapeAnnotation: "true",
+			},
+			wantErr: true,
+		},
+		{
+			name:        "scrape is not a bool",
+			annotations: map[string]string{PrometheusScrapeAnnotation: "yes please"},
+			wantErr:     true,
+		},
+		{
+			name:        "port out of range",
+			annotations: map[string]string{PrometheusPortAnnotation: "70000"},
+			wantErr:     true,
+		},
+		{
+			name:        "relative path",
+			annotations: map[string]string{PrometheusPathAnnotation: "metrics"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateScrapeAnnotations(tc.annotations)
+			if tc.wantErr && err == nil {
+				t.Errorf("want an error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
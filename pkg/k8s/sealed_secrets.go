@@ -0,0 +1,129 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretUnsealer decrypts the values that were sealed with kubeseal --raw for the
+// Sealed Secrets controller of the cluster, so that the plaintext of a secret is
+// only seen by the cluster and not by the pipeline that creates it
+type SecretUnsealer struct {
+	keys []*rsa.PrivateKey
+}
+
+// LoadSecretUnsealer reads the PEM encoded private keys of the Sealed Secrets
+// controller from path, i.e. the tls.key of each of its active keys concatenated,
+// so that values sealed before a key rotation can still be unsealed
+func LoadSecretUnsealer(path string) (*SecretUnsealer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sealing keys: %w", err)
+	}
+
+	u := &SecretUnsealer{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		key, err := parseRSAPrivateKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse sealing key: %w", err)
+		}
+		u.keys = append(u.keys, key)
+	}
+
+	if len(u.keys) == 0 {
+		return nil, fmt.Errorf("no sealing keys found in %s", path)
+	}
+	return u, nil
+}
+
+func parseRSAPrivateKey(block *pem.Block) (*rsa.PrivateKey, error) {
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("want an RSA key, got %T", key)
+	}
+	return rsaKey, nil
+}
+
+// Unseal returns the plaintext of a value sealed with kubeseal --raw for the secret
+// name in namespace. The value must be sealed with the strict or the namespace-wide
+// scope, so that a value sealed for one secret can not be stored in another
+// namespace.
+func (u *SecretUnsealer) Unseal(namespace, name string, value []byte) ([]byte, error) {
+	encoded := strings.TrimSpace(string(value))
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("sealed value is not base64 encoded: %w", err)
+	}
+
+	labels := [][]byte{
+		[]byte(namespace + "/" + name),
+		[]byte(namespace),
+	}
+	for _, key := range u.keys {
+		for _, label := range labels {
+			plaintext, err := hybridDecrypt(key, ciphertext, label)
+			if err == nil {
+				return plaintext, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unable to unseal the value of secret %s in namespace %s, it must be sealed for this name and namespace", name, namespace)
+}
+
+// hybridDecrypt reverses the encryption of kubeseal, the length of the session key
+// encrypted with RSA-OAEP, the session key and the value encrypted with AES-GCM
+func hybridDecrypt(key *rsa.PrivateKey, ciphertext, label []byte) ([]byte, error) {
+	if len(ciphertext) < 2 {
+		return nil, errors.New("sealed value is too short")
+	}
+	keyLength := int(binary.BigEndian.Uint16(ciphertext))
+	if len(ciphertext) < 2+keyLength {
+		return nil, errors.New("sealed value is too short")
+	}
+
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), nil, key, ciphertext[2:2+keyLength], label)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// each session key is only used once, so the nonce is always zero
+	nonce := make([]byte, gcm.NonceSize())
+	return gcm.Open(nil, nonce, ciphertext[2+keyLength:], nil)
+}
@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// seal encrypts the value in the same way as kubeseal --raw
+func seal(t *testing.T, key *rsa.PublicKey, value, label string) string {
+	sessionKey := make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, sessionKey, []byte(label))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := aes.NewCipher(sessionKey)
+	gcm, _ := cipher.NewGCM(block)
+
+	ciphertext := make([]byte, 2)
+	binary.BigEndian.PutUint16(ciphertext, uint16(len(encryptedKey)))
+	ciphertext = append(ciphertext, encryptedKey...)
+	ciphertext = gcm.Seal(ciphertext, make([]byte, gcm.NonceSize()), []byte(value), nil)
+
+	return base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+func newSealingKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "tls.key")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key, path
+}
+
+func Test_SecretUnsealer_Unseal(t *testing.T) {
+	key, path := newSealingKey(t)
+	unsealer, err := LoadSecretUnsealer(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		name    string
+		label   string
+		wantErr bool
+	}{
+		{name: "strict scope", label: "openfaas-fn/api-key"},
+		{name: "namespace-wide scope", label: "openfaas-fn"},
+		{name: "sealed for another secret", label: "openfaas-fn/db-password", wantErr: true},
+		{name: "sealed for another namespace", label: "staging/api-key", wantErr: true},
+		{name: "cluster-wide scope", label: "", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			value := seal(t, &key.PublicKey, "s3cr3t", tc.label)
+
+			plaintext, err := unsealer.Unseal("openfaas-fn", "api-key", []byte(value))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want an error, got %q", plaintext)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(plaintext) != "s3cr3t" {
+				t.Errorf("want s3cr3t, got %q", plaintext)
+			}
+		})
+	}
+}
+
+func Test_SecretUnsealer_RotatedKeys(t *testing.T) {
+	oldKey, oldPath := newSealingKey(t)
+	_, newPath := newSealingKey(t)
+
+	oldPEM, _ := os.ReadFile(oldPath)
+	newPEM, _ := os.ReadFile(newPath)
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	if err := os.WriteFile(path, append(newPEM, oldPEM...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	unsealer, err := LoadSecretUnsealer(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	value := seal(t, &oldKey.PublicKey, "s3cr3t", "openfaas-fn/api-key")
+	if _, err := unsealer.Unseal("openfaas-fn", "api-key", []byte(value)); err != nil {
+		t.Errorf("want a value sealed with an older key to be unsealed, got %s", err)
+	}
+}
+
+func Test_LoadSecretUnsealer_NoKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tls.key")
+	os.WriteFile(path, []byte("not a key"), 0600)
+
+	if _, err := LoadSecretUnsealer(path); err == nil {
+		t.Errorf("want an error without keys")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AnnotationSecretsMountPath is the directory the secrets of a function are
+	// mounted at, instead of /var/openfaas/secrets
+	AnnotationSecretsMountPath = "com.openfaas.secrets.mount-path"
+	// AnnotationSecretsMode is the octal file mode of the secrets of a function, such
+	// as 0400
+	AnnotationSecretsMode = "com.openfaas.secrets.mode"
+	// AnnotationSecretsItems maps the keys of secrets to paths under the mount path,
+	// as a comma separated list of secret/key=path
+	AnnotationSecretsItems = "com.openfaas.secrets.items"
+)
+
+// SecretMounts is where the secrets of a function are mounted, and with which mode
+type SecretMounts struct {
+	// MountPath is the directory of the secrets
+	MountPath string
+	// Mode is the file mode of the secrets, the default of Kubernetes when nil
+	Mode *int32
+	// Items is the path of a key, by the name of its secret and then by the key
+	Items map[string]map[string]string
+}
+
+// ParseSecretMounts reads the SecretMounts of a function from its annotations,
+// the secrets are mounted at /var/openfaas/secrets with the name of each key
+// when none are set
+func ParseSecretMounts(annotations map[string]string) (SecretMounts, error) {
+	mounts := SecretMounts{MountPath: secretsMountPath, Items: map[string]map[string]string{}}
+
+	if value, ok := annotations[AnnotationSecretsMountPath]; ok {
+		if !path.IsAbs(value) || path.Clean(value) != value || value == "/" {
+			return mounts, fmt.Errorf("invalid %s annotation: %q, must be a clean absolute path other than /", AnnotationSecretsMountPath, value)
+		}
+		mounts.MountPath = value
+	}
+
+	if value, ok := annotations[AnnotationSecretsMode]; ok {
+		mode, err := strconv.ParseInt(value, 8, 32)
+		if err != nil || mode < 0 || mode > 0777 {
+			return mounts, fmt.Errorf("invalid %s annotation: %q, must be an octal mode between 0000 and 0777", AnnotationSecretsMode, value)
+		}
+		m := int32(mode)
+		mounts.Mode = &m
+	}
+
+	value, ok := annotations[AnnotationSecretsItems]
+	if !ok {
+		return mounts, nil
+	}
+
+	paths := map[string]string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		ref, itemPath, ok := strings.Cut(item, "=")
+		secret, key, hasKey := strings.Cut(ref, "/")
+		if !ok || !hasKey || secret == "" || key == "" {
+			return mounts, fmt.Errorf("invalid %s annotation: %q, must be secret/key=path", AnnotationSecretsItems, item)
+		}
+		if itemPath == "" || path.IsAbs(itemPath) || path.Clean(itemPath) != itemPath || itemPath == ".." || strings.HasPrefix(itemPath, "../") {
+			return mounts, fmt.Errorf("invalid %s annotation: %q, the path must be relative to the mount path", AnnotationSecretsItems, item)
+		}
+		if other, ok := paths[itemPath]; ok && other != ref {
+			return mounts, fmt.Errorf("invalid %s annotation: %s and %s have the same path: %s", AnnotationSecretsItems, other, ref, itemPath)
+		}
+		paths[itemPath] = ref
+
+		if mounts.Items[secret] == nil {
+			mounts.Items[secret] = map[string]string{}
+		}
+		mounts.Items[secret][key] = itemPath
+	}
+	return mounts, nil
+}
+
+// Path returns the path of the key of a secret under the mount path
+func (m SecretMounts) Path(secret, key string) string {
+	if itemPath, ok := m.Items[secret][key]; ok {
+		return itemPath
+	}
+	return key
+}
+
+// ProjectedVolume returns the projected volume of the secrets, with the Mode of the
+// SecretMounts
+func (m SecretMounts) ProjectedVolume(name string, sources []apiv1.VolumeProjection) apiv1.Volume {
+	return apiv1.Volume{
+		Name: name,
+		VolumeSource: apiv1.VolumeSource{
+			Projected: &apiv1.ProjectedVolumeSource{
+				Sources:     sources,
+				DefaultMode: m.Mode,
+			},
+		},
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func Test_ParseSecretMounts(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{name: "defaults", annotations: map[string]string{}},
+		{name: "mount path", annotations: map[string]string{AnnotationSecretsMountPath: "/etc/app/credentials"}},
+		{name: "relative mount path", annotations: map[string]string{AnnotationSecretsMountPath: "etc/app"}, wantErr: true},
+		{name: "root mount path", annotations: map[string]string{AnnotationSecretsMountPath: "/"}, wantErr: true},
+		{name: "unclean mount path", annotations: map[string]string{AnnotationSecretsMountPath: "/etc/../app/"}, wantErr: true},
+		{name: "mode", annotations: map[string]string{AnnotationSecretsMode: "0400"}},
+		{name: "decimal mode", annotations: map[string]string{AnnotationSecretsMode: "0899"}, wantErr: true},
+		{name: "mode out of range", annotations: map[string]string{AnnotationSecretsMode: "1777"}, wantErr: true},
+		{name: "items", annotations: map[string]string{AnnotationSecretsItems: "db/password=db/password.txt, api/token=token"}},
+		{name: "item without a key", annotations: map[string]string{AnnotationSecretsItems: "db=password"}, wantErr: true},
+		{name: "item without a path", annotations: map[string]string{AnnotationSecretsItems: "db/password="}, wantErr: true},
+		{name: "absolute item path", annotations: map[string]string{AnnotationSecretsItems: "db/password=/etc/password"}, wantErr: true},
+		{name: "item path outside of the mount", annotations: map[string]string{AnnotationSecretsItems: "db/password=../password"}, wantErr: true},
+		{name: "items with the same path", annotations: map[string]string{AnnotationSecretsItems: "db/password=token,api/token=token"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseSecretMounts(c.annotations)
+			if (err != nil) != c.wantErr {
+				t.Errorf("want error: %t, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_ParseSecretMounts_Values(t *testing.T) {
+	mounts, err := ParseSecretMounts(map[string]string{
+		AnnotationSecretsMountPath: "/etc/app",
+		AnnotationSecretsMode:      "0440",
+		AnnotationSecretsItems:     "db/password=db/password.txt",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if mounts.MountPath != "/etc/app" {
+		t.Errorf("want the mount path /etc/app, got %q", mounts.MountPath)
+	}
+	if mounts.Mode == nil || *mounts.Mode != 0440 {
+		t.Errorf("want the mode 0440, got %v", mounts.Mode)
+	}
+	if got := mounts.Path("db", "password"); got != "db/password.txt" {
+		t.Errorf("want the mapped path of db/password, got %q", got)
+	}
+	if got := mounts.Path("db", "user"); got != "user" {
+		t.Errorf("want the key as the path of an unmapped key, got %q", got)
+	}
+}
+
+func Test_ConfigureSecrets_SecretMounts(t *testing.T) {
+	factory := FunctionFactory{}
+	statefulset := &appsv1.StatefulSet{}
+	statefulset.Name = "figlet"
+	statefulset.Spec.Template.Spec.Containers = []apiv1.Container{{Name: "figlet"}}
+
+	existing := map[string]*apiv1.Secret{
+		"db": {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"password": []byte("pass")}},
+	}
+	request := types.FunctionDeployment{
+		Service: "figlet",
+		Secrets: []string{"db", "vault:secret/data/api#token"},
+		Annotations: &map[string]string{
+			AnnotationSecretsMountPath: "/etc/app",
+			AnnotationSecretsMode:      "0400",
+			AnnotationSecretsItems:     "db/password=db/password.txt",
+		},
+	}
+	if err := factory.ConfigureSecrets(request, statefulset, existing); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	projected := statefulset.Spec.Template.Spec.Volumes[0].Projected
+	if projected.DefaultMode == nil || *projected.DefaultMode != 0400 {
+		t.Errorf("want the default mode 0400, got %v", projected.DefaultMode)
+	}
+	if items := projected.Sources[0].Secret.Items; len(items) != 1 || items[0].Path != "db/password.txt" {
+		t.Errorf("want the mapped path of the key, got %v", items)
+	}
+
+	mounts := statefulset.Spec.Template.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 2 || mounts[0].MountPath != "/etc/app" {
+		t.Fatalf("want the projected secrets at /etc/app, got %v", mounts)
+	}
+	if mounts[1].MountPath != "/etc/app/token" || mounts[1].SubPath != "token" {
+		t.Errorf("want the external secret next to the others, got %v", mounts[1])
+	}
+
+	if got := ReadFunctionSecretsSpec(*statefulset); len(got) != 2 || got[0] != "db" {
+		t.Errorf("want both secrets to be read back, got %v", got)
+	}
+}
+
+func Test_ConfigureSecrets_InvalidSecretMounts(t *testing.T) {
+	factory := FunctionFactory{}
+	statefulset := &appsv1.StatefulSet{}
+
+	request := types.FunctionDeployment{
+		Service:     "figlet",
+		Annotations: &map[string]string{AnnotationSecretsMode: "rw"},
+	}
+	if err := factory.ConfigureSecrets(request, statefulset, map[string]*apiv1.Secret{}); err == nil {
+		t.Errorf("want an error for an invalid mode")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NamespaceSecretSelectorAnnotation on a namespace replaces the configured
+// SecretSelector for the functions in it
+const NamespaceSecretSelectorAnnotation = "openfaas.com/secret-selector"
+
+// SecretSelector returns the label selector that the secrets of the functions in a
+// namespace must match, from the openfaas.com/secret-selector annotation of the
+// namespace or the configured SecretSelector. Every secret is allowed when neither
+// is set.
+func (f *FunctionFactory) SecretSelector(ctx context.Context, namespace string) (labels.Selector, error) {
+	value := f.Config.SecretSelector
+	if annotation, ok := f.namespaceAnnotations(ctx, namespace)[NamespaceSecretSelectorAnnotation]; ok {
+		value = annotation
+	}
+
+	selector, err := labels.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret selector %q for namespace %s: %w", value, namespace, err)
+	}
+	return selector, nil
+}
+
+// CheckSecretPolicy returns an error when any of the secrets of a function does not
+// match the SecretSelector of its namespace, so that a function can only mount the
+// secrets that are meant for functions, rather than any secret in a shared namespace
+func (f *FunctionFactory) CheckSecretPolicy(ctx context.Context, namespace string, secrets map[string]*apiv1.Secret) error {
+	selector, err := f.SecretSelector(ctx, namespace)
+	if err != nil {
+		// a selector that can not be parsed denies every secret, rather than allowing them all
+		logging.FromContext(ctx).Error(err, "Unable to read the secret selector")
+		return err
+	}
+	if selector.Empty() {
+		return nil
+	}
+
+	var denied []string
+	for name, secret := range secrets {
+		if !selector.Matches(labels.Set(secret.Labels)) {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		return fmt.Errorf("secrets %v do not match the selector %q of namespace %s", denied, selector.String(), namespace)
+	}
+	return nil
+}
+
+// ParseSecretSelector validates a label selector for SecretSelector
+func ParseSecretSelector(value string) error {
+	_, err := labels.Parse(value)
+	return err
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_CheckSecretPolicy(t *testing.T) {
+	secrets := map[string]*apiv1.Secret{
+		"api-key": {ObjectMeta: metav1.ObjectMeta{Name: "api-key", Labels: map[string]string{"openfaas-managed": "true"}}},
+		"db-root": {ObjectMeta: metav1.ObjectMeta{Name: "db-root"}},
+	}
+
+	namespaces := fake.NewSimpleClientset(
+		&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openfaas-fn"}},
+		&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "team-a",
+			Annotations: map[string]string{NamespaceSecretSelectorAnnotation: ""},
+		}},
+		&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "team-b",
+			Annotations: map[string]string{NamespaceSecretSelectorAnnotation: "openfaas-managed in (true"},
+		}},
+	)
+
+	cases := []struct {
+		name      string
+		selector  string
+		namespace string
+		secrets   []string
+		wantErr   string
+	}{
+		{name: "no selector", namespace: "openfaas-fn", secrets: []string{"api-key", "db-root"}},
+		{name: "matching secret", selector: "openfaas-managed=true", namespace: "openfaas-fn", secrets: []string{"api-key"}},
+		{
+			name:      "secret without the label",
+			selector:  "openfaas-managed=true",
+			namespace: "openfaas-fn",
+			secrets:   []string{"api-key", "db-root"},
+			wantErr:   "secrets [db-root] do not match the selector",
+		},
+		{name: "namespace allows all secrets", selector: "openfaas-managed=true", namespace: "team-a", secrets: []string{"db-root"}},
+		{name: "invalid namespace selector", namespace: "team-b", secrets: []string{"api-key"}, wantErr: "invalid secret selector"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := mockFactory()
+			f.Config.SecretSelector = tc.selector
+			f.NamespaceAnnotations = NewNamespaceAnnotations(namespaces)
+
+			requested := map[string]*apiv1.Secret{}
+			for _, name := range tc.secrets {
+				requested[name] = secrets[name]
+			}
+
+			err := f.CheckSecretPolicy(context.Background(), tc.namespace, requested)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("want no error, got %s", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("want an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1apply "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AnnotationSecretRotation is set on the StatefulSet of a function while its Pods
+	// are restarted for a rotated secret, with the SecretRotation as JSON
+	AnnotationSecretRotation = "com.openfaas.secrets.rotation"
+	// AnnotationSecretsRotatedAt is set on the Pod template of a function when one of
+	// its secrets is rotated, so that its Pods are restarted with the new value
+	AnnotationSecretsRotatedAt = "com.openfaas.secrets.rotated-at"
+)
+
+// SecretRotation is the progress of the restart of a function's Pods after one of
+// its secrets was rotated
+type SecretRotation struct {
+	// Secret is the name of the rotated secret
+	Secret string `json:"secret"`
+	// StartedAt is when the secret was rotated
+	StartedAt time.Time `json:"startedAt"`
+	// Partition is the lowest ordinal that is restarted, it is lowered by one each
+	// time the Pods above it are ready
+	Partition int32 `json:"partition"`
+}
+
+// SecretRotationProgress is the progress of the restart of one function after a
+// secret was rotated
+type SecretRotationProgress struct {
+	Function        string `json:"function"`
+	Replicas        int32  `json:"replicas"`
+	UpdatedReplicas int32  `json:"updatedReplicas"`
+	ReadyReplicas   int32  `json:"readyReplicas"`
+	// Partition is the lowest ordinal that is restarted, it is nil once all of the
+	// Pods have been restarted
+	Partition *int32 `json:"partition,omitempty"`
+	RotatedAt string `json:"rotatedAt,omitempty"`
+	Done      bool   `json:"done"`
+}
+
+// ParseSecretRotation returns the SecretRotation recorded in the annotations of a
+// StatefulSet, it is nil when no rotation is in progress
+func ParseSecretRotation(annotations map[string]string) *SecretRotation {
+	value, ok := annotations[AnnotationSecretRotation]
+	if !ok {
+		return nil
+	}
+
+	rotation := &SecretRotation{}
+	if err := json.Unmarshal([]byte(value), rotation); err != nil {
+		return nil
+	}
+	return rotation
+}
+
+// UsesSecret returns true when the function mounts the secret or pulls its image
+// with it
+func UsesSecret(statefulset *appsv1.StatefulSet, secret string) bool {
+	for _, name := range ReadFunctionSecretsSpec(*statefulset) {
+		if name == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSecretRotationProgress reads the progress of the restart of a function from
+// its StatefulSet
+func GetSecretRotationProgress(statefulset *appsv1.StatefulSet) SecretRotationProgress {
+	rollout := GetRolloutStatus(statefulset)
+	progress := SecretRotationProgress{
+		Function:        statefulset.Name,
+		Replicas:        rollout.Replicas,
+		UpdatedReplicas: rollout.UpdatedReplicas,
+		ReadyReplicas:   rollout.ReadyReplicas,
+		RotatedAt:       statefulset.Spec.Template.Annotations[AnnotationSecretsRotatedAt],
+		Done:            true,
+	}
+
+	if rotation := ParseSecretRotation(statefulset.Annotations); rotation != nil {
+		partition := rotation.Partition
+		progress.Partition = &partition
+		progress.Done = false
+	}
+	return progress
+}
+
+// ApplySecretRotation restarts the Pods of a function with the ordinal of the
+// rotation's Partition and above, by setting rotatedAt on the Pod template. A nil
+// rotation records that the restart is complete, and partition is then the
+// partition of the function, which is left unset when it is nil. The applied
+// StatefulSet is returned.
+//
+// The annotation of the Pod template is applied each time, as the Pods would be
+// restarted again if it were removed.
+func ApplySecretRotation(ctx context.Context, client kubernetes.Interface, namespace, name, rotatedAt string, rotation *SecretRotation, partition *int32) (*appsv1.StatefulSet, error) {
+	spec := appsv1apply.StatefulSetSpec().
+		WithTemplate(corev1apply.PodTemplateSpec().
+			WithAnnotations(map[string]string{AnnotationSecretsRotatedAt: rotatedAt}))
+
+	applyConfig := appsv1apply.StatefulSet(name, namespace)
+	if rotation != nil {
+		value, err := json.Marshal(rotation)
+		if err != nil {
+			return nil, err
+		}
+		applyConfig.WithAnnotations(map[string]string{AnnotationSecretRotation: string(value)})
+		partition = &rotation.Partition
+	}
+	if partition != nil {
+		spec.WithUpdateStrategy(appsv1apply.StatefulSetUpdateStrategy().
+			WithType(appsv1.RollingUpdateStatefulSetStrategyType).
+			WithRollingUpdate(appsv1apply.RollingUpdateStatefulSetStrategy().WithPartition(*partition)))
+	}
+	applyConfig.WithSpec(spec)
+
+	return client.AppsV1().StatefulSets(namespace).
+		Apply(ctx, applyConfig, metav1.ApplyOptions{FieldManager: SecretRotationFieldManager, Force: true})
+}
+
+// StartSecretRotation restarts the Pods of a function for the rotated secret, from
+// the highest ordinal. A function at zero replicas only has its Pod template
+// updated, so that it starts with the new value. The applied StatefulSet is
+// returned.
+func StartSecretRotation(ctx context.Context, client kubernetes.Interface, statefulset *appsv1.StatefulSet, secret string, now time.Time) (*appsv1.StatefulSet, error) {
+	rotatedAt := now.UTC().Format(time.RFC3339)
+
+	replicas := int32(1)
+	if statefulset.Spec.Replicas != nil {
+		replicas = *statefulset.Spec.Replicas
+	}
+	if replicas == 0 {
+		return ApplySecretRotation(ctx, client, statefulset.Namespace, statefulset.Name, rotatedAt, nil, nil)
+	}
+
+	rotation := &SecretRotation{Secret: secret, StartedAt: now.UTC(), Partition: replicas - 1}
+	return ApplySecretRotation(ctx, client, statefulset.Namespace, statefulset.Name, rotatedAt, rotation, nil)
+}
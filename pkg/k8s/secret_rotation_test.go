@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSecretsStatefulSet(name string, secrets ...string) *appsv1.StatefulSet {
+	var sources []corev1.VolumeProjection
+	for _, secret := range secrets {
+		sources = append(sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: secret}},
+		})
+	}
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{{
+						Name:         name + "-projected-secrets",
+						VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: sources}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func Test_UsesSecret(t *testing.T) {
+	statefulset := newSecretsStatefulSet("figlet", "api-key", "db-password")
+	statefulset.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+
+	for _, secret := range []string{"api-key", "db-password", "registry"} {
+		if !UsesSecret(statefulset, secret) {
+			t.Errorf("want the function to use %s", secret)
+		}
+	}
+	if UsesSecret(statefulset, "other") {
+		t.Errorf("want the function not to use other")
+	}
+}
+
+func Test_GetSecretRotationProgress(t *testing.T) {
+	replicas := int32(3)
+	statefulset := newSecretsStatefulSet("figlet", "api-key")
+	statefulset.Spec.Replicas = &replicas
+	statefulset.Spec.Template.Annotations = map[string]string{AnnotationSecretsRotatedAt: "2026-10-15T10:00:00Z"}
+	statefulset.Annotations = map[string]string{
+		AnnotationSecretRotation: `{"secret":"api-key","startedAt":"2026-10-15T10:00:00Z","partition":1}`,
+	}
+	statefulset.Status = appsv1.StatefulSetStatus{Replicas: 3, UpdatedReplicas: 2, ReadyReplicas: 3}
+
+	progress := GetSecretRotationProgress(statefulset)
+	if progress.Done || progress.Partition == nil || *progress.Partition != 1 {
+		t.Errorf("want the rotation to be in progress at partition 1, got %+v", progress)
+	}
+	if progress.UpdatedReplicas != 2 || progress.RotatedAt != "2026-10-15T10:00:00Z" {
+		t.Errorf("want 2 updated replicas rotated at 10:00, got %+v", progress)
+	}
+
+	rotation := ParseSecretRotation(statefulset.Annotations)
+	if want := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC); rotation == nil || !rotation.StartedAt.Equal(want) {
+		t.Errorf("want the rotation to have started at %s, got %+v", want, rotation)
+	}
+
+	delete(statefulset.Annotations, AnnotationSecretRotation)
+	if progress := GetSecretRotationProgress(statefulset); !progress.Done || progress.Partition != nil {
+		t.Errorf("want the rotation to be done, got %+v", progress)
+	}
+}
@@ -6,10 +6,11 @@ package k8s
 import (
 	"context"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/openfaas/faas-netes/pkg/logging"
 	types "github.com/openfaas/faas-provider/types"
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
@@ -17,6 +18,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	typedV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelister "k8s.io/client-go/listers/core/v1"
 )
 
 const (
@@ -32,18 +34,18 @@ type SecretsClient interface {
 	// List returns a list of available function secrets.  Only the names are returned
 	// to ensure we do not accidentally read or print the sensitive values during
 	// read operations.
-	List(namespace string) (names []string, err error)
+	List(ctx context.Context, namespace string) (names []string, err error)
 	// Create adds a new secret, with the appropriate labels and structure to be
 	// used as a function secret.
-	Create(secret types.Secret) error
+	Create(ctx context.Context, secret types.Secret) error
 	// Replace updates the value of a function secret
-	Replace(secret types.Secret) error
+	Replace(ctx context.Context, secret types.Secret) error
 	// Delete removes a function secret
-	Delete(name string, namespace string) error
+	Delete(ctx context.Context, namespace string, name string) error
 	// GetSecrets queries Kubernetes for a list of secrets by name in the given k8s namespace.
 	// This should only be used if you need access to the actual secret structure/value. Specifically,
 	// inside the FunctionFactory.
-	GetSecrets(namespace string, secretNames []string) (map[string]*apiv1.Secret, error)
+	GetSecrets(ctx context.Context, namespace string, secretNames []string) (map[string]*apiv1.Secret, error)
 }
 
 // SecretInterfacer exposes the SecretInterface getter for the k8s client.
@@ -58,19 +60,55 @@ type SecretInterfacer interface {
 
 type secretClient struct {
 	kube SecretInterfacer
+	// lister is optional, when set GetSecrets reads from the informer cache
+	lister corelister.SecretLister
+	// timeout bounds each call to the API, see WithAPITimeout
+	timeout time.Duration
 }
 
-// NewSecretsClient constructs a new SecretsClient using the provided Kubernetes client.
-func NewSecretsClient(kube kubernetes.Interface) SecretsClient {
+// NewSecretsClient constructs a new SecretsClient using the provided Kubernetes client,
+// each call to the API is bounded by timeout.
+func NewSecretsClient(kube kubernetes.Interface, timeout time.Duration) SecretsClient {
 	return &secretClient{
-		kube: kube.CoreV1(),
+		kube:    kube.CoreV1(),
+		timeout: timeout,
 	}
 }
 
-func (c secretClient) List(namespace string) (names []string, err error) {
-	res, err := c.kube.Secrets(namespace).List(context.TODO(), c.selector())
+// NewCachedSecretsClient constructs a SecretsClient that looks up secrets for functions
+// in the lister of a Secret informer, secrets missing from the cache are read from the
+// API, for instance secrets that were created without the OpenFaaS label.
+func NewCachedSecretsClient(kube kubernetes.Interface, lister corelister.SecretLister, timeout time.Duration) SecretsClient {
+	return &secretClient{
+		kube:    kube.CoreV1(),
+		lister:  lister,
+		timeout: timeout,
+	}
+}
+
+// NewSecretsClient returns a SecretsClient that uses the SecretLister of the factory
+// when it has been set
+func (f FunctionFactory) NewSecretsClient() SecretsClient {
+	if f.SecretLister != nil {
+		return NewCachedSecretsClient(f.Client, f.SecretLister, f.Config.APITimeout)
+	}
+	return NewSecretsClient(f.Client, f.Config.APITimeout)
+}
+
+// FilterManagedSecrets restricts a list or watch to the secrets that are managed by
+// OpenFaaS, it is used with informers.WithTweakListOptions for the Secret informer
+func FilterManagedSecrets(options *metav1.ListOptions) {
+	PaginateInformerList(options)
+	options.LabelSelector = fmt.Sprintf("%s=%s", secretLabel, secretLabelValue)
+}
+
+func (c secretClient) List(ctx context.Context, namespace string) (names []string, err error) {
+	ctx, cancel := WithAPITimeout(ctx, c.timeout)
+	defer cancel()
+
+	res, err := c.kube.Secrets(namespace).List(ctx, c.selector())
 	if err != nil {
-		log.Printf("failed to list secrets in %s: %v\n", namespace, err)
+		logging.Default().Error(err, "Failed to list secrets", "namespace", namespace)
 		return nil, err
 	}
 
@@ -82,7 +120,7 @@ func (c secretClient) List(namespace string) (names []string, err error) {
 	return names, nil
 }
 
-func (c secretClient) Create(secret types.Secret) error {
+func (c secretClient) Create(ctx context.Context, secret types.Secret) error {
 	err := c.validateSecret(secret)
 	if err != nil {
 		return err
@@ -101,56 +139,84 @@ func (c secretClient) Create(secret types.Secret) error {
 
 	req.Data = c.getValidSecretData(secret)
 
-	_, err = c.kube.Secrets(secret.Namespace).Create(context.TODO(), req, metav1.CreateOptions{})
+	ctx, cancel := WithAPITimeout(ctx, c.timeout)
+	defer cancel()
+
+	_, err = c.kube.Secrets(secret.Namespace).Create(ctx, req, metav1.CreateOptions{})
 	if err != nil {
-		log.Printf("failed to create secret %s.%s: %v\n", secret.Name, secret.Namespace, err)
+		logging.Default().Error(err, "Failed to create secret", "secret", secret.Name, "namespace", secret.Namespace)
 		return err
 	}
 
-	log.Printf("created secret %s.%s\n", secret.Name, secret.Namespace)
+	logging.Default().Info("Created secret", "secret", secret.Name, "namespace", secret.Namespace)
 
 	return nil
 }
 
-func (c secretClient) Replace(secret types.Secret) error {
+func (c secretClient) Replace(ctx context.Context, secret types.Secret) error {
 	err := c.validateSecret(secret)
 	if err != nil {
 		return err
 	}
 
+	getCtx, cancel := WithAPITimeout(ctx, c.timeout)
+	defer cancel()
+
 	kube := c.kube.Secrets(secret.Namespace)
-	found, err := kube.Get(context.TODO(), secret.Name, metav1.GetOptions{})
+	found, err := kube.Get(getCtx, secret.Name, metav1.GetOptions{})
 	if err != nil {
-		log.Printf("can not retrieve secret for update %s.%s: %v\n", secret.Name, secret.Namespace, err)
+		logging.Default().Error(err, "Can not retrieve secret for update", "secret", secret.Name, "namespace", secret.Namespace)
 		return err
 	}
 
 	found.Data = c.getValidSecretData(secret)
 
-	_, err = kube.Update(context.TODO(), found, metav1.UpdateOptions{})
+	updateCtx, cancel := WithAPITimeout(ctx, c.timeout)
+	defer cancel()
+
+	_, err = kube.Update(updateCtx, found, metav1.UpdateOptions{})
 	if err != nil {
-		log.Printf("can not update secret %s.%s: %v\n", secret.Name, secret.Namespace, err)
+		logging.Default().Error(err, "Can not update secret", "secret", secret.Name, "namespace", secret.Namespace)
 		return err
 	}
 
 	return nil
 }
 
-func (c secretClient) Delete(namespace string, name string) error {
-	err := c.kube.Secrets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+func (c secretClient) Delete(ctx context.Context, namespace string, name string) error {
+	ctx, cancel := WithAPITimeout(ctx, c.timeout)
+	defer cancel()
+
+	err := c.kube.Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil {
-		log.Printf("can not delete %s.%s: %v\n", name, namespace, err)
+		logging.Default().Error(err, "Can not delete secret", "secret", name, "namespace", namespace)
 	}
 	return err
 }
 
-func (c secretClient) GetSecrets(namespace string, secretNames []string) (map[string]*apiv1.Secret, error) {
+func (c secretClient) GetSecrets(ctx context.Context, namespace string, secretNames []string) (map[string]*apiv1.Secret, error) {
 	kube := c.kube.Secrets(namespace)
 	opts := metav1.GetOptions{}
 
 	secrets := map[string]*apiv1.Secret{}
 	for _, secretName := range secretNames {
-		secret, err := kube.Get(context.TODO(), secretName, opts)
+		// external secrets are read by the Secrets Store CSI driver
+		if IsExternalSecret(secretName) {
+			continue
+		}
+
+		if c.lister != nil {
+			secret, err := c.lister.Secrets(namespace).Get(secretName)
+			if err == nil {
+				secrets[secretName] = secret
+				continue
+			}
+			if !IsNotFound(err) {
+				return nil, err
+			}
+		}
+
+		secret, err := c.getSecret(ctx, kube, secretName, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -160,6 +226,13 @@ func (c secretClient) GetSecrets(namespace string, secretNames []string) (map[st
 	return secrets, nil
 }
 
+func (c secretClient) getSecret(ctx context.Context, kube typedV1.SecretInterface, name string, opts metav1.GetOptions) (*apiv1.Secret, error) {
+	ctx, cancel := WithAPITimeout(ctx, c.timeout)
+	defer cancel()
+
+	return kube.Get(ctx, name, opts)
+}
+
 func (c secretClient) selector() metav1.ListOptions {
 	return metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("%s=%s", secretLabel, secretLabelValue),
@@ -196,11 +269,33 @@ func (c secretClient) getValidSecretData(secret types.Secret) map[string][]byte
 // in the kubernetes cluster.  For each requested secret, we inspect the type and add it to the
 // statefulset spec as appropriate: secrets with type `SecretTypeDockercfg/SecretTypeDockerjson`
 // are added as ImagePullSecrets all other secrets are mounted as files in the statefulsets containers.
+// External secrets from Vault are mounted with the Secrets Store CSI driver. The
+// mount path, mode and paths of the secrets are read from the SecretMounts
+// annotations of the request, and a checksum of the data of the secrets is set on
+// the Pod template so that a change of their values restarts the Pods.
 func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, statefulset *appsv1.StatefulSet, existingSecrets map[string]*apiv1.Secret) error {
+	external, err := ParseExternalSecrets(request.Secrets)
+	if err != nil {
+		return err
+	}
+
+	var annotations map[string]string
+	if request.Annotations != nil {
+		annotations = *request.Annotations
+	}
+	mounts, err := ParseSecretMounts(annotations)
+	if err != nil {
+		return err
+	}
+
 	// Add / reference pre-existing secrets within Kubernetes
 	secretVolumeProjections := []apiv1.VolumeProjection{}
 
 	for _, secretName := range request.Secrets {
+		if IsExternalSecret(secretName) {
+			continue
+		}
+
 		deployedSecret, ok := existingSecrets[secretName]
 		if !ok {
 			return fmt.Errorf("required secret '%s' was not found in the cluster", secretName)
@@ -221,7 +316,7 @@ func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, sta
 
 			projectedPaths := []apiv1.KeyToPath{}
 			for secretKey := range deployedSecret.Data {
-				projectedPaths = append(projectedPaths, apiv1.KeyToPath{Key: secretKey, Path: secretKey})
+				projectedPaths = append(projectedPaths, apiv1.KeyToPath{Key: secretKey, Path: mounts.Path(secretName, secretKey)})
 			}
 
 			projection := &apiv1.SecretProjection{Items: projectedPaths}
@@ -234,14 +329,7 @@ func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, sta
 	}
 
 	volumeName := fmt.Sprintf(secretsProjectVolumeNameTmpl, request.Service)
-	projectedSecrets := apiv1.Volume{
-		Name: volumeName,
-		VolumeSource: apiv1.VolumeSource{
-			Projected: &apiv1.ProjectedVolumeSource{
-				Sources: secretVolumeProjections,
-			},
-		},
-	}
+	projectedSecrets := mounts.ProjectedVolume(volumeName, secretVolumeProjections)
 
 	// remove the existing secrets volume, if we can find it. The update volume will be
 	// added below
@@ -257,7 +345,7 @@ func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, sta
 		mount := apiv1.VolumeMount{
 			Name:      volumeName,
 			ReadOnly:  true,
-			MountPath: secretsMountPath,
+			MountPath: mounts.MountPath,
 		}
 
 		// remove the existing secrets volume mount, if we can find it. We update it later.
@@ -271,6 +359,9 @@ func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, sta
 
 	statefulset.Spec.Template.Spec.Containers = updatedContainers
 
+	ConfigureExternalSecrets(request.Service, statefulset, external, mounts.MountPath)
+	ConfigureSecretsChecksum(statefulset, SecretsChecksum(request.Secrets, existingSecrets))
+
 	return nil
 }
 
@@ -298,6 +389,8 @@ func ReadFunctionSecretsSpec(item appsv1.StatefulSet) []string {
 		secrets = append(secrets, s.Secret.Name)
 	}
 
+	secrets = append(secrets, readExternalSecrets(item)...)
+
 	sort.Strings(secrets)
 	return secrets
 }
@@ -0,0 +1,90 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// AnnotationSecretsChecksum is set on the Pod template of a function with a checksum
+// of the data of the secrets that are mounted into it, so that its Pods are
+// restarted when the value of a secret is changed
+const AnnotationSecretsChecksum = "com.openfaas.secrets.checksum"
+
+// SecretsChecksum returns a checksum of the data of the secrets that are projected
+// into a function, it is empty when there are none. Image pull secrets and external
+// secrets are not included.
+func SecretsChecksum(secretNames []string, existingSecrets map[string]*apiv1.Secret) string {
+	names := []string{}
+	for _, name := range secretNames {
+		secret, ok := existingSecrets[name]
+		if !ok || secret.Type == apiv1.SecretTypeDockercfg || secret.Type == apiv1.SecretTypeDockerConfigJson {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		data := existingSecrets[name].Data
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeChecksumField(h, []byte(name))
+		for _, key := range keys {
+			writeChecksumField(h, []byte(key))
+			writeChecksumField(h, data[key])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeChecksumField writes the length before the value, so that two sets of fields
+// never have the same encoding
+func writeChecksumField(h hash.Hash, value []byte) {
+	fmt.Fprintf(h, "%d:", len(value))
+	h.Write(value)
+}
+
+// ConfigureSecretsChecksum sets the AnnotationSecretsChecksum on the Pod template,
+// or removes it when the function has no projected secrets
+func ConfigureSecretsChecksum(statefulset *appsv1.StatefulSet, checksum string) {
+	if _, ok := statefulset.Spec.Template.Annotations[AnnotationSecretsChecksum]; !ok && checksum == "" {
+		return
+	}
+
+	// the map of the Pod template can be shared with the StatefulSet
+	annotations := cloneStringMap(statefulset.Spec.Template.Annotations)
+	delete(annotations, AnnotationSecretsChecksum)
+	if checksum != "" {
+		annotations[AnnotationSecretsChecksum] = checksum
+	}
+	statefulset.Spec.Template.Annotations = annotations
+}
+
+// SecretsChanged returns true when the data of the projected secrets differs from
+// the AnnotationSecretsChecksum of the Pod template. A StatefulSet created before
+// the checksum was recorded is not changed, so that the Pods of every function are
+// not restarted at once after an upgrade, it gets its checksum on the next update.
+func SecretsChanged(statefulset *appsv1.StatefulSet, secretNames []string, existingSecrets map[string]*apiv1.Secret) bool {
+	previous, ok := statefulset.Spec.Template.Annotations[AnnotationSecretsChecksum]
+	if !ok {
+		return false
+	}
+	return previous != SecretsChecksum(secretNames, existingSecrets)
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func Test_SecretsChecksum(t *testing.T) {
+	secrets := map[string]*apiv1.Secret{
+		"db":   {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"user": []byte("admin"), "password": []byte("pass")}},
+		"api":  {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"token": []byte("abc")}},
+		"pull": {Type: apiv1.SecretTypeDockerConfigJson, Data: map[string][]byte{".dockerconfigjson": []byte("{}")}},
+	}
+
+	checksum := SecretsChecksum([]string{"db", "api"}, secrets)
+	if checksum == "" {
+		t.Fatalf("want a checksum for the projected secrets")
+	}
+	if got := SecretsChecksum([]string{"api", "db", "pull", "vault:secret/data/db#password"}, secrets); got != checksum {
+		t.Errorf("want the order, pull secrets and external secrets to be ignored, got %s and %s", got, checksum)
+	}
+	if got := SecretsChecksum([]string{"pull"}, secrets); got != "" {
+		t.Errorf("want no checksum without projected secrets, got %s", got)
+	}
+
+	secrets["db"].Data["password"] = []byte("rotated")
+	if got := SecretsChecksum([]string{"db", "api"}, secrets); got == checksum {
+		t.Errorf("want the checksum to change with the value of a secret")
+	}
+
+	moved := map[string]*apiv1.Secret{
+		"a": {Data: map[string][]byte{"b": []byte("c")}},
+	}
+	joined := map[string]*apiv1.Secret{
+		"a": {Data: map[string][]byte{"bc": []byte("")}},
+	}
+	if SecretsChecksum([]string{"a"}, moved) == SecretsChecksum([]string{"a"}, joined) {
+		t.Errorf("want different keys and values to have different checksums")
+	}
+}
+
+func Test_ConfigureSecrets_Checksum(t *testing.T) {
+	factory := FunctionFactory{}
+	statefulset := &appsv1.StatefulSet{}
+	statefulset.Name = "figlet"
+	statefulset.Spec.Template.Spec.Containers = []apiv1.Container{{Name: "figlet"}}
+
+	shared := map[string]string{"com.openfaas.scale.max": "5"}
+	statefulset.Annotations = shared
+	statefulset.Spec.Template.Annotations = shared
+
+	existing := map[string]*apiv1.Secret{
+		"db": {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"password": []byte("pass")}},
+	}
+	request := types.FunctionDeployment{Service: "figlet", Secrets: []string{"db"}}
+	if err := factory.ConfigureSecrets(request, statefulset, existing); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := SecretsChecksum([]string{"db"}, existing)
+	if got := statefulset.Spec.Template.Annotations[AnnotationSecretsChecksum]; got != want {
+		t.Errorf("want the checksum %s on the Pod template, got %q", want, got)
+	}
+	if _, ok := statefulset.Annotations[AnnotationSecretsChecksum]; ok {
+		t.Errorf("want the checksum only on the Pod template")
+	}
+	if SecretsChanged(statefulset, request.Secrets, existing) {
+		t.Errorf("want the secrets to be unchanged")
+	}
+
+	existing["db"] = &apiv1.Secret{Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"password": []byte("rotated")}}
+	if !SecretsChanged(statefulset, request.Secrets, existing) {
+		t.Errorf("want the secrets to be changed after their value was changed")
+	}
+
+	request.Secrets = nil
+	if err := factory.ConfigureSecrets(request, statefulset, existing); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := statefulset.Spec.Template.Annotations[AnnotationSecretsChecksum]; ok {
+		t.Errorf("want the checksum to be removed with the secrets")
+	}
+}
+
+func Test_SecretsChanged_WithoutChecksum(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{}
+	existing := map[string]*apiv1.Secret{
+		"db": {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"password": []byte("pass")}},
+	}
+
+	if SecretsChanged(statefulset, []string{"db"}, existing) {
+		t.Errorf("want a StatefulSet without a checksum to be unchanged")
+	}
+}
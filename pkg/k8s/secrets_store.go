@@ -0,0 +1,263 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ExternalSecretPrefix marks an entry in the secrets of a function as a Vault
+	// path in the form vault:PATH#KEY, the value is mounted as the file KEY
+	ExternalSecretPrefix = "vault:"
+
+	// annotationExternalSecrets keeps the external secrets of a function on its
+	// StatefulSet, so that they are returned by the function list
+	annotationExternalSecrets = "com.openfaas.secrets.external"
+
+	secretsStoreDriver         = "secrets-store.csi.k8s.io"
+	secretsStoreVolumeNameTmpl = "%s-secrets-store"
+)
+
+// SecretProviderClassResource is the SecretProviderClass of the Secrets Store CSI
+// driver, it is managed with the dynamic client so that the driver is only
+// required when a function uses external secrets
+var SecretProviderClassResource = schema.GroupVersionResource{Group: "secrets-store.csi.x-k8s.io", Version: "v1", Resource: "secretproviderclasses"}
+
+var secretKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// SecretsStoreConfig is used for the SecretProviderClass of each function
+type SecretsStoreConfig struct {
+	// VaultAddress is optional, the address configured for the Vault CSI provider
+	// is used when it is empty
+	VaultAddress string
+	// VaultRole is the Kubernetes auth role in Vault, the name of the function is
+	// used when it is empty
+	VaultRole string
+}
+
+// ExternalSecret is a key of a secret in Vault
+type ExternalSecret struct {
+	Path string
+	Key  string
+}
+
+// IsExternalSecret returns true when the secret is read from Vault rather than
+// from a Kubernetes Secret
+func IsExternalSecret(secret string) bool {
+	return strings.HasPrefix(secret, ExternalSecretPrefix)
+}
+
+// ParseExternalSecrets returns the external secrets from the secrets of a function
+func ParseExternalSecrets(secrets []string) ([]ExternalSecret, error) {
+	var external []ExternalSecret
+	keys := map[string]bool{}
+
+	for _, secret := range secrets {
+		if !IsExternalSecret(secret) {
+			continue
+		}
+
+		ref := strings.TrimPrefix(secret, ExternalSecretPrefix)
+		i := strings.LastIndex(ref, "#")
+		if i <= 0 || i == len(ref)-1 {
+			return nil, fmt.Errorf("invalid external secret %q, use %sPATH#KEY", secret, ExternalSecretPrefix)
+		}
+
+		path, key := ref[:i], ref[i+1:]
+		if !secretKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid key for external secret %q, it is used as the file name", secret)
+		}
+		if keys[key] {
+			return nil, fmt.Errorf("external secret key %q is used more than once", key)
+		}
+		keys[key] = true
+
+		external = append(external, ExternalSecret{Path: path, Key: key})
+	}
+
+	return external, nil
+}
+
+// SecretProviderClassName is the name of the SecretProviderClass of a function
+func SecretProviderClassName(functionName string) string {
+	return functionName + "-secrets"
+}
+
+// MakeSecretProviderClass creates the SecretProviderClass with the Vault objects of
+// the external secrets of a function
+func MakeSecretProviderClass(functionName, namespace string, external []ExternalSecret, config SecretsStoreConfig) (*unstructured.Unstructured, error) {
+	objects := []map[string]string{}
+	for _, secret := range external {
+		objects = append(objects, map[string]string{
+			"objectName": secret.Key,
+			"secretPath": secret.Path,
+			"secretKey":  secret.Key,
+		})
+	}
+
+	objectsYAML, err := yaml.Marshal(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	role := config.VaultRole
+	if role == "" {
+		role = functionName
+	}
+
+	parameters := map[string]interface{}{
+		"roleName": role,
+		"objects":  string(objectsYAML),
+	}
+	if config.VaultAddress != "" {
+		parameters["vaultAddress"] = config.VaultAddress
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": SecretProviderClassResource.GroupVersion().String(),
+		"kind":       "SecretProviderClass",
+		"metadata": map[string]interface{}{
+			"name":      SecretProviderClassName(functionName),
+			"namespace": namespace,
+			"labels":    map[string]interface{}{"faas_function": functionName},
+		},
+		"spec": map[string]interface{}{
+			"provider":   "vault",
+			"parameters": parameters,
+		},
+	}}, nil
+}
+
+// ConfigureExternalSecrets adds the CSI volume for the external secrets of a function.
+// The volume is mounted on mountPath, unless the function also has secrets from
+// Kubernetes, then each key is mounted as a file next to them. Values mounted as files
+// are not updated when they are rotated in Vault until the Pod is restarted.
+func ConfigureExternalSecrets(functionName string, statefulset *appsv1.StatefulSet, external []ExternalSecret, mountPath string) {
+	podSpec := &statefulset.Spec.Template.Spec
+	volumeName := fmt.Sprintf(secretsStoreVolumeNameTmpl, functionName)
+
+	podSpec.Volumes = removeVolume(volumeName, podSpec.Volumes)
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].VolumeMounts = removeVolumeMount(volumeName, podSpec.Containers[i].VolumeMounts)
+	}
+	if statefulset.Annotations != nil {
+		delete(statefulset.Annotations, annotationExternalSecrets)
+	}
+
+	if len(external) == 0 {
+		return
+	}
+
+	readOnly := true
+	podSpec.Volumes = append(podSpec.Volumes, apiv1.Volume{
+		Name: volumeName,
+		VolumeSource: apiv1.VolumeSource{
+			CSI: &apiv1.CSIVolumeSource{
+				Driver:           secretsStoreDriver,
+				ReadOnly:         &readOnly,
+				VolumeAttributes: map[string]string{"secretProviderClass": SecretProviderClassName(functionName)},
+			},
+		},
+	})
+
+	projectedVolumeName := fmt.Sprintf(secretsProjectVolumeNameTmpl, functionName)
+	for i, container := range podSpec.Containers {
+		mixed := false
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == projectedVolumeName {
+				mixed = true
+			}
+		}
+
+		if !mixed {
+			container.VolumeMounts = append(container.VolumeMounts, apiv1.VolumeMount{
+				Name:      volumeName,
+				ReadOnly:  true,
+				MountPath: mountPath,
+			})
+		} else {
+			for _, secret := range external {
+				container.VolumeMounts = append(container.VolumeMounts, apiv1.VolumeMount{
+					Name:      volumeName,
+					ReadOnly:  true,
+					MountPath: mountPath + "/" + secret.Key,
+					SubPath:   secret.Key,
+				})
+			}
+		}
+		podSpec.Containers[i] = container
+	}
+
+	refs := make([]string, 0, len(external))
+	for _, secret := range external {
+		refs = append(refs, ExternalSecretPrefix+secret.Path+"#"+secret.Key)
+	}
+	if statefulset.Annotations == nil {
+		statefulset.Annotations = map[string]string{}
+	}
+	statefulset.Annotations[annotationExternalSecrets] = strings.Join(refs, ",")
+}
+
+// readExternalSecrets is the inverse of ConfigureExternalSecrets
+func readExternalSecrets(statefulset appsv1.StatefulSet) []string {
+	value := statefulset.Annotations[annotationExternalSecrets]
+	if value == "" {
+		return nil
+	}
+
+	refs := strings.Split(value, ",")
+	sort.Strings(refs)
+	return refs
+}
+
+// SyncSecretProviderClass applies the SecretProviderClass for the external secrets of
+// a function, or removes it when the function has none. The labels are added to the
+// SecretProviderClass.
+func SyncSecretProviderClass(ctx context.Context, client dynamic.Interface, functionName, namespace string, secrets []string, config SecretsStoreConfig, owner metav1.OwnerReference, labels map[string]string) error {
+	external, err := ParseExternalSecrets(secrets)
+	if err != nil {
+		return err
+	}
+
+	if client == nil {
+		if len(external) > 0 {
+			return fmt.Errorf("external secrets are not supported without a dynamic client")
+		}
+		return nil
+	}
+
+	classes := client.Resource(SecretProviderClassResource).Namespace(namespace)
+
+	if len(external) == 0 {
+		err := classes.Delete(ctx, SecretProviderClassName(functionName), metav1.DeleteOptions{})
+		if err != nil && !IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return err
+		}
+		return nil
+	}
+
+	class, err := MakeSecretProviderClass(functionName, namespace, external, config)
+	if err != nil {
+		return err
+	}
+	class.SetOwnerReferences([]metav1.OwnerReference{owner})
+	AddLabels(class, labels)
+
+	_, err = classes.Apply(ctx, class.GetName(), class, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
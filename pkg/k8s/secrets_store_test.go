@@ -0,0 +1,126 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_ParseExternalSecrets(t *testing.T) {
+	external, err := ParseExternalSecrets([]string{"db", "vault:secret/data/db#password", "vault:kv/api#token"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []ExternalSecret{{Path: "secret/data/db", Key: "password"}, {Path: "kv/api", Key: "token"}}
+	if len(external) != len(want) {
+		t.Fatalf("want %v, got %v", want, external)
+	}
+	for i := range want {
+		if external[i] != want[i] {
+			t.Errorf("want %v, got %v", want[i], external[i])
+		}
+	}
+}
+
+func Test_ParseExternalSecrets_Invalid(t *testing.T) {
+	cases := map[string][]string{
+		"missing key":   {"vault:secret/data/db"},
+		"empty key":     {"vault:secret/data/db#"},
+		"invalid key":   {"vault:secret/data/db#../password"},
+		"duplicate key": {"vault:secret/data/db#password", "vault:secret/data/api#password"},
+	}
+
+	for name, secrets := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseExternalSecrets(secrets); err == nil {
+				t.Errorf("want an error for %v", secrets)
+			}
+		})
+	}
+}
+
+func Test_MakeSecretProviderClass(t *testing.T) {
+	class, err := MakeSecretProviderClass("figlet", "openfaas-fn",
+		[]ExternalSecret{{Path: "secret/data/db", Key: "password"}}, SecretsStoreConfig{VaultAddress: "http://vault:8200"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if class.GetName() != "figlet-secrets" {
+		t.Errorf("want the name figlet-secrets, got %s", class.GetName())
+	}
+
+	parameters, _, _ := unstructured.NestedStringMap(class.Object, "spec", "parameters")
+	if parameters["roleName"] != "figlet" {
+		t.Errorf("want the function's name as the role, got %q", parameters["roleName"])
+	}
+	if parameters["vaultAddress"] != "http://vault:8200" {
+		t.Errorf("want the vault address, got %q", parameters["vaultAddress"])
+	}
+	for _, want := range []string{"objectName: password", "secretPath: secret/data/db", "secretKey: password"} {
+		if !strings.Contains(parameters["objects"], want) {
+			t.Errorf("want %q in the objects, got %q", want, parameters["objects"])
+		}
+	}
+}
+
+func Test_ConfigureSecrets_ExternalSecretsOnly(t *testing.T) {
+	factory := FunctionFactory{}
+	statefulset := &appsv1.StatefulSet{}
+	statefulset.Spec.Template.Spec.Containers = []apiv1.Container{{Name: "figlet"}}
+
+	request := types.FunctionDeployment{Service: "figlet", Secrets: []string{"vault:secret/data/db#password"}}
+	if err := factory.ConfigureSecrets(request, statefulset, map[string]*apiv1.Secret{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	volumes := statefulset.Spec.Template.Spec.Volumes
+	if len(volumes) != 1 || volumes[0].CSI == nil || volumes[0].CSI.VolumeAttributes["secretProviderClass"] != "figlet-secrets" {
+		t.Fatalf("want only the CSI volume, got %v", volumes)
+	}
+
+	mounts := statefulset.Spec.Template.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].MountPath != secretsMountPath || mounts[0].SubPath != "" {
+		t.Errorf("want the CSI volume on the secrets path, got %v", mounts)
+	}
+
+	if got := ReadFunctionSecretsSpec(*statefulset); len(got) != 1 || got[0] != "vault:secret/data/db#password" {
+		t.Errorf("want the external secret to be read back, got %v", got)
+	}
+}
+
+func Test_ConfigureSecrets_MixedSecrets(t *testing.T) {
+	factory := FunctionFactory{}
+	statefulset := &appsv1.StatefulSet{}
+	statefulset.Name = "figlet"
+	statefulset.Spec.Template.Spec.Containers = []apiv1.Container{{Name: "figlet"}}
+
+	existing := map[string]*apiv1.Secret{
+		"db": {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"db": []byte("user")}},
+	}
+	request := types.FunctionDeployment{Service: "figlet", Secrets: []string{"db", "vault:secret/data/db#password"}}
+	if err := factory.ConfigureSecrets(request, statefulset, existing); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	mounts := statefulset.Spec.Template.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 2 {
+		t.Fatalf("want the projected and the CSI mounts, got %v", mounts)
+	}
+	if mounts[1].MountPath != secretsMountPath+"/password" || mounts[1].SubPath != "password" {
+		t.Errorf("want the external secret mounted as a file next to the others, got %v", mounts[1])
+	}
+
+	got := ReadFunctionSecretsSpec(*statefulset)
+	if len(got) != 2 || got[0] != "db" || got[1] != "vault:secret/data/db#password" {
+		t.Errorf("want both secrets to be read back, got %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_CachedSecretsClient_GetSecrets(t *testing.T) {
+	managed := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-key",
+			Namespace: "openfaas-fn",
+			Labels:    map[string]string{secretLabel: secretLabelValue},
+		},
+	}
+	unmanaged := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "openfaas-fn"},
+	}
+
+	kube := fake.NewSimpleClientset(unmanaged)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(managed)
+
+	client := NewCachedSecretsClient(kube, corelister.NewSecretLister(indexer), DefaultAPITimeout)
+
+	secrets, err := client.GetSecrets(context.Background(), "openfaas-fn", []string{"api-key"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if secrets["api-key"] != managed {
+		t.Fatalf("expected the secret from the cache")
+	}
+	if len(kube.Actions()) != 0 {
+		t.Fatalf("expected no API calls for a cached secret, got %d", len(kube.Actions()))
+	}
+
+	secrets, err = client.GetSecrets(context.Background(), "openfaas-fn", []string{"api-key", "registry"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if secrets["registry"] == nil {
+		t.Fatalf("expected a secret missing from the cache to be read from the API")
+	}
+
+	if _, err := client.GetSecrets(context.Background(), "openfaas-fn", []string{"missing"}); !IsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func Test_FilterManagedSecrets(t *testing.T) {
+	options := metav1.ListOptions{}
+	FilterManagedSecrets(&options)
+
+	want := "app.kubernetes.io/managed-by=openfaas"
+	if options.LabelSelector != want {
+		t.Fatalf("expected selector %q, got %q", want, options.LabelSelector)
+	}
+}
@@ -4,6 +4,10 @@
 package k8s
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+
 	types "github.com/openfaas/faas-provider/types"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -13,14 +17,85 @@ import (
 // value >10000 per the suggestion from https://kubesec.io/basics/containers-securitycontext-runasuser/
 const SecurityContextUserID = int64(12000)
 
-// ConfigureContainerUserID sets the UID to 12000 for the function Container.  Defaults to user
-// specified in image metadata if `SetNonRootUser` is `false`. Root == 0.
+const (
+	// AnnotationRunAsUser sets the UID of the function container
+	AnnotationRunAsUser = "com.openfaas.security.run-as-user"
+	// AnnotationRunAsGroup sets the GID of the function container
+	AnnotationRunAsGroup = "com.openfaas.security.run-as-group"
+
+	// NamespaceRunAsUserAnnotation on a namespace sets the UID of the functions in it
+	NamespaceRunAsUserAnnotation = "openfaas.com/run-as-user"
+	// NamespaceRunAsGroupAnnotation on a namespace sets the GID of the functions in it
+	NamespaceRunAsGroupAnnotation = "openfaas.com/run-as-group"
+)
+
+// ParseUserID parses a UID for a function, root is rejected since the UID must
+// satisfy runAsNonRoot
+func ParseUserID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id: %q", value)
+	}
+	if id <= 0 {
+		return 0, fmt.Errorf("user id must be greater than 0 to run as non-root, got: %d", id)
+	}
+	return id, nil
+}
+
+// ParseGroupID parses a GID for a function
+func ParseGroupID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid group id: %q", value)
+	}
+	if id < 0 {
+		return 0, fmt.Errorf("group id must not be negative, got: %d", id)
+	}
+	return id, nil
+}
+
+// ConfigureContainerUserID sets the UID and GID of the function Container from, in
+// order of precedence, the com.openfaas.security.run-as-user and run-as-group
+// annotations of the function, the openfaas.com/run-as-user and run-as-group
+// annotations of its namespace, then NonRootUserID and NonRootGroupID when
+// `SetNonRootUser` is `true`. Otherwise the user specified in the image metadata is
+// used. Root == 0.
 func (f *FunctionFactory) ConfigureContainerUserID(statefulset *appsv1.StatefulSet) {
-	userID := SecurityContextUserID
-	var functionUser *int64
+	var functionUser, functionGroup *int64
 
-	if f.Config.SetNonRootUser {
+	if f.Config.Current().SetNonRootUser {
+		userID := f.Config.NonRootUserID
+		if userID <= 0 {
+			userID = SecurityContextUserID
+		}
 		functionUser = &userID
+
+		if f.Config.NonRootGroupID > 0 {
+			groupID := f.Config.NonRootGroupID
+			functionGroup = &groupID
+		}
+	}
+
+	// an invalid annotation of a namespace is ignored, the annotations of functions
+	// are validated when they are deployed
+	overrides := []struct {
+		annotations map[string]string
+		user, group string
+	}{
+		{f.namespaceAnnotations(context.Background(), statefulset.Namespace), NamespaceRunAsUserAnnotation, NamespaceRunAsGroupAnnotation},
+		{statefulset.Annotations, AnnotationRunAsUser, AnnotationRunAsGroup},
+	}
+	for _, override := range overrides {
+		if value, ok := override.annotations[override.user]; ok {
+			if id, err := ParseUserID(value); err == nil {
+				functionUser = &id
+			}
+		}
+		if value, ok := override.annotations[override.group]; ok {
+			if id, err := ParseGroupID(value); err == nil {
+				functionGroup = &id
+			}
+		}
 	}
 
 	if statefulset.Spec.Template.Spec.Containers[0].SecurityContext == nil {
@@ -28,6 +103,7 @@ func (f *FunctionFactory) ConfigureContainerUserID(statefulset *appsv1.StatefulS
 	}
 
 	statefulset.Spec.Template.Spec.Containers[0].SecurityContext.RunAsUser = functionUser
+	statefulset.Spec.Template.Spec.Containers[0].SecurityContext.RunAsGroup = functionGroup
 }
 
 // ConfigureReadOnlyRootFilesystem will create or update the required settings and mounts to ensure
@@ -37,13 +113,16 @@ func (f *FunctionFactory) ConfigureContainerUserID(statefulset *appsv1.StatefulS
 // 2. when ReadOnlyRootFilesystem is false, the security context of the container will also have ReadOnlyRootFilesystem set
 //    to false and there will be no mount for the `/tmp` folder
 //
-// This method is safe for both create and update operations.
+// This method is safe for both create and update operations. When ForceReadOnlyRootFilesystem
+// is set, the root filesystem is read-only regardless of the request.
 func (f *FunctionFactory) ConfigureReadOnlyRootFilesystem(request types.FunctionDeployment, statefulset *appsv1.StatefulSet) {
+	readOnly := request.ReadOnlyRootFilesystem || f.Config.ForceReadOnlyRootFilesystem
+
 	if statefulset.Spec.Template.Spec.Containers[0].SecurityContext != nil {
-		statefulset.Spec.Template.Spec.Containers[0].SecurityContext.ReadOnlyRootFilesystem = &request.ReadOnlyRootFilesystem
+		statefulset.Spec.Template.Spec.Containers[0].SecurityContext.ReadOnlyRootFilesystem = &readOnly
 	} else {
 		statefulset.Spec.Template.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
-			ReadOnlyRootFilesystem: &request.ReadOnlyRootFilesystem,
+			ReadOnlyRootFilesystem: &readOnly,
 		}
 	}
 
@@ -53,7 +132,7 @@ func (f *FunctionFactory) ConfigureReadOnlyRootFilesystem(request types.Function
 	existingMounts := removeVolumeMount("temp", statefulset.Spec.Template.Spec.Containers[0].VolumeMounts)
 	statefulset.Spec.Template.Spec.Containers[0].VolumeMounts = existingMounts
 
-	if request.ReadOnlyRootFilesystem {
+	if readOnly {
 		statefulset.Spec.Template.Spec.Volumes = append(
 			existingVolumes,
 			corev1.Volume{
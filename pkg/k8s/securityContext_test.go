@@ -10,6 +10,8 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func readOnlyRootDisabled(t *testing.T, statefulset *appsv1.StatefulSet) {
@@ -190,3 +192,157 @@ func Test_configureReadOnlyRootFilesystem_Enabled_To_Enabled(t *testing.T) {
 	f.ConfigureReadOnlyRootFilesystem(request, statefulset)
 	readOnlyRootEnabled(t, statefulset)
 }
+
+func Test_configureReadOnlyRootFilesystem_Forced(t *testing.T) {
+	f := mockFactory()
+	f.Config.ForceReadOnlyRootFilesystem = true
+	statefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest"},
+					},
+				},
+			},
+		},
+	}
+
+	request := types.FunctionDeployment{
+		Service:                "testfunc",
+		ReadOnlyRootFilesystem: false,
+	}
+
+	f.ConfigureReadOnlyRootFilesystem(request, statefulset)
+	readOnlyRootEnabled(t, statefulset)
+}
+
+func Test_ConfigureContainerUserID(t *testing.T) {
+	namespace := &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "team-a",
+			Annotations: map[string]string{NamespaceRunAsUserAnnotation: "2000", NamespaceRunAsGroupAnnotation: "2000"},
+		},
+	}
+
+	cases := []struct {
+		name           string
+		setNonRootUser bool
+		namespace      string
+		annotations    map[string]string
+		wantUser       *int64
+		wantGroup      *int64
+	}{
+		{
+			name: "image user",
+		},
+		{
+			name:           "default non-root user",
+			setNonRootUser: true,
+			wantUser:       int64p(SecurityContextUserID),
+		},
+		{
+			name:      "namespace user and group",
+			namespace: "team-a",
+			wantUser:  int64p(2000),
+			wantGroup: int64p(2000),
+		},
+		{
+			name:           "function user overrides the namespace",
+			setNonRootUser: true,
+			namespace:      "team-a",
+			annotations:    map[string]string{AnnotationRunAsUser: "1000"},
+			wantUser:       int64p(1000),
+			wantGroup:      int64p(2000),
+		},
+		{
+			name:           "root user is ignored",
+			setNonRootUser: true,
+			annotations:    map[string]string{AnnotationRunAsUser: "0", AnnotationRunAsGroup: "3000"},
+			wantUser:       int64p(SecurityContextUserID),
+			wantGroup:      int64p(3000),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := mockFactory()
+			f.Config.SetNonRootUser = tc.setNonRootUser
+			f.NamespaceAnnotations = NewNamespaceAnnotations(fake.NewSimpleClientset(namespace))
+
+			statefulset := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tc.namespace, Annotations: tc.annotations},
+				Spec: appsv1.StatefulSetSpec{
+					Template: apiv1.PodTemplateSpec{
+						Spec: apiv1.PodSpec{
+							Containers: []apiv1.Container{{Name: "testfunc", Image: "alpine:latest"}},
+						},
+					},
+				},
+			}
+
+			f.ConfigureContainerUserID(statefulset)
+
+			sc := statefulset.Spec.Template.Spec.Containers[0].SecurityContext
+			if !equalInt64p(sc.RunAsUser, tc.wantUser) {
+				t.Errorf("want user %v, got %v", deref(tc.wantUser), deref(sc.RunAsUser))
+			}
+			if !equalInt64p(sc.RunAsGroup, tc.wantGroup) {
+				t.Errorf("want group %v, got %v", deref(tc.wantGroup), deref(sc.RunAsGroup))
+			}
+		})
+	}
+}
+
+func Test_ConfigureContainerUserID_ConfiguredIDs(t *testing.T) {
+	f := mockFactory()
+	f.Config.SetNonRootUser = true
+	f.Config.NonRootUserID = 1000
+	f.Config.NonRootGroupID = 1001
+
+	statefulset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{Name: "testfunc", Image: "alpine:latest"}},
+				},
+			},
+		},
+	}
+
+	f.ConfigureContainerUserID(statefulset)
+
+	sc := statefulset.Spec.Template.Spec.Containers[0].SecurityContext
+	if !equalInt64p(sc.RunAsUser, int64p(1000)) || !equalInt64p(sc.RunAsGroup, int64p(1001)) {
+		t.Errorf("want user 1000 and group 1001, got %v and %v", deref(sc.RunAsUser), deref(sc.RunAsGroup))
+	}
+}
+
+func Test_ParseUserID(t *testing.T) {
+	for _, value := range []string{"0", "-1", "root"} {
+		if _, err := ParseUserID(value); err == nil {
+			t.Errorf("want an error for %q", value)
+		}
+	}
+	if id, err := ParseUserID("1000"); err != nil || id != 1000 {
+		t.Errorf("want 1000, got %d, %v", id, err)
+	}
+}
+
+func int64p(i int64) *int64 {
+	return &i
+}
+
+func equalInt64p(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func deref(i *int64) interface{} {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AnnotationTokenAudience mounts a service account token for this audience
+	// into the function, so that it can authenticate to other functions or to
+	// internal APIs that validate the token with a TokenReview
+	AnnotationTokenAudience = "com.openfaas.auth.token-audience"
+	// AnnotationTokenExpiration is the lifetime of the token in seconds, the
+	// kubelet refreshes it before it expires
+	AnnotationTokenExpiration = "com.openfaas.auth.token-expiration"
+
+	// ServiceTokenVolumeName is the projected volume of the token and CA bundle
+	ServiceTokenVolumeName = "openfaas-auth"
+	// ServiceTokenMountPath is where the token and ca.crt are mounted
+	ServiceTokenMountPath = "/var/openfaas/auth"
+
+	// ServiceTokenFileEnv and ServiceTokenCAFileEnv are set to the paths of the
+	// token and of the CA bundle in the function container
+	ServiceTokenFileEnv   = "OPENFAAS_AUTH_TOKEN_FILE"
+	ServiceTokenCAFileEnv = "OPENFAAS_AUTH_CA_FILE"
+
+	// rootCAConfigMap is published in every namespace by the kube-controller-manager
+	rootCAConfigMap = "kube-root-ca.crt"
+
+	defaultTokenExpiration = int64(3600)
+	// minTokenExpiration is the shortest lifetime accepted by the API server
+	minTokenExpiration = int64(600)
+)
+
+// ParseTokenExpiration parses the lifetime of a service token in seconds
+func ParseTokenExpiration(value string) (int64, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid token expiration: %q", value)
+	}
+	if seconds < minTokenExpiration {
+		return 0, fmt.Errorf("token expiration must be at least %d seconds, got: %d", minTokenExpiration, seconds)
+	}
+	return seconds, nil
+}
+
+// ConfigureServiceToken mounts a projected service account token with the audience
+// of the com.openfaas.auth.token-audience annotation, and the CA bundle of the
+// cluster, into the function container
+func (f *FunctionFactory) ConfigureServiceToken(statefulset *appsv1.StatefulSet) {
+	audience := statefulset.Annotations[AnnotationTokenAudience]
+	spec := &statefulset.Spec.Template.Spec
+	if audience == "" || len(spec.Containers) == 0 {
+		return
+	}
+
+	// an invalid expiration is rejected when the function is deployed
+	expiration := defaultTokenExpiration
+	if value, ok := statefulset.Annotations[AnnotationTokenExpiration]; ok {
+		if seconds, err := ParseTokenExpiration(value); err == nil {
+			expiration = seconds
+		}
+	}
+
+	spec.Volumes = append(removeVolume(ServiceTokenVolumeName, spec.Volumes), corev1.Volume{
+		Name: ServiceTokenVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{
+					{
+						ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							Audience:          audience,
+							ExpirationSeconds: &expiration,
+							Path:              "token",
+						},
+					},
+					{
+						ConfigMap: &corev1.ConfigMapProjection{
+							LocalObjectReference: corev1.LocalObjectReference{Name: rootCAConfigMap},
+							Items:                []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	container := &spec.Containers[0]
+	container.VolumeMounts = append(removeVolumeMount(ServiceTokenVolumeName, container.VolumeMounts), corev1.VolumeMount{
+		Name:      ServiceTokenVolumeName,
+		MountPath: ServiceTokenMountPath,
+		ReadOnly:  true,
+	})
+	container.Env = append(removeEnvVar(ServiceTokenCAFileEnv, removeEnvVar(ServiceTokenFileEnv, container.Env)),
+		corev1.EnvVar{Name: ServiceTokenFileEnv, Value: path.Join(ServiceTokenMountPath, "token")},
+		corev1.EnvVar{Name: ServiceTokenCAFileEnv, Value: path.Join(ServiceTokenMountPath, "ca.crt")},
+	)
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newServiceTokenStatefulSet(annotations map[string]string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Annotations: annotations},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet"}},
+				},
+			},
+		},
+	}
+}
+
+func Test_ConfigureServiceToken_NoAudience(t *testing.T) {
+	factory := mockFactory()
+	statefulset := newServiceTokenStatefulSet(nil)
+
+	factory.ConfigureServiceToken(statefulset)
+
+	if len(statefulset.Spec.Template.Spec.Volumes) != 0 {
+		t.Errorf("want no volumes, got %+v", statefulset.Spec.Template.Spec.Volumes)
+	}
+	if len(statefulset.Spec.Template.Spec.Containers[0].Env) != 0 {
+		t.Errorf("want no env, got %+v", statefulset.Spec.Template.Spec.Containers[0].Env)
+	}
+}
+
+func Test_ConfigureServiceToken(t *testing.T) {
+	factory := mockFactory()
+	statefulset := newServiceTokenStatefulSet(map[string]string{
+		AnnotationTokenAudience:   "openfaas-fn",
+		AnnotationTokenExpiration: "7200",
+	})
+
+	// applying twice, as on an update, must not duplicate the volume
+	factory.ConfigureServiceToken(statefulset)
+	factory.ConfigureServiceToken(statefulset)
+
+	volumes := statefulset.Spec.Template.Spec.Volumes
+	if len(volumes) != 1 || volumes[0].Projected == nil {
+		t.Fatalf("want one projected volume, got %+v", volumes)
+	}
+	sources := volumes[0].Projected.Sources
+	if len(sources) != 2 {
+		t.Fatalf("want the token and the CA bundle, got %+v", sources)
+	}
+
+	token := sources[0].ServiceAccountToken
+	if token == nil || token.Audience != "openfaas-fn" || *token.ExpirationSeconds != 7200 {
+		t.Errorf("want a token for openfaas-fn that expires in 7200s, got %+v", token)
+	}
+	if ca := sources[1].ConfigMap; ca == nil || ca.Name != "kube-root-ca.crt" {
+		t.Errorf("want the CA bundle from kube-root-ca.crt, got %+v", ca)
+	}
+
+	container := statefulset.Spec.Template.Spec.Containers[0]
+	if len(container.VolumeMounts) != 1 || container.VolumeMounts[0].MountPath != ServiceTokenMountPath {
+		t.Errorf("want the volume mounted at %s, got %+v", ServiceTokenMountPath, container.VolumeMounts)
+	}
+
+	want := map[string]string{
+		ServiceTokenFileEnv:   "/var/openfaas/auth/token",
+		ServiceTokenCAFileEnv: "/var/openfaas/auth/ca.crt",
+	}
+	if len(container.Env) != len(want) {
+		t.Fatalf("want %d env vars, got %+v", len(want), container.Env)
+	}
+	for _, env := range container.Env {
+		if want[env.Name] != env.Value {
+			t.Errorf("want %s=%s, got %s", env.Name, want[env.Name], env.Value)
+		}
+	}
+}
+
+func Test_ParseTokenExpiration(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "3600", want: 3600},
+		{value: "600", want: 600},
+		{value: "599", wantErr: true},
+		{value: "1h", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseTokenExpiration(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: want an error", tc.value)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s: want %d, got %d (%v)", tc.value, tc.want, got, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package k8s
+
+import (
+	"path"
+
+	v1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// SPIFFEVolumeName is the name of the volume with the Workload API socket
+	SPIFFEVolumeName = "spiffe-workload-api"
+	// SPIFFEMountPath is where the Workload API socket directory is mounted in
+	// the function container
+	SPIFFEMountPath = "/spiffe-workload-api"
+	// SPIFFEEndpointSocketEnv is read by the SPIFFE client libraries, such as
+	// go-spiffe, to find the Workload API
+	SPIFFEEndpointSocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+
+	defaultSPIFFEDriver     = "csi.spiffe.io"
+	defaultSPIFFESocketName = "spire-agent.sock"
+)
+
+// spiffeVolume returns the volume with the Workload API socket, from the
+// SPIFFE CSI driver or from a directory on the node
+func spiffeVolume(spiffe *v1.SPIFFE) corev1.Volume {
+	volume := corev1.Volume{Name: SPIFFEVolumeName}
+	if spiffe.HostPath != "" {
+		hostPathType := corev1.HostPathDirectory
+		volume.HostPath = &corev1.HostPathVolumeSource{
+			Path: spiffe.HostPath,
+			Type: &hostPathType,
+		}
+		return volume
+	}
+
+	driver := spiffe.Driver
+	if driver == "" {
+		driver = defaultSPIFFEDriver
+	}
+	readOnly := true
+	volume.CSI = &corev1.CSIVolumeSource{
+		Driver:   driver,
+		ReadOnly: &readOnly,
+	}
+	return volume
+}
+
+// spiffeEndpointSocket returns the value of SPIFFE_ENDPOINT_SOCKET
+func spiffeEndpointSocket(spiffe *v1.SPIFFE) string {
+	socketName := spiffe.SocketName
+	if socketName == "" {
+		socketName = defaultSPIFFESocketName
+	}
+	return "unix://" + path.Join(SPIFFEMountPath, socketName)
+}
+
+// applySPIFFE mounts the Workload API socket into the first container and adds
+// the labels and annotations that are used to register the function's Pods
+func applySPIFFE(spiffe *v1.SPIFFE, statefulset *appsv1.StatefulSet) {
+	template := &statefulset.Spec.Template
+
+	// the template labels may be shared with the selector, so they are copied
+	// before being changed
+	if len(spiffe.Labels) > 0 {
+		labels := cloneStringMap(template.Labels)
+		for k, v := range spiffe.Labels {
+			labels[k] = v
+		}
+		template.Labels = labels
+	}
+
+	if len(spiffe.Annotations) > 0 {
+		annotations := cloneStringMap(template.Annotations)
+		for k, v := range spiffe.Annotations {
+			annotations[k] = v
+		}
+		template.Annotations = annotations
+	}
+
+	template.Spec.Volumes = append(removeVolume(SPIFFEVolumeName, template.Spec.Volumes), spiffeVolume(spiffe))
+
+	if len(template.Spec.Containers) == 0 {
+		return
+	}
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(removeVolumeMount(SPIFFEVolumeName, container.VolumeMounts), corev1.VolumeMount{
+		Name:      SPIFFEVolumeName,
+		MountPath: SPIFFEMountPath,
+		ReadOnly:  true,
+	})
+	container.Env = append(removeEnvVar(SPIFFEEndpointSocketEnv, container.Env), corev1.EnvVar{
+		Name:  SPIFFEEndpointSocketEnv,
+		Value: spiffeEndpointSocket(spiffe),
+	})
+}
+
+// removeSPIFFE is the inverse of applySPIFFE, labels, annotations and the
+// environment variable are only removed when they still have the Profile's value
+func removeSPIFFE(spiffe *v1.SPIFFE, statefulset *appsv1.StatefulSet) {
+	template := &statefulset.Spec.Template
+
+	if len(spiffe.Labels) > 0 {
+		labels := cloneStringMap(template.Labels)
+		for k, v := range spiffe.Labels {
+			if labels[k] == v {
+				delete(labels, k)
+			}
+		}
+		template.Labels = labels
+	}
+
+	if len(spiffe.Annotations) > 0 {
+		annotations := cloneStringMap(template.Annotations)
+		for k, v := range spiffe.Annotations {
+			if annotations[k] == v {
+				delete(annotations, k)
+			}
+		}
+		template.Annotations = annotations
+	}
+
+	template.Spec.Volumes = removeVolume(SPIFFEVolumeName, template.Spec.Volumes)
+
+	if len(template.Spec.Containers) == 0 {
+		return
+	}
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = removeVolumeMount(SPIFFEVolumeName, container.VolumeMounts)
+	for _, env := range container.Env {
+		if env.Name == SPIFFEEndpointSocketEnv && env.Value == spiffeEndpointSocket(spiffe) {
+			container.Env = removeEnvVar(SPIFFEEndpointSocketEnv, container.Env)
+			break
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+// TemplateHashLabel is set on the Pod template of a function to a hash of its
+// content, so that an update with the same spec leaves the Pods running. An image
+// with a mutable tag is only pulled again when the Pods are replaced, so a new
+// build should be deployed with a new tag or digest.
+const TemplateHashLabel = "com.openfaas.template-hash"
+
+// SetTemplateHash sets the TemplateHashLabel of the Pod template to a hash of the
+// rest of the template
+func SetTemplateHash(template *corev1.PodTemplateSpec) error {
+	hash, err := TemplateHash(template)
+	if err != nil {
+		return err
+	}
+
+	labels := make(map[string]string, len(template.Labels)+1)
+	for k, v := range template.Labels {
+		labels[k] = v
+	}
+	labels[TemplateHashLabel] = hash
+	template.Labels = labels
+	return nil
+}
+
+// TemplateHash returns a hash of the Pod template that only changes with its
+// content, the TemplateHashLabel is left out
+func TemplateHash(template *corev1.PodTemplateSpec) (string, error) {
+	t := template.DeepCopy()
+	delete(t.Labels, TemplateHashLabel)
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash the pod template: %w", err)
+	}
+
+	h := fnv.New32a()
+	h.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(h.Sum32())), nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_SetTemplateHash(t *testing.T) {
+	newTemplate := func(image string) *corev1.PodTemplateSpec {
+		return &corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"faas_function": "figlet"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "figlet", Image: image}},
+			},
+		}
+	}
+
+	first := newTemplate("ghcr.io/openfaas/figlet:0.2.0")
+	if err := SetTemplateHash(first); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	hash := first.Labels[TemplateHashLabel]
+	if hash == "" {
+		t.Fatalf("want the %s label to be set", TemplateHashLabel)
+	}
+
+	// hashing a template again, with the label already set, gives the same value
+	if err := SetTemplateHash(first); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := first.Labels[TemplateHashLabel]; got != hash {
+		t.Errorf("want the hash to be stable, got %s then %s", hash, got)
+	}
+
+	same := newTemplate("ghcr.io/openfaas/figlet:0.2.0")
+	SetTemplateHash(same)
+	if got := same.Labels[TemplateHashLabel]; got != hash {
+		t.Errorf("want the same hash for the same template, got %s and %s", hash, got)
+	}
+
+	changed := newTemplate("ghcr.io/openfaas/figlet:0.2.1")
+	SetTemplateHash(changed)
+	if got := changed.Labels[TemplateHashLabel]; got == hash {
+		t.Errorf("want a new hash when the image changes, got %s for both", got)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultAPITimeout bounds each call to the Kubernetes API that is made for a
+// request to the provider, so that a hung API server does not hold requests and
+// their goroutines open until the client gives up
+const DefaultAPITimeout = 10 * time.Second
+
+// WithAPITimeout returns the context for one call to the Kubernetes API, it is
+// cancelled with ctx or after timeout, whichever comes first. Only ctx applies
+// when timeout is zero.
+func WithAPITimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// WithAPITimeout bounds one call to the Kubernetes API with the APITimeout of the
+// DeploymentConfig
+func (f FunctionFactory) WithAPITimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return WithAPITimeout(ctx, f.Config.APITimeout)
+}
+
+// namespaceAnnotations reads the annotations of a namespace within the APITimeout,
+// they are cached by NamespaceAnnotations so most calls do not reach the API
+func (f *FunctionFactory) namespaceAnnotations(ctx context.Context, namespace string) map[string]string {
+	ctx, cancel := f.WithAPITimeout(ctx)
+	defer cancel()
+	return f.NamespaceAnnotations.Get(ctx, namespace)
+}
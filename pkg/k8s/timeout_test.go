@@ -0,0 +1,71 @@
+// Copyright 2020 OpenFaaS Authors
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	typedV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+func Test_WithAPITimeout(t *testing.T) {
+	ctx, cancel := WithAPITimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("want no deadline without a timeout")
+	}
+
+	ctx, cancel = WithAPITimeout(context.Background(), time.Second)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Errorf("want a deadline within a second, got %v", deadline)
+	}
+}
+
+// hungSecrets blocks each Get until its context is done, like an API server that
+// does not respond
+type hungSecrets struct {
+	typedV1.SecretInterface
+}
+
+func (h hungSecrets) Get(ctx context.Context, name string, opts metav1.GetOptions) (*apiv1.Secret, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type hungSecretInterfacer struct{}
+
+func (hungSecretInterfacer) Secrets(namespace string) typedV1.SecretInterface {
+	return hungSecrets{fake.NewSimpleClientset().CoreV1().Secrets(namespace)}
+}
+
+func Test_secretClient_GetSecrets_Timeout(t *testing.T) {
+	client := secretClient{kube: hungSecretInterfacer{}, timeout: time.Millisecond * 50}
+
+	start := time.Now()
+	_, err := client.GetSecrets(context.Background(), "openfaas-fn", []string{"api-key"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want the call to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want the call to return after the timeout, took %s", elapsed)
+	}
+}
+
+func Test_secretClient_GetSecrets_Cancelled(t *testing.T) {
+	client := secretClient{kube: hungSecretInterfacer{}, timeout: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.GetSecrets(ctx, "openfaas-fn", []string{"api-key"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want the call to end with the request, got %v", err)
+	}
+}
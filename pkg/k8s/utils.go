@@ -42,3 +42,31 @@ func removeVolumeMount(volumeName string, mounts []corev1.VolumeMount) []corev1.
 
 	return newMounts
 }
+
+// removeEnvVar returns an EnvVar slice with any variables matching name removed
+// Uses the filter without allocation technique
+// https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+func removeEnvVar(name string, env []corev1.EnvVar) []corev1.EnvVar {
+	if env == nil {
+		return []corev1.EnvVar{}
+	}
+
+	newEnv := env[:0]
+	for _, v := range env {
+		if v.Name != name {
+			newEnv = append(newEnv, v)
+		}
+	}
+
+	return newEnv
+}
+
+// cloneStringMap returns a copy of m that can be changed without changing m,
+// the copy is never nil
+func cloneStringMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
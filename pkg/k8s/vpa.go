@@ -0,0 +1,136 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// VPAResource is the VerticalPodAutoscaler, it is managed with the dynamic client
+// so that the VPA is only required when the recommendations are enabled
+var VPAResource = schema.GroupVersionResource{Group: "autoscaling.k8s.io", Version: "v1", Resource: "verticalpodautoscalers"}
+
+// ContainerRecommendation is the CPU and memory recommended by the VPA for one
+// container of a function
+type ContainerRecommendation struct {
+	Container  string            `json:"container"`
+	Target     map[string]string `json:"target,omitempty"`
+	LowerBound map[string]string `json:"lowerBound,omitempty"`
+	UpperBound map[string]string `json:"upperBound,omitempty"`
+	// Requests and Limits are the current values of the container, so that badly
+	// tuned functions can be spotted without looking up the StatefulSet
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+// MakeVPA creates a VerticalPodAutoscaler in recommendation mode for the StatefulSet
+// of a function, it is owned by the StatefulSet so that it is removed with the
+// function. The VPA never evicts or updates the Pods.
+func MakeVPA(statefulset *appsv1.StatefulSet) *unstructured.Unstructured {
+	vpa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": VPAResource.GroupVersion().String(),
+		"kind":       "VerticalPodAutoscaler",
+		"metadata": map[string]interface{}{
+			"name":      statefulset.Name,
+			"namespace": statefulset.Namespace,
+			"labels":    map[string]interface{}{"faas_function": statefulset.Name},
+		},
+		"spec": map[string]interface{}{
+			"targetRef": map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "StatefulSet",
+				"name":       statefulset.Name,
+			},
+			"updatePolicy": map[string]interface{}{
+				"updateMode": "Off",
+			},
+		},
+	}}
+
+	vpa.SetOwnerReferences([]metav1.OwnerReference{StatefulSetOwner(statefulset)})
+
+	return vpa
+}
+
+// StatefulSetOwner is used for the resources that are removed together with the
+// StatefulSet of a function
+func StatefulSetOwner(statefulset *appsv1.StatefulSet) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "apps/v1",
+		Kind:       "StatefulSet",
+		Name:       statefulset.Name,
+		UID:        statefulset.UID,
+	}
+}
+
+// ApplyVPA creates or updates the VerticalPodAutoscaler for the StatefulSet, the
+// labels are added to the ones of the VPA
+func ApplyVPA(ctx context.Context, client dynamic.Interface, statefulset *appsv1.StatefulSet, labels map[string]string) error {
+	vpa := MakeVPA(statefulset)
+	AddLabels(vpa, labels)
+
+	_, err := client.Resource(VPAResource).Namespace(statefulset.Namespace).
+		Apply(ctx, statefulset.Name, vpa, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
+
+// GetVPARecommendations reads the recommendations from the status of the function's
+// VerticalPodAutoscaler, the result is empty until the VPA has observed the Pods
+func GetVPARecommendations(ctx context.Context, client dynamic.Interface, namespace, name string) ([]ContainerRecommendation, error) {
+	vpa, err := client.Resource(VPAResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return vpaRecommendations(vpa)
+}
+
+// vpaStatus is the subset of the VPA's status that holds the recommendations
+type vpaStatus struct {
+	Recommendation *struct {
+		ContainerRecommendations []struct {
+			ContainerName string            `json:"containerName"`
+			Target        map[string]string `json:"target"`
+			LowerBound    map[string]string `json:"lowerBound"`
+			UpperBound    map[string]string `json:"upperBound"`
+		} `json:"containerRecommendations"`
+	} `json:"recommendation"`
+}
+
+func vpaRecommendations(vpa *unstructured.Unstructured) ([]ContainerRecommendation, error) {
+	recommendations := []ContainerRecommendation{}
+
+	statusObj, found, err := unstructured.NestedMap(vpa.Object, "status")
+	if err != nil || !found {
+		return recommendations, err
+	}
+
+	status := vpaStatus{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(statusObj, &status); err != nil {
+		return nil, fmt.Errorf("unable to read the status of VPA %s: %w", vpa.GetName(), err)
+	}
+
+	if status.Recommendation == nil {
+		return recommendations, nil
+	}
+
+	for _, r := range status.Recommendation.ContainerRecommendations {
+		recommendations = append(recommendations, ContainerRecommendation{
+			Container:  r.ContainerName,
+			Target:     r.Target,
+			LowerBound: r.LowerBound,
+			UpperBound: r.UpperBound,
+		})
+	}
+
+	return recommendations, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_MakeVPA_RecommendationMode(t *testing.T) {
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn", UID: "1234"},
+	}
+
+	vpa := MakeVPA(statefulset)
+
+	if mode, _, _ := unstructured.NestedString(vpa.Object, "spec", "updatePolicy", "updateMode"); mode != "Off" {
+		t.Errorf("want updateMode Off, got %q", mode)
+	}
+	if kind, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "kind"); kind != "StatefulSet" {
+		t.Errorf("want the StatefulSet as the target, got %q", kind)
+	}
+
+	owners := vpa.GetOwnerReferences()
+	if len(owners) != 1 || owners[0].UID != "1234" {
+		t.Errorf("want the VPA to be owned by the StatefulSet, got %v", owners)
+	}
+}
+
+func Test_vpaRecommendations(t *testing.T) {
+	vpa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "figlet"},
+		"status": map[string]interface{}{
+			"recommendation": map[string]interface{}{
+				"containerRecommendations": []interface{}{
+					map[string]interface{}{
+						"containerName": "figlet",
+						"target":        map[string]interface{}{"cpu": "25m", "memory": "262144k"},
+						"lowerBound":    map[string]interface{}{"cpu": "10m", "memory": "131072k"},
+						"upperBound":    map[string]interface{}{"cpu": "100m", "memory": "524288k"},
+					},
+				},
+			},
+		},
+	}}
+
+	recommendations, err := vpaRecommendations(vpa)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(recommendations) != 1 {
+		t.Fatalf("want 1 recommendation, got %d", len(recommendations))
+	}
+
+	got := recommendations[0]
+	if got.Container != "figlet" || got.Target["cpu"] != "25m" || got.UpperBound["memory"] != "524288k" {
+		t.Errorf("unexpected recommendation: %+v", got)
+	}
+}
+
+func Test_vpaRecommendations_NoStatus(t *testing.T) {
+	vpa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "figlet"},
+	}}
+
+	recommendations, err := vpaRecommendations(vpa)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(recommendations) != 0 {
+		t.Errorf("want no recommendations before the VPA has observed the Pods, got %v", recommendations)
+	}
+}
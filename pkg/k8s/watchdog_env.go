@@ -0,0 +1,69 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// AnnotationProcessEnv records the name of the environment variable with the
+// process of the function, when it is not EnvProcessName, so that the process
+// can be read back after the provider is configured with another name
+const AnnotationProcessEnv = "com.openfaas.function.process-env"
+
+// WatchdogEnv are the names of the environment variables that the provider sets
+// for the watchdog of each function, they can be changed for a watchdog or a
+// runtime that reads other names. An empty name is the name of the OpenFaaS
+// watchdog.
+type WatchdogEnv struct {
+	// Process is the command of the function, fprocess by default
+	Process string
+	// ReadTimeout, WriteTimeout and ExecTimeout are set from the AnnotationTimeout,
+	// read_timeout, write_timeout and exec_timeout by default
+	ReadTimeout  string
+	WriteTimeout string
+	ExecTimeout  string
+}
+
+// ProcessName returns the name of the environment variable with the process of
+// the function
+func (e WatchdogEnv) ProcessName() string {
+	return orDefault(e.Process, EnvProcessName)
+}
+
+// timeouts returns the names of the environment variables that bound an
+// invocation
+func (e WatchdogEnv) timeouts() []string {
+	return []string{
+		orDefault(e.ReadTimeout, "read_timeout"),
+		orDefault(e.WriteTimeout, "write_timeout"),
+		orDefault(e.ExecTimeout, "exec_timeout"),
+	}
+}
+
+// RecordProcessEnv records the name of the process environment variable on the
+// StatefulSet of a function when it is not the default
+func (e WatchdogEnv) RecordProcessEnv(statefulset *appsv1.StatefulSet) {
+	name := e.ProcessName()
+	if name == EnvProcessName {
+		return
+	}
+
+	recorded := cloneStringMap(statefulset.Annotations)
+	recorded[AnnotationProcessEnv] = name
+	statefulset.Annotations = recorded
+}
+
+// ProcessEnvName returns the name of the environment variable with the process of
+// the function that was recorded on its StatefulSet, or EnvProcessName
+func ProcessEnvName(statefulset *appsv1.StatefulSet) string {
+	return orDefault(statefulset.Annotations[AnnotationProcessEnv], EnvProcessName)
+}
+
+func orDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
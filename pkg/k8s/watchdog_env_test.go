@@ -0,0 +1,84 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package k8s
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newProcessStatefulSet(env ...corev1.EnvVar) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Annotations: map[string]string{"topic": "cron"}},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet", Env: env}},
+				},
+			},
+		},
+	}
+}
+
+func Test_WatchdogEnv_RecordProcessEnv(t *testing.T) {
+	statefulset := newProcessStatefulSet(corev1.EnvVar{Name: "fprocess", Value: "figlet"})
+	WatchdogEnv{}.RecordProcessEnv(statefulset)
+
+	if _, ok := statefulset.Annotations[AnnotationProcessEnv]; ok {
+		t.Errorf("want the default process env not to be recorded")
+	}
+	if got := AsFunctionStatus(*statefulset).EnvProcess; got != "figlet" {
+		t.Errorf("want process figlet, got %q", got)
+	}
+
+	statefulset = newProcessStatefulSet(corev1.EnvVar{Name: "HANDLER", Value: "figlet"}, corev1.EnvVar{Name: "fprocess", Value: "cat"})
+	annotations := statefulset.Annotations
+	WatchdogEnv{Process: "HANDLER"}.RecordProcessEnv(statefulset)
+
+	if got := statefulset.Annotations[AnnotationProcessEnv]; got != "HANDLER" {
+		t.Errorf("want the process env to be recorded, got %q", got)
+	}
+	if _, ok := annotations[AnnotationProcessEnv]; ok {
+		t.Errorf("want the annotations of the function not to be changed")
+	}
+
+	status := AsFunctionStatus(*statefulset)
+	if status.EnvProcess != "figlet" {
+		t.Errorf("want process figlet, got %q", status.EnvProcess)
+	}
+	if _, ok := (*status.Annotations)[AnnotationProcessEnv]; ok {
+		t.Errorf("want the recorded process env not to be returned as an annotation")
+	}
+}
+
+func Test_ConfigureTimeout_WatchdogEnv(t *testing.T) {
+	statefulset := newProcessStatefulSet()
+	statefulset.Annotations[AnnotationTimeout] = "1m"
+
+	factory := FunctionFactory{Config: DeploymentConfig{WatchdogEnv: WatchdogEnv{ExecTimeout: "HANDLER_TIMEOUT"}}}
+	factory.ConfigureTimeout(statefulset)
+
+	want := map[string]string{"read_timeout": "1m0s", "write_timeout": "1m0s", "HANDLER_TIMEOUT": "1m0s"}
+	env := statefulset.Spec.Template.Spec.Containers[0].Env
+	if len(env) != len(want) {
+		t.Fatalf("want env %v, got %v", want, env)
+	}
+	for _, e := range env {
+		if want[e.Name] != e.Value {
+			t.Errorf("want %s=%s, got %s", e.Name, want[e.Name], e.Value)
+		}
+	}
+}
+
+func Test_DeploymentConfig_HTTPPort(t *testing.T) {
+	if got := (DeploymentConfig{}).HTTPPort(); got != DefaultFunctionPort {
+		t.Errorf("want the default port %d, got %d", DefaultFunctionPort, got)
+	}
+	if got := (DeploymentConfig{RuntimeHTTPPort: 9000}).HTTPPort(); got != 9000 {
+		t.Errorf("want port 9000, got %d", got)
+	}
+}
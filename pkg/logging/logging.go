@@ -0,0 +1,192 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package logging configures the structured logger used by faas-netes.
+//
+// Each line is written as JSON or as key="value" text with a timestamp, a level and
+// a message. The handlers add the request ID, the function name and the namespace to
+// the logger of each request, so that all of the lines for one call can be found and
+// correlated in a log store such as Loki or Elasticsearch.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	klogv2 "k8s.io/klog/v2"
+)
+
+// RequestIDHeader is set by the OpenFaaS gateway for each call, a new ID is
+// generated when it is missing and returned to the caller in the same header
+const RequestIDHeader = "X-Call-Id"
+
+const (
+	// FormatJSON writes one JSON object per line
+	FormatJSON = "json"
+	// FormatText writes key="value" pairs per line
+	FormatText = "text"
+)
+
+// Config for the logger
+type Config struct {
+	// Format is either FormatJSON or FormatText
+	Format string
+
+	// Level is the verbosity, see ParseLevel
+	Level int
+
+	// SampleInitial is the number of lines with the same message that are written
+	// each second, before only every SampleThereafter-th line is written. Errors are
+	// never sampled. Zero disables sampling.
+	SampleInitial int
+
+	// SampleThereafter is the interval of the lines that are written once the
+	// SampleInitial lines have been written in the current second
+	SampleThereafter int
+}
+
+// ParseLevel converts a level name or a number into the verbosity of the logger.
+// "error" only writes errors, "info" is the default and "debug" writes all of the
+// detailed lines that were previously enabled with -v=4.
+func ParseLevel(level string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "error":
+		return -1, nil
+	case "", "info":
+		return 0, nil
+	case "debug":
+		return 4, nil
+	}
+
+	v, err := strconv.Atoi(level)
+	if err != nil {
+		return 0, fmt.Errorf("invalid log level %q, use error, info, debug or a number", level)
+	}
+	return v, nil
+}
+
+// New creates a logger that writes to w
+func New(w io.Writer, config Config) (logr.Logger, error) {
+	opts := funcr.Options{
+		LogTimestamp:    true,
+		TimestampFormat: time.RFC3339Nano,
+		Verbosity:       config.Level,
+	}
+
+	var mu sync.Mutex
+	var logger logr.Logger
+	switch config.Format {
+	case "", FormatJSON:
+		logger = funcr.NewJSON(func(obj string) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintln(w, obj)
+		}, opts)
+	case FormatText:
+		logger = funcr.New(func(prefix, args string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if prefix != "" {
+				fmt.Fprintf(w, "%s: %s\n", prefix, args)
+				return
+			}
+			fmt.Fprintln(w, args)
+		}, opts)
+	default:
+		return logr.Discard(), fmt.Errorf("invalid log format %q, use %s or %s", config.Format, FormatJSON, FormatText)
+	}
+
+	if config.SampleInitial > 0 {
+		logger = logger.WithSink(newSampler(logger.GetSink(), time.Second, config.SampleInitial, config.SampleThereafter))
+	}
+
+	return logger, nil
+}
+
+var (
+	defaultLogger     = logr.Discard()
+	defaultLoggerLock sync.RWMutex
+)
+
+// SetDefault sets the logger returned by Default and by FromContext when the
+// context has no logger, the logs of client-go are also written to it
+func SetDefault(logger logr.Logger) {
+	defaultLoggerLock.Lock()
+	defaultLogger = logger
+	defaultLoggerLock.Unlock()
+
+	klogv2.SetLogger(logger.WithName("client-go"))
+}
+
+// Default returns the logger for code that does not serve a request
+func Default() logr.Logger {
+	defaultLoggerLock.RLock()
+	defer defaultLoggerLock.RUnlock()
+	return defaultLogger
+}
+
+// FromContext returns the logger of the request, or the default logger
+func FromContext(ctx context.Context) logr.Logger {
+	if logger, err := logr.FromContext(ctx); err == nil {
+		return logger
+	}
+	return Default()
+}
+
+// NewContext returns a copy of ctx that carries logger
+func NewContext(ctx context.Context, logger logr.Logger) context.Context {
+	return logr.NewContext(ctx, logger)
+}
+
+// Middleware adds a logger with the request ID to the context of each request
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = r.Header.Get("X-Request-Id")
+		}
+		if requestID == "" {
+			requestID = newRequestID()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		logger := Default().WithValues("request_id", requestID)
+		next(w, r.WithContext(NewContext(r.Context(), logger)))
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// RedirectStdLog writes the lines of the standard library logger, which is used by
+// faas-provider, to logger
+func RedirectStdLog(logger logr.Logger) {
+	log.SetFlags(0)
+	log.SetOutput(stdWriter{logger: logger})
+}
+
+type stdWriter struct {
+	logger logr.Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_New_JSONIncludesValues(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := New(buf, Config{Format: FormatJSON})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	logger.WithValues("function", "figlet", "namespace", "openfaas-fn").Info("Statefulset created")
+
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected a JSON line, got %q: %s", buf.String(), err)
+	}
+
+	for key, want := range map[string]string{"msg": "Statefulset created", "function": "figlet", "namespace": "openfaas-fn"} {
+		if got := line[key]; got != want {
+			t.Errorf("expected %s to be %q, got %v", key, want, got)
+		}
+	}
+	if _, ok := line["ts"]; !ok {
+		t.Errorf("expected a timestamp")
+	}
+}
+
+func Test_New_InvalidFormat(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, Config{Format: "xml"}); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
+
+func Test_ParseLevel(t *testing.T) {
+	cases := map[string]int{"error": -1, "": 0, "info": 0, "DEBUG": 4, "2": 2}
+	for level, want := range cases {
+		got, err := ParseLevel(level)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", level, err)
+		}
+		if got != want {
+			t.Errorf("level %q, want %d, got %d", level, want, got)
+		}
+	}
+
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+}
+
+func Test_New_ErrorLevelOnlyWritesErrors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, _ := New(buf, Config{Format: FormatText, Level: -1})
+
+	logger.Info("skipped")
+	logger.Error(nil, "written")
+
+	if strings.Contains(buf.String(), "skipped") || !strings.Contains(buf.String(), "written") {
+		t.Fatalf("expected only the error to be written, got %q", buf.String())
+	}
+}
+
+func Test_Middleware_AddsRequestID(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, _ := New(buf, Config{Format: FormatText})
+	previous := Default()
+	SetDefault(logger)
+	defer SetDefault(previous)
+
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("handled")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/system/functions", nil)
+	r.Header.Set(RequestIDHeader, "abc123")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if got := w.Header().Get(RequestIDHeader); got != "abc123" {
+		t.Errorf("expected the request ID to be returned, got %q", got)
+	}
+	if !strings.Contains(buf.String(), `"request_id"="abc123"`) {
+		t.Errorf("expected the request ID in the log line, got %q", buf.String())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/system/functions", nil)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if got := w.Header().Get(RequestIDHeader); len(got) != 32 {
+		t.Errorf("expected a generated request ID, got %q", got)
+	}
+}
+
+func Test_sampler(t *testing.T) {
+	counts := newSampler(nil, time.Second, 2, 3).counts
+	now := time.Now()
+
+	var written int
+	for i := 0; i < 11; i++ {
+		if counts.sample("invoked", now) {
+			written++
+		}
+	}
+	// the first two, then the 5th, 8th and 11th
+	if written != 5 {
+		t.Errorf("expected 5 lines to be written, got %d", written)
+	}
+
+	if !counts.sample("invoked", now.Add(time.Second)) {
+		t.Errorf("expected the counts to be reset after the tick")
+	}
+}
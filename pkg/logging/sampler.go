@@ -0,0 +1,78 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// sampler limits the number of info lines with the same message, so that a busy
+// function does not flood the log store with one line per invocation
+type sampler struct {
+	logr.LogSink
+	counts *sampleCounts
+}
+
+// sampleCounts is shared by a sampler and the loggers derived from it with
+// WithValues and WithName
+type sampleCounts struct {
+	tick       time.Duration
+	first      int
+	thereafter int
+
+	lock   sync.Mutex
+	reset  time.Time
+	counts map[string]int
+}
+
+func newSampler(sink logr.LogSink, tick time.Duration, first, thereafter int) *sampler {
+	return &sampler{
+		LogSink: sink,
+		counts: &sampleCounts{
+			tick:       tick,
+			first:      first,
+			thereafter: thereafter,
+			counts:     map[string]int{},
+		},
+	}
+}
+
+// sample returns true when the line with msg should be written
+func (c *sampleCounts) sample(msg string, now time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if now.Sub(c.reset) >= c.tick {
+		c.reset = now
+		c.counts = map[string]int{}
+	}
+
+	c.counts[msg]++
+	n := c.counts[msg]
+	if n <= c.first {
+		return true
+	}
+	if c.thereafter <= 0 {
+		return false
+	}
+	return (n-c.first)%c.thereafter == 0
+}
+
+func (s *sampler) Info(level int, msg string, keysAndValues ...interface{}) {
+	if !s.counts.sample(msg, time.Now()) {
+		return
+	}
+	s.LogSink.Info(level, msg, keysAndValues...)
+}
+
+func (s *sampler) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &sampler{LogSink: s.LogSink.WithValues(keysAndValues...), counts: s.counts}
+}
+
+func (s *sampler) WithName(name string) logr.LogSink {
+	return &sampler{LogSink: s.LogSink.WithName(name), counts: s.counts}
+}
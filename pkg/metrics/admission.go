@@ -0,0 +1,44 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Admission holds the metrics of the priority-based admission of functions while
+// the cluster is saturated
+type Admission struct {
+	PendingPods prometheus.Gauge
+	Saturated   prometheus.Gauge
+	Preemptions *prometheus.CounterVec
+	Denied      *prometheus.CounterVec
+}
+
+// NewAdmission creates the admission metrics and registers them with reg
+func NewAdmission(reg prometheus.Registerer) *Admission {
+	m := &Admission{
+		PendingPods: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "faas_netes",
+			Name:      "admission_pending_pods",
+			Help:      "Number of Pods of functions that can not be scheduled",
+		}),
+		Saturated: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "faas_netes",
+			Name:      "admission_saturated",
+			Help:      "1 while the cluster is saturated and functions are admitted by their priority",
+		}),
+		Preemptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "faas_netes",
+			Name:      "admission_preemptions_total",
+			Help:      "Number of replicas of a function removed for functions with a higher priority",
+		}, []string{"function_name", "namespace"}),
+		Denied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "faas_netes",
+			Name:      "admission_denied_total",
+			Help:      "Number of deploys and scale-ups of a function denied while the cluster is saturated",
+		}, []string{"function_name", "namespace", "operation"}),
+	}
+
+	reg.MustRegister(m.PendingPods, m.Saturated, m.Preemptions, m.Denied)
+	return m
+}
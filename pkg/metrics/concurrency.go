@@ -0,0 +1,123 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+// MaxInflightEnv is the environment variable of the watchdog that limits the
+// number of concurrent requests handled by each replica of a function
+const MaxInflightEnv = "max_inflight"
+
+// Concurrency reports the invocations in flight for each ready replica of a
+// function, so that functions with a max_inflight limit can be scaled on
+// concurrency instead of CPU, i.e. by a HorizontalPodAutoscaler with an
+// external metric from prometheus-adapter.
+//
+// The values are computed when the metrics are collected, from the in-flight
+// gauge of the invocations and the StatefulSets of the functions.
+type Concurrency struct {
+	invocations  *Invocations
+	statefulsets appslisters.StatefulSetLister
+
+	perReplica  *prometheus.Desc
+	maxInflight *prometheus.Desc
+}
+
+// NewConcurrency creates the concurrency metrics for the functions that are
+// invoked through invocations, it must be registered to be collected
+func NewConcurrency(invocations *Invocations, statefulsets appslisters.StatefulSetLister) *Concurrency {
+	return &Concurrency{
+		invocations:  invocations,
+		statefulsets: statefulsets,
+		perReplica: prometheus.NewDesc("faas_netes_function_inflight_per_replica",
+			"Number of invocations of a function that are in progress for each of its ready replicas",
+			[]string{"function_name", "namespace"}, nil),
+		maxInflight: prometheus.NewDesc("faas_netes_function_max_inflight",
+			"Maximum number of concurrent invocations of each replica of a function, from its max_inflight environment variable",
+			[]string{"function_name", "namespace"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Concurrency) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.perReplica
+	ch <- c.maxInflight
+}
+
+// Collect implements prometheus.Collector
+func (c *Concurrency) Collect(ch chan<- prometheus.Metric) {
+	gauges := make(chan prometheus.Metric)
+	go func() {
+		c.invocations.InFlight.Collect(gauges)
+		close(gauges)
+	}()
+
+	for gauge := range gauges {
+		var m dto.Metric
+		if err := gauge.Write(&m); err != nil {
+			continue
+		}
+
+		var name, namespace string
+		for _, label := range m.GetLabel() {
+			switch label.GetName() {
+			case "function_name":
+				name = label.GetValue()
+			case "namespace":
+				namespace = label.GetValue()
+			}
+		}
+
+		// the gauge is kept for functions that have been removed
+		statefulset, err := c.statefulsets.StatefulSets(namespace).Get(name)
+		if err != nil {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.perReplica, prometheus.GaugeValue,
+			PerReplica(m.GetGauge().GetValue(), statefulset.Status.ReadyReplicas), name, namespace)
+
+		if limit, ok := MaxInflight(statefulset); ok {
+			ch <- prometheus.MustNewConstMetric(c.maxInflight, prometheus.GaugeValue, float64(limit), name, namespace)
+		}
+	}
+}
+
+// PerReplica divides the invocations in flight between the ready replicas, while
+// no replica is ready all of them are counted against one replica so that the
+// function is still scaled up
+func PerReplica(inFlight float64, readyReplicas int32) float64 {
+	if readyReplicas < 1 {
+		return inFlight
+	}
+	return inFlight / float64(readyReplicas)
+}
+
+// MaxInflight returns the max_inflight limit of the first container of the
+// function, false is returned when it is not set or is not a positive number
+func MaxInflight(statefulset *appsv1.StatefulSet) (int, bool) {
+	containers := statefulset.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return 0, false
+	}
+
+	for _, env := range containers[0].Env {
+		if env.Name != MaxInflightEnv {
+			continue
+		}
+		limit, err := strconv.Atoi(env.Value)
+		if err != nil || limit < 1 {
+			return 0, false
+		}
+		return limit, true
+	}
+	return 0, false
+}
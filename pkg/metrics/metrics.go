@@ -0,0 +1,82 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package metrics records Prometheus metrics for the invocations that are proxied
+// by faas-netes, they are served on /metrics by faas-provider.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Invocations holds the metrics for function invocations, labeled by the function
+// name and namespace, and the status code for completed invocations
+type Invocations struct {
+	Total    *prometheus.CounterVec
+	Duration *prometheus.HistogramVec
+	InFlight *prometheus.GaugeVec
+}
+
+// NewInvocations creates the invocation metrics and registers them with reg
+func NewInvocations(reg prometheus.Registerer) *Invocations {
+	m := &Invocations{
+		Total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "faas_netes",
+			Name:      "function_invocation_total",
+			Help:      "Number of invocations proxied to a function",
+		}, []string{"function_name", "namespace", "code"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "faas_netes",
+			Name:      "function_invocation_duration_seconds",
+			Help:      "Duration of invocations proxied to a function",
+			Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"function_name", "namespace", "code"}),
+		InFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "faas_netes",
+			Name:      "function_invocation_inflight",
+			Help:      "Number of invocations of a function that are in progress",
+		}, []string{"function_name", "namespace"}),
+	}
+
+	reg.MustRegister(m.Total, m.Duration, m.InFlight)
+	return m
+}
+
+// Instrument records the metrics for each invocation handled by next, the name of
+// the function is read from the "name" path variable and may be suffixed with its
+// namespace, otherwise defaultNamespace is used
+func (m *Invocations) Instrument(defaultNamespace string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, namespace := FunctionName(mux.Vars(r)["name"], defaultNamespace)
+		if name == "" {
+			next(w, r)
+			return
+		}
+
+		inFlight := m.InFlight.WithLabelValues(name, namespace)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		// the wrapped writer keeps the optional interfaces of w, such as http.Flusher
+		// which is needed to stream responses
+		snoop := httpsnoop.CaptureMetrics(next, w, r)
+
+		code := strconv.Itoa(snoop.Code)
+		m.Total.WithLabelValues(name, namespace, code).Inc()
+		m.Duration.WithLabelValues(name, namespace, code).Observe(snoop.Duration.Seconds())
+	}
+}
+
+// FunctionName splits a function name in the form name.namespace
+func FunctionName(name, defaultNamespace string) (string, string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, defaultNamespace
+}
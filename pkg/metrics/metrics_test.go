@@ -0,0 +1,122 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_Instrument_RecordsInvocations(t *testing.T) {
+	m := NewInvocations(prometheus.NewRegistry())
+
+	var inFlight float64
+	router := mux.NewRouter()
+	router.HandleFunc("/function/{name}", m.Instrument("openfaas-fn", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["name"] == "figlet" {
+			inFlight = testutil.ToFloat64(m.InFlight.WithLabelValues("figlet", "openfaas-fn"))
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for i := 0; i < 2; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/function/figlet", nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/function/figlet.staging", nil))
+
+	if got := testutil.ToFloat64(m.Total.WithLabelValues("figlet", "openfaas-fn", "201")); got != 2 {
+		t.Errorf("expected 2 invocations in openfaas-fn, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.Total.WithLabelValues("figlet", "staging", "201")); got != 1 {
+		t.Errorf("expected 1 invocation in staging, got %v", got)
+	}
+	if inFlight != 1 {
+		t.Errorf("expected 1 invocation in flight during the request, got %v", inFlight)
+	}
+	if got := testutil.ToFloat64(m.InFlight.WithLabelValues("figlet", "openfaas-fn")); got != 0 {
+		t.Errorf("expected no invocations in flight after the request, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.Duration); got != 2 {
+		t.Errorf("expected a histogram per function and code, got %d", got)
+	}
+}
+
+func Test_FunctionName(t *testing.T) {
+	name, namespace := FunctionName("figlet.staging", "openfaas-fn")
+	if name != "figlet" || namespace != "staging" {
+		t.Errorf("want figlet staging, got %s %s", name, namespace)
+	}
+
+	name, namespace = FunctionName("figlet", "openfaas-fn")
+	if name != "figlet" || namespace != "openfaas-fn" {
+		t.Errorf("want figlet openfaas-fn, got %s %s", name, namespace)
+	}
+}
+
+func Test_Concurrency_PerReplica(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewInvocations(reg)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "figlet",
+						Env:  []corev1.EnvVar{{Name: MaxInflightEnv, Value: "5"}},
+					}},
+				},
+			},
+		},
+		Status: appsv1.StatefulSetStatus{ReadyReplicas: 2},
+	})
+	reg.MustRegister(NewConcurrency(m, appslisters.NewStatefulSetLister(indexer)))
+
+	m.InFlight.WithLabelValues("figlet", "openfaas-fn").Add(6)
+	m.InFlight.WithLabelValues("removed", "openfaas-fn").Add(1)
+
+	expected := `
+# HELP faas_netes_function_inflight_per_replica Number of invocations of a function that are in progress for each of its ready replicas
+# TYPE faas_netes_function_inflight_per_replica gauge
+faas_netes_function_inflight_per_replica{function_name="figlet",namespace="openfaas-fn"} 3
+# HELP faas_netes_function_max_inflight Maximum number of concurrent invocations of each replica of a function, from its max_inflight environment variable
+# TYPE faas_netes_function_max_inflight gauge
+faas_netes_function_max_inflight{function_name="figlet",namespace="openfaas-fn"} 5
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"faas_netes_function_inflight_per_replica", "faas_netes_function_max_inflight"); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_PerReplica(t *testing.T) {
+	cases := []struct {
+		inFlight float64
+		ready    int32
+		want     float64
+	}{
+		{inFlight: 10, ready: 4, want: 2.5},
+		{inFlight: 3, ready: 0, want: 3},
+		{inFlight: 0, ready: 1, want: 0},
+	}
+
+	for _, c := range cases {
+		if got := PerReplica(c.inFlight, c.ready); got != c.want {
+			t.Errorf("PerReplica(%v, %d): want %v, got %v", c.inFlight, c.ready, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// FlavorDogStatsD sends the labels of a metric as DogStatsD tags
+	FlavorDogStatsD = "dogstatsd"
+	// FlavorStatsD appends the values of the labels to the name of a metric, since
+	// plain StatsD has no tags
+	FlavorStatsD = "statsd"
+
+	// maxPacketSize keeps each UDP packet below the MTU of most networks
+	maxPacketSize = 1432
+)
+
+// StatsD pushes the metrics of a Prometheus registry to a StatsD or DogStatsD agent
+// over UDP, for clusters where the metrics are not scraped by Prometheus.
+//
+// Counters and the count and sum of histograms are sent as the increase since the
+// previous push, gauges are sent as their current value.
+type StatsD struct {
+	conn     net.Conn
+	flavor   string
+	gatherer prometheus.Gatherer
+
+	// previous holds the value of each counter at the previous push
+	previous map[string]float64
+}
+
+// NewStatsD creates a StatsD pusher for the metrics of gatherer, flavor is
+// FlavorDogStatsD or FlavorStatsD
+func NewStatsD(address, flavor string, gatherer prometheus.Gatherer) (*StatsD, error) {
+	switch flavor {
+	case "":
+		flavor = FlavorDogStatsD
+	case FlavorDogStatsD, FlavorStatsD:
+	default:
+		return nil, fmt.Errorf("invalid statsd flavor %q, use %s or %s", flavor, FlavorDogStatsD, FlavorStatsD)
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to statsd at %s: %w", address, err)
+	}
+
+	return &StatsD{
+		conn:     conn,
+		flavor:   flavor,
+		gatherer: gatherer,
+		previous: map[string]float64{},
+	}, nil
+}
+
+// Run pushes the metrics every interval until ctx is cancelled
+func (s *StatsD) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer s.conn.Close()
+
+	logger := logging.Default().WithName("statsd")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Push(); err != nil {
+				logger.Error(err, "Unable to push metrics")
+			}
+		}
+	}
+}
+
+// Push gathers the metrics and sends them to the agent
+func (s *StatsD) Push() error {
+	families, err := s.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			lines = append(lines, s.lines(family.GetName(), family.GetType(), metric)...)
+		}
+	}
+
+	return s.send(lines)
+}
+
+func (s *StatsD) lines(name string, metricType dto.MetricType, metric *dto.Metric) []string {
+	labels := metric.GetLabel()
+
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		return s.counter(name, labels, metric.GetCounter().GetValue())
+	case dto.MetricType_GAUGE:
+		return []string{s.format(name, labels, metric.GetGauge().GetValue(), "g")}
+	case dto.MetricType_UNTYPED:
+		return []string{s.format(name, labels, metric.GetUntyped().GetValue(), "g")}
+	case dto.MetricType_HISTOGRAM:
+		histogram := metric.GetHistogram()
+		return append(s.counter(name+"_count", labels, float64(histogram.GetSampleCount())),
+			s.counter(name+"_sum", labels, histogram.GetSampleSum())...)
+	case dto.MetricType_SUMMARY:
+		summary := metric.GetSummary()
+		return append(s.counter(name+"_count", labels, float64(summary.GetSampleCount())),
+			s.counter(name+"_sum", labels, summary.GetSampleSum())...)
+	}
+	return nil
+}
+
+// counter returns the increase of a counter since the previous push, nothing is sent
+// when it has not changed
+func (s *StatsD) counter(name string, labels []*dto.LabelPair, value float64) []string {
+	key := name + "{" + labelKey(labels) + "}"
+	delta := value - s.previous[key]
+	s.previous[key] = value
+
+	// a counter that was reset starts again from zero
+	if delta < 0 {
+		delta = value
+	}
+	if delta == 0 {
+		return nil
+	}
+	return []string{s.format(name, labels, delta, "c")}
+}
+
+func (s *StatsD) format(name string, labels []*dto.LabelPair, value float64, metricType string) string {
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+
+	if s.flavor == FlavorStatsD {
+		parts := []string{name}
+		for _, label := range labels {
+			parts = append(parts, sanitize(label.GetValue()))
+		}
+		return strings.Join(parts, ".") + ":" + formatted + "|" + metricType
+	}
+
+	line := name + ":" + formatted + "|" + metricType
+	if len(labels) > 0 {
+		tags := make([]string, 0, len(labels))
+		for _, label := range labels {
+			tags = append(tags, label.GetName()+":"+sanitize(label.GetValue()))
+		}
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// send writes the lines in as few packets as possible
+func (s *StatsD) send(lines []string) error {
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := s.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > maxPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	return flush()
+}
+
+func labelKey(labels []*dto.LabelPair) string {
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, label.GetName()+"="+label.GetValue())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// sanitize replaces the characters that separate the fields of the StatsD protocol
+func sanitize(value string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", ".", "_").Replace(value)
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func listenStatsD(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readLines(t *testing.T, conn *net.UDPConn) []string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, maxPacketSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(string(buf[:n]), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func Test_StatsD_DogStatsD(t *testing.T) {
+	conn := listenStatsD(t)
+
+	reg := prometheus.NewRegistry()
+	total := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "invocations_total"}, []string{"function_name", "namespace"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{Name: "inflight"})
+	reg.MustRegister(total, inFlight)
+
+	statsd, err := NewStatsD(conn.LocalAddr().String(), FlavorDogStatsD, reg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	total.WithLabelValues("figlet", "openfaas-fn").Add(3)
+	inFlight.Set(2)
+	if err := statsd.Push(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{
+		"inflight:2|g",
+		"invocations_total:3|c|#function_name:figlet,namespace:openfaas-fn",
+	}
+	if got := readLines(t, conn); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	// only the increase since the previous push is sent for a counter
+	total.WithLabelValues("figlet", "openfaas-fn").Add(2)
+	if err := statsd.Push(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want = []string{
+		"inflight:2|g",
+		"invocations_total:2|c|#function_name:figlet,namespace:openfaas-fn",
+	}
+	if got := readLines(t, conn); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func Test_StatsD_PlainStatsDHistogram(t *testing.T) {
+	conn := listenStatsD(t)
+
+	reg := prometheus.NewRegistry()
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration_seconds"}, []string{"function_name"})
+	reg.MustRegister(duration)
+
+	statsd, err := NewStatsD(conn.LocalAddr().String(), FlavorStatsD, reg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	duration.WithLabelValues("figlet.v2").Observe(0.5)
+	duration.WithLabelValues("figlet.v2").Observe(1)
+	if err := statsd.Push(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{
+		"duration_seconds_count.figlet_v2:2|c",
+		"duration_seconds_sum.figlet_v2:1.5|c",
+	}
+	if got := readLines(t, conn); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func Test_NewStatsD_InvalidFlavor(t *testing.T) {
+	if _, err := NewStatsD("127.0.0.1:8125", "graphite", prometheus.NewRegistry()); err == nil {
+		t.Fatalf("want an error for an unknown flavor")
+	}
+}
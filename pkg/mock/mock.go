@@ -0,0 +1,101 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package mock serves the provider against in-memory fake clientsets, so that the
+// provider API can be used by integration tests without a cluster. There is no
+// kubelet, so the functions have no Pods and can not be invoked.
+package mock
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
+	faasfake "github.com/openfaas/faas-netes/pkg/client/clientset/versioned/fake"
+	"github.com/openfaas/faas-netes/pkg/logging"
+)
+
+// NewClients returns fake clientsets with the namespaces, which are labelled so
+// that functions can be deployed to them
+func NewClients(namespaces ...string) (kubernetes.Interface, clientset.Interface, dynamic.Interface) {
+	objects := []runtime.Object{}
+	seen := map[string]bool{}
+	for _, name := range namespaces {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		objects = append(objects, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      map[string]string{"openfaas": "true"},
+				Annotations: map[string]string{"openfaas": "1"},
+			},
+		})
+	}
+
+	return fake.NewSimpleClientset(objects...), faasfake.NewSimpleClientset(), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+}
+
+// RunStatusUpdater reports each StatefulSet in the namespace as rolled out with
+// all of its replicas ready, in place of the StatefulSet controller, until ctx is
+// cancelled
+func RunStatusUpdater(ctx context.Context, client kubernetes.Interface, namespace string) {
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(client, time.Minute, kubeinformers.WithNamespace(namespace))
+	informer := factory.Apps().V1().StatefulSets().Informer()
+
+	update := func(obj interface{}) {
+		statefulset, ok := obj.(*appsv1.StatefulSet)
+		if !ok {
+			return
+		}
+		status := RolledOut(statefulset)
+		if reflect.DeepEqual(status, statefulset.Status) {
+			return
+		}
+
+		rolledOut := statefulset.DeepCopy()
+		rolledOut.Status = status
+		if _, err := client.AppsV1().StatefulSets(namespace).UpdateStatus(ctx, rolledOut, metav1.UpdateOptions{}); err != nil {
+			logging.Default().WithName("mock").Error(err, "Unable to update the StatefulSet status", "function", statefulset.Name)
+		}
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj interface{}) { update(obj) },
+	})
+	informer.Run(ctx.Done())
+}
+
+// RolledOut returns the status of a StatefulSet whose replicas are all at its
+// latest revision and ready
+func RolledOut(statefulset *appsv1.StatefulSet) appsv1.StatefulSetStatus {
+	replicas := int32(1)
+	if statefulset.Spec.Replicas != nil {
+		replicas = *statefulset.Spec.Replicas
+	}
+
+	return appsv1.StatefulSetStatus{
+		ObservedGeneration: statefulset.Generation,
+		Replicas:           replicas,
+		ReadyReplicas:      replicas,
+		CurrentReplicas:    replicas,
+		UpdatedReplicas:    replicas,
+		AvailableReplicas:  replicas,
+		CurrentRevision:    statefulset.Name + "-mock",
+		UpdateRevision:     statefulset.Name + "-mock",
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package mock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func Test_NewClients_LabelsNamespaces(t *testing.T) {
+	kubeClient, _, _ := NewClients("openfaas-fn", "openfaas-fn", "staging-fn")
+
+	namespaces, err := kubeClient.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces.Items) != 2 {
+		t.Fatalf("want 2 namespaces, got %d", len(namespaces.Items))
+	}
+	for _, ns := range namespaces.Items {
+		if ns.Labels["openfaas"] != "true" {
+			t.Errorf("want namespace %s to be labelled for functions", ns.Name)
+		}
+	}
+}
+
+func Test_RunStatusUpdater_RollsOutStatefulSets(t *testing.T) {
+	kubeClient, _, _ := NewClients("openfaas-fn")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go RunStatusUpdater(ctx, kubeClient, "openfaas-fn")
+
+	replicas := int32(2)
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+	if _, err := kubeClient.AppsV1().StatefulSets("openfaas-fn").Create(ctx, statefulset, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollUntilContextTimeout(ctx, time.Millisecond*10, time.Second*5, true, func(ctx context.Context) (bool, error) {
+		got, err := kubeClient.AppsV1().StatefulSets("openfaas-fn").Get(ctx, "figlet", metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return got.Status.ReadyReplicas == 2 && got.Status.UpdatedReplicas == 2, nil
+	})
+	if err != nil {
+		t.Fatalf("want the StatefulSet to be rolled out: %s", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package providergrpc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/openfaas/faas-netes/pkg/providerpb"
+	"github.com/openfaas/faas-netes/pkg/rbac"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Authorizer wraps a handler so that it requires the role, it is the middleware
+// that authorizes the routes of the REST API
+type Authorizer func(rbac.Role, http.HandlerFunc) http.HandlerFunc
+
+// methodRoles are the roles of the REST routes that each method stands for
+var methodRoles = map[string]rbac.Role{
+	providerpb.Provider_List_FullMethodName:        rbac.RoleReader,
+	providerpb.Provider_Get_FullMethodName:         rbac.RoleReader,
+	providerpb.Provider_Logs_FullMethodName:        rbac.RoleReader,
+	providerpb.Provider_WatchStatus_FullMethodName: rbac.RoleReader,
+	providerpb.Provider_Deploy_FullMethodName:      rbac.RoleDeployer,
+	providerpb.Provider_Update_FullMethodName:      rbac.RoleDeployer,
+	providerpb.Provider_Scale_FullMethodName:       rbac.RoleDeployer,
+	providerpb.Provider_Delete_FullMethodName:      rbac.RoleDeployer,
+}
+
+// AuthorizeInterceptors check each call with the authorizer of the REST API, so that
+// the basic auth user or the RBAC roles apply to gRPC as well. The credentials are
+// sent as "Basic <base64>" in the authorization metadata, a method without a role
+// is refused.
+func AuthorizeInterceptors(authorize Authorizer) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	allow := func(http.ResponseWriter, *http.Request) {}
+	checks := map[rbac.Role]http.HandlerFunc{}
+	for _, role := range methodRoles {
+		if _, ok := checks[role]; !ok {
+			checks[role] = authorize(role, allow)
+		}
+	}
+
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkAuthorization(ctx, checks, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkAuthorization(ss.Context(), checks, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+
+	return unary, stream
+}
+
+func checkAuthorization(ctx context.Context, checks map[rbac.Role]http.HandlerFunc, method string) error {
+	check, ok := checks[methodRoles[method]]
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "method %s is not allowed", method)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, method, http.NoBody)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		r.Header.Set("Authorization", values[0])
+	}
+
+	w := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	check(w, r)
+	if w.status >= http.StatusMultipleChoices {
+		message := strings.TrimSpace(w.body.String())
+		if message == "" {
+			message = http.StatusText(w.status)
+		}
+		return status.Error(httpStatusCode(w.status), message)
+	}
+	return nil
+}
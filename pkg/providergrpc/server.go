@@ -0,0 +1,318 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package providergrpc serves the operations of the provider over gRPC, for clients
+// that want typed messages and streams instead of the REST API.
+package providergrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/providerpb"
+	"github.com/openfaas/faas-provider/logs"
+	"github.com/openfaas/faas-provider/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Handlers are the handlers of the REST API that the gRPC service calls, so that
+// both APIs share the validation, events and tracing of each operation
+type Handlers struct {
+	Deploy http.HandlerFunc
+	Update http.HandlerFunc
+	// List is the FunctionReader
+	List http.HandlerFunc
+	// Get is the ReplicaReader, it reads the name from the route variables
+	Get http.HandlerFunc
+	// Scale is the ReplicaUpdater, it reads the name from the route variables
+	Scale  http.HandlerFunc
+	Delete http.HandlerFunc
+}
+
+// Server implements providerpb.ProviderServer
+type Server struct {
+	providerpb.UnimplementedProviderServer
+
+	handlers Handlers
+	logs     logs.Requester
+	watcher  *Watcher
+}
+
+// NewServer creates a Server, the watcher is optional and WatchStatus is
+// unimplemented without it
+func NewServer(handlers Handlers, logs logs.Requester, watcher *Watcher) *Server {
+	return &Server{
+		handlers: handlers,
+		logs:     logs,
+		watcher:  watcher,
+	}
+}
+
+func (s *Server) Deploy(ctx context.Context, req *providerpb.DeployRequest) (*providerpb.DeployResponse, error) {
+	return s.deploy(ctx, s.handlers.Deploy, http.MethodPost, req)
+}
+
+func (s *Server) Update(ctx context.Context, req *providerpb.DeployRequest) (*providerpb.DeployResponse, error) {
+	return s.deploy(ctx, s.handlers.Update, http.MethodPut, req)
+}
+
+func (s *Server) deploy(ctx context.Context, handler http.HandlerFunc, method string, req *providerpb.DeployRequest) (*providerpb.DeployResponse, error) {
+	header, err := call(ctx, handler, method, "/system/functions", nil, toFunctionDeployment(req), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &providerpb.DeployResponse{
+		ResourceVersion: header.Get(handlers.ResourceVersionHeader),
+		Warnings:        header.Values("Warning"),
+	}, nil
+}
+
+func (s *Server) List(ctx context.Context, req *providerpb.ListRequest) (*providerpb.ListResponse, error) {
+	functions := []types.FunctionStatus{}
+	if _, err := call(ctx, s.handlers.List, http.MethodGet, withNamespace("/system/functions", req.Namespace), nil, nil, &functions); err != nil {
+		return nil, err
+	}
+
+	res := &providerpb.ListResponse{}
+	for _, function := range functions {
+		res.Functions = append(res.Functions, toFunction(function))
+	}
+	return res, nil
+}
+
+func (s *Server) Get(ctx context.Context, req *providerpb.GetRequest) (*providerpb.Function, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	function := types.FunctionStatus{}
+	vars := map[string]string{"name": req.Name}
+	if _, err := call(ctx, s.handlers.Get, http.MethodGet, withNamespace("/system/function/"+req.Name, req.Namespace), vars, nil, &function); err != nil {
+		return nil, err
+	}
+	return toFunction(function), nil
+}
+
+func (s *Server) Scale(ctx context.Context, req *providerpb.ScaleRequest) (*providerpb.ScaleResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	body := types.ScaleServiceRequest{
+		ServiceName: req.Name,
+		Replicas:    req.Replicas,
+	}
+	vars := map[string]string{"name": req.Name}
+	if _, err := call(ctx, s.handlers.Scale, http.MethodPost, withNamespace("/system/scale-function/"+req.Name, req.Namespace), vars, body, nil); err != nil {
+		return nil, err
+	}
+	return &providerpb.ScaleResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *providerpb.DeleteRequest) (*providerpb.DeleteResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	body := types.DeleteFunctionRequest{FunctionName: req.Name}
+	if _, err := call(ctx, s.handlers.Delete, http.MethodDelete, withNamespace("/system/functions", req.Namespace), nil, body, nil); err != nil {
+		return nil, err
+	}
+	return &providerpb.DeleteResponse{}, nil
+}
+
+func (s *Server) Logs(req *providerpb.LogsRequest, stream providerpb.Provider_LogsServer) error {
+	if req.Name == "" {
+		return status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	query := logs.Request{
+		Name:      req.Name,
+		Namespace: req.Namespace,
+		Instance:  req.Instance,
+		Tail:      int(req.Tail),
+		Follow:    req.Follow,
+	}
+	if req.Since != nil {
+		since := req.Since.AsTime()
+		query.Since = &since
+	}
+
+	messages, err := s.logs.Query(stream.Context(), query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to read the logs of %s: %s", req.Name, err)
+	}
+
+	for message := range messages {
+		if err := stream.Send(&providerpb.LogMessage{
+			Name:      message.Name,
+			Namespace: message.Namespace,
+			Instance:  message.Instance,
+			Timestamp: timestamppb.New(message.Timestamp),
+			Text:      message.Text,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) WatchStatus(req *providerpb.WatchStatusRequest, stream providerpb.Provider_WatchStatusServer) error {
+	if s.watcher == nil {
+		return status.Error(codes.Unimplemented, "method WatchStatus not implemented")
+	}
+	return s.watcher.Watch(req, stream)
+}
+
+func withNamespace(path, namespace string) string {
+	if namespace == "" {
+		return path
+	}
+	return path + "?namespace=" + url.QueryEscape(namespace)
+}
+
+// call invokes a handler of the REST API with in as its JSON body and decodes the
+// JSON response into out. A response with an error status is returned as a gRPC
+// status with the body of the response as its message.
+func call(ctx context.Context, handler http.HandlerFunc, method, target string, vars map[string]string, in, out interface{}) (http.Header, error) {
+	var body io.Reader = http.NoBody
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		body = bytes.NewReader(b)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+
+	w := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	handler(w, r)
+
+	if w.status >= http.StatusMultipleChoices {
+		return nil, status.Error(httpStatusCode(w.status), strings.TrimSpace(w.body.String()))
+	}
+
+	if out != nil && w.body.Len() > 0 {
+		if err := json.Unmarshal(w.body.Bytes(), out); err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to decode the response: %s", err)
+		}
+	}
+	return w.header, nil
+}
+
+// responseRecorder keeps the response of a handler in memory
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.status = status
+	r.wroteHeader = true
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+// httpStatusCode maps the status of a response from the REST API to a gRPC code
+func httpStatusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Internal
+}
+
+func toFunctionDeployment(req *providerpb.DeployRequest) types.FunctionDeployment {
+	deployment := types.FunctionDeployment{
+		Service:                req.Service,
+		Image:                  req.Image,
+		Namespace:              req.Namespace,
+		EnvProcess:             req.EnvProcess,
+		EnvVars:                req.EnvVars,
+		Constraints:            req.Constraints,
+		Secrets:                req.Secrets,
+		ReadOnlyRootFilesystem: req.ReadOnlyRootFilesystem,
+	}
+	if req.Labels != nil {
+		deployment.Labels = &req.Labels
+	}
+	if req.Annotations != nil {
+		deployment.Annotations = &req.Annotations
+	}
+	if req.Limits != nil {
+		deployment.Limits = &types.FunctionResources{Memory: req.Limits.Memory, CPU: req.Limits.Cpu}
+	}
+	if req.Requests != nil {
+		deployment.Requests = &types.FunctionResources{Memory: req.Requests.Memory, CPU: req.Requests.Cpu}
+	}
+	return deployment
+}
+
+func toFunction(function types.FunctionStatus) *providerpb.Function {
+	res := &providerpb.Function{
+		Name:              function.Name,
+		Namespace:         function.Namespace,
+		Image:             function.Image,
+		EnvProcess:        function.EnvProcess,
+		Replicas:          function.Replicas,
+		AvailableReplicas: function.AvailableReplicas,
+		Secrets:           function.Secrets,
+	}
+	if function.Labels != nil {
+		res.Labels = *function.Labels
+	}
+	if function.Annotations != nil {
+		res.Annotations = *function.Annotations
+	}
+	if !function.CreatedAt.IsZero() {
+		res.CreatedAt = timestamppb.New(function.CreatedAt)
+	}
+	return res
+}
@@ -0,0 +1,240 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package providergrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/providerpb"
+	"github.com/openfaas/faas-netes/pkg/rbac"
+	"github.com/openfaas/faas-provider/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func startTestServer(t *testing.T, server *Server, opts ...grpc.ServerOption) providerpb.ProviderClient {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	providerpb.RegisterProviderServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return providerpb.NewProviderClient(conn)
+}
+
+func Test_Deploy_CallsTheDeployHandler(t *testing.T) {
+	var got types.FunctionDeployment
+	deploy := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("want method POST, got %s", r.Method)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set(handlers.ResourceVersionHeader, "42")
+		w.Header().Add("Warning", `299 - "deprecated"`)
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	client := startTestServer(t, NewServer(Handlers{Deploy: deploy}, nil, nil))
+
+	res, err := client.Deploy(context.Background(), &providerpb.DeployRequest{
+		Service:   "figlet",
+		Image:     "ghcr.io/openfaas/figlet:latest",
+		Namespace: "openfaas-fn",
+		Labels:    map[string]string{"team": "payments"},
+		Limits:    &providerpb.Resources{Memory: "128Mi"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Service != "figlet" || got.Image != "ghcr.io/openfaas/figlet:latest" || got.Namespace != "openfaas-fn" {
+		t.Errorf("unexpected deployment: %+v", got)
+	}
+	if got.Labels == nil || (*got.Labels)["team"] != "payments" {
+		t.Errorf("want the labels to be passed, got %v", got.Labels)
+	}
+	if got.Limits == nil || got.Limits.Memory != "128Mi" {
+		t.Errorf("want the limits to be passed, got %v", got.Limits)
+	}
+
+	if res.ResourceVersion != "42" {
+		t.Errorf("want resource version 42, got %q", res.ResourceVersion)
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("want 1 warning, got %v", res.Warnings)
+	}
+}
+
+func Test_Get_MapsTheStatusOfTheHandler(t *testing.T) {
+	get := func(w http.ResponseWriter, r *http.Request) {
+		if name := mux.Vars(r)["name"]; name != "figlet" {
+			t.Errorf("want name figlet, got %q", name)
+		}
+		if namespace := r.URL.Query().Get("namespace"); namespace != "staging" {
+			t.Errorf("want namespace staging, got %q", namespace)
+		}
+		http.Error(w, "function not found", http.StatusNotFound)
+	}
+
+	client := startTestServer(t, NewServer(Handlers{Get: get}, nil, nil))
+
+	_, err := client.Get(context.Background(), &providerpb.GetRequest{Name: "figlet", Namespace: "staging"})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Fatalf("want code NotFound, got %s", got)
+	}
+	if got := status.Convert(err).Message(); got != "function not found" {
+		t.Errorf("want the body as the message, got %q", got)
+	}
+}
+
+func Test_List_ConvertsTheFunctions(t *testing.T) {
+	list := func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]types.FunctionStatus{
+			{Name: "figlet", Namespace: "openfaas-fn", Replicas: 2, AvailableReplicas: 1},
+		})
+	}
+
+	client := startTestServer(t, NewServer(Handlers{List: list}, nil, nil))
+
+	res, err := client.List(context.Background(), &providerpb.ListRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(res.Functions) != 1 {
+		t.Fatalf("want 1 function, got %d", len(res.Functions))
+	}
+	if function := res.Functions[0]; function.Name != "figlet" || function.Replicas != 2 || function.AvailableReplicas != 1 {
+		t.Errorf("unexpected function: %v", function)
+	}
+}
+
+func Test_AuthorizeInterceptors(t *testing.T) {
+	list := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}
+	deleted := false
+	remove := func(w http.ResponseWriter, r *http.Request) {
+		deleted = true
+	}
+
+	authorizer, err := rbac.New([]rbac.User{
+		{Name: "admin", Password: "secret", Role: rbac.RoleAdmin},
+		{Name: "viewer", Password: "secret", Role: rbac.RoleReader},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unary, stream := AuthorizeInterceptors(authorizer.Require)
+	client := startTestServer(t, NewServer(Handlers{List: list, Delete: remove}, nil, nil),
+		grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream))
+
+	_, err = client.List(context.Background(), &providerpb.ListRequest{})
+	if got := status.Code(err); got != codes.Unauthenticated {
+		t.Errorf("want code Unauthenticated without credentials, got %s", got)
+	}
+
+	wrong := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:wrong")))
+	_, err = client.List(wrong, &providerpb.ListRequest{})
+	if got := status.Code(err); got != codes.Unauthenticated {
+		t.Errorf("want code Unauthenticated with the wrong password, got %s", got)
+	}
+
+	valid := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:secret")))
+	if _, err = client.List(valid, &providerpb.ListRequest{}); err != nil {
+		t.Errorf("want the call to succeed with valid credentials, got %s", err)
+	}
+
+	reader := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("viewer:secret")))
+	if _, err = client.List(reader, &providerpb.ListRequest{}); err != nil {
+		t.Errorf("want a reader to list the functions, got %s", err)
+	}
+	_, err = client.Delete(reader, &providerpb.DeleteRequest{Name: "figlet"})
+	if got := status.Code(err); got != codes.PermissionDenied || deleted {
+		t.Errorf("want code PermissionDenied for a reader that deletes a function, got %s", got)
+	}
+}
+
+func Test_WatchStatus_SendsExistingFunctionsAndChanges(t *testing.T) {
+	newStatefulSet := func(name, resourceVersion string) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "openfaas-fn",
+				ResourceVersion: resourceVersion,
+				Labels:          map[string]string{"faas_function": name},
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: name, Image: "ghcr.io/openfaas/" + name}}},
+				},
+			},
+		}
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(newStatefulSet("figlet", "1"))
+	indexer.Add(newStatefulSet("nodeinfo", "1"))
+
+	watcher := NewWatcher(v1.NewStatefulSetLister(indexer))
+	client := startTestServer(t, NewServer(Handlers{}, nil, watcher))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchStatus(ctx, &providerpb.WatchStatusRequest{Name: "figlet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != providerpb.FunctionEvent_ADDED || event.Function.Name != "figlet" {
+		t.Fatalf("want figlet to be ADDED, got %v", event)
+	}
+
+	// the stream subscribes before listing, so it already receives these
+	watcher.publish(providerpb.FunctionEvent_MODIFIED, newStatefulSet("nodeinfo", "2"))
+	watcher.publish(providerpb.FunctionEvent_DELETED, newStatefulSet("figlet", "2"))
+
+	event, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != providerpb.FunctionEvent_DELETED || event.Function.Name != "figlet" {
+		t.Errorf("want only the change to figlet, got %v", event)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package providergrpc
+
+import (
+	"sync"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/providerpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// subscriberBuffer is the number of events that are queued for a stream before
+// the subscriber is considered too slow and its stream is ended
+const subscriberBuffer = 100
+
+// Watcher relays the changes to the StatefulSets of the functions, as observed by
+// the informer, to the WatchStatus streams
+type Watcher struct {
+	lister v1.StatefulSetLister
+
+	lock        sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	events chan *providerpb.FunctionEvent
+}
+
+// NewWatcher creates a Watcher, RegisterEventHandlers must be called for it to
+// receive any changes
+func NewWatcher(lister v1.StatefulSetLister) *Watcher {
+	return &Watcher{
+		lister:      lister,
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+// RegisterEventHandlers publishes an event whenever the StatefulSet of a function
+// is added, changed or removed
+func (w *Watcher) RegisterEventHandlers(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			w.publish(providerpb.FunctionEvent_ADDED, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldStatefulSet, ok := oldObj.(*appsv1.StatefulSet)
+			if !ok {
+				return
+			}
+			newStatefulSet, ok := newObj.(*appsv1.StatefulSet)
+			if !ok || oldStatefulSet.ResourceVersion == newStatefulSet.ResourceVersion {
+				// a resync of the informer
+				return
+			}
+			w.publish(providerpb.FunctionEvent_MODIFIED, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			w.publish(providerpb.FunctionEvent_DELETED, obj)
+		},
+	})
+}
+
+func (w *Watcher) publish(eventType providerpb.FunctionEvent_Type, obj interface{}) {
+	statefulset, ok := obj.(*appsv1.StatefulSet)
+	if !ok || statefulset == nil {
+		return
+	}
+	if _, ok := statefulset.Labels["faas_function"]; !ok || len(statefulset.Spec.Template.Spec.Containers) == 0 {
+		return
+	}
+
+	event := &providerpb.FunctionEvent{
+		Type:     eventType,
+		Function: toFunction(*k8s.AsFunctionStatus(*statefulset)),
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for s := range w.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			// the informer must never be blocked by a slow stream
+			close(s.events)
+			delete(w.subscribers, s)
+		}
+	}
+}
+
+func (w *Watcher) subscribe() *subscriber {
+	s := &subscriber{events: make(chan *providerpb.FunctionEvent, subscriberBuffer)}
+
+	w.lock.Lock()
+	w.subscribers[s] = struct{}{}
+	w.lock.Unlock()
+
+	return s
+}
+
+func (w *Watcher) unsubscribe(s *subscriber) {
+	w.lock.Lock()
+	delete(w.subscribers, s)
+	w.lock.Unlock()
+}
+
+// Watch sends the functions that match req as ADDED events, followed by each change
+// until the stream is cancelled
+func (w *Watcher) Watch(req *providerpb.WatchStatusRequest, stream providerpb.Provider_WatchStatusServer) error {
+	// the subscription is made before listing so that no change is missed, a
+	// function may be sent twice instead
+	s := w.subscribe()
+	defer w.unsubscribe(s)
+
+	requirement, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	statefulsets, err := w.lister.StatefulSets(req.Namespace).List(labels.NewSelector().Add(*requirement))
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to list functions: %s", err)
+	}
+
+	for _, statefulset := range statefulsets {
+		if req.Name != "" && statefulset.Name != req.Name {
+			continue
+		}
+		if len(statefulset.Spec.Template.Spec.Containers) == 0 {
+			continue
+		}
+		if err := stream.Send(&providerpb.FunctionEvent{
+			Type:     providerpb.FunctionEvent_ADDED,
+			Function: toFunction(*k8s.AsFunctionStatus(*statefulset)),
+		}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-s.events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "the stream fell behind the changes to the functions, watch again to resume")
+			}
+			if req.Namespace != "" && event.Function.Namespace != req.Namespace {
+				continue
+			}
+			if req.Name != "" && event.Function.Name != req.Name {
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
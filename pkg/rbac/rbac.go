@@ -0,0 +1,119 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package rbac authorizes the requests to the provider API with roles.
+//
+// The users and their roles are read from a YAML file, the basic auth user of the
+// gateway is an admin. A reader may list functions, read their logs and reports,
+// a deployer may also deploy, update, scale and delete functions, and an admin may
+// also manage secrets.
+package rbac
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/openfaas/faas-provider/auth"
+	"sigs.k8s.io/yaml"
+)
+
+// Role of a user, each role includes the permissions of the roles before it
+type Role string
+
+const (
+	RoleReader   Role = "reader"
+	RoleDeployer Role = "deployer"
+	RoleAdmin    Role = "admin"
+)
+
+var levels = map[Role]int{
+	RoleReader:   1,
+	RoleDeployer: 2,
+	RoleAdmin:    3,
+}
+
+// Allows returns true when the role includes the permissions of required
+func (r Role) Allows(required Role) bool {
+	return levels[r] >= levels[required]
+}
+
+// Config is the file of the users
+type Config struct {
+	Users []User `json:"users"`
+}
+
+// User of the provider API, authenticated with basic auth
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Role     Role   `json:"role"`
+}
+
+// Authorizer checks the credentials and the role of the user of each request
+type Authorizer struct {
+	users map[string]User
+}
+
+// Load reads the users from path, admin is the basic auth user of the gateway and
+// may be nil
+func Load(path string, admin *auth.BasicAuthCredentials) (*Authorizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read RBAC users: %w", err)
+	}
+
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse RBAC users: %w", err)
+	}
+
+	if admin != nil {
+		config.Users = append(config.Users, User{Name: admin.User, Password: admin.Password, Role: RoleAdmin})
+	}
+
+	return New(config.Users)
+}
+
+// New creates an Authorizer for the users
+func New(users []User) (*Authorizer, error) {
+	a := &Authorizer{users: map[string]User{}}
+	for i, user := range users {
+		if user.Name == "" || user.Password == "" {
+			return nil, fmt.Errorf("user %d requires a name and a password", i)
+		}
+		if _, ok := levels[user.Role]; !ok {
+			return nil, fmt.Errorf("user %s has an invalid role %q, use %s, %s or %s", user.Name, user.Role, RoleReader, RoleDeployer, RoleAdmin)
+		}
+		if _, ok := a.users[user.Name]; ok {
+			return nil, fmt.Errorf("user %s is listed more than once", user.Name)
+		}
+		a.users[user.Name] = user
+	}
+	return a, nil
+}
+
+// Require returns a middleware that only calls next for the users with a role
+// that allows required. Unknown users and invalid passwords are unauthorized,
+// users without the role are forbidden.
+func (a *Authorizer) Require(required Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, password, ok := r.BasicAuth()
+		user, found := a.users[name]
+
+		const noMatch = 0
+		if !ok || !found || subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == noMatch {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		if !user.Role.Allows(required) {
+			http.Error(w, fmt.Sprintf("user %s with role %s requires the role %s", name, user.Role, required), http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
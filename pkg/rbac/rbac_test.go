@@ -0,0 +1,110 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package rbac
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+func Test_Require(t *testing.T) {
+	authorizer, err := New([]User{
+		{Name: "dev", Password: "dev-password", Role: RoleReader},
+		{Name: "ci", Password: "ci-password", Role: RoleDeployer},
+		{Name: "admin", Password: "admin-password", Role: RoleAdmin},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	cases := []struct {
+		name     string
+		user     string
+		password string
+		required Role
+		want     int
+	}{
+		{name: "reader lists functions", user: "dev", password: "dev-password", required: RoleReader, want: http.StatusOK},
+		{name: "reader deploys", user: "dev", password: "dev-password", required: RoleDeployer, want: http.StatusForbidden},
+		{name: "deployer deploys", user: "ci", password: "ci-password", required: RoleDeployer, want: http.StatusOK},
+		{name: "deployer manages secrets", user: "ci", password: "ci-password", required: RoleAdmin, want: http.StatusForbidden},
+		{name: "admin manages secrets", user: "admin", password: "admin-password", required: RoleAdmin, want: http.StatusOK},
+		{name: "invalid password", user: "admin", password: "dev-password", required: RoleReader, want: http.StatusUnauthorized},
+		{name: "unknown user", user: "guest", password: "", required: RoleReader, want: http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/system/functions", nil)
+			req.SetBasicAuth(tc.user, tc.password)
+			rr := httptest.NewRecorder()
+
+			authorizer.Require(tc.required, ok)(rr, req)
+
+			if rr.Code != tc.want {
+				t.Errorf("want status %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func Test_Require_NoCredentials(t *testing.T) {
+	authorizer, _ := New(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/system/functions", nil)
+	rr := httptest.NewRecorder()
+	authorizer.Require(RoleReader, func(w http.ResponseWriter, r *http.Request) {})(rr, req)
+
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("want a basic auth challenge, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+func Test_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rbac.yaml")
+	users := `users:
+- name: dev
+  password: dev-password
+  role: reader
+`
+	if err := os.WriteFile(path, []byte(users), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	authorizer, err := Load(path, &auth.BasicAuthCredentials{User: "admin", Password: "admin-password"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := authorizer.users["dev"].Role; got != RoleReader {
+		t.Errorf("want dev to be a reader, got %q", got)
+	}
+	if got := authorizer.users["admin"].Role; got != RoleAdmin {
+		t.Errorf("want the basic auth user to be an admin, got %q", got)
+	}
+}
+
+func Test_New_Invalid(t *testing.T) {
+	cases := map[string][]User{
+		"missing password": {{Name: "dev", Role: RoleReader}},
+		"unknown role":     {{Name: "dev", Password: "p", Role: "owner"}},
+		"duplicate user": {
+			{Name: "dev", Password: "p", Role: RoleReader},
+			{Name: "dev", Password: "q", Role: RoleAdmin},
+		},
+	}
+
+	for name, users := range cases {
+		if _, err := New(users); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
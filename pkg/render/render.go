@@ -0,0 +1,348 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package render writes the Kubernetes manifests that are needed to run faas-netes,
+// for clusters where the Helm chart can not be used.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// Name is used for the Deployment, Service, ServiceAccount and RBAC of the provider
+const Name = "faas-netes"
+
+// port is where the provider's API is served
+const port = 8081
+
+// Options are the settings of the rendered manifests, they mirror the values of
+// the Helm chart
+type Options struct {
+	// Namespace of the provider
+	Namespace string
+	// FunctionNamespace is where the functions are deployed
+	FunctionNamespace string
+	// ProfilesNamespace is where Profiles are looked up, the default is the
+	// FunctionNamespace
+	ProfilesNamespace string
+	// Image of the provider
+	Image string
+	// ClusterRole grants the provider access to all namespaces, which is needed to
+	// check the nodes and for multiple function namespaces
+	ClusterRole bool
+	// CreateNamespaces adds the Namespace and FunctionNamespace to the manifests
+	CreateNamespaces bool
+
+	// BasicAuth reads the credentials of the API from the basic-auth Secret
+	BasicAuth       bool
+	ReadTimeout     string
+	WriteTimeout    string
+	HTTPProbe       bool
+	SetNonRootUser  bool
+	ImagePullPolicy string
+	MeshMode        string
+	CostLabels      []string
+	LogFormat       string
+	LogLevel        string
+
+	// CRDs are written before the other manifests, as YAML documents
+	CRDs [][]byte
+}
+
+// Render writes the CRDs, namespaces, RBAC, Deployment and Service of faas-netes
+// as a multi-document YAML stream
+func Render(w io.Writer, opts Options) error {
+	if opts.Namespace == "" || opts.FunctionNamespace == "" {
+		return fmt.Errorf("the namespace and function namespace are required")
+	}
+	if opts.Image == "" {
+		return fmt.Errorf("the image is required")
+	}
+	if opts.ProfilesNamespace == "" {
+		opts.ProfilesNamespace = opts.FunctionNamespace
+	}
+
+	for _, crd := range opts.CRDs {
+		if err := writeDocument(w, bytes.TrimPrefix(bytes.TrimSpace(crd), []byte("---\n"))); err != nil {
+			return err
+		}
+	}
+
+	objects := []interface{}{}
+	if opts.CreateNamespaces {
+		objects = append(objects, makeNamespace(opts.Namespace))
+		if opts.FunctionNamespace != opts.Namespace {
+			objects = append(objects, makeNamespace(opts.FunctionNamespace))
+		}
+	}
+	objects = append(objects, makeServiceAccount(opts))
+	objects = append(objects, makeRBAC(opts)...)
+	objects = append(objects, makeDeployment(opts), makeService(opts))
+
+	for _, object := range objects {
+		out, err := marshal(object)
+		if err != nil {
+			return err
+		}
+		if err := writeDocument(w, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// marshal converts the object to YAML without the fields that are only set by the
+// API server, such as the creationTimestamp and the status
+func marshal(object interface{}) ([]byte, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+
+	unstructured.RemoveNestedField(u, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u, "spec", "template", "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u, "status")
+	if spec, ok := u["spec"].(map[string]interface{}); ok && len(spec) == 0 {
+		delete(u, "spec")
+	}
+
+	return yaml.Marshal(u)
+}
+
+func writeDocument(w io.Writer, document []byte) error {
+	if _, err := fmt.Fprintf(w, "---\n%s\n", bytes.TrimSpace(document)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func labels() map[string]string {
+	return map[string]string{
+		"app":       Name,
+		"component": Name,
+	}
+}
+
+func makeNamespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}
+}
+
+func makeServiceAccount(opts Options) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: opts.Namespace, Labels: labels()},
+	}
+}
+
+// functionRules are needed in the function namespace, functions are deployed as
+// StatefulSets with a PersistentVolumeClaim for each replica, and the groups of
+// functions are kept in ConfigMaps
+func functionRules() []rbacv1.PolicyRule {
+	all := []string{"get", "list", "watch", "create", "delete", "update", "patch"}
+	read := []string{"get", "list", "watch"}
+
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: all},
+		{APIGroups: []string{"apps"}, Resources: []string{"statefulsets", "daemonsets"}, Verbs: all},
+		{APIGroups: []string{""}, Resources: []string{"secrets", "configmaps"}, Verbs: all},
+		{APIGroups: []string{""}, Resources: []string{"pods", "pods/log", "endpoints", "persistentvolumeclaims", "resourcequotas"}, Verbs: read},
+		{APIGroups: []string{""}, Resources: []string{"pods/eviction"}, Verbs: []string{"create"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"controllerrevisions"}, Verbs: []string{"get", "list", "delete"}},
+		{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"get", "list", "watch", "create", "patch"}},
+		{APIGroups: []string{"discovery.k8s.io"}, Resources: []string{"endpointslices"}, Verbs: read},
+		{APIGroups: []string{"secrets-store.csi.x-k8s.io"}, Resources: []string{"secretproviderclasses"}, Verbs: []string{"get", "create", "update", "patch", "delete"}},
+		{APIGroups: []string{"keda.sh"}, Resources: []string{"scaledobjects"}, Verbs: []string{"get", "create", "update", "patch", "delete"}},
+		{APIGroups: []string{"networking.k8s.io"}, Resources: []string{"ingresses"}, Verbs: []string{"get", "create", "update", "patch", "delete"}},
+		{APIGroups: []string{"gateway.networking.k8s.io"}, Resources: []string{"httproutes"}, Verbs: []string{"get", "create", "update", "patch", "delete"}},
+		{APIGroups: []string{"cert-manager.io"}, Resources: []string{"certificates"}, Verbs: []string{"get", "create", "update", "patch", "delete"}},
+		{APIGroups: []string{"networking.k8s.io"}, Resources: []string{"networkpolicies"}, Verbs: []string{"get", "create", "update", "patch", "delete"}},
+		{APIGroups: []string{"cilium.io"}, Resources: []string{"ciliumnetworkpolicies"}, Verbs: []string{"get", "create", "update", "patch", "delete"}},
+		{APIGroups: []string{"autoscaling"}, Resources: []string{"horizontalpodautoscalers"}, Verbs: []string{"get", "create", "update", "patch", "delete"}},
+	}
+}
+
+func profileRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{"openfaas.com"}, Resources: []string{"profiles"}, Verbs: []string{"get", "list", "watch"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list", "watch"}},
+	}
+}
+
+func makeRBAC(opts Options) []interface{} {
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: Name, Namespace: opts.Namespace}}
+
+	if opts.ClusterRole {
+		rules := append(functionRules(), profileRules()...)
+		rules = append(rules,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "list", "watch"}},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list", "watch"}},
+		)
+
+		return []interface{}{
+			&rbacv1.ClusterRole{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+				ObjectMeta: metav1.ObjectMeta{Name: Name, Labels: labels()},
+				Rules:      rules,
+			},
+			&rbacv1.ClusterRoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: Name, Labels: labels()},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: Name},
+				Subjects:   subjects,
+			},
+		}
+	}
+
+	roles := []struct {
+		name, namespace string
+		rules           []rbacv1.PolicyRule
+	}{
+		{name: Name, namespace: opts.FunctionNamespace, rules: functionRules()},
+	}
+	if opts.ProfilesNamespace == opts.FunctionNamespace {
+		roles[0].rules = append(roles[0].rules, profileRules()...)
+	} else {
+		roles = append(roles, struct {
+			name, namespace string
+			rules           []rbacv1.PolicyRule
+		}{name: Name + "-profiles", namespace: opts.ProfilesNamespace, rules: profileRules()})
+	}
+
+	objects := []interface{}{}
+	for _, role := range roles {
+		objects = append(objects,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: role.name, Namespace: role.namespace, Labels: labels()},
+				Rules:      role.rules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: role.name, Namespace: role.namespace, Labels: labels()},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: role.name},
+				Subjects:   subjects,
+			})
+	}
+	return objects
+}
+
+func makeEnv(opts Options) []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{Name: "port", Value: strconv.Itoa(port)},
+		{Name: "function_namespace", Value: opts.FunctionNamespace},
+		{Name: "profiles_namespace", Value: opts.ProfilesNamespace},
+		{Name: "read_timeout", Value: opts.ReadTimeout},
+		{Name: "write_timeout", Value: opts.WriteTimeout},
+		{Name: "http_probe", Value: strconv.FormatBool(opts.HTTPProbe)},
+		{Name: "set_nonroot_user", Value: strconv.FormatBool(opts.SetNonRootUser)},
+		{Name: "cost_labels", Value: strings.Join(opts.CostLabels, ",")},
+	}
+	if opts.ImagePullPolicy != "" {
+		env = append(env, corev1.EnvVar{Name: "image_pull_policy", Value: opts.ImagePullPolicy})
+	}
+	if opts.MeshMode != "" {
+		env = append(env, corev1.EnvVar{Name: "mesh_mode", Value: opts.MeshMode})
+	}
+	if opts.BasicAuth {
+		env = append(env,
+			corev1.EnvVar{Name: "basic_auth", Value: "true"},
+			corev1.EnvVar{Name: "secret_mount_path", Value: "/var/secrets"})
+	}
+	return env
+}
+
+func makeDeployment(opts Options) *appsv1.Deployment {
+	replicas := int32(1)
+	readOnly := true
+	runAsUser := int64(10001)
+
+	args := []string{"./faas-netes", "controller"}
+	if opts.LogFormat != "" {
+		args = append(args, "-log-format="+opts.LogFormat)
+	}
+	if opts.LogLevel != "" {
+		args = append(args, "-log-level="+opts.LogLevel)
+	}
+
+	volumes := []corev1.Volume{
+		{Name: "faas-netes-temp-volume", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "faas-netes-temp-volume", MountPath: "/tmp"},
+	}
+	if opts.BasicAuth {
+		volumes = append(volumes, corev1.Volume{
+			Name:         "auth",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "basic-auth"}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: "auth", MountPath: "/var/secrets", ReadOnly: true})
+	}
+
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: opts.Namespace, Labels: labels()},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": Name}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels()},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: Name,
+					Volumes:            volumes,
+					Containers: []corev1.Container{{
+						Name:            Name,
+						Image:           opts.Image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Command:         args,
+						Env:             makeEnv(opts),
+						Ports:           []corev1.ContainerPort{{ContainerPort: port, Protocol: corev1.ProtocolTCP}},
+						VolumeMounts:    mounts,
+						SecurityContext: &corev1.SecurityContext{
+							ReadOnlyRootFilesystem: &readOnly,
+							RunAsUser:              &runAsUser,
+						},
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{
+								HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(port)},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func makeService(opts Options) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: opts.Namespace, Labels: labels()},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{"app": Name},
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Port:       port,
+				TargetPort: intstr.FromInt(port),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+}
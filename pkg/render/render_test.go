@@ -0,0 +1,107 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+type document struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+func renderDocuments(t *testing.T, opts Options) ([]document, string) {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := Render(&out, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	documents := []document{}
+	for _, part := range strings.Split(out.String(), "---\n") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		d := document{}
+		if err := yaml.Unmarshal([]byte(part), &d); err != nil {
+			t.Fatalf("invalid YAML document: %s\n%s", err, part)
+		}
+		documents = append(documents, d)
+	}
+	return documents, out.String()
+}
+
+func kinds(documents []document) string {
+	names := []string{}
+	for _, d := range documents {
+		names = append(names, d.Kind+"/"+d.Metadata.Namespace+"/"+d.Metadata.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func Test_Render_Role(t *testing.T) {
+	documents, out := renderDocuments(t, Options{
+		Namespace:         "openfaas",
+		FunctionNamespace: "openfaas-fn",
+		ProfilesNamespace: "openfaas",
+		Image:             "ghcr.io/openfaas/faas-netes:latest",
+		CreateNamespaces:  true,
+		MeshMode:          "linkerd",
+		CRDs:              [][]byte{[]byte("---\napiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: functions.openfaas.com\n")},
+	})
+
+	want := "CustomResourceDefinition//functions.openfaas.com," +
+		"Namespace//openfaas,Namespace//openfaas-fn," +
+		"ServiceAccount/openfaas/faas-netes," +
+		"Role/openfaas-fn/faas-netes,RoleBinding/openfaas-fn/faas-netes," +
+		"Role/openfaas/faas-netes-profiles,RoleBinding/openfaas/faas-netes-profiles," +
+		"Deployment/openfaas/faas-netes,Service/openfaas/faas-netes"
+	if got := kinds(documents); got != want {
+		t.Fatalf("want %s\ngot  %s", want, got)
+	}
+
+	for _, s := range []string{"- statefulsets", "- persistentvolumeclaims", "name: mesh_mode\n          value: linkerd"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("want %q in the manifests", s)
+		}
+	}
+	if strings.Contains(out, "creationTimestamp") {
+		t.Errorf("want no creationTimestamp in the manifests")
+	}
+}
+
+func Test_Render_ClusterRole(t *testing.T) {
+	documents, out := renderDocuments(t, Options{
+		Namespace:         "openfaas",
+		FunctionNamespace: "openfaas-fn",
+		Image:             "ghcr.io/openfaas/faas-netes:latest",
+		ClusterRole:       true,
+	})
+
+	want := "ServiceAccount/openfaas/faas-netes," +
+		"ClusterRole//faas-netes,ClusterRoleBinding//faas-netes," +
+		"Deployment/openfaas/faas-netes,Service/openfaas/faas-netes"
+	if got := kinds(documents); got != want {
+		t.Fatalf("want %s\ngot  %s", want, got)
+	}
+
+	if !strings.Contains(out, "- nodes") {
+		t.Errorf("want the ClusterRole to grant access to the nodes")
+	}
+}
+
+func Test_Render_RequiresImage(t *testing.T) {
+	if err := Render(&bytes.Buffer{}, Options{Namespace: "openfaas", FunctionNamespace: "openfaas-fn"}); err == nil {
+		t.Fatalf("want an error without an image")
+	}
+}
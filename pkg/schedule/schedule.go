@@ -0,0 +1,190 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package schedule parses the scaling windows of a function, each window is a cron
+// expression and the replicas that the function is scaled to when it fires.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Annotation holds the windows of a function separated by ";", for example
+// "0 8 * * 1-5=10; 0 20 * * *=2" scales to 10 replicas at 08:00 on weekdays and
+// back to 2 replicas at 20:00 every day
+const Annotation = "com.openfaas.scale.schedule"
+
+// Window scales a function to Replicas each time Cron fires
+type Window struct {
+	Cron     Cron
+	Replicas int32
+}
+
+// Parse reads the windows from the value of the annotation
+func Parse(value string) ([]Window, error) {
+	var windows []Window
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		i := strings.LastIndex(part, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("window %q must be in the form CRON=REPLICAS", part)
+		}
+
+		cron, err := ParseCron(strings.TrimSpace(part[:i]))
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %w", part, err)
+		}
+
+		replicas, err := strconv.ParseInt(strings.TrimSpace(part[i+1:]), 10, 32)
+		if err != nil || replicas < 0 {
+			return nil, fmt.Errorf("window %q: replicas must be a number of zero or more", part)
+		}
+
+		windows = append(windows, Window{Cron: cron, Replicas: int32(replicas)})
+	}
+
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no windows in %q", value)
+	}
+	return windows, nil
+}
+
+// maxCatchUp bounds how far back Due looks for windows that were missed
+const maxCatchUp = 24 * time.Hour
+
+// Due returns the replicas of the last window that fired after since and at or
+// before now, ok is false when none fired. Times are compared to the minute, in the
+// location of now, and windows older than a day are ignored.
+func Due(windows []Window, since, now time.Time) (replicas int32, ok bool) {
+	if now.Sub(since) > maxCatchUp {
+		since = now.Add(-maxCatchUp)
+	}
+	since = since.In(now.Location())
+
+	for t := since.Truncate(time.Minute).Add(time.Minute); !t.After(now); t = t.Add(time.Minute) {
+		for _, window := range windows {
+			if window.Cron.Matches(t) {
+				replicas, ok = window.Replicas, true
+			}
+		}
+	}
+	return replicas, ok
+}
+
+// Cron is a standard five field cron expression: minute, hour, day of month, month
+// and day of week. Each field is "*", a number, a range such as "1-5", a step such
+// as "*/15" or "0-30/10", or a comma separated list of these.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+
+	// the day matches when either the day of month or day of week matches, unless
+	// one of them is "*"
+	domStar, dowStar bool
+}
+
+// ParseCron parses a five field cron expression
+func ParseCron(expr string) (Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Cron{}, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var c Cron
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return Cron{}, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return Cron{}, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return Cron{}, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12); err != nil {
+		return Cron{}, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return Cron{}, fmt.Errorf("day of week: %w", err)
+	}
+
+	// 7 is also Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+
+	return c, nil
+}
+
+// Matches returns true when the expression fires in the minute of t
+func (c Cron) Matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 ||
+		c.hour&(1<<uint(t.Hour())) == 0 ||
+		c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+
+		start, end := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			start = value
+			// a single value with a step runs to the end of the field
+			if strings.Contains(part, "/") {
+				end = max
+			} else {
+				end = value
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is out of the range %d-%d", part, min, max)
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
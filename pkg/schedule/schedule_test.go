@@ -0,0 +1,86 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ParseCron_Matches(t *testing.T) {
+	// 2023-06-05 is a Monday
+	monday := time.Date(2023, 6, 5, 8, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		expr string
+		time time.Time
+		want bool
+	}{
+		{expr: "0 8 * * 1-5", time: monday, want: true},
+		{expr: "0 8 * * 1-5", time: monday.AddDate(0, 0, 5), want: false},
+		{expr: "0 8 * * 1-5", time: monday.Add(time.Minute), want: false},
+		{expr: "*/15 * * * *", time: monday.Add(45 * time.Minute), want: true},
+		{expr: "*/15 * * * *", time: monday.Add(50 * time.Minute), want: false},
+		{expr: "0 8,20 * * *", time: monday.Add(12 * time.Hour), want: true},
+		{expr: "0 8 * * 7", time: monday.AddDate(0, 0, 6), want: true},
+		{expr: "0 8 1 * *", time: monday, want: false},
+		// either the day of month or the day of week matches when both are set
+		{expr: "0 8 1 * 1", time: monday, want: true},
+		{expr: "0 8 5 6 *", time: monday, want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr+" "+tc.time.Format(time.RFC3339), func(t *testing.T) {
+			cron, err := ParseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := cron.Matches(tc.time); got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("want an error for %q", expr)
+		}
+	}
+}
+
+func Test_Parse(t *testing.T) {
+	windows, err := Parse("0 8 * * 1-5=10; 0 20 * * *=2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(windows) != 2 || windows[0].Replicas != 10 || windows[1].Replicas != 2 {
+		t.Errorf("unexpected windows: %+v", windows)
+	}
+
+	for _, value := range []string{"", "0 8 * * *", "0 8 * * *=-1", "0 8 * *=1"} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("want an error for %q", value)
+		}
+	}
+}
+
+func Test_Due(t *testing.T) {
+	windows, _ := Parse("0 8 * * *=10; 0 20 * * *=2")
+	morning := time.Date(2023, 6, 5, 8, 0, 0, 0, time.UTC)
+
+	if replicas, ok := Due(windows, morning.Add(-time.Minute), morning); !ok || replicas != 10 {
+		t.Errorf("want 10 replicas at 08:00, got %d %v", replicas, ok)
+	}
+
+	if _, ok := Due(windows, morning, morning.Add(time.Minute)); ok {
+		t.Error("want no window after 08:00")
+	}
+
+	// the last of the windows that were missed is used
+	if replicas, ok := Due(windows, morning.Add(-time.Hour), morning.Add(13*time.Hour)); !ok || replicas != 2 {
+		t.Errorf("want 2 replicas after 20:00, got %d %v", replicas, ok)
+	}
+}
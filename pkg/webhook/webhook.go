@@ -0,0 +1,98 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package webhook validates Functions created or updated through the Kubernetes
+// API with a validating admission webhook, using the same rules as the REST API.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	"github.com/openfaas/faas-netes/pkg/controller"
+	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/logging"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxReviewSize is the largest AdmissionReview that is read, the API server limits
+// objects to a few MB
+const maxReviewSize = 6 * 1024 * 1024
+
+// MakeValidatingHandler reviews the Functions sent by the API server in an
+// AdmissionReview, other kinds and deletions are always allowed
+func MakeValidatingHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil {
+			http.Error(w, "an AdmissionReview is required", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxReviewSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		review := admissionv1.AdmissionReview{}
+		if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+			http.Error(w, "an AdmissionReview is required", http.StatusBadRequest)
+			return
+		}
+
+		response := Review(review.Request)
+		if !response.Allowed {
+			logging.FromContext(r.Context()).Info("Rejected Function",
+				"function", review.Request.Name, "namespace", review.Request.Namespace, "reason", response.Result.Message)
+		}
+
+		out, err := json.Marshal(admissionv1.AdmissionReview{
+			TypeMeta: review.TypeMeta,
+			Response: response,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(out)
+	}
+}
+
+// Review validates the Function in the request
+func Review(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+
+	if request.Kind.Kind != "Function" || request.Operation == admissionv1.Delete {
+		return response
+	}
+
+	function := faasv1.Function{}
+	if err := json.Unmarshal(request.Object.Raw, &function); err != nil {
+		return deny(response, http.StatusBadRequest, fmt.Errorf("unable to decode the Function: %w", err))
+	}
+
+	deployment := controller.FunctionRequest(&function)
+	if err := handlers.ValidateDeployRequest(&deployment); err != nil {
+		return deny(response, http.StatusUnprocessableEntity, err)
+	}
+	return response
+}
+
+func deny(response *admissionv1.AdmissionResponse, code int32, err error) *admissionv1.AdmissionResponse {
+	response.Allowed = false
+	response.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Message: err.Error(),
+	}
+	return response
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 OpenFaaS Author(s)
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	faasv1 "github.com/openfaas/faas-netes/pkg/apis/openfaas/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newReview(t *testing.T, operation admissionv1.Operation, function faasv1.Function) admissionv1.AdmissionReview {
+	raw, err := json.Marshal(function)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "d5f6bb11",
+			Kind:      metav1.GroupVersionKind{Group: "openfaas.com", Version: "v1", Kind: "Function"},
+			Name:      function.Name,
+			Namespace: "openfaas-fn",
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+func review(t *testing.T, in admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	body, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body))
+	MakeValidatingHandler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	out := admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Response == nil || out.Response.UID != in.Request.UID {
+		t.Fatalf("want a response for the request %s, got %+v", in.Request.UID, out.Response)
+	}
+	if out.APIVersion != "admission.k8s.io/v1" {
+		t.Errorf("want the apiVersion of the request, got %q", out.APIVersion)
+	}
+	return out.Response
+}
+
+func Test_MakeValidatingHandler_AllowsValidFunction(t *testing.T) {
+	function := faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet"},
+		Spec:       faasv1.FunctionSpec{Name: "figlet", Image: "ghcr.io/openfaas/figlet:latest"},
+	}
+
+	response := review(t, newReview(t, admissionv1.Create, function))
+	if !response.Allowed {
+		t.Errorf("want the Function to be allowed, got %+v", response.Result)
+	}
+}
+
+func Test_MakeValidatingHandler_RejectsInvalidFunction(t *testing.T) {
+	function := faasv1.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet"},
+		Spec: faasv1.FunctionSpec{
+			Name:        "figlet",
+			Image:       "ghcr.io/openfaas/figlet:latest",
+			Annotations: &map[string]string{"com.openfaas.health.type": "grpc"},
+		},
+	}
+
+	response := review(t, newReview(t, admissionv1.Update, function))
+	if response.Allowed {
+		t.Fatal("want the Function to be rejected")
+	}
+	if response.Result == nil || response.Result.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want status code %d, got %+v", http.StatusUnprocessableEntity, response.Result)
+	}
+}
+
+func Test_MakeValidatingHandler_AllowsDelete(t *testing.T) {
+	function := faasv1.Function{ObjectMeta: metav1.ObjectMeta{Name: "figlet"}}
+
+	response := review(t, newReview(t, admissionv1.Delete, function))
+	if !response.Allowed {
+		t.Errorf("want the deletion to be allowed, got %+v", response.Result)
+	}
+}
+
+func Test_MakeValidatingHandler_RequiresReview(t *testing.T) {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader([]byte(`{}`)))
+	MakeValidatingHandler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("want status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
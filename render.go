@@ -0,0 +1,80 @@
+// Copyright (c) OpenFaaS Author(s) 2020. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"embed"
+	"flag"
+	"io"
+	"io/fs"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/render"
+	version "github.com/openfaas/faas-netes/version"
+)
+
+// crds are the CRDs of the Functions and Profiles, the IAM CRDs are only used
+// by OpenFaaS Pro
+//
+//go:embed artifacts/crds/openfaas.com_functions.yaml artifacts/crds/openfaas.com_profiles.yaml
+var crds embed.FS
+
+// runRender writes the manifests to install faas-netes without Helm, the flags
+// follow the values of the chart
+func runRender(args []string, w io.Writer) error {
+	opts := render.Options{}
+	var costLabels string
+	var skipCRDs bool
+
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.StringVar(&opts.Namespace, "namespace", "openfaas", "Namespace of faas-netes")
+	flags.StringVar(&opts.FunctionNamespace, "function-namespace", "openfaas-fn", "Namespace that functions are deployed to")
+	flags.StringVar(&opts.ProfilesNamespace, "profiles-namespace", "", "Namespace of the Profiles, defaults to the function namespace")
+	flags.StringVar(&opts.Image, "image", "ghcr.io/openfaas/faas-netes:"+defaultImageTag(), "Image of faas-netes")
+	flags.BoolVar(&opts.ClusterRole, "cluster-role", false, "Use a ClusterRole, required to check the architectures of nodes")
+	flags.BoolVar(&opts.CreateNamespaces, "create-namespaces", true, "Include the namespaces in the manifests")
+	flags.BoolVar(&opts.BasicAuth, "basic-auth", true, "Authenticate the API with the credentials in the basic-auth Secret")
+	flags.StringVar(&opts.ReadTimeout, "read-timeout", "60s", "Read timeout of the API")
+	flags.StringVar(&opts.WriteTimeout, "write-timeout", "60s", "Write timeout of the API")
+	flags.BoolVar(&opts.HTTPProbe, "http-probe", true, "Use HTTP probes for the functions instead of exec")
+	flags.BoolVar(&opts.SetNonRootUser, "set-nonroot-user", false, "Run the functions as a non-root user")
+	flags.StringVar(&opts.ImagePullPolicy, "image-pull-policy", "Always", "Pull policy of the images of functions")
+	flags.StringVar(&opts.MeshMode, "mesh-mode", "", "Add functions to a service mesh, istio or linkerd")
+	flags.StringVar(&costLabels, "cost-labels", "team,project", "Comma separated labels of functions that are used for cost allocation")
+	flags.StringVar(&opts.LogFormat, "log-format", "", "Format of the logs, json or text")
+	flags.StringVar(&opts.LogLevel, "log-level", "", "Level of the logs, error, info, debug or a verbosity number")
+	flags.BoolVar(&skipCRDs, "skip-crds", false, "Leave out the CRDs, when they are installed separately")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := k8s.ValidateMeshMode(opts.MeshMode); err != nil {
+		return err
+	}
+	opts.CostLabels = k8s.ParseCostLabels(costLabels)
+
+	if !skipCRDs {
+		files, err := fs.Glob(crds, "artifacts/crds/*.yaml")
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			crd, err := crds.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			opts.CRDs = append(opts.CRDs, crd)
+		}
+	}
+
+	return render.Render(w, opts)
+}
+
+// defaultImageTag is the version of this build, or latest for a development build
+func defaultImageTag() string {
+	if release := version.BuildVersion(); release != version.DevVersion {
+		return release
+	}
+	return "latest"
+}